@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/archive"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// tenantExport writes the archive of a tenant, its rows and stored files, to a zip file.
+func tenantExport(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("tenant export")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	out := fs.String("out", "", "Archive file to write, e.g. acme.zip")
+	withoutCredentials := fs.Bool("without-credentials", false, "Leave out password hashes and private keys")
+	if err := parse(fs, args, "tenant", "out"); err != nil {
+		return err
+	}
+	id, err := tenantID(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	m, err := archive.Export(ctx, id, f, archive.ExportOptions{Store: store, WithoutCredentials: *withoutCredentials})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	audit(ctx, id, 0, "tenant.exported", fmt.Sprintf("%d users, %d files", m.Tables["users"], len(m.Files)))
+	fmt.Printf("Tenant %s exported to %s: %d users, %d files\n", m.Subdomain, *out, m.Tables["users"], len(m.Files))
+	return nil
+}
+
+// tenantImport creates a new tenant from an archive written by tenant export.
+func tenantImport(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("tenant import")
+	in := fs.String("in", "", "Archive file to read")
+	subdomain := fs.String("subdomain", "", "Subdomain of the new tenant, the archived one when empty")
+	name := fs.String("name", "", "Name of the new tenant, the archived one when empty")
+	email := fs.String("email", "", "Contact email of the new tenant, the archived one when empty")
+	if err := parse(fs, args, "in"); err != nil {
+		return err
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	id, err := archive.Import(ctx, f, info.Size(), archive.ImportOptions{
+		Config:    cfg,
+		Subdomain: *subdomain,
+		Name:      *name,
+		Email:     *email,
+		Store:     storage.Metered(store),
+	})
+	if id == 0 {
+		if errors.Is(err, multitenant.ErrInvalidSubdomain) {
+			return fmt.Errorf("%w, choose another with -subdomain", err)
+		}
+		return err
+	}
+	audit(ctx, id, 0, "tenant.imported", "from "+*in)
+	if err != nil {
+		return fmt.Errorf("tenant %d created without all its files: %w", id, err)
+	}
+	sub, err := models.GetTenantSubdomain(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tenant %d imported: %s\n", id, urls.Subdomain(cfg, sub, "/", nil))
+	return nil
+}
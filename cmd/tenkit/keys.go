@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+)
+
+// keysRotate gives a tenant, or every tenant, a new data key and re-encrypts its encrypted columns,
+// including the values written before they were encrypted. With -drop-retired the previous data
+// keys are deleted afterwards.
+func keysRotate(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("keys rotate")
+	subdomain := fs.String("tenant", "", "Tenant subdomain, every tenant when empty")
+	dropRetired := fs.Bool("drop-retired", false, "Delete the previous data keys; values of unregistered columns they encrypted become unreadable")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var tenants []models.TenantSummary
+	if *subdomain != "" {
+		id, err := tenantID(ctx, *subdomain)
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, models.TenantSummary{ID: id, Subdomain: *subdomain})
+	} else {
+		var err error
+		if tenants, err = models.ListTenants(ctx); err != nil {
+			return err
+		}
+	}
+	for _, t := range tenants {
+		n, err := crypto.Rotate(ctx, t.ID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Subdomain, err)
+		}
+		details := fmt.Sprintf("%d values re-encrypted", n)
+		if *dropRetired {
+			dropped, err := crypto.DropRetired(ctx, t.ID)
+			switch {
+			case errors.Is(err, models.ErrLegalHold):
+				details += ", retired keys kept (legal hold)"
+			case err != nil:
+				return fmt.Errorf("%s: %w", t.Subdomain, err)
+			default:
+				details += fmt.Sprintf(", %d retired keys deleted", dropped)
+			}
+		}
+		audit(ctx, t.ID, 0, "crypto.key_rotated", details)
+		fmt.Printf("Data key of %s rotated: %s\n", t.Subdomain, details)
+	}
+	return nil
+}
+
+// keysRewrap wraps the data keys with TENKIT_MASTER_KEY after it changed; the replaced master key
+// must still be in TENKIT_MASTER_KEY_PREVIOUS.
+func keysRewrap(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	if err := parse(newFlags("keys rewrap"), args); err != nil {
+		return err
+	}
+	n, err := crypto.Rewrap(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		audit(ctx, 0, 0, "crypto.keys_rewrapped", fmt.Sprintf("%d data keys, master key %s", n, crypto.MasterKeyID()))
+	}
+	fmt.Printf("%d data keys rewrapped with master key %s\n", n, crypto.MasterKeyID())
+	return nil
+}
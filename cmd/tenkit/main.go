@@ -0,0 +1,262 @@
+// Command tenkit runs operational tasks against the database of a tenkit deployment, so that
+// operators do not have to edit SQLite by hand. It reads the same configuration as the server:
+// .env, TENKIT_CONFIG, the environment and the SECRETS_PROVIDER secrets. Run it from the
+// directory the server runs from.
+//
+//	tenkit migrate
+//	tenkit tenant create -name Acme -owner admin@acme.test [-subdomain acme] [-plan pro] [-parent agency] [-password-stdin]
+//	tenkit tenant list
+//	tenkit tenant suspend -tenant acme -reason "unpaid invoice"
+//	tenkit tenant export -tenant acme -out acme.zip [-without-credentials]
+//	tenkit tenant import -in acme.zip [-subdomain acme2] [-name "Acme 2"] [-email ops@acme.test]
+//	tenkit user create -tenant acme -email bob@acme.test [-role member] [-password-stdin]
+//	echo "$PASSWORD" | tenkit user set-password -tenant acme -email bob@acme.test
+//	tenkit user promote -tenant acme -email bob@acme.test [-role admin]
+//	tenkit invite -tenant acme [-role member] [-days 7] [-max-uses 1]
+//	tenkit maintenance on [-tenant acme] [-message "Database upgrade"] [-retry-after 30m]
+//	tenkit maintenance off [-tenant acme]
+//	tenkit maintenance status
+//	tenkit sessions purge [-tenant acme]
+//	tenkit search reindex [-tenant acme]
+//	tenkit keys rotate [-tenant acme] [-drop-retired]
+//	tenkit keys rewrap
+//	tenkit i18n check
+//
+// Changes are recorded in the audit log, marked [cli].
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cache"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/maintenance"
+	"github.com/pandamasta/tenkit/multitenant/notify"
+	"github.com/pandamasta/tenkit/multitenant/realtime"
+	"github.com/pandamasta/tenkit/multitenant/secrets"
+	"github.com/pandamasta/tenkit/multitenant/webhooks"
+)
+
+// command is a subcommand; run receives the arguments that follow its name.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, cfg *multitenant.Config, args []string) error
+	noDB    bool // Runs without opening the database
+}
+
+var commands = []command{
+	{name: "migrate", summary: "Create the tables and apply the column migrations", run: migrate},
+	{name: "tenant create", summary: "Create an active tenant and its owner", run: tenantCreate},
+	{name: "tenant list", summary: "List the tenants and their state", run: tenantList},
+	{name: "tenant suspend", summary: "Take a tenant offline", run: tenantSuspend},
+	{name: "tenant export", summary: "Write a tenant, its members, settings and files to an archive", run: tenantExport},
+	{name: "tenant import", summary: "Create a tenant from an archive", run: tenantImport},
+	{name: "user create", summary: "Create a verified member of a tenant", run: userCreate},
+	{name: "user set-password", summary: "Set the password of a user and end their sessions", run: userSetPassword},
+	{name: "user promote", summary: "Change the role of a member", run: userPromote},
+	{name: "invite", summary: "Create a signup link and print its URL", run: invite},
+	{name: "maintenance on", summary: "Put the platform or a tenant in maintenance", run: maintenanceOn},
+	{name: "maintenance off", summary: "End the maintenance of the platform or a tenant", run: maintenanceOff},
+	{name: "maintenance status", summary: "List the maintenance windows in progress", run: maintenanceStatus},
+	{name: "sessions purge", summary: "Delete expired sessions, or every session of a tenant", run: sessionsPurge},
+	{name: "keys rotate", summary: "Give tenants new data keys and re-encrypt their columns", run: keysRotate},
+	{name: "keys rewrap", summary: "Wrap the data keys with the current master key", run: keysRewrap},
+	{name: "search reindex", summary: "Rebuild the search index of a tenant or of every tenant", run: searchReindex},
+	{name: "i18n check", summary: "Report missing, unknown and mismatched translations", run: i18nCheck, noDB: true},
+}
+
+// errUsage reports invalid arguments; the flag set already printed the details.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	cmd, args := lookup(os.Args[1:])
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	// Only warnings and errors of the library go to stderr; stdout carries the results
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	ctx := context.Background()
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tenkit:", err)
+		os.Exit(1)
+	}
+	if !cmd.noDB {
+		db.DSN = cfg.Database.DSN
+		db.Init()
+		crypto.Configure(cfg)
+		maintenance.Configure(cfg.Maintenance)
+		if err := maintenance.Load(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "tenkit:", err)
+			os.Exit(1)
+		}
+		// Lifecycle events reach the webhooks queue, delivered by the running server, notifications and,
+		// through Redis, the live updates of the running servers
+		models.OnTenantTransition(events.OnTransition)
+		events.Subscribe(events.All, webhooks.Forward)
+		if cfg.Routes.Enabled(multitenant.FlowNotifications) {
+			events.Subscribe(events.All, notify.Forward)
+		}
+		if cfg.Routes.Enabled(multitenant.FlowRealtime) && cfg.Realtime.Backend == "redis" {
+			hub, err := realtime.New(cfg.Realtime)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "tenkit:", err)
+				os.Exit(1)
+			}
+			realtime.SetHub(hub)
+			events.Subscribe(events.All, realtime.Forward(cfg))
+		}
+		// Changes made here drop the sessions and tenants the running servers share through Redis
+		if cfg.Cache.Backend == "redis" {
+			c, err := cache.New(cfg.Cache)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "tenkit:", err)
+				os.Exit(1)
+			}
+			cache.SetCache(c)
+			cache.Watch()
+			shared := multitenant.NewCachedFetcher(nil, c, cfg.TenantCache)
+			models.OnTenantChange(shared.InvalidateTenant)
+			models.OnTenantTransition(func(_ context.Context, t models.TenantTransition) { shared.Invalidate(t.Subdomain) })
+		}
+	}
+
+	if err := cmd.run(ctx, cfg, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "tenkit:", err)
+		os.Exit(1)
+	}
+}
+
+// lookup returns the command named by the first one or two arguments and the remaining arguments.
+func lookup(args []string) (*command, []string) {
+	for n := 2; n >= 1; n-- {
+		if len(args) < n {
+			continue
+		}
+		name := strings.Join(args[:n], " ")
+		for i := range commands {
+			if commands[i].name == name {
+				return &commands[i], args[n:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: tenkit <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run tenkit <command> -h for the flags of a command.")
+}
+
+// loadConfig reads the settings and secrets like the server does.
+func loadConfig(ctx context.Context) (*multitenant.Config, error) {
+	cfg := multitenant.LoadDefaultConfig()
+	store, err := secrets.New(cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets configuration: %w", err)
+	}
+	if err := secrets.Apply(ctx, store, cfg); err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	cfg.ApplyKeys()
+	return cfg, nil
+}
+
+// newFlags returns the flag set of a command.
+func newFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("tenkit "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: tenkit %s [flags]\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of a command and checks that the required ones are set.
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+	for _, name := range required {
+		if strings.TrimSpace(fs.Lookup(name).Value.String()) == "" {
+			fmt.Fprintf(fs.Output(), "-%s is required\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+// tenantID returns the ID of the tenant with the given subdomain.
+func tenantID(ctx context.Context, subdomain string) (int64, error) {
+	subdomain = strings.ToLower(strings.TrimSpace(subdomain))
+	id, err := models.GetTenantIDBySubdomain(ctx, subdomain)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("no tenant uses the subdomain %q", subdomain)
+	}
+	return id, nil
+}
+
+// readPassword reads a password from the first line of stdin, so that it stays out of the shell
+// history: echo "$PASSWORD" | tenkit user set-password -tenant acme -email bob@acme.test
+func readPassword() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read the password from stdin: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("empty password on stdin")
+	}
+	return password, nil
+}
+
+// audit records an operator action in the audit log, marked as run from the command line.
+func audit(ctx context.Context, tenantID, userID int64, action, details string) {
+	models.LogAudit(ctx, models.AuditEntry{
+		TenantID: tenantID,
+		UserID:   userID,
+		Action:   action,
+		Details:  strings.TrimSpace(details + " [cli]"),
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/maintenance"
+)
+
+// maintenanceOn puts the platform, or a tenant, in maintenance; running servers pick it up within
+// seconds.
+func maintenanceOn(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("maintenance on")
+	subdomain := fs.String("tenant", "", "Tenant subdomain, the whole platform when empty")
+	message := fs.String("message", "", "Shown on the maintenance page instead of the default text")
+	retryAfter := fs.Duration("retry-after", cfg.Maintenance.RetryAfter, "Sent as Retry-After, 0 to leave it out")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *retryAfter < 0 {
+		return fmt.Errorf("-retry-after must not be negative")
+	}
+	id, name, err := maintenanceTarget(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	if err := maintenance.Start(ctx, id, *message, *retryAfter, 0); err != nil {
+		return err
+	}
+	audit(ctx, id, 0, "maintenance.started", *message)
+	fmt.Printf("Maintenance started on %s\n", name)
+	return nil
+}
+
+// maintenanceOff ends the maintenance of the platform or of a tenant.
+func maintenanceOff(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("maintenance off")
+	subdomain := fs.String("tenant", "", "Tenant subdomain, the whole platform when empty")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	id, name, err := maintenanceTarget(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	ended, err := maintenance.End(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ended {
+		fmt.Printf("No maintenance started on %s\n", name)
+	} else {
+		audit(ctx, id, 0, "maintenance.ended", "")
+		fmt.Printf("Maintenance ended on %s\n", name)
+	}
+	if id == 0 && cfg.Maintenance.Enabled || id != 0 && slices.Contains(cfg.Maintenance.Tenants, name) {
+		fmt.Println("Still in maintenance through MAINTENANCE_MODE or MAINTENANCE_TENANTS")
+	}
+	return nil
+}
+
+// maintenanceStatus prints the maintenance windows in progress.
+func maintenanceStatus(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	if err := parse(newFlags("maintenance status"), args); err != nil {
+		return err
+	}
+	windows := maintenance.Windows()
+	if len(windows) == 0 {
+		fmt.Println("No maintenance in progress")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCOPE\tSOURCE\tSINCE\tRETRY AFTER\tMESSAGE")
+	for _, win := range windows {
+		scope := win.Subdomain
+		if scope == "" {
+			scope = "platform"
+		}
+		since := "-"
+		if !win.Since.IsZero() {
+			since = win.Since.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", scope, win.Source, since, win.RetryAfter.Round(time.Second), win.Message)
+	}
+	return w.Flush()
+}
+
+// maintenanceTarget returns the tenant ID of subdomain, 0 for the platform when it is empty, and a
+// name to print.
+func maintenanceTarget(ctx context.Context, subdomain string) (int64, string, error) {
+	if subdomain == "" {
+		return 0, "the platform", nil
+	}
+	id, err := tenantID(ctx, subdomain)
+	return id, subdomain, err
+}
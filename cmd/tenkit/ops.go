@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// migrate creates the missing tables and columns; every other command does it too when it opens
+// the database, so this only makes upgrades explicit in deploy scripts.
+func migrate(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	if err := parse(newFlags("migrate"), args); err != nil {
+		return err
+	}
+	fmt.Println("Database up to date:", db.DSN)
+	return nil
+}
+
+// sessionsPurge deletes the expired sessions, or signs every user of a tenant out.
+func sessionsPurge(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("sessions purge")
+	subdomain := fs.String("tenant", "", "End every session of this tenant instead of the expired ones")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *subdomain == "" {
+		n, err := models.PurgeExpiredSessions(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d expired sessions deleted\n", n)
+		return nil
+	}
+	id, err := tenantID(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	n, err := models.DeleteTenantSessions(ctx, id)
+	if err != nil {
+		return err
+	}
+	audit(ctx, id, 0, "sessions.purged", fmt.Sprintf("%d sessions", n))
+	fmt.Printf("%d sessions of %s deleted\n", n, *subdomain)
+	return nil
+}
+
+// i18nCheck loads the built-in translations and those of TENKIT_LOCALES like the server does, and
+// reports the problems of every language against DEFAULT_LANG. It fails when there is any, for CI.
+func i18nCheck(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	if err := parse(newFlags("i18n check"), args); err != nil {
+		return err
+	}
+	tr, err := i18n.New(cfg.I18n.DefaultLang)
+	if err != nil {
+		return err
+	}
+	sources := []fs.FS{i18n.Builtin}
+	if cfg.I18n.LocalesPath != "" {
+		sources = append(sources, os.DirFS(cfg.I18n.LocalesPath))
+	}
+	if err := tr.Load(sources...); err != nil {
+		return err
+	}
+	issues := tr.Check()
+	for _, is := range issues {
+		fmt.Printf("%s\t%s\t%s\n", is.Lang, is.Problem, is.Key)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d translation problems", len(issues))
+	}
+	fmt.Println("Translations complete")
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/search"
+)
+
+// searchReindex rebuilds the search index of a tenant, or of every tenant, from the built-in
+// sources; run it after changing SEARCH_BACKEND or when the index drifted.
+func searchReindex(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("search reindex")
+	subdomain := fs.String("tenant", "", "Tenant subdomain, every tenant when empty")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	b, err := search.New(ctx, cfg.Search)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("search is disabled (SEARCH_BACKEND=none)")
+	}
+	search.SetBackend(b)
+	search.Register(search.MemberSource(cfg))
+
+	var tenants []models.TenantSummary
+	if *subdomain != "" {
+		id, err := tenantID(ctx, *subdomain)
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, models.TenantSummary{ID: id, Subdomain: *subdomain})
+	} else if tenants, err = models.ListTenants(ctx); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		n, err := search.Reindex(ctx, t.ID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.Subdomain, err)
+		}
+		fmt.Printf("%d documents of %s indexed\n", n, t.Subdomain)
+	}
+	return nil
+}
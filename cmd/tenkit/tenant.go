@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// tenantCreate creates a tenant with the checks of /enroll. Without a password the owner sets one
+// through /forgot. With -parent the tenant is a sub-tenant served on a subdomain of its parent.
+func tenantCreate(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("tenant create")
+	name := fs.String("name", "", "Tenant name")
+	owner := fs.String("owner", "", "Owner email")
+	subdomain := fs.String("subdomain", "", "Subdomain, derived from the name when empty")
+	plan := fs.String("plan", "", "Limits plan, the platform default when empty")
+	parent := fs.String("parent", "", "Subdomain of the parent tenant, for a sub-tenant")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the owner password from stdin")
+	if err := parse(fs, args, "name", "owner"); err != nil {
+		return err
+	}
+	var password string
+	if *passwordStdin {
+		var err error
+		if password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	t, err := multitenant.ProvisionTenant(ctx, multitenant.ProvisionRequest{
+		Config:        cfg,
+		Name:          *name,
+		Subdomain:     *subdomain,
+		OwnerEmail:    *owner,
+		OwnerPassword: password,
+		Plan:          *plan,
+		Parent:        *parent,
+	})
+	if err != nil {
+		return err
+	}
+	audit(ctx, t.ID, 0, "tenant.provisioned", t.Subdomain+" owner "+strings.ToLower(strings.TrimSpace(*owner)))
+	fmt.Printf("Tenant %d created: %s\n", t.ID, urls.Subdomain(cfg, t.Subdomain, "/", nil))
+	return nil
+}
+
+// tenantList prints the tenants, oldest first.
+func tenantList(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	if err := parse(newFlags("tenant list"), args); err != nil {
+		return err
+	}
+	tenants, err := models.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSUBDOMAIN\tNAME\tSTATE\tPLAN\tCREATED")
+	for _, t := range tenants {
+		state := t.State
+		if t.SuspendedReason != "" {
+			state += " (" + t.SuspendedReason + ")"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Subdomain, t.Name, state, t.Plan, t.CreatedAt.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+// tenantSuspend takes an active tenant offline; /admin/tenants reactivates it.
+func tenantSuspend(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("tenant suspend")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	reason := fs.String("reason", "", "Reason, shown to platform admins")
+	if err := parse(fs, args, "tenant", "reason"); err != nil {
+		return err
+	}
+	id, err := tenantID(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	if err := models.SuspendTenant(ctx, id, strings.TrimSpace(*reason)); err != nil {
+		return fmt.Errorf("%s: %w", *subdomain, err)
+	}
+	audit(ctx, id, 0, "tenant.suspended", strings.TrimSpace(*reason))
+	fmt.Printf("Tenant %s suspended\n", *subdomain)
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// userCreate adds a verified member to a tenant. Without a password it prints the link through
+// which the user chooses one.
+func userCreate(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("user create")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	email := fs.String("email", "", "User email")
+	role := fs.String("role", cfg.Roles.Default, "Role")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the password from stdin")
+	if err := parse(fs, args, "tenant", "email"); err != nil {
+		return err
+	}
+	addr := strings.ToLower(strings.TrimSpace(*email))
+	if !multitenant.ValidEmail(addr) {
+		return fmt.Errorf("invalid email %q", *email)
+	}
+	if _, ok := cfg.Roles.Get(*role); !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	id, err := tenantID(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+
+	if !*passwordStdin {
+		m, err := multitenant.CreateMember(ctx, multitenant.MemberRequest{Config: cfg, TenantID: id, Email: addr, Role: *role})
+		if err != nil {
+			return err
+		}
+		audit(ctx, id, m.UserID, "user.created", addr+" "+*role)
+		fmt.Printf("User %d created: %s (%s)\n", m.UserID, addr, *role)
+		fmt.Println(urls.Subdomain(cfg, strings.ToLower(strings.TrimSpace(*subdomain)), "/reset", url.Values{"token": {m.Token}}))
+		return nil
+	}
+	hash, err := hashPassword()
+	if err != nil {
+		return err
+	}
+	userID, err := models.CreateUser(ctx, id, addr, hash, *role)
+	if err != nil {
+		return err
+	}
+	audit(ctx, id, userID, "user.created", addr+" "+*role)
+	fmt.Printf("User %d created: %s (%s)\n", userID, addr, *role)
+	return nil
+}
+
+// userSetPassword replaces the password of a user with the one read from stdin and ends their
+// sessions.
+func userSetPassword(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("user set-password")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	email := fs.String("email", "", "User email")
+	if err := parse(fs, args, "tenant", "email"); err != nil {
+		return err
+	}
+	id, user, err := tenantUser(ctx, *subdomain, *email)
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword()
+	if err != nil {
+		return err
+	}
+	if err := models.SetUserPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	audit(ctx, id, user.ID, "user.password_set", user.Email)
+	fmt.Printf("Password of %s changed; their sessions ended\n", user.Email)
+	return nil
+}
+
+// userPromote changes the role of a member, to the tenant admin role by default.
+func userPromote(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("user promote")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	email := fs.String("email", "", "User email")
+	role := fs.String("role", cfg.Roles.Admin, "New role")
+	if err := parse(fs, args, "tenant", "email"); err != nil {
+		return err
+	}
+	if _, ok := cfg.Roles.Get(*role); !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	id, user, err := tenantUser(ctx, *subdomain, *email)
+	if err != nil {
+		return err
+	}
+	found, err := models.SetMemberRole(ctx, id, user.ID, *role, cfg.Roles.Owner)
+	if errors.Is(err, models.ErrLastOwner) {
+		return fmt.Errorf("%s is the last owner of %s; promote another member first", user.Email, *subdomain)
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s is not a member of %s", user.Email, *subdomain)
+	}
+	audit(ctx, id, user.ID, "membership.role_changed", fmt.Sprintf("%d %s %s -> %s", user.ID, user.Email, user.Role, *role))
+	events.Publish(ctx, events.Event{
+		Name:     events.MemberRoleChanged,
+		TenantID: id,
+		UserID:   user.ID,
+		Data:     map[string]any{"role": *role, "previous_role": user.Role, "changed_by": "cli"},
+	})
+	fmt.Printf("%s is now %s of %s\n", user.Email, *role, *subdomain)
+	return nil
+}
+
+// invite creates a signup link of a tenant, like the members page does, and prints its URL.
+func invite(ctx context.Context, cfg *multitenant.Config, args []string) error {
+	fs := newFlags("invite")
+	subdomain := fs.String("tenant", "", "Tenant subdomain")
+	role := fs.String("role", cfg.Roles.Default, "Role given to the users joining with the link")
+	days := fs.Int("days", 7, "Days the link stays valid")
+	maxUses := fs.Int("max-uses", 1, "Users the link admits, 0 for unlimited")
+	if err := parse(fs, args, "tenant"); err != nil {
+		return err
+	}
+	if _, ok := cfg.Roles.Get(*role); !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	if *days < 1 || *maxUses < 0 {
+		return fmt.Errorf("-days must be at least 1 and -max-uses positive")
+	}
+	id, err := tenantID(ctx, *subdomain)
+	if err != nil {
+		return err
+	}
+	sub := strings.ToLower(strings.TrimSpace(*subdomain))
+
+	link := models.SignupLink{
+		TenantID:  id,
+		Role:      *role,
+		MaxUses:   *maxUses,
+		ExpiresAt: time.Now().Add(time.Duration(*days) * 24 * time.Hour),
+	}
+	if link.ID, err = models.CreateSignupLink(ctx, link); err != nil {
+		return err
+	}
+	token, err := utils.GenerateSignupLinkToken(sub, link.ID, link.Role, link.MaxUses, link.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	audit(ctx, id, 0, "signup_link.created", fmt.Sprintf("%d %s", link.ID, link.Role))
+	events.Publish(ctx, events.Event{
+		Name:     events.MemberInvited,
+		TenantID: id,
+		Data:     map[string]any{"signup_link_id": link.ID, "role": link.Role, "max_uses": link.MaxUses, "invited_by": "cli"},
+	})
+	fmt.Println(urls.Subdomain(cfg, sub, "/register", url.Values{"link": {token}}))
+	return nil
+}
+
+// tenantUser returns the ID of a tenant and one of its users.
+func tenantUser(ctx context.Context, subdomain, email string) (int64, *models.User, error) {
+	id, err := tenantID(ctx, subdomain)
+	if err != nil {
+		return 0, nil, err
+	}
+	user, err := models.GetUserByEmailAndTenant(strings.ToLower(strings.TrimSpace(email)), id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if user == nil {
+		return 0, nil, fmt.Errorf("no verified user %s in %s", email, subdomain)
+	}
+	return id, user, nil
+}
+
+// hashPassword reads a password from stdin and returns its bcrypt hash.
+func hashPassword() (string, error) {
+	password, err := readPassword()
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -1,17 +1,23 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
 
+// DSN is the database Init opens, DATABASE_DSN.
+var DSN = "./clubapp.db"
+
 func Init() {
 	var err error
-	DB, err = sql.Open("sqlite3", "./clubapp.db")
+	DB, err = sql.Open("sqlite3", DSN)
 	if err != nil {
 		log.Fatalf("DB connection error: %v", err)
 	}
@@ -22,10 +28,16 @@ func Init() {
 		name TEXT NOT NULL UNIQUE,
 		slug TEXT NOT NULL UNIQUE,
 		subdomain TEXT NOT NULL UNIQUE,
+		parent_tenant_id INTEGER REFERENCES tenants(id),
+		plan TEXT,
 		custom_domain TEXT,
 		email TEXT NOT NULL,
 		primary_color TEXT,
+		secondary_color TEXT,
+		theme TEXT,
 		logo_path TEXT,
+		logo_key TEXT,
+		branding_version INTEGER NOT NULL DEFAULT 0,
 		is_active BOOLEAN NOT NULL DEFAULT 1,
 		is_deleted BOOLEAN NOT NULL DEFAULT 0,
 		allow_signins BOOLEAN NOT NULL DEFAULT 1,
@@ -34,13 +46,17 @@ func Init() {
 		deleted_at DATETIME,
 		timezone TEXT DEFAULT 'UTC',
 		address TEXT,
-		country TEXT
+		country TEXT,
+		rate_limit_factor REAL NOT NULL DEFAULT 1,
+		suspended_reason TEXT,
+		purge_at DATETIME
 	);
 
 	CREATE TABLE IF NOT EXISTS pending_tenant_signups (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		email TEXT NOT NULL,
 		org_name TEXT NOT NULL,
+		subdomain TEXT,
 		password_hash TEXT NOT NULL,
 		token TEXT NOT NULL UNIQUE,
 		expires_at DATETIME NOT NULL
@@ -48,7 +64,7 @@ func Init() {
 
 	CREATE TABLE IF NOT EXISTS users (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		email TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL,
 		password_hash TEXT NOT NULL,
 		is_verified BOOLEAN NOT NULL DEFAULT 0,
 		tenant_id INTEGER,
@@ -62,6 +78,7 @@ func Init() {
 		tenant_id INTEGER NOT NULL,
 		role TEXT DEFAULT 'member',
 		is_active BOOLEAN NOT NULL DEFAULT 1,
+		status TEXT NOT NULL DEFAULT 'active',
 		joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (user_id) REFERENCES users(id),
 		FOREIGN KEY (tenant_id) REFERENCES tenants(id),
@@ -74,20 +91,562 @@ func Init() {
 		password_hash TEXT NOT NULL,
 		token TEXT NOT NULL UNIQUE,
 		expires_at DATETIME NOT NULL,
+		link_id INTEGER,
+		role TEXT,
 		FOREIGN KEY (tenant_id) REFERENCES tenants(id)
 	);
 
+	CREATE TABLE IF NOT EXISTS signup_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		role TEXT NOT NULL,
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		created_by INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		revoked_at DATETIME,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		FOREIGN KEY(created_by) REFERENCES users(id)
+	);
+
 	CREATE TABLE IF NOT EXISTS sessions (
 		token TEXT PRIMARY KEY,
 		user_id INTEGER NOT NULL,
 		tenant_id INTEGER NOT NULL,
 		expires_at DATETIME NOT NULL,
+		impersonator_id INTEGER,
+		impersonator_email TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS data_exports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		tenant_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		storage_key TEXT,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME,
+		expires_at DATETIME,
 		FOREIGN KEY(user_id) REFERENCES users(id),
 		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS audit_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER,
+		user_id INTEGER,
+		action TEXT NOT NULL,
+		ip TEXT,
+		details TEXT,
+		request_id TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_geo_policies (
+		tenant_id INTEGER PRIMARY KEY,
+		mode TEXT NOT NULL DEFAULT 'deny',
+		countries TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_nav_settings (
+		tenant_id INTEGER NOT NULL,
+		item_id TEXT NOT NULL,
+		hidden BOOLEAN NOT NULL DEFAULT 1,
+		PRIMARY KEY (tenant_id, item_id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS password_resets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		tenant_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS impersonation_handoffs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		operator_id INTEGER NOT NULL,
+		nonce TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS ownership_transfers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		from_user_id INTEGER NOT NULL,
+		to_user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		accepted_at DATETIME,
+		FOREIGN KEY(from_user_id) REFERENCES users(id),
+		FOREIGN KEY(to_user_id) REFERENCES users(id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_custom_domains (
+		tenant_id INTEGER PRIMARY KEY,
+		domain TEXT NOT NULL,
+		token TEXT NOT NULL,
+		is_verified BOOLEAN NOT NULL DEFAULT 0,
+		verified_at DATETIME,
+		checked_at DATETIME,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_email_domains (
+		tenant_id INTEGER PRIMARY KEY,
+		domain TEXT NOT NULL,
+		selector TEXT NOT NULL,
+		private_key TEXT NOT NULL,
+		is_verified BOOLEAN NOT NULL DEFAULT 0,
+		verified_at DATETIME,
+		checked_at DATETIME,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS acme_cache (
+		key TEXT PRIMARY KEY,
+		data BLOB NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_meta_settings (
+		tenant_id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_launch_settings (
+		tenant_id INTEGER PRIMARY KEY,
+		coming_soon BOOLEAN NOT NULL DEFAULT 0,
+		message TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		tier TEXT NOT NULL DEFAULT 'free',
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_key_usage (
+		key_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		requests INTEGER NOT NULL DEFAULT 0,
+		throttled INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (key_id, day),
+		FOREIGN KEY(key_id) REFERENCES api_keys(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS report_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		tenant_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		progress INTEGER NOT NULL DEFAULT 0,
+		storage_key TEXT,
+		content_type TEXT,
+		error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_membership_settings (
+		tenant_id INTEGER PRIMARY KEY,
+		require_approval BOOLEAN NOT NULL DEFAULT 0,
+		unmatched_domains TEXT NOT NULL DEFAULT 'allow',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_join_domains (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		domain TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		UNIQUE(tenant_id, domain)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_legal_holds (
+		tenant_id INTEGER PRIMARY KEY,
+		reason TEXT NOT NULL,
+		placed_by INTEGER NOT NULL,
+		placed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		FOREIGN KEY(placed_by) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS feature_flags (
+		name TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL DEFAULT 0,
+		rollout INTEGER NOT NULL DEFAULT 0,
+		updated_by INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_feature_flags (
+		tenant_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		updated_by INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (tenant_id, name),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS maintenance (
+		tenant_id INTEGER PRIMARY KEY,
+		message TEXT NOT NULL DEFAULT '',
+		retry_after INTEGER NOT NULL DEFAULT 0,
+		started_by INTEGER,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		UNIQUE(tenant_id, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS group_members (
+		group_id INTEGER NOT NULL,
+		tenant_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		role TEXT NOT NULL DEFAULT 'member',
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(group_id, user_id),
+		FOREIGN KEY(group_id) REFERENCES groups(id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(tenant_id, user_id);
+
+	CREATE TABLE IF NOT EXISTS group_permissions (
+		group_id INTEGER NOT NULL,
+		tenant_id INTEGER NOT NULL,
+		permission TEXT NOT NULL,
+		granted_by INTEGER,
+		granted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(group_id, permission),
+		FOREIGN KEY(group_id) REFERENCES groups(id),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_settings (
+		tenant_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(tenant_id, key),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS stored_objects (
+		key TEXT PRIMARY KEY,
+		tenant_id INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_stored_objects_tenant ON stored_objects(tenant_id);
+
+	CREATE TABLE IF NOT EXISTS usage_daily (
+		tenant_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		meter TEXT NOT NULL,
+		value INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(tenant_id, day, meter),
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_usage_daily_day ON usage_daily(day);
+
+	CREATE TABLE IF NOT EXISTS usage_active_users (
+		tenant_id INTEGER NOT NULL,
+		day TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		PRIMARY KEY(tenant_id, day, user_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_endpoints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		is_active BOOLEAN NOT NULL DEFAULT 1,
+		created_by INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_tenant ON webhook_endpoints(tenant_id);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		endpoint_id INTEGER NOT NULL,
+		tenant_id INTEGER,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME,
+		FOREIGN KEY(endpoint_id) REFERENCES webhook_endpoints(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, created_at);
+
+	CREATE TABLE IF NOT EXISTS support_refs (
+		code TEXT PRIMARY KEY,
+		request_id TEXT NOT NULL,
+		tenant_id INTEGER,
+		user_id INTEGER,
+		method TEXT NOT NULL DEFAULT '',
+		path TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		key TEXT NOT NULL,
+		args TEXT NOT NULL DEFAULT '{}',
+		url TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		read_at DATETIME,
+		dismissed_at DATETIME,
+		FOREIGN KEY(tenant_id) REFERENCES tenants(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, dismissed_at, created_at);
+
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL DEFAULT 0,
+		kind TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT 'null',
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL DEFAULT 5,
+		run_at DATETIME NOT NULL,
+		locked_until DATETIME,
+		started_at DATETIME,
+		finished_at DATETIME,
+		last_error TEXT NOT NULL DEFAULT '',
+		request_id TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(status, run_at);
+	CREATE INDEX IF NOT EXISTS idx_jobs_tenant ON jobs(tenant_id, status, started_at);
+
+	CREATE TABLE IF NOT EXISTS job_schedules (
+		name TEXT PRIMARY KEY,
+		spec TEXT NOT NULL,
+		next_run_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS tenant_data_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id INTEGER NOT NULL,
+		wrapped_key TEXT NOT NULL,
+		master_key_id TEXT NOT NULL,
+		is_active BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		retired_at DATETIME
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_data_keys_active ON tenant_data_keys(tenant_id) WHERE is_active = 1;
 	`
 
 	if _, err := DB.Exec(schema); err != nil {
 		log.Fatalf("Schema error: %v", err)
 	}
+
+	// Columns added after the first release; CREATE TABLE IF NOT EXISTS does not add them to existing databases
+	migrations := []struct{ table, column, definition string }{
+		{"tenants", "rate_limit_factor", "REAL NOT NULL DEFAULT 1"},
+		{"tenants", "suspended_reason", "TEXT"},
+		{"tenants", "purge_at", "DATETIME"},
+		{"tenants", "secondary_color", "TEXT"},
+		{"tenants", "theme", "TEXT"},
+		{"tenants", "logo_key", "TEXT"},
+		{"tenants", "branding_version", "INTEGER NOT NULL DEFAULT 0"},
+		{"memberships", "status", "TEXT NOT NULL DEFAULT 'active'"},
+		{"tenant_membership_settings", "unmatched_domains", "TEXT NOT NULL DEFAULT 'allow'"},
+		{"pending_user_signups", "link_id", "INTEGER"},
+		{"pending_user_signups", "role", "TEXT"},
+		{"sessions", "impersonator_id", "INTEGER"},
+		{"sessions", "impersonator_email", "TEXT"},
+		{"audit_logs", "request_id", "TEXT"},
+		{"pending_tenant_signups", "subdomain", "TEXT"},
+		{"tenants", "plan", "TEXT"},
+		{"users", "lang", "TEXT"},
+		{"users", "name", "TEXT"},
+		{"users", "timezone", "TEXT"},
+		{"users", "avatar_key", "TEXT"},
+		{"users", "calendar_secret", "TEXT"},
+		{"tenants", "parent_tenant_id", "INTEGER REFERENCES tenants(id)"},
+	}
+	for _, m := range migrations {
+		if err := ensureColumn(m.table, m.column, m.definition); err != nil {
+			log.Fatalf("Migration error on %s.%s: %v", m.table, m.column, err)
+		}
+	}
+
+	if _, err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_tenants_parent ON tenants(parent_tenant_id)`); err != nil {
+		log.Fatalf("Migration error on tenants.parent_tenant_id: %v", err)
+	}
+
+	// Emails were unique across tenants before accounts became per tenant
+	if migrated, err := dropUnique("users", "email TEXT NOT NULL UNIQUE", "email TEXT NOT NULL"); err != nil {
+		log.Fatalf("Migration error on users.email: %v", err)
+	} else if migrated {
+		log.Printf("Migrated users: emails are now unique per tenant")
+	}
+
+	// Custom domains were unique when claimed; only verified ones are now, so claims cannot squat
+	if migrated, err := dropUnique("tenant_custom_domains", "domain TEXT NOT NULL UNIQUE", "domain TEXT NOT NULL"); err != nil {
+		log.Fatalf("Migration error on tenant_custom_domains.domain: %v", err)
+	} else if migrated {
+		log.Printf("Migrated tenant_custom_domains: domains are now unique once verified")
+	}
+	if _, err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_tenant_custom_domains_domain ON tenant_custom_domains(domain)`); err != nil {
+		log.Fatalf("Migration error on tenant_custom_domains.domain: %v", err)
+	}
+
+	// Fields compared without case, so that concurrent signups cannot both create one; a database
+	// already holding such duplicates keeps working without the index
+	uniques := []struct{ name, on string }{
+		{"idx_tenants_subdomain_nocase", "tenants(subdomain COLLATE NOCASE)"},
+		{"idx_tenants_name_nocase", "tenants(name COLLATE NOCASE)"},
+		{"idx_tenants_email_nocase", "tenants(email COLLATE NOCASE)"},
+		{"idx_users_email_tenant", "users(email COLLATE NOCASE, tenant_id)"},
+		{"idx_tenant_custom_domains_verified", "tenant_custom_domains(domain) WHERE is_verified = 1"},
+	}
+	for _, u := range uniques {
+		if _, err := DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ` + u.name + ` ON ` + u.on); err != nil {
+			log.Printf("Unique index %s not created, duplicate values in %s: %v", u.name, u.on, err)
+		}
+	}
+}
+
+// ensureColumn adds a column to an existing table when it is missing.
+func ensureColumn(table, column, definition string) error {
+	rows, err := DB.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = DB.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// dropUnique replaces the column definition unique by plain in a table created with it, to drop a
+// UNIQUE constraint, and reports whether it did. SQLite cannot drop a constraint, so the table is
+// copied into one without it, with foreign keys off for the swap. The indexes of the table are
+// dropped with it; Init creates them again.
+func dropUnique(table, unique, plain string) (bool, error) {
+	var schema string
+	if err := DB.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&schema); err != nil {
+		return false, err
+	}
+	if !strings.Contains(schema, unique) {
+		return false, nil
+	}
+	scoped := table + "_scoped"
+	schema = strings.Replace(schema, unique, plain, 1)
+	schema = strings.Replace(schema, table, scoped, 1)
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	var fk int
+	if err := conn.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&fk); err != nil {
+		return false, err
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return false, err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = `+strconv.Itoa(fk))
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	for _, q := range []string{
+		schema,
+		`INSERT INTO ` + scoped + ` SELECT * FROM ` + table,
+		// Keep the IDs of deleted rows from being reused
+		`UPDATE sqlite_sequence SET seq = MAX(seq, (SELECT seq FROM sqlite_sequence WHERE name = '` + table + `')) WHERE name = '` + scoped + `'`,
+		`DROP TABLE ` + table,
+		`ALTER TABLE ` + scoped + ` RENAME TO ` + table,
+	} {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
 }
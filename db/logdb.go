@@ -3,37 +3,67 @@ package db
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
+	"regexp"
+
+	"github.com/pandamasta/tenkit/multitenant/logging"
 )
 
-// Debug controls whether to print DB logs
+// Debug controls whether to print DB logs; TENKIT_LOG_LEVELS=SQL=debug does the same.
 var Debug = false
 
+// EnableDebugLogs logs every query at Debug level under the SQL subsystem.
 func EnableDebugLogs() {
 	Debug = true
+	logging.SetLevel("SQL", slog.LevelDebug)
 }
 
 func DisableDebugLogs() {
 	Debug = false
+	logging.SetLevel("SQL", slog.LevelInfo)
 }
 
-func LogExec(ctx context.Context, db *sql.DB, query string, args ...any) (sql.Result, error) {
+// tokenLike matches arguments that look like session tokens, password hashes or keys.
+var tokenLike = regexp.MustCompile(`^[A-Za-z0-9+/=_\-.$]{16,}$`)
+
+// enabled reports whether queries are logged.
+func enabled() bool {
 	if Debug {
-		log.Printf("[SQL Exec] %s -- %v", query, args)
+		return true
+	}
+	l, ok := logging.Level("SQL")
+	return ok && l <= slog.LevelDebug
+}
+
+// maskArgs hides the arguments that look like secrets; emails and short values are kept.
+func maskArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		if s, ok := a.(string); ok && tokenLike.MatchString(s) {
+			a = logging.Redacted
+		}
+		out[i] = a
+	}
+	return out
+}
+
+func LogExec(ctx context.Context, db *sql.DB, query string, args ...any) (sql.Result, error) {
+	if enabled() {
+		slog.DebugContext(ctx, "[SQL] Exec", "query", query, "args", maskArgs(args))
 	}
 	return db.ExecContext(ctx, query, args...)
 }
 
 func LogQuery(ctx context.Context, db *sql.DB, query string, args ...any) (*sql.Rows, error) {
-	if Debug {
-		log.Printf("[SQL Query] %s -- %v", query, args)
+	if enabled() {
+		slog.DebugContext(ctx, "[SQL] Query", "query", query, "args", maskArgs(args))
 	}
 	return db.QueryContext(ctx, query, args...)
 }
 
 func LogQueryRow(ctx context.Context, db *sql.DB, query string, args ...any) *sql.Row {
-	if Debug {
-		log.Printf("[SQL QueryRow] \n%s\n         -- %v", query, args)
+	if enabled() {
+		slog.DebugContext(ctx, "[SQL] QueryRow", "query", query, "args", maskArgs(args))
 	}
 	return db.QueryRowContext(ctx, query, args...)
 }
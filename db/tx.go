@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// IsBusy reports whether err is the database giving up on a lock held by another transaction,
+// which a new attempt of the transaction may pass.
+func IsBusy(err error) bool {
+	var e sqlite3.Error
+	return errors.As(err, &e) && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked)
+}
+
+// UniqueViolation returns the column of the unique constraint err violated, as "table.column",
+// or "" when err is not such a violation.
+func UniqueViolation(err error) string {
+	var e sqlite3.Error
+	if !errors.As(err, &e) || e.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return ""
+	}
+	// "UNIQUE constraint failed: tenants.subdomain", with every column of a composite constraint
+	_, cols, _ := strings.Cut(e.Error(), "failed: ")
+	col, _, _ := strings.Cut(cols, ",")
+	return strings.TrimSpace(col)
+}
+
+// RetryTx runs fn in a transaction committed when fn returns nil. While retry reports that the
+// error of a run may pass on a new one, fn runs again from the start in a new transaction, up to
+// attempts runs, so fn must not keep state across runs.
+func RetryTx(ctx context.Context, attempts int, retry func(error) bool, fn func(tx *sql.Tx) error) error {
+	var err error
+	for i := 1; ; i++ {
+		if err = runTx(ctx, fn); err == nil || i >= attempts || !retry(err) {
+			return err
+		}
+		// Let the transaction that won finish before running again
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(i) * 20 * time.Millisecond):
+		}
+	}
+}
+
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
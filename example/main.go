@@ -1,129 +1,87 @@
 package main
 
 import (
-	"html/template"
+	"context"
+	"embed"
+	"io/fs"
 	"log/slog"
-	"net/http"
 	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/pandamasta/tenkit"
 	"github.com/pandamasta/tenkit/db"
-	"github.com/pandamasta/tenkit/handlers"
-	"github.com/pandamasta/tenkit/internal/i18n"
-	"github.com/pandamasta/tenkit/internal/render"
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/mail"
 	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/secrets"
 )
 
-var (
-	mainPageTmpl   *template.Template
-	tenantPageTmpl *template.Template
-)
+//go:embed static
+var staticFS embed.FS
 
 func main() {
+	ctx := context.Background()
 	cfg := multitenant.LoadDefaultConfig()
 
-	// Initialiser i18n avec validation
-	i18n, err := i18n.New(cfg.I18n.DefaultLang)
+	// Secrets from SECRETS_PROVIDER, over the settings, before validating them
+	secretStore, err := secrets.New(cfg.Secrets)
 	if err != nil {
-		slog.Error("[LANG] Failed to initialize i18n", "error", err)
+		slog.Error("Invalid secrets configuration", "err", err)
 		os.Exit(1)
 	}
-	slog.Info("[LANG] Loading locales", "path", cfg.I18n.LocalesPath)
-	if err := i18n.LoadLocales(cfg.I18n.LocalesPath); err != nil {
-		slog.Error("[LANG] Error loading translations", "err", err)
+	if err := secrets.Apply(ctx, secretStore, cfg); err != nil {
+		slog.Error("Failed to read secrets", "err", err)
 		os.Exit(1)
 	}
-
-	if os.Getenv("TENKIT_DEBUG") == "1" {
-		db.EnableDebugLogs()
-		i18n.EnableDebug()
-		slog.Info("Debug logging ENABLED")
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Invalid configuration", "err", err)
+		os.Exit(1)
 	}
+	cfg.ApplyKeys()
 
-	// Log config
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	// Log config; TENKIT_LOG_LEVEL follows configuration reloads
+	multitenant.LogLevel.UnmarshalText([]byte(cfg.Log.Level))
+	slog.SetDefault(slog.New(middleware.NewSlogHandler(cfg, os.Stdout, multitenant.LogLevel)))
+
+	// Plans limiting tenants; tenants without one get TENANT_DEFAULT_PLAN, or no limits when it is empty
+	limits.RegisterPlan(limits.Plan{Name: "free", Limits: map[string]int64{limits.Members: 10, limits.Storage: 10 << 20}})
+	limits.RegisterPlan(limits.Plan{Name: "pro", Limits: map[string]int64{limits.Members: 100, limits.Storage: 1 << 30},
+		Features: []string{limits.CustomDomain, limits.APIKeys}})
+	limits.RegisterPlan(limits.Plan{Name: "enterprise", Features: []string{limits.CustomDomain, limits.APIKeys}})
+
+	// Static files, embedded and served under content-hashed names ({{ asset "..." }} in templates)
+	staticFiles, _ := fs.Sub(staticFS, "static")
+	app, err := tenkit.New(cfg, tenkit.WithStatic(staticFiles), tenkit.WithSecrets(secretStore))
+	if err != nil {
+		slog.Error("Failed to assemble the application", "err", err)
+		os.Exit(1)
+	}
 
 	if os.Getenv("TENKIT_DEBUG") == "1" {
 		db.EnableDebugLogs()
-		i18n.EnableDebug()
+		app.I18n.EnableDebug()
 		slog.Info("Debug logging ENABLED")
 	}
 
-	// Load DB
-	db.Init()
-
-	// Load templates
-	baseTemplates := []string{
-		"templates/base.html",
-		"templates/header.html",
-	}
-	mainPageTmpl, tenantPageTmpl = handlers.InitHomeTemplates(baseTemplates)
-	enrollTmpl := handlers.InitEnrollTemplates(baseTemplates)
-	verifyTmpl := handlers.InitVerifyTemplates(baseTemplates)
-	registerTmpl := handlers.InitRegisterTemplates(baseTemplates)
-	confirmTmpl := handlers.InitConfirmTemplates(baseTemplates)
-	loginTmpl := handlers.InitLoginTemplates(baseTemplates)
-
-	// Routes
-	mux := http.NewServeMux()
-
-	fileServer := http.FileServer(http.Dir("static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
-
-	mux.HandleFunc("/", handlers.HomeHandler(i18n, mainPageTmpl, tenantPageTmpl))
-
-	// Set language via dropdown (persists in cookie)
-	mux.HandleFunc("/lang", func(w http.ResponseWriter, r *http.Request) {
-		lang := r.URL.Query().Get("lang")
-		if lang != "" {
-			http.SetCookie(w, &http.Cookie{
-				Name:  "lang",
-				Value: lang,
-				Path:  "/",
-			})
-		}
-		http.Redirect(w, r, r.Referer(), http.StatusSeeOther)
+	// Inbound email: replies to notifications land on reply+<tag>@<tenant>.<INBOUND_MAIL_DOMAIN>
+	mail.Inbound.Handle("reply", func(ctx context.Context, tenantID int64, msg *mail.InboundMessage) error {
+		_, tag := msg.LocalPart()
+		slog.InfoContext(ctx, "[INBOUND] Reply received", "tenant_id", tenantID, "tag", tag, "from", msg.From)
+		return nil
 	})
 
-	mux.HandleFunc("/enroll", handlers.EnrollHandler(cfg, i18n, enrollTmpl))
-	mux.HandleFunc("/verify", handlers.VerifyHandler(cfg, i18n, verifyTmpl))
-	mux.HandleFunc("/register", handlers.RegisterHandler(cfg, i18n, registerTmpl))
-	mux.HandleFunc("/confirm", handlers.ConfirmHandler(cfg, i18n, confirmTmpl))
-	mux.HandleFunc("/login", handlers.LoginHandler(cfg, i18n, loginTmpl))
-	mux.HandleFunc("/logout", handlers.LogoutHandler(cfg, i18n))
-
-	dashboardHandler := func(w http.ResponseWriter, r *http.Request) {
-		// Step 1: Prepare template data
-		data := render.BaseTemplateData(r, i18n, nil)
-		slog.Debug("[DASHBOARD] Rendering dashboard", "lang", data.Lang, "tenant", data.Tenant != nil, "user", data.User != nil)
-
-		// Step 2: Render template
-		if data.Tenant != nil {
-			slog.Debug("[DASHBOARD] Rendering tenant template", "template", "tenant.html")
-			render.RenderTemplate(w, tenantPageTmpl, "base", data)
-		} else {
-			slog.Debug("[DASHBOARD] Rendering main template", "template", "main.html")
-			render.RenderTemplate(w, mainPageTmpl, "base", data)
-		}
-	}
-	mux.Handle("/dashboard", middleware.RequireAuth(http.HandlerFunc(dashboardHandler)))
-
-	resolver := multitenant.SubdomainResolver{Config: cfg}
-	fetcher := multitenant.DBFetcher{DB: db.DB}
+	// Tenant settings editable at /settings/general
+	multitenant.RegisterSetting(multitenant.SettingDef{Key: "welcome_message", LabelKey: "settings.welcome_message", HelpKey: "settings.welcome_message_help", Type: multitenant.SettingString})
 
-	// Middleware
-	handler := middleware.LangMiddleware(cfg, i18n, mux)
-	handler = middleware.TenantMiddleware(cfg, resolver, fetcher, handler)
-	handler = middleware.SessionMiddleware(cfg, handler)
-	handler = middleware.CSRFMiddleware(handler)
-	handler = middleware.Logger(cfg, handler)
+	// Permissions tenant admins grant to groups at /groups/{id}
+	multitenant.RegisterPermission(multitenant.Permission{Name: "billing.manage"})
 
-	slog.Info("Starting HTTP server", "addr", cfg.Server.Addr)
 	slog.Debug("Loaded config", "config", cfg)
 
-	if err := http.ListenAndServe(cfg.Server.Addr, handler); err != nil {
+	app.Start(ctx)
+	if err := app.ListenAndServe(ctx); err != nil {
 		slog.Error("Server exited with error", "error", err)
 	}
 }
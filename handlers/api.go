@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/features"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// The JSON API under /api/v1/ runs the enroll, register, confirm, login and password reset flows of
+// the HTML pages for SPAs and mobile apps. Requests are JSON or form bodies; responses are
+// {"data": ...} on success and RFC 7807 problem details (middleware.Problem) otherwise, with a stable
+// code and the detail translated to the request language. Logged-in calls send the access token
+// returned by the login as "Authorization: Bearer <token>".
+
+// apiMaxBody caps the size of API request bodies.
+const apiMaxBody = 1 << 16
+
+// apiUser is the JSON form of a user.
+type apiUser struct {
+	ID       int64  `json:"id"`
+	Email    string `json:"email"`
+	TenantID int64  `json:"tenant_id"`
+	Role     string `json:"role"`
+}
+
+// apiToken is the JSON answered by the login.
+type apiToken struct {
+	AccessToken string  `json:"access_token"`
+	TokenType   string  `json:"token_type"`
+	ExpiresIn   int64   `json:"expires_in"` // Seconds
+	User        apiUser `json:"user"`
+}
+
+// apiTokenInput is the body of the steps that consume a mailed token.
+type apiTokenInput struct {
+	Token string `json:"token"`
+}
+
+// apiLoginInput is the body of POST /api/v1/login.
+type apiLoginInput struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Challenge string `json:"challenge,omitempty"` // Challenge response, when one is required
+}
+
+// apiForgotInput is the body of POST /api/v1/password/forgot.
+type apiForgotInput struct {
+	Email string `json:"email"`
+}
+
+// apiResetInput is the body of POST /api/v1/password/reset.
+type apiResetInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// apiEnvelope is the JSON of successful API responses, as documented in the OpenAPI document.
+type apiEnvelope[T any] struct {
+	Data T `json:"data"`
+}
+
+// apiStatus is the answer of the API steps that only report where the flow stands.
+type apiStatus struct {
+	Status string `json:"status"` // e.g. "pending_confirmation"
+}
+
+// apiEnrollment is the answer of POST /api/v1/enroll.
+type apiEnrollment struct {
+	Status    string `json:"status"` // "pending_verification"
+	Subdomain string `json:"subdomain"`
+}
+
+// apiTenant is the answer of POST /api/v1/enroll/verify.
+type apiTenant struct {
+	TenantID  int64   `json:"tenant_id"`
+	Subdomain string  `json:"subdomain"`
+	URL       string  `json:"url"`
+	Owner     apiUser `json:"owner"`
+}
+
+// apiMember is the answer of POST /api/v1/confirm.
+type apiMember struct {
+	User   apiUser `json:"user"`
+	Status string  `json:"status"` // "active", or "pending" while an admin must approve the membership
+}
+
+// apiData answers {"data": v}.
+func apiData(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"data": v})
+}
+
+// apiFail answers a refused flow step as problem details.
+func apiFail(w http.ResponseWriter, r *http.Request, i18n *i18n.I18n, fe *flowError) {
+	middleware.APIError(w, r, fe.Code, fe.message(i18n, middleware.LangFromContext(r.Context())), fe.Status)
+}
+
+// apiDecode reads a JSON or form body into dst, whose fields are named by their json tags. It answers
+// the error and returns false when the body is unusable.
+func apiDecode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, apiMaxBody)
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "", "application/json":
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+			middleware.APIError(w, r, "invalid_body", "Invalid JSON body", http.StatusBadRequest)
+			return false
+		}
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		if err := r.ParseMultipartForm(apiMaxBody); err != nil && err != http.ErrNotMultipart {
+			middleware.APIError(w, r, "invalid_body", "Invalid form body", http.StatusBadRequest)
+			return false
+		}
+		fields := map[string]string{}
+		for k := range r.PostForm {
+			fields[k] = r.PostForm.Get(k)
+		}
+		raw, _ := json.Marshal(fields)
+		if err := json.Unmarshal(raw, dst); err != nil {
+			middleware.APIError(w, r, "invalid_body", "Invalid form body", http.StatusBadRequest)
+			return false
+		}
+	default:
+		middleware.APIError(w, r, "unsupported_media_type", "Send application/json or form bodies", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// APINegotiate refuses API requests whose Accept header excludes JSON with 406.
+func APINegotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !middleware.AcceptsJSON(r) {
+			middleware.APIError(w, r, "not_acceptable", "Responses are application/json", http.StatusNotAcceptable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// APIEnrollHandler records a tenant signup at POST /api/v1/enroll on the root domain and mails the
+// verification link. It answers 202 with the subdomain the tenant will get.
+func APIEnrollHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.FromContext(r.Context()) != nil {
+			middleware.APIError(w, r, "not_found", "Enrollment is only available on the root domain", http.StatusNotFound)
+			return
+		}
+		var in enrollInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		sub, fe := enrollTenant(cfg, i18n, r, in)
+		if fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusAccepted, apiEnrollment{Status: "pending_verification", Subdomain: sub})
+	}
+}
+
+// APIVerifyHandler creates the tenant of a verification token at POST /api/v1/enroll/verify and
+// answers 201 with it, for apps that open the mailed link themselves.
+func APIVerifyHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in apiTokenInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		t, fe := verifyTenant(cfg, r, in.Token)
+		if fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusCreated, apiTenant{
+			TenantID:  t.TenantID,
+			Subdomain: t.Subdomain,
+			URL:       urls.Subdomain(cfg, t.Subdomain, "/", nil),
+			Owner:     apiUser{ID: t.UserID, Email: t.Email, TenantID: t.TenantID, Role: cfg.Roles.Owner},
+		})
+	}
+}
+
+// APIRegisterHandler records a member signup on the tenant at POST /api/v1/register and mails the
+// confirmation link. It answers 202.
+func APIRegisterHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in registerInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		if fe := registerUser(cfg, i18n, r, in); fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusAccepted, apiStatus{Status: "pending_confirmation"})
+	}
+}
+
+// APIConfirmHandler creates the member of a confirmation token at POST /api/v1/confirm and answers
+// 201 with it. Its status is "pending" while an admin must approve the membership.
+func APIConfirmHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in apiTokenInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		u, fe := confirmUser(cfg, i18n, r, in.Token)
+		if fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusCreated, apiMember{
+			User:   apiUser{ID: u.UserID, Email: u.Email, TenantID: u.TenantID, Role: u.Role},
+			Status: u.Status,
+		})
+	}
+}
+
+// APILoginHandler checks credentials at POST /api/v1/login and answers an access token bound to a
+// new session, valid for Config.TokenExpiry.
+func APILoginHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Check the credentials and open a session
+		var in apiLoginInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		user, session, fe := loginUser(r, in.Email, in.Password, in.Challenge)
+		if fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+
+		// Step 2: Sign the access token for the tenant
+		now := time.Now()
+		token, err := utils.GenerateAccessToken(utils.AccessClaims{
+			Subject:   user.ID,
+			TenantID:  user.TenantID,
+			Audience:  middleware.FromContext(r.Context()).Subdomain,
+			SessionID: session,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(cfg.TokenExpiry).Unix(),
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[API] Failed to sign access token", "user_id", user.ID, "err", err)
+			apiFail(w, r, i18n, flowFail(http.StatusInternalServerError, "internal", "login.error.Internal"))
+			return
+		}
+		apiData(w, http.StatusOK, apiToken{
+			AccessToken: token,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(cfg.TokenExpiry.Seconds()),
+			User:        apiUser{ID: user.ID, Email: user.Email, TenantID: user.TenantID, Role: user.Role},
+		})
+	}
+}
+
+// APILogoutHandler ends the session of the access token at POST /api/v1/logout, revoking the token.
+func APILogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := middleware.BearerSession(r.Context())
+		if session == "" {
+			middleware.APIError(w, r, "unauthorized", "Access token required", http.StatusUnauthorized)
+			return
+		}
+		if err := models.DeleteSession(r.Context(), session); err != nil {
+			slog.ErrorContext(r.Context(), "[API] Failed to end session", "err", err)
+			middleware.APIError(w, r, "internal", "Internal error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIMeHandler answers the user of the access token at GET /api/v1/me.
+func APIMeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			middleware.APIError(w, r, "unauthorized", "Access token required", http.StatusUnauthorized)
+			return
+		}
+		apiData(w, http.StatusOK, apiUser{ID: user.ID, Email: user.Email, TenantID: user.TenantID, Role: user.Role})
+	}
+}
+
+// apiFeatures is the answer of GET /api/v1/features.
+type apiFeatures struct {
+	Flags map[string]bool `json:"flags"` // By name, for the tenant and the user of the access token if any
+}
+
+// APIFeaturesHandler answers the feature flags of the tenant and user at GET /api/v1/features, for
+// client-side code.
+func APIFeaturesHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.FromContext(r.Context()) == nil {
+			middleware.APIError(w, r, "no_tenant", "No tenant on this host", http.StatusNotFound)
+			return
+		}
+		apiData(w, http.StatusOK, apiFeatures{Flags: features.All(r.Context())})
+	}
+}
+
+// APIForgotPasswordHandler mails a reset link at POST /api/v1/password/forgot. Like /forgot, it
+// answers 202 whether or not the email belongs to an account.
+func APIForgotPasswordHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in apiForgotInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		if fe := requestPasswordReset(cfg, i18n, r, in.Email); fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusAccepted, apiStatus{Status: "reset_requested"})
+	}
+}
+
+// APIResetPasswordHandler stores a new password with a reset token at POST /api/v1/password/reset.
+// Every session of the user ends, revoking their access tokens.
+func APIResetPasswordHandler(i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var in apiResetInput
+		if !apiDecode(w, r, &in) {
+			return
+		}
+		if fe := resetPassword(r, in.Token, in.Password); fe != nil {
+			apiFail(w, r, i18n, fe)
+			return
+		}
+		apiData(w, http.StatusOK, apiStatus{Status: "password_reset"})
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// apiKeyView is an API key with its limit and recent consumption.
+type apiKeyView struct {
+	Key       models.APIKey
+	Limit     int
+	Today     int64
+	Throttled int64
+	Last7Days int64
+	Usage     []models.APIKeyUsage
+}
+
+// InitAPIKeyTemplates parses the templates needed for the API keys page.
+// It includes header, base layout, and API-key-specific content.
+func InitAPIKeyTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("api_keys", "api_keys.html")
+}
+
+// APIKeysHandler lets tenant admins create and revoke API keys and see their consumption.
+// POST actions: "create" mints a key shown once, "revoke" disables one.
+func APIKeysHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			keys, err := models.ListAPIKeys(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[APIKEY] Failed to list keys", "tenant", t.Subdomain, "err", err)
+			}
+			views := make([]apiKeyView, 0, len(keys))
+			for _, k := range keys {
+				v := apiKeyView{Key: k, Limit: cfg.APIRateLimit(k.Tier)}
+				usage, err := models.GetAPIKeyUsage(r.Context(), k.ID, 7)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "[APIKEY] Failed to load usage", "key_id", k.ID, "err", err)
+				}
+				for i, u := range usage {
+					if i == 0 && u.Day == todayUTC() {
+						v.Today = u.Requests
+						v.Throttled = u.Throttled
+					}
+					v.Last7Days += u.Requests
+				}
+				v.Usage = usage
+				views = append(views, v)
+			}
+			extra["Keys"] = views
+			extra["Tiers"] = cfg.API.Tiers
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to list keys
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, nil)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[APIKEY] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("apikey.error.invalid_form", lang)})
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "create":
+			// Step 4a: Mint the key and show it once
+			if err := limits.Require(r.Context(), limits.APIKeys); err != nil {
+				renderPage(http.StatusForbidden, map[string]any{"Error": limitMessage(i18n, lang, err)})
+				return
+			}
+			name := strings.TrimSpace(r.FormValue("name"))
+			if name == "" || len(name) > 100 {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("apikey.error.invalid_name", lang)})
+				return
+			}
+			tier := r.FormValue("tier")
+			if _, ok := cfg.API.Tiers[tier]; !ok {
+				tier = cfg.API.DefaultTier
+			}
+			key, err := models.CreateAPIKey(r.Context(), t.ID, user.ID, name, tier)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[APIKEY] Failed to create key", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "api_key.created",
+				IP:       middleware.ClientIP(r),
+				Details:  name,
+			})
+			slog.InfoContext(r.Context(), "[APIKEY] Key created", "tenant", t.Subdomain, "tier", tier)
+			w.Header().Set("Cache-Control", "no-store")
+			renderPage(http.StatusOK, map[string]any{"NewKey": key})
+			return
+
+		case "revoke":
+			// Step 4b: Disable the key
+			keyID, err := strconv.ParseInt(r.FormValue("key_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("apikey.error.invalid_form", lang)})
+				return
+			}
+			if err := models.RevokeAPIKey(r.Context(), t.ID, keyID); err != nil {
+				slog.ErrorContext(r.Context(), "[APIKEY] Failed to revoke key", "key_id", keyID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "api_key.revoked",
+				IP:       middleware.ClientIP(r),
+				Details:  "key_id=" + strconv.FormatInt(keyID, 10),
+			})
+			slog.InfoContext(r.Context(), "[APIKEY] Key revoked", "tenant", t.Subdomain, "key_id", keyID)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("apikey.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/settings/api-keys", http.StatusSeeOther)
+	}
+}
+
+// apiKeyInfo is the answer of GET /api/v1/whoami.
+type apiKeyInfo struct {
+	TenantID int64  `json:"tenant_id"`
+	Key      string `json:"key"` // Key prefix
+	Name     string `json:"name"`
+	Tier     string `json:"tier"`
+}
+
+// APIWhoAmIHandler returns the tenant and key behind the request, to check API credentials.
+func APIWhoAmIHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := middleware.APIKeyFromContext(r.Context())
+		if key == nil {
+			middleware.Error(w, r, "API key required", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(apiKeyInfo{TenantID: key.TenantID, Key: key.Prefix, Name: key.Name, Tier: key.Tier})
+	}
+}
+
+// todayUTC returns the current day as stored in api_key_usage.day.
+func todayUTC() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
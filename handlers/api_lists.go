@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/openapi"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+	"github.com/pandamasta/tenkit/multitenant/search"
+)
+
+// List endpoints answer {"data": [...], "pagination": {...}} (pagination.Envelope) and take the
+// paging parameters of their list: ?limit=, ?sort=, and ?offset= or the ?cursor= of the previous
+// page, as documented by pageParams.
+
+// apiMemberItem is the JSON form of a member in GET /api/v1/members.
+type apiMemberItem struct {
+	ID       int64     `json:"id"`
+	Email    string    `json:"email"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	Status   string    `json:"status"` // "active", "inactive" (deactivated) or "pending"
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// apiAuditItem is the JSON form of an audit entry in GET /api/v1/audit.
+type apiAuditItem struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	UserID    int64     `json:"user_id"` // 0 for anonymous requests
+	UserEmail string    `json:"user_email"`
+	IP        string    `json:"ip"`
+	Details   string    `json:"details"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiSearchResult is the JSON form of a result in GET /api/v1/search.
+type apiSearchResult struct {
+	Type    string  `json:"type"`
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Snippet string  `json:"snippet_html"` // Escaped excerpt, matches in <mark> elements
+	Score   float64 `json:"score"`
+}
+
+// pageParams returns the query parameters of an operation listing l, followed by its filters.
+func pageParams(l *pagination.List, filters ...openapi.Parameter) []openapi.Parameter {
+	params := []openapi.Parameter{
+		{Name: "limit", Type: "integer", Description: "Page size, up to the maximum of the list"},
+	}
+	if l.Mode == pagination.CursorMode {
+		params = append(params,
+			openapi.Parameter{Name: "cursor", Type: "string", Description: "next_cursor of the previous page"},
+			openapi.Parameter{Name: "sort", Type: "string", Description: `"id", or "-id" for newest first`})
+	} else {
+		params = append(params,
+			openapi.Parameter{Name: "offset", Type: "integer", Description: "Rows skipped"},
+			openapi.Parameter{Name: "sort", Type: "string", Description: `Sort name, prefixed with "-" for descending order`})
+	}
+	return append(params, filters...)
+}
+
+// apiPage answers a page of items in a pagination.Envelope.
+func apiPage[T any](w http.ResponseWriter, items []T, p pagination.Page) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pagination.NewEnvelope(items, p))
+}
+
+// apiAdmin returns the tenant of the request when the user of the access token administers it,
+// answering the error otherwise.
+func apiAdmin(cfg *multitenant.Config, w http.ResponseWriter, r *http.Request) *multitenant.Tenant {
+	t := middleware.FromContext(r.Context())
+	if t == nil {
+		middleware.APIError(w, r, "no_tenant", "No tenant on this host", http.StatusNotFound)
+		return nil
+	}
+	user := middleware.CurrentUser(r)
+	if user == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		middleware.APIError(w, r, "unauthorized", "Access token required", http.StatusUnauthorized)
+		return nil
+	}
+	if !cfg.Roles.Allows(user.Role, cfg.Roles.Admin) {
+		middleware.APIError(w, r, "forbidden", "Tenant admins only", http.StatusForbidden)
+		return nil
+	}
+	return t
+}
+
+// apiParse reads the page asked for from the query string of r, answering 400 when it is malformed.
+func apiParse(w http.ResponseWriter, r *http.Request, l *pagination.List) (pagination.Request, bool) {
+	req, err := l.Parse(r.URL.Query())
+	if errors.Is(err, pagination.ErrInvalid) {
+		middleware.APIError(w, r, "invalid_pagination", "Invalid limit, offset, cursor or sort", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// APIMembersHandler lists the members of the tenant to its admins at GET /api/v1/members, see
+// models.MemberList for the sorts and filters.
+func APIMembersHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := apiAdmin(cfg, w, r)
+		if t == nil {
+			return
+		}
+		req, ok := apiParse(w, r, models.MemberList)
+		if !ok {
+			return
+		}
+		members, page, err := models.PageTenantMembers(r.Context(), t.ID, req)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[API] Failed to list members", "tenant", t.Subdomain, "err", err)
+			middleware.APIError(w, r, "internal", "Internal error", http.StatusInternalServerError)
+			return
+		}
+		items := make([]apiMemberItem, 0, len(members))
+		for _, m := range members {
+			status := m.Status
+			if status == models.MembershipActive && !m.IsActive {
+				status = models.MembershipInactive
+			}
+			items = append(items, apiMemberItem{ID: m.UserID, Email: m.Email, Name: m.Name, Role: m.Role, Status: status, JoinedAt: m.JoinedAt})
+		}
+		apiPage(w, items, page)
+	}
+}
+
+// APIAuditHandler lists the audit log of the tenant to its admins at GET /api/v1/audit, newest
+// first, see models.AuditList for the filters.
+func APIAuditHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := apiAdmin(cfg, w, r)
+		if t == nil {
+			return
+		}
+		req, ok := apiParse(w, r, models.AuditList)
+		if !ok {
+			return
+		}
+		entries, page, err := models.PageAuditEntries(r.Context(), t.ID, req)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[API] Failed to list audit entries", "tenant", t.Subdomain, "err", err)
+			middleware.APIError(w, r, "internal", "Internal error", http.StatusInternalServerError)
+			return
+		}
+		items := make([]apiAuditItem, 0, len(entries))
+		for _, e := range entries {
+			items = append(items, apiAuditItem{
+				ID: e.ID, Action: e.Action, UserID: e.UserID, UserEmail: e.UserEmail,
+				IP: e.IP, Details: e.Details, RequestID: e.RequestID, CreatedAt: e.CreatedAt,
+			})
+		}
+		apiPage(w, items, page)
+	}
+}
+
+// APISearchHandler searches the data of the tenant at GET /api/v1/search?q=, best first, among the
+// documents the user of the access token may find.
+func APISearchHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil {
+			middleware.APIError(w, r, "no_tenant", "No tenant on this host", http.StatusNotFound)
+			return
+		}
+		if user == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			middleware.APIError(w, r, "unauthorized", "Access token required", http.StatusUnauthorized)
+			return
+		}
+		req, ok := apiParse(w, r, searchList)
+		if !ok {
+			return
+		}
+		if req.Filter("q") == "" {
+			middleware.APIError(w, r, "missing_query", "The q parameter is required", http.StatusBadRequest)
+			return
+		}
+		results, page, err := runSearch(cfg, r, t, user, req)
+		if errors.Is(err, search.ErrDisabled) {
+			middleware.APIError(w, r, "search_disabled", "Search is not available", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[API] Search failed", "tenant", t.Subdomain, "err", err)
+			middleware.APIError(w, r, "internal", "Internal error", http.StatusInternalServerError)
+			return
+		}
+		items := make([]apiSearchResult, 0, len(results))
+		for _, res := range results {
+			items = append(items, apiSearchResult{
+				Type: res.Type, ID: res.ID, Title: res.Title, URL: res.URL,
+				Snippet: string(res.SnippetHTML()), Score: res.Score,
+			})
+		}
+		apiPage(w, items, page)
+	}
+}
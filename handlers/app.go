@@ -0,0 +1,181 @@
+// Package handlers serves the built-in pages and endpoints of tenkit: enrollment of new tenants,
+// signup and login on tenant sites, password reset, account pages, tenant settings and member
+// administration, and the platform admin console. App registers them on a router.Router in three
+// groups: RegisterAuthRoutes, RegisterTenantRoutes and RegisterAPIRoutes. The flows listed in
+// ROUTES_DISABLED are left out.
+//
+// Pages and the JSON API under /api/v1/ share the flow code of flows.go, so both apply the same
+// checks. API responses are {"data": ...} or problem details. The login returns an access token
+// bound to the tenant and a session, sent back as Authorization: Bearer <token>.
+// /confirm and /verify only use their token on POST, so mail scanners prefetching the links do not
+// consume them (CONFIRM_ON_GET=true uses them on GET).
+//
+// Tenant admins approve members, manage join domains, signup links, groups and sub-tenants (served
+// on a subdomain of their parent and inheriting its branding and settings). Owners hand the tenant
+// over with an ownership offer. Platform admins suspend, restore and impersonate tenants: an
+// impersonation needs a reason, lasts IMPERSONATION_TTL and is named in every audit entry written
+// during it. Applications add reports to the reports page with RegisterReport.
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/openapi"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/router"
+)
+
+// App registers the built-in routes on an embedder's router, so applications compose the route groups
+// they need instead of copying the example's setup. Flows disabled in Config.Routes are not registered
+// and their templates are not parsed.
+type App struct {
+	Config    *multitenant.Config
+	I18n      *i18n.I18n
+	Store     storage.Store
+	Templates *render.Engine                  // Pages of the built-in flows
+	Screen    func(http.Handler) http.Handler // Optional guard around signup and login, e.g. middleware.ReputationGuard
+}
+
+// screen wraps h with the App's Screen guard, if any.
+func (a *App) screen(h http.Handler) http.Handler {
+	if a.Screen == nil {
+		return h
+	}
+	return a.Screen(h)
+}
+
+// RegisterAuthRoutes registers tenant enrollment, self-registration, login, logout and password reset.
+func (a *App) RegisterAuthRoutes(rt *router.Router) {
+	cfg, routes := a.Config, a.Config.Routes
+
+	if routes.Enabled(multitenant.FlowEnroll) {
+		rt.Form("/enroll", a.screen(EnrollHandler(cfg, a.I18n, InitEnrollTemplates(a.Templates)))).Name("enroll")
+		rt.Get("/enroll/check", SubdomainCheckHandler(cfg)).Name("enroll.check")
+		rt.Form("/verify", VerifyHandler(cfg, a.I18n, InitVerifyTemplates(a.Templates))).Name("verify")
+	}
+	if routes.Enabled(multitenant.FlowRegister) {
+		rt.Form("/register", a.screen(RegisterHandler(cfg, a.I18n, InitRegisterTemplates(a.Templates)))).Name("register")
+		rt.Form("/confirm", ConfirmHandler(cfg, a.I18n, InitConfirmTemplates(a.Templates))).Name("confirm")
+	}
+	rt.Form("/login", a.screen(LoginHandler(cfg, a.I18n, InitLoginTemplates(a.Templates)))).Name("login")
+	rt.Form("/logout", LogoutHandler(cfg, a.I18n)).Name("logout")
+	if routes.Enabled(multitenant.FlowPasswordReset) {
+		rt.Form("/forgot", a.screen(ForgotPasswordHandler(cfg, a.I18n, InitForgotTemplates(a.Templates)))).Name("forgot")
+		rt.Form("/reset", ResetPasswordHandler(cfg, a.I18n, InitResetTemplates(a.Templates))).Name("reset")
+	}
+	slog.Info("[ROUTES] Auth routes registered", "disabled", routes.Disabled)
+}
+
+// RegisterAPIRoutes registers the JSON API of the auth flows under /api/v1/, minus the flows disabled
+// in Config.Routes, and its OpenAPI document at /api/openapi.json. Access tokens replace session
+// cookies there, so the API is exempt from CSRF checks.
+func (a *App) RegisterAPIRoutes(rt *router.Router) {
+	cfg, routes := a.Config, a.Config.Routes
+	if !routes.Enabled(multitenant.FlowAPI) {
+		return
+	}
+	if !slices.Contains(cfg.CSRF.ExemptPaths, "/api/v1/") {
+		cfg.CSRF.ExemptPaths = append(cfg.CSRF.ExemptPaths, "/api/v1/")
+	}
+	api := func(op openapi.Operation, h http.Handler) {
+		rt.Handle([]string{op.Method}, op.Path, APINegotiate(middleware.BearerAuth(h))).Name("api." + op.ID)
+		openapi.Register(op)
+	}
+
+	if routes.Enabled(multitenant.FlowEnroll) {
+		api(apiEnrollOp, a.screen(APIEnrollHandler(cfg, a.I18n)))
+		api(apiVerifyOp, APIVerifyHandler(cfg, a.I18n))
+	}
+	if routes.Enabled(multitenant.FlowRegister) {
+		api(apiRegisterOp, a.screen(APIRegisterHandler(cfg, a.I18n)))
+		api(apiConfirmOp, APIConfirmHandler(cfg, a.I18n))
+	}
+	api(apiLoginOp, a.screen(APILoginHandler(cfg, a.I18n)))
+	api(apiLogoutOp, APILogoutHandler())
+	api(apiMeOp, APIMeHandler())
+	api(apiFeaturesOp, APIFeaturesHandler())
+	api(apiMembersOp, APIMembersHandler(cfg))
+	api(apiAuditOp, APIAuditHandler(cfg))
+	if routes.Enabled(multitenant.FlowSearch) {
+		api(apiSearchOp, APISearchHandler(cfg))
+	}
+	if routes.Enabled(multitenant.FlowPasswordReset) {
+		api(apiForgotOp, a.screen(APIForgotPasswordHandler(cfg, a.I18n)))
+		api(apiResetOp, APIResetPasswordHandler(a.I18n))
+	}
+	rt.Get("/api/openapi.json", OpenAPIHandler(cfg)).Name("api.openapi")
+	slog.Info("[ROUTES] API routes registered", "disabled", routes.Disabled)
+}
+
+// RegisterTenantRoutes registers the member pages and the tenant admin settings, which are only
+// served on tenant hosts.
+func (a *App) RegisterTenantRoutes(rt *router.Router) {
+	cfg, routes, tmpl := a.Config, a.Config.Routes, a.Templates
+	g := router.StandardGroups(rt, cfg)
+
+	// Member pages
+	g.Auth.Form("/account/profile", ProfileHandler(cfg, a.I18n, InitProfileTemplates(tmpl), a.Store)).Name("account.profile")
+	g.Auth.Get("/avatars/{id}", AvatarHandler(a.Store)).Name("avatar")
+	g.Tenant.Form("/ownership", OwnershipHandler(cfg, a.I18n, InitOwnershipTemplates(tmpl))).Name("ownership")
+	if routes.Enabled(multitenant.FlowExport) {
+		g.Auth.Form("/account/export", ExportHandler(cfg, a.Store, a.I18n, InitExportTemplates(tmpl))).Name("account.export")
+		g.Auth.Get("/account/export/download", ExportDownloadHandler(cfg, a.Store)).Name("account.export.download")
+	}
+	if routes.Enabled(multitenant.FlowCalendar) {
+		g.Auth.Form("/account/calendar", CalendarPageHandler(cfg, a.I18n, InitCalendarTemplates(tmpl))).Name("account.calendar")
+		g.Public.Get("/calendar/{file}", CalendarFeedHandler(cfg)).Name("calendar.feed")
+	}
+	if routes.Enabled(multitenant.FlowNotifications) {
+		notifications := InitNotificationTemplates(tmpl)
+		g.Auth.Get("/notifications", NotificationsHandler(a.I18n, notifications)).Name("notifications")
+		g.Auth.Get("/notifications/{id}", OpenNotificationHandler()).Name("notifications.open")
+		g.Auth.Post("/notifications/read", NotificationReadHandler(a.I18n, notifications)).Name("notifications.read")
+		g.Auth.Post("/notifications/dismiss", NotificationDismissHandler(a.I18n, notifications)).Name("notifications.dismiss")
+	}
+	if routes.Enabled(multitenant.FlowRealtime) {
+		g.Auth.Get("/events", EventStreamHandler(cfg)).Name("events")
+	}
+	if routes.Enabled(multitenant.FlowSearch) {
+		g.Auth.Get("/search", SearchHandler(cfg, a.I18n, InitSearchTemplates(tmpl))).Name("search")
+	}
+	if routes.Enabled(multitenant.FlowGroups) {
+		g.Auth.Form("/groups", GroupsHandler(cfg, a.I18n, InitGroupsTemplates(tmpl))).Name("groups")
+		g.Auth.Form("/groups/{id}", GroupHandler(cfg, a.I18n, InitGroupTemplates(tmpl))).Name("group")
+	}
+
+	// Tenant admin settings
+	g.Admin.Form("/settings/email-domain", EmailDomainHandler(a.I18n, InitEmailDomainTemplates(tmpl))).Name("settings.email_domain")
+	g.Admin.Form("/settings/navigation", NavigationSettingsHandler(a.I18n, InitNavigationTemplates(tmpl))).Name("settings.navigation")
+	g.Admin.Form("/settings/launch", LaunchSettingsHandler(a.I18n, InitLaunchTemplates(tmpl))).Name("settings.launch")
+	g.Admin.Form("/settings/domain", CustomDomainHandler(cfg, a.I18n, InitCustomDomainTemplates(tmpl))).Name("settings.domain")
+	g.Admin.Form("/settings/members", MembersHandler(cfg, a.I18n, InitMembersTemplates(tmpl))).Name("settings.members")
+	g.Admin.Form("/admin/members", MemberAdminHandler(cfg, a.I18n, InitMemberAdminTemplates(tmpl))).Name("admin.members")
+	g.Admin.Get("/admin/audit", AuditLogHandler(a.I18n, InitAuditTemplates(tmpl))).Name("admin.audit")
+	g.Admin.Form("/settings/general", TenantSettingsHandler(a.I18n, InitTenantSettingsTemplates(tmpl))).Name("settings.general")
+	g.Admin.Form("/settings/branding", BrandingHandler(a.I18n, InitBrandingTemplates(tmpl), a.Store)).Name("settings.branding")
+	g.Admin.Form("/settings/meta", MetaSettingsHandler(a.I18n, InitMetaTemplates(tmpl))).Name("settings.meta")
+	if routes.Enabled(multitenant.FlowAPIKeys) {
+		g.Admin.Form("/settings/api-keys", APIKeysHandler(cfg, a.I18n, InitAPIKeyTemplates(tmpl))).Name("settings.api_keys")
+	}
+	if routes.Enabled(multitenant.FlowSubTenants) {
+		g.Admin.Form("/settings/sub-tenants", SubTenantsHandler(cfg, a.I18n, InitSubTenantTemplates(tmpl))).Name("settings.sub_tenants")
+	}
+	if routes.Enabled(multitenant.FlowWebhooks) {
+		g.Admin.Form("/settings/webhooks", WebhooksHandler(cfg, a.I18n, InitWebhookTemplates(tmpl))).Name("settings.webhooks")
+	}
+
+	// Background reports, polled through /jobs/{id}
+	if routes.Enabled(multitenant.FlowReports) {
+		g.Admin.Form("/settings/reports", ReportsPageHandler(a.I18n, InitReportTemplates(tmpl))).Name("settings.reports")
+		g.Admin.Post("/reports/{kind}", EnqueueReportHandler(cfg, a.Store)).Name("reports.enqueue")
+		g.Auth.Get("/jobs/{id}", JobStatusHandler(cfg)).Name("job")
+		g.Auth.Get("/jobs/{id}/download", JobDownloadHandler(cfg, a.Store)).Name("job.download")
+	}
+	slog.Info("[ROUTES] Tenant routes registered", "disabled", routes.Disabled)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitAuditTemplates parses the templates needed for the tenant audit log.
+// It includes header, base layout, and audit-specific content.
+func InitAuditTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("audit", "audit.html")
+}
+
+// AuditLogHandler shows tenant admins the audit log of their tenant at GET /admin/audit, newest
+// first, filtered by ?action= and ?user= (ID or email), see models.AuditList.
+func AuditLogHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Read the page asked for; a stale or malformed cursor restarts from the newest entries
+		req, err := models.AuditList.Parse(r.URL.Query())
+		extra := map[string]any{}
+		if err != nil {
+			extra["Error"] = i18n.T("audit.error.invalid_page", lang)
+		}
+
+		// Step 3: Load the page
+		entries, page, err := models.PageAuditEntries(r.Context(), t.ID, req)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[AUDIT] Failed to list audit entries", "tenant", t.Subdomain, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		extra["Entries"] = entries
+		extra["Page"] = page
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
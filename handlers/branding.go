@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+)
+
+// logoRules bound uploaded logos: raster images up to 1 MB.
+var logoRules = storage.ImageRules
+
+// InitBrandingTemplates parses the templates needed for the branding settings page.
+// It includes header, base layout, and branding-specific content.
+func InitBrandingTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("branding", "branding.html")
+}
+
+// BrandingHandler lets tenant admins set their colors, theme and logo.
+// POST actions: "colors" saves the colors and theme, "logo" uploads a logo to store, "remove_logo" deletes it.
+func BrandingHandler(i18n *i18n.I18n, tmpl *render.Page, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and admin from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			b, err := models.GetTenantBranding(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to load branding", "tenant", t.Subdomain, "err", err)
+			}
+			extra["Branding"] = b
+			extra["Themes"] = multitenant.BrandThemes
+			extra["MaxLogoKB"] = logoRules.MaxSize >> 10
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the branding
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("branding.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse the form data; CSRFMiddleware already parsed multipart uploads
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[BRAND] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("branding.error.invalid_form", lang)})
+			return
+		}
+
+		var details string
+		switch action := r.FormValue("action"); action {
+		case "colors":
+			// Step 4a: Save the colors and theme
+			primary := strings.TrimSpace(r.FormValue("primary_color"))
+			secondary := strings.TrimSpace(r.FormValue("secondary_color"))
+			theme := r.FormValue("theme")
+			if !multitenant.ValidBrandColor(primary) || !multitenant.ValidBrandColor(secondary) || !multitenant.ValidBrandTheme(theme) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("branding.error.invalid_color", lang)})
+				return
+			}
+			if err := models.SetTenantColors(r.Context(), t.ID, primary, secondary, theme); err != nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to save colors", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			details = strings.TrimSpace(fmt.Sprintf("colors %s %s %s", primary, secondary, theme))
+
+		case "logo":
+			// Step 4b: Check the upload by size and content, not by its declared type
+			file, header, err := r.FormFile("logo")
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("branding.error.invalid_logo", lang, logoRules.MaxSize>>10)})
+				return
+			}
+			defer file.Close()
+			var upload *storage.Upload
+			if header.Size > logoRules.MaxSize {
+				err = storage.ErrTooLarge
+			} else {
+				upload, err = storage.ReadUpload(file, logoRules)
+			}
+			if err != nil {
+				slog.InfoContext(r.Context(), "[BRAND] Rejected logo", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("branding.error.invalid_logo", lang, logoRules.MaxSize>>10)})
+				return
+			}
+
+			// Store the new logo, then drop the previous one
+			old, err := models.GetTenantBranding(r.Context(), t.ID)
+			if err != nil || old == nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to load branding", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if err := limits.Check(r.Context(), limits.Storage, int64(len(upload.Data))); err != nil {
+				if msg := limitMessage(i18n, lang, err); msg != "" {
+					slog.InfoContext(r.Context(), "[BRAND] Storage limit reached", "tenant", t.Subdomain, "err", err)
+					renderPage(http.StatusForbidden, map[string]any{"Error": msg})
+					return
+				}
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to check storage limit", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			key := storage.LogoKey(t.ID, upload.Ext, time.Now())
+			if err := store.Put(r.Context(), key, bytes.NewReader(upload.Data), upload.ContentType); err != nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to store logo", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if err := models.SetTenantLogo(r.Context(), t.ID, key); err != nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to save logo", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			deleteLogo(r, store, old.LogoKey)
+			details = "logo " + upload.ContentType + " " + strconv.Itoa(len(upload.Data))
+
+		case "remove_logo":
+			// Step 4c: Remove the logo
+			old, err := models.GetTenantBranding(r.Context(), t.ID)
+			if err == nil && old != nil {
+				err = models.SetTenantLogo(r.Context(), t.ID, "")
+			}
+			if err != nil || old == nil {
+				slog.ErrorContext(r.Context(), "[BRAND] Failed to remove logo", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			deleteLogo(r, store, old.LogoKey)
+			details = "logo removed"
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("branding.error.invalid_form", lang)})
+			return
+		}
+
+		// Step 5: Record the change
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   "branding.updated",
+			IP:       middleware.ClientIP(r),
+			Details:  details,
+		})
+		slog.InfoContext(r.Context(), "[BRAND] Branding updated", "tenant", t.Subdomain, "details", details)
+		http.Redirect(w, r, "/settings/branding?saved=1", http.StatusSeeOther)
+	}
+}
+
+// deleteLogo removes a replaced logo from storage; failures only leave an orphaned file behind.
+func deleteLogo(r *http.Request, store storage.Store, key string) {
+	if key == "" {
+		return
+	}
+	if err := store.Delete(r.Context(), key); err != nil {
+		slog.WarnContext(r.Context(), "[BRAND] Failed to delete previous logo", "key", key, "err", err)
+	}
+}
+
+// LogoHandler serves the uploaded logo of the tenant at /branding/logo. Requests carrying the
+// version of the stored logo path (?v=) may be cached indefinitely since every upload changes it.
+func LogoHandler(store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := models.GetTenantBranding(r.Context(), t.ID)
+		if err == nil && (b == nil || b.LogoKey == "") && t.ParentID != 0 {
+			// Sub-tenants without a logo of their own show the parent's
+			b, err = models.GetTenantBranding(r.Context(), t.ParentID)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[BRAND] Failed to load branding", "tenant", t.Subdomain, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if b == nil || b.LogoKey == "" {
+			http.NotFound(w, r)
+			return
+		}
+		version := strings.TrimPrefix(b.LogoPath, "/branding/logo?v=")
+		if brandNotModified(w, r, fmt.Sprintf(`"logo-%d-%s"`, t.ID, version), version) {
+			return
+		}
+
+		body, err := store.Get(r.Context(), b.LogoKey)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[BRAND] Failed to read logo", "tenant", t.Subdomain, "key", b.LogoKey, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", storage.ContentTypeOf(b.LogoKey))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := io.Copy(w, body); err != nil {
+			slog.ErrorContext(r.Context(), "[BRAND] Failed to stream logo", "tenant", t.Subdomain, "err", err)
+		}
+	}
+}
+
+// ThemeCSSHandler serves /branding/theme.css, overriding the daisyUI colors with the tenant's own.
+// The stylesheet is generated from the cached tenant, so serving it costs no query.
+func ThemeCSSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			return
+		}
+		b := t.Brand
+		version := strconv.FormatInt(b.Version, 10)
+		if brandNotModified(w, r, fmt.Sprintf(`"theme-%d-%s"`, t.ID, version), version) {
+			return
+		}
+
+		var css strings.Builder
+		for _, c := range []struct{ name, value string }{{"primary", b.PrimaryColor}, {"secondary", b.SecondaryColor}} {
+			if !multitenant.ValidBrandColor(c.value) || c.value == "" {
+				continue
+			}
+			fmt.Fprintf(&css, ":root{--tenant-%[1]s:%[2]s;--tenant-%[1]s-content:%[3]s}\n", c.name, c.value, multitenant.ContrastColor(c.value))
+			fmt.Fprintf(&css, ".btn-%[1]s{background-color:var(--tenant-%[1]s);border-color:var(--tenant-%[1]s);color:var(--tenant-%[1]s-content)}\n", c.name)
+			fmt.Fprintf(&css, ".bg-%[1]s{background-color:var(--tenant-%[1]s);color:var(--tenant-%[1]s-content)}\n", c.name)
+			fmt.Fprintf(&css, ".text-%[1]s,.link-%[1]s{color:var(--tenant-%[1]s)}\n", c.name)
+		}
+		io.WriteString(w, css.String())
+	}
+}
+
+// brandNotModified sets the caching headers of a branding asset and answers conditional requests.
+// Versioned URLs are immutable; unversioned ones are revalidated after a few minutes.
+func brandNotModified(w http.ResponseWriter, r *http.Request, etag, version string) bool {
+	w.Header().Set("ETag", etag)
+	if r.URL.Query().Get("v") == version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
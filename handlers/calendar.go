@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/ics"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// calendarTokenLifetime is how long a subscription URL keeps working.
+// Calendar apps poll the same URL for months, so it is much longer than other links; the URLs stop
+// working earlier when their user resets them or leaves the tenant.
+const calendarTokenLifetime = 365 * 24 * time.Hour
+
+// calendarLink is a registered feed with the current user's subscription URLs.
+type calendarLink struct {
+	Feed   ics.Feed
+	URL    string
+	Webcal string
+}
+
+// InitCalendarTemplates parses the templates needed for the calendar subscription page.
+// It includes header, base layout, and calendar-specific content.
+func InitCalendarTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("calendar", "calendar.html")
+}
+
+// CalendarPageHandler lists the registered feeds with the user's signed subscription URLs. POST
+// resets them: the user gets a new calendar feed secret and the URLs handed out before stop working.
+func CalendarPageHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		// Step 1: Reset the URLs on request
+		if r.Method == http.MethodPost {
+			if _, err := models.RotateCalendarSecret(r.Context(), user.TenantID, user.ID); err != nil {
+				slog.ErrorContext(r.Context(), "[CALENDAR] Failed to reset feed secret", "user_id", user.ID, "err", err)
+				middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: user.TenantID,
+				UserID:   user.ID,
+				Action:   "calendar.links_reset",
+				IP:       middleware.ClientIP(r),
+			})
+			slog.InfoContext(r.Context(), "[CALENDAR] Feed URLs reset", "user_id", user.ID)
+			http.Redirect(w, r, "/account/calendar?reset=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 2: Sign the URLs with the user's feed secret
+		secret, err := models.CalendarSecret(r.Context(), user.TenantID, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Failed to load feed secret", "user_id", user.ID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		token, err := utils.GenerateCalendarToken(tokenAudience(cfg, r), user.ID, user.TenantID, secret, time.Now().Add(calendarTokenLifetime))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Failed to sign feed token", "user_id", user.ID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		var links []calendarLink
+		for _, f := range ics.Feeds() {
+			path := r.Host + "/calendar/" + f.Name + ".ics?token=" + token
+			scheme := "https://"
+			if r.TLS == nil && cfg.IsDev() {
+				scheme = "http://"
+			}
+			links = append(links, calendarLink{Feed: f, URL: scheme + path, Webcal: "webcal://" + path})
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, map[string]any{
+			"Links": links,
+			"Reset": r.URL.Query().Get("reset") == "1",
+		}))
+	}
+}
+
+// CalendarFeedHandler serves /calendar/{file} where file is "<feed>.ics". It authenticates with the
+// signed token in the query instead of the session, since calendar apps fetch it without cookies,
+// and checks on every fetch that the user is still an active member and did not reset their URLs.
+func CalendarFeedHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Resolve the feed
+		name, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+		feed, found := ics.Lookup(name)
+		if !ok || !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Validate the token for this tenant
+		userID, tenantID, secret, ok := utils.ValidateCalendarToken(r.URL.Query().Get("token"), tokenAudience(cfg, r))
+		if t := middleware.FromContext(r.Context()); !ok || (t != nil && t.ID != tenantID) {
+			slog.InfoContext(r.Context(), "[CALENDAR] Invalid or expired feed token", "feed", name)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 3: Check that the user is still an active member and the URL was not reset
+		current, err := models.GetCalendarSecret(r.Context(), tenantID, userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Failed to load feed secret", "user_id", userID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		status, err := models.GetMembershipStatus(r.Context(), userID, tenantID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Failed to load membership", "user_id", userID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if current == "" || subtle.ConstantTimeCompare([]byte(current), []byte(secret)) != 1 || status != models.MembershipActive {
+			slog.InfoContext(r.Context(), "[CALENDAR] Revoked feed token", "feed", name, "user_id", userID, "status", status)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 4: Collect and render the events
+		events, err := feed.Source(r.Context(), tenantID, userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Feed source failed", "feed", name, "user_id", userID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		cal := ics.Calendar{Name: feed.Name, ProdID: "-//tenkit//" + cfg.Domain + "//EN", Events: events}
+		if t := middleware.FromContext(r.Context()); t != nil {
+			cal.Name = t.Name + " – " + feed.Name
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="`+feed.Name+`.ics"`)
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		if _, err := cal.WriteTo(w); err != nil {
+			slog.ErrorContext(r.Context(), "[CALENDAR] Failed to write feed", "feed", name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitCustomDomainTemplates parses the templates needed for the custom domain settings page.
+// It includes header, base layout, and custom-domain-specific content.
+func InitCustomDomainTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("custom_domain", "custom_domain.html")
+}
+
+// CustomDomainHandler lets tenant admins serve their site on their own domain.
+// POST actions: "set" claims a domain, "verify" checks DNS now, "remove" deletes it.
+// Pending domains are also checked in the background by VerifyPendingDomains.
+func CustomDomainHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			d, err := models.GetCustomDomain(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[DOMAIN] Failed to load domain", "tenant", t.Subdomain, "err", err)
+			}
+			if d != nil {
+				extra["Domain"] = d
+				extra["RecordName"], extra["RecordValue"] = multitenant.DomainVerifyRecord(d.Domain, d.Token)
+			}
+			extra["Target"] = tenantHost(cfg, t.Subdomain)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the current state
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, nil)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[DOMAIN] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("domain.error.invalid_form", lang)})
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "set":
+			// Step 4a: Claim the domain; it resolves only once verified
+			domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(r.FormValue("domain"))), ".")
+			root := tenantHost(cfg, "")
+			if err := limits.Require(r.Context(), limits.CustomDomain); err != nil {
+				renderPage(http.StatusForbidden, map[string]any{"Error": limitMessage(i18n, lang, err)})
+				return
+			}
+			if !domainRegex.MatchString(domain) || domain == root || strings.HasSuffix(domain, "."+root) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("domain.error.invalid_domain", lang)})
+				return
+			}
+			taken, err := models.CustomDomainTaken(r.Context(), domain, t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[DOMAIN] Failed to check domain", "domain", domain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if taken {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("domain.error.taken", lang)})
+				return
+			}
+			if err := models.SetCustomDomain(r.Context(), t.ID, domain); err != nil {
+				slog.ErrorContext(r.Context(), "[DOMAIN] Failed to save domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "custom_domain.added",
+				IP:       middleware.ClientIP(r),
+				Details:  domain,
+			})
+			slog.InfoContext(r.Context(), "[DOMAIN] Domain added", "tenant", t.Subdomain, "domain", domain)
+
+		case "verify":
+			// Step 4b: Check DNS right away instead of waiting for the background verifier
+			d, err := models.GetCustomDomain(r.Context(), t.ID)
+			if err != nil || d == nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("domain.error.not_configured", lang)})
+				return
+			}
+			if err := checkCustomDomain(r.Context(), cfg, t.Subdomain, *d); errors.Is(err, models.ErrCustomDomainTaken) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("domain.error.taken", lang)})
+				return
+			} else if err != nil {
+				renderPage(http.StatusOK, map[string]any{"Error": i18n.T("domain.error.verification_failed", lang)})
+				return
+			}
+
+		case "remove":
+			// Step 4c: Stop serving the domain
+			if err := models.DeleteCustomDomain(r.Context(), t.ID); err != nil {
+				slog.ErrorContext(r.Context(), "[DOMAIN] Failed to remove domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "custom_domain.removed",
+				IP:       middleware.ClientIP(r),
+			})
+			slog.InfoContext(r.Context(), "[DOMAIN] Domain removed", "tenant", t.Subdomain)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("domain.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/settings/domain", http.StatusSeeOther)
+	}
+}
+
+// VerifyPendingDomains checks the DNS of every unverified custom domain and activates those that pass.
+func VerifyPendingDomains(ctx context.Context, cfg *multitenant.Config) {
+	pending, err := models.ListPendingCustomDomains(ctx)
+	if err != nil {
+		slog.Error("[DOMAIN] Failed to list pending domains", "err", err)
+		return
+	}
+	for _, d := range pending {
+		sub, err := models.GetTenantSubdomain(ctx, d.TenantID)
+		if err != nil || sub == "" {
+			slog.Error("[DOMAIN] Failed to load tenant of domain", "domain", d.Domain, "tenant_id", d.TenantID, "err", err)
+			continue
+		}
+		checkCustomDomain(ctx, cfg, sub, d)
+	}
+}
+
+// checkCustomDomain runs the DNS check and records its outcome.
+func checkCustomDomain(ctx context.Context, cfg *multitenant.Config, subdomain string, d models.CustomDomain) error {
+	checkErr := multitenant.VerifyCustomDomain(ctx, d.Domain, d.Token, tenantHost(cfg, subdomain))
+	err := models.RecordCustomDomainCheck(ctx, d.TenantID, checkErr)
+	if errors.Is(err, models.ErrCustomDomainTaken) {
+		// Another tenant proved control first: keep the claim, failed, until it is removed
+		checkErr = err
+		err = models.RecordCustomDomainCheck(ctx, d.TenantID, checkErr)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "[DOMAIN] Failed to record check", "domain", d.Domain, "err", err)
+		return err
+	}
+	if checkErr != nil {
+		slog.InfoContext(ctx, "[DOMAIN] Verification failed", "domain", d.Domain, "err", checkErr)
+		return checkErr
+	}
+	if !d.IsVerified {
+		models.LogAudit(ctx, models.AuditEntry{TenantID: d.TenantID, Action: "custom_domain.verified", Details: d.Domain})
+		slog.InfoContext(ctx, "[DOMAIN] Domain verified", "domain", d.Domain, "tenant_id", d.TenantID)
+	}
+	return nil
+}
+
+// tenantHost returns the host of a tenant under the root domain, or the root domain itself, without port.
+func tenantHost(cfg *multitenant.Config, subdomain string) string {
+	root := cfg.Domain
+	if h, _, err := net.SplitHostPort(root); err == nil {
+		root = h
+	}
+	if subdomain == "" {
+		return root
+	}
+	return subdomain + "." + root
+}
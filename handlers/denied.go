@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitDeniedTemplates parses the templates needed for the access denied page.
+// It includes header, base layout, and denial-specific content.
+func InitDeniedTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("denied", "denied.html")
+}
+
+// GeoDeniedHandler renders the page shown when a tenant's geo policy blocks a visitor.
+// The status code is set by middleware.GeoRestriction before this handler runs.
+func GeoDeniedHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return deniedHandler(i18n, tmpl, "geo.denied")
+}
+
+// ReputationBlockedHandler renders the page shown when a request comes from a blocked IP.
+// The status code is set by middleware.ReputationGuard before this handler runs.
+func ReputationBlockedHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return deniedHandler(i18n, tmpl, "reputation.blocked")
+}
+
+// IPDeniedHandler renders the page shown when a tenant's IP lists block a visitor.
+// The status code is set by middleware.IPAccess before this handler runs.
+func IPDeniedHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return deniedHandler(i18n, tmpl, "ip_access.denied")
+}
+
+func deniedHandler(i18n *i18n.I18n, tmpl *render.Page, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		data := render.BaseTemplateData(r, i18n, map[string]any{
+			"Message": i18n.T(key, lang),
+		})
+		render.RenderTemplate(w, tmpl, "base", data)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+	"github.com/pandamasta/tenkit/multitenant/forms"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// emailDomainForm is the form setting the sending domain.
+var emailDomainForm = forms.New(
+	forms.Field{Name: "domain", Required: true, Lower: true, Checks: []forms.Check{forms.Pattern(domainRegex, "maildomain.error.invalid_domain")}},
+)
+
+// InitEmailDomainTemplates parses the templates needed for the email domain settings page.
+// It includes header, base layout, and email-domain-specific content.
+func InitEmailDomainTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("email_domain", "email_domain.html")
+}
+
+// EmailDomainHandler lets tenant admins send email from their own domain.
+// POST actions: "set" generates a DKIM key for a domain, "verify" checks DNS, "remove" deletes it.
+func EmailDomainHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			d, err := models.GetEmailDomain(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Failed to load domain", "tenant", t.Subdomain, "err", err)
+			}
+			if d != nil {
+				extra["Domain"] = d
+				if key, err := mail.DomainKey(r.Context(), d); err == nil {
+					name, value, _ := mail.DKIMRecord(d.Domain, d.Selector, key)
+					extra["RecordName"] = name
+					extra["RecordValue"] = value
+				}
+			}
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the current state
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, nil)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[MAILDOMAIN] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("maildomain.error.invalid_form", lang)})
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "set":
+			// Step 4a: Generate a DKIM key for the new domain
+			form := emailDomainForm.Parse(r)
+			if !form.Valid() {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": form.Error("domain")})
+				return
+			}
+			domain := form.Get("domain")
+			key, err := mail.GenerateDKIMKey()
+			if err == nil {
+				key, err = crypto.DKIMKey.Encrypt(r.Context(), t.ID, key)
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Key generation failed", "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			err = models.SetEmailDomain(r.Context(), models.EmailDomain{
+				TenantID:   t.ID,
+				Domain:     domain,
+				Selector:   "tenkit" + time.Now().Format("200601"),
+				PrivateKey: key,
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Failed to save domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			slog.InfoContext(r.Context(), "[MAILDOMAIN] Domain configured", "tenant", t.Subdomain, "domain", domain)
+
+		case "verify":
+			// Step 4b: Check the published DNS record
+			d, err := models.GetEmailDomain(r.Context(), t.ID)
+			if err != nil || d == nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("maildomain.error.not_configured", lang)})
+				return
+			}
+			key, err := mail.DomainKey(r.Context(), d)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Stored key is invalid", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			checkErr := mail.VerifyDKIMRecord(d.Domain, d.Selector, key)
+			if err := models.RecordEmailDomainCheck(r.Context(), t.ID, checkErr); err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Failed to record check", "tenant", t.Subdomain, "err", err)
+			}
+			if checkErr != nil {
+				slog.InfoContext(r.Context(), "[MAILDOMAIN] Verification failed", "tenant", t.Subdomain, "domain", d.Domain, "err", checkErr)
+				renderPage(http.StatusOK, map[string]any{"Error": i18n.T("maildomain.error.verification_failed", lang)})
+				return
+			}
+			slog.InfoContext(r.Context(), "[MAILDOMAIN] Domain verified", "tenant", t.Subdomain, "domain", d.Domain)
+
+		case "remove":
+			// Step 4c: Go back to the platform sender
+			if err := models.DeleteEmailDomain(r.Context(), t.ID); err != nil {
+				slog.ErrorContext(r.Context(), "[MAILDOMAIN] Failed to remove domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			slog.InfoContext(r.Context(), "[MAILDOMAIN] Domain removed", "tenant", t.Subdomain)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("maildomain.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/settings/email-domain", http.StatusSeeOther)
+	}
+}
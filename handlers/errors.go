@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// InitErrorTemplates parses the templates needed for the error pages.
+// It includes header, base layout, and error-specific content.
+func InitErrorTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("error", "error.html")
+}
+
+// ErrorPage renders the branded error pages of browser requests; set middleware.ErrorPage to it so
+// the 403, 404 and 500 answers of the middleware, of Recover and of handlers share the site layout.
+// Pages for unknown tenants link back to the root domain.
+func ErrorPage(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) func(http.ResponseWriter, *http.Request, *middleware.Problem) {
+	return func(w http.ResponseWriter, r *http.Request, p *middleware.Problem) {
+		data := render.BaseTemplateData(r, i18n, map[string]any{"Problem": p})
+		data.SupportCode = p.SupportCode
+		data.Extra["Error"] = p.Detail
+		if p.Code == "no_tenant" || p.Code == "invalid_domain" {
+			data.Extra["HomeURL"] = urls.Marketing(cfg, "/", nil)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(p.Status)
+		render.RenderTemplate(w, tmpl, "base", data)
+	}
+}
+
+// NotFoundHandler answers 404 for paths no route serves, as the error page for browsers.
+func NotFoundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.WriteError(w, r, middleware.ErrNotFound)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// exportView is what the export page shows for each requested export.
+type exportView struct {
+	CreatedAt time.Time
+	Status    string
+	Link      string
+}
+
+// InitExportTemplates parses the templates needed for the data export page.
+// It includes header, base layout, and export-specific content.
+func InitExportTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("export", "export.html")
+}
+
+// ExportHandler lists the user's data exports on GET and requests a new one on POST.
+// Exports are generated in the background; the page links to them once ready.
+func ExportHandler(cfg *multitenant.Config, store storage.Store, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		// Step 1: Handle POST request to enqueue a new export
+		if r.Method == http.MethodPost {
+			id, err := models.CreateDataExport(r.Context(), user.ID, user.TenantID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[EXPORT] Failed to create export", "user_id", user.ID, "err", err)
+				data := render.BaseTemplateData(r, i18n, map[string]any{
+					"Error": i18n.T("export.error.internal", lang),
+				})
+				w.WriteHeader(http.StatusInternalServerError)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			slog.InfoContext(r.Context(), "[EXPORT] Export requested", "export_id", id, "user_id", user.ID)
+			go generateUserExport(cfg, store, id, user.ID, user.TenantID)
+			http.Redirect(w, r, "/account/export?requested=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 2: List previous exports with signed links for the ready ones
+		exports, err := models.ListDataExports(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[EXPORT] Failed to list exports", "user_id", user.ID, "err", err)
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Error": i18n.T("export.error.internal", lang),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			render.RenderTemplate(w, tmpl, "base", data)
+			return
+		}
+
+		views := make([]exportView, 0, len(exports))
+		for _, e := range exports {
+			v := exportView{CreatedAt: e.CreatedAt, Status: e.Status}
+			if e.Status == models.ExportReady && e.ExpiresAt.Valid && e.ExpiresAt.Time.After(time.Now()) {
+				token, err := utils.GenerateExportToken(tokenAudience(cfg, r), e.ID, user.ID, e.ExpiresAt.Time)
+				if err == nil {
+					v.Link = "/account/export/download?token=" + token
+				}
+			}
+			views = append(views, v)
+		}
+
+		// Step 3: Render the page
+		extra := map[string]any{"Exports": views}
+		if r.URL.Query().Get("requested") != "" {
+			extra["Success"] = i18n.T("export.requested", lang)
+		}
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
+
+// ExportDownloadHandler serves a ready export to its owner when the signed link is valid.
+func ExportDownloadHandler(cfg *multitenant.Config, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Validate the signed token
+		exportID, userID, ok := utils.ValidateExportToken(r.URL.Query().Get("token"), tokenAudience(cfg, r))
+		if !ok {
+			slog.InfoContext(r.Context(), "[EXPORT] Invalid or expired download token")
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Only the owner may download, even with a valid link
+		user := middleware.CurrentUser(r)
+		if user == nil || user.ID != userID {
+			slog.WarnContext(r.Context(), "[EXPORT] Download attempted by another user", "export_id", exportID)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 3: Load the export and serve the file
+		e, err := models.GetDataExport(r.Context(), exportID)
+		if err != nil || e == nil || e.UserID != userID || e.Status != models.ExportReady || !e.StorageKey.Valid {
+			slog.InfoContext(r.Context(), "[EXPORT] Export not available", "export_id", exportID, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		if e.ExpiresAt.Valid && e.ExpiresAt.Time.Before(time.Now()) {
+			slog.InfoContext(r.Context(), "[EXPORT] Export expired", "export_id", exportID)
+			http.NotFound(w, r)
+			return
+		}
+
+		body, err := store.Get(r.Context(), e.StorageKey.String)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[EXPORT] Failed to read export", "export_id", exportID, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.json"`, e.ID))
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := io.Copy(w, body); err != nil {
+			slog.ErrorContext(r.Context(), "[EXPORT] Failed to stream export", "export_id", exportID, "err", err)
+		}
+	}
+}
+
+// generateUserExport builds the export document and writes it to the store.
+func generateUserExport(cfg *multitenant.Config, store storage.Store, exportID, userID, tenantID int64) {
+	ctx := context.Background()
+
+	fail := func(err error) {
+		slog.Error("[EXPORT] Export failed", "export_id", exportID, "err", err)
+		if mErr := models.MarkDataExportFailed(ctx, exportID, err); mErr != nil {
+			slog.Error("[EXPORT] Failed to record export failure", "export_id", exportID, "err", mErr)
+		}
+	}
+
+	doc, err := models.BuildUserExport(ctx, userID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	body, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		fail(err)
+		return
+	}
+	key := storage.ExportKey(tenantID, exportID, time.Now())
+	if err := store.Put(ctx, key, bytes.NewReader(body), "application/json"); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := models.MarkDataExportReady(ctx, exportID, key, time.Now().Add(cfg.Export.LinkExpiry)); err != nil {
+		fail(err)
+		return
+	}
+	slog.Info("[EXPORT] Export ready", "export_id", exportID, "user_id", userID)
+}
+
+// PurgeExpiredExports deletes exports whose download links have expired.
+// Tenants on legal hold are skipped until the hold is released.
+func PurgeExpiredExports(ctx context.Context, store storage.Store) {
+	exports, err := models.ExpiredDataExports(ctx)
+	if err != nil {
+		slog.Error("[EXPORT] Failed to list expired exports", "err", err)
+		return
+	}
+	for _, e := range exports {
+		// Step 1: Recheck the hold right before deleting anything
+		if err := models.CheckLegalHold(ctx, e.TenantID); err != nil {
+			slog.Info("[EXPORT] Purge skipped", "export_id", e.ID, "tenant_id", e.TenantID, "err", err)
+			continue
+		}
+
+		// Step 2: Remove the file, then the record
+		if e.StorageKey.Valid {
+			if err := store.Delete(ctx, e.StorageKey.String); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				slog.Error("[EXPORT] Failed to delete export file", "export_id", e.ID, "err", err)
+				continue
+			}
+		}
+		if err := models.DeleteDataExport(ctx, e); err != nil {
+			slog.Error("[EXPORT] Failed to delete export", "export_id", e.ID, "err", err)
+			continue
+		}
+		slog.Info("[EXPORT] Expired export purged", "export_id", e.ID)
+	}
+}
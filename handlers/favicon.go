@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// cssColor accepts the hex colors a manifest theme_color can safely carry.
+var cssColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// webManifest is the subset of the Web App Manifest spec served per tenant.
+type webManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	StartURL        string         `json:"start_url"`
+	Display         string         `json:"display"`
+	ThemeColor      string         `json:"theme_color"`
+	BackgroundColor string         `json:"background_color"`
+	Icons           []manifestIcon `json:"icons"`
+}
+
+type manifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type,omitempty"`
+}
+
+// FaviconHandler serves /favicon.ico: a redirect to the tenant logo when it has one,
+// the platform favicon (cfg.Brand.Favicon) otherwise.
+func FaviconHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b := tenantBranding(r); b != nil && b.LogoPath != "" {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			http.Redirect(w, r, logoURL(b.LogoPath), http.StatusFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		http.ServeFile(w, r, cfg.Brand.Favicon)
+	}
+}
+
+// ManifestHandler serves /manifest.webmanifest with the tenant name, logo and primary color,
+// falling back to the platform brand on the root domain and for unset fields.
+func ManifestHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m := webManifest{
+			Name:            cfg.Brand.Name,
+			ShortName:       cfg.Brand.Name,
+			StartURL:        "/",
+			Display:         "standalone",
+			ThemeColor:      cfg.Brand.ThemeColor,
+			BackgroundColor: "#ffffff",
+		}
+		icon := "/favicon.ico"
+		iconType := mime.TypeByExtension(path.Ext(cfg.Brand.Favicon))
+		if b := tenantBranding(r); b != nil {
+			m.Name, m.ShortName = b.Name, b.Name
+			if cssColor.MatchString(b.PrimaryColor) {
+				m.ThemeColor = b.PrimaryColor
+			}
+			if b.LogoPath != "" {
+				icon = logoURL(b.LogoPath)
+				iconType = mime.TypeByExtension(path.Ext(b.LogoPath))
+			}
+		}
+		m.Icons = []manifestIcon{{Src: icon, Sizes: "any", Type: iconType}}
+
+		w.Header().Set("Content-Type", "application/manifest+json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if err := json.NewEncoder(w).Encode(m); err != nil {
+			slog.ErrorContext(r.Context(), "[BRAND] Failed to write manifest", "err", err)
+		}
+	}
+}
+
+// tenantBranding loads the branding of the tenant in context, or nil on the root domain. A sub-tenant
+// gets the colors, theme and logo inherited from its parent.
+func tenantBranding(r *http.Request) *models.TenantBranding {
+	t := middleware.FromContext(r.Context())
+	if t == nil {
+		return nil
+	}
+	b, err := models.GetTenantBranding(r.Context(), t.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[BRAND] Failed to load branding", "tenant", t.Subdomain, "err", err)
+	}
+	if b != nil && t.ParentID != 0 {
+		b.PrimaryColor, b.SecondaryColor, b.Theme, b.LogoPath = t.Brand.PrimaryColor, t.Brand.SecondaryColor, t.Brand.Theme, t.Brand.LogoPath
+	}
+	return b
+}
+
+// logoURL turns a stored logo path into a URL usable from any page of the site.
+func logoURL(p string) string {
+	if strings.HasPrefix(p, "https://") || strings.HasPrefix(p, "http://") {
+		return p
+	}
+	return "/" + strings.TrimPrefix(p, "/")
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/features"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitFeatureTemplates parses the templates needed for the feature flag admin page.
+func InitFeatureTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("features", "features.html")
+}
+
+// FeaturesHandler lets platform admins toggle feature flags platform-wide and for specific tenants.
+// POST actions: "set" stores the state of a flag, "reset" returns it to its definition in code or
+// FEATURE_FLAGS, "tenant_set" turns it on or off for a tenant by subdomain and "tenant_clear" removes
+// that override. Every change is recorded in the audit log.
+func FeaturesHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			overrides, err := models.ListTenantFeatureFlags(r.Context())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[FEATURES] Failed to list tenant overrides", "err", err)
+			}
+			extra["Flags"] = features.Flags()
+			extra["Overrides"] = overrides
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 1: Handle GET request to list the flags and tenant overrides
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, nil)
+			return
+		}
+
+		// Step 2: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[FEATURES] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.invalid_form", lang)})
+			return
+		}
+		name := strings.ToLower(strings.TrimSpace(r.FormValue("name")))
+		if name == "" {
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.invalid_form", lang)})
+			return
+		}
+
+		var (
+			tenantID int64
+			action   string
+			details  string
+			err      error
+		)
+		switch r.FormValue("action") {
+		case "set":
+			// Step 3a: Store the platform-wide state
+			enabled := r.FormValue("enabled") == "on"
+			rollout := 0
+			if v := strings.TrimSpace(strings.TrimSuffix(r.FormValue("rollout"), "%")); v != "" {
+				if rollout, err = strconv.Atoi(v); err != nil || rollout < 0 || rollout > 100 {
+					renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.invalid_rollout", lang)})
+					return
+				}
+			}
+			action, details = "feature.updated", fmt.Sprintf("%s enabled=%t rollout=%d%%", name, enabled, rollout)
+			err = features.Set(r.Context(), name, enabled, rollout, user.ID)
+
+		case "reset":
+			// Step 3b: Drop the admin state and the tenant overrides
+			action, details = "feature.reset", name
+			err = features.Reset(r.Context(), name)
+
+		case "tenant_set":
+			// Step 3c: Resolve the tenant and store its override
+			subdomain := strings.ToLower(strings.TrimSpace(r.FormValue("subdomain")))
+			if subdomain == "" {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.missing_fields", lang)})
+				return
+			}
+			tenantID, err = models.GetTenantIDBySubdomain(r.Context(), subdomain)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[FEATURES] Tenant lookup failed", "subdomain", subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if tenantID == 0 {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.unknown_tenant", lang)})
+				return
+			}
+			enabled := r.FormValue("enabled") == "on"
+			action, details = "feature.tenant_set", fmt.Sprintf("%s enabled=%t", name, enabled)
+			err = features.SetTenant(r.Context(), tenantID, name, enabled, user.ID)
+
+		case "tenant_clear":
+			// Step 3d: Remove the override of a tenant
+			if tenantID, err = strconv.ParseInt(r.FormValue("tenant_id"), 10, 64); err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.invalid_form", lang)})
+				return
+			}
+			action, details = "feature.tenant_cleared", name
+			err = features.ClearTenant(r.Context(), tenantID, name)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("features.error.invalid_form", lang)})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[FEATURES] Failed to update flag", "action", action, "flag", name, "tenant_id", tenantID, "err", err)
+			renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+			return
+		}
+
+		// Step 4: Record the change
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: tenantID,
+			UserID:   user.ID,
+			Action:   action,
+			IP:       middleware.ClientIP(r),
+			Details:  details,
+		})
+		slog.InfoContext(r.Context(), "[FEATURES] Flag updated", "action", action, "flag", name, "tenant_id", tenantID, "by", user.ID)
+
+		http.Redirect(w, r, "/admin/features", http.StatusSeeOther)
+	}
+}
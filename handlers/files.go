@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// FileHandler serves the signed URLs of the local storage backend at GET /files/{key...}.
+// The token alone grants access, like a presigned S3 URL, so it must match the requested key.
+func FileHandler(store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Validate the token against the requested key
+		key := r.PathValue("key")
+		signed, ok := utils.ValidateFileToken(r.URL.Query().Get("token"))
+		if !ok || signed != key {
+			slog.InfoContext(r.Context(), "[FILES] Invalid or expired file token", "key", key)
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Stream the object
+		body, err := store.Get(r.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[FILES] Failed to read file", "key", key, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+
+		// Uploaded content is never trusted as active content on the application's origin
+		w.Header().Set("Content-Type", storage.ContentTypeOf(key))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if _, err := io.Copy(w, body); err != nil {
+			slog.ErrorContext(r.Context(), "[FILES] Failed to stream file", "key", key, "err", err)
+		}
+	}
+}
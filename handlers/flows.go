@@ -0,0 +1,828 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/challenge"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/security"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The built-in flows run their checks here, once for the HTML pages and the JSON API: each returns
+// a flowError that the pages render as a message and the API answers as problem details.
+
+// flowError is a refused or failed step of a flow.
+type flowError struct {
+	Status int    // HTTP status
+	Code   string // Stable code for API clients, e.g. "invalid_token"
+	Key    string // i18n key of the message
+	Msg    string // Message already translated, used instead of Key
+}
+
+func flowFail(status int, code, key string) *flowError {
+	return &flowError{Status: status, Code: code, Key: key}
+}
+
+// message returns the translated message of the error.
+func (e *flowError) message(i18n *i18n.I18n, lang string) string {
+	if e.Msg != "" {
+		return e.Msg
+	}
+	return i18n.T(e.Key, lang)
+}
+
+// memberLimitError refuses a new member once the tenant's plan is full.
+func memberLimitError(r *http.Request, i18n *i18n.I18n, tag, internalKey string) *flowError {
+	err := limits.Check(r.Context(), limits.Members, 1)
+	if err == nil {
+		return nil
+	}
+	msg := limitMessage(i18n, middleware.LangFromContext(r.Context()), err)
+	if msg == "" {
+		slog.ErrorContext(r.Context(), "["+tag+"] Failed to check member limit", "err", err)
+		return flowFail(http.StatusInternalServerError, "internal", internalKey)
+	}
+	slog.InfoContext(r.Context(), "["+tag+"] Member limit reached", "err", err)
+	return &flowError{Status: http.StatusForbidden, Code: "limit_reached", Msg: msg}
+}
+
+// challengeError checks the challenge posted with a submission from a suspicious source: an IP of
+// the challenge list, or an IP or email past CHALLENGE_AFTER suspicious attempts. Without a
+// provider, such IPs are refused; emails are then not counted, so nobody can lock an account out.
+func challengeError(r *http.Request, tag, email, response string) *flowError {
+	ctx := r.Context()
+	g := challenge.Current()
+	ip := middleware.ClientIP(r)
+	listed := middleware.ReputationChallenged(ctx)
+	if !listed && (g == nil || !g.Required(ctx, tenantID(r), ip, email)) {
+		return nil
+	}
+	if g == nil || g.Provider == nil {
+		if listed {
+			slog.WarnContext(ctx, "["+tag+"] Submission from challenged IP refused")
+			return flowFail(http.StatusForbidden, "challenged", "reputation.challenge")
+		}
+		slog.WarnContext(ctx, "["+tag+"] Too many attempts", "ip", ip, "email", email)
+		return flowFail(http.StatusTooManyRequests, "too_many_attempts", "challenge.too_many_attempts")
+	}
+	if response == "" {
+		return flowFail(http.StatusForbidden, "challenge_required", "challenge.required")
+	}
+	if err := g.Provider.Verify(ctx, response, ip); errors.Is(err, challenge.ErrFailed) {
+		slog.InfoContext(ctx, "["+tag+"] Challenge failed", "ip", ip, "err", err)
+		return flowFail(http.StatusForbidden, "challenge_failed", "challenge.failed")
+	} else if err != nil {
+		slog.ErrorContext(ctx, "["+tag+"] Failed to verify challenge", "err", err)
+		return flowFail(http.StatusServiceUnavailable, "challenge_unavailable", "challenge.unavailable")
+	}
+	return nil
+}
+
+// noteAttempt counts a suspicious attempt of the client and email towards a challenge.
+func noteAttempt(r *http.Request, email string) {
+	if g := challenge.Current(); g != nil {
+		g.Note(r.Context(), tenantID(r), middleware.ClientIP(r), email)
+	}
+}
+
+// tenantID returns the ID of the tenant of the request, 0 on the root domain.
+func tenantID(r *http.Request) int64 {
+	if t := middleware.FromContext(r.Context()); t != nil {
+		return t.ID
+	}
+	return 0
+}
+
+// challengeResponse returns the challenge response posted with a form, "" without a provider.
+func challengeResponse(r *http.Request) string {
+	if g := challenge.Current(); g != nil && g.Provider != nil {
+		return r.FormValue(g.Provider.Field())
+	}
+	return ""
+}
+
+// challengeWidget returns the widget a form shows when its next submission from the client, for
+// email when known, must carry a challenge, and nil otherwise.
+func challengeWidget(r *http.Request, email string) *challenge.Widget {
+	g := challenge.Current()
+	if g == nil || g.Provider == nil {
+		return nil
+	}
+	if !middleware.ReputationChallenged(r.Context()) && !g.Required(r.Context(), tenantID(r), middleware.ClientIP(r), email) {
+		return nil
+	}
+	w := g.Provider.Widget()
+	return &w
+}
+
+// enrollInput is a tenant signup, from the /enroll form or POST /api/v1/enroll.
+type enrollInput struct {
+	Email     string `json:"email"`
+	OrgName   string `json:"org_name"`
+	Password  string `json:"password"`
+	Subdomain string `json:"subdomain,omitempty"` // Optional; derived from the name when empty
+	Challenge string `json:"challenge,omitempty"` // Challenge response, when one is required
+}
+
+// enrollTenant records a pending tenant signup and mails the verification link. The tenant is
+// created when the link is followed, by verifyTenant.
+func enrollTenant(cfg *multitenant.Config, i18n *i18n.I18n, r *http.Request, in enrollInput) (subdomain string, fe *flowError) {
+	lang := middleware.LangFromContext(r.Context())
+
+	email := strings.ToLower(strings.TrimSpace(in.Email))
+	org := strings.TrimSpace(in.OrgName)
+
+	// Step 1: Check the challenge of suspicious sources, and count the signup towards one
+	if fe := challengeError(r, "ENROLL", email, in.Challenge); fe != nil {
+		return "", fe
+	}
+	noteAttempt(r, email)
+
+	// Step 2: Validate required fields and the email format
+	if email == "" || org == "" || in.Password == "" {
+		return "", flowFail(http.StatusBadRequest, "missing_fields", "enroll.required_fields")
+	}
+	if !multitenant.ValidEmail(email) {
+		return "", flowFail(http.StatusBadRequest, "invalid_email", "enroll.invalid_email")
+	}
+
+	// Step 3: Pick the subdomain chosen on the form, or the first free one derived from the name.
+	// It must not be reserved or look like the preview host of another tenant.
+	sub := strings.ToLower(strings.TrimSpace(in.Subdomain))
+	if sub == "" {
+		var err error
+		if sub, err = cfg.Server.AvailableSubdomain(r.Context(), org); err != nil {
+			slog.ErrorContext(r.Context(), "[ENROLL] Subdomain lookup error", "err", err, "org", org)
+			return "", flowFail(http.StatusInternalServerError, "internal", "enroll.internal_error")
+		}
+	}
+	if !cfg.Server.ValidSubdomain(sub) {
+		return "", flowFail(http.StatusBadRequest, "invalid_subdomain", "enroll.invalid_org_name")
+	}
+
+	// Step 4: Check for duplicate email, subdomain or name in DB. The verification checks again,
+	// as another signup may take them meanwhile.
+	if err := models.TenantConflict(r.Context(), nil, org, sub, email); errors.Is(err, models.ErrTenantExists) {
+		slog.InfoContext(r.Context(), "[ENROLL] Attempt to reuse tenant fields", "org", org, "email", email, "err", err)
+		return "", tenantTakenError(err)
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "[ENROLL] DB lookup error", "err", err, "email", email, "sub", sub)
+		return "", flowFail(http.StatusInternalServerError, "internal", "enroll.internal_error")
+	}
+
+	// Step 5: Hash password with bcrypt
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[ENROLL] Password hashing error", "err", err)
+		return "", flowFail(http.StatusInternalServerError, "internal", "enroll.internal_error")
+	}
+
+	// Step 6: Generate signup token and insert pending signup into DB
+	expires := time.Now().Add(24 * time.Hour)
+	token, err := utils.GenerateSignupToken(cfg.Domain, email, org, expires)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[ENROLL] Token generation error", "err", err)
+		return "", flowFail(http.StatusInternalServerError, "internal", "enroll.internal_error")
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO pending_tenant_signups (email, org_name, subdomain, password_hash, token, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		email, org, sub, string(hash), token, expires)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[ENROLL] DB insert error", "err", err, "email", email)
+		return "", flowFail(http.StatusInternalServerError, "internal", "enroll.internal_error")
+	}
+
+	// Step 7: Generate verification link and mail it
+	link := urls.Marketing(cfg, "/verify", url.Values{"token": {token}})
+	slog.InfoContext(r.Context(), "[ENROLL] Token created", "email", email, "link", link)
+	err = mail.Default.Send(r.Context(), mail.Message{
+		To:      []string{email},
+		Subject: i18n.T("mail.verify.subject", lang),
+		Text:    i18n.T("mail.verify.body", lang, link),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[ENROLL] Failed to send verification email", "email", email, "err", err)
+	}
+	return sub, nil
+}
+
+// errAlreadyVerified refuses a signup whose tenant and owner already exist, from a second click on
+// the verification link.
+var errAlreadyVerified = errors.New("signup already verified")
+
+// tenantTakenError returns the message of a tenant field already taken, see models.ErrTenantExists.
+func tenantTakenError(err error) *flowError {
+	switch {
+	case errors.Is(err, models.ErrSubdomainTaken):
+		return flowFail(http.StatusConflict, "subdomain_taken", "enroll.subdomain_taken")
+	case errors.Is(err, models.ErrTenantNameTaken):
+		return flowFail(http.StatusConflict, "name_taken", "enroll.name_taken")
+	case errors.Is(err, models.ErrTenantEmailTaken):
+		return flowFail(http.StatusConflict, "email_taken", "enroll.email_taken")
+	}
+	return flowFail(http.StatusConflict, "conflict", "enroll.email_or_subdomain_exists")
+}
+
+// usedSignupError tells apart a verification link whose signup was verified, e.g. by a mail
+// scanner opening it first, from an unknown one.
+func usedSignupError(r *http.Request, email, org string) *flowError {
+	verified, err := models.SignupVerified(r.Context(), nil, email, org, "")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[VERIFY] DB error looking up verified signup", "err", err)
+		return flowFail(http.StatusInternalServerError, "internal", "common.internal_error")
+	}
+	if verified {
+		slog.InfoContext(r.Context(), "[VERIFY] Signup already verified", "org", org, "email", email)
+		return flowFail(http.StatusConflict, "already_verified", "verify.already_verified")
+	}
+	slog.InfoContext(r.Context(), "[VERIFY] Token already used or not found", "org", org, "email", email)
+	return flowFail(http.StatusGone, "token_used", "verify.link_already_used")
+}
+
+// checkSignupToken checks a verification link without using it, for the page asking to confirm
+// the signup: nil while the signup is pending, or the error verifyTenant would return.
+func checkSignupToken(cfg *multitenant.Config, r *http.Request, token string) *flowError {
+	email, org, ok := utils.ValidateSignupToken(token, cfg.Domain)
+	if !ok {
+		return flowFail(http.StatusBadRequest, "invalid_token", "verify.invalid_token")
+	}
+	var n int
+	if err := db.LogQueryRow(r.Context(), db.DB, `SELECT COUNT(*) FROM pending_tenant_signups WHERE token = ?`, token).Scan(&n); err != nil {
+		slog.ErrorContext(r.Context(), "[VERIFY] DB error reading signup token", "err", err)
+		return flowFail(http.StatusInternalServerError, "internal", "common.internal_error")
+	}
+	if n == 0 {
+		return usedSignupError(r, strings.ToLower(strings.TrimSpace(email)), org)
+	}
+	return nil
+}
+
+// verifiedTenant is the tenant and owner created by verifyTenant.
+type verifiedTenant struct {
+	TenantID  int64
+	UserID    int64
+	Subdomain string
+	Email     string
+}
+
+// verifyTenant creates the tenant and its owner from a pending signup token mailed by enrollTenant.
+func verifyTenant(cfg *multitenant.Config, r *http.Request, token string) (*verifiedTenant, *flowError) {
+	internal := flowFail(http.StatusInternalServerError, "internal", "common.internal_error")
+
+	// Step 1: Validate the token
+	email, org, ok := utils.ValidateSignupToken(token, cfg.Domain)
+	if !ok {
+		slog.InfoContext(r.Context(), "[VERIFY] Invalid or expired token")
+		return nil, flowFail(http.StatusBadRequest, "invalid_token", "verify.invalid_token")
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	slog.InfoContext(r.Context(), "[VERIFY] Verifying email", "email", email, "org", org)
+
+	// Step 2: Create the tenant in a transaction that runs again when a concurrent verification
+	// of the same signup or subdomain wins, so that its checks then tell what happened
+	var sub string
+	var tid, uid int64
+	err := models.ProvisionTx(r.Context(), func(tx *sql.Tx) error {
+		// Step 2a: Get password hash and subdomain from pending signups
+		var ph string
+		err := tx.QueryRowContext(r.Context(), `SELECT password_hash, COALESCE(subdomain, '') FROM pending_tenant_signups WHERE token = ?`, token).Scan(&ph, &sub)
+		if err != nil {
+			return err
+		}
+		if sub == "" {
+			sub = multitenant.Slugify(org) // Signups pending since before subdomains were stored
+		}
+
+		// Step 2b: Refuse tenants that already exist, telling apart a second click on the link
+		conflict := models.TenantConflict(r.Context(), tx, org, sub, email)
+		if errors.Is(conflict, models.ErrTenantExists) {
+			if verified, err := models.SignupVerified(r.Context(), tx, email, org, sub); err != nil {
+				return err
+			} else if verified {
+				return errAlreadyVerified
+			}
+		}
+		if conflict != nil {
+			return conflict
+		}
+
+		// Step 2c: Create the tenant, its owner and membership, and delete the pending signup
+		tid, uid, err = models.InsertTenantWithOwner(r.Context(), tx, models.NewTenant{
+			Name:         org,
+			Subdomain:    sub,
+			OwnerEmail:   email,
+			PasswordHash: ph,
+			OwnerRole:    cfg.Roles.Owner,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(r.Context(), `DELETE FROM pending_tenant_signups WHERE token = ?`, token)
+		return err
+	})
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, usedSignupError(r, email, org)
+	case errors.Is(err, errAlreadyVerified):
+		slog.InfoContext(r.Context(), "[VERIFY] Tenant and user already exist", "subdomain", sub, "email", email)
+		return nil, flowFail(http.StatusConflict, "already_verified", "verify.already_verified")
+	case errors.Is(err, models.ErrTenantExists):
+		slog.InfoContext(r.Context(), "[VERIFY] Tenant fields taken", "subdomain", sub, "email", email, "err", err)
+		return nil, tenantTakenError(err)
+	case err != nil:
+		slog.ErrorContext(r.Context(), "[VERIFY] Failed to create tenant", "subdomain", sub, "err", err)
+		return nil, internal
+	}
+
+	// Step 3: Publish the event
+	slog.InfoContext(r.Context(), "[VERIFY] Tenant and user created", "subdomain", sub, "email", email)
+	events.Publish(r.Context(), events.Event{
+		Name:     events.TenantCreated,
+		TenantID: tid,
+		Data:     map[string]any{"subdomain": sub, "name": org, "owner_email": email},
+	})
+	return &verifiedTenant{TenantID: tid, UserID: uid, Subdomain: sub, Email: email}, nil
+}
+
+// registerInput is a member signup on a tenant, from the /register form or POST /api/v1/register.
+type registerInput struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Link      string `json:"link,omitempty"`      // Optional signup link token
+	Challenge string `json:"challenge,omitempty"` // Challenge response, when one is required
+}
+
+// registerUser records a pending member signup on the tenant of the request and mails the
+// confirmation link. The user is created when the link is followed, by confirmUser.
+func registerUser(cfg *multitenant.Config, i18n *i18n.I18n, r *http.Request, in registerInput) *flowError {
+	lang := middleware.LangFromContext(r.Context())
+	internal := flowFail(http.StatusInternalServerError, "internal", "register.error.internal")
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email)) // Stored as enrollment and CreateMember do
+
+	// Step 1: Retrieve tenant from context and the signup link the user followed, if any
+	tCtx := middleware.FromContext(r.Context())
+	if tCtx == nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Tenant context missing")
+		return flowFail(http.StatusForbidden, "no_tenant", "register.error.no_tenant")
+	}
+	invite, err := signupLink(r.Context(), cfg, r, tCtx.ID, in.Link)
+	if errors.Is(err, errSignupLinkInvalid) {
+		slog.InfoContext(r.Context(), "[REGISTER] Unusable signup link", "tenant", tCtx.Subdomain)
+		return flowFail(http.StatusBadRequest, "invalid_link", "register.error.invalid_link")
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to load signup link", "err", err)
+		return internal
+	}
+
+	// Step 2: Check the challenge of suspicious sources, and count the signup towards one
+	if fe := challengeError(r, "REGISTER", in.Email, in.Challenge); fe != nil {
+		return fe
+	}
+	noteAttempt(r, in.Email)
+
+	// Step 3: Validate the fields
+	email := in.Email
+	if email == "" || in.Password == "" {
+		return flowFail(http.StatusBadRequest, "missing_fields", "register.error.missing_fields")
+	}
+
+	// Step 4: Refuse addresses outside the tenant's join domains when it only accepts those, unless
+	// invited by a link, and new members once the tenant's plan is full
+	if _, _, err := joinPolicy(r.Context(), cfg, tCtx.ID, email); invite == nil && errors.Is(err, errJoinRefused) {
+		slog.InfoContext(r.Context(), "[REGISTER] Email domain refused", "email", email, "tenant", tCtx.Subdomain)
+		return flowFail(http.StatusForbidden, "domain_not_allowed", "register.error.domain_not_allowed")
+	} else if err != nil && !errors.Is(err, errJoinRefused) {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to resolve join policy", "err", err)
+		return internal
+	}
+	if fe := memberLimitError(r, i18n, "REGISTER", "register.error.internal"); fe != nil {
+		return fe
+	}
+
+	// Step 5: Start transaction
+	tx, err := db.DB.Begin()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to start transaction", "err", err)
+		return internal
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Step 6: Check for an account of the tenant, then for existing pending signups. Accounts
+	// belong to one tenant, so an address with an account elsewhere registers as usual.
+	var exists int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER(?) AND tenant_id = ?`, email, tCtx.ID).Scan(&exists)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] DB error checking accounts", "err", err)
+		return internal
+	}
+	if exists > 0 {
+		slog.InfoContext(r.Context(), "[REGISTER] Already a member", "email", email, "tenant", tCtx.Subdomain)
+		return flowFail(http.StatusConflict, "already_member", "register.error.already_member")
+	}
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM pending_user_signups
+		WHERE LOWER(email) = LOWER(?) AND tenant_id = ?`, email, tCtx.ID).Scan(&exists)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] DB error checking pending signups", "err", err)
+		return internal
+	}
+	if exists > 0 {
+		slog.InfoContext(r.Context(), "[REGISTER] Already registered", "email", email, "tenant", tCtx.Subdomain)
+		return flowFail(http.StatusBadRequest, "already_registered", "register.error.already_registered")
+	}
+
+	// Step 7: Hash password with bcrypt
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Password hashing error", "err", err)
+		return internal
+	}
+
+	// Step 8: Generate token and insert pending signup
+	token, err := utils.GenerateUserToken(tCtx.Subdomain, email, tCtx.ID, time.Now().Add(24*time.Hour))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Token generation error", "err", err)
+		return internal
+	}
+
+	// The link and its role are checked again and counted on confirmation
+	var linkID sql.NullInt64
+	var linkRole sql.NullString
+	if invite != nil {
+		linkID = sql.NullInt64{Int64: invite.ID, Valid: true}
+		linkRole = sql.NullString{String: invite.Role, Valid: true}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO pending_user_signups (email, tenant_id, password_hash, token, expires_at, link_id, role)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, email, tCtx.ID, string(hash), token, time.Now().Add(24*time.Hour), linkID, linkRole)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to insert pending signup", "err", err)
+		return internal
+	}
+
+	// Step 9: Commit transaction
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to commit transaction", "err", err)
+		return internal
+	}
+
+	// Step 10: Publish the event, generate confirmation link and mail it
+	events.Publish(r.Context(), events.Event{
+		Name:     events.UserRegistered,
+		TenantID: tCtx.ID,
+		Data:     map[string]any{"email": email},
+	})
+	link := urls.Tenant(cfg, tCtx, "/confirm", url.Values{"token": {token}})
+	slog.InfoContext(r.Context(), "[REGISTER] Sent confirm link", "email", email, "link", link)
+	err = mail.Default.SendTenant(r.Context(), tCtx.ID, tCtx.Name, mail.Message{
+		To:      []string{email},
+		Subject: i18n.T("mail.confirm.subject", lang, tCtx.Name),
+		Text:    i18n.T("mail.confirm.body", lang, link),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REGISTER] Failed to send confirmation email", "email", email, "err", err)
+	}
+	return nil
+}
+
+// usedConfirmationError tells apart a confirmation link whose member was created, e.g. by a mail
+// scanner opening it first, from an unknown one.
+func usedConfirmationError(r *http.Request, email string, tenantID int64) *flowError {
+	u, err := models.GetUserByEmailAndTenant(email, tenantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] DB error looking up confirmed user", "err", err)
+		return flowFail(http.StatusInternalServerError, "internal", "confirm.internal_error")
+	}
+	if u != nil {
+		slog.InfoContext(r.Context(), "[CONFIRM] User already confirmed", "email", email, "tid", tenantID)
+		return flowFail(http.StatusConflict, "already_confirmed", "confirm.already_confirmed")
+	}
+	slog.InfoContext(r.Context(), "[CONFIRM] No signup found", "email", email, "tid", tenantID)
+	return flowFail(http.StatusNotFound, "not_found", "confirm.not_found")
+}
+
+// checkUserToken checks a confirmation link without using it, for the page asking to confirm the
+// registration: nil while the registration is pending, or the error confirmUser would return.
+func checkUserToken(cfg *multitenant.Config, r *http.Request, token string) *flowError {
+	email, tid, ok := utils.ValidateUserToken(token, tokenAudience(cfg, r))
+	if !ok {
+		return flowFail(http.StatusBadRequest, "invalid_token", "confirm.invalid_token")
+	}
+	var n int
+	if err := db.LogQueryRow(r.Context(), db.DB, `SELECT COUNT(*) FROM pending_user_signups WHERE token = ? AND tenant_id = ?`, token, tid).Scan(&n); err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] DB error reading signup", "err", err)
+		return flowFail(http.StatusInternalServerError, "internal", "confirm.internal_error")
+	}
+	if n == 0 {
+		return usedConfirmationError(r, email, tid)
+	}
+	return nil
+}
+
+// confirmedUser is the member created by confirmUser.
+type confirmedUser struct {
+	TenantID int64
+	UserID   int64
+	Email    string
+	Role     string
+	Status   string // models.MembershipActive, or MembershipPending while an admin must approve
+}
+
+// confirmUser creates the member from a pending signup token mailed by registerUser.
+func confirmUser(cfg *multitenant.Config, i18n *i18n.I18n, r *http.Request, token string) (*confirmedUser, *flowError) {
+	internal := flowFail(http.StatusInternalServerError, "internal", "confirm.internal_error")
+
+	// Step 1: Validate the token
+	email, tid, ok := utils.ValidateUserToken(token, tokenAudience(cfg, r))
+	if !ok {
+		slog.InfoContext(r.Context(), "[CONFIRM] Invalid or expired token")
+		return nil, flowFail(http.StatusBadRequest, "invalid_token", "confirm.invalid_token")
+	}
+
+	// Step 2: Check for pending signup in DB
+	var ph string
+	var linkID sql.NullInt64
+	var linkRole sql.NullString
+	err := db.DB.QueryRow(`
+		SELECT password_hash, link_id, role FROM pending_user_signups WHERE token = ? AND tenant_id = ?`,
+		token, tid).Scan(&ph, &linkID, &linkRole)
+	if err == sql.ErrNoRows {
+		return nil, usedConfirmationError(r, email, tid)
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] DB error reading signup", "err", err)
+		return nil, internal
+	}
+
+	// Step 3: Start the transaction creating the user
+	tx, err := db.DB.Begin()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] Failed to start transaction", "err", err)
+		return nil, internal
+	}
+	defer tx.Rollback() // Rollback if not committed
+
+	// Step 4: Decide the role and whether the membership waits for approval.
+	// A signup link admits the user with its role as long as it has uses left;
+	// otherwise the tenant's join policy applies.
+	var status, role string
+	var usedLink int64
+	if linkID.Valid {
+		used, err := models.UseSignupLink(r.Context(), tx, tid, linkID.Int64)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[CONFIRM] Failed to use signup link", "link_id", linkID.Int64, "err", err)
+			return nil, internal
+		}
+		if _, known := cfg.Roles.Get(linkRole.String); used && known {
+			status, role, usedLink = models.MembershipActive, linkRole.String, linkID.Int64
+		} else {
+			slog.InfoContext(r.Context(), "[CONFIRM] Signup link no longer usable", "link_id", linkID.Int64)
+		}
+	}
+	if status == "" {
+		status, role, err = joinPolicy(r.Context(), cfg, tid, email)
+	}
+	if errors.Is(err, errJoinRefused) {
+		slog.InfoContext(r.Context(), "[CONFIRM] Email domain refused", "email", email, "tid", tid)
+		return nil, flowFail(http.StatusForbidden, "domain_not_allowed", "register.error.domain_not_allowed")
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] Failed to resolve join policy", "tid", tid, "err", err)
+		return nil, internal
+	}
+
+	// The plan may have filled up since the registration
+	if fe := memberLimitError(r, i18n, "CONFIRM", "confirm.internal_error"); fe != nil {
+		return nil, fe
+	}
+
+	// Step 5: Insert user and membership, delete pending signup
+	res, err := tx.Exec(`
+		INSERT INTO users (email, password_hash, is_verified, tenant_id, role)
+		VALUES (?, ?, 1, ?, ?)`, email, ph, tid, role)
+	var uid int64
+	if err == nil {
+		uid, err = res.LastInsertId()
+	}
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO memberships (user_id, tenant_id, role, is_active, status) VALUES (?, ?, ?, ?, ?)`,
+			uid, tid, role, status == models.MembershipActive, status)
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM pending_user_signups WHERE token = ?`, token)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if db.UniqueViolation(err) == "users.email" {
+		// A concurrent confirmation of the same link created the user first
+		return nil, usedConfirmationError(r, email, tid)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[CONFIRM] Failed to create user", "email", email, "tid", tid, "err", err)
+		return nil, internal
+	}
+
+	// Step 6: Publish the event and record membership requests for the admins
+	slog.InfoContext(r.Context(), "[CONFIRM] User confirmed", "email", email, "tid", tid, "status", status)
+	data := map[string]any{"user_id": uid, "email": email, "role": role, "status": status}
+	if usedLink != 0 {
+		data["signup_link_id"] = usedLink
+	}
+	events.Publish(r.Context(), events.Event{
+		Name:     events.UserConfirmed,
+		TenantID: tid,
+		UserID:   uid,
+		Data:     data,
+	})
+	if status == models.MembershipPending {
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: tid,
+			UserID:   uid,
+			Action:   "membership.requested",
+			IP:       middleware.ClientIP(r),
+			Details:  email,
+		})
+	}
+	return &confirmedUser{TenantID: tid, UserID: uid, Email: email, Role: role, Status: status}, nil
+}
+
+// loginUser checks credentials on the tenant of the request and opens a session. It returns the
+// user and the session token, which the pages set as a cookie and the API wraps in an access token.
+// response is the challenge response, required once the client or email failed too often.
+func loginUser(r *http.Request, email, password, response string) (*models.User, string, *flowError) {
+	internal := flowFail(http.StatusInternalServerError, "internal", "login.error.Internal")
+
+	// Step 1: Check the challenge of suspicious sources
+	if fe := challengeError(r, "LOGIN", email, response); fe != nil {
+		return nil, "", fe
+	}
+
+	// Step 2: Validate required fields
+	if email == "" || password == "" {
+		return nil, "", flowFail(http.StatusBadRequest, "missing_fields", "login.error.MissingFields")
+	}
+
+	// Step 3: Retrieve tenant from context
+	t := middleware.FromContext(r.Context())
+	if t == nil {
+		slog.ErrorContext(r.Context(), "[LOGIN] Tenant context missing", "email", email)
+		return nil, "", flowFail(http.StatusBadRequest, "no_tenant", "login.error.TenantNotFound")
+	}
+
+	// Step 4: Look up user by email and tenant
+	user, err := models.GetUserByEmailAndTenant(email, t.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[LOGIN] DB error", "email", email, "tenant", t.Subdomain, "err", err)
+		return nil, "", internal
+	}
+	if user == nil {
+		middleware.EmitSecurityEvent(r, security.FailedLogin, "unknown user "+email)
+		noteAttempt(r, email)
+		return nil, "", flowFail(http.StatusUnauthorized, "invalid_credentials", "login.error.InvalidCreds")
+	}
+
+	// Step 5: Verify password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		middleware.EmitSecurityEvent(r, security.FailedLogin, "wrong password for "+email)
+		noteAttempt(r, email)
+		return nil, "", flowFail(http.StatusUnauthorized, "invalid_credentials", "login.error.InvalidCreds")
+	}
+	if g := challenge.Current(); g != nil {
+		g.Reset(r.Context(), t.ID, email)
+	}
+
+	// Step 6: Refuse members still waiting for approval or deactivated by an admin
+	status, err := models.GetMembershipStatus(r.Context(), user.ID, t.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[LOGIN] Failed to load membership", "email", email, "tenant", t.Subdomain, "err", err)
+		return nil, "", internal
+	}
+	if status == models.MembershipPending {
+		slog.InfoContext(r.Context(), "[LOGIN] Membership pending approval", "email", email, "tenant", t.Subdomain)
+		return nil, "", flowFail(http.StatusForbidden, "pending_approval", "login.error.PendingApproval")
+	}
+	if status == models.MembershipInactive {
+		slog.InfoContext(r.Context(), "[LOGIN] Membership deactivated", "email", email, "tenant", t.Subdomain)
+		return nil, "", flowFail(http.StatusForbidden, "deactivated", "login.error.Deactivated")
+	}
+
+	// Step 7: Create session token, log success and publish the event
+	token := models.CreateSession(user.ID, user.TenantID)
+	slog.InfoContext(r.Context(), "[LOGIN] User logged in", "email", email, "tenant", t.Subdomain)
+	events.Publish(r.Context(), events.Event{
+		Name:     events.LoginSucceeded,
+		TenantID: t.ID,
+		UserID:   user.ID,
+		Data:     map[string]any{"email": email, "ip": middleware.ClientIP(r)},
+	})
+	return user, token, nil
+}
+
+// requestPasswordReset mails a reset link when email belongs to an account of the tenant of the
+// request. It succeeds whether or not it does, so the answer never reveals accounts.
+func requestPasswordReset(cfg *multitenant.Config, i18n *i18n.I18n, r *http.Request, email string) *flowError {
+	lang := middleware.LangFromContext(r.Context())
+	internal := flowFail(http.StatusInternalServerError, "internal", "reset.error.internal")
+
+	// Step 1: Retrieve tenant from context
+	t := middleware.FromContext(r.Context())
+	if t == nil {
+		return flowFail(http.StatusForbidden, "no_tenant", "reset.error.no_tenant")
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	// Step 2: Mint a reset token if the account exists
+	user, err := models.GetUserByEmailAndTenant(email, t.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RESET] DB error", "tenant", t.Subdomain, "err", err)
+		return internal
+	}
+	if user == nil {
+		slog.InfoContext(r.Context(), "[RESET] Reset requested for unknown email", "tenant", t.Subdomain)
+		return nil
+	}
+	token, err := models.CreatePasswordReset(r.Context(), user.ID, t.ID, cfg.ResetExpiry)
+	if errors.Is(err, models.ErrTooManyResets) {
+		slog.WarnContext(r.Context(), "[RESET] Too many outstanding resets", "user_id", user.ID)
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RESET] Failed to create reset", "user_id", user.ID, "err", err)
+		return internal
+	}
+
+	// Step 3: Generate reset link and mail it
+	link := urls.Tenant(cfg, t, "/reset", url.Values{"token": {token}})
+	slog.InfoContext(r.Context(), "[RESET] Sent reset link", "email", email, "link", link)
+	err = mail.Default.SendTenant(r.Context(), t.ID, t.Name, mail.Message{
+		To:      []string{email},
+		Subject: i18n.T("mail.reset.subject", lang),
+		Text:    i18n.T("mail.reset.body", lang, link),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RESET] Failed to send reset email", "user_id", user.ID, "err", err)
+	}
+	return nil
+}
+
+// resetPassword consumes a reset token mailed by requestPasswordReset and stores the new password.
+// Every session of the user ends.
+func resetPassword(r *http.Request, token, password string) *flowError {
+	internal := flowFail(http.StatusInternalServerError, "internal", "reset.error.internal")
+
+	// Step 1: Retrieve tenant from context and validate the fields
+	t := middleware.FromContext(r.Context())
+	if t == nil {
+		return flowFail(http.StatusNotFound, "no_tenant", "reset.error.no_tenant")
+	}
+	if password == "" {
+		return flowFail(http.StatusBadRequest, "missing_password", "reset.error.missing_password")
+	}
+
+	// Step 2: Hash password with bcrypt
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RESET] Password hashing error", "err", err)
+		return internal
+	}
+
+	// Step 3: Consume the token and store the new password
+	userID, err := models.ResetPassword(r.Context(), token, t.ID, string(hash))
+	if errors.Is(err, models.ErrResetInvalid) {
+		slog.InfoContext(r.Context(), "[RESET] Invalid or used reset token", "tenant", t.Subdomain)
+		return flowFail(http.StatusBadRequest, "invalid_token", "reset.error.invalid_token")
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RESET] Failed to reset password", "err", err)
+		return internal
+	}
+
+	// Step 4: Publish the event
+	slog.InfoContext(r.Context(), "[RESET] Password reset", "user_id", userID, "tenant", t.Subdomain)
+	events.Publish(r.Context(), events.Event{
+		Name:     events.PasswordReset,
+		TenantID: t.ID,
+		UserID:   userID,
+		Data:     map[string]any{"ip": middleware.ClientIP(r)},
+	})
+	return nil
+}
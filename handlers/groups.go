@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Limits on group fields
+const (
+	maxGroupNameLen        = 100
+	maxGroupDescriptionLen = 500
+)
+
+// InitGroupsTemplates parses the templates needed for the group list.
+// It includes header, base layout, and groups-specific content.
+func InitGroupsTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("groups", "groups.html")
+}
+
+// InitGroupTemplates parses the templates needed for a single group page.
+// It includes header, base layout, and group-specific content.
+func InitGroupTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("group", "group.html")
+}
+
+// GroupsHandler lists the groups visible to the user: every group for tenant admins, their own groups otherwise.
+// POST actions, reserved to tenant admins: "create" adds a group, "delete" removes one with its memberships.
+func GroupsHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and user from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		isAdmin := cfg.Roles.Allows(user.Role, cfg.Roles.Admin)
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			var groups []models.Group
+			if isAdmin {
+				var err error
+				if groups, err = models.ListGroups(r.Context(), t.ID); err != nil {
+					slog.ErrorContext(r.Context(), "[GROUPS] Failed to list groups", "tenant", t.Subdomain, "err", err)
+				}
+			} else {
+				groups = middleware.GroupsFromContext(r.Context())
+			}
+			extra["Groups"] = groups
+			extra["IsAdmin"] = isAdmin
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the groups
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("groups.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Only tenant admins create and delete groups
+		if !isAdmin {
+			middleware.Error(w, r, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[GROUPS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "create":
+			// Step 4a: Create the group and open its page
+			name, description, ok := groupFields(r)
+			if !ok {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_name", lang, maxGroupNameLen)})
+				return
+			}
+			id, err := models.CreateGroup(r.Context(), models.Group{TenantID: t.ID, Name: name, Description: description, CreatedBy: user.ID})
+			if errors.Is(err, models.ErrGroupExists) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("groups.error.exists", lang)})
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to create group", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "group.created",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10) + " " + name,
+			})
+			slog.InfoContext(r.Context(), "[GROUPS] Group created", "tenant", t.Subdomain, "group_id", id)
+			http.Redirect(w, r, fmt.Sprintf("/groups/%d?saved=1", id), http.StatusSeeOther)
+			return
+
+		case "delete":
+			// Step 4b: Delete the group and its memberships
+			id, err := strconv.ParseInt(r.FormValue("group_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+				return
+			}
+			found, err := models.DeleteGroup(r.Context(), t.ID, id)
+			if errors.Is(err, models.ErrLegalHold) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("common.legal_hold", lang)})
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to delete group", "tenant", t.Subdomain, "group_id", id, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("groups.error.not_found", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "group.deleted",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10),
+			})
+			slog.InfoContext(r.Context(), "[GROUPS] Group deleted", "tenant", t.Subdomain, "group_id", id)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/groups?saved=1", http.StatusSeeOther)
+	}
+}
+
+// GroupHandler shows a group to its members and tenant admins; other users get a 404.
+// POST actions: "add_member", "set_role" and "remove_member" are open to the group's managers and tenant admins,
+// "update" (name and description), "grant" and "revoke" (a permission of multitenant.DefaultPermissions) to
+// tenant admins only.
+func GroupHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant, user and group
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		groupID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		group, err := models.GetGroup(r.Context(), t.ID, groupID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[GROUPS] Failed to load group", "tenant", t.Subdomain, "group_id", groupID, "err", err)
+			middleware.Error(w, r, i18n.T("common.internal_error", lang), http.StatusInternalServerError)
+			return
+		}
+		if group == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Resolve what the user may do in this group
+		groupRole, err := models.GetGroupRole(r.Context(), t.ID, group.ID, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[GROUPS] Failed to load group role", "group_id", group.ID, "user_id", user.ID, "err", err)
+			middleware.Error(w, r, i18n.T("common.internal_error", lang), http.StatusInternalServerError)
+			return
+		}
+		isAdmin := cfg.Roles.Allows(user.Role, cfg.Roles.Admin)
+		if groupRole == "" && !isAdmin {
+			http.NotFound(w, r)
+			return
+		}
+		canManage := isAdmin || groupRole == models.GroupManager
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			members, err := models.ListGroupMembers(r.Context(), t.ID, group.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to list group members", "group_id", group.ID, "err", err)
+			}
+			if canManage {
+				extra["Candidates"] = groupCandidates(r, t.ID, members)
+			}
+			extra["Group"] = group
+			extra["Members"] = members
+			extra["Permissions"] = groupPermissions(r, t.ID, group.ID)
+			extra["CanManage"] = canManage
+			extra["IsAdmin"] = isAdmin
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 3: Handle GET request to show the group
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("groups.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 4: Parse the form data for POST requests
+		if !canManage {
+			middleware.Error(w, r, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[GROUPS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+			return
+		}
+
+		var auditAction, details string
+		switch action := r.FormValue("action"); action {
+		case "update":
+			// Step 5a: Rename the group
+			if !isAdmin {
+				middleware.Error(w, r, "Forbidden", http.StatusForbidden)
+				return
+			}
+			name, description, ok := groupFields(r)
+			if !ok {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_name", lang, maxGroupNameLen)})
+				return
+			}
+			_, err := models.UpdateGroup(r.Context(), models.Group{ID: group.ID, TenantID: t.ID, Name: name, Description: description})
+			if errors.Is(err, models.ErrGroupExists) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("groups.error.exists", lang)})
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to update group", "group_id", group.ID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			auditAction, details = "group.updated", name
+
+		case "grant", "revoke":
+			// Step 5b: Grant or withdraw a permission; unregistered ones can only be withdrawn
+			if !isAdmin {
+				middleware.Error(w, r, "Forbidden", http.StatusForbidden)
+				return
+			}
+			permission := r.FormValue("permission")
+			var found bool
+			if action == "grant" {
+				if _, ok := multitenant.DefaultPermissions.Get(permission); !ok {
+					renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+					return
+				}
+				found, err = models.GrantGroupPermission(r.Context(), t.ID, group.ID, permission, user.ID)
+			} else {
+				found, err = models.RevokeGroupPermission(r.Context(), t.ID, group.ID, permission)
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to change group permission", "group_id", group.ID, "permission", permission, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("groups.error.unchanged", lang)})
+				return
+			}
+			auditAction, details = "group.permission_granted", permission
+			if action == "revoke" {
+				auditAction = "group.permission_revoked"
+			}
+
+		case "add_member", "set_role":
+			// Step 5c: Add an active tenant member to the group, or change their group role
+			memberID, err := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+			role := r.FormValue("role")
+			if err != nil || (role != models.GroupManager && role != models.GroupMember) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+				return
+			}
+			status, err := models.GetMembershipStatus(r.Context(), memberID, t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to check membership", "user_id", memberID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if status != models.MembershipActive {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.not_member", lang)})
+				return
+			}
+			if err := models.SetGroupMember(r.Context(), t.ID, group.ID, memberID, role); err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to save group member", "group_id", group.ID, "user_id", memberID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			auditAction = "group.member_added"
+			if action == "set_role" {
+				auditAction = "group.member_role_changed"
+			}
+			details = strconv.FormatInt(memberID, 10) + " " + role
+
+		case "remove_member":
+			// Step 5d: Take a member out of the group
+			memberID, err := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+				return
+			}
+			found, err := models.RemoveGroupMember(r.Context(), t.ID, group.ID, memberID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[GROUPS] Failed to remove group member", "group_id", group.ID, "user_id", memberID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+				return
+			}
+			auditAction, details = "group.member_removed", strconv.FormatInt(memberID, 10)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("groups.error.invalid_form", lang)})
+			return
+		}
+
+		// Step 6: Record the change
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   auditAction,
+			IP:       middleware.ClientIP(r),
+			Details:  strconv.FormatInt(group.ID, 10) + " " + details,
+		})
+		slog.InfoContext(r.Context(), "[GROUPS] Group changed", "tenant", t.Subdomain, "group_id", group.ID, "action", auditAction)
+		http.Redirect(w, r, fmt.Sprintf("/groups/%d?saved=1", group.ID), http.StatusSeeOther)
+	}
+}
+
+// groupFields reads and validates the name and description of a group form.
+func groupFields(r *http.Request) (name, description string, ok bool) {
+	name = strings.TrimSpace(r.FormValue("name"))
+	description = strings.TrimSpace(r.FormValue("description"))
+	ok = name != "" && utf8.RuneCountInString(name) <= maxGroupNameLen && utf8.RuneCountInString(description) <= maxGroupDescriptionLen
+	return name, description, ok
+}
+
+// groupCandidates returns the active tenant members who are not in the group yet.
+func groupCandidates(r *http.Request, tenantID int64, members []models.GroupMemberEntry) []models.TenantMember {
+	all, err := models.ListTenantMembers(r.Context(), tenantID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[GROUPS] Failed to list tenant members", "tenant_id", tenantID, "err", err)
+		return nil
+	}
+	in := make(map[int64]bool, len(members))
+	for _, m := range members {
+		in[m.UserID] = true
+	}
+	var out []models.TenantMember
+	for _, m := range all {
+		if m.Status == models.MembershipActive && !in[m.UserID] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// groupPermission is a permission as shown on the group page.
+type groupPermission struct {
+	multitenant.Permission
+	Granted bool
+}
+
+// groupPermissions returns the registered permissions with whether the group holds them, followed
+// by the permissions it holds that are no longer registered, so admins can still withdraw them.
+func groupPermissions(r *http.Request, tenantID, groupID int64) []groupPermission {
+	granted, err := models.ListGroupPermissions(r.Context(), tenantID, groupID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[GROUPS] Failed to list group permissions", "group_id", groupID, "err", err)
+	}
+	held := make(map[string]bool, len(granted))
+	for _, p := range granted {
+		held[p] = true
+	}
+	var out []groupPermission
+	for _, p := range multitenant.DefaultPermissions.Items() {
+		out = append(out, groupPermission{Permission: p, Granted: held[p.Name]})
+		delete(held, p.Name)
+	}
+	for _, p := range granted {
+		if held[p] {
+			out = append(out, groupPermission{Permission: multitenant.Permission{Name: p, LabelKey: p}, Granted: true})
+		}
+	}
+	return out
+}
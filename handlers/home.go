@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"html/template"
 	"log/slog"
 	"net/http"
 
@@ -11,37 +10,44 @@ import (
 
 // InitHomeTemplates parses the templates for the landing page and tenant home page.
 // It includes header, base layout, and specific content for each.
-func InitHomeTemplates(base []string) (*template.Template, *template.Template) {
-	mainTmpl := template.New("base")
-	var err error
-	mainTmpl, err = mainTmpl.ParseFiles(append(base, "templates/main.html")...)
-	if err != nil {
-		slog.Error("[HOME] Failed to parse main template", "err", err)
-		panic(err)
-	}
+func InitHomeTemplates(e *render.Engine) (*render.Page, *render.Page) {
+	return e.MustPage("main", "main.html"), e.MustPage("tenant", "tenant.html")
+}
 
-	tenantTmpl := template.New("base")
-	tenantTmpl, err = tenantTmpl.ParseFiles(append(base, "templates/tenant.html")...)
-	if err != nil {
-		slog.Error("[HOME] Failed to parse tenant template", "err", err)
-		panic(err)
-	}
+// HomeHandler handles the "/" route.
+// Renders the marketing landing page (if no tenant) or tenant home page (if tenant), and the 404 page
+// for paths no other route serves.
+func HomeHandler(i18n *i18n.I18n, mainTmpl, tenantTmpl *render.Page) http.HandlerFunc {
+	notFound := NotFoundHandler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			notFound(w, r)
+			return
+		}
+		data := render.BaseTemplateData(r, i18n, nil)
+		slog.DebugContext(r.Context(), "[HOME] Rendering home page", "lang", data.Lang, "tenant", data.Tenant != nil, "user", data.User != nil)
 
-	return mainTmpl, tenantTmpl
+		if data.Tenant != nil {
+			slog.DebugContext(r.Context(), "[HOME] Rendering tenant template", "template", "tenant.html")
+			render.RenderTemplate(w, tenantTmpl, "base", data)
+		} else {
+			slog.DebugContext(r.Context(), "[HOME] Rendering main template", "template", "main.html")
+			render.RenderTemplate(w, mainTmpl, "base", data)
+		}
+	}
 }
 
-// HomeHandler handles the "/" route.
-// Renders the marketing landing page (if no tenant) or tenant home page (if tenant).
-func HomeHandler(i18n *i18n.I18n, mainTmpl, tenantTmpl *template.Template) http.HandlerFunc {
+// DashboardHandler handles the "/dashboard" route of signed-in users, with the home page templates.
+func DashboardHandler(i18n *i18n.I18n, mainTmpl, tenantTmpl *render.Page) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Prepare template data
 		data := render.BaseTemplateData(r, i18n, nil)
-		slog.Debug("[HOME] Rendering home page", "lang", data.Lang, "tenant", data.Tenant != nil, "user", data.User != nil)
+		slog.DebugContext(r.Context(), "[DASHBOARD] Rendering dashboard", "lang", data.Lang, "tenant", data.Tenant != nil, "user", data.User != nil)
 
+		// Step 2: Render template
 		if data.Tenant != nil {
-			slog.Debug("[HOME] Rendering tenant template", "template", "tenant.html")
 			render.RenderTemplate(w, tenantTmpl, "base", data)
 		} else {
-			slog.Debug("[HOME] Rendering main template", "template", "main.html")
 			render.RenderTemplate(w, mainTmpl, "base", data)
 		}
 	}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// impersonationHandoff bounds the hand-off from the platform admin page to the tenant host.
+const impersonationHandoff = time.Minute
+
+// InitImpersonateTemplates parses the templates needed for the impersonation page.
+// It includes header, base layout, and impersonation-specific content.
+func InitImpersonateTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("admin_impersonate", "admin_impersonate.html")
+}
+
+// ImpersonateStartHandler lets platform admins sign in as a tenant user at /admin/impersonate.
+// The start is audited with its reason, then the admin is sent to the tenant host with a
+// short-lived hand-off token that ImpersonateHandler turns into an expiring session.
+func ImpersonateStartHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		operator := middleware.CurrentUser(r)
+		if operator == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			extra["TTL"] = cfg.Security.ImpersonationTTL.String()
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 1: Handle GET request to show the form
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, map[string]any{"Subdomain": r.URL.Query().Get("subdomain")})
+			return
+		}
+
+		// Step 2: Validate the form; an impersonation cannot start another one
+		if operator.ImpersonatorID != 0 {
+			renderPage(http.StatusForbidden, map[string]any{"Error": i18n.T("impersonate.error.nested", lang)})
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("impersonate.error.invalid_form", lang)})
+			return
+		}
+		sub := strings.ToLower(strings.TrimSpace(r.FormValue("subdomain")))
+		email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+		reason := strings.TrimSpace(r.FormValue("reason"))
+		form := map[string]any{"Subdomain": sub, "Email": email, "Reason": reason}
+		if sub == "" || email == "" || reason == "" {
+			form["Error"] = i18n.T("impersonate.error.invalid_form", lang)
+			renderPage(http.StatusBadRequest, form)
+			return
+		}
+
+		// Step 3: Find the user, never another platform admin
+		t, err := models.GetTenantBySubdomain(r.Context(), db.DB, sub)
+		var target *models.User
+		if err == nil && t != nil {
+			target, err = models.GetUserByEmailAndTenant(email, int64(t.ID))
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Failed to load user", "subdomain", sub, "err", err)
+			form["Error"] = i18n.T("common.internal_error", lang)
+			renderPage(http.StatusInternalServerError, form)
+			return
+		}
+		if target == nil {
+			form["Error"] = i18n.T("impersonate.error.not_found", lang)
+			renderPage(http.StatusNotFound, form)
+			return
+		}
+		if cfg.IsPlatformAdmin(target.Email) {
+			form["Error"] = i18n.T("impersonate.error.platform_admin", lang)
+			renderPage(http.StatusForbidden, form)
+			return
+		}
+
+		// Step 4: Audit the start, then hand off to the tenant host
+		nonce, err := models.CreateImpersonationHandoff(r.Context(), int64(t.ID), operator.ID, impersonationHandoff)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Failed to record hand-off", "err", err)
+			form["Error"] = i18n.T("common.internal_error", lang)
+			renderPage(http.StatusInternalServerError, form)
+			return
+		}
+		token, err := utils.GenerateImpersonationToken(t.Subdomain, target.ID, int64(t.ID), operator.ID, operator.Email, nonce, time.Now().Add(impersonationHandoff))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Failed to sign hand-off", "err", err)
+			form["Error"] = i18n.T("common.internal_error", lang)
+			renderPage(http.StatusInternalServerError, form)
+			return
+		}
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: int64(t.ID),
+			UserID:   operator.ID,
+			Action:   "impersonation.started",
+			IP:       middleware.ClientIP(r),
+			Details:  operator.Email + " as " + target.Email + ": " + reason,
+		})
+		slog.InfoContext(r.Context(), "[IMPERSONATE] Impersonation started", "operator", operator.Email, "tenant", t.Subdomain, "user_id", target.ID)
+		http.Redirect(w, r, urls.Subdomain(cfg, t.Subdomain, "/impersonate", url.Values{"token": {token}}), http.StatusSeeOther)
+	}
+}
+
+// ImpersonateHandler opens the impersonation session on the tenant host at GET /impersonate.
+func ImpersonateHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Validate the hand-off for this tenant
+		t := middleware.FromContext(r.Context())
+		c, ok := utils.ValidateImpersonationToken(r.URL.Query().Get("token"), tokenAudience(cfg, r))
+		if t == nil || !ok || c.TenantID != t.ID {
+			slog.WarnContext(r.Context(), "[IMPERSONATE] Invalid or expired hand-off")
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Consume the hand-off and open an expiring session flagged with the operator
+		expires := time.Now().Add(cfg.Security.ImpersonationTTL)
+		token, err := models.CreateImpersonationSession(r.Context(), c.Nonce, c.UserID, t.ID, c.ObjectID, c.Email, expires)
+		if errors.Is(err, models.ErrHandoffInvalid) {
+			slog.WarnContext(r.Context(), "[IMPERSONATE] Hand-off already used", "operator", c.Email, "tenant", t.Subdomain)
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Failed to create session", "tenant", t.Subdomain, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		cookies.Set(w, r, cfg.SessionCookie, token, cfg.Security.ImpersonationTTL)
+		slog.InfoContext(r.Context(), "[IMPERSONATE] Session opened", "operator", c.Email, "tenant", t.Subdomain, "user_id", c.UserID, "expires", expires)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// StopImpersonationHandler ends the impersonation session at POST /impersonate/stop and sends
+// the operator back to the platform admin page.
+func StopImpersonationHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := middleware.CurrentUser(r)
+		if user == nil || user.ImpersonatorID == 0 {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		endImpersonation(w, r, cfg, user, "stopped")
+		http.Redirect(w, r, urls.Marketing(cfg, "/admin/impersonate", nil), http.StatusSeeOther)
+	}
+}
+
+// endImpersonation deletes the impersonation session, clears its cookie and audits the stop,
+// which LogAudit attributes to the operator. how tells whether the operator stopped it or logged out.
+func endImpersonation(w http.ResponseWriter, r *http.Request, cfg *multitenant.Config, user *models.User, how string) {
+	if c, err := r.Cookie(cfg.SessionCookie.Name); err == nil {
+		if err := models.DeleteSession(r.Context(), c.Value); err != nil {
+			slog.ErrorContext(r.Context(), "[IMPERSONATE] Failed to delete session", "err", err)
+		}
+	}
+	cookies.Clear(w, r, cfg.SessionCookie)
+	models.LogAudit(r.Context(), models.AuditEntry{
+		TenantID: user.TenantID,
+		UserID:   user.ImpersonatorID,
+		Action:   "impersonation.stopped",
+		IP:       middleware.ClientIP(r),
+		Details:  user.Email + ": " + how,
+	})
+	slog.InfoContext(r.Context(), "[IMPERSONATE] Impersonation ended", "operator", user.ImpersonatorEmail, "user_id", user.ID, "how", how)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InboundMailgunHandler receives messages forwarded by a Mailgun route and dispatches them
+// through mail.Inbound to the handler of the recipient mailbox, scoped to the recipient's tenant.
+func InboundMailgunHandler(cfg *multitenant.Config, fetcher multitenant.TenantFetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		msg, err := mail.ParseMailgun(r, cfg.Mail.MailgunSigningKey, cfg.CSRF.MaxMemory)
+		if errors.Is(err, mail.ErrInboundSignature) {
+			slog.WarnContext(r.Context(), "[INBOUND] Rejected Mailgun webhook", "ip", middleware.ClientIP(r))
+			middleware.Error(w, r, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[INBOUND] Invalid Mailgun payload", "err", err)
+			middleware.Error(w, r, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if err := dispatchInbound(r, cfg, fetcher, msg); err != nil {
+			middleware.Error(w, r, "Processing failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// InboundSESHandler receives SES receipts delivered through SNS. The endpoint must be called
+// with ?token=<INBOUND_MAIL_SECRET>; SNS subscription confirmations are accepted automatically.
+func InboundSESHandler(cfg *multitenant.Config, fetcher multitenant.TenantFetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Check the shared secret
+		token := r.URL.Query().Get("token")
+		if cfg.Mail.InboundSecret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Mail.InboundSecret)) != 1 {
+			slog.WarnContext(r.Context(), "[INBOUND] Rejected SES webhook", "ip", middleware.ClientIP(r))
+			middleware.Error(w, r, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Step 2: Parse, confirming subscriptions when asked
+		msgs, err := mail.ParseSES(r.Body)
+		var sub *mail.ErrSESSubscription
+		if errors.As(err, &sub) {
+			confirmSNSSubscription(r, sub.SubscribeURL)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[INBOUND] Invalid SES payload", "err", err)
+			middleware.Error(w, r, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		// Step 3: Dispatch each recipient
+		for _, msg := range msgs {
+			if err := dispatchInbound(r, cfg, fetcher, msg); err != nil {
+				middleware.Error(w, r, "Processing failed", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// dispatchInbound resolves the tenant of the recipient and hands the message to its handler.
+// Messages nobody handles are dropped so the provider does not retry them.
+func dispatchInbound(r *http.Request, cfg *multitenant.Config, fetcher multitenant.TenantFetcher, msg *mail.InboundMessage) error {
+	subdomain, ok := mail.RecipientSubdomain(msg.Recipient, cfg.Mail.InboundDomain)
+	if !ok {
+		slog.InfoContext(r.Context(), "[INBOUND] Recipient outside inbound domain", "recipient", msg.Recipient)
+		return nil
+	}
+
+	var tenantID int64
+	if subdomain != "" {
+		t, err := fetcher.Fetch(r.Context(), subdomain)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[INBOUND] Tenant lookup failed", "subdomain", subdomain, "err", err)
+			return err
+		}
+		if t == nil || t.Suspended {
+			slog.InfoContext(r.Context(), "[INBOUND] Unknown or suspended tenant", "subdomain", subdomain)
+			return nil
+		}
+		tenantID = t.ID
+	}
+
+	err := mail.Inbound.Dispatch(r.Context(), tenantID, msg)
+	if errors.Is(err, mail.ErrInboundNoHandler) {
+		slog.InfoContext(r.Context(), "[INBOUND] No handler for recipient", "recipient", msg.Recipient)
+		return nil
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[INBOUND] Handler failed", "recipient", msg.Recipient, "err", err)
+		return err
+	}
+	slog.InfoContext(r.Context(), "[INBOUND] Message dispatched", "recipient", msg.Recipient, "tenant_id", tenantID)
+	return nil
+}
+
+// confirmSNSSubscription visits the SubscribeURL when it points at Amazon SNS.
+func confirmSNSSubscription(r *http.Request, subscribeURL string) {
+	u, err := url.Parse(subscribeURL)
+	if err != nil || u.Scheme != "https" || !strings.HasPrefix(u.Host, "sns.") || !strings.HasSuffix(u.Host, ".amazonaws.com") {
+		slog.WarnContext(r.Context(), "[INBOUND] Ignoring suspicious SNS subscribe URL", "url", subscribeURL)
+		return
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[INBOUND] SNS subscription confirmation failed", "err", err)
+		return
+	}
+	resp.Body.Close()
+	slog.InfoContext(r.Context(), "[INBOUND] SNS subscription confirmed", "status", resp.StatusCode)
+}
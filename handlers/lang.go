@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/redirect"
+)
+
+// LangHandler handles the language dropdown (GET /lang?lang=fr). The choice persists in a signed cookie,
+// and on the user when signed in, then the visitor goes back to the page they came from, under the
+// new language prefix when Config.I18n.URLPrefix is set. A Referer of another site leads home.
+func LangHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Keep a known language
+		lang := r.URL.Query().Get("lang")
+		_, known := i18n.Translations()[lang]
+		if known {
+			cookies.SetSigned(w, r, cookies.Lang(cfg), lang, 0)
+			if user := middleware.CurrentUser(r); user != nil && user.ImpersonatorID == 0 && user.Lang != lang {
+				if err := models.SetUserLang(r.Context(), user.ID, lang); err != nil {
+					slog.ErrorContext(r.Context(), "[LANG] Failed to store the user's language", "user_id", user.ID, "err", err)
+				}
+			}
+		}
+
+		// Step 2: Send the visitor back to the same page, if it is on this host
+		back := redirect.Target(r, r.Referer(), "/")
+		if cfg.I18n.URLPrefix && known {
+			if u, err := url.Parse(back); err == nil {
+				_, rest, _ := middleware.SplitLangPrefix(u.Path, i18n.Translations())
+				back = middleware.LocalizePath(rest, lang)
+				if u.RawQuery != "" {
+					back += "?" + u.RawQuery
+				}
+			}
+		}
+		redirect.Safe(w, r, back, "/")
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// maxLaunchMessage bounds the placeholder message stored per tenant.
+const maxLaunchMessage = 500
+
+// InitComingSoonTemplates parses the templates needed for the coming-soon placeholder.
+// It includes header, base layout, and coming-soon-specific content.
+func InitComingSoonTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("coming_soon", "coming_soon.html")
+}
+
+// InitLaunchTemplates parses the templates needed for the launch settings page.
+// It includes header, base layout, and launch-specific content.
+func InitLaunchTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("launch", "launch.html")
+}
+
+// ComingSoonHandler renders the tenant-branded placeholder shown by middleware.ComingSoon.
+func ComingSoonHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		extra := map[string]any{}
+		if t := middleware.FromContext(r.Context()); t != nil {
+			settings, err := models.GetLaunchSettings(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[LAUNCH] Failed to load launch settings", "tenant", t.Subdomain, "err", err)
+			}
+			if settings != nil && settings.Message != "" {
+				extra["Message"] = settings.Message
+			}
+		}
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
+
+// LaunchSettingsHandler lets tenant admins toggle coming-soon mode and edit the placeholder message.
+func LaunchSettingsHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Handle POST request to save the settings
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				slog.ErrorContext(r.Context(), "[LAUNCH] Invalid form", "err", err)
+				middleware.Error(w, r, "Bad request", http.StatusBadRequest)
+				return
+			}
+			settings := models.LaunchSettings{
+				TenantID:   t.ID,
+				ComingSoon: r.FormValue("coming_soon") == "1",
+				Message:    strings.TrimSpace(r.FormValue("message")),
+			}
+			if len(settings.Message) > maxLaunchMessage {
+				data := render.BaseTemplateData(r, i18n, map[string]any{
+					"Error":    i18n.T("launch.error.message_too_long", lang, maxLaunchMessage),
+					"Settings": settings,
+				})
+				w.WriteHeader(http.StatusBadRequest)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			if err := models.SetLaunchSettings(r.Context(), settings); err != nil {
+				slog.ErrorContext(r.Context(), "[LAUNCH] Failed to save settings", "tenant", t.Subdomain, "err", err)
+				data := render.BaseTemplateData(r, i18n, map[string]any{
+					"Error":    i18n.T("common.internal_error", lang),
+					"Settings": settings,
+				})
+				w.WriteHeader(http.StatusInternalServerError)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			slog.InfoContext(r.Context(), "[LAUNCH] Launch settings updated", "tenant", t.Subdomain, "coming_soon", settings.ComingSoon)
+			http.Redirect(w, r, "/settings/launch?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 3: Render the current settings
+		settings, err := models.GetLaunchSettings(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[LAUNCH] Failed to load settings", "tenant", t.Subdomain, "err", err)
+		}
+		if settings == nil {
+			settings = &models.LaunchSettings{TenantID: t.ID}
+		}
+		extra := map[string]any{"Settings": settings}
+		if r.URL.Query().Get("saved") != "" {
+			extra["Success"] = i18n.T("launch.saved", lang)
+		}
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitLegalHoldTemplates parses the templates needed for the legal hold admin page.
+// It includes header, base layout, and legal-hold-specific content.
+func InitLegalHoldTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("legal_holds", "legal_holds.html")
+}
+
+// LegalHoldHandler lets platform admins place and release legal holds on tenants.
+// POST actions: "place" holds a tenant by subdomain, "release" lifts a hold by tenant ID.
+// Every change is recorded in the audit log.
+func LegalHoldHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			holds, err := models.ListLegalHolds(r.Context())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[LEGALHOLD] Failed to list holds", "err", err)
+			}
+			extra["Holds"] = holds
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 1: Handle GET request to list active holds
+		if r.Method == http.MethodGet {
+			renderPage(http.StatusOK, nil)
+			return
+		}
+
+		// Step 2: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[LEGALHOLD] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("legalhold.error.invalid_form", lang)})
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "place":
+			// Step 3a: Resolve the tenant and record the hold
+			subdomain := strings.ToLower(strings.TrimSpace(r.FormValue("subdomain")))
+			reason := strings.TrimSpace(r.FormValue("reason"))
+			if subdomain == "" || reason == "" {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("legalhold.error.missing_fields", lang)})
+				return
+			}
+			tenantID, err := models.GetTenantIDBySubdomain(r.Context(), subdomain)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[LEGALHOLD] Tenant lookup failed", "subdomain", subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if tenantID == 0 {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("legalhold.error.unknown_tenant", lang)})
+				return
+			}
+			if err := models.PlaceLegalHold(r.Context(), tenantID, user.ID, reason); err != nil {
+				slog.ErrorContext(r.Context(), "[LEGALHOLD] Failed to place hold", "tenant_id", tenantID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: tenantID,
+				UserID:   user.ID,
+				Action:   "legal_hold.placed",
+				IP:       middleware.ClientIP(r),
+				Details:  reason,
+			})
+			slog.InfoContext(r.Context(), "[LEGALHOLD] Hold placed", "tenant_id", tenantID, "by", user.ID)
+
+		case "release":
+			// Step 3b: Lift the hold
+			tenantID, err := strconv.ParseInt(r.FormValue("tenant_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("legalhold.error.invalid_form", lang)})
+				return
+			}
+			if err := models.ReleaseLegalHold(r.Context(), tenantID); err != nil {
+				slog.ErrorContext(r.Context(), "[LEGALHOLD] Failed to release hold", "tenant_id", tenantID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: tenantID,
+				UserID:   user.ID,
+				Action:   "legal_hold.released",
+				IP:       middleware.ClientIP(r),
+				Details:  fmt.Sprintf("released by user %d", user.ID),
+			})
+			slog.InfoContext(r.Context(), "[LEGALHOLD] Hold released", "tenant_id", tenantID, "by", user.ID)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("legalhold.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/admin/legal-holds", http.StatusSeeOther)
+	}
+}
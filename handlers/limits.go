@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+)
+
+// limitMessage translates an error of package limits for the user, "" for any other error.
+func limitMessage(i18n *i18n.I18n, lang string, err error) string {
+	var le *limits.LimitError
+	switch {
+	case errors.As(err, &le) && le.Resource == limits.Members:
+		return i18n.T("limits.error.members", lang, le.Limit)
+	case errors.As(err, &le) && le.Resource == limits.Storage:
+		return i18n.T("limits.error.storage", lang, (le.Limit+1<<20-1)>>20)
+	case errors.As(err, &le):
+		return i18n.T("limits.error.resource", lang, le.Resource, le.Limit)
+	case errors.Is(err, limits.ErrFeatureUnavailable):
+		return i18n.T("limits.error.feature", lang)
+	}
+	return ""
+}
@@ -1,161 +1,96 @@
 package handlers
 
 import (
-	"html/template"
 	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/pandamasta/tenkit/internal/i18n"
 	"github.com/pandamasta/tenkit/internal/render"
-	"github.com/pandamasta/tenkit/models"
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
 	"github.com/pandamasta/tenkit/multitenant/middleware"
-
-	"golang.org/x/crypto/bcrypt"
+	"github.com/pandamasta/tenkit/multitenant/redirect"
 )
 
 // InitLoginTemplates parses the templates needed for the login page.
 // It includes header, base layout, and login-specific content.
-func InitLoginTemplates(base []string) *template.Template {
-	tmpl := template.New("base").Funcs(template.FuncMap{
-		"t": func(key string, args ...any) string {
-			return key // Placeholder
-		},
-	})
-	var err error
-	tmpl, err = tmpl.ParseFiles(append(base, "templates/login.html")...)
-	if err != nil {
-		slog.Error("[LOGIN] Failed to parse login template", "err", err)
-		panic(err)
-	}
-	return tmpl
+func InitLoginTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("login", "login.html")
 }
 
-// LoginHandler handles GET and POST requests for /login.
-func LoginHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *template.Template) http.HandlerFunc {
+// LoginHandler handles GET and POST requests for /login. After signing in, the user goes to the
+// "next" parameter when it stays on this tenant or a configured host (see redirect.Allowed), or home.
+func LoginHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		lang := middleware.LangFromContext(r.Context())
 
 		// Step 1: Handle GET request to serve the login form
 		if r.Method == http.MethodGet {
 			// Step 2: Prepare data for template
-			data := render.BaseTemplateData(r, i18n, nil)
-			// Step 3: Render login form
-			slog.Debug("[LOGIN] Rendering login form", "lang", lang)
+			extra := map[string]any{"Challenge": challengeWidget(r, ""), "Next": loginNext(r, r.URL.Query().Get("next"))}
 			// Check for error in query params (from redirect)
 			if errorKey := r.URL.Query().Get("error"); errorKey != "" {
-				data.Extra = map[string]any{
-					"Error": i18n.T("login.error."+errorKey, lang),
-				}
+				extra["Error"] = i18n.T("login.error."+errorKey, lang)
 			}
-			render.RenderTemplate(w, tmpl, "base", data)
+			data := render.BaseTemplateData(r, i18n, extra)
+			// Step 3: Render login form
+			slog.DebugContext(r.Context(), "[LOGIN] Rendering login form", "lang", lang)
+			render.Partial(w, r, tmpl, "content", data)
 			return
 		}
 
 		// Step 4: Parse form data from POST request
 		if err := r.ParseForm(); err != nil {
-			slog.Error("[LOGIN] Invalid form", "err", err)
+			slog.ErrorContext(r.Context(), "[LOGIN] Invalid form", "err", err)
 			data := render.BaseTemplateData(r, i18n, map[string]any{
 				"Error": i18n.T("login.error.InvalidForm", lang),
+				"Next":  loginNext(r, r.FormValue("next")),
 			})
 			w.WriteHeader(http.StatusBadRequest)
-			render.RenderTemplate(w, tmpl, "base", data)
+			render.Partial(w, r, tmpl, "content", data)
 			return
 		}
 
-		// Step 5: Extract submitted values
-		email := r.FormValue("email")
-		pass := r.FormValue("password")
-
-		// Step 6: Validate required fields
-		if email == "" || pass == "" {
+		// Step 5: Check the credentials and open a session
+		_, token, fe := loginUser(r, r.FormValue("email"), r.FormValue("password"), challengeResponse(r))
+		if fe != nil {
 			data := render.BaseTemplateData(r, i18n, map[string]any{
-				"Error": i18n.T("login.error.MissingFields", lang),
+				"Error":     fe.message(i18n, lang),
+				"Challenge": challengeWidget(r, r.FormValue("email")),
+				"Next":      loginNext(r, r.FormValue("next")),
 			})
-			w.WriteHeader(http.StatusBadRequest)
-			render.RenderTemplate(w, tmpl, "base", data)
+			w.WriteHeader(fe.Status)
+			render.Partial(w, r, tmpl, "content", data)
 			return
 		}
 
-		// Step 7: Retrieve tenant from context
-		t := middleware.FromContext(r.Context())
-		if t == nil {
-			slog.Error("[LOGIN] Tenant context missing", "email", email)
-			data := render.BaseTemplateData(r, i18n, map[string]any{
-				"Error": i18n.T("login.error.TenantNotFound", lang),
-			})
-			w.WriteHeader(http.StatusBadRequest)
-			render.RenderTemplate(w, tmpl, "base", data)
-			return
-		}
+		// Step 6: Set session cookie
+		cookies.Set(w, r, cfg.SessionCookie, token, cfg.TokenExpiry)
 
-		// Step 8: Look up user by email and tenant
-		user, err := models.GetUserByEmailAndTenant(email, t.ID)
-		if err != nil {
-			slog.Error("[LOGIN] DB error", "email", email, "tenant", t.Subdomain, "err", err)
-			data := render.BaseTemplateData(r, i18n, map[string]any{
-				"Error": i18n.T("login.error.Internal", lang),
-			})
-			w.WriteHeader(http.StatusInternalServerError)
-			render.RenderTemplate(w, tmpl, "base", data)
-			return
-		}
-		if user == nil {
-			slog.Info("[LOGIN] No user found", "email", email, "tenant", t.Subdomain)
-			data := render.BaseTemplateData(r, i18n, map[string]any{
-				"Error": i18n.T("login.error.InvalidCreds", lang),
-			})
-			w.WriteHeader(http.StatusUnauthorized)
-			render.RenderTemplate(w, tmpl, "base", data)
-			return
-		}
-
-		// Step 9: Verify password
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(pass)); err != nil {
-			slog.Info("[LOGIN] Wrong password", "email", email, "tenant", t.Subdomain)
-			data := render.BaseTemplateData(r, i18n, map[string]any{
-				"Error": i18n.T("login.error.InvalidCreds", lang),
-			})
-			w.WriteHeader(http.StatusUnauthorized)
-			render.RenderTemplate(w, tmpl, "base", data)
-			return
-		}
-
-		// Step 10: Create session token
-		token := models.CreateSession(user.ID, user.TenantID)
-
-		// Step 11: Set session cookie
-		cookie := http.Cookie{
-			Name:     cfg.SessionCookie.Name,
-			Value:    token,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   false, // Set to true in production
-			Expires:  time.Now().Add(cfg.TokenExpiry),
-		}
-		http.SetCookie(w, &cookie)
-
-		// Step 12: Log success and redirect
-		slog.Info("[LOGIN] User logged in", "email", email, "tenant", t.Subdomain)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		// Step 7: Go back to the page asked for, or home
+		redirect.Safe(w, r, loginNext(r, r.FormValue("next")), "/")
 	}
 }
 
+// loginNext returns the "next" target of the login form, "" when it is missing or not allowed.
+func loginNext(r *http.Request, next string) string {
+	return redirect.Target(r, next, "")
+}
+
 // LogoutHandler handles GET requests for /logout.
 func LogoutHandler(cfg *multitenant.Config, i18n *i18n.I18n) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Step 1: Clear session cookie
-		cookie := http.Cookie{
-			Name:     cfg.SessionCookie.Name,
-			Value:    "",
-			Path:     "/",
-			HttpOnly: true,
-			Expires:  time.Unix(0, 0),
+		// Step 1: End an impersonation for good rather than leave its session behind
+		if user := middleware.CurrentUser(r); user != nil && user.ImpersonatorID != 0 {
+			endImpersonation(w, r, cfg, user, "logged out")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
 		}
-		http.SetCookie(w, &cookie)
 
-		// Step 2: Redirect to home
+		// Step 2: Clear session cookie
+		cookies.Clear(w, r, cfg.SessionCookie)
+
+		// Step 3: Redirect to home
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
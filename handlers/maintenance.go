@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/maintenance"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// maintenanceBody is the JSON accepted by POST /api/v1/maintenance.
+type maintenanceBody struct {
+	Tenant     string `json:"tenant,omitempty"` // Subdomain, empty for the whole platform
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds, MAINTENANCE_RETRY_AFTER when 0
+}
+
+// maintenanceWindow is a window in progress, as answered by /api/v1/maintenance.
+type maintenanceWindow struct {
+	Tenant     string     `json:"tenant,omitempty"` // Empty for the whole platform
+	Message    string     `json:"message,omitempty"`
+	RetryAfter int        `json:"retry_after"` // Seconds
+	Since      *time.Time `json:"since,omitempty"`
+	Source     string     `json:"source"` // "config" or "operator"
+}
+
+// maintenanceStatus is the answer of /api/v1/maintenance.
+type maintenanceStatus struct {
+	Windows []maintenanceWindow `json:"windows"`
+}
+
+// InitMaintenanceTemplates parses the templates needed for the maintenance page.
+func InitMaintenanceTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("maintenance", "maintenance.html")
+}
+
+// MaintenanceHandler renders the page served by middleware.Maintenance, which sets Retry-After.
+func MaintenanceHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window, _ := maintenance.Tenant(middleware.FromContext(r.Context()))
+		extra := map[string]any{"Message": window.Message}
+		if window.RetryAfter > 0 {
+			extra["RetryMinutes"] = int((window.RetryAfter + time.Minute - 1) / time.Minute)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
+
+// HealthHandler answers GET /healthz for load balancers and orchestrators: 200 while the database
+// answers, 503 otherwise. It stays reachable in maintenance mode.
+func HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := db.DB.PingContext(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "[HEALTH] Database unreachable", "err", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("database unreachable\n"))
+			return
+		}
+		w.Write([]byte("ok\n"))
+	}
+}
+
+// MaintenanceAPIHandler lets operators switch maintenance mode from scripts at /api/v1/maintenance
+// on the root domain, with the TENANT_PROVISION_TOKEN of ProvisionHandler. GET answers the windows
+// in progress; POST opens ("enabled": true) or closes the window of the platform, or of a tenant
+// with "tenant", and answers the same. Windows set by configuration stay until it changes.
+func MaintenanceAPIHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Authenticate the caller on the root domain
+		if !platformTokenValid(cfg, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			writeMaintenanceStatus(w)
+			return
+		}
+
+		// Step 2: Decode the request and find the tenant
+		var body maintenanceBody
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+			middleware.Error(w, r, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.RetryAfter < 0 {
+			middleware.Error(w, r, "Invalid retry_after", http.StatusBadRequest)
+			return
+		}
+		var tenantID int64
+		if sub := strings.ToLower(strings.TrimSpace(body.Tenant)); sub != "" {
+			id, err := models.GetTenantIDBySubdomain(r.Context(), sub)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MAINTENANCE] Failed to look up tenant", "subdomain", sub, "err", err)
+				middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			if id == 0 {
+				middleware.Error(w, r, "Unknown tenant", http.StatusNotFound)
+				return
+			}
+			tenantID = id
+		}
+
+		// Step 3: Open or close the window, audited
+		var err error
+		action := "maintenance.started"
+		if body.Enabled {
+			retry := cfg.Maintenance.RetryAfter
+			if body.RetryAfter > 0 {
+				retry = time.Duration(body.RetryAfter) * time.Second
+			}
+			err = maintenance.Start(r.Context(), tenantID, strings.TrimSpace(body.Message), retry, 0)
+		} else {
+			action = "maintenance.ended"
+			_, err = maintenance.End(r.Context(), tenantID)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[MAINTENANCE] Failed to switch maintenance mode", "tenant_id", tenantID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: tenantID,
+			Action:   action,
+			IP:       middleware.ClientIP(r),
+			Details:  strings.TrimSpace(body.Message),
+		})
+		slog.InfoContext(r.Context(), "[MAINTENANCE] Maintenance mode switched", "tenant_id", tenantID, "enabled", body.Enabled)
+		writeMaintenanceStatus(w)
+	}
+}
+
+// platformTokenValid checks the TENANT_PROVISION_TOKEN of the platform API. It answers 404 on
+// tenant hosts and while no token is configured, 401 for a wrong token.
+func platformTokenValid(cfg *multitenant.Config, w http.ResponseWriter, r *http.Request) bool {
+	token := cfg.Tenants.ProvisionToken
+	if token == "" || middleware.FromContext(r.Context()) != nil {
+		http.NotFound(w, r)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		slog.WarnContext(r.Context(), "[PLATFORM] Rejected API request", "path", r.URL.Path, "ip", middleware.ClientIP(r))
+		middleware.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeMaintenanceStatus(w http.ResponseWriter) {
+	status := maintenanceStatus{Windows: []maintenanceWindow{}}
+	for _, win := range maintenance.Windows() {
+		mw := maintenanceWindow{Tenant: win.Subdomain, Message: win.Message, RetryAfter: int(win.RetryAfter.Seconds()), Source: win.Source}
+		if !win.Since.IsZero() {
+			since := win.Since
+			mw.Since = &since
+		}
+		status.Windows = append(status.Windows, mw)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
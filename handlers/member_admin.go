@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/realtime"
+	"github.com/pandamasta/tenkit/multitenant/search"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// InitMemberAdminTemplates parses the templates needed for the member admin console.
+// It includes header, base layout, and console-specific content.
+func InitMemberAdminTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("admin_members", "admin_members.html")
+}
+
+// MemberAdminHandler is the tenant admins' console at /admin/members.
+// POST actions on a member: "set_role", "deactivate", "reactivate" and "remove"; admins never act on
+// themselves nor on members ranking above them, and the last active owner is never demoted,
+// deactivated or removed (models.ErrLastOwner). Members of a tenant on legal hold are not removed.
+// Owners may also "transfer_ownership" to an active member, who becomes owner once they accept the
+// offer from the mailed link (see OwnershipHandler), and "cancel_transfer" while it is pending.
+// "cancel_signup" deletes a registration still waiting for its email confirmation, and "create"
+// adds a user with a role the admin may grant and mails them a link to choose their password.
+// The list is paged and may be searched (?q=), filtered (?role=, ?status=) and sorted, see
+// models.MemberList.
+func MemberAdminHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and admin from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			// Malformed paging parameters show the first page
+			req, _ := models.MemberList.Parse(r.URL.Query())
+			members, page, err := models.PageTenantMembers(r.Context(), t.ID, req)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to list members", "tenant", t.Subdomain, "err", err)
+			}
+			signups, err := models.ListPendingSignups(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to list pending signups", "tenant", t.Subdomain, "err", err)
+			}
+			extra["Members"] = members
+			extra["Page"] = page
+			extra["AllRoles"] = cfg.Roles.Roles
+			extra["Statuses"] = []string{models.MembershipActive, models.MembershipInactive, models.MembershipPending}
+			extra["Signups"] = signups
+			extra["Roles"] = grantableRoles(cfg, user.Role)
+			extra["DefaultRole"] = cfg.Roles.Default
+			extra["Self"] = user.ID
+			if cfg.Roles.Allows(user.Role, cfg.Roles.Owner) {
+				transfer, err := models.PendingOwnershipTransfer(r.Context(), t.ID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "[MEMBERS] Failed to load ownership transfer", "tenant", t.Subdomain, "err", err)
+				}
+				extra["IsOwner"] = true
+				extra["OwnerRole"] = cfg.Roles.Owner
+				extra["Transfer"] = transfer
+			}
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the console
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("members.saved", lang)
+			}
+			if r.URL.Query().Get("created") != "" {
+				extra["Success"] = i18n.T("member_admin.created", lang)
+			}
+			if r.URL.Query().Get("transfer") != "" {
+				extra["Success"] = i18n.T("member_admin.transfer_sent", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[MEMBERS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+			return
+		}
+		action := r.FormValue("action")
+
+		// Step 4: Cancel an unconfirmed registration
+		if action == "cancel_signup" {
+			id, err := strconv.ParseInt(r.FormValue("signup_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			found, err := models.CancelPendingSignup(r.Context(), t.ID, id)
+			if errors.Is(err, models.ErrLegalHold) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("common.legal_hold", lang)})
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to cancel signup", "tenant", t.Subdomain, "signup_id", id, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "signup.cancelled",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10),
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Pending signup cancelled", "tenant", t.Subdomain, "signup_id", id)
+			http.Redirect(w, r, "/admin/members?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 5: Withdraw the pending ownership transfer
+		if action == "cancel_transfer" {
+			if !cfg.Roles.Allows(user.Role, cfg.Roles.Owner) {
+				renderPage(http.StatusForbidden, map[string]any{"Error": i18n.T("members.error.owner_only", lang)})
+				return
+			}
+			found, err := models.CancelOwnershipTransfer(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to cancel ownership transfer", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.unchanged", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "ownership.transfer_cancelled",
+				IP:       middleware.ClientIP(r),
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Ownership transfer cancelled", "tenant", t.Subdomain)
+			http.Redirect(w, r, "/admin/members?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 6: Create a member who chooses their password from the mailed link
+		if action == "create" {
+			email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+			role := r.FormValue("role")
+			if !canGrant(cfg, user.Role, role) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_role", lang), "NewEmail": email})
+				return
+			}
+			if fe := memberLimitError(r, i18n, "MEMBERS", "common.internal_error"); fe != nil {
+				renderPage(fe.Status, map[string]any{"Error": fe.message(i18n, lang), "NewEmail": email})
+				return
+			}
+			m, err := multitenant.CreateMember(r.Context(), multitenant.MemberRequest{
+				Config:    cfg,
+				TenantID:  t.ID,
+				Email:     email,
+				Role:      role,
+				CreatedBy: user.ID,
+			})
+			switch {
+			case errors.Is(err, multitenant.ErrInvalidEmail):
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("member_admin.error.invalid_email", lang), "NewEmail": email})
+				return
+			case errors.Is(err, multitenant.ErrUserExists):
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("member_admin.error.exists", lang), "NewEmail": email})
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to create member", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "member.created",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(m.UserID, 10) + " " + m.Email + " " + m.Role,
+			})
+			link := urls.Tenant(cfg, t, "/reset", url.Values{"token": {m.Token}})
+			err = mail.Default.SendTenant(r.Context(), t.ID, t.Name, mail.Message{
+				To:      []string{m.Email},
+				Subject: i18n.T("mail.setup.subject", lang, t.Name),
+				Text:    i18n.T("mail.setup.body", lang, user.Email, t.Name, link, cfg.SetupExpiry.Round(time.Hour).Hours()),
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to send set-password email", "user_id", m.UserID, "err", err)
+			}
+			slog.InfoContext(r.Context(), "[MEMBERS] Member created", "tenant", t.Subdomain, "member_id", m.UserID, "role", m.Role)
+			http.Redirect(w, r, "/admin/members?created=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 7: Load the member and check the admin may act on them
+		memberID, err := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+		if err != nil {
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+			return
+		}
+		target, err := models.GetTenantMember(r.Context(), t.ID, memberID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[MEMBERS] Failed to load member", "tenant", t.Subdomain, "member_id", memberID, "err", err)
+			renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+			return
+		}
+		if target == nil {
+			renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("members.error.not_found", lang)})
+			return
+		}
+		if target.UserID == user.ID {
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.self", lang)})
+			return
+		}
+		if !cfg.Roles.Allows(user.Role, target.Role) {
+			slog.WarnContext(r.Context(), "[MEMBERS] Action on a higher role refused", "tenant", t.Subdomain, "member_id", memberID, "action", action)
+			renderPage(http.StatusForbidden, map[string]any{"Error": i18n.T("members.error.outranked", lang)})
+			return
+		}
+
+		// Step 8: Offer the tenant to the member, who becomes owner once they accept from the mailed link
+		if action == "transfer_ownership" {
+			if !cfg.Roles.Allows(user.Role, cfg.Roles.Owner) {
+				renderPage(http.StatusForbidden, map[string]any{"Error": i18n.T("members.error.owner_only", lang)})
+				return
+			}
+			if target.Status != models.MembershipActive || !target.IsActive {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.transfer_inactive", lang)})
+				return
+			}
+			token, err := models.CreateOwnershipTransfer(r.Context(), t.ID, user.ID, memberID, cfg.TransferExpiry)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to create ownership transfer", "tenant", t.Subdomain, "member_id", memberID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "ownership.transfer_offered",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(memberID, 10) + " " + target.Email,
+			})
+			link := urls.Tenant(cfg, t, "/ownership", url.Values{"token": {token}})
+			err = mail.Default.SendTenant(r.Context(), t.ID, t.Name, mail.Message{
+				To:      []string{target.Email},
+				Subject: i18n.T("mail.transfer.subject", lang, t.Name),
+				Text:    i18n.T("mail.transfer.body", lang, user.Email, t.Name, link, cfg.TransferExpiry.Round(time.Hour).Hours()),
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to send ownership transfer email", "member_id", memberID, "err", err)
+			}
+			slog.InfoContext(r.Context(), "[MEMBERS] Ownership transfer offered", "tenant", t.Subdomain, "member_id", memberID)
+			http.Redirect(w, r, "/admin/members?transfer=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 9: Apply the action
+		var found bool
+		var auditAction, details string
+		switch action {
+		case "set_role":
+			role := r.FormValue("role")
+			if !canGrant(cfg, user.Role, role) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_role", lang)})
+				return
+			}
+			found, err = models.SetMemberRole(r.Context(), t.ID, memberID, role, cfg.Roles.Owner)
+			auditAction, details = "membership.role_changed", target.Role+" -> "+role
+		case "deactivate", "reactivate":
+			found, err = models.SetMembershipActive(r.Context(), t.ID, memberID, action == "reactivate", cfg.Roles.Owner)
+			auditAction = "membership." + action + "d"
+		case "remove":
+			found, err = models.RemoveMember(r.Context(), t.ID, memberID, cfg.Roles.Owner)
+			auditAction = "membership.removed"
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+			return
+		}
+		if errors.Is(err, models.ErrLastOwner) {
+			renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.last_owner", lang)})
+			return
+		}
+		if errors.Is(err, models.ErrLegalHold) {
+			renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.legal_hold", lang)})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[MEMBERS] Failed to update member", "tenant", t.Subdomain, "action", action, "member_id", memberID, "err", err)
+			renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+			return
+		}
+		if !found {
+			renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.unchanged", lang)})
+			return
+		}
+
+		// Step 10: Record the change
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   auditAction,
+			IP:       middleware.ClientIP(r),
+			Details:  strings.TrimSpace(strconv.FormatInt(memberID, 10) + " " + target.Email + " " + details),
+		})
+		search.TouchMember(r.Context(), t.ID, memberID)
+		if action == "set_role" {
+			events.Publish(r.Context(), events.Event{
+				Name:     events.MemberRoleChanged,
+				TenantID: t.ID,
+				UserID:   memberID,
+				Data:     map[string]any{"role": r.FormValue("role"), "previous_role": target.Role, "changed_by": user.Email},
+			})
+		} else {
+			realtime.MemberChanged(r.Context(), cfg, t.ID, memberID, strings.TrimPrefix(auditAction, "membership."))
+		}
+		slog.InfoContext(r.Context(), "[MEMBERS] Member updated", "tenant", t.Subdomain, "action", action, "member_id", memberID)
+		http.Redirect(w, r, "/admin/members?saved=1", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/search"
+)
+
+// errJoinRefused is returned by joinPolicy when the tenant does not accept the address.
+var errJoinRefused = errors.New("email domain not accepted by tenant")
+
+// InitMembersTemplates parses the templates needed for the member management page.
+// It includes header, base layout, and members-specific content.
+func InitMembersTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("members", "members.html")
+}
+
+// MembersHandler lists the tenant's members and manages the approval queue and join domains.
+// POST actions: "settings" saves the registration policy, "approve" and "reject" handle a pending member,
+// "add_domain" and "remove_domain" manage the email domains that join without approval,
+// "create_link" and "revoke_link" manage shareable signup links granting a role.
+func MembersHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and admin from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			members, err := models.ListTenantMembers(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to list members", "tenant", t.Subdomain, "err", err)
+			}
+			settings, err := models.GetMembershipSettings(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to load settings", "tenant", t.Subdomain, "err", err)
+			}
+			if settings == nil {
+				settings = &models.MembershipSettings{TenantID: t.ID, UnmatchedDomains: models.UnmatchedAllow}
+			}
+			domains, err := models.ListJoinDomains(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to list join domains", "tenant", t.Subdomain, "err", err)
+			}
+			links, err := models.ListSignupLinks(r.Context(), t.ID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to list signup links", "tenant", t.Subdomain, "err", err)
+			}
+			views := make([]signupLinkView, 0, len(links))
+			for _, l := range links {
+				u, err := signupLinkURL(cfg, r, l)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "[MEMBERS] Failed to sign link", "link_id", l.ID, "err", err)
+					continue
+				}
+				views = append(views, signupLinkView{SignupLink: l, URL: u})
+			}
+			extra["Links"] = views
+			extra["Members"] = members
+			extra["Settings"] = settings
+			extra["Domains"] = domains
+			extra["Roles"] = grantableRoles(cfg, user.Role)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the members
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("members.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[MEMBERS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+			return
+		}
+
+		switch action := r.FormValue("action"); action {
+		case "settings":
+			// Step 4a: Save the registration policy
+			settings := models.MembershipSettings{
+				TenantID:         t.ID,
+				RequireApproval:  r.FormValue("require_approval") == "1",
+				UnmatchedDomains: r.FormValue("unmatched_domains"),
+			}
+			switch settings.UnmatchedDomains {
+			case models.UnmatchedAllow, models.UnmatchedApproval, models.UnmatchedReject:
+			default:
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			if err := models.SetMembershipSettings(r.Context(), settings); err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to save settings", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			slog.InfoContext(r.Context(), "[MEMBERS] Settings updated", "tenant", t.Subdomain, "require_approval", settings.RequireApproval)
+
+		case "approve", "reject":
+			// Step 4b: Decide on a pending member
+			memberID, err := strconv.ParseInt(r.FormValue("user_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			var found bool
+			if action == "approve" {
+				found, err = models.ApproveMembership(r.Context(), t.ID, memberID)
+			} else {
+				found, err = models.RejectMembership(r.Context(), t.ID, memberID)
+			}
+			if errors.Is(err, models.ErrLegalHold) {
+				renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("members.error.legal_hold", lang)})
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to update membership", "tenant", t.Subdomain, "action", action, "member_id", memberID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("members.error.not_pending", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "membership." + action + "d",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(memberID, 10),
+			})
+			search.TouchMember(r.Context(), t.ID, memberID)
+			slog.InfoContext(r.Context(), "[MEMBERS] Pending member handled", "tenant", t.Subdomain, "action", action, "member_id", memberID)
+
+		case "add_domain":
+			// Step 4c: Let a domain join without approval, optionally with a specific role
+			domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(r.FormValue("domain"))), "@")
+			if !domainRegex.MatchString(domain) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_domain", lang)})
+				return
+			}
+			role := r.FormValue("role")
+			if role != "" && !canGrant(cfg, user.Role, role) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_role", lang)})
+				return
+			}
+			if err := models.SetJoinDomain(r.Context(), models.JoinDomain{TenantID: t.ID, Domain: domain, Role: role}); err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to save join domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "join_domain.added",
+				IP:       middleware.ClientIP(r),
+				Details:  domain + " " + role,
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Join domain added", "tenant", t.Subdomain, "domain", domain, "role", role)
+
+		case "remove_domain":
+			// Step 4d: Remove a join domain
+			id, err := strconv.ParseInt(r.FormValue("domain_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			found, err := models.DeleteJoinDomain(r.Context(), t.ID, id)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to remove join domain", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "join_domain.removed",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10),
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Join domain removed", "tenant", t.Subdomain, "domain_id", id)
+
+		case "create_link":
+			// Step 4e: Create a signup link granting a role
+			role := r.FormValue("role")
+			days, errDays := strconv.Atoi(r.FormValue("days"))
+			maxUses, errUses := strconv.Atoi(r.FormValue("max_uses"))
+			if errDays != nil || errUses != nil || days < 1 || days > maxSignupLinkDays || maxUses < 0 || maxUses > maxSignupLinkUses {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_link", lang, maxSignupLinkDays, maxSignupLinkUses)})
+				return
+			}
+			if !canGrant(cfg, user.Role, role) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_role", lang)})
+				return
+			}
+			id, err := models.CreateSignupLink(r.Context(), models.SignupLink{
+				TenantID:  t.ID,
+				Role:      role,
+				MaxUses:   maxUses,
+				ExpiresAt: time.Now().Add(time.Duration(days) * 24 * time.Hour),
+				CreatedBy: user.ID,
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to create signup link", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "signup_link.created",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10) + " " + role,
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Signup link created", "tenant", t.Subdomain, "link_id", id, "role", role)
+			events.Publish(r.Context(), events.Event{
+				Name:     events.MemberInvited,
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Data:     map[string]any{"signup_link_id": id, "role": role, "max_uses": maxUses, "invited_by": user.Email},
+			})
+
+		case "revoke_link":
+			// Step 4f: Revoke a signup link
+			id, err := strconv.ParseInt(r.FormValue("link_id"), 10, 64)
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			found, err := models.RevokeSignupLink(r.Context(), t.ID, id)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[MEMBERS] Failed to revoke signup link", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if !found {
+				renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+				return
+			}
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "signup_link.revoked",
+				IP:       middleware.ClientIP(r),
+				Details:  strconv.FormatInt(id, 10),
+			})
+			slog.InfoContext(r.Context(), "[MEMBERS] Signup link revoked", "tenant", t.Subdomain, "link_id", id)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("members.error.invalid_form", lang)})
+			return
+		}
+
+		http.Redirect(w, r, "/settings/members?saved=1", http.StatusSeeOther)
+	}
+}
+
+// canGrant reports whether an admin holding granter may hand out role: nobody grants above their own rank.
+func canGrant(cfg *multitenant.Config, granter, role string) bool {
+	_, ok := cfg.Roles.Get(role)
+	return ok && cfg.Roles.Allows(granter, role)
+}
+
+// grantableRoles returns the roles an admin holding granter may hand out.
+func grantableRoles(cfg *multitenant.Config, granter string) []multitenant.Role {
+	var out []multitenant.Role
+	for _, r := range cfg.Roles.Roles {
+		if canGrant(cfg, granter, r.Name) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// joinPolicy decides the membership status and role of a user registering with email.
+// Addresses of a join domain skip the approval queue; others follow the tenant's membership settings.
+func joinPolicy(ctx context.Context, cfg *multitenant.Config, tenantID int64, email string) (status, role string, err error) {
+	settings, err := models.GetMembershipSettings(ctx, tenantID)
+	if err != nil {
+		return "", "", err
+	}
+	if settings == nil {
+		settings = &models.MembershipSettings{TenantID: tenantID, UnmatchedDomains: models.UnmatchedAllow}
+	}
+
+	// Step 1: A matching join domain admits the user at once
+	email = strings.ToLower(strings.TrimSpace(email))
+	domain := email[strings.LastIndex(email, "@")+1:]
+	rule, err := models.GetJoinDomain(ctx, tenantID, domain)
+	if err != nil {
+		return "", "", err
+	}
+	if rule != nil {
+		role = cfg.Roles.Default
+		if _, ok := cfg.Roles.Get(rule.Role); ok {
+			role = rule.Role
+		}
+		return models.MembershipActive, role, nil
+	}
+
+	// Step 2: Other addresses follow the approval setting and the unmatched domain policy
+	status = models.MembershipActive
+	if settings.RequireApproval {
+		status = models.MembershipPending
+	}
+	if settings.UnmatchedDomains == models.UnmatchedApproval || settings.UnmatchedDomains == models.UnmatchedReject {
+		n, err := models.CountJoinDomains(ctx, tenantID)
+		if err != nil {
+			return "", "", err
+		}
+		if n > 0 && settings.UnmatchedDomains == models.UnmatchedReject {
+			return "", "", errJoinRefused
+		}
+		if n > 0 {
+			status = models.MembershipPending
+		}
+	}
+	return status, cfg.Roles.Default, nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/forms"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Limits matching what search engines and link previews display.
+const (
+	maxMetaTitle       = 70
+	maxMetaDescription = 300
+)
+
+// metaForm is the form of the meta settings page.
+var metaForm = forms.New(
+	forms.Field{Name: "title", Checks: []forms.Check{forms.MaxLength(maxMetaTitle)}},
+	forms.Field{Name: "description", Checks: []forms.Check{forms.MaxLength(maxMetaDescription)}},
+)
+
+// InitMetaTemplates parses the templates needed for the SEO and sharing settings page.
+// It includes header, base layout, and meta-specific content.
+func InitMetaTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("meta_settings", "meta_settings.html")
+}
+
+// MetaSettingsHandler lets tenant admins edit the title and description used in search results
+// and link previews. The og:image comes from the tenant logo.
+func MetaSettingsHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Handle POST request to save the settings
+		if r.Method == http.MethodPost {
+			form := metaForm.Parse(r)
+			settings := models.MetaSettings{
+				TenantID:    t.ID,
+				Title:       form.Get("title"),
+				Description: form.Get("description"),
+			}
+			if !form.Valid() {
+				data := render.BaseTemplateData(r, i18n, map[string]any{"Form": form})
+				w.WriteHeader(http.StatusBadRequest)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			if err := models.SetMetaSettings(r.Context(), settings); err != nil {
+				slog.ErrorContext(r.Context(), "[META] Failed to save settings", "tenant", t.Subdomain, "err", err)
+				data := render.BaseTemplateData(r, i18n, map[string]any{
+					"Error": i18n.T("common.internal_error", lang),
+					"Form":  form,
+				})
+				w.WriteHeader(http.StatusInternalServerError)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			slog.InfoContext(r.Context(), "[META] Meta settings updated", "tenant", t.Subdomain)
+			http.Redirect(w, r, "/settings/meta?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 3: Render the current settings
+		settings, err := models.GetMetaSettings(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[META] Failed to load settings", "tenant", t.Subdomain, "err", err)
+		}
+		form := forms.Empty(r)
+		if settings != nil {
+			form.Set("title", settings.Title)
+			form.Set("description", settings.Description)
+		}
+		extra := map[string]any{"Form": form}
+		if r.URL.Query().Get("saved") != "" {
+			extra["Success"] = i18n.T("meta.saved", lang)
+		}
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// navSetting is a registered nav item together with its visibility for the tenant.
+type navSetting struct {
+	Item    multitenant.NavItem
+	Visible bool
+}
+
+// InitNavigationTemplates parses the templates needed for the navigation settings page.
+// It includes header, base layout, and navigation-specific content.
+func InitNavigationTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("navigation", "navigation.html")
+}
+
+// NavigationSettingsHandler lets tenant admins choose which registered menu items are shown.
+func NavigationSettingsHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Handle POST request to save visibility
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				slog.ErrorContext(r.Context(), "[NAV] Invalid form", "err", err)
+				middleware.Error(w, r, "Bad request", http.StatusBadRequest)
+				return
+			}
+			visible := make(map[string]bool)
+			for _, id := range r.Form["visible"] {
+				visible[id] = true
+			}
+			var hidden []string
+			for _, item := range multitenant.DefaultNav.Items() {
+				if !visible[item.ID] {
+					hidden = append(hidden, item.ID)
+				}
+			}
+			if err := models.SetHiddenNavItems(r.Context(), t.ID, hidden); err != nil {
+				slog.ErrorContext(r.Context(), "[NAV] Failed to save settings", "tenant", t.Subdomain, "err", err)
+				data := render.BaseTemplateData(r, i18n, map[string]any{
+					"Error": i18n.T("common.internal_error", lang),
+				})
+				w.WriteHeader(http.StatusInternalServerError)
+				render.RenderTemplate(w, tmpl, "base", data)
+				return
+			}
+			slog.InfoContext(r.Context(), "[NAV] Navigation settings updated", "tenant", t.Subdomain, "hidden", hidden)
+			http.Redirect(w, r, "/settings/navigation?saved=1", http.StatusSeeOther)
+			return
+		}
+
+		// Step 3: Render the current settings
+		hidden, err := models.GetHiddenNavItems(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[NAV] Failed to load settings", "tenant", t.Subdomain, "err", err)
+		}
+		var settings []navSetting
+		for _, item := range multitenant.DefaultNav.Items() {
+			settings = append(settings, navSetting{Item: item, Visible: !hidden[item.ID]})
+		}
+		extra := map[string]any{"Items": settings}
+		if r.URL.Query().Get("saved") != "" {
+			extra["Success"] = i18n.T("nav.saved", lang)
+		}
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
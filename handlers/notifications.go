@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Notifications shown by the notification menu and by the /notifications page.
+const (
+	notificationMenuLimit = 10
+	notificationPageLimit = 50
+)
+
+// InitNotificationTemplates parses the templates needed for the notifications page.
+// It includes header, base layout, and the notification list also served to the menu.
+func InitNotificationTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("notifications", "notifications.html")
+}
+
+// renderNotifications renders the notifications of the user: the whole page, or only the list for
+// htmx requests, e.g. the notification menu (?menu=1) loading it or an action swapping it.
+func renderNotifications(w http.ResponseWriter, r *http.Request, i18n *i18n.I18n, tmpl *render.Page) {
+	t := middleware.FromContext(r.Context())
+	user := middleware.CurrentUser(r)
+	menu := r.FormValue("menu") != ""
+	limit := notificationPageLimit
+	if menu {
+		limit = notificationMenuLimit
+	}
+	extra := map[string]any{"Menu": menu}
+	list, err := models.ListNotifications(r.Context(), t.ID, user.ID, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[NOTIFY] Failed to list notifications", "user_id", user.ID, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		extra["Error"] = i18n.T("common.internal_error", middleware.LangFromContext(r.Context()))
+	}
+	unread := 0
+	for _, n := range list {
+		if n.Unread() {
+			unread++
+		}
+	}
+	extra["Notifications"], extra["Unread"] = list, unread
+	w.Header().Set("Cache-Control", "no-store")
+	render.Partial(w, r, tmpl, "notification_list", render.BaseTemplateData(r, i18n, extra))
+}
+
+// NotificationsHandler lists the notifications of the user at GET /notifications, newest first.
+func NotificationsHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if middleware.FromContext(r.Context()) == nil || middleware.CurrentUser(r) == nil {
+			http.NotFound(w, r)
+			return
+		}
+		renderNotifications(w, r, i18n, tmpl)
+	}
+}
+
+// OpenNotificationHandler marks a notification read and follows its link, at GET /notifications/{id}.
+func OpenNotificationHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Retrieve tenant, user and notification
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if t == nil || user == nil || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		n, err := models.GetNotification(r.Context(), t.ID, user.ID, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[NOTIFY] Failed to load notification", "id", id, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if n == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Mark it read and follow its link, or go back to the list without one
+		if _, err := models.MarkNotificationsRead(r.Context(), t.ID, user.ID, id); err != nil {
+			slog.ErrorContext(r.Context(), "[NOTIFY] Failed to mark notification read", "id", id, "err", err)
+		}
+		target := n.URL
+		if target == "" {
+			target = "/notifications"
+		}
+		http.Redirect(w, r, middleware.LangPath(r.Context(), target), http.StatusSeeOther)
+	}
+}
+
+// NotificationReadHandler marks the notification of the id form value read at POST
+// /notifications/read, or every notification without one.
+func NotificationReadHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return notificationAction(i18n, tmpl, "read", models.MarkNotificationsRead)
+}
+
+// NotificationDismissHandler hides the notification of the id form value at POST
+// /notifications/dismiss, or every notification without one.
+func NotificationDismissHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return notificationAction(i18n, tmpl, "dismiss", models.DismissNotifications)
+}
+
+// notificationAction applies apply to the notification of the id form value, then renders the list
+// for htmx requests and redirects to /notifications otherwise.
+func notificationAction(i18n *i18n.I18n, tmpl *render.Page, name string,
+	apply func(ctx context.Context, tenantID, userID, id int64) (int64, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Retrieve tenant and user from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Parse the notification, none for all of them
+		var id int64
+		if v := r.FormValue("id"); v != "" {
+			var err error
+			if id, err = strconv.ParseInt(v, 10, 64); err != nil || id <= 0 {
+				middleware.Error(w, r, "Invalid notification", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Step 3: Apply the action
+		n, err := apply(r.Context(), t.ID, user.ID, id)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[NOTIFY] Failed to update notifications", "action", name, "id", id, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		slog.DebugContext(r.Context(), "[NOTIFY] Notifications updated", "action", name, "id", id, "count", n)
+
+		// Step 4: Show the updated list
+		if render.IsPartial(r) {
+			renderNotifications(w, r, i18n, tmpl)
+			return
+		}
+		http.Redirect(w, r, middleware.LangPath(r.Context(), "/notifications"), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/openapi"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+)
+
+// openapiDescription introduces the tenant scoping of the API in the OpenAPI document.
+const openapiDescription = `Tenants are resolved from the host: operations scoped "tenant" (x-tenant-scope) act on the ` +
+	`tenant of https://<tenant>.<domain> or of its custom domain, operations scoped "root" are only served on the ` +
+	`root domain. Access tokens are only valid on the tenant that issued them. Errors answer RFC 7807 ` +
+	`application/problem+json with a stable code and the detail in the request language.`
+
+// apiErrors returns the error responses shared by the API operations plus the given ones.
+func apiErrors(more map[int]string) map[int]openapi.Response {
+	rs := map[int]openapi.Response{
+		http.StatusNotAcceptable:       {Description: "The Accept header excludes application/json"},
+		http.StatusTooManyRequests:     {Description: "Rate limited; retry after the Retry-After header"},
+		http.StatusInternalServerError: {Description: "Internal error; quote the support code"},
+	}
+	for code, desc := range more {
+		rs[code] = openapi.Response{Description: desc}
+	}
+	return rs
+}
+
+// apiOp returns op with the shared error responses and the given success response.
+func apiOp(op openapi.Operation, status int, desc string, body any, errs map[int]string) openapi.Operation {
+	if body != nil {
+		errs[http.StatusBadRequest] = "Invalid body or fields; code names the problem"
+		errs[http.StatusUnsupportedMediaType] = "The body is neither JSON nor a form"
+	}
+	op.Responses = apiErrors(errs)
+	op.Responses[status] = openapi.Response{Description: desc, Body: body}
+	return op
+}
+
+// The operations of the API routes registered by RegisterAPIRoutes.
+var (
+	apiEnrollOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/enroll", ID: "enroll", Tags: []string{"enrollment"},
+		Summary:     "Sign up a new tenant",
+		Description: "Mails a verification link; the tenant is created once it is verified.",
+		Scope:       openapi.ScopeRoot, Request: enrollInput{},
+	}, http.StatusAccepted, "Verification link sent", apiEnvelope[apiEnrollment]{}, map[int]string{
+		http.StatusForbidden:       "Challenged: send the solved challenge as challenge",
+		http.StatusConflict:        "The email, name or subdomain is taken",
+		http.StatusTooManyRequests: "Too many attempts from this address",
+	})
+	apiVerifyOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/enroll/verify", ID: "verifyEnrollment", Tags: []string{"enrollment"},
+		Summary: "Create the tenant of a verification token",
+		Scope:   openapi.ScopeRoot, Request: apiTokenInput{},
+	}, http.StatusCreated, "Tenant created", apiEnvelope[apiTenant]{}, map[int]string{
+		http.StatusConflict: "Already verified, or the subdomain was taken meanwhile",
+		http.StatusGone:     "The token was already used",
+	})
+	apiRegisterOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/register", ID: "register", Tags: []string{"registration"},
+		Summary:     "Sign up as a member of the tenant",
+		Description: "Mails a confirmation link. Tenants restricting signups require the token of a signup link.",
+		Scope:       openapi.ScopeTenant, Request: registerInput{},
+	}, http.StatusAccepted, "Confirmation link sent", apiEnvelope[apiStatus]{}, map[int]string{
+		http.StatusForbidden:       "Email domain not allowed, member limit reached or challenged",
+		http.StatusConflict:        "The email already has an account on the tenant",
+		http.StatusTooManyRequests: "Too many attempts from this address",
+	})
+	apiConfirmOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/confirm", ID: "confirmRegistration", Tags: []string{"registration"},
+		Summary: "Create the member of a confirmation token",
+		Scope:   openapi.ScopeTenant, Request: apiTokenInput{},
+	}, http.StatusCreated, "Member created; pending while an admin must approve them", apiEnvelope[apiMember]{}, map[int]string{
+		http.StatusForbidden: "Member limit reached",
+		http.StatusNotFound:  "Unknown or expired token",
+		http.StatusConflict:  "Already confirmed",
+	})
+	apiLoginOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/login", ID: "login", Tags: []string{"auth"},
+		Summary:     "Exchange credentials for an access token",
+		Description: "The token is bound to a new session and valid on this tenant only.",
+		Scope:       openapi.ScopeTenant, Request: apiLoginInput{},
+	}, http.StatusOK, "Access token", apiEnvelope[apiToken]{}, map[int]string{
+		http.StatusUnauthorized:    "Invalid credentials",
+		http.StatusForbidden:       "Account deactivated, pending approval or challenged",
+		http.StatusTooManyRequests: "Too many failed attempts from this address or on this account",
+	})
+	apiLogoutOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/logout", ID: "logout", Tags: []string{"auth"},
+		Summary: "End the session of the access token",
+		Scope:   openapi.ScopeTenant, Security: []string{openapi.AuthBearer},
+	}, http.StatusNoContent, "Session ended; the token is revoked", nil, map[int]string{
+		http.StatusUnauthorized: "Missing, invalid or revoked access token",
+	})
+	apiMeOp = apiOp(openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/me", ID: "me", Tags: []string{"auth"},
+		Summary: "The user of the access token",
+		Scope:   openapi.ScopeTenant, Security: []string{openapi.AuthBearer},
+	}, http.StatusOK, "Current user", apiEnvelope[apiUser]{}, map[int]string{
+		http.StatusUnauthorized: "Missing, invalid or revoked access token",
+	})
+	apiFeaturesOp = apiOp(openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/features", ID: "features", Tags: []string{"features"},
+		Summary:     "The feature flags of the tenant",
+		Description: "With an access token, flags rolled out by user are evaluated for its user.",
+		Scope:       openapi.ScopeTenant,
+	}, http.StatusOK, "Flag states by name", apiEnvelope[apiFeatures]{}, map[int]string{
+		http.StatusNotFound: "No tenant on this host",
+	})
+	apiMembersOp = apiOp(openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/members", ID: "listMembers", Tags: []string{"members"},
+		Summary:     "The members of the tenant",
+		Description: "For tenant admins. Sorts: email, name, role and joined (default).",
+		Scope:       openapi.ScopeTenant, Security: []string{openapi.AuthBearer},
+		Query: pageParams(models.MemberList,
+			openapi.Parameter{Name: "q", Type: "string", Description: "Part of the email or name"},
+			openapi.Parameter{Name: "role", Type: "string", Description: "Role name"},
+			openapi.Parameter{Name: "status", Type: "string", Description: "active, inactive or pending"}),
+	}, http.StatusOK, "A page of members", pagination.Envelope[apiMemberItem]{}, map[int]string{
+		http.StatusBadRequest:   "Invalid limit, offset or sort",
+		http.StatusUnauthorized: "Missing, invalid or revoked access token",
+		http.StatusForbidden:    "The user is not a tenant admin",
+	})
+	apiAuditOp = apiOp(openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/audit", ID: "listAuditEntries", Tags: []string{"audit"},
+		Summary:     "The audit log of the tenant, newest first",
+		Description: "For tenant admins. Pass next_cursor as ?cursor= to read older entries.",
+		Scope:       openapi.ScopeTenant, Security: []string{openapi.AuthBearer},
+		Query: pageParams(models.AuditList,
+			openapi.Parameter{Name: "action", Type: "string", Description: "Action, or family of actions without a dot, e.g. membership"},
+			openapi.Parameter{Name: "user", Type: "string", Description: "User ID or email"}),
+	}, http.StatusOK, "A page of audit entries", pagination.Envelope[apiAuditItem]{}, map[int]string{
+		http.StatusBadRequest:   "Invalid limit or cursor",
+		http.StatusUnauthorized: "Missing, invalid or revoked access token",
+		http.StatusForbidden:    "The user is not a tenant admin",
+	})
+	apiSearchOp = apiOp(openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/search", ID: "search", Tags: []string{"search"},
+		Summary:     "Search the data of the tenant",
+		Description: "Results are ranked best first and limited to the documents the role of the user may find.",
+		Scope:       openapi.ScopeTenant, Security: []string{openapi.AuthBearer},
+		Query: []openapi.Parameter{
+			{Name: "q", Type: "string", Description: "Words searched, matched as prefixes"},
+			{Name: "type", Type: "string", Description: "Type of the documents searched, e.g. member"},
+			{Name: "limit", Type: "integer", Description: "Page size, up to 50"},
+			{Name: "offset", Type: "integer", Description: "Results skipped"},
+		},
+	}, http.StatusOK, "A page of results", pagination.Envelope[apiSearchResult]{}, map[int]string{
+		http.StatusBadRequest:         "Missing q, or invalid limit or offset",
+		http.StatusUnauthorized:       "Missing, invalid or revoked access token",
+		http.StatusServiceUnavailable: "Search is turned off",
+	})
+	apiForgotOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/password/forgot", ID: "forgotPassword", Tags: []string{"password"},
+		Summary:     "Mail a password reset link",
+		Description: "Answers 202 whether or not the email belongs to an account.",
+		Scope:       openapi.ScopeTenant, Request: apiForgotInput{},
+	}, http.StatusAccepted, "Reset link sent if the account exists", apiEnvelope[apiStatus]{}, map[int]string{
+		http.StatusForbidden: "Challenged by the signup screen",
+	})
+	apiResetOp = apiOp(openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/password/reset", ID: "resetPassword", Tags: []string{"password"},
+		Summary:     "Set a new password with a reset token",
+		Description: "Ends every session of the user, revoking their access tokens.",
+		Scope:       openapi.ScopeTenant, Request: apiResetInput{},
+	}, http.StatusOK, "Password changed", apiEnvelope[apiStatus]{}, map[int]string{
+		http.StatusNotFound: "No tenant on this host",
+	})
+)
+
+// WhoAmIOperation describes GET /api/v1/whoami, served with APIWhoAmIHandler behind middleware.APIKeyAuth.
+var WhoAmIOperation = openapi.Operation{
+	Method: http.MethodGet, Path: "/api/v1/whoami", ID: "whoami", Tags: []string{"api-keys"},
+	Summary: "The tenant and key behind the API key",
+	Scope:   openapi.ScopeAny, Security: []string{openapi.AuthAPIKey},
+	Responses: map[int]openapi.Response{
+		http.StatusOK:              {Description: "Key details", Body: apiKeyInfo{}},
+		http.StatusUnauthorized:    {Description: "Missing or invalid API key"},
+		http.StatusTooManyRequests: {Description: "Rate or daily quota of the key exceeded"},
+	},
+}
+
+// ProvisionOperation describes POST /api/v1/tenants, served with ProvisionHandler.
+var ProvisionOperation = openapi.Operation{
+	Method: http.MethodPost, Path: "/api/v1/tenants", ID: "provisionTenant", Tags: []string{"provisioning"},
+	Summary:     "Create a tenant and its owner",
+	Description: "For external systems such as billing. Unavailable (404) while TENANT_PROVISION_TOKEN is unset.",
+	Scope:       openapi.ScopeRoot, Security: []string{openapi.AuthProvision}, Request: provisionBody{},
+	Responses: map[int]openapi.Response{
+		http.StatusCreated:      {Description: "Tenant created", Body: provisionedTenant{}},
+		http.StatusBadRequest:   {Description: "Invalid body, name, email, subdomain or plan"},
+		http.StatusUnauthorized: {Description: "Invalid provisioning token"},
+		http.StatusConflict:     {Description: "The subdomain or owner email is taken"},
+	},
+}
+
+// MaintenanceStatusOperation and MaintenanceSwitchOperation describe /api/v1/maintenance, served
+// with MaintenanceAPIHandler.
+var (
+	MaintenanceStatusOperation = openapi.Operation{
+		Method: http.MethodGet, Path: "/api/v1/maintenance", ID: "maintenanceStatus", Tags: []string{"maintenance"},
+		Summary:     "The maintenance windows in progress",
+		Description: "Unavailable (404) while TENANT_PROVISION_TOKEN is unset.",
+		Scope:       openapi.ScopeRoot, Security: []string{openapi.AuthProvision},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Windows of the platform and tenants", Body: maintenanceStatus{}},
+			http.StatusUnauthorized: {Description: "Invalid provisioning token"},
+		},
+	}
+	MaintenanceSwitchOperation = openapi.Operation{
+		Method: http.MethodPost, Path: "/api/v1/maintenance", ID: "maintenanceSwitch", Tags: []string{"maintenance"},
+		Summary:     "Put the platform or a tenant in maintenance, or end it",
+		Description: "Windows set by MAINTENANCE_MODE or MAINTENANCE_TENANTS stay until the setting changes.",
+		Scope:       openapi.ScopeRoot, Security: []string{openapi.AuthProvision}, Request: maintenanceBody{},
+		Responses: map[int]openapi.Response{
+			http.StatusOK:           {Description: "Windows of the platform and tenants", Body: maintenanceStatus{}},
+			http.StatusBadRequest:   {Description: "Invalid body"},
+			http.StatusUnauthorized: {Description: "Invalid provisioning token"},
+			http.StatusNotFound:     {Description: "Unknown tenant"},
+		},
+	}
+)
+
+// OpenAPIHandler serves the OpenAPI 3 document of the operations in openapi.Default at
+// GET /api/openapi.json, for generating client SDKs.
+func OpenAPIHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := "tenkit API"
+		if cfg.Brand.Name != "" {
+			title = cfg.Brand.Name + " API"
+		}
+		doc := openapi.Default.Document(openapi.Info{
+			Title:       title,
+			Version:     "1",
+			Description: openapiDescription,
+			Scheme:      middleware.Scheme(r),
+			Domain:      cfg.Domain,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(doc)
+	}
+}
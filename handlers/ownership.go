@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/search"
+)
+
+// InitOwnershipTemplates parses the templates needed for the ownership transfer page.
+func InitOwnershipTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("ownership", "ownership.html")
+}
+
+// OwnershipHandler lets a member accept the tenant an owner offered them from /admin/members.
+// GET shows the offer of ?token= to the member it was made to, logged in; POST accepts it, making
+// them owner and the sender an admin.
+func OwnershipHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		token := r.FormValue("token")
+		renderMessage := func(status int, msg string, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			extra["Message"] = msg
+			w.WriteHeader(status)
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 1: Load the offer
+		o, err := models.GetOwnershipTransfer(r.Context(), t.ID, token)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[OWNERSHIP] Failed to load transfer", "tenant", t.Subdomain, "err", err)
+			renderMessage(http.StatusInternalServerError, i18n.T("common.internal_error", lang), nil)
+			return
+		}
+		if o == nil {
+			renderMessage(http.StatusNotFound, i18n.T("ownership.error.invalid", lang), nil)
+			return
+		}
+
+		// Step 2: Only the recipient, logged in, may answer
+		if user == nil {
+			renderMessage(http.StatusOK, i18n.T("ownership.login", lang, o.ToEmail), map[string]any{"Login": true})
+			return
+		}
+		if user.ID != o.ToUserID {
+			slog.WarnContext(r.Context(), "[OWNERSHIP] Transfer opened by another user", "tenant", t.Subdomain, "user_id", user.ID)
+			renderMessage(http.StatusForbidden, i18n.T("ownership.error.other_user", lang, o.ToEmail), nil)
+			return
+		}
+
+		// Step 3: On GET, ask to accept
+		if r.Method == http.MethodGet {
+			renderMessage(http.StatusOK, i18n.T("ownership.prompt", lang, o.FromEmail, t.Name), map[string]any{"Token": token})
+			return
+		}
+
+		// Step 4: Accept, unless the offer was used, withdrawn or the sender is no longer an owner
+		o, err = models.AcceptOwnershipTransfer(r.Context(), t.ID, user.ID, token, cfg.Roles.Owner, cfg.Roles.Admin)
+		if errors.Is(err, models.ErrTransferInvalid) {
+			renderMessage(http.StatusConflict, i18n.T("ownership.error.invalid", lang), nil)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[OWNERSHIP] Failed to accept transfer", "tenant", t.Subdomain, "user_id", user.ID, "err", err)
+			renderMessage(http.StatusInternalServerError, i18n.T("common.internal_error", lang), nil)
+			return
+		}
+
+		// Step 5: Record the change of both roles
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   "ownership.transferred",
+			IP:       middleware.ClientIP(r),
+			Details:  strconv.FormatInt(o.FromUserID, 10) + " " + o.FromEmail + " -> " + strconv.FormatInt(user.ID, 10) + " " + user.Email,
+		})
+		for _, c := range []struct {
+			id             int64
+			role, previous string
+		}{{user.ID, cfg.Roles.Owner, user.Role}, {o.FromUserID, cfg.Roles.Admin, cfg.Roles.Owner}} {
+			search.TouchMember(r.Context(), t.ID, c.id)
+			events.Publish(r.Context(), events.Event{
+				Name:     events.MemberRoleChanged,
+				TenantID: t.ID,
+				UserID:   c.id,
+				Data:     map[string]any{"role": c.role, "previous_role": c.previous, "changed_by": user.Email},
+			})
+		}
+		slog.InfoContext(r.Context(), "[OWNERSHIP] Ownership transferred", "tenant", t.Subdomain, "from", o.FromUserID, "to", user.ID)
+		renderMessage(http.StatusOK, i18n.T("ownership.success", lang, t.Name), nil)
+	}
+}
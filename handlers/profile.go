@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/search"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+)
+
+// maxNameLength bounds display names, in characters.
+const maxNameLength = 100
+
+// avatarRules bound uploaded avatars like logos: raster images up to 1 MB.
+var avatarRules = storage.ImageRules
+
+// InitProfileTemplates parses the templates needed for the profile page.
+// It includes header, base layout, and profile-specific content.
+func InitProfileTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("profile", "profile.html")
+}
+
+// ProfileHandler lets members edit their profile at /account/profile.
+// POST actions: "profile" saves the name, language and time zone, "avatar" uploads an avatar to
+// store and "remove_avatar" deletes it. Operators impersonating the user can only look.
+func ProfileHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and user from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			langs := make([]string, 0, len(i18n.Translations()))
+			for l := range i18n.Translations() {
+				langs = append(langs, l)
+			}
+			slices.Sort(langs)
+			extra["Langs"] = langs
+			extra["TenantTimezone"] = t.Timezone
+			extra["MaxAvatarKB"] = avatarRules.MaxSize >> 10
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the profile
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("profile.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+		if user.ImpersonatorID != 0 {
+			renderPage(http.StatusForbidden, map[string]any{"Error": i18n.T("profile.error.impersonating", lang)})
+			return
+		}
+
+		// Step 3: Parse the form data; CSRFMiddleware already parsed multipart uploads
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[PROFILE] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.invalid_form", lang)})
+			return
+		}
+
+		var details string
+		switch action := r.FormValue("action"); action {
+		case "profile":
+			// Step 4a: Save the name, language and time zone
+			p := models.Profile{
+				Name:     strings.Join(strings.Fields(r.FormValue("name")), " "),
+				Lang:     r.FormValue("lang"),
+				Timezone: strings.TrimSpace(r.FormValue("timezone")),
+			}
+			if utf8.RuneCountInString(p.Name) > maxNameLength {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.name", lang, maxNameLength)})
+				return
+			}
+			if _, ok := i18n.Translations()[p.Lang]; p.Lang != "" && !ok {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.invalid_form", lang)})
+				return
+			}
+			if _, err := time.LoadLocation(p.Timezone); p.Timezone != "" && (err != nil || p.Timezone == "Local") {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.timezone", lang)})
+				return
+			}
+			if err := models.UpdateProfile(r.Context(), user.ID, p); err != nil {
+				slog.ErrorContext(r.Context(), "[PROFILE] Failed to save profile", "user_id", user.ID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			// A language picked on this browser beats the stored one, so follow the new choice
+			if p.Lang != user.Lang {
+				if p.Lang == "" {
+					cookies.Clear(w, r, cookies.Lang(cfg))
+				} else {
+					cookies.SetSigned(w, r, cookies.Lang(cfg), p.Lang, 0)
+				}
+			}
+			details = strings.TrimSpace(fmt.Sprintf("lang=%s timezone=%s", p.Lang, p.Timezone))
+
+		case "avatar":
+			// Step 4b: Check the upload by size and content, not by its declared type
+			file, header, err := r.FormFile("avatar")
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.invalid_avatar", lang, avatarRules.MaxSize>>10)})
+				return
+			}
+			defer file.Close()
+			var upload *storage.Upload
+			if header.Size > avatarRules.MaxSize {
+				err = storage.ErrTooLarge
+			} else {
+				upload, err = storage.ReadUpload(file, avatarRules)
+			}
+			if err != nil {
+				slog.InfoContext(r.Context(), "[PROFILE] Rejected avatar", "user_id", user.ID, "err", err)
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.invalid_avatar", lang, avatarRules.MaxSize>>10)})
+				return
+			}
+
+			// Store the new avatar, then drop the previous one
+			if err := limits.Check(r.Context(), limits.Storage, int64(len(upload.Data))); err != nil {
+				if msg := limitMessage(i18n, lang, err); msg != "" {
+					slog.InfoContext(r.Context(), "[PROFILE] Storage limit reached", "tenant", t.Subdomain, "err", err)
+					renderPage(http.StatusForbidden, map[string]any{"Error": msg})
+					return
+				}
+				slog.ErrorContext(r.Context(), "[PROFILE] Failed to check storage limit", "tenant", t.Subdomain, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			key := storage.AvatarKey(t.ID, user.ID, upload.Ext, time.Now())
+			if err := store.Put(r.Context(), key, bytes.NewReader(upload.Data), upload.ContentType); err != nil {
+				slog.ErrorContext(r.Context(), "[PROFILE] Failed to store avatar", "user_id", user.ID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			if err := models.SetUserAvatar(r.Context(), user.ID, key); err != nil {
+				slog.ErrorContext(r.Context(), "[PROFILE] Failed to save avatar", "user_id", user.ID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			deleteAvatar(r, store, user.AvatarKey)
+			details = "avatar " + upload.ContentType + " " + strconv.Itoa(len(upload.Data))
+
+		case "remove_avatar":
+			// Step 4c: Remove the avatar
+			if err := models.SetUserAvatar(r.Context(), user.ID, ""); err != nil {
+				slog.ErrorContext(r.Context(), "[PROFILE] Failed to remove avatar", "user_id", user.ID, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			deleteAvatar(r, store, user.AvatarKey)
+			details = "avatar removed"
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("profile.error.invalid_form", lang)})
+			return
+		}
+
+		// Step 5: Record the change
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   "profile.updated",
+			IP:       middleware.ClientIP(r),
+			Details:  details,
+		})
+		search.TouchMember(r.Context(), t.ID, user.ID)
+		slog.InfoContext(r.Context(), "[PROFILE] Profile updated", "user_id", user.ID, "details", details)
+		http.Redirect(w, r, "/account/profile?saved=1", http.StatusSeeOther)
+	}
+}
+
+// deleteAvatar removes a replaced avatar from storage; failures only leave an orphaned file behind.
+func deleteAvatar(r *http.Request, store storage.Store, key string) {
+	if key == "" {
+		return
+	}
+	if err := store.Delete(r.Context(), key); err != nil {
+		slog.WarnContext(r.Context(), "[PROFILE] Failed to delete previous avatar", "key", key, "err", err)
+	}
+}
+
+// AvatarHandler serves the avatar of the member named by the {id} path value to the other members
+// of the tenant, at /avatars/{id}. Like logos, requests carrying the version of the current upload
+// (?v=) may be cached indefinitely.
+func AvatarHandler(store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := middleware.FromContext(r.Context())
+		userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if t == nil || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		key, err := models.GetUserAvatarKey(r.Context(), t.ID, userID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[PROFILE] Failed to load avatar", "user_id", userID, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if key == "" {
+			http.NotFound(w, r)
+			return
+		}
+		version := models.AvatarVersion(key)
+		etag := fmt.Sprintf(`"avatar-%d-%s"`, userID, version)
+		w.Header().Set("ETag", etag)
+		if r.URL.Query().Get("v") == version {
+			w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "private, max-age=300")
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		body, err := store.Get(r.Context(), key)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[PROFILE] Failed to read avatar", "key", key, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+		w.Header().Set("Content-Type", storage.ContentTypeOf(key))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := io.Copy(w, body); err != nil {
+			slog.ErrorContext(r.Context(), "[PROFILE] Failed to stream avatar", "user_id", userID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// provisionBody is the JSON accepted by ProvisionHandler.
+type provisionBody struct {
+	Name          string `json:"name"`
+	Subdomain     string `json:"subdomain"`
+	OwnerEmail    string `json:"owner_email"`
+	OwnerPassword string `json:"owner_password"`
+	Plan          string `json:"plan,omitempty"`
+}
+
+// provisionedTenant is the answer of POST /api/v1/tenants.
+type provisionedTenant struct {
+	ID        int64  `json:"id"`
+	Subdomain string `json:"subdomain"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+}
+
+// ProvisionHandler creates tenants from external systems at POST /api/v1/tenants on the root domain.
+// Callers authenticate with "Authorization: Bearer <TENANT_PROVISION_TOKEN>"; the endpoint is
+// unavailable while no token is configured. It answers 201 with the tenant, 400 for invalid
+// requests and 409 when the subdomain or owner email is taken.
+func ProvisionHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Authenticate the caller on the root domain
+		if !platformTokenValid(cfg, w, r) {
+			return
+		}
+
+		// Step 2: Decode the request
+		var body provisionBody
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+			middleware.Error(w, r, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.Plan != "" && limits.GetPlan(body.Plan) == nil {
+			middleware.Error(w, r, "Unknown plan", http.StatusBadRequest)
+			return
+		}
+
+		// Step 3: Create the tenant with the checks of /enroll
+		t, err := multitenant.ProvisionTenant(r.Context(), multitenant.ProvisionRequest{
+			Config:        cfg,
+			Name:          body.Name,
+			Subdomain:     body.Subdomain,
+			OwnerEmail:    body.OwnerEmail,
+			OwnerPassword: body.OwnerPassword,
+			Plan:          body.Plan,
+		})
+		switch {
+		case errors.Is(err, multitenant.ErrTenantExists):
+			middleware.Error(w, r, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, multitenant.ErrInvalidName), errors.Is(err, multitenant.ErrInvalidEmail), errors.Is(err, multitenant.ErrInvalidSubdomain):
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "[PROVISION] Failed to create tenant", "subdomain", body.Subdomain, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Step 4: Record and answer with the new tenant
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			Action:   "tenant.provisioned",
+			IP:       middleware.ClientIP(r),
+			Details:  t.Subdomain + " owner " + strings.ToLower(strings.TrimSpace(body.OwnerEmail)),
+		})
+		slog.InfoContext(r.Context(), "[PROVISION] Tenant created", "subdomain", t.Subdomain, "tenant_id", t.ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(provisionedTenant{ID: t.ID, Subdomain: t.Subdomain, Name: t.Name, URL: urls.Subdomain(cfg, t.Subdomain, "/", nil)})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/qr"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// qrMaxData bounds the payload accepted by /qr.png; otpauth and invite URLs are far shorter.
+const qrMaxData = 1024
+
+// QRImageURL returns a signed /qr.png URL rendering data for the current tenant.
+// Use it where inline SVG is not an option, such as emails.
+func QRImageURL(cfg *multitenant.Config, r *http.Request, data string) string {
+	q := url.Values{}
+	q.Set("d", data)
+	q.Set("s", utils.SignQR(tokenAudience(cfg, r), data))
+	return "/qr.png?" + q.Encode()
+}
+
+// QRHandler serves /qr.png for URLs produced by QRImageURL. The signature binds the
+// payload to the tenant, so a link issued on one tenant does not work on another.
+func QRHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Check the payload was signed for this tenant
+		data := r.URL.Query().Get("d")
+		if data == "" || len(data) > qrMaxData || !utils.VerifyQR(tokenAudience(cfg, r), data, r.URL.Query().Get("s")) {
+			slog.InfoContext(r.Context(), "[QR] Invalid QR request")
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Encode and stream the image
+		code, err := qr.Encode(data, qr.Medium)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[QR] Failed to encode", "err", err)
+			middleware.Error(w, r, "Bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		if err := code.WritePNG(w, 8, 4); err != nil {
+			slog.ErrorContext(r.Context(), "[QR] Failed to write image", "err", err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/realtime"
+)
+
+// eventStreamLifetime bounds a stream: the browser then reconnects through the session checks, so
+// that logging out or losing the membership also ends the live updates.
+const eventStreamLifetime = 10 * time.Minute
+
+// EventStreamHandler streams the live updates of the tenant to the signed-in member at GET /events,
+// as Server-Sent Events. Clients resume with the Last-Event-ID header, or the last_event_id query
+// parameter for clients that cannot set headers.
+func EventStreamHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Retrieve tenant, user and hub
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		hub := realtime.Current()
+		if hub == nil {
+			middleware.Error(w, r, "Live updates are disabled", http.StatusServiceUnavailable)
+			return
+		}
+		rc := http.NewResponseController(w)
+		if err := rc.Flush(); err != nil {
+			slog.ErrorContext(r.Context(), "[REALTIME] Response writer cannot stream", "err", err)
+			middleware.Error(w, r, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		_ = rc.SetWriteDeadline(time.Time{})
+
+		// Step 2: Subscribe, picking up the messages missed since the last connection
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		sub, missed, ok := hub.Subscribe(t.ID, user.ID, user.Role, lastID)
+		defer sub.Close()
+		slog.DebugContext(r.Context(), "[REALTIME] Stream opened", "tenant", t.Subdomain, "user_id", user.ID,
+			"last_event_id", lastID, "missed", len(missed), "resync", !ok)
+
+		// Step 3: Send the headers, the reconnection delay and the missed messages
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-store")
+		h.Set("X-Accel-Buffering", "no") // Tell nginx not to buffer the stream
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", cfg.Realtime.Retry.Milliseconds())
+		for _, m := range missed {
+			writeEvent(w, m)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		// Step 4: Stream messages and heartbeats until the client leaves or the stream expires
+		heartbeat := time.NewTicker(max(cfg.Realtime.Heartbeat, time.Second))
+		defer heartbeat.Stop()
+		expire := time.NewTimer(eventStreamLifetime)
+		defer expire.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-expire.C:
+				return
+			case m, open := <-sub.C:
+				if !open {
+					return // Dropped by the hub for lagging behind: the client reconnects and catches up
+				}
+				writeEvent(w, m)
+			case <-heartbeat.C:
+				io.WriteString(w, ": ping\n\n")
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a message in the text/event-stream format. An empty ID resets the last event ID
+// of the client.
+func writeEvent(w io.Writer, m realtime.Message) {
+	var b strings.Builder
+	b.WriteString("id: " + m.ID + "\n")
+	b.WriteString("event: " + m.Event + "\n")
+	for _, line := range strings.Split(string(m.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	io.WriteString(w, b.String())
+}
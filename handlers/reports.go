@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/jobs"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// ReportFunc writes a report for the job's tenant to w, calling progress with a 0-100 value as it goes.
+type ReportFunc func(ctx context.Context, job *models.ReportJob, w io.Writer, progress func(int)) error
+
+// Report describes a kind of report that can be enqueued.
+type Report struct {
+	Kind        string
+	ContentType string
+	Ext         string
+	Generate    ReportFunc
+}
+
+var (
+	reportsMu sync.RWMutex
+	reports   = map[string]Report{}
+)
+
+// RegisterReport makes a report kind available to EnqueueReportHandler.
+func RegisterReport(rep Report) {
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+	reports[rep.Kind] = rep
+}
+
+func lookupReport(kind string) (Report, bool) {
+	reportsMu.RLock()
+	defer reportsMu.RUnlock()
+	rep, ok := reports[kind]
+	return rep, ok
+}
+
+// jobStatus is the JSON body returned by the job polling endpoint.
+type jobStatus struct {
+	ID          int64  `json:"id"`
+	Kind        string `json:"kind"`
+	Status      string `json:"status"`
+	Progress    int    `json:"progress"`
+	DownloadURL string `json:"download_url,omitempty"`
+	StatusURL   string `json:"status_url"`
+}
+
+// InitReportTemplates parses the templates needed for the reports page.
+// It includes header, base layout, and report-specific content.
+func InitReportTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("reports", "reports.html")
+}
+
+// ReportsPageHandler renders the page from which tenant admins request reports.
+func ReportsPageHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, nil))
+	}
+}
+
+// EnqueueReportHandler starts the report named by the {kind} path value for the current tenant
+// and answers 202 with the job ID and the URL to poll.
+func EnqueueReportHandler(cfg *multitenant.Config, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Resolve tenant, user and report kind
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		rep, ok := lookupReport(r.PathValue("kind"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Record the job and queue it for the background workers
+		id, err := models.CreateReportJob(r.Context(), rep.Kind, t.ID, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[REPORT] Failed to create job", "kind", rep.Kind, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := jobs.Enqueue(r.Context(), t.ID, ReportJobKind, reportPayload{ReportJobID: id}); err != nil {
+			slog.ErrorContext(r.Context(), "[REPORT] Failed to enqueue job", "job_id", id, "kind", rep.Kind, "err", err)
+			if mErr := models.MarkReportFailed(r.Context(), id, err); mErr != nil {
+				slog.ErrorContext(r.Context(), "[REPORT] Failed to record job failure", "job_id", id, "err", mErr)
+			}
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "[REPORT] Job enqueued", "job_id", id, "kind", rep.Kind, "tenant", t.Subdomain)
+
+		// Step 3: Answer with the polling URL
+		status := jobStatus{ID: id, Kind: rep.Kind, Status: models.ReportPending, StatusURL: fmt.Sprintf("/jobs/%d", id)}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", status.StatusURL)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// JobStatusHandler reports progress of the job named by the {id} path value.
+// Only the user who requested the job can see it; a signed download URL is included once ready.
+func JobStatusHandler(cfg *multitenant.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job := loadOwnJob(w, r)
+		if job == nil {
+			return
+		}
+		status := jobStatus{
+			ID:        job.ID,
+			Kind:      job.Kind,
+			Status:    job.Status,
+			Progress:  job.Progress,
+			StatusURL: fmt.Sprintf("/jobs/%d", job.ID),
+		}
+		if job.Status == models.ReportReady {
+			token, err := utils.GenerateReportToken(tokenAudience(cfg, r), job.ID, job.UserID, time.Now().Add(cfg.Export.LinkExpiry))
+			if err == nil {
+				status.DownloadURL = fmt.Sprintf("/jobs/%d/download?token=%s", job.ID, token)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// JobDownloadHandler serves a finished report when the signed link is valid.
+func JobDownloadHandler(cfg *multitenant.Config, store storage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Validate the signed token against the path
+		jobID, userID, ok := utils.ValidateReportToken(r.URL.Query().Get("token"), tokenAudience(cfg, r))
+		if !ok || strconv.FormatInt(jobID, 10) != r.PathValue("id") {
+			slog.InfoContext(r.Context(), "[REPORT] Invalid or expired download token")
+			http.NotFound(w, r)
+			return
+		}
+		job := loadOwnJob(w, r)
+		if job == nil {
+			return
+		}
+		if job.UserID != userID || job.Status != models.ReportReady || !job.StorageKey.Valid {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Stream the stored file
+		body, err := store.Get(r.Context(), job.StorageKey.String)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[REPORT] Failed to read report", "job_id", job.ID, "err", err)
+			http.NotFound(w, r)
+			return
+		}
+		defer body.Close()
+
+		ext := "csv"
+		if rep, ok := lookupReport(job.Kind); ok {
+			ext = rep.Ext
+		}
+		w.Header().Set("Content-Type", job.ContentType.String)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.%s"`, job.Kind, job.ID, ext))
+		w.Header().Set("Cache-Control", "no-store")
+		if _, err := io.Copy(w, body); err != nil {
+			slog.ErrorContext(r.Context(), "[REPORT] Failed to stream report", "job_id", job.ID, "err", err)
+		}
+	}
+}
+
+// loadOwnJob loads the job named by the {id} path value and checks it belongs to the current user and tenant.
+// It writes a 404 and returns nil otherwise.
+func loadOwnJob(w http.ResponseWriter, r *http.Request) *models.ReportJob {
+	user := middleware.CurrentUser(r)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if user == nil || err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	job, err := models.GetReportJob(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[REPORT] Failed to load job", "job_id", id, "err", err)
+	}
+	t := middleware.FromContext(r.Context())
+	if job == nil || job.UserID != user.ID || (t != nil && job.TenantID != t.ID) {
+		http.NotFound(w, r)
+		return nil
+	}
+	return job
+}
+
+// ReportJobKind is the kind of the background jobs generating reports.
+const ReportJobKind = "report"
+
+// reportPayload is the payload of the report jobs.
+type reportPayload struct {
+	ReportJobID int64 `json:"report_job_id"`
+}
+
+// ReportJob returns the kind of job generating the reports enqueued by EnqueueReportHandler into
+// store. A failed report is not retried: its failure is shown to the user, who may request it again.
+func ReportJob(store storage.Store) jobs.Kind {
+	return jobs.Kind{
+		Name:        ReportJobKind,
+		MaxAttempts: 1,
+		Handler: func(ctx context.Context, job *models.Job) error {
+			var p reportPayload
+			if err := job.Decode(&p); err != nil {
+				return jobs.Permanent(err)
+			}
+			report, err := models.GetReportJob(ctx, p.ReportJobID)
+			if err != nil {
+				return err
+			}
+			if report == nil || report.TenantID != job.TenantID {
+				return jobs.Permanent(fmt.Errorf("report job %d not found", p.ReportJobID))
+			}
+			rep, ok := lookupReport(report.Kind)
+			if !ok {
+				err := fmt.Errorf("unknown report kind %q", report.Kind)
+				if mErr := models.MarkReportFailed(ctx, report.ID, err); mErr != nil {
+					slog.ErrorContext(ctx, "[REPORT] Failed to record job failure", "job_id", report.ID, "err", mErr)
+				}
+				return jobs.Permanent(err)
+			}
+			runReport(ctx, store, rep, report.ID)
+			return nil
+		},
+	}
+}
+
+// runReport generates the report and stores the result. ctx carries the ID of the request that
+// enqueued the job, so that the job's log lines can be traced back to it.
+func runReport(ctx context.Context, store storage.Store, rep Report, jobID int64) {
+	fail := func(err error) {
+		slog.ErrorContext(ctx, "[REPORT] Job failed", "job_id", jobID, "kind", rep.Kind, "err", err)
+		if mErr := models.MarkReportFailed(ctx, jobID, err); mErr != nil {
+			slog.ErrorContext(ctx, "[REPORT] Failed to record job failure", "job_id", jobID, "err", mErr)
+		}
+	}
+
+	job, err := models.GetReportJob(ctx, jobID)
+	if err != nil || job == nil {
+		fail(fmt.Errorf("job not found: %v", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	last := -1
+	progress := func(pct int) {
+		if pct == last {
+			return
+		}
+		last = pct
+		if err := models.SetReportProgress(ctx, jobID, pct); err != nil {
+			slog.ErrorContext(ctx, "[REPORT] Failed to record progress", "job_id", jobID, "err", err)
+		}
+	}
+	progress(0)
+	if err := rep.Generate(ctx, job, &buf, progress); err != nil {
+		fail(err)
+		return
+	}
+
+	key := storage.ReportKey(job.TenantID, job.ID, rep.Ext, time.Now())
+	if err := store.Put(ctx, key, &buf, rep.ContentType); err != nil {
+		fail(err)
+		return
+	}
+	if err := models.MarkReportReady(ctx, jobID, key, rep.ContentType); err != nil {
+		fail(err)
+		return
+	}
+	slog.InfoContext(ctx, "[REPORT] Job ready", "job_id", jobID, "kind", rep.Kind)
+}
+
+// MemberReport exports the tenant's members as CSV.
+var MemberReport = Report{
+	Kind:        "members",
+	ContentType: "text/csv",
+	Ext:         "csv",
+	Generate: func(ctx context.Context, job *models.ReportJob, w io.Writer, progress func(int)) error {
+		members, err := models.ListTenantMembers(ctx, job.TenantID)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"user_id", "email", "role", "active", "joined_at"})
+		for i, m := range members {
+			cw.Write([]string{
+				strconv.FormatInt(m.UserID, 10), csvCell(m.Email), m.Role,
+				strconv.FormatBool(m.IsActive), m.JoinedAt.UTC().Format(time.RFC3339),
+			})
+			progress((i + 1) * 100 / len(members))
+		}
+		cw.Flush()
+		return cw.Error()
+	},
+}
+
+// AuditReport exports the tenant's audit log as CSV.
+var AuditReport = Report{
+	Kind:        "audit",
+	ContentType: "text/csv",
+	Ext:         "csv",
+	Generate: func(ctx context.Context, job *models.ReportJob, w io.Writer, progress func(int)) error {
+		entries, err := models.ListAuditEntries(ctx, job.TenantID)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"id", "created_at", "user_id", "action", "ip", "details"})
+		for i, e := range entries {
+			cw.Write([]string{
+				strconv.FormatInt(e.ID, 10), e.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatInt(e.UserID, 10), e.Action, e.IP, csvCell(e.Details),
+			})
+			progress((i + 1) * 100 / len(entries))
+		}
+		cw.Flush()
+		return cw.Error()
+	},
+}
+
+// csvCell neutralises values that spreadsheets would evaluate as formulas.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
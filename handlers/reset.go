@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitForgotTemplates parses the templates needed for the forgot password page.
+// It includes header, base layout, and forgot-specific content.
+func InitForgotTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("forgot", "forgot.html")
+}
+
+// InitResetTemplates parses the templates needed for the reset password page.
+// It includes header, base layout, and reset-specific content.
+func InitResetTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("reset", "reset.html")
+}
+
+// ForgotPasswordHandler handles GET and POST requests for /forgot.
+// The response never reveals whether the email belongs to an account.
+func ForgotPasswordHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Error": i18n.T("reset.error.no_tenant", lang),
+			})
+			w.WriteHeader(http.StatusForbidden)
+			render.Partial(w, r, tmpl, "content", data)
+			return
+		}
+
+		// Step 2: Handle GET request to serve the form
+		if r.Method == http.MethodGet {
+			render.Partial(w, r, tmpl, "content", render.BaseTemplateData(r, i18n, nil))
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[RESET] Invalid form", "err", err)
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Error": i18n.T("reset.error.invalid_form", lang),
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			render.Partial(w, r, tmpl, "content", data)
+			return
+		}
+
+		// Step 4: Mail a reset link if the account exists
+		if fe := requestPasswordReset(cfg, i18n, r, r.FormValue("email")); fe != nil {
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Error": fe.message(i18n, lang),
+			})
+			w.WriteHeader(fe.Status)
+			render.Partial(w, r, tmpl, "content", data)
+			return
+		}
+		data := render.BaseTemplateData(r, i18n, map[string]any{
+			"Success": i18n.T("reset.requested", lang),
+		})
+		render.Partial(w, r, tmpl, "content", data)
+	}
+}
+
+// ResetPasswordHandler handles GET and POST requests for /reset.
+// GET only checks the token; it is consumed when the new password is submitted.
+func ResetPasswordHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant from context
+		t := middleware.FromContext(r.Context())
+		if t == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Handle GET request to serve the form for a usable token
+		if r.Method == http.MethodGet {
+			token := r.URL.Query().Get("token")
+			extra := map[string]any{"Token": token}
+			if !models.PasswordResetValid(r.Context(), token, t.ID) {
+				extra = map[string]any{"Error": i18n.T("reset.error.invalid_token", lang)}
+			}
+			render.Partial(w, r, tmpl, "content", render.BaseTemplateData(r, i18n, extra))
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[RESET] Invalid form", "err", err)
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Error": i18n.T("reset.error.invalid_form", lang),
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			render.Partial(w, r, tmpl, "content", data)
+			return
+		}
+
+		// Step 4: Consume the token and store the new password
+		token := r.FormValue("token")
+		if fe := resetPassword(r, token, r.FormValue("password")); fe != nil {
+			data := render.BaseTemplateData(r, i18n, map[string]any{
+				"Token": token,
+				"Error": fe.message(i18n, lang),
+			})
+			w.WriteHeader(fe.Status)
+			render.Partial(w, r, tmpl, "content", data)
+			return
+		}
+
+		// Step 5: Render success message
+		data := render.BaseTemplateData(r, i18n, map[string]any{
+			"Success": i18n.T("reset.success", lang),
+		})
+		render.Partial(w, r, tmpl, "content", data)
+	}
+}
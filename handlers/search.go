@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+	"github.com/pandamasta/tenkit/multitenant/search"
+)
+
+// searchList pages through search results, best first. Filters: "q" is the text searched, "type"
+// restricts the results to one source.
+var searchList = &pagination.List{
+	Limit:    20,
+	MaxLimit: 50,
+	Filters:  []string{"q", "type"},
+}
+
+// InitSearchTemplates parses the templates needed for the search page.
+// It includes header, base layout, and search-specific content.
+func InitSearchTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("search", "search.html")
+}
+
+// runSearch returns the page of results asked for by req, among the documents of the tenant that
+// user may find.
+func runSearch(cfg *multitenant.Config, r *http.Request, t *multitenant.Tenant, user *models.User, req pagination.Request) ([]search.Result, pagination.Page, error) {
+	q := search.Query{
+		TenantID: t.ID,
+		Text:     req.Filter("q"),
+		Limit:    req.Limit + 1, // One more to detect a following page, see pagination.Trim
+		Offset:   req.Offset,
+	}
+	if typ := req.Filter("type"); typ != "" {
+		q.Types = []string{typ}
+	}
+	for _, role := range cfg.Roles.Roles {
+		if cfg.Roles.Allows(user.Role, role.Name) {
+			q.Roles = append(q.Roles, role.Name)
+		}
+	}
+	results, err := search.Search(r.Context(), q)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	items, page := pagination.Trim(req, results, func(search.Result) int64 { return 0 })
+	return items, page, nil
+}
+
+// SearchHandler searches the data of the tenant at GET /search?q=, ranked best first and
+// optionally restricted to one type (?type=). Members only find the documents their role allows.
+func SearchHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and user from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Step 2: Read the query; malformed paging parameters show the first page
+		req, _ := searchList.Parse(r.URL.Query())
+		sources := search.Sources()
+		labels := map[string]string{}
+		for _, src := range sources {
+			labels[src.Type] = src.LabelKey
+		}
+		extra := map[string]any{"Sources": sources, "Labels": labels}
+
+		// Step 3: Search
+		if req.Filter("q") != "" {
+			results, page, err := runSearch(cfg, r, t, user, req)
+			switch {
+			case errors.Is(err, search.ErrDisabled):
+				w.WriteHeader(http.StatusServiceUnavailable)
+				extra["Error"] = i18n.T("search.error.disabled", lang)
+			case err != nil:
+				slog.ErrorContext(r.Context(), "[SEARCH] Search failed", "tenant", t.Subdomain, "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				extra["Error"] = i18n.T("common.internal_error", lang)
+			default:
+				extra["Results"] = results
+				extra["Searched"] = true
+			}
+			extra["Page"] = page
+		}
+		extra["Query"] = req.Filter("q")
+		extra["Type"] = req.Filter("type")
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
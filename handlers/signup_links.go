@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// Bounds of the signup links admins can create.
+const (
+	maxSignupLinkDays = 90
+	maxSignupLinkUses = 1000
+)
+
+// errSignupLinkInvalid is returned by signupLink when the link is forged, expired, revoked or used up.
+var errSignupLinkInvalid = errors.New("signup link is not usable")
+
+// signupLinkView is what the members page shows for each active signup link.
+type signupLinkView struct {
+	models.SignupLink
+	URL string
+}
+
+// signupLink returns the signup link of a token, carried by the "link" query parameter of /register,
+// or nil when there is none.
+func signupLink(ctx context.Context, cfg *multitenant.Config, r *http.Request, tenantID int64, token string) (*models.SignupLink, error) {
+	if token == "" {
+		return nil, nil
+	}
+	id, role, ok := utils.ValidateSignupLinkToken(token, tokenAudience(cfg, r))
+	if !ok {
+		return nil, errSignupLinkInvalid
+	}
+	l, err := models.GetSignupLink(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || l.Role != role || !l.Usable() {
+		return nil, errSignupLinkInvalid
+	}
+	return l, nil
+}
+
+// signupLinkURL returns the shareable registration URL of a link. Tokens are deterministic,
+// so the URL can be rebuilt from the stored link instead of keeping the token.
+func signupLinkURL(cfg *multitenant.Config, r *http.Request, l models.SignupLink) (string, error) {
+	token, err := utils.GenerateSignupLinkToken(tokenAudience(cfg, r), l.ID, l.Role, l.MaxUses, l.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+	return urls.Tenant(cfg, middleware.FromContext(r.Context()), "/register", url.Values{"link": {token}}), nil
+}
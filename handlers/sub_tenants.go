@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/urls"
+)
+
+// InitSubTenantTemplates parses the templates needed for the sub-tenant page.
+// It includes header, base layout, and sub-tenant-specific content.
+func InitSubTenantTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("sub_tenants", "sub_tenants.html")
+}
+
+// SubTenantsHandler lets the admins of a tenant see and create its sub-tenants at
+// /settings/sub-tenants, e.g. the clients of an agency. A sub-tenant is served on a subdomain of
+// its parent (client.agency.<domain>) and inherits the parent's branding and settings until it sets
+// its own. POST action "create" provisions one with its owner, who gets a link to choose their
+// password. Sub-tenants cannot have sub-tenants of their own.
+func SubTenantsHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and admin from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			if t.ParentID != 0 {
+				extra["Nested"] = true
+			} else {
+				subs, err := models.ListSubTenants(r.Context(), t.ID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "[TENANTS] Failed to list sub-tenants", "tenant", t.Subdomain, "err", err)
+				}
+				links := make(map[int64]string, len(subs))
+				for _, s := range subs {
+					links[s.ID] = urls.Subdomain(cfg, s.Subdomain, "/", nil)
+				}
+				extra["SubTenants"] = subs
+				extra["Links"] = links
+			}
+			extra["Suffix"] = tenantHost(cfg, t.Subdomain)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to list the sub-tenants
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("created") != "" {
+				extra["Success"] = i18n.T("subtenants.created", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil || r.FormValue("action") != "create" {
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("subtenants.error.invalid_form", lang)})
+			return
+		}
+		name := strings.TrimSpace(r.FormValue("name"))
+		label := strings.ToLower(strings.TrimSpace(r.FormValue("subdomain")))
+		email := strings.ToLower(strings.TrimSpace(r.FormValue("owner_email")))
+		form := map[string]any{"Name": name, "Label": label, "OwnerEmail": email}
+		fail := func(status int, key string) {
+			form["Error"] = i18n.T(key, lang)
+			renderPage(status, form)
+		}
+
+		// Step 4: Create the sub-tenant with the checks of /enroll
+		sub, err := multitenant.ProvisionTenant(r.Context(), multitenant.ProvisionRequest{
+			Config:     cfg,
+			Name:       name,
+			Subdomain:  label,
+			OwnerEmail: email,
+			Parent:     t.Subdomain,
+		})
+		switch {
+		case errors.Is(err, multitenant.ErrInvalidName):
+			fail(http.StatusBadRequest, "subtenants.error.invalid_name")
+			return
+		case errors.Is(err, multitenant.ErrInvalidEmail):
+			fail(http.StatusBadRequest, "subtenants.error.invalid_email")
+			return
+		case errors.Is(err, multitenant.ErrInvalidSubdomain):
+			fail(http.StatusBadRequest, "subtenants.error.invalid_subdomain")
+			return
+		case errors.Is(err, multitenant.ErrInvalidParent):
+			fail(http.StatusConflict, "subtenants.error.nested")
+			return
+		case errors.Is(err, multitenant.ErrTenantExists):
+			fail(http.StatusConflict, "subtenants.error.taken")
+			return
+		case err != nil:
+			slog.ErrorContext(r.Context(), "[TENANTS] Failed to create sub-tenant", "tenant", t.Subdomain, "err", err)
+			fail(http.StatusInternalServerError, "common.internal_error")
+			return
+		}
+
+		// Step 5: Record the creation on both tenants
+		entry := models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   user.ID,
+			Action:   "tenant.sub_tenant_created",
+			IP:       middleware.ClientIP(r),
+			Details:  sub.Subdomain + " owner " + email,
+		}
+		models.LogAudit(r.Context(), entry)
+		entry.TenantID, entry.UserID, entry.Action = sub.ID, 0, "tenant.provisioned"
+		entry.Details += " by " + user.Email + " of " + t.Subdomain
+		models.LogAudit(r.Context(), entry)
+		slog.InfoContext(r.Context(), "[TENANTS] Sub-tenant created", "parent", t.Subdomain, "subdomain", sub.Subdomain, "tenant_id", sub.ID)
+
+		// Step 6: Mail the owner a link to choose their password on the sub-tenant
+		if err := mailSubTenantOwner(r, cfg, i18n, lang, sub, email, user.Email); err != nil {
+			slog.ErrorContext(r.Context(), "[TENANTS] Failed to send set-password email", "tenant_id", sub.ID, "err", err)
+		}
+
+		http.Redirect(w, r, "/settings/sub-tenants?created=1", http.StatusSeeOther)
+	}
+}
+
+// mailSubTenantOwner sends the owner of a new sub-tenant the link to set their password.
+func mailSubTenantOwner(r *http.Request, cfg *multitenant.Config, i18n *i18n.I18n, lang string, sub *multitenant.Tenant, email, inviter string) error {
+	owner, err := models.GetUserByEmailAndTenant(email, sub.ID)
+	if err != nil || owner == nil {
+		return err
+	}
+	token, err := models.CreatePasswordReset(r.Context(), owner.ID, sub.ID, cfg.SetupExpiry)
+	if err != nil {
+		return err
+	}
+	link := urls.Tenant(cfg, sub, "/reset", url.Values{"token": {token}})
+	return mail.Default.SendTenant(r.Context(), sub.ID, sub.Name, mail.Message{
+		To:      []string{email},
+		Subject: i18n.T("mail.setup.subject", lang, sub.Name),
+		Text:    i18n.T("mail.setup.body", lang, inviter, sub.Name, link, cfg.SetupExpiry.Round(time.Hour).Hours()),
+	})
+}
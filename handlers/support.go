@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// InitSupportTemplates parses the templates needed for the support code lookup page.
+// It includes header, base layout, and support-specific content.
+func InitSupportTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("admin_support", "admin_support.html")
+}
+
+// SupportLookupHandler lets platform admins resolve the support code a user quotes (/admin/support?code=)
+// to the request it was shown on: tenant, user, path, the audit entries recorded while serving it,
+// and the request ID to search the logs for.
+func SupportLookupHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Show the form until a code is given
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		extra := map[string]any{"Code": code}
+		if code == "" {
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+			return
+		}
+
+		// Step 2: Resolve the code and the audit trail of its request
+		ref, err := models.GetSupportRef(r.Context(), code)
+		var entries []models.AuditEntry
+		if err == nil && ref != nil {
+			entries, err = models.ListRequestAuditEntries(r.Context(), ref.RequestID)
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[SUPPORT] Failed to resolve support code", "code", code, "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if ref == nil {
+			w.WriteHeader(http.StatusNotFound)
+			extra["NotFound"] = true
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+			return
+		}
+		slog.InfoContext(r.Context(), "[SUPPORT] Support code resolved", "code", ref.Code, "ref_request_id", ref.RequestID)
+		extra["Ref"] = ref
+		extra["Entries"] = entries
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+	}
+}
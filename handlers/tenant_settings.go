@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// settingField is a declared setting with the tenant's current value, as shown on the settings page.
+type settingField struct {
+	multitenant.SettingDef
+	Value any
+}
+
+// InitTenantSettingsTemplates parses the templates needed for the tenant settings page.
+// It includes header, base layout, and settings-specific content.
+func InitTenantSettingsTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("tenant_settings", "tenant_settings.html")
+}
+
+// TenantSettingsHandler lets tenant admins edit the settings declared with multitenant.RegisterSetting.
+// Only changed values are written, and the changed keys are audited.
+func TenantSettingsHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Retrieve tenant and admin from context
+		t := middleware.FromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if t == nil || user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		defs := multitenant.DefaultSettings.Defs()
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			fields := make([]settingField, 0, len(defs))
+			for _, d := range defs {
+				f := settingField{SettingDef: d}
+				switch d.Type {
+				case multitenant.SettingBool:
+					f.Value = t.Settings.GetBool(d.Key)
+				case multitenant.SettingInt:
+					f.Value = t.Settings.GetInt(d.Key)
+				default:
+					f.Value = t.Settings.GetString(d.Key)
+				}
+				fields = append(fields, f)
+			}
+			extra["Fields"] = fields
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET request to show the settings
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("settings.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse and validate every declared setting before writing any
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[SETTINGS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("settings.error.invalid_form", lang)})
+			return
+		}
+		stored, err := models.GetTenantSettings(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[SETTINGS] Failed to load settings", "tenant", t.Subdomain, "err", err)
+			renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+			return
+		}
+		values := make([]json.RawMessage, len(defs))
+		for i, d := range defs {
+			raw, err := d.Parse(r.FormValue(d.Key))
+			if err != nil {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("settings.error.invalid_value", lang, i18n.T(d.LabelKey, lang))})
+				return
+			}
+			values[i] = raw
+		}
+
+		// Step 4: Save the values that differ from what currently applies, stored or default
+		var keys []string
+		for i, d := range defs {
+			current, ok := stored[d.Key]
+			if !ok {
+				current = d.DefaultJSON()
+			}
+			if bytes.Equal(values[i], current) {
+				continue
+			}
+			if err := models.SetTenantSetting(r.Context(), t.ID, d.Key, values[i]); err != nil {
+				slog.ErrorContext(r.Context(), "[SETTINGS] Failed to save setting", "tenant", t.Subdomain, "key", d.Key, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			keys = append(keys, d.Key)
+		}
+		if len(keys) > 0 {
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   user.ID,
+				Action:   "tenant_settings.updated",
+				IP:       middleware.ClientIP(r),
+				Details:  strings.Join(keys, ","),
+			})
+			slog.InfoContext(r.Context(), "[SETTINGS] Settings updated", "tenant", t.Subdomain, "keys", keys)
+		}
+		http.Redirect(w, r, "/settings/general?saved=1", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+)
+
+// InitSuspendedTemplates parses the templates needed for the suspended tenant page.
+// It includes header, base layout, and suspended-specific content.
+func InitSuspendedTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("suspended", "suspended.html")
+}
+
+// InitTenantAdminTemplates parses the templates needed for the platform tenant list.
+// It includes header, base layout, and tenant-admin-specific content.
+func InitTenantAdminTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("admin_tenants", "admin_tenants.html")
+}
+
+// SuspendedHandler renders the tenant-branded page served by middleware.Suspended.
+func SuspendedHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, nil))
+	}
+}
+
+// TenantAdminHandler lets platform admins move tenants through their lifecycle.
+// POST actions: "suspend" takes a tenant offline, "reactivate" brings back a suspended or deleted
+// tenant, "delete" soft-deletes it until the purge date, "set_plan" attaches it to a limits plan.
+// Every change is audited. The list is paged and may be searched (?q=), filtered by state and
+// sorted, see models.TenantList.
+func TenantAdminHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			return
+		}
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			// Malformed paging parameters show the first page
+			req, _ := models.TenantList.Parse(r.URL.Query())
+			tenants, page, err := models.PageTenants(r.Context(), req)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[TENANTS] Failed to list tenants", "err", err)
+			}
+			extra["Tenants"] = tenants
+			extra["Page"] = page
+			extra["States"] = []string{models.TenantActive, models.TenantSuspended, models.TenantDeleted}
+			extra["Plans"] = limits.Plans()
+			extra["DefaultPlan"] = limits.DefaultPlan
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 1: Handle GET request to list the tenants
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("tenants.saved", lang)
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 2: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[TENANTS] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("tenants.error.invalid_form", lang)})
+			return
+		}
+		tenantID, err := strconv.ParseInt(r.FormValue("tenant_id"), 10, 64)
+		if err != nil {
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("tenants.error.invalid_form", lang)})
+			return
+		}
+
+		// Step 3: Apply the transition
+		action := r.FormValue("action")
+		var auditAction, details string
+		switch action {
+		case "suspend":
+			auditAction = "tenant.suspended"
+			details = strings.TrimSpace(r.FormValue("reason"))
+			if details == "" {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("tenants.error.missing_reason", lang)})
+				return
+			}
+			err = models.SuspendTenant(r.Context(), tenantID, details)
+		case "reactivate":
+			auditAction = "tenant.reactivated"
+			err = models.ReactivateTenant(r.Context(), tenantID)
+		case "delete":
+			auditAction = "tenant.deleted"
+			purgeAt := time.Now().Add(cfg.Tenants.PurgeAfter)
+			details = "purge after " + purgeAt.Format(time.RFC3339)
+			err = models.DeleteTenant(r.Context(), tenantID, purgeAt)
+		case "set_plan":
+			auditAction = "tenant.plan_changed"
+			details = r.FormValue("plan")
+			err = limits.SetPlan(r.Context(), tenantID, details)
+			if errors.Is(err, limits.ErrUnknownPlan) {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("tenants.error.invalid_form", lang)})
+				return
+			}
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("tenants.error.invalid_form", lang)})
+			return
+		}
+		if errors.Is(err, models.ErrTenantState) {
+			renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("tenants.error.state", lang)})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[TENANTS] Transition failed", "tenant_id", tenantID, "action", action, "err", err)
+			renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+			return
+		}
+
+		// Step 4: Record the transition
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: tenantID,
+			UserID:   user.ID,
+			Action:   auditAction,
+			IP:       middleware.ClientIP(r),
+			Details:  details,
+		})
+		slog.InfoContext(r.Context(), "[TENANTS] Tenant transitioned", "tenant_id", tenantID, "action", action, "by", user.ID)
+
+		http.Redirect(w, r, "/admin/tenants?saved=1", http.StatusSeeOther)
+	}
+}
+
+// PurgeDeletedTenants permanently removes soft-deleted tenants past their purge date, files included.
+// Tenants on legal hold are skipped until the hold is released.
+func PurgeDeletedTenants(ctx context.Context, store storage.Store) {
+	tenants, err := models.TenantsDueForPurge(ctx)
+	if err != nil {
+		slog.Error("[TENANTS] Failed to list tenants due for purge", "err", err)
+		return
+	}
+	for _, t := range tenants {
+		// Step 1: Remove the stored files first so no file outlives its record
+		keys, err := models.TenantStorageKeys(ctx, t.ID)
+		if err != nil {
+			slog.Error("[TENANTS] Failed to list tenant files", "tenant_id", t.ID, "err", err)
+			continue
+		}
+		failed := false
+		for _, key := range keys {
+			if err := store.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				slog.Error("[TENANTS] Failed to delete tenant file", "tenant_id", t.ID, "key", key, "err", err)
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+
+		// Step 2: Delete the rows; the audit entry is platform-level since the tenant's log goes too
+		if err := models.PurgeTenant(ctx, t.ID); err != nil {
+			slog.Error("[TENANTS] Purge failed", "tenant_id", t.ID, "err", err)
+			continue
+		}
+		models.LogAudit(ctx, models.AuditEntry{Action: "tenant.purged", Details: t.Subdomain})
+		slog.Info("[TENANTS] Tenant purged", "tenant_id", t.ID, "subdomain", t.Subdomain)
+	}
+}
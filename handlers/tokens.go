@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// tokenAudience returns the audience signed tokens are bound to for this request:
+// the tenant subdomain on tenant sites, the root domain otherwise.
+func tokenAudience(cfg *multitenant.Config, r *http.Request) string {
+	if t := middleware.FromContext(r.Context()); t != nil {
+		return t.Subdomain
+	}
+	return cfg.Domain
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/metering"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// usageReportDays is the period shown when the report is opened without dates.
+const usageReportDays = 30
+
+// InitUsageTemplates parses the templates needed for the platform usage report.
+// It includes header, base layout, and usage-specific content.
+func InitUsageTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("admin_usage", "admin_usage.html")
+}
+
+// UsageReportHandler shows platform admins the daily usage of tenants at GET /admin/usage, filtered by
+// ?from= and ?to= (YYYY-MM-DD, the last 30 days by default), ?tenant= (subdomain) and ?meter=.
+// ?format=csv or ?format=json returns the same rows for billing systems.
+func UsageReportHandler(i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+		q := r.URL.Query()
+
+		// Step 1: Read the filter, defaulting to the last days
+		now := time.Now()
+		f := models.UsageFilter{
+			From:  strings.TrimSpace(q.Get("from")),
+			To:    strings.TrimSpace(q.Get("to")),
+			Meter: strings.TrimSpace(q.Get("meter")),
+		}
+		if f.From == "" {
+			f.From = metering.Day(now.AddDate(0, 0, -usageReportDays+1))
+		}
+		if f.To == "" {
+			f.To = metering.Day(now)
+		}
+		extra := map[string]any{"From": f.From, "To": f.To, "Tenant": q.Get("tenant"), "Meter": f.Meter}
+		_, errFrom := time.Parse("2006-01-02", f.From)
+		_, errTo := time.Parse("2006-01-02", f.To)
+		if errFrom != nil || errTo != nil || (f.Meter != "" && !metering.ValidMeter(f.Meter)) {
+			extra["Error"] = i18n.T("usage.error.invalid_filter", lang)
+			w.WriteHeader(http.StatusBadRequest)
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+			return
+		}
+		if sub := strings.TrimSpace(q.Get("tenant")); sub != "" {
+			t, err := models.GetTenantBySubdomain(r.Context(), db.DB, sub)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[USAGE] Failed to load tenant", "subdomain", sub, "err", err)
+				middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			if t == nil {
+				extra["Error"] = i18n.T("usage.error.unknown_tenant", lang)
+				w.WriteHeader(http.StatusNotFound)
+				render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+				return
+			}
+			f.TenantID = int64(t.ID)
+		}
+
+		// Step 2: Load the usage
+		rows, err := models.ListUsage(r.Context(), f)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[USAGE] Failed to list usage", "err", err)
+			middleware.Error(w, r, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Step 3: Answer in the requested format
+		switch q.Get("format") {
+		case "json":
+			out := make([]map[string]any, 0, len(rows))
+			for _, u := range rows {
+				out = append(out, map[string]any{
+					"tenant_id": u.TenantID, "subdomain": u.Subdomain, "day": u.Day, "meter": u.Meter, "value": u.Value,
+				})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{"from": f.From, "to": f.To, "usage": out})
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="usage-`+f.From+`-`+f.To+`.csv"`)
+			cw := csv.NewWriter(w)
+			cw.Write([]string{"tenant_id", "subdomain", "day", "meter", "value"})
+			for _, u := range rows {
+				cw.Write([]string{strconv.FormatInt(u.TenantID, 10), u.Subdomain, u.Day, u.Meter, strconv.FormatInt(u.Value, 10)})
+			}
+			cw.Flush()
+		default:
+			extra["Rows"] = rows
+			for _, format := range []string{"csv", "json"} {
+				q.Set("format", format)
+				extra[strings.ToUpper(format)+"Link"] = "/admin/usage?" + q.Encode()
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/webhooks"
+)
+
+// webhookLogSize is the number of deliveries shown in an endpoint's log.
+const webhookLogSize = 50
+
+// InitWebhookTemplates parses the templates needed for the webhooks page.
+// It includes header, base layout, and webhook-specific content.
+func InitWebhookTemplates(e *render.Engine) *render.Page {
+	return e.MustPage("webhooks", "webhooks.html")
+}
+
+// WebhooksHandler lets tenant admins (/settings/webhooks) and platform admins (/admin/webhooks, on the
+// root domain, receiving the events of every tenant) manage their webhook endpoints. ?endpoint= shows
+// the delivery log of an endpoint. POST actions: "create" registers an endpoint and shows its secret
+// once, "toggle" pauses or resumes it, "delete" removes it, "ping" sends a test event and "redeliver"
+// queues a delivery again.
+func WebhooksHandler(cfg *multitenant.Config, i18n *i18n.I18n, tmpl *render.Page) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lang := middleware.LangFromContext(r.Context())
+
+		// Step 1: Resolve the scope: the tenant of the request, or the platform on the root domain
+		user := middleware.CurrentUser(r)
+		if user == nil {
+			http.NotFound(w, r)
+			return
+		}
+		var scope int64
+		if t := middleware.FromContext(r.Context()); t != nil {
+			scope = t.ID
+		}
+		page := r.URL.Path
+
+		renderPage := func(status int, extra map[string]any) {
+			if extra == nil {
+				extra = map[string]any{}
+			}
+			endpoints, err := models.ListWebhookEndpoints(r.Context(), scope)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[WEBHOOK] Failed to list endpoints", "scope", scope, "err", err)
+			}
+			extra["Endpoints"] = endpoints
+			extra["Events"] = webhooks.Events
+			extra["Platform"] = scope == 0
+			extra["Page"] = page
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+			}
+			render.RenderTemplate(w, tmpl, "base", render.BaseTemplateData(r, i18n, extra))
+		}
+
+		// Step 2: Handle GET requests: the endpoints, or the log of one
+		if r.Method == http.MethodGet {
+			extra := map[string]any{}
+			if r.URL.Query().Get("saved") != "" {
+				extra["Success"] = i18n.T("webhooks.saved", lang)
+			}
+			if id, err := strconv.ParseInt(r.URL.Query().Get("endpoint"), 10, 64); err == nil {
+				e, err := models.GetWebhookEndpoint(r.Context(), scope, id)
+				var deliveries []models.WebhookDelivery
+				if err == nil && e != nil {
+					deliveries, err = models.ListWebhookDeliveries(r.Context(), scope, id, webhookLogSize)
+				}
+				if err != nil {
+					slog.ErrorContext(r.Context(), "[WEBHOOK] Failed to load deliveries", "endpoint_id", id, "err", err)
+					renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+					return
+				}
+				if e == nil {
+					http.NotFound(w, r)
+					return
+				}
+				extra["Endpoint"] = e
+				extra["Deliveries"] = deliveries
+			}
+			renderPage(http.StatusOK, extra)
+			return
+		}
+
+		// Step 3: Parse the form data for POST requests
+		if err := r.ParseForm(); err != nil {
+			slog.ErrorContext(r.Context(), "[WEBHOOK] Invalid form", "err", err)
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("webhooks.error.invalid_form", lang)})
+			return
+		}
+		id, _ := strconv.ParseInt(r.FormValue("endpoint_id"), 10, 64)
+		redirect := page + "?saved=1"
+
+		var auditAction, details string
+		switch r.FormValue("action") {
+		case "create":
+			// Step 4a: Register the endpoint and show its secret once
+			target := strings.TrimSpace(r.FormValue("url"))
+			u, err := url.Parse(target)
+			if err != nil || u.Host == "" || (u.Scheme != "https" && !(u.Scheme == "http" && cfg.IsDev())) || len(target) > 500 {
+				renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("webhooks.error.invalid_url", lang)})
+				return
+			}
+			var events []string
+			for _, ev := range r.Form["events"] {
+				if webhooks.ValidEvent(ev) {
+					events = append(events, ev)
+				}
+			}
+			e, err := models.CreateWebhookEndpoint(r.Context(), models.WebhookEndpoint{
+				TenantID:  scope,
+				URL:       target,
+				Events:    events,
+				CreatedBy: user.ID,
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[WEBHOOK] Failed to create endpoint", "scope", scope, "err", err)
+				renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+				return
+			}
+			auditWebhook(r, scope, user.ID, "webhook.created", target)
+			slog.InfoContext(r.Context(), "[WEBHOOK] Endpoint created", "scope", scope, "endpoint_id", e.ID)
+			w.Header().Set("Cache-Control", "no-store")
+			renderPage(http.StatusOK, map[string]any{"NewSecret": e.Secret, "NewURL": e.URL})
+			return
+
+		case "toggle":
+			// Step 4b: Pause or resume the endpoint
+			active := r.FormValue("active") == "1"
+			found, err := models.SetWebhookEndpointActive(r.Context(), scope, id, active)
+			if err != nil || !found {
+				webhookActionFailed(r, renderPage, i18n, lang, found, err)
+				return
+			}
+			auditAction, details = "webhook.paused", strconv.FormatInt(id, 10)
+			if active {
+				auditAction = "webhook.resumed"
+			}
+
+		case "delete":
+			// Step 4c: Remove the endpoint and its log
+			found, err := models.DeleteWebhookEndpoint(r.Context(), scope, id)
+			if err != nil || !found {
+				webhookActionFailed(r, renderPage, i18n, lang, found, err)
+				return
+			}
+			auditAction, details = "webhook.deleted", strconv.FormatInt(id, 10)
+
+		case "ping":
+			// Step 4d: Queue a test event for the endpoint
+			e, err := models.GetWebhookEndpoint(r.Context(), scope, id)
+			if err == nil && e != nil {
+				err = webhooks.SendPing(r.Context(), *e)
+			}
+			if err != nil || e == nil {
+				webhookActionFailed(r, renderPage, i18n, lang, e != nil, err)
+				return
+			}
+			redirect = page + "?endpoint=" + strconv.FormatInt(id, 10)
+
+		case "redeliver":
+			// Step 4e: Queue a delivery again
+			deliveryID, _ := strconv.ParseInt(r.FormValue("delivery_id"), 10, 64)
+			found, err := models.RetryWebhookDelivery(r.Context(), scope, deliveryID)
+			if err != nil || !found {
+				webhookActionFailed(r, renderPage, i18n, lang, found, err)
+				return
+			}
+			redirect = page + "?endpoint=" + strconv.FormatInt(id, 10)
+
+		default:
+			renderPage(http.StatusBadRequest, map[string]any{"Error": i18n.T("webhooks.error.invalid_form", lang)})
+			return
+		}
+
+		// Step 5: Record the change
+		if auditAction != "" {
+			auditWebhook(r, scope, user.ID, auditAction, details)
+			slog.InfoContext(r.Context(), "[WEBHOOK] Endpoint updated", "scope", scope, "action", auditAction, "endpoint_id", id)
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	}
+}
+
+// webhookActionFailed answers an action on an endpoint or delivery that is unknown in the scope, or failed.
+func webhookActionFailed(r *http.Request, renderPage func(int, map[string]any), i18n *i18n.I18n, lang string, found bool, err error) {
+	if errors.Is(err, models.ErrLegalHold) {
+		renderPage(http.StatusConflict, map[string]any{"Error": i18n.T("common.legal_hold", lang)})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[WEBHOOK] Action failed", "action", r.FormValue("action"), "err", err)
+		renderPage(http.StatusInternalServerError, map[string]any{"Error": i18n.T("common.internal_error", lang)})
+		return
+	}
+	renderPage(http.StatusNotFound, map[string]any{"Error": i18n.T("webhooks.error.not_found", lang)})
+}
+
+func auditWebhook(r *http.Request, scope, userID int64, action, details string) {
+	models.LogAudit(r.Context(), models.AuditEntry{
+		TenantID: scope,
+		UserID:   userID,
+		Action:   action,
+		IP:       middleware.ClientIP(r),
+		Details:  details,
+	})
+}
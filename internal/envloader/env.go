@@ -2,7 +2,7 @@ package envloader
 
 import (
 	"bufio"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 )
@@ -11,7 +11,7 @@ import (
 func LoadDotEnv(path string) {
 	file, err := os.Open(path)
 	if err != nil {
-		log.Printf("No .env file loaded from %s\n", path)
+		slog.Info("[CONFIG] No .env file loaded", "path", path)
 		return
 	}
 	defer file.Close()
@@ -0,0 +1,13 @@
+package i18n
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// Builtin holds the translations of the kit's own pages and mails, embedded in the binary so they
+// load whatever the working directory. Applications load their locale directory after it.
+var Builtin, _ = fs.Sub(builtin, "locales")
@@ -0,0 +1,138 @@
+package i18n
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Problems reported by Check.
+const (
+	IssueMissing      = "missing"      // The key falls back to the default language
+	IssueUnknown      = "unknown"      // The default language has no such key
+	IssuePlaceholders = "placeholders" // The {{.Name}} placeholders or % verbs differ from the default language
+)
+
+// Issue is a problem found by Check in the translations of a language.
+type Issue struct {
+	Lang    string
+	Key     string
+	Problem string
+}
+
+var (
+	namedPlaceholder = regexp.MustCompile(`{{\s*\.(\w+)\s*}}`)
+	printfVerb       = regexp.MustCompile(`%[-+#0-9.]*[a-zA-Z]`)
+)
+
+// Check compares the translations of every language with the default language. A regional
+// language such as fr-CA only needs the keys missing from its base language. Plural forms are
+// compared by their base key, since languages use different plural categories, and their
+// placeholders are not compared: a "zero" form may leave the count out.
+func (i *I18n) Check() []Issue {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	reference := i.translations[i.defaultLang]
+	var issues []Issue
+	for lang, entries := range i.translations {
+		if lang == i.defaultLang {
+			continue
+		}
+		has := func(key string) bool {
+			for _, l := range i.fallbacks(lang) {
+				if l != i.defaultLang && hasKey(i.translations[l], key) {
+					return true
+				}
+			}
+			return false
+		}
+		for key := range reference {
+			if !has(key) {
+				issues = append(issues, Issue{Lang: lang, Key: pluralBase(key), Problem: IssueMissing})
+			}
+		}
+		for key, val := range entries {
+			ref, ok := reference[key]
+			switch {
+			case !hasKey(reference, key):
+				issues = append(issues, Issue{Lang: lang, Key: pluralBase(key), Problem: IssueUnknown})
+			case ok && pluralBase(key) == key && !samePlaceholders(ref, val):
+				issues = append(issues, Issue{Lang: lang, Key: key, Problem: IssuePlaceholders})
+			}
+		}
+	}
+
+	// Plural forms of a key report once
+	sort.Slice(issues, func(a, b int) bool {
+		x, y := issues[a], issues[b]
+		if x.Lang != y.Lang {
+			return x.Lang < y.Lang
+		}
+		if x.Key != y.Key {
+			return x.Key < y.Key
+		}
+		return x.Problem < y.Problem
+	})
+	out := issues[:0]
+	for n, is := range issues {
+		if n == 0 || is != issues[n-1] {
+			out = append(out, is)
+		}
+	}
+	return out
+}
+
+// hasKey reports whether entries translate key, in any plural form for plural keys.
+func hasKey(entries map[string]string, key string) bool {
+	if _, ok := entries[key]; ok {
+		return true
+	}
+	base := pluralBase(key)
+	if base == key {
+		return false
+	}
+	for _, form := range []string{Zero, One, Two, Few, Many, Other} {
+		if _, ok := entries[base+"."+form]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pluralBase returns the key of a plural form without its category, "items.one" becoming "items".
+func pluralBase(key string) string {
+	base, form, ok := cutLast(key, ".")
+	if !ok {
+		return key
+	}
+	switch form {
+	case Zero, One, Two, Few, Many, Other:
+		return base
+	}
+	return key
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if n := strings.LastIndex(s, sep); n >= 0 {
+		return s[:n], s[n+len(sep):], true
+	}
+	return s, "", false
+}
+
+// samePlaceholders reports whether two translations use the same named placeholders and the same
+// number of % verbs, which T fills from the same arguments.
+func samePlaceholders(a, b string) bool {
+	names := func(s string) string {
+		var out []string
+		for _, m := range namedPlaceholder.FindAllStringSubmatch(s, -1) {
+			out = append(out, m[1])
+		}
+		sort.Strings(out)
+		return strings.Join(out, ",")
+	}
+	verbs := func(s string) int {
+		return len(printfVerb.FindAllString(strings.ReplaceAll(s, "%%", ""), -1))
+	}
+	return names(a) == names(b) && verbs(a) == verbs(b)
+}
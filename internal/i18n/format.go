@@ -0,0 +1,193 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localeStyle holds how a language writes dates, numbers and amounts.
+type localeStyle struct {
+	date, dateTime, time string // time.Format layouts
+	group, decimal       string // Thousands and decimal separators
+	symbolAfter          bool   // "12,50 €" rather than "€12.50"
+}
+
+const (
+	nbsp       = "\u00a0" // Between amounts and symbols, and groups in some languages
+	narrowNbsp = "\u202f" // Groups in French
+)
+
+var (
+	styleEN = localeStyle{date: "Jan 2, 2006", dateTime: "Jan 2, 2006 3:04 PM MST", time: "3:04 PM", group: ",", decimal: "."}
+	styleFR = localeStyle{date: "02/01/2006", dateTime: "02/01/2006 15:04 MST", time: "15:04", group: narrowNbsp, decimal: ",", symbolAfter: true}
+	styleDE = localeStyle{date: "02.01.2006", dateTime: "02.01.2006 15:04 MST", time: "15:04", group: ".", decimal: ",", symbolAfter: true}
+	styleES = localeStyle{date: "02/01/2006", dateTime: "02/01/2006 15:04 MST", time: "15:04", group: ".", decimal: ",", symbolAfter: true}
+)
+
+// localeStyles maps languages to their style; region-specific entries win over the base language,
+// and languages not listed are written as in English.
+var localeStyles = map[string]localeStyle{
+	"en":    styleEN,
+	"en-GB": {date: "2 Jan 2006", dateTime: "2 Jan 2006 15:04 MST", time: "15:04", group: ",", decimal: "."},
+	"fr":    styleFR,
+	"fr-CH": {date: "02.01.2006", dateTime: "02.01.2006 15:04 MST", time: "15:04", group: "’", decimal: ".", symbolAfter: true},
+	"de":    styleDE,
+	"es":    styleES,
+	"it":    styleES,
+	"pt":    {date: "02/01/2006", dateTime: "02/01/2006 15:04 MST", time: "15:04", group: ".", decimal: ",", symbolAfter: true},
+	"nl":    {date: "02-01-2006", dateTime: "02-01-2006 15:04 MST", time: "15:04", group: ".", decimal: ","},
+	"ru":    {date: "02.01.2006", dateTime: "02.01.2006 15:04 MST", time: "15:04", group: nbsp, decimal: ",", symbolAfter: true},
+	"pl":    {date: "02.01.2006", dateTime: "02.01.2006 15:04 MST", time: "15:04", group: nbsp, decimal: ",", symbolAfter: true},
+	"ja":    {date: "2006/01/02", dateTime: "2006/01/02 15:04 MST", time: "15:04", group: ",", decimal: "."},
+	"zh":    {date: "2006/01/02", dateTime: "2006/01/02 15:04 MST", time: "15:04", group: ",", decimal: "."},
+}
+
+// currencySymbols are the symbols of common currencies; other currencies are written with their code.
+var currencySymbols = map[string]string{"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CHF": "CHF", "CAD": "CA$", "AUD": "A$"}
+
+// currencyDecimals are the minor unit digits of currencies that do not use two.
+var currencyDecimals = map[string]int{"JPY": 0, "KRW": 0, "CLP": 0}
+
+// Formatter formats dates, times, numbers and amounts in a language, with dates in a time zone,
+// e.g. the tenant's. The zero value formats as in English, in UTC.
+type Formatter struct {
+	Lang     string
+	Location *time.Location
+	style    localeStyle
+}
+
+// NewFormatter returns the formatter of lang; a nil loc is UTC.
+func NewFormatter(lang string, loc *time.Location) Formatter {
+	if loc == nil {
+		loc = time.UTC
+	}
+	style, ok := localeStyles[lang]
+	if !ok {
+		base, _, _ := strings.Cut(lang, "-")
+		if style, ok = localeStyles[base]; !ok {
+			style = styleEN
+		}
+	}
+	return Formatter{Lang: lang, Location: loc, style: style}
+}
+
+func (f Formatter) layout(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if layout == "" {
+		layout = styleEN.dateTime
+	}
+	return t.In(loc).Format(layout)
+}
+
+// Date formats the day of t: "Jan 2, 2006" in English, "02/01/2006" in French. Zero times are "".
+func (f Formatter) Date(t time.Time) string {
+	return f.layout(t, f.style.date)
+}
+
+// DateTime formats t with its time and zone abbreviation.
+func (f Formatter) DateTime(t time.Time) string {
+	return f.layout(t, f.style.dateTime)
+}
+
+// Time formats the time of day of t: "3:04 PM" in English, "15:04" in French.
+func (f Formatter) Time(t time.Time) string {
+	return f.layout(t, f.style.time)
+}
+
+// Number groups the thousands of v, with two decimals for non-integers: 1234567.5 is "1,234,567.50"
+// in English and "1 234 567,50" in French. Values that are not numbers are printed as they are.
+func (f Formatter) Number(v any) string {
+	n, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if n == math.Trunc(n) {
+		return f.group(strconv.FormatFloat(n, 'f', 0, 64))
+	}
+	return f.group(strconv.FormatFloat(n, 'f', 2, 64))
+}
+
+// Currency formats an amount in major units with its ISO 4217 code: 12.5 "EUR" is "€12.50" in
+// English and "12,50 €" in French.
+func (f Formatter) Currency(v any, code string) string {
+	n, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	code = strings.ToUpper(code)
+	decimals, ok := currencyDecimals[code]
+	if !ok {
+		decimals = 2
+	}
+	amount := f.group(strconv.FormatFloat(math.Abs(n), 'f', decimals, 64))
+	sign := ""
+	if n < 0 {
+		sign = "-"
+	}
+	symbol, known := currencySymbols[code]
+	switch {
+	case f.style.symbolAfter && known:
+		return sign + amount + nbsp + symbol
+	case known && strings.Trim(symbol, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == "":
+		return sign + symbol + nbsp + amount // Letter symbols such as CHF are spaced
+	case known:
+		return sign + symbol + amount
+	}
+	return sign + amount + nbsp + code
+}
+
+// group inserts the thousands separators of the language in a number formatted by strconv, and
+// replaces its decimal point.
+func (f Formatter) group(s string) string {
+	sep, point := f.style.group, f.style.decimal
+	if sep == "" {
+		sep, point = styleEN.group, styleEN.decimal
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(c)
+	}
+	if hasFrac {
+		return sign + b.String() + point + frac
+	}
+	return sign + b.String()
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
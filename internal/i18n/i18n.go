@@ -1,19 +1,38 @@
+// Package i18n loads the JSON translations of tenkit and formats messages, dates and numbers per
+// language. The built-in locales are embedded (Builtin), and an application's files are merged
+// over them key by key, so they only hold the keys they add or change:
+//
+//	tr, _ := i18n.New("en")
+//	err := tr.Load(i18n.Builtin, os.DirFS("locales"))
+//	tr.T("groups.title", "fr")
+//	tr.T("members.count", "fr", map[string]any{"Count": 3}) // Plural form of 3
+//
+// Locale files may nest objects, looked up with dot paths. An object of CLDR plural categories
+// (zero, one, two, few, many, other) is a plural entry, picked with the rule of the language
+// (PluralCategory). Messages take named placeholders ({{.Name}}) from a map, or positional %s
+// verbs. A <lang>.meta.json file can mark a language right-to-left. I18N_WATCH reloads the files
+// when they change, and an invalid file keeps the previous translations; Check lists the keys
+// missing from a language or with different placeholders, as tenkit i18n check does.
 package i18n
 
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"maps"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"text/template"
 )
 
 // I18n manages JSON translations with a robust and thread-safe mechanism.
 type I18n struct {
 	translations map[string]map[string]string
+	sources      []fs.FS // Of the last Load, for Reload
+	meta         map[string]LocaleMeta
 	defaultLang  string
 	debug        bool
 	mu           sync.RWMutex
@@ -50,65 +69,96 @@ func (i *I18n) Translations() map[string]map[string]string {
 
 // LoadLocales loads JSON translation files from a directory.
 func (i *I18n) LoadLocales(dir string) error {
-	i.mu.Lock()
-	defer i.mu.Unlock()
-
-	// Reset translations to avoid stale data
-	i.translations = make(map[string]map[string]string)
-
-	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
-	if err != nil {
-		slog.Error("[LANG] Failed to list translation files", "dir", dir, "error", err)
-		return fmt.Errorf("failed to list translation files: %w", err)
-	}
-	if len(files) == 0 {
-		slog.Warn("[LANG] No translation files found", "dir", dir)
-		return fmt.Errorf("no translation files found in %s", dir)
-	}
+	return i.Load(os.DirFS(dir))
+}
 
-	for _, file := range files {
-		lang := strings.TrimSuffix(filepath.Base(file), ".json")
-		if !isValidLang(lang) {
-			slog.Warn("[LANG] Invalid language code, skipping", "lang", lang, "file", file)
+// Load loads the <lang>.json translation files at the root of each source, e.g. Builtin followed
+// by the application's locale directory. Sources are merged in order: a key of a later source
+// overrides the same key of an earlier one, so applications only ship the keys they change.
+func (i *I18n) Load(sources ...fs.FS) error {
+	translations := make(map[string]map[string]string)
+	meta := make(map[string]LocaleMeta)
+	for n, fsys := range sources {
+		files, err := fs.Glob(fsys, "*.json")
+		if err != nil {
+			slog.Error("[LANG] Failed to list translation files", "source", n, "error", err)
+			return fmt.Errorf("failed to list translation files: %w", err)
+		}
+		if len(files) == 0 {
+			slog.Warn("[LANG] No translation files found", "source", n)
 			continue
 		}
 
-		slog.Info("[LANG] Loading translation file", "file", file, "lang", lang)
-		data, err := os.ReadFile(file)
-		if err != nil {
-			slog.Error("[LANG] Failed to read translation file", "file", file, "error", err)
-			return fmt.Errorf("failed to read translation file %s: %w", file, err)
+		if err := loadMeta(fsys, meta); err != nil {
+			return err
 		}
 
-		var entries map[string]string
-		if err := json.Unmarshal(data, &entries); err != nil {
-			slog.Error("[LANG] Invalid JSON format", "file", file, "error", err)
-			return fmt.Errorf("invalid JSON format in %s: %w", file, err)
-		}
-		if len(entries) == 0 {
-			slog.Warn("[LANG] Translation file is empty", "file", file)
-			continue
-		}
+		for _, file := range files {
+			lang := strings.TrimSuffix(file, ".json")
+			if strings.HasSuffix(lang, metaSuffix) {
+				continue
+			}
+			if !isValidLang(lang) {
+				slog.Warn("[LANG] Invalid language code, skipping", "lang", lang, "file", file)
+				continue
+			}
+
+			slog.Info("[LANG] Loading translation file", "file", file, "lang", lang, "source", n)
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				slog.Error("[LANG] Failed to read translation file", "file", file, "error", err)
+				return fmt.Errorf("failed to read translation file %s: %w", file, err)
+			}
+
+			var tree map[string]any
+			if err := json.Unmarshal(data, &tree); err != nil {
+				slog.Error("[LANG] Invalid JSON format", "file", file, "error", err)
+				return fmt.Errorf("invalid JSON format in %s: %w", file, err)
+			}
+			entries := map[string]string{}
+			if err := flatten(entries, "", tree); err != nil {
+				slog.Error("[LANG] Invalid translation", "file", file, "error", err)
+				return fmt.Errorf("invalid translation in %s: %w", file, err)
+			}
+			if len(entries) == 0 {
+				slog.Warn("[LANG] Translation file is empty", "file", file)
+				continue
+			}
 
-		i.translations[lang] = entries
-		slog.Info("[LANG] Successfully loaded", "lang", lang, "entries", len(entries))
-		if i.debug {
-			keys := make([]string, 0, len(entries))
-			for k := range entries {
-				keys = append(keys, k)
+			if translations[lang] == nil {
+				translations[lang] = entries
+			} else {
+				maps.Copy(translations[lang], entries)
+			}
+			slog.Info("[LANG] Successfully loaded", "lang", lang, "entries", len(entries))
+			if i.debug {
+				keys := make([]string, 0, len(entries))
+				for k := range entries {
+					keys = append(keys, k)
+				}
+				slog.Debug("[LANG] Loaded keys", "lang", lang, "keys", keys)
 			}
-			slog.Debug("[LANG] Loaded keys", "lang", lang, "keys", keys)
 		}
 	}
+	if len(translations) == 0 {
+		return fmt.Errorf("no translation files found")
+	}
 
 	// Validate that the default language has translations
-	if _, ok := i.translations[i.defaultLang]; !ok {
+	if _, ok := translations[i.defaultLang]; !ok {
 		slog.Error("[LANG] Default language has no translations", "lang", i.defaultLang)
 		return fmt.Errorf("default language %s has no translations", i.defaultLang)
 	}
 
+	// Swap only complete sets, so a failed reload keeps serving the previous translations
+	i.mu.Lock()
+	i.translations = translations
+	i.meta = meta
+	i.sources = sources
+	i.mu.Unlock()
+
 	if i.debug {
-		slog.Debug("[LANG] All translations loaded", "langs", len(i.translations))
+		slog.Debug("[LANG] All translations loaded", "langs", len(translations))
 	}
 	return nil
 }
@@ -119,7 +169,44 @@ func (i *I18n) ReloadLocales(dir string) error {
 	return i.LoadLocales(dir)
 }
 
-// T translates a key into the requested language, with support for arguments.
+// Reload loads the sources of the last Load again, e.g. after translators edited the files.
+func (i *I18n) Reload() error {
+	i.mu.RLock()
+	sources := i.sources
+	i.mu.RUnlock()
+	if len(sources) == 0 {
+		return fmt.Errorf("no locales loaded")
+	}
+	slog.Info("[LANG] Reloading locales", "sources", len(sources))
+	return i.Load(sources...)
+}
+
+// flatten adds the strings of a nested JSON object to entries under dot-separated keys:
+// {"mail": {"subject": "..."}} becomes "mail.subject".
+func flatten(entries map[string]string, prefix string, tree map[string]any) error {
+	for k, v := range tree {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case string:
+			entries[key] = v
+		case map[string]any:
+			if err := flatten(entries, key, v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("key %s: want a string or an object, got %T", key, v)
+		}
+	}
+	return nil
+}
+
+// T translates a key into the requested language. Arguments are either positional, formatted with
+// fmt verbs ("%d members"), or a single map of named values for {{.Name}} placeholders. Keys with
+// plural forms ({"one": ..., "other": ...}) are picked by the CLDR rule of the language for the
+// count: the first numeric argument, or the "Count" value of a map.
 func (i *I18n) T(key, lang string, args ...any) string {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
@@ -132,30 +219,119 @@ func (i *I18n) T(key, lang string, args ...any) string {
 		slog.Debug("[LANG] Looking up key", "key", key, "lang", lang, "available_keys", keys)
 	}
 
-	val := i.getTranslation(key, lang)
+	var val string
+	if n, ok := pluralCount(args); ok {
+		val = i.getPlural(key, lang, n)
+	}
+	if val == "" {
+		val = i.getTranslation(key, lang)
+	}
 	if val == "" {
 		slog.Warn("[LANG] Missing translation", "key", key, "lang", lang)
 		val = key // Fallback to the key
 	}
 
-	if len(args) > 0 {
+	if len(args) == 1 {
+		if data, ok := args[0].(map[string]any); ok {
+			return interpolate(val, data)
+		}
+	}
+	if len(args) > 0 && strings.Contains(val, "%") {
 		return fmt.Sprintf(val, args...)
 	}
 	return val
 }
 
-// getTranslation retrieves a translation with fallback to base language and default language.
-func (i *I18n) getTranslation(key, lang string) string {
-	if v, ok := i.translations[lang][key]; ok {
-		return v
+// pluralCount returns the count selecting the plural form among args.
+func pluralCount(args []any) (int64, bool) {
+	if len(args) == 1 {
+		if data, ok := args[0].(map[string]any); ok {
+			return toInt(data["Count"])
+		}
+	}
+	for _, a := range args {
+		if n, ok := toInt(a); ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// getPlural retrieves the plural form of key for n, following the same fallbacks as getTranslation.
+// An explicit "zero" form is used for 0 in every language.
+func (i *I18n) getPlural(key, lang string, n int64) string {
+	for _, l := range i.fallbacks(lang) {
+		forms := []string{key + "." + PluralCategory(l, n), key + "." + Other}
+		if n == 0 {
+			forms = append([]string{key + "." + Zero}, forms...)
+		}
+		for _, k := range forms {
+			if v, ok := i.translations[l][k]; ok {
+				return v
+			}
+		}
 	}
+	return ""
+}
+
+// fallbacks returns the languages searched for lang: itself, its base language and the default.
+func (i *I18n) fallbacks(lang string) []string {
+	langs := []string{lang}
 	if base := strings.Split(lang, "-")[0]; base != lang {
-		if v, ok := i.translations[base][key]; ok {
-			return v
+		langs = append(langs, base)
+	}
+	return append(langs, i.defaultLang)
+}
+
+// placeholders caches the parsed templates of translations with named placeholders.
+var placeholders sync.Map
+
+// interpolate replaces the {{.Name}} placeholders of val with the values of data.
+func interpolate(val string, data map[string]any) string {
+	if !strings.Contains(val, "{{") {
+		return val
+	}
+	cached, ok := placeholders.Load(val)
+	if !ok {
+		tmpl, err := template.New("").Option("missingkey=error").Parse(val)
+		if err != nil {
+			slog.Warn("[LANG] Invalid placeholder", "text", val, "err", err)
+			return val
 		}
+		cached, _ = placeholders.LoadOrStore(val, tmpl)
+	}
+	var b strings.Builder
+	if err := cached.(*template.Template).Execute(&b, data); err != nil {
+		slog.Warn("[LANG] Failed to interpolate", "text", val, "err", err)
+		return val
 	}
-	if v, ok := i.translations[i.defaultLang][key]; ok {
-		return v
+	return b.String()
+}
+
+// getTranslation retrieves a translation with fallback to base language and default language.
+func (i *I18n) getTranslation(key, lang string) string {
+	for _, l := range i.fallbacks(lang) {
+		if v, ok := i.translations[l][key]; ok {
+			return v
+		}
 	}
 	return ""
 }
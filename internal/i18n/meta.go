@@ -0,0 +1,70 @@
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+)
+
+// metaSuffix names the metadata file of a language next to its translations: ar.meta.json.
+const metaSuffix = ".meta"
+
+// LocaleMeta describes a language beyond its translations, read from <lang>.meta.json.
+type LocaleMeta struct {
+	Dir string `json:"dir"` // Writing direction, "ltr" or "rtl"
+}
+
+// rtlLangs are the base languages written right to left when their metadata does not say otherwise.
+var rtlLangs = map[string]bool{"ar": true, "he": true, "fa": true, "ur": true}
+
+// loadMeta reads the metadata files of fsys into meta; later sources override earlier ones.
+func loadMeta(fsys fs.FS, meta map[string]LocaleMeta) error {
+	files, err := fs.Glob(fsys, "*"+metaSuffix+".json")
+	if err != nil {
+		return fmt.Errorf("failed to list locale metadata files: %w", err)
+	}
+	for _, file := range files {
+		lang := strings.TrimSuffix(file, metaSuffix+".json")
+		if !isValidLang(lang) {
+			slog.Warn("[LANG] Invalid language code, skipping", "lang", lang, "file", file)
+			continue
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to read locale metadata %s: %w", file, err)
+		}
+		var m LocaleMeta
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("invalid JSON format in %s: %w", file, err)
+		}
+		if m.Dir != "" && m.Dir != "ltr" && m.Dir != "rtl" {
+			return fmt.Errorf("invalid dir %q in %s: want ltr or rtl", m.Dir, file)
+		}
+		meta[lang] = m
+	}
+	return nil
+}
+
+// Dir returns the writing direction of lang, "rtl" or "ltr": from its metadata file, then from its
+// base language's, then from the known right-to-left languages (Arabic, Hebrew, Persian, Urdu).
+func (i *I18n) Dir(lang string) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	base, _, _ := strings.Cut(lang, "-")
+	for _, l := range []string{lang, base} {
+		if m, ok := i.meta[l]; ok && m.Dir != "" {
+			return m.Dir
+		}
+	}
+	if rtlLangs[base] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// IsRTL reports whether lang is written right to left.
+func (i *I18n) IsRTL(lang string) bool {
+	return i.Dir(lang) == "rtl"
+}
@@ -0,0 +1,99 @@
+package i18n
+
+import "strings"
+
+// Plural categories of the CLDR plural rules.
+const (
+	Zero  = "zero"
+	One   = "one"
+	Two   = "two"
+	Few   = "few"
+	Many  = "many"
+	Other = "other"
+)
+
+// pluralRules maps base languages to the CLDR cardinal rule of integers; languages not listed
+// follow the English rule (one for 1, other otherwise).
+var pluralRules = map[string]func(n int64) string{
+	"fr": func(n int64) string { return oneIf(n == 0 || n == 1) },
+	"pt": func(n int64) string { return oneIf(n == 0 || n == 1) },
+	"ja": otherOnly, "zh": otherOnly, "ko": otherOnly, "vi": otherOnly, "th": otherOnly, "id": otherOnly, "tr": otherOnly,
+	"ru": slavic, "uk": slavic, "be": slavic,
+	"pl": func(n int64) string {
+		switch {
+		case n == 1:
+			return One
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return Few
+		}
+		return Many
+	},
+	"cs": czech, "sk": czech,
+	"ar": func(n int64) string {
+		switch {
+		case n == 0:
+			return Zero
+		case n == 1:
+			return One
+		case n == 2:
+			return Two
+		case n%100 >= 3 && n%100 <= 10:
+			return Few
+		case n%100 >= 11:
+			return Many
+		}
+		return Other
+	},
+	"he": func(n int64) string {
+		switch n {
+		case 1:
+			return One
+		case 2:
+			return Two
+		}
+		return Other
+	},
+}
+
+// PluralCategory returns the CLDR plural category of the count n in lang, e.g. "one" or "few".
+func PluralCategory(lang string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if rule, ok := pluralRules[base]; ok {
+		return rule(n)
+	}
+	return oneIf(n == 1)
+}
+
+func oneIf(one bool) string {
+	if one {
+		return One
+	}
+	return Other
+}
+
+func otherOnly(int64) string { return Other }
+
+// slavic is the rule of Russian, Ukrainian and Belarusian.
+func slavic(n int64) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return One
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return Few
+	}
+	return Many
+}
+
+// czech is the rule of Czech and Slovak.
+func czech(n int64) string {
+	switch {
+	case n == 1:
+		return One
+	case n >= 2 && n <= 4:
+		return Few
+	}
+	return Other
+}
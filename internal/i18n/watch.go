@@ -0,0 +1,68 @@
+package i18n
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Watch reloads the translations whenever a JSON file of dir is added, changed or removed, checking
+// every interval until ctx is done. It polls modification times, which is enough for translators
+// editing files in development; production servers reload on demand with Reload.
+func (i *I18n) Watch(ctx context.Context, dir string, interval time.Duration) {
+	slog.Info("[LANG] Watching locales", "dir", dir, "interval", interval)
+	last := snapshot(dir)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := snapshot(dir)
+		if sameSnapshot(last, current) {
+			continue
+		}
+		last = current
+		if err := i.Reload(); err != nil {
+			// The previous translations stay in place until the files are fixed
+			slog.Error("[LANG] Failed to reload locales", "dir", dir, "err", err)
+		}
+	}
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the stamps of the JSON files of dir.
+func snapshot(dir string) map[string]fileStamp {
+	fsys := os.DirFS(dir)
+	files, _ := fs.Glob(fsys, "*.json")
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		info, err := fs.Stat(fsys, file)
+		if err != nil {
+			continue
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps
+}
+
+func sameSnapshot(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, stamp := range a {
+		if other, ok := b[file]; !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+// Package render executes the page templates of tenkit. An Engine loads the built-in templates
+// (templates.FS) under the files of TEMPLATES_DIR and of the layers added with Override, so that
+// an application replaces any built-in page or layout by a file of the same name:
+//
+//	engine := render.NewEngine(cfg.Templates, templates.FS)
+//	engine.Override(appTemplates) // e.g. an embed.FS
+//	login := engine.MustPage("login", "login.html")
+//	render.RenderTemplate(w, login, "base", render.BaseTemplateData(r, tr, nil))
+//
+// TEMPLATES_RELOAD=true parses pages again on every render. Every template gets the functions
+// date, datetime, number, currency, markdown and asset (see RegisterFunc), and the page data
+// carries .T, .Format, .Brand, .TenantURL and the other helpers of TemplateData. Partial renders
+// only the content block for htmx requests and Redirect answers them with HX-Redirect.
+package render
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// DefaultLayouts are the layout files parsed with every page; "base" is the template pages render.
+var DefaultLayouts = []string{"base.html", "header.html", "meta.html", "pager.html", "notifications_menu.html", "challenge.html"}
+
+// Engine loads page templates from a stack of file systems: override layers first, then the built-in
+// templates, so applications replace any built-in file (layout or page) by supplying one with the same
+// name. Pages are registered by name at startup; in reload mode they are parsed again on every
+// render, so edits on disk show up without restarting.
+type Engine struct {
+	Layouts []string         // Parsed before the files of every page, DefaultLayouts unless changed
+	Funcs   template.FuncMap // Functions of this engine, over those of RegisterFunc
+
+	mu     sync.RWMutex
+	layers []fs.FS
+	reload bool
+	pages  map[string]*Page
+}
+
+// NewEngine returns an engine serving the built-in templates, e.g. templates.FS, overridden by the
+// files of cfg.Dir when set.
+func NewEngine(cfg multitenant.TemplatesConfig, builtin fs.FS) *Engine {
+	e := &Engine{
+		Layouts: append([]string{}, DefaultLayouts...),
+		Funcs:   template.FuncMap{},
+		layers:  []fs.FS{builtin},
+		reload:  cfg.Reload,
+		pages:   map[string]*Page{},
+	}
+	if cfg.Dir != "" {
+		e.Override(os.DirFS(cfg.Dir))
+	}
+	slog.Info("[RENDER] Template engine ready", "overrides", cfg.Dir, "reload", cfg.Reload)
+	return e
+}
+
+// Override adds a layer searched before the previous ones, e.g. an application's embed.FS.
+// Pages registered afterwards pick up its files; register pages once the layers are in place.
+func (e *Engine) Override(fsys fs.FS) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.layers = append([]fs.FS{fsys}, e.layers...)
+}
+
+// Page registers the page name, made of the layouts and files, and parses it so that errors show
+// up at startup. Registering a name again replaces the page.
+func (e *Engine) Page(name string, files ...string) (*Page, error) {
+	p := &Page{Name: name, engine: e, files: files}
+	tmpl, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	p.tmpl = tmpl
+	e.mu.Lock()
+	e.pages[name] = p
+	e.mu.Unlock()
+	return p, nil
+}
+
+// MustPage is Page for the built-in pages; it panics when the templates do not parse.
+func (e *Engine) MustPage(name string, files ...string) *Page {
+	p, err := e.Page(name, files...)
+	if err != nil {
+		slog.Error("[RENDER] Failed to parse page", "page", name, "err", err)
+		panic(err)
+	}
+	return p
+}
+
+// Lookup returns the registered page name, or nil.
+func (e *Engine) Lookup(name string) *Page {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.pages[name]
+}
+
+// open returns the content of file from the first layer that has it.
+func (e *Engine) open(file string) ([]byte, error) {
+	e.mu.RLock()
+	layers := e.layers
+	e.mu.RUnlock()
+	for _, fsys := range layers {
+		b, err := fs.ReadFile(fsys, file)
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("render: read %s: %w", file, err)
+		}
+	}
+	return nil, fmt.Errorf("render: template %s not found", file)
+}
+
+// Page is a registered page: the layouts plus its own files.
+type Page struct {
+	Name   string
+	engine *Engine
+	files  []string
+
+	mu   sync.RWMutex
+	tmpl *template.Template
+}
+
+// Template returns the parsed page, parsed again from the layers in reload mode.
+func (p *Page) Template() (*template.Template, error) {
+	if p.engine.reload {
+		tmpl, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.tmpl = tmpl
+		p.mu.Unlock()
+		return tmpl, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tmpl, nil
+}
+
+// ExecuteTemplate executes the template name of the page, e.g. "base"; see RenderTemplate.
+func (p *Page) ExecuteTemplate(w io.Writer, name string, data any) error {
+	tmpl, err := p.Template()
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+// parse parses the layouts and files of the page like template.ParseFiles: each file defines a
+// template named after its base name.
+func (p *Page) parse() (*template.Template, error) {
+	tmpl := template.New("base").Funcs(Funcs()).Funcs(p.engine.Funcs)
+	for _, file := range append(append([]string{}, p.engine.Layouts...), p.files...) {
+		b, err := p.engine.open(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.New(path.Base(file)).Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/assets"
+)
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = template.FuncMap{
+		"date":     formatDate,
+		"datetime": formatDateTime,
+		"number":   formatNumber,
+		"currency": formatCurrency,
+		"markdown": Markdown,
+		"asset":    AssetURL,
+		"dict":     dict,
+	}
+)
+
+// RegisterFunc adds a function available to every template, replacing any built-in one of the same
+// name. Register functions at startup, before the pages using them are registered.
+func RegisterFunc(name string, fn any) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	funcs[name] = fn
+}
+
+// Funcs returns a copy of the functions available to every template.
+func Funcs() template.FuncMap {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	out := make(template.FuncMap, len(funcs))
+	for name, fn := range funcs {
+		out[name] = fn
+	}
+	return out
+}
+
+// dict builds a map from key/value pairs, e.g. the named arguments of a translation:
+// {{ call .T "groups.joined" (dict "Name" .Name "Count" .Members) }}.
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict: odd number of arguments")
+	}
+	m := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict: key %v is not a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// tenantLocation returns the time zone of tenant, UTC on the root domain or for unknown zones.
+func tenantLocation(tenant *multitenant.Tenant) *time.Location {
+	if tenant == nil || tenant.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tenant.Timezone)
+	if err != nil {
+		slog.Warn("[RENDER] Unknown tenant time zone", "tenant", tenant.Subdomain, "timezone", tenant.Timezone)
+		return time.UTC
+	}
+	return loc
+}
+
+// userLocation returns the time zone chosen by user, or the one of tenant when they have none.
+func userLocation(user *models.User, tenant *multitenant.Tenant) *time.Location {
+	if user != nil && user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
+		slog.Warn("[RENDER] Unknown user time zone", "user_id", user.ID, "timezone", user.Timezone)
+	}
+	return tenantLocation(tenant)
+}
+
+// defaultFormatter formats in the default language, for the functions called without the page's
+// language; pages use TemplateData.Format.
+func defaultFormatter(tenant *multitenant.Tenant) i18n.Formatter {
+	lang := "en"
+	if Config != nil {
+		lang = Config.I18n.DefaultLang
+	}
+	return i18n.NewFormatter(lang, tenantLocation(tenant))
+}
+
+// formatDate formats t as a date in the tenant's time zone: {{ date .Extra.CreatedAt .Tenant }}.
+func formatDate(t time.Time, tenant *multitenant.Tenant) string {
+	return defaultFormatter(tenant).Date(t)
+}
+
+// formatDateTime formats t with its time in the tenant's time zone.
+func formatDateTime(t time.Time, tenant *multitenant.Tenant) string {
+	return defaultFormatter(tenant).DateTime(t)
+}
+
+// formatNumber groups the thousands of v, with two decimals for non-integers: 1234567 is "1,234,567".
+func formatNumber(v any) string {
+	return defaultFormatter(nil).Number(v)
+}
+
+// formatCurrency formats an amount in major units with its currency: {{ currency 12.5 "EUR" }} is "€12.50".
+func formatCurrency(v any, code string) string {
+	return defaultFormatter(nil).Currency(v, code)
+}
+
+// Assets serves the static files AssetURL links to; set it at startup. Without it, AssetURL returns
+// unversioned URLs under /static/.
+var Assets *assets.Server
+
+// AssetURL returns the URL of a static file under its content-hashed name, so browsers can cache it
+// for good: {{ asset "app.css" }} is "/static/app.3f2a1b9c.css".
+func AssetURL(name string) string {
+	if Assets == nil {
+		return "/static/" + strings.TrimPrefix(path.Clean("/"+name), "/")
+	}
+	return Assets.URL(name)
+}
@@ -0,0 +1,94 @@
+package render
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdItalic = regexp.MustCompile(`\*([^*]+)\*`)
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+)
+
+// Markdown renders a small, safe subset of Markdown written by tenants (welcome messages,
+// descriptions): paragraphs, "#" headings, "-" lists, **bold**, *italic*, `code` and links to http(s)
+// or relative URLs. Everything else is escaped: {{ markdown .Extra.Welcome }}.
+func Markdown(src string) template.HTML {
+	var b strings.Builder
+	inList := false
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + strings.Join(para, "<br>") + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			b.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+			closeList()
+		case strings.HasPrefix(trimmed, "#"):
+			flush()
+			closeList()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 {
+				level = 6
+			}
+			tag := "h" + string(rune('0'+level))
+			b.WriteString("<" + tag + ">" + inline(strings.TrimSpace(trimmed[level:])) + "</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "):
+			flush()
+			if !inList {
+				b.WriteString("<ul>\n")
+				inList = true
+			}
+			b.WriteString("<li>" + inline(strings.TrimSpace(trimmed[2:])) + "</li>\n")
+		default:
+			closeList()
+			para = append(para, inline(trimmed))
+		}
+	}
+	flush()
+	closeList()
+	return template.HTML(b.String())
+}
+
+// inline escapes a line and renders its emphasis, code and links.
+func inline(s string) string {
+	s = html.EscapeString(s)
+	s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+	s = mdLink.ReplaceAllStringFunc(s, func(m string) string {
+		parts := mdLink.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[2])
+		if !safeHref(href) {
+			return parts[1]
+		}
+		return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">` + parts[1] + `</a>`
+	})
+	s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = mdItalic.ReplaceAllString(s, "<em>$1</em>")
+	return s
+}
+
+// safeHref accepts http(s) and relative links, rejecting javascript: and other schemes.
+func safeHref(href string) bool {
+	lower := strings.ToLower(href)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return true
+	}
+	return strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//")
+}
@@ -0,0 +1,34 @@
+package render
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// IsPartial reports whether r was sent by htmx to swap part of the page (HX-Request), rather than a
+// boosted navigation (HX-Boosted) or a regular browser request, which get the whole page.
+func IsPartial(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true"
+}
+
+// Partial renders only the template block of tmpl, e.g. "content", for htmx requests, and the whole
+// "base" page otherwise, so form handlers serve both with the same call.
+func Partial(w http.ResponseWriter, r *http.Request, tmpl Executor, block string, data TemplateData) {
+	if !IsPartial(r) {
+		RenderTemplate(w, tmpl, "base", data)
+		return
+	}
+	slog.DebugContext(r.Context(), "[RENDER] Rendering partial", "block", block, "target", r.Header.Get("HX-Target"))
+	RenderTemplate(w, tmpl, block, data)
+}
+
+// Redirect redirects to url. htmx follows redirects in place, swapping the target page into the
+// fragment, so its requests get an HX-Redirect header making the browser navigate instead.
+func Redirect(w http.ResponseWriter, r *http.Request, url string, code int) {
+	if IsPartial(r) {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, url, code)
+}
@@ -1,25 +1,99 @@
 package render
 
 import (
+	"context"
+	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pandamasta/tenkit/internal/i18n"
 	"github.com/pandamasta/tenkit/models"
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cache"
+	tkerrors "github.com/pandamasta/tenkit/multitenant/errors"
+	"github.com/pandamasta/tenkit/multitenant/features"
 	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/qr"
+	"github.com/pandamasta/tenkit/multitenant/urls"
 )
 
 type TemplateData struct {
 	Tenant    *multitenant.Tenant
 	User      *models.User
 	Lang      string
+	Dir       string // Writing direction of Lang, "ltr" or "rtl", for the dir attribute
+	IsRTL     bool
 	CSRFToken string
-	T         func(key string, args ...any) string
-	Extra     map[string]any
+	RequestID string
+	// SupportCode is the short code users quote to support, set on pages showing Extra["Error"]
+	SupportCode string
+	T           func(key string, args ...any) string
+	// Format formats dates in the tenant's time zone and numbers in the page's language:
+	// {{ .Format.DateTime .Extra.CreatedAt }}, {{ .Format.Currency 12.5 "EUR" }}
+	Format i18n.Formatter
+	QR     func(data string) template.HTML
+	// MarketingURL and TenantURL return absolute URLs on the root domain and on the current tenant's
+	// site (the root domain outside tenants), e.g. {{ call .MarketingURL "/enroll" }}
+	MarketingURL func(path string) string
+	TenantURL    func(path string) string
+	// Path returns a path of the site in the page's language, /fr/login in URL-prefix mode
+	Path func(path string) string
+	// UnreadCount returns the number of unread notifications of the user; it is nil outside tenant
+	// sites, for visitors and when the notifications flow is disabled: {{ call .UnreadCount }}
+	UnreadCount func() int
+	// Feature reports whether a feature flag is on for the tenant and user: {{ if call .Feature "new_dashboard" }}
+	Feature func(name string) bool
+	Nav     []multitenant.NavItem
+	Meta    PageMeta
+	Brand   BrandData
+	Preview bool // Served on the tenant's preview host
+	// Impersonation is set while a platform admin browses as User; templates show a banner
+	Impersonation *Impersonation
+	Extra         map[string]any
 }
 
+// Impersonation describes an impersonation session for the banner.
+type Impersonation struct {
+	Operator  string // Email of the platform admin
+	ExpiresAt time.Time
+}
+
+// BrandData exposes the tenant's branding to templates; it is empty on the root domain.
+type BrandData struct {
+	PrimaryColor   string
+	SecondaryColor string
+	Theme          string // data-theme of the page, empty for the default theme
+	LogoURL        string
+	CSSURL         string // Versioned per-tenant stylesheet
+}
+
+// PageMeta is rendered by the "meta" partial as description and Open Graph tags.
+type PageMeta struct {
+	Title       string
+	Description string
+	Image       string // Absolute URL, empty for no og:image
+	URL         string // Canonical URL of the page, without query
+	SiteName    string
+	// Alternates are the page in every language, rendered as hreflang links in URL-prefix mode
+	Alternates []Alternate
+}
+
+// Alternate is the URL of a page in one language; Lang "x-default" is the language-negotiating URL.
+type Alternate struct {
+	Lang string
+	URL  string
+}
+
+// Config is the configuration the URL functions of TemplateData build URLs with; set it at startup.
+// Without it, they return path unchanged.
+var Config *multitenant.Config
+
 func BaseTemplateData(r *http.Request, i18n *i18n.I18n, extra map[string]any) TemplateData {
 	ctx := r.Context()
 	tenant := middleware.FromContext(ctx)
@@ -30,24 +104,202 @@ func BaseTemplateData(r *http.Request, i18n *i18n.I18n, extra map[string]any) Te
 	slog.Debug("[RENDER] BaseTemplateData", "lang", lang, "tenant", tenant != nil, "user", user != nil, "csrf", csrf != "")
 
 	return TemplateData{
-		Tenant:    tenant,
-		User:      user,
-		Lang:      lang,
-		CSRFToken: csrf,
+		Tenant:      tenant,
+		User:        user,
+		Lang:        lang,
+		Dir:         i18n.Dir(lang),
+		IsRTL:       i18n.IsRTL(lang),
+		CSRFToken:   csrf,
+		RequestID:   middleware.RequestIDFromContext(ctx),
+		SupportCode: supportCode(r, extra),
 		T: func(key string, args ...any) string {
 			slog.Debug("[RENDER] Translation called", "key", key, "lang", lang, "args", args)
 			result := i18n.T(key, lang, args...)
 			slog.Debug("[RENDER] Translation result", "key", key, "lang", lang, "result", result)
 			return result
 		},
-		Extra: extra,
+		Format:        FormatterFor(r),
+		QR:            inlineQR,
+		MarketingURL:  marketingURL,
+		TenantURL:     func(path string) string { return tenantURL(tenant, path) },
+		Path:          func(path string) string { return middleware.LangPath(ctx, path) },
+		Feature:       func(name string) bool { return features.Enabled(ctx, name) },
+		UnreadCount:   unreadCount(ctx, tenant, user),
+		Nav:           tenantNav(r, tenant, user),
+		Meta:          pageMeta(r, i18n, lang, tenant),
+		Brand:         brandData(tenant),
+		Preview:       middleware.IsPreview(ctx),
+		Impersonation: impersonation(user),
+		Extra:         extra,
+	}
+}
+
+// FormatterFor returns the formatter of the request: its language and the time zone of its user,
+// or else of its tenant, for handlers formatting outside templates, e.g. in CSV exports or emails.
+func FormatterFor(r *http.Request) i18n.Formatter {
+	return i18n.NewFormatter(middleware.LangFromContext(r.Context()), userLocation(middleware.CurrentUser(r), middleware.FromContext(r.Context())))
+}
+
+// supportCode records and returns the support code of pages rendering an error.
+func supportCode(r *http.Request, extra map[string]any) string {
+	if msg, _ := extra["Error"].(string); msg == "" {
+		return ""
 	}
+	return middleware.SupportCode(r, 0)
 }
 
-func RenderTemplate(w http.ResponseWriter, tmpl *template.Template, name string, data TemplateData) {
+// tenantNav returns the navigation items visible to the current visitor on a tenant site.
+func tenantNav(r *http.Request, tenant *multitenant.Tenant, user *models.User) []multitenant.NavItem {
+	if tenant == nil {
+		return nil
+	}
+	hidden, err := cache.LoadTenant(r.Context(), tenant.ID, "nav", func(ctx context.Context) (map[string]bool, error) {
+		return models.GetHiddenNavItems(ctx, tenant.ID)
+	})
+	if err != nil {
+		slog.Error("[RENDER] Failed to load hidden nav items", "tenant", tenant.Subdomain, "err", err)
+	}
+	role := ""
+	if user != nil {
+		role = user.Role
+	}
+	return multitenant.DefaultNav.Visible(role, user != nil, hidden)
+}
+
+// unreadCount returns the UnreadCount helper of a page. The count is loaded on the first call only,
+// so pages without the notification menu cost no query.
+func unreadCount(ctx context.Context, tenant *multitenant.Tenant, user *models.User) func() int {
+	if tenant == nil || user == nil || (Config != nil && !Config.Routes.Enabled(multitenant.FlowNotifications)) {
+		return nil
+	}
+	var once sync.Once
+	var n int
+	return func() int {
+		once.Do(func() {
+			var err error
+			if n, err = models.CountUnreadNotifications(ctx, tenant.ID, user.ID); err != nil {
+				slog.ErrorContext(ctx, "[RENDER] Failed to count unread notifications", "user_id", user.ID, "err", err)
+			}
+		})
+		return n
+	}
+}
+
+// brandData derives the template branding from the tenant loaded with the request.
+func brandData(tenant *multitenant.Tenant) BrandData {
+	if tenant == nil {
+		return BrandData{}
+	}
+	b := tenant.Brand
+	data := BrandData{
+		PrimaryColor:   b.PrimaryColor,
+		SecondaryColor: b.SecondaryColor,
+		Theme:          b.Theme,
+		CSSURL:         fmt.Sprintf("/branding/theme.css?v=%d", b.Version),
+	}
+	switch {
+	case strings.HasPrefix(b.LogoPath, "https://"), strings.HasPrefix(b.LogoPath, "http://"):
+		data.LogoURL = b.LogoPath
+	case b.LogoPath != "":
+		data.LogoURL = "/" + strings.TrimPrefix(b.LogoPath, "/")
+	}
+	return data
+}
+
+// pageMeta builds the share preview of the page from the tenant's meta settings.
+func pageMeta(r *http.Request, i18n *i18n.I18n, lang string, tenant *multitenant.Tenant) PageMeta {
+	origin := middleware.Scheme(r) + "://" + r.Host
+	meta := PageMeta{
+		Title:       i18n.T("base.title", lang),
+		Description: i18n.T("meta.default_description", lang),
+		URL:         origin + middleware.LangPath(r.Context(), r.URL.Path),
+		SiteName:    i18n.T("base.title", lang),
+		Alternates:  alternates(r, i18n, origin),
+	}
+	if tenant == nil {
+		return meta
+	}
+	meta.Title, meta.SiteName = tenant.Name, tenant.Name
+	s, err := cache.LoadTenant(r.Context(), tenant.ID, "meta", func(ctx context.Context) (*models.MetaSettings, error) {
+		return models.GetMetaSettings(ctx, tenant.ID)
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "[RENDER] Failed to load meta settings", "tenant", tenant.Subdomain, "err", err)
+	}
+	if s == nil {
+		return meta
+	}
+	if s.Title != "" {
+		meta.Title = s.Title
+	}
+	if s.Description != "" {
+		meta.Description = s.Description
+	}
+	switch {
+	case strings.HasPrefix(s.LogoPath, "https://"), strings.HasPrefix(s.LogoPath, "http://"):
+		meta.Image = s.LogoPath
+	case s.LogoPath != "":
+		meta.Image = origin + "/" + strings.TrimPrefix(s.LogoPath, "/")
+	}
+	return meta
+}
+
+// alternates lists the page in every available language when it is served under a language prefix.
+func alternates(r *http.Request, i18n *i18n.I18n, origin string) []Alternate {
+	if !middleware.HasLangPrefix(r.Context()) {
+		return nil
+	}
+	langs := make([]string, 0)
+	for l := range i18n.Translations() {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	out := make([]Alternate, 0, len(langs)+1)
+	for _, l := range langs {
+		out = append(out, Alternate{Lang: l, URL: origin + middleware.LocalizePath(r.URL.Path, l)})
+	}
+	return append(out, Alternate{Lang: "x-default", URL: origin + r.URL.Path})
+}
+
+// marketingURL returns the absolute URL of path on the root domain.
+func marketingURL(path string) string {
+	if Config == nil {
+		return path
+	}
+	return urls.Marketing(Config, path, nil)
+}
+
+// tenantURL returns the absolute URL of path on the site of tenant, or on the root domain for nil.
+func tenantURL(tenant *multitenant.Tenant, path string) string {
+	if Config == nil {
+		return path
+	}
+	if tenant == nil {
+		return urls.Marketing(Config, path, nil)
+	}
+	return urls.Tenant(Config, tenant, path, nil)
+}
+
+// inlineQR renders data as an inline SVG QR code, e.g. {{ call .QR .Extra.InviteURL }}.
+func inlineQR(data string) template.HTML {
+	code, err := qr.Encode(data, qr.Medium)
+	if err != nil {
+		slog.Error("[RENDER] Failed to encode QR code", "err", err)
+		return ""
+	}
+	return template.HTML(code.SVG(4))
+}
+
+// Executor is a parsed set of templates: a *Page of an Engine, or a plain *template.Template.
+type Executor interface {
+	ExecuteTemplate(w io.Writer, name string, data any) error
+}
+
+func RenderTemplate(w http.ResponseWriter, tmpl Executor, name string, data TemplateData) {
 	slog.Debug("[RENDER] Rendering template", "name", name, "lang", data.Lang)
 	if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
 		slog.Error("[RENDER] Template execution failed", "err", err)
+		reportRenderError(name, err, data)
 		// Vérifier si l'en-tête a déjà été écrit
 		if w.Header().Get("Content-Type") == "" {
 			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -56,3 +308,24 @@ func RenderTemplate(w http.ResponseWriter, tmpl *template.Template, name string,
 		}
 	}
 }
+
+// reportRenderError passes a template failure to the error reporter with the tenant and user of the
+// page.
+func reportRenderError(name string, err error, data TemplateData) {
+	rep := tkerrors.Report{Err: fmt.Errorf("template %s: %w", name, err), Stack: tkerrors.Stack(1), RequestID: data.RequestID}
+	if data.Tenant != nil {
+		rep.TenantID, rep.Tenant = data.Tenant.ID, data.Tenant.Subdomain
+	}
+	if data.User != nil {
+		rep.UserID, rep.UserEmail = data.User.ID, data.User.Email
+	}
+	tkerrors.Capture(context.Background(), rep)
+}
+
+// impersonation returns the banner data of an impersonation session, nil for regular sessions.
+func impersonation(user *models.User) *Impersonation {
+	if user == nil || user.ImpersonatorID == 0 {
+		return nil
+	}
+	return &Impersonation{Operator: user.ImpersonatorEmail, ExpiresAt: user.SessionExpires}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// GetACMECache returns a cached ACME entry (certificate, account key), or nil when absent.
+func GetACMECache(ctx context.Context, key string) ([]byte, error) {
+	row := db.LogQueryRow(ctx, db.DB, `SELECT data FROM acme_cache WHERE key = ?`, key)
+	var data []byte
+	err := row.Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func PutACMECache(ctx context.Context, key string, data []byte) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO acme_cache (key, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		key, data, time.Now())
+	return err
+}
+
+func DeleteACMECache(ctx context.Context, key string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM acme_cache WHERE key = ?`, key)
+	return err
+}
+
+// IsActiveCustomDomain reports whether host is the custom domain of an active tenant,
+// i.e. whether a certificate may be requested for it.
+func IsActiveCustomDomain(ctx context.Context, host string) (bool, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT COUNT(*) FROM tenants
+		WHERE custom_domain = ? AND is_active = 1 AND is_deleted = 0`, host)
+	var n int
+	if err := row.Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// APIKeyPrefix starts every key so leaked keys are easy to recognise in code scanners.
+const APIKeyPrefix = "tk_"
+
+// APIKey is a tenant-scoped credential for the public API. The secret itself is never stored.
+type APIKey struct {
+	ID         int64
+	TenantID   int64
+	Name       string
+	Prefix     string // First characters of the key, shown in the dashboard
+	Tier       string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+// APIKeyUsage is one day of requests made with a key.
+type APIKeyUsage struct {
+	Day       string
+	Requests  int64
+	Throttled int64
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey mints a new key for the tenant and returns it in clear; it cannot be shown again.
+func CreateAPIKey(ctx context.Context, tenantID, createdBy int64, name, tier string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO api_keys (tenant_id, name, prefix, key_hash, tier, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		tenantID, name, key[:len(APIKeyPrefix)+6], hashAPIKey(key), tier, nullInt(createdBy))
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// GetAPIKeyBySecret returns the active key matching the clear secret, or nil.
+func GetAPIKeyBySecret(ctx context.Context, secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, nil
+	}
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, tenant_id, name, prefix, tier, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`, hashAPIKey(secret))
+	var k APIKey
+	err := row.Scan(&k.ID, &k.TenantID, &k.Name, &k.Prefix, &k.Tier, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns the tenant's keys, active ones first.
+func ListAPIKeys(ctx context.Context, tenantID int64) ([]APIKey, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, tenant_id, name, prefix, tier, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE tenant_id = ?
+		ORDER BY revoked_at IS NOT NULL, created_at DESC`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIKey
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.TenantID, &k.Name, &k.Prefix, &k.Tier, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey disables a key of the tenant. Revoked keys are kept for their usage history.
+func RevokeAPIKey(ctx context.Context, tenantID, keyID int64) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL`,
+		time.Now(), keyID, tenantID)
+	return err
+}
+
+// RecordAPIKeyUsage counts a request against today's usage of the key.
+func RecordAPIKeyUsage(ctx context.Context, keyID int64, throttled bool) error {
+	now := time.Now().UTC()
+	t := 0
+	if throttled {
+		t = 1
+	}
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO api_key_usage (key_id, day, requests, throttled) VALUES (?, ?, 1, ?)
+		ON CONFLICT(key_id, day) DO UPDATE SET requests = requests + 1, throttled = throttled + excluded.throttled`,
+		keyID, now.Format("2006-01-02"), t)
+	if err != nil {
+		return err
+	}
+	if !throttled {
+		_, err = db.LogExec(ctx, db.DB, `UPDATE api_keys SET last_used_at = ? WHERE id = ?`, now, keyID)
+	}
+	return err
+}
+
+// GetAPIKeyUsage returns the key's usage over the last days, most recent first.
+func GetAPIKeyUsage(ctx context.Context, keyID int64, days int) ([]APIKeyUsage, error) {
+	since := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT day, requests, throttled FROM api_key_usage
+		WHERE key_id = ? AND day > ? ORDER BY day DESC`, keyID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []APIKeyUsage
+	for rows.Next() {
+		var u APIKeyUsage
+		if err := rows.Scan(&u.Day, &u.Requests, &u.Throttled); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
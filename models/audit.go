@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+)
+
+// AuditEntry is a single security-relevant event recorded in audit_logs.
+type AuditEntry struct {
+	ID        int64
+	TenantID  int64 // 0 for platform-level events
+	UserID    int64 // 0 for anonymous requests
+	Action    string
+	IP        string
+	Details   string
+	RequestID string // Filled from the context by LogAudit
+	CreatedAt time.Time
+	UserEmail string // Filled by PageAuditEntries
+}
+
+// LogAudit records an audit entry. Failures are logged but never block the caller's flow.
+// Entries recorded during an impersonation name the operator in their details, and entries
+// recorded within a request keep its ID for support lookups.
+func LogAudit(ctx context.Context, e AuditEntry) error {
+	if by := ImpersonatorFromContext(ctx); by != "" {
+		e.Details = strings.TrimSpace(e.Details + " [impersonated by " + by + "]")
+	}
+	_, err := db.LogExec(ctx, db.DB,
+		`INSERT INTO audit_logs (tenant_id, user_id, action, ip, details, request_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		nullInt(e.TenantID), nullInt(e.UserID), e.Action, e.IP, e.Details, RequestIDFromContext(ctx))
+	if err != nil {
+		slog.Error("[AUDIT] Failed to record audit entry", "action", e.Action, "err", err)
+	}
+	return err
+}
+
+// nullInt maps zero IDs to NULL so anonymous and platform events stay distinguishable.
+func nullInt(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+// ListAuditEntries returns the tenant's audit log, oldest first.
+func ListAuditEntries(ctx context.Context, tenantID int64) ([]AuditEntry, error) {
+	return queryAuditEntries(ctx, `
+		SELECT id, COALESCE(tenant_id, 0), COALESCE(user_id, 0), action, COALESCE(ip, ''), COALESCE(details, ''),
+			COALESCE(request_id, ''), created_at
+		FROM audit_logs WHERE tenant_id = ? ORDER BY id`, tenantID)
+}
+
+// ListRequestAuditEntries returns the audit entries recorded while serving a request, oldest first.
+func ListRequestAuditEntries(ctx context.Context, requestID string) ([]AuditEntry, error) {
+	return queryAuditEntries(ctx, `
+		SELECT id, COALESCE(tenant_id, 0), COALESCE(user_id, 0), action, COALESCE(ip, ''), COALESCE(details, ''),
+			COALESCE(request_id, ''), created_at
+		FROM audit_logs WHERE request_id = ? ORDER BY id`, requestID)
+}
+
+// AuditList pages through an audit log, newest first. Filters: "action" matches an action or,
+// without a dot, a family of actions such as "membership"; "user" is a user ID or email.
+var AuditList = &pagination.List{
+	Mode:    pagination.CursorMode,
+	Limit:   50,
+	Sort:    "-id",
+	Filters: []string{"action", "user"},
+}
+
+// PageAuditEntries returns a page of the tenant's audit log, see AuditList.
+func PageAuditEntries(ctx context.Context, tenantID int64, req pagination.Request) ([]AuditEntry, pagination.Page, error) {
+	q := &pagination.Query{
+		Select: `a.id, COALESCE(a.tenant_id, 0), COALESCE(a.user_id, 0), a.action, COALESCE(a.ip, ''), COALESCE(a.details, ''),
+			COALESCE(a.request_id, ''), a.created_at, COALESCE(u.email, '')`,
+		From:     "audit_logs a LEFT JOIN users u ON u.id = a.user_id",
+		Tenant:   "a.tenant_id",
+		TenantID: tenantID,
+		ID:       "a.id",
+	}
+	if v := req.Filter("action"); v != "" {
+		if strings.Contains(v, ".") {
+			q.Where("a.action = ?", v)
+		} else {
+			q.Where(`a.action LIKE ? ESCAPE '\'`, pagination.Prefix(v+"."))
+		}
+	}
+	if v := req.Filter("user"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			q.Where("a.user_id = ?", id)
+		} else {
+			q.Where("u.email = ?", strings.ToLower(v))
+		}
+	}
+	return pagination.Fetch(ctx, q, req, func(rows *sql.Rows) (AuditEntry, error) {
+		var e AuditEntry
+		err := rows.Scan(&e.ID, &e.TenantID, &e.UserID, &e.Action, &e.IP, &e.Details, &e.RequestID, &e.CreatedAt, &e.UserEmail)
+		return e, err
+	}, func(e AuditEntry) int64 { return e.ID })
+}
+
+func queryAuditEntries(ctx context.Context, query string, args ...any) ([]AuditEntry, error) {
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.TenantID, &e.UserID, &e.Action, &e.IP, &e.Details, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// TenantBranding is the visual identity stored on the tenant row.
+type TenantBranding struct {
+	TenantID       int64
+	Name           string
+	PrimaryColor   string
+	SecondaryColor string
+	Theme          string // daisyUI theme name; empty for the platform default
+	LogoPath       string // URL or site path of the logo; empty when unset
+	LogoKey        string // Storage key of an uploaded logo, served at LogoPath
+	Version        int64  // Bumped on every change to bust caches
+}
+
+// GetTenantBranding returns the tenant's branding, or nil when the tenant does not exist.
+func GetTenantBranding(ctx context.Context, tenantID int64) (*TenantBranding, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, name, COALESCE(primary_color, ''), COALESCE(secondary_color, ''), COALESCE(theme, ''),
+			COALESCE(logo_path, ''), COALESCE(logo_key, ''), branding_version
+		FROM tenants WHERE id = ?`, tenantID)
+	var b TenantBranding
+	err := row.Scan(&b.TenantID, &b.Name, &b.PrimaryColor, &b.SecondaryColor, &b.Theme, &b.LogoPath, &b.LogoKey, &b.Version)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SetTenantColors saves the colors and theme of a tenant. Cached tenants are invalidated.
+func SetTenantColors(ctx context.Context, tenantID int64, primary, secondary, theme string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE tenants SET primary_color = ?, secondary_color = ?, theme = ?,
+			branding_version = branding_version + 1, updated_at = ?
+		WHERE id = ?`, primary, secondary, theme, time.Now(), tenantID)
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
+
+// SetTenantLogo records an uploaded logo (an empty key removes it). The logo path gets the new
+// branding version so that browsers fetch the new file. Cached tenants are invalidated.
+func SetTenantLogo(ctx context.Context, tenantID int64, key string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE tenants SET logo_key = NULLIF(?, ''),
+			logo_path = CASE WHEN ? = '' THEN NULL ELSE '/branding/logo?v=' || (branding_version + 1) END,
+			branding_version = branding_version + 1, updated_at = ?
+		WHERE id = ?`, key, key, time.Now(), tenantID)
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
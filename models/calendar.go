@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// CalendarSecret returns the secret the calendar feed URLs of a user of the tenant are bound to,
+// creating it on first use. It returns "" when the user belongs to another tenant.
+func CalendarSecret(ctx context.Context, tenantID, userID int64) (string, error) {
+	secret, err := GetCalendarSecret(ctx, tenantID, userID)
+	if err != nil || secret != "" {
+		return secret, err
+	}
+	secret, err = newCalendarSecret()
+	if err != nil {
+		return "", err
+	}
+	if _, err := db.LogExec(ctx, db.DB, `
+		UPDATE users SET calendar_secret = ? WHERE id = ? AND tenant_id = ? AND calendar_secret IS NULL`,
+		secret, userID, tenantID); err != nil {
+		return "", err
+	}
+	return GetCalendarSecret(ctx, tenantID, userID) // The one stored by a concurrent request wins
+}
+
+// GetCalendarSecret returns the calendar feed secret of a user of the tenant, "" when they have none.
+func GetCalendarSecret(ctx context.Context, tenantID, userID int64) (string, error) {
+	var secret string
+	err := db.LogQueryRow(ctx, db.DB, `
+		SELECT COALESCE(calendar_secret, '') FROM users WHERE id = ? AND tenant_id = ?`, userID, tenantID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return secret, err
+}
+
+// RotateCalendarSecret gives a user a new calendar feed secret, so that the URLs handed out
+// before stop working. It reports whether the user was found.
+func RotateCalendarSecret(ctx context.Context, tenantID, userID int64) (bool, error) {
+	secret, err := newCalendarSecret()
+	if err != nil {
+		return false, err
+	}
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE users SET calendar_secret = ? WHERE id = ? AND tenant_id = ?`, secret, userID, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func newCalendarSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrCustomDomainTaken is returned when verifying a domain another tenant already verified.
+var ErrCustomDomainTaken = errors.New("custom domain verified by another tenant")
+
+// CustomDomain is a domain a tenant wants to serve its site on. tenants.custom_domain
+// is only set once the domain is verified, so unverified domains never resolve. Several tenants
+// may claim the same domain; the first to verify it gets it and the other claims are dropped.
+type CustomDomain struct {
+	TenantID   int64
+	Domain     string
+	Token      string // Expected in the verification TXT record
+	IsVerified bool
+	VerifiedAt sql.NullTime
+	CheckedAt  sql.NullTime
+	LastError  sql.NullString
+}
+
+const customDomainColumns = `tenant_id, domain, token, is_verified, verified_at, checked_at, last_error`
+
+func scanCustomDomain(row interface{ Scan(...any) error }) (*CustomDomain, error) {
+	var d CustomDomain
+	err := row.Scan(&d.TenantID, &d.Domain, &d.Token, &d.IsVerified, &d.VerifiedAt, &d.CheckedAt, &d.LastError)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func GetCustomDomain(ctx context.Context, tenantID int64) (*CustomDomain, error) {
+	row := db.LogQueryRow(ctx, db.DB, `SELECT `+customDomainColumns+` FROM tenant_custom_domains WHERE tenant_id = ?`, tenantID)
+	d, err := scanCustomDomain(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// CustomDomainTaken reports whether another tenant already verified the domain. Unverified claims
+// do not count, so that nobody can hold a domain they do not control.
+func CustomDomainTaken(ctx context.Context, domain string, tenantID int64) (bool, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT COUNT(*) FROM tenant_custom_domains WHERE domain = ? AND tenant_id != ? AND is_verified = 1`, domain, tenantID)
+	var n int
+	if err := row.Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetCustomDomain stores a new unverified domain with a fresh verification token, replacing
+// any previous one. The previous domain stops resolving immediately.
+func SetCustomDomain(ctx context.Context, tenantID int64, domain string) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO tenant_custom_domains (tenant_id, domain, token, is_verified) VALUES (?, ?, ?, 0)
+		ON CONFLICT(tenant_id) DO UPDATE SET
+			domain = excluded.domain, token = excluded.token,
+			is_verified = 0, verified_at = NULL, checked_at = NULL, last_error = NULL`,
+		tenantID, domain, token); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE tenants SET custom_domain = NULL, updated_at = ? WHERE id = ?`, time.Now(), tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordCustomDomainCheck stores the outcome of a DNS verification attempt and activates
+// the domain on the tenant once it passes, dropping the claims of other tenants on it. It returns
+// ErrCustomDomainTaken when another tenant verified the domain first. A verified domain stays
+// active if a later check fails.
+func RecordCustomDomainCheck(ctx context.Context, tenantID int64, checkErr error) error {
+	now := time.Now()
+	if checkErr != nil {
+		_, err := db.LogExec(ctx, db.DB, `
+			UPDATE tenant_custom_domains SET checked_at = ?, last_error = ? WHERE tenant_id = ?`,
+			now, checkErr.Error(), tenantID)
+		return err
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var domain string
+	if err := tx.QueryRowContext(ctx, `SELECT domain FROM tenant_custom_domains WHERE tenant_id = ?`, tenantID).Scan(&domain); err != nil {
+		return err
+	}
+	var taken int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tenant_custom_domains WHERE domain = ? AND tenant_id != ? AND is_verified = 1`,
+		domain, tenantID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrCustomDomainTaken
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM tenant_custom_domains WHERE domain = ? AND tenant_id != ? AND is_verified = 0`, domain, tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE tenant_custom_domains SET is_verified = 1, verified_at = COALESCE(verified_at, ?), checked_at = ?, last_error = NULL
+		WHERE tenant_id = ?`, now, now, tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE tenants SET custom_domain = (SELECT domain FROM tenant_custom_domains WHERE tenant_id = ?), updated_at = ?
+		WHERE id = ?`, tenantID, now, tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListPendingCustomDomains returns the domains still waiting for verification.
+func ListPendingCustomDomains(ctx context.Context) ([]CustomDomain, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT `+customDomainColumns+` FROM tenant_custom_domains WHERE is_verified = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CustomDomain
+	for rows.Next() {
+		d, err := scanCustomDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+// DeleteCustomDomain removes the tenant's domain and stops resolving it.
+func DeleteCustomDomain(ctx context.Context, tenantID int64) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenant_custom_domains WHERE tenant_id = ?`, tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE tenants SET custom_domain = NULL, updated_at = ? WHERE id = ?`, time.Now(), tenantID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSubdomainByCustomDomain returns the subdomain of the active tenant serving host, or "" when none does.
+func GetSubdomainByCustomDomain(ctx context.Context, host string) (string, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT subdomain FROM tenants WHERE custom_domain = ? AND is_deleted = 0`, host)
+	var sub string
+	err := row.Scan(&sub)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return sub, err
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrDataKeyExists is returned by CreateDataKey when the tenant got an active data key meanwhile.
+var ErrDataKeyExists = errors.New("tenant already has an active data key")
+
+// DataKey is a data key of a tenant, stored wrapped by a master key. Retired keys still decrypt the
+// values written before a rotation.
+type DataKey struct {
+	ID          int64
+	TenantID    int64 // 0 for platform data
+	WrappedKey  string
+	MasterKeyID string // Identifies the master key that wrapped it
+	Active      bool
+	CreatedAt   time.Time
+	RetiredAt   sql.NullTime
+}
+
+const dataKeyColumns = `id, tenant_id, wrapped_key, master_key_id, is_active, created_at, retired_at`
+
+func scanDataKey(row interface{ Scan(...any) error }) (*DataKey, error) {
+	var k DataKey
+	err := row.Scan(&k.ID, &k.TenantID, &k.WrappedKey, &k.MasterKeyID, &k.Active, &k.CreatedAt, &k.RetiredAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// GetActiveDataKey returns the data key encrypting the new values of a tenant, or nil when it has none yet.
+func GetActiveDataKey(ctx context.Context, tenantID int64) (*DataKey, error) {
+	return scanDataKey(db.LogQueryRow(ctx, db.DB,
+		`SELECT `+dataKeyColumns+` FROM tenant_data_keys WHERE tenant_id = ? AND is_active = 1`, tenantID))
+}
+
+// GetDataKey returns a data key by ID, active or retired, or nil when it does not exist.
+func GetDataKey(ctx context.Context, id int64) (*DataKey, error) {
+	return scanDataKey(db.LogQueryRow(ctx, db.DB, `SELECT `+dataKeyColumns+` FROM tenant_data_keys WHERE id = ?`, id))
+}
+
+// ListDataKeys returns every data key, by ID.
+func ListDataKeys(ctx context.Context) ([]DataKey, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT `+dataKeyColumns+` FROM tenant_data_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DataKey
+	for rows.Next() {
+		k, err := scanDataKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *k)
+	}
+	return out, rows.Err()
+}
+
+// CreateDataKey stores the first active data key of a tenant. It returns ErrDataKeyExists when a
+// concurrent request created one first; the caller then uses that one.
+func CreateDataKey(ctx context.Context, tenantID int64, wrapped, masterKeyID string) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`INSERT INTO tenant_data_keys (tenant_id, wrapped_key, master_key_id) VALUES (?, ?, ?)`,
+		tenantID, wrapped, masterKeyID)
+	if db.UniqueViolation(err) != "" {
+		return 0, ErrDataKeyExists
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// RotateDataKey retires the active data key of a tenant and stores the new one in its place.
+func RotateDataKey(ctx context.Context, tenantID int64, wrapped, masterKeyID string) (int64, error) {
+	var id int64
+	err := db.RetryTx(ctx, 3, db.IsBusy, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE tenant_data_keys SET is_active = 0, retired_at = ? WHERE tenant_id = ? AND is_active = 1`,
+			time.Now(), tenantID); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO tenant_data_keys (tenant_id, wrapped_key, master_key_id) VALUES (?, ?, ?)`,
+			tenantID, wrapped, masterKeyID)
+		if err != nil {
+			return err
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+// RewrapDataKey replaces the wrapped form of a data key after a master key rotation.
+func RewrapDataKey(ctx context.Context, id int64, wrapped, masterKeyID string) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE tenant_data_keys SET wrapped_key = ?, master_key_id = ? WHERE id = ?`, wrapped, masterKeyID, id)
+	return err
+}
+
+// DeleteRetiredDataKeys deletes the retired data keys of a tenant, making the values they encrypted
+// unreadable, and returns how many were deleted. It returns ErrLegalHold while the tenant is held.
+func DeleteRetiredDataKeys(ctx context.Context, tenantID int64) (int64, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return 0, err
+	}
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_data_keys WHERE tenant_id = ? AND is_active = 0`, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ColumnValue is the value of an encrypted column in a row, found by its key.
+type ColumnValue struct {
+	Key   any
+	Value string
+}
+
+// ColumnValues returns the non-empty values of column in the rows of a tenant, with the value of
+// the key column of each row, e.g. ("tenant_email_domains", "tenant_id", "private_key"). The
+// names must be known to the code, never input.
+func ColumnValues(ctx context.Context, table, key, column string, tenantID int64) ([]ColumnValue, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT `+key+`, `+column+` FROM `+table+`
+		WHERE tenant_id = ? AND `+column+` IS NOT NULL AND `+column+` <> ''`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ColumnValue
+	for rows.Next() {
+		var v ColumnValue
+		if err := rows.Scan(&v.Key, &v.Value); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// SetColumnValue replaces the value of column in the row of a tenant with the given key, unless it
+// changed since it was read as old.
+func SetColumnValue(ctx context.Context, table, key, column string, tenantID int64, keyValue any, old, value string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE `+table+` SET `+column+` = ? WHERE tenant_id = ? AND `+key+` = ? AND `+column+` = ?`,
+		value, tenantID, keyValue, old)
+	return err
+}
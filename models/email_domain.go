@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// EmailDomain is the custom sending domain configured by a tenant.
+type EmailDomain struct {
+	TenantID   int64
+	Domain     string
+	Selector   string
+	PrivateKey string // PEM-encoded DKIM key
+	IsVerified bool
+	VerifiedAt sql.NullTime
+	CheckedAt  sql.NullTime
+	LastError  sql.NullString
+}
+
+func GetEmailDomain(ctx context.Context, tenantID int64) (*EmailDomain, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT tenant_id, domain, selector, private_key, is_verified, verified_at, checked_at, last_error
+		FROM tenant_email_domains WHERE tenant_id = ?`, tenantID)
+	var d EmailDomain
+	err := row.Scan(&d.TenantID, &d.Domain, &d.Selector, &d.PrivateKey, &d.IsVerified,
+		&d.VerifiedAt, &d.CheckedAt, &d.LastError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// SetEmailDomain stores a new (unverified) sending domain for the tenant, replacing any previous one.
+func SetEmailDomain(ctx context.Context, d EmailDomain) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_email_domains (tenant_id, domain, selector, private_key, is_verified)
+		VALUES (?, ?, ?, ?, 0)
+		ON CONFLICT(tenant_id) DO UPDATE SET
+			domain = excluded.domain, selector = excluded.selector, private_key = excluded.private_key,
+			is_verified = 0, verified_at = NULL, checked_at = NULL, last_error = NULL`,
+		d.TenantID, d.Domain, d.Selector, d.PrivateKey)
+	return err
+}
+
+// RecordEmailDomainCheck stores the outcome of a DNS verification attempt.
+func RecordEmailDomainCheck(ctx context.Context, tenantID int64, checkErr error) error {
+	now := time.Now()
+	if checkErr != nil {
+		_, err := db.LogExec(ctx, db.DB, `
+			UPDATE tenant_email_domains SET is_verified = 0, checked_at = ?, last_error = ? WHERE tenant_id = ?`,
+			now, checkErr.Error(), tenantID)
+		return err
+	}
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE tenant_email_domains SET is_verified = 1, verified_at = COALESCE(verified_at, ?), checked_at = ?, last_error = NULL
+		WHERE tenant_id = ?`, now, now, tenantID)
+	return err
+}
+
+func DeleteEmailDomain(ctx context.Context, tenantID int64) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_email_domains WHERE tenant_id = ?`, tenantID)
+	return err
+}
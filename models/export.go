@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Export statuses stored in data_exports.status.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+type DataExport struct {
+	ID          int64
+	UserID      int64
+	TenantID    int64
+	Status      string
+	StorageKey  sql.NullString
+	Error       sql.NullString
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+// UserExport is the portable document handed to a user asking for their data.
+type UserExport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Profile     ExportProfile      `json:"profile"`
+	Memberships []ExportMembership `json:"memberships"`
+	Sessions    []ExportSession    `json:"sessions"`
+}
+
+type ExportProfile struct {
+	ID         int64  `json:"id"`
+	Email      string `json:"email"`
+	TenantID   int64  `json:"tenant_id"`
+	Role       string `json:"role"`
+	IsVerified bool   `json:"is_verified"`
+	Name       string `json:"name,omitempty"`
+	Lang       string `json:"lang,omitempty"`
+	Timezone   string `json:"timezone,omitempty"`
+}
+
+type ExportMembership struct {
+	TenantID   int64     `json:"tenant_id"`
+	TenantName string    `json:"tenant_name"`
+	Subdomain  string    `json:"subdomain"`
+	Role       string    `json:"role"`
+	IsActive   bool      `json:"is_active"`
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+// ExportSession never contains the raw session token, only a short prefix to help recognise it.
+type ExportSession struct {
+	TokenPrefix string    `json:"token_prefix"`
+	TenantID    int64     `json:"tenant_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func CreateDataExport(ctx context.Context, userID, tenantID int64) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`INSERT INTO data_exports (user_id, tenant_id, status) VALUES (?, ?, ?)`,
+		userID, tenantID, ExportPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func MarkDataExportReady(ctx context.Context, id int64, key string, expires time.Time) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE data_exports SET status = ?, storage_key = ?, completed_at = ?, expires_at = ? WHERE id = ?`,
+		ExportReady, key, time.Now(), expires, id)
+	return err
+}
+
+func MarkDataExportFailed(ctx context.Context, id int64, cause error) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+		ExportFailed, cause.Error(), time.Now(), id)
+	return err
+}
+
+func GetDataExport(ctx context.Context, id int64) (*DataExport, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, user_id, tenant_id, status, storage_key, error, created_at, completed_at, expires_at
+		FROM data_exports WHERE id = ?`, id)
+	var e DataExport
+	err := row.Scan(&e.ID, &e.UserID, &e.TenantID, &e.Status, &e.StorageKey, &e.Error,
+		&e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListDataExports returns the most recent exports requested by a user.
+func ListDataExports(ctx context.Context, userID int64) ([]DataExport, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, user_id, tenant_id, status, storage_key, error, created_at, completed_at, expires_at
+		FROM data_exports WHERE user_id = ? ORDER BY created_at DESC LIMIT 10`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DataExport
+	for rows.Next() {
+		var e DataExport
+		if err := rows.Scan(&e.ID, &e.UserID, &e.TenantID, &e.Status, &e.StorageKey, &e.Error,
+			&e.CreatedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// BuildUserExport collects the profile, memberships and sessions of a user.
+func BuildUserExport(ctx context.Context, userID int64) (*UserExport, error) {
+	exp := &UserExport{GeneratedAt: time.Now().UTC()}
+
+	// Step 1: Profile
+	var tid sql.NullInt64
+	var role sql.NullString
+	row := db.LogQueryRow(ctx, db.DB,
+		`SELECT id, email, tenant_id, role, is_verified, COALESCE(name, ''), COALESCE(lang, ''), COALESCE(timezone, '')
+		 FROM users WHERE id = ?`, userID)
+	if err := row.Scan(&exp.Profile.ID, &exp.Profile.Email, &tid, &role, &exp.Profile.IsVerified,
+		&exp.Profile.Name, &exp.Profile.Lang, &exp.Profile.Timezone); err != nil {
+		return nil, err
+	}
+	exp.Profile.TenantID = tid.Int64
+	exp.Profile.Role = role.String
+
+	// Step 2: Memberships
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT m.tenant_id, t.name, t.subdomain, m.role, m.is_active, m.joined_at
+		FROM memberships m
+		JOIN tenants t ON t.id = m.tenant_id
+		WHERE m.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m ExportMembership
+		var mrole sql.NullString
+		if err := rows.Scan(&m.TenantID, &m.TenantName, &m.Subdomain, &mrole, &m.IsActive, &m.JoinedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		m.Role = mrole.String
+		exp.Memberships = append(exp.Memberships, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Step 3: Sessions
+	rows, err = db.LogQuery(ctx, db.DB,
+		`SELECT token, tenant_id, expires_at FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s ExportSession
+		var token string
+		if err := rows.Scan(&token, &s.TenantID, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if len(token) > 6 {
+			token = token[:6]
+		}
+		s.TokenPrefix = token
+		exp.Sessions = append(exp.Sessions, s)
+	}
+	return exp, rows.Err()
+}
+
+// ExpiredDataExports returns exports past their link expiry, skipping tenants on legal hold.
+func ExpiredDataExports(ctx context.Context) ([]DataExport, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, user_id, tenant_id, status, storage_key, error, created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE expires_at IS NOT NULL AND expires_at < ?
+		  AND tenant_id NOT IN (SELECT tenant_id FROM tenant_legal_holds)`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []DataExport
+	for rows.Next() {
+		var e DataExport
+		if err := rows.Scan(&e.ID, &e.UserID, &e.TenantID, &e.Status, &e.StorageKey, &e.Error,
+			&e.CreatedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// DeleteDataExport removes an export record. It refuses while the tenant is on legal hold.
+func DeleteDataExport(ctx context.Context, e DataExport) error {
+	if err := CheckLegalHold(ctx, e.TenantID); err != nil {
+		return err
+	}
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM data_exports WHERE id = ?`, e.ID)
+	return err
+}
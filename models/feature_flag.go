@@ -0,0 +1,104 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// FeatureFlag is the platform-wide state of a feature flag set by platform admins, over the
+// definition of the flag in code or configuration.
+type FeatureFlag struct {
+	Name      string
+	Enabled   bool
+	Rollout   int // Percentage of tenants or users getting the flag when it is not enabled for all
+	UpdatedBy int64
+	UpdatedAt time.Time
+}
+
+// TenantFeatureFlag turns a feature flag on or off for one tenant, whatever its platform-wide state.
+type TenantFeatureFlag struct {
+	TenantID  int64
+	Subdomain string
+	Name      string
+	Enabled   bool
+	UpdatedBy int64
+	UpdatedAt time.Time
+}
+
+// ListFeatureFlags returns the platform-wide flag states, by name.
+func ListFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT name, enabled, rollout, COALESCE(updated_by, 0), updated_at FROM feature_flags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var flags []FeatureFlag
+	for rows.Next() {
+		var f FeatureFlag
+		if err := rows.Scan(&f.Name, &f.Enabled, &f.Rollout, &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// SetFeatureFlag stores the platform-wide state of a flag.
+func SetFeatureFlag(ctx context.Context, name string, enabled bool, rollout int, updatedBy int64) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO feature_flags (name, enabled, rollout, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET enabled = excluded.enabled, rollout = excluded.rollout,
+			updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		name, enabled, rollout, updatedBy, time.Now())
+	return err
+}
+
+// DeleteFeatureFlag removes the platform-wide state of a flag and its tenant overrides; a flag
+// defined in code or configuration falls back to its definition.
+func DeleteFeatureFlag(ctx context.Context, name string) error {
+	if _, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_feature_flags WHERE name = ?`, name); err != nil {
+		return err
+	}
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM feature_flags WHERE name = ?`, name)
+	return err
+}
+
+// ListTenantFeatureFlags returns every tenant override, by flag then subdomain.
+func ListTenantFeatureFlags(ctx context.Context) ([]TenantFeatureFlag, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT f.tenant_id, t.subdomain, f.name, f.enabled, COALESCE(f.updated_by, 0), f.updated_at
+		FROM tenant_feature_flags f JOIN tenants t ON t.id = f.tenant_id
+		ORDER BY f.name, t.subdomain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var flags []TenantFeatureFlag
+	for rows.Next() {
+		var f TenantFeatureFlag
+		if err := rows.Scan(&f.TenantID, &f.Subdomain, &f.Name, &f.Enabled, &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, f)
+	}
+	return flags, rows.Err()
+}
+
+// SetTenantFeatureFlag turns a flag on or off for a tenant.
+func SetTenantFeatureFlag(ctx context.Context, tenantID int64, name string, enabled bool, updatedBy int64) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_feature_flags (tenant_id, name, enabled, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(tenant_id, name) DO UPDATE SET enabled = excluded.enabled,
+			updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		tenantID, name, enabled, updatedBy, time.Now())
+	return err
+}
+
+// ClearTenantFeatureFlag removes the override of a tenant, which then follows the platform-wide state.
+func ClearTenantFeatureFlag(ctx context.Context, tenantID int64, name string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_feature_flags WHERE tenant_id = ? AND name = ?`, tenantID, name)
+	return err
+}
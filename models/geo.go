@@ -0,0 +1,76 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Geo policy modes stored in tenant_geo_policies.mode.
+const (
+	GeoAllow = "allow" // Only listed countries may access the tenant
+	GeoDeny  = "deny"  // Listed countries are blocked
+)
+
+// GeoPolicy is a tenant's country-based access policy.
+type GeoPolicy struct {
+	TenantID  int64
+	Mode      string
+	Countries []string // ISO 3166-1 alpha-2 codes, upper case
+}
+
+// Allows reports whether a visitor from the given country may access the tenant.
+// An unknown country ("") is rejected by allow lists and accepted by deny lists.
+func (p *GeoPolicy) Allows(country string) bool {
+	if p == nil || len(p.Countries) == 0 {
+		return true
+	}
+	country = strings.ToUpper(country)
+	listed := false
+	for _, c := range p.Countries {
+		if c == country {
+			listed = true
+			break
+		}
+	}
+	if p.Mode == GeoAllow {
+		return listed
+	}
+	return !listed
+}
+
+// GetGeoPolicy returns the tenant's geo policy, or nil when none is configured.
+func GetGeoPolicy(ctx context.Context, tenantID int64) (*GeoPolicy, error) {
+	row := db.LogQueryRow(ctx, db.DB,
+		`SELECT mode, countries FROM tenant_geo_policies WHERE tenant_id = ?`, tenantID)
+	var mode, countries string
+	err := row.Scan(&mode, &countries)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &GeoPolicy{TenantID: tenantID, Mode: mode, Countries: splitCountries(countries)}, nil
+}
+
+// SetGeoPolicy creates or replaces the tenant's geo policy.
+func SetGeoPolicy(ctx context.Context, p GeoPolicy) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_geo_policies (tenant_id, mode, countries) VALUES (?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET mode = excluded.mode, countries = excluded.countries`,
+		p.TenantID, p.Mode, strings.Join(p.Countries, ","))
+	return err
+}
+
+func splitCountries(s string) []string {
+	var out []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
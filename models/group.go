@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Group roles stored in group_members.role. Managers run the group's membership;
+// tenant admins manage every group whatever their group role.
+const (
+	GroupManager = "manager"
+	GroupMember  = "member"
+)
+
+// ErrGroupExists is returned when a tenant already has a group with the requested name.
+var ErrGroupExists = errors.New("group name already taken")
+
+// Group is a team of members within a tenant.
+type Group struct {
+	ID          int64
+	TenantID    int64
+	Name        string
+	Description string
+	CreatedBy   int64
+	CreatedAt   time.Time
+	Members     int    // Filled by the list queries
+	Role        string // Group role of the listing user, filled by ListUserGroups
+}
+
+// GroupMemberEntry is a member of a group as shown on the group page.
+type GroupMemberEntry struct {
+	UserID  int64
+	Email   string
+	Role    string // GroupManager or GroupMember
+	AddedAt time.Time
+}
+
+// CreateGroup adds a group to the tenant and returns its ID, or ErrGroupExists when the name is taken.
+func CreateGroup(ctx context.Context, g Group) (int64, error) {
+	if taken, err := groupNameTaken(ctx, g.TenantID, g.Name, 0); err != nil {
+		return 0, err
+	} else if taken {
+		return 0, ErrGroupExists
+	}
+	res, err := db.LogExec(ctx, db.DB,
+		`INSERT INTO groups (tenant_id, name, description, created_by) VALUES (?, ?, ?, ?)`,
+		g.TenantID, g.Name, g.Description, g.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateGroup renames a group and replaces its description. It reports whether the group was found.
+func UpdateGroup(ctx context.Context, g Group) (bool, error) {
+	if taken, err := groupNameTaken(ctx, g.TenantID, g.Name, g.ID); err != nil {
+		return false, err
+	} else if taken {
+		return false, ErrGroupExists
+	}
+	res, err := db.LogExec(ctx, db.DB,
+		`UPDATE groups SET name = ?, description = ?, updated_at = ? WHERE id = ? AND tenant_id = ?`,
+		g.Name, g.Description, time.Now(), g.ID, g.TenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func groupNameTaken(ctx context.Context, tenantID int64, name string, exceptID int64) (bool, error) {
+	var n int
+	err := db.LogQueryRow(ctx, db.DB,
+		`SELECT COUNT(*) FROM groups WHERE tenant_id = ? AND name = ? COLLATE NOCASE AND id != ?`,
+		tenantID, name, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+// GetGroup returns a group of the tenant, or nil when it does not exist.
+func GetGroup(ctx context.Context, tenantID, id int64) (*Group, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT g.id, g.tenant_id, g.name, g.description, COALESCE(g.created_by, 0), g.created_at,
+			(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id)
+		FROM groups g WHERE g.id = ? AND g.tenant_id = ?`, id, tenantID)
+	var g Group
+	err := row.Scan(&g.ID, &g.TenantID, &g.Name, &g.Description, &g.CreatedBy, &g.CreatedAt, &g.Members)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// ListGroups returns every group of the tenant by name.
+func ListGroups(ctx context.Context, tenantID int64) ([]Group, error) {
+	return queryGroups(ctx, `
+		SELECT g.id, g.tenant_id, g.name, g.description, COALESCE(g.created_by, 0), g.created_at,
+			(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id), ''
+		FROM groups g WHERE g.tenant_id = ?
+		ORDER BY g.name COLLATE NOCASE`, tenantID)
+}
+
+// ListUserGroups returns the groups a user belongs to in the tenant, with the user's group role.
+func ListUserGroups(ctx context.Context, tenantID, userID int64) ([]Group, error) {
+	return queryGroups(ctx, `
+		SELECT g.id, g.tenant_id, g.name, g.description, COALESCE(g.created_by, 0), g.created_at,
+			(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = g.id), m.role
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE g.tenant_id = ? AND m.user_id = ?
+		ORDER BY g.name COLLATE NOCASE`, tenantID, userID)
+}
+
+func queryGroups(ctx context.Context, query string, args ...any) ([]Group, error) {
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Group
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ID, &g.TenantID, &g.Name, &g.Description, &g.CreatedBy, &g.CreatedAt, &g.Members, &g.Role); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// DeleteGroup removes a group with its memberships and permissions. It reports whether the group was found,
+// and returns ErrLegalHold while the tenant is held.
+func DeleteGroup(ctx context.Context, tenantID, id int64) (bool, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return false, err
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{
+		`DELETE FROM group_members WHERE group_id = ? AND tenant_id = ?`,
+		`DELETE FROM group_permissions WHERE group_id = ? AND tenant_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, id, tenantID); err != nil {
+			return false, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE id = ? AND tenant_id = ?`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ListGroupMembers returns the members of a group, managers first.
+func ListGroupMembers(ctx context.Context, tenantID, groupID int64) ([]GroupMemberEntry, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT u.id, u.email, m.role, m.added_at
+		FROM group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ? AND m.tenant_id = ?
+		ORDER BY m.role = 'manager' DESC, u.email`, groupID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []GroupMemberEntry
+	for rows.Next() {
+		var m GroupMemberEntry
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// GetGroupRole returns the user's role in a group, or "" when the user is not a member.
+func GetGroupRole(ctx context.Context, tenantID, groupID, userID int64) (string, error) {
+	var role string
+	err := db.LogQueryRow(ctx, db.DB,
+		`SELECT role FROM group_members WHERE group_id = ? AND tenant_id = ? AND user_id = ?`,
+		groupID, tenantID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// SetGroupMember adds a user to a group or changes their group role.
+func SetGroupMember(ctx context.Context, tenantID, groupID, userID int64, role string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO group_members (group_id, tenant_id, user_id, role) VALUES (?, ?, ?, ?)
+		ON CONFLICT(group_id, user_id) DO UPDATE SET role = excluded.role`,
+		groupID, tenantID, userID, role)
+	return err
+}
+
+// RemoveGroupMember takes a user out of a group. It reports whether the user was a member.
+func RemoveGroupMember(ctx context.Context, tenantID, groupID, userID int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`DELETE FROM group_members WHERE group_id = ? AND tenant_id = ? AND user_id = ?`, groupID, tenantID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
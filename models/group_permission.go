@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ListGroupPermissions returns the permissions granted to a group, by name.
+func ListGroupPermissions(ctx context.Context, tenantID, groupID int64) ([]string, error) {
+	return queryPermissions(ctx, `
+		SELECT permission FROM group_permissions
+		WHERE group_id = ? AND tenant_id = ?
+		ORDER BY permission`, groupID, tenantID)
+}
+
+// ListUserPermissions returns the permissions a user holds through the groups they belong to in
+// the tenant, by name.
+func ListUserPermissions(ctx context.Context, tenantID, userID int64) ([]string, error) {
+	return queryPermissions(ctx, `
+		SELECT DISTINCT p.permission
+		FROM group_permissions p
+		JOIN group_members m ON m.group_id = p.group_id
+		WHERE p.tenant_id = ? AND m.user_id = ?
+		ORDER BY p.permission`, tenantID, userID)
+}
+
+func queryPermissions(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// GrantGroupPermission grants a permission to a group. It reports whether the group did not hold
+// it yet.
+func GrantGroupPermission(ctx context.Context, tenantID, groupID int64, permission string, grantedBy int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO group_permissions (group_id, tenant_id, permission, granted_by) VALUES (?, ?, ?, ?)
+		ON CONFLICT(group_id, permission) DO NOTHING`,
+		groupID, tenantID, permission, grantedBy)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeGroupPermission withdraws a permission from a group. It reports whether the group held it.
+func RevokeGroupPermission(ctx context.Context, tenantID, groupID int64, permission string) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`DELETE FROM group_permissions WHERE group_id = ? AND tenant_id = ? AND permission = ?`, groupID, tenantID, permission)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,50 @@
+package models
+
+import "strings"
+
+// GroupScope restricts group-owned records to the groups a user belongs to.
+// Build it with middleware.GroupScopeFor and apply it with Where.
+type GroupScope struct {
+	GroupIDs         []int64 // Groups the user belongs to
+	All              bool    // Tenant admins see every record of the tenant
+	IncludeUngrouped bool    // Records without a group (NULL column) are visible to every member
+}
+
+// Where returns an SQL condition on column, the table's group ID column, with its arguments.
+// It never matches anything for a user without groups, unless ungrouped records are included.
+//
+//	cond, args := scope.Where("documents.group_id")
+//	rows, err := db.LogQuery(ctx, db.DB, `SELECT ... FROM documents WHERE tenant_id = ? AND `+cond, append([]any{tenantID}, args...)...)
+func (s GroupScope) Where(column string) (string, []any) {
+	if s.All {
+		return "1 = 1", nil
+	}
+	var conds []string
+	var args []any
+	if len(s.GroupIDs) > 0 {
+		conds = append(conds, column+" IN (?"+strings.Repeat(", ?", len(s.GroupIDs)-1)+")")
+		for _, id := range s.GroupIDs {
+			args = append(args, id)
+		}
+	}
+	if s.IncludeUngrouped {
+		conds = append(conds, column+" IS NULL")
+	}
+	if len(conds) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// Allows reports whether a record owned by groupID (0 for none) is visible within the scope.
+func (s GroupScope) Allows(groupID int64) bool {
+	if s.All || (groupID == 0 && s.IncludeUngrouped) {
+		return true
+	}
+	for _, id := range s.GroupIDs {
+		if id == groupID && id != 0 {
+			return true
+		}
+	}
+	return false
+}
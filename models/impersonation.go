@@ -0,0 +1,100 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrHandoffInvalid is returned when an impersonation hand-off is unknown, expired or already used.
+var ErrHandoffInvalid = errors.New("invalid, expired or used impersonation hand-off")
+
+type impersonatorKey struct{}
+
+// WithImpersonator marks ctx as acting for a platform operator signed in as another user.
+// Audit entries recorded with it name the operator.
+func WithImpersonator(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, email)
+}
+
+// ImpersonatorFromContext returns the email of the operator impersonating the current user, or "".
+func ImpersonatorFromContext(ctx context.Context) string {
+	email, _ := ctx.Value(impersonatorKey{}).(string)
+	return email
+}
+
+// CreateImpersonationHandoff records a hand-off of an operator to a tenant host and returns its
+// nonce, which the signed hand-off token carries so that it opens a single session.
+func CreateImpersonationHandoff(ctx context.Context, tenantID, operatorID int64, ttl time.Duration) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(b)
+	now := time.Now()
+	if _, err := db.LogExec(ctx, db.DB, `DELETE FROM impersonation_handoffs WHERE expires_at <= ?`, now); err != nil {
+		return "", err
+	}
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO impersonation_handoffs (tenant_id, operator_id, nonce, expires_at) VALUES (?, ?, ?, ?)`,
+		tenantID, operatorID, nonce, now.Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+// CreateImpersonationSession consumes the hand-off nonce and opens a session as a tenant user on
+// behalf of a platform operator. It expires on its own and is flagged so that the user's pages show
+// who is acting. A nonce opens one session; ErrHandoffInvalid is returned for a replayed one.
+func CreateImpersonationSession(ctx context.Context, nonce string, userID, tenantID, impersonatorID int64, impersonatorEmail string, expires time.Time) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Step 1: Mark the hand-off used; the WHERE clause makes concurrent uses lose the race
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE impersonation_handoffs SET used_at = ?
+		WHERE nonce = ? AND tenant_id = ? AND operator_id = ? AND used_at IS NULL AND expires_at > ?`,
+		now, nonce, tenantID, impersonatorID, now)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return "", ErrHandoffInvalid
+	}
+
+	// Step 2: Open the session
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sessions (token, user_id, tenant_id, expires_at, impersonator_id, impersonator_email)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		token, userID, tenantID, expires, impersonatorID, impersonatorEmail); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DeleteSession ends a session.
+func DeleteSession(ctx context.Context, token string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM sessions WHERE token = ?`, token)
+	if err == nil {
+		sessionEnded(token)
+	}
+	return err
+}
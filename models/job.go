@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Job statuses stored in jobs.status.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a unit of background work, run by the jobs package on any instance.
+type Job struct {
+	ID          int64
+	TenantID    int64 // 0 for platform jobs
+	Kind        string
+	Payload     string // JSON
+	Status      string
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LastError   string
+	RequestID   string // Of the request that enqueued the job
+	CreatedAt   time.Time
+	FinishedAt  sql.NullTime
+}
+
+// Decode unmarshals the payload of the job into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+const jobColumns = `id, tenant_id, kind, payload, status, attempts, max_attempts, run_at, last_error, request_id,
+	created_at, finished_at`
+
+// CreateJob queues a job and sets its ID. With unique, nothing is queued while a job of the same
+// kind and tenant is pending or running, and the ID stays 0.
+func CreateJob(ctx context.Context, j *Job, unique bool) error {
+	res, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO jobs (tenant_id, kind, payload, status, max_attempts, run_at, request_id)
+		SELECT ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT ? OR NOT EXISTS (
+			SELECT 1 FROM jobs WHERE tenant_id = ? AND kind = ? AND status IN (?, ?))`,
+		j.TenantID, j.Kind, j.Payload, JobPending, j.MaxAttempts, j.RunAt, j.RequestID,
+		unique, j.TenantID, j.Kind, JobPending, JobRunning)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	j.ID, err = res.LastInsertId()
+	return err
+}
+
+// ClaimJob takes the next due job, or a running job whose lease expired with its instance, and
+// leases it until now+lease. Tenants take turns: the tenant that started a job the longest ago goes
+// first, and tenants already running perTenant jobs wait. Platform jobs are not capped. It returns
+// nil when no job is due.
+func ClaimJob(ctx context.Context, lease time.Duration, perTenant int) (*Job, error) {
+	now := time.Now()
+	for {
+		var id int64
+		err := db.LogQueryRow(ctx, db.DB, `
+			SELECT j.id FROM jobs j
+			WHERE ((j.status = ? AND j.run_at <= ?) OR (j.status = ? AND j.locked_until <= ?))
+				AND (j.tenant_id = 0 OR (SELECT COUNT(*) FROM jobs r
+					WHERE r.tenant_id = j.tenant_id AND r.status = ? AND r.locked_until > ?) < ?)
+			ORDER BY (SELECT MAX(started_at) FROM jobs r WHERE r.tenant_id = j.tenant_id) NULLS FIRST, j.run_at, j.id
+			LIMIT 1`,
+			JobPending, now, JobRunning, now, JobRunning, now, perTenant).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res, err := db.LogExec(ctx, db.DB, `
+			UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = ?, locked_until = ?
+			WHERE id = ? AND ((status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?))`,
+			JobRunning, now, now.Add(lease), id, JobPending, now, JobRunning, now)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return GetJob(ctx, id)
+		}
+		// Claimed by another instance in between: pick the next one
+	}
+}
+
+// GetJob returns a job, nil when it does not exist.
+func GetJob(ctx context.Context, id int64) (*Job, error) {
+	var j Job
+	err := db.LogQueryRow(ctx, db.DB, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id).
+		Scan(&j.ID, &j.TenantID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt,
+			&j.LastError, &j.RequestID, &j.CreatedAt, &j.FinishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// FinishJob records the outcome of an attempt: done without error, failed for good when retryAt is
+// zero, or pending again until retryAt.
+func FinishJob(ctx context.Context, id int64, runErr error, retryAt time.Time) error {
+	status, msg := JobDone, ""
+	if runErr != nil {
+		status, msg = JobFailed, runErr.Error()
+		if !retryAt.IsZero() {
+			status = JobPending
+		}
+	}
+	now := time.Now()
+	finished := sql.NullTime{Time: now, Valid: status != JobPending}
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE jobs SET status = ?, last_error = ?, run_at = COALESCE(?, run_at), finished_at = ?, locked_until = NULL
+		WHERE id = ?`,
+		status, msg, sql.NullTime{Time: retryAt, Valid: !retryAt.IsZero()}, finished, id)
+	return err
+}
+
+// PurgeJobs deletes the jobs done or failed before before and returns how many were deleted.
+func PurgeJobs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM jobs WHERE status IN (?, ?) AND finished_at < ?`,
+		JobDone, JobFailed, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClaimJobSchedule moves the schedule name to next when it is due, and reports whether it was, so
+// that one instance only enqueues each run, along with the time the schedule is due next. A new
+// schedule, or one whose spec changed, is first due at next.
+func ClaimJobSchedule(ctx context.Context, name, spec string, next time.Time) (bool, time.Time, error) {
+	now := time.Now()
+	if _, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO job_schedules (name, spec, next_run_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET spec = excluded.spec, next_run_at = excluded.next_run_at
+		WHERE job_schedules.spec <> excluded.spec`, name, spec, next); err != nil {
+		return false, time.Time{}, err
+	}
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE job_schedules SET next_run_at = ? WHERE name = ? AND next_run_at <= ?`, next, name, now)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return true, next, nil
+	}
+	var at time.Time
+	err = db.LogQueryRow(ctx, db.DB, `SELECT next_run_at FROM job_schedules WHERE name = ?`, name).Scan(&at)
+	return false, at, err
+}
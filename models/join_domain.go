@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// JoinDomain lets users registering with an address of Domain join the tenant without approval.
+type JoinDomain struct {
+	ID        int64
+	TenantID  int64
+	Domain    string // e.g. "acme.com"
+	Role      string // Role given on joining; empty for the default role
+	CreatedAt time.Time
+}
+
+// ListJoinDomains returns the tenant's join domains in alphabetical order.
+func ListJoinDomains(ctx context.Context, tenantID int64) ([]JoinDomain, error) {
+	rows, err := db.LogQuery(ctx, db.DB,
+		`SELECT id, tenant_id, domain, role, created_at FROM tenant_join_domains WHERE tenant_id = ? ORDER BY domain`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []JoinDomain
+	for rows.Next() {
+		var d JoinDomain
+		if err := rows.Scan(&d.ID, &d.TenantID, &d.Domain, &d.Role, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// GetJoinDomain returns the tenant's rule for a domain, or nil when there is none.
+func GetJoinDomain(ctx context.Context, tenantID int64, domain string) (*JoinDomain, error) {
+	row := db.LogQueryRow(ctx, db.DB,
+		`SELECT id, tenant_id, domain, role, created_at FROM tenant_join_domains WHERE tenant_id = ? AND domain = ?`,
+		tenantID, domain)
+	var d JoinDomain
+	err := row.Scan(&d.ID, &d.TenantID, &d.Domain, &d.Role, &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CountJoinDomains returns how many join domains the tenant has configured.
+func CountJoinDomains(ctx context.Context, tenantID int64) (int, error) {
+	var n int
+	err := db.LogQueryRow(ctx, db.DB,
+		`SELECT COUNT(*) FROM tenant_join_domains WHERE tenant_id = ?`, tenantID).Scan(&n)
+	return n, err
+}
+
+// SetJoinDomain adds a join domain or changes the role of an existing one.
+func SetJoinDomain(ctx context.Context, d JoinDomain) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_join_domains (tenant_id, domain, role) VALUES (?, ?, ?)
+		ON CONFLICT(tenant_id, domain) DO UPDATE SET role = excluded.role`,
+		d.TenantID, d.Domain, d.Role)
+	return err
+}
+
+// DeleteJoinDomain removes a join domain. It reports whether the domain belonged to the tenant.
+func DeleteJoinDomain(ctx context.Context, tenantID, id int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_join_domains WHERE id = ? AND tenant_id = ?`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
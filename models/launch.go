@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// LaunchSettings controls the tenant's soft launch ("coming soon") mode.
+type LaunchSettings struct {
+	TenantID   int64
+	ComingSoon bool
+	Message    string // Shown on the placeholder page; a default text is used when empty
+}
+
+// GetLaunchSettings returns the tenant's launch settings, or nil when the tenant never changed them.
+func GetLaunchSettings(ctx context.Context, tenantID int64) (*LaunchSettings, error) {
+	row := db.LogQueryRow(ctx, db.DB,
+		`SELECT tenant_id, coming_soon, message FROM tenant_launch_settings WHERE tenant_id = ?`, tenantID)
+	var s LaunchSettings
+	err := row.Scan(&s.TenantID, &s.ComingSoon, &s.Message)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SetLaunchSettings creates or replaces the tenant's launch settings.
+func SetLaunchSettings(ctx context.Context, s LaunchSettings) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_launch_settings (tenant_id, coming_soon, message, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET coming_soon = excluded.coming_soon, message = excluded.message, updated_at = excluded.updated_at`,
+		s.TenantID, s.ComingSoon, s.Message, time.Now())
+	return err
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrLegalHold is returned by deletions attempted on a tenant under legal hold.
+var ErrLegalHold = errors.New("tenant is on legal hold")
+
+// LegalHold suspends retention jobs and deletions for a tenant.
+type LegalHold struct {
+	TenantID  int64
+	Subdomain string
+	Reason    string
+	PlacedBy  int64
+	PlacedAt  time.Time
+}
+
+// PlaceLegalHold puts a tenant on hold, replacing the reason of an existing hold.
+func PlaceLegalHold(ctx context.Context, tenantID, placedBy int64, reason string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_legal_holds (tenant_id, reason, placed_by, placed_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET reason = excluded.reason, placed_by = excluded.placed_by`,
+		tenantID, reason, placedBy, time.Now())
+	return err
+}
+
+// ReleaseLegalHold lifts the hold; retention resumes on the next run.
+func ReleaseLegalHold(ctx context.Context, tenantID int64) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_legal_holds WHERE tenant_id = ?`, tenantID)
+	return err
+}
+
+// IsOnLegalHold reports whether the tenant is currently held.
+func IsOnLegalHold(ctx context.Context, tenantID int64) (bool, error) {
+	var n int
+	row := db.LogQueryRow(ctx, db.DB, `SELECT COUNT(*) FROM tenant_legal_holds WHERE tenant_id = ?`, tenantID)
+	if err := row.Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CheckLegalHold returns ErrLegalHold when the tenant is held. Deletion paths call it first.
+func CheckLegalHold(ctx context.Context, tenantID int64) error {
+	held, err := IsOnLegalHold(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if held {
+		return ErrLegalHold
+	}
+	return nil
+}
+
+// ListLegalHolds returns every active hold with the tenant's subdomain.
+func ListLegalHolds(ctx context.Context) ([]LegalHold, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT h.tenant_id, t.subdomain, h.reason, h.placed_by, h.placed_at
+		FROM tenant_legal_holds h
+		JOIN tenants t ON t.id = h.tenant_id
+		ORDER BY h.placed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []LegalHold
+	for rows.Next() {
+		var h LegalHold
+		if err := rows.Scan(&h.TenantID, &h.Subdomain, &h.Reason, &h.PlacedBy, &h.PlacedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// GetTenantIDBySubdomain resolves a subdomain including inactive and deleted tenants,
+// which are the ones most likely to need a hold. It returns 0 when nothing matches.
+func GetTenantIDBySubdomain(ctx context.Context, subdomain string) (int64, error) {
+	var id int64
+	row := db.LogQueryRow(ctx, db.DB, `SELECT id FROM tenants WHERE subdomain = ?`, subdomain)
+	err := row.Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Maintenance is a maintenance window started by an operator. TenantID 0 is the whole platform.
+type Maintenance struct {
+	TenantID   int64
+	Subdomain  string // Empty for the platform
+	Message    string
+	RetryAfter time.Duration
+	StartedBy  int64 // 0 when started from the command line or the API
+	StartedAt  time.Time
+}
+
+// ListMaintenance returns the maintenance windows in progress, the platform's first.
+func ListMaintenance(ctx context.Context) ([]Maintenance, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT m.tenant_id, COALESCE(t.subdomain, ''), m.message, m.retry_after, COALESCE(m.started_by, 0), m.started_at
+		FROM maintenance m LEFT JOIN tenants t ON t.id = m.tenant_id
+		ORDER BY m.tenant_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Maintenance
+	for rows.Next() {
+		var m Maintenance
+		var seconds int64
+		if err := rows.Scan(&m.TenantID, &m.Subdomain, &m.Message, &seconds, &m.StartedBy, &m.StartedAt); err != nil {
+			return nil, err
+		}
+		m.RetryAfter = time.Duration(seconds) * time.Second
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// StartMaintenance puts the platform (tenantID 0) or a tenant in maintenance, or updates the
+// message and Retry-After of its window in progress.
+func StartMaintenance(ctx context.Context, tenantID int64, message string, retryAfter time.Duration, startedBy int64) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO maintenance (tenant_id, message, retry_after, started_by, started_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET message = excluded.message, retry_after = excluded.retry_after`,
+		tenantID, message, int64(retryAfter/time.Second), nullInt(startedBy), time.Now())
+	return err
+}
+
+// EndMaintenance ends the maintenance window of the platform (tenantID 0) or a tenant; it reports
+// whether one was in progress.
+func EndMaintenance(ctx context.Context, tenantID int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM maintenance WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
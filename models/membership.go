@@ -0,0 +1,331 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Membership statuses stored in memberships.status.
+const (
+	MembershipActive  = "active"
+	MembershipPending = "pending" // Waiting for an admin to approve the self-registration
+	// MembershipInactive is reported by GetMembershipStatus for an active membership deactivated
+	// by an admin; it is stored as is_active = 0.
+	MembershipInactive = "inactive"
+)
+
+// What happens to registrations outside the tenant's join domains, stored in unmatched_domains.
+// The policy only applies once at least one join domain is configured.
+const (
+	UnmatchedAllow    = "allow"    // Register as usual
+	UnmatchedApproval = "approval" // Send to the approval queue
+	UnmatchedReject   = "reject"   // Refuse the registration
+)
+
+// ErrLastOwner is returned when a change would leave a tenant without an active owner.
+var ErrLastOwner = errors.New("the tenant must keep an active owner")
+
+// MembershipSettings controls how new members join a tenant.
+type MembershipSettings struct {
+	TenantID         int64
+	RequireApproval  bool   // Self-registrations wait in the approval queue instead of joining at once
+	UnmatchedDomains string // UnmatchedAllow, UnmatchedApproval or UnmatchedReject
+}
+
+// GetMembershipSettings returns the tenant's membership settings, or nil when the tenant never changed them.
+func GetMembershipSettings(ctx context.Context, tenantID int64) (*MembershipSettings, error) {
+	row := db.LogQueryRow(ctx, db.DB,
+		`SELECT tenant_id, require_approval, unmatched_domains FROM tenant_membership_settings WHERE tenant_id = ?`, tenantID)
+	var s MembershipSettings
+	err := row.Scan(&s.TenantID, &s.RequireApproval, &s.UnmatchedDomains)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SetMembershipSettings creates or replaces the tenant's membership settings.
+func SetMembershipSettings(ctx context.Context, s MembershipSettings) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_membership_settings (tenant_id, require_approval, unmatched_domains, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET require_approval = excluded.require_approval,
+			unmatched_domains = excluded.unmatched_domains, updated_at = excluded.updated_at`,
+		s.TenantID, s.RequireApproval, s.UnmatchedDomains, time.Now())
+	return err
+}
+
+// GetMembershipStatus returns the status of a user's membership, or "" when there is none.
+func GetMembershipStatus(ctx context.Context, userID, tenantID int64) (string, error) {
+	var status string
+	err := db.LogQueryRow(ctx, db.DB, `
+		SELECT CASE WHEN is_active = 0 AND status = ? THEN ? ELSE status END
+		FROM memberships WHERE user_id = ? AND tenant_id = ?`,
+		MembershipActive, MembershipInactive, userID, tenantID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// ApproveMembership activates a pending membership. It reports whether a pending membership was found.
+func ApproveMembership(ctx context.Context, tenantID, userID int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE memberships SET status = ?, is_active = 1, joined_at = ?
+		WHERE tenant_id = ? AND user_id = ? AND status = ?`,
+		MembershipActive, time.Now(), tenantID, userID, MembershipPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RejectMembership deletes a pending membership together with its user, so the address can register again.
+// It reports whether a pending membership was found, and returns ErrLegalHold while the tenant is held.
+func RejectMembership(ctx context.Context, tenantID, userID int64) (bool, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return false, err
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM memberships WHERE tenant_id = ? AND user_id = ? AND status = ?`, tenantID, userID, MembershipPending)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = ? AND tenant_id = ?`, userID, tenantID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetTenantMember returns a membership of the tenant, or nil when the user is not a member.
+func GetTenantMember(ctx context.Context, tenantID, userID int64) (*TenantMember, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT `+memberColumns+`
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.tenant_id = ? AND m.user_id = ?`, tenantID, userID)
+	var m TenantMember
+	err := row.Scan(&m.UserID, &m.Email, &m.Name, &m.Role, &m.IsActive, &m.Status, &m.JoinedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SetMemberRole changes the role of a member. The role is kept on both the membership and the user,
+// which sessions read it from. It reports whether the membership was found, and returns
+// ErrLastOwner instead of demoting the last active member with the owner role.
+func SetMemberRole(ctx context.Context, tenantID, userID int64, role, owner string) (bool, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	wasOwner, err := hasRole(ctx, tx, tenantID, userID, owner)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE memberships SET role = ? WHERE tenant_id = ? AND user_id = ?`, role, tenantID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET role = ? WHERE id = ? AND tenant_id = ?`, role, userID, tenantID); err != nil {
+		return false, err
+	}
+	if wasOwner {
+		if err := keepOwner(ctx, tx, tenantID, owner); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	UserChanged(userID)
+	return true, nil
+}
+
+// SetMembershipActive deactivates or reactivates an approved membership. Deactivation also ends the
+// member's sessions so it applies at once. It reports whether the membership changed, and returns
+// ErrLastOwner instead of deactivating the last active owner.
+func SetMembershipActive(ctx context.Context, tenantID, userID int64, active bool, owner string) (bool, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	wasOwner, err := hasRole(ctx, tx, tenantID, userID, owner)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE memberships SET is_active = ?
+		WHERE tenant_id = ? AND user_id = ? AND status = ? AND is_active != ?`,
+		active, tenantID, userID, MembershipActive, active)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if !active {
+		if wasOwner {
+			if err := keepOwner(ctx, tx, tenantID, owner); err != nil {
+				return false, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND tenant_id = ?`, userID, tenantID); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	UserChanged(userID)
+	return true, nil
+}
+
+// RemoveMember deletes a membership with its user, group memberships, sessions, notifications and
+// ownership transfers, so the address can register again. It reports whether the membership was
+// found, and returns ErrLastOwner instead of removing the last active owner and ErrLegalHold while
+// the tenant is held.
+func RemoveMember(ctx context.Context, tenantID, userID int64, owner string) (bool, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return false, err
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	wasOwner, err := hasRole(ctx, tx, tenantID, userID, owner)
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM memberships WHERE tenant_id = ? AND user_id = ?`, tenantID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if wasOwner {
+		if err := keepOwner(ctx, tx, tenantID, owner); err != nil {
+			return false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ownership_transfers WHERE tenant_id = ? AND (from_user_id = ? OR to_user_id = ?)`,
+		tenantID, userID, userID); err != nil {
+		return false, err
+	}
+	for _, q := range []string{
+		`DELETE FROM group_members WHERE user_id = ? AND tenant_id = ?`,
+		`DELETE FROM sessions WHERE user_id = ? AND tenant_id = ?`,
+		`DELETE FROM notifications WHERE user_id = ? AND tenant_id = ?`,
+		`DELETE FROM users WHERE id = ? AND tenant_id = ?`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, userID, tenantID); err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	UserChanged(userID)
+	return true, nil
+}
+
+// hasRole reports whether the membership of a user has the given role.
+func hasRole(ctx context.Context, tx *sql.Tx, tenantID, userID int64, role string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM memberships WHERE tenant_id = ? AND user_id = ? AND role = ?`,
+		tenantID, userID, role).Scan(&n)
+	return n > 0, err
+}
+
+// keepOwner returns ErrLastOwner when the changes made by tx left the tenant without an active
+// membership with the owner role. Checking after the change, within the transaction, also holds
+// when two owners are demoted at once.
+func keepOwner(ctx context.Context, tx *sql.Tx, tenantID int64, owner string) error {
+	var n int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM memberships
+		WHERE tenant_id = ? AND role = ? AND status = ? AND is_active = 1`,
+		tenantID, owner, MembershipActive).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// PendingSignup is a registration waiting for its email confirmation.
+type PendingSignup struct {
+	ID        int64
+	Email     string
+	Role      string // Role granted by the signup link, if any
+	ExpiresAt time.Time
+}
+
+// ListPendingSignups returns the tenant's unconfirmed registrations that have not expired.
+func ListPendingSignups(ctx context.Context, tenantID int64) ([]PendingSignup, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, email, COALESCE(role, ''), expires_at
+		FROM pending_user_signups
+		WHERE tenant_id = ? AND expires_at > ?
+		ORDER BY expires_at`, tenantID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PendingSignup
+	for rows.Next() {
+		var p PendingSignup
+		if err := rows.Scan(&p.ID, &p.Email, &p.Role, &p.ExpiresAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// CancelPendingSignup deletes an unconfirmed registration, so its confirmation link stops working.
+// It reports whether the registration was found, and returns ErrLegalHold while the tenant is held.
+func CancelPendingSignup(ctx context.Context, tenantID, id int64) (bool, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return false, err
+	}
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM pending_user_signups WHERE id = ? AND tenant_id = ?`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// MetaSettings holds what a tenant shows to search engines and link previews.
+// Empty fields fall back to the tenant name and the platform description.
+type MetaSettings struct {
+	TenantID    int64
+	Title       string
+	Description string
+	LogoPath    string // From tenants.logo_path, used as og:image
+}
+
+// GetMetaSettings returns the tenant's meta settings with its logo, or nil when the tenant does not exist.
+func GetMetaSettings(ctx context.Context, tenantID int64) (*MetaSettings, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT t.id, COALESCE(m.title, ''), COALESCE(m.description, ''), COALESCE(t.logo_path, '')
+		FROM tenants t
+		LEFT JOIN tenant_meta_settings m ON m.tenant_id = t.id
+		WHERE t.id = ?`, tenantID)
+	var s MetaSettings
+	err := row.Scan(&s.TenantID, &s.Title, &s.Description, &s.LogoPath)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SetMetaSettings creates or replaces the tenant's title and description.
+func SetMetaSettings(ctx context.Context, s MetaSettings) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_meta_settings (tenant_id, title, description, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id) DO UPDATE SET title = excluded.title, description = excluded.description, updated_at = excluded.updated_at`,
+		s.TenantID, s.Title, s.Description, time.Now())
+	if err == nil {
+		TenantChanged(s.TenantID)
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"context"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// GetHiddenNavItems returns the IDs of navigation items the tenant has hidden.
+func GetHiddenNavItems(ctx context.Context, tenantID int64) (map[string]bool, error) {
+	rows, err := db.LogQuery(ctx, db.DB,
+		`SELECT item_id FROM tenant_nav_settings WHERE tenant_id = ? AND hidden = 1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hidden := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
+
+// SetHiddenNavItems replaces the tenant's hidden navigation items.
+func SetHiddenNavItems(ctx context.Context, tenantID int64, ids []string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenant_nav_settings WHERE tenant_id = ?`, tenantID); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO tenant_nav_settings (tenant_id, item_id, hidden) VALUES (?, ?, 1)`, tenantID, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	TenantChanged(tenantID)
+	return nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Notification is an in-app message to a user. Key and Args are a translation key and its named
+// arguments, so the message is shown in the language of the reader rather than of the sender.
+type Notification struct {
+	ID        int64
+	TenantID  int64
+	UserID    int64
+	Key       string
+	Args      map[string]any
+	URL       string // Page the notification leads to, "" for none
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+// Unread reports whether the user has not opened the notification or marked it read.
+func (n Notification) Unread() bool {
+	return !n.ReadAt.Valid
+}
+
+// CreateNotification records a notification for its user, in the tenant of the user, and sets its
+// ID and TenantID. ID stays 0 when the user does not exist.
+func CreateNotification(ctx context.Context, n *Notification) error {
+	args, err := json.Marshal(n.Args)
+	if err != nil {
+		return err
+	}
+	if n.Args == nil {
+		args = []byte("{}")
+	}
+	err = db.LogQueryRow(ctx, db.DB, `SELECT tenant_id FROM users WHERE id = ?`, n.UserID).Scan(&n.TenantID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO notifications (tenant_id, user_id, key, args, url) VALUES (?, ?, ?, ?, ?)`,
+		n.TenantID, n.UserID, n.Key, string(args), n.URL)
+	if err != nil {
+		return err
+	}
+	n.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListNotifications returns the latest notifications of a user that were not dismissed, newest first.
+func ListNotifications(ctx context.Context, tenantID, userID int64, limit int) ([]Notification, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, tenant_id, user_id, key, args, url, created_at, read_at
+		FROM notifications
+		WHERE tenant_id = ? AND user_id = ? AND dismissed_at IS NULL
+		ORDER BY created_at DESC, id DESC LIMIT ?`, tenantID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Notification
+	for rows.Next() {
+		var n Notification
+		var args string
+		if err := rows.Scan(&n.ID, &n.TenantID, &n.UserID, &n.Key, &args, &n.URL, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(args), &n.Args); err != nil {
+			slog.WarnContext(ctx, "[NOTIFY] Invalid notification arguments", "id", n.ID, "err", err)
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// GetNotification returns a notification of the user, nil when it does not exist or was dismissed.
+func GetNotification(ctx context.Context, tenantID, userID, id int64) (*Notification, error) {
+	var n Notification
+	var args string
+	err := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, tenant_id, user_id, key, args, url, created_at, read_at
+		FROM notifications
+		WHERE id = ? AND tenant_id = ? AND user_id = ? AND dismissed_at IS NULL`, id, tenantID, userID).
+		Scan(&n.ID, &n.TenantID, &n.UserID, &n.Key, &args, &n.URL, &n.CreatedAt, &n.ReadAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(args), &n.Args)
+	return &n, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of a user.
+func CountUnreadNotifications(ctx context.Context, tenantID, userID int64) (int, error) {
+	var n int
+	err := db.LogQueryRow(ctx, db.DB, `
+		SELECT COUNT(*) FROM notifications
+		WHERE tenant_id = ? AND user_id = ? AND read_at IS NULL AND dismissed_at IS NULL`, tenantID, userID).Scan(&n)
+	return n, err
+}
+
+// MarkNotificationsRead marks a notification of the user read, or all of them when id is 0, and
+// returns the number of notifications changed.
+func MarkNotificationsRead(ctx context.Context, tenantID, userID, id int64) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE notifications SET read_at = ?
+		WHERE tenant_id = ? AND user_id = ? AND read_at IS NULL AND (? = 0 OR id = ?)`,
+		time.Now(), tenantID, userID, id, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DismissNotifications hides a notification of the user, or all of them when id is 0, and returns
+// the number of notifications dismissed.
+func DismissNotifications(ctx context.Context, tenantID, userID, id int64) (int64, error) {
+	now := time.Now()
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE notifications SET dismissed_at = ?, read_at = COALESCE(read_at, ?)
+		WHERE tenant_id = ? AND user_id = ? AND dismissed_at IS NULL AND (? = 0 OR id = ?)`,
+		now, now, tenantID, userID, id, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
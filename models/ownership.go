@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrTransferInvalid is returned by AcceptOwnershipTransfer for an unknown, expired or used offer,
+// an offer for another user, or one whose sender is no longer an owner.
+var ErrTransferInvalid = errors.New("invalid, expired or used ownership transfer")
+
+// OwnershipTransfer is an owner's offer to hand a tenant over to another member, who accepts it
+// from the link they were mailed.
+type OwnershipTransfer struct {
+	ID         int64
+	TenantID   int64
+	FromUserID int64
+	FromEmail  string
+	ToUserID   int64
+	ToEmail    string
+	ExpiresAt  time.Time
+}
+
+// hashTransferToken returns the value stored in ownership_transfers.token_hash.
+func hashTransferToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateOwnershipTransfer offers the tenant to a member and returns the token of the offer in
+// clear. A tenant has one offer at a time: a new one replaces the offers still pending.
+func CreateOwnershipTransfer(ctx context.Context, tenantID, fromUserID, toUserID int64, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ownership_transfers WHERE tenant_id = ? AND accepted_at IS NULL`, tenantID); err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ownership_transfers (tenant_id, from_user_id, to_user_id, token_hash, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, tenantID, fromUserID, toUserID, hashTransferToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+const transferColumns = `t.id, t.tenant_id, t.from_user_id, f.email, t.to_user_id, u.email, t.expires_at`
+
+const transferFrom = `
+	FROM ownership_transfers t
+	JOIN users f ON f.id = t.from_user_id
+	JOIN users u ON u.id = t.to_user_id`
+
+func scanTransfer(row *sql.Row) (*OwnershipTransfer, error) {
+	var o OwnershipTransfer
+	err := row.Scan(&o.ID, &o.TenantID, &o.FromUserID, &o.FromEmail, &o.ToUserID, &o.ToEmail, &o.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// PendingOwnershipTransfer returns the tenant's unexpired offer waiting for its answer, or nil.
+func PendingOwnershipTransfer(ctx context.Context, tenantID int64) (*OwnershipTransfer, error) {
+	return scanTransfer(db.LogQueryRow(ctx, db.DB, `
+		SELECT `+transferColumns+transferFrom+`
+		WHERE t.tenant_id = ? AND t.accepted_at IS NULL AND t.expires_at > ?`, tenantID, time.Now()))
+}
+
+// GetOwnershipTransfer returns the pending offer of a token without accepting it, or nil when the
+// token is unknown, expired or used.
+func GetOwnershipTransfer(ctx context.Context, tenantID int64, token string) (*OwnershipTransfer, error) {
+	return scanTransfer(db.LogQueryRow(ctx, db.DB, `
+		SELECT `+transferColumns+transferFrom+`
+		WHERE t.token_hash = ? AND t.tenant_id = ? AND t.accepted_at IS NULL AND t.expires_at > ?`,
+		hashTransferToken(token), tenantID, time.Now()))
+}
+
+// CancelOwnershipTransfer withdraws the tenant's pending offer, so its link stops working. It
+// reports whether an offer was pending.
+func CancelOwnershipTransfer(ctx context.Context, tenantID int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM ownership_transfers WHERE tenant_id = ? AND accepted_at IS NULL`, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// AcceptOwnershipTransfer consumes the offer of token on behalf of userID, who must be the active
+// member it was made to: they get the owner role and the sender, still an owner, gets the previous
+// role, in one transaction.
+func AcceptOwnershipTransfer(ctx context.Context, tenantID, userID int64, token, owner, previous string) (*OwnershipTransfer, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Step 1: Mark the offer accepted; the WHERE clause makes concurrent uses lose the race
+	now := time.Now()
+	hash := hashTransferToken(token)
+	res, err := tx.ExecContext(ctx, `
+		UPDATE ownership_transfers SET accepted_at = ?
+		WHERE token_hash = ? AND tenant_id = ? AND to_user_id = ? AND accepted_at IS NULL AND expires_at > ?`,
+		now, hash, tenantID, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, ErrTransferInvalid
+	}
+	var o OwnershipTransfer
+	err = tx.QueryRowContext(ctx, `SELECT `+transferColumns+transferFrom+` WHERE t.token_hash = ?`, hash).
+		Scan(&o.ID, &o.TenantID, &o.FromUserID, &o.FromEmail, &o.ToUserID, &o.ToEmail, &o.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: Only an owner may still hand the tenant over
+	if ok, err := hasRole(ctx, tx, tenantID, o.FromUserID, owner); err != nil || !ok {
+		if err == nil {
+			err = ErrTransferInvalid
+		}
+		return nil, err
+	}
+
+	// Step 3: Promote the recipient, whose membership must be active, then demote the sender
+	res, err = tx.ExecContext(ctx, `
+		UPDATE memberships SET role = ?
+		WHERE tenant_id = ? AND user_id = ? AND status = ? AND is_active = 1`,
+		owner, tenantID, userID, MembershipActive)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return nil, ErrTransferInvalid
+	}
+	for _, c := range []struct {
+		id   int64
+		role string
+	}{{userID, owner}, {o.FromUserID, previous}} {
+		if _, err := tx.ExecContext(ctx, `UPDATE memberships SET role = ? WHERE tenant_id = ? AND user_id = ?`, c.role, tenantID, c.id); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET role = ? WHERE id = ? AND tenant_id = ?`, c.role, c.id, tenantID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	UserChanged(userID)
+	UserChanged(o.FromUserID)
+	return &o, nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// MaxOutstandingResets caps the number of unused, unexpired reset tokens per user.
+const MaxOutstandingResets = 3
+
+var (
+	ErrTooManyResets = errors.New("too many outstanding password resets")
+	ErrResetInvalid  = errors.New("invalid, expired or used reset token")
+)
+
+// hashResetToken returns the value stored in password_resets.token_hash.
+// Only the hash is persisted so a database leak does not expose usable tokens.
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePasswordReset mints a random single-use reset token for the user and returns it in clear.
+func CreatePasswordReset(ctx context.Context, userID, tenantID int64, ttl time.Duration) (string, error) {
+	var outstanding int
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT COUNT(*) FROM password_resets
+		WHERE user_id = ? AND used_at IS NULL AND expires_at > ?`, userID, time.Now())
+	if err := row.Scan(&outstanding); err != nil {
+		return "", err
+	}
+	if outstanding >= MaxOutstandingResets {
+		return "", ErrTooManyResets
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO password_resets (user_id, tenant_id, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)`, userID, tenantID, hashResetToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// PasswordResetValid reports whether the token can still be used, without consuming it.
+func PasswordResetValid(ctx context.Context, token string, tenantID int64) bool {
+	var id int64
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id FROM password_resets
+		WHERE token_hash = ? AND tenant_id = ? AND used_at IS NULL AND expires_at > ?`,
+		hashResetToken(token), tenantID, time.Now())
+	return row.Scan(&id) == nil
+}
+
+// ResetPassword consumes the token and sets the new password hash in one transaction.
+// All sessions and other outstanding resets of the user are revoked.
+func ResetPassword(ctx context.Context, token string, tenantID int64, passwordHash string) (int64, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Step 1: Mark the token used; the WHERE clause makes concurrent uses lose the race
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE password_resets SET used_at = ?
+		WHERE token_hash = ? AND tenant_id = ? AND used_at IS NULL AND expires_at > ?`,
+		now, hashResetToken(token), tenantID, now)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return 0, ErrResetInvalid
+	}
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM password_resets WHERE token_hash = ?`,
+		hashResetToken(token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrResetInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Step 2: Update the password and revoke everything issued before
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, now, userID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	UserChanged(userID)
+	return userID, nil
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Profile holds the fields users edit themselves at /account/profile.
+type Profile struct {
+	Name     string
+	Lang     string // "" to negotiate the language from the browser
+	Timezone string // "" for the tenant's time zone
+}
+
+// DisplayName returns the name of the user, or their email address until they set one.
+func (u *User) DisplayName() string {
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Email
+}
+
+// AvatarURL returns the path of the user's avatar, "" without one. The query changes with every
+// upload so browsers may cache it indefinitely.
+func (u *User) AvatarURL() string {
+	if u.AvatarKey == "" {
+		return ""
+	}
+	return fmt.Sprintf("/avatars/%d?v=%s", u.ID, AvatarVersion(u.AvatarKey))
+}
+
+// AvatarVersion returns the part of an avatar key that changes with every upload.
+func AvatarVersion(key string) string {
+	return strings.TrimSuffix(path.Base(key), path.Ext(key))
+}
+
+// UpdateProfile stores the profile of a user.
+func UpdateProfile(ctx context.Context, userID int64, p Profile) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE users SET name = NULLIF(?, ''), lang = NULLIF(?, ''), timezone = NULLIF(?, '')
+		WHERE id = ?`, p.Name, p.Lang, p.Timezone, userID)
+	if err == nil {
+		UserChanged(userID)
+	}
+	return err
+}
+
+// SetUserAvatar records the storage key of a user's avatar, "" to remove it.
+func SetUserAvatar(ctx context.Context, userID int64, key string) error {
+	_, err := db.LogExec(ctx, db.DB, `UPDATE users SET avatar_key = NULLIF(?, '') WHERE id = ?`, key, userID)
+	if err == nil {
+		UserChanged(userID)
+	}
+	return err
+}
+
+// GetUserAvatarKey returns the avatar key of a user of the tenant, "" when they have none or
+// belong to another tenant.
+func GetUserAvatarKey(ctx context.Context, tenantID, userID int64) (string, error) {
+	var key string
+	err := db.LogQueryRow(ctx, db.DB, `
+		SELECT COALESCE(avatar_key, '') FROM users WHERE id = ? AND tenant_id = ?`, userID, tenantID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return key, err
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrTenantExists is returned when the name, subdomain or contact email already belongs to a tenant,
+// including soft-deleted tenants that can still be restored. The errors naming the field taken,
+// such as ErrSubdomainTaken, match it with errors.Is.
+var ErrTenantExists = errors.New("name, subdomain or email already taken")
+
+// Fields of a new tenant already used by another one.
+var (
+	ErrSubdomainTaken   error = takenError("subdomain")
+	ErrTenantNameTaken  error = takenError("name")
+	ErrTenantEmailTaken error = takenError("email")
+)
+
+type takenError string
+
+func (e takenError) Error() string { return string(e) + " already taken" }
+
+func (e takenError) Is(target error) bool { return target == ErrTenantExists }
+
+// NewTenant is a tenant to create with its owner account.
+type NewTenant struct {
+	Name         string
+	Subdomain    string
+	OwnerEmail   string
+	PasswordHash string // bcrypt hash; empty leaves the owner to set a password through the reset flow
+	OwnerRole    string
+	Plan         string // Limits plan, "" for the platform default
+	ParentID     int64  // Parent of a sub-tenant, 0 for a top-level tenant
+}
+
+// CreateTenantWithOwner creates an active tenant, its owner user and the owner's membership in one
+// transaction, and returns the tenant and user IDs.
+func CreateTenantWithOwner(ctx context.Context, t NewTenant) (tenantID, userID int64, err error) {
+	err = ProvisionTx(ctx, func(tx *sql.Tx) error {
+		if err := TenantConflict(ctx, tx, t.Name, t.Subdomain, t.OwnerEmail); err != nil {
+			return err
+		}
+		tenantID, userID, err = InsertTenantWithOwner(ctx, tx, t)
+		return err
+	})
+	return tenantID, userID, err
+}
+
+// InsertTenantWithOwner inserts an active tenant, its owner user and the owner's membership within
+// tx, which should be run by ProvisionTx.
+func InsertTenantWithOwner(ctx context.Context, tx *sql.Tx, t NewTenant) (tenantID, userID int64, err error) {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO tenants (name, slug, subdomain, email, plan, parent_tenant_id, is_active, is_deleted)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, 0), 1, 0)`, t.Name, t.Subdomain, t.Subdomain, t.OwnerEmail, t.Plan, t.ParentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if tenantID, err = res.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+	res, err = tx.ExecContext(ctx, `
+		INSERT INTO users (email, password_hash, is_verified, tenant_id, role)
+		VALUES (?, ?, 1, ?, ?)`, t.OwnerEmail, t.PasswordHash, tenantID, t.OwnerRole)
+	if err != nil {
+		return 0, 0, err
+	}
+	if userID, err = res.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO memberships (user_id, tenant_id, role, is_active) VALUES (?, ?, ?, 1)`,
+		userID, tenantID, t.OwnerRole); err != nil {
+		return 0, 0, err
+	}
+	return tenantID, userID, nil
+}
+
+// provisionAttempts bounds the runs of a provisioning transaction.
+const provisionAttempts = 3
+
+// ProvisionTx runs fn, which checks and creates a tenant, in a transaction committed when fn
+// returns nil. The checks of fn cannot see a tenant created at the same time by another
+// transaction, so the unique constraints of the tables decide the race: the losing insert fails,
+// and fn runs again from the start in a new transaction, where its checks see the winner and tell
+// why the tenant is refused. A busy database is retried the same way. A violation left after the
+// last run is returned as ErrSubdomainTaken, ErrTenantNameTaken or ErrTenantEmailTaken.
+func ProvisionTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	err := db.RetryTx(ctx, provisionAttempts, func(err error) bool {
+		return db.IsBusy(err) || takenField(err) != nil
+	}, fn)
+	if taken := takenField(err); taken != nil {
+		return taken
+	}
+	return err
+}
+
+// takenField translates the violation of a unique constraint on a new tenant or owner.
+func takenField(err error) error {
+	switch db.UniqueViolation(err) {
+	case "tenants.subdomain", "tenants.slug":
+		return ErrSubdomainTaken
+	case "tenants.name":
+		return ErrTenantNameTaken
+	case "tenants.email":
+		return ErrTenantEmailTaken
+	}
+	return nil
+}
+
+// TenantConflict returns the error of the first field of a new tenant already used by a tenant,
+// including a soft-deleted one, or nil when none is. It runs within tx, or on the database when tx
+// is nil; outside of ProvisionTx its answer is only advisory, as a concurrent signup may take the
+// fields before the tenant is created.
+func TenantConflict(ctx context.Context, tx *sql.Tx, name, sub, email string) error {
+	const query = `
+		SELECT LOWER(subdomain) = LOWER(?), LOWER(name) = LOWER(?), LOWER(email) = LOWER(?) FROM tenants
+		WHERE LOWER(subdomain) = LOWER(?) OR LOWER(name) = LOWER(?) OR LOWER(email) = LOWER(?)
+		ORDER BY 1 DESC, 2 DESC LIMIT 1`
+	args := []any{sub, name, email, sub, name, email}
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, args...)
+	} else {
+		row = db.LogQueryRow(ctx, db.DB, query, args...)
+	}
+	var subTaken, nameTaken, emailTaken bool
+	switch err := row.Scan(&subTaken, &nameTaken, &emailTaken); {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	case subTaken:
+		return ErrSubdomainTaken
+	case nameTaken:
+		return ErrTenantNameTaken
+	default:
+		return ErrTenantEmailTaken
+	}
+}
+
+// SignupVerified reports whether email owns a verified account on a tenant with the name, subdomain
+// or contact email of a tenant signup, which means the signup was verified. It runs within tx, or
+// on the database when tx is nil.
+func SignupVerified(ctx context.Context, tx *sql.Tx, email, name, sub string) (bool, error) {
+	const query = `
+		SELECT COUNT(*) FROM users u JOIN tenants t ON t.id = u.tenant_id
+		WHERE LOWER(u.email) = LOWER(?) AND u.is_verified = 1
+		AND (LOWER(t.subdomain) = LOWER(?) OR LOWER(t.email) = LOWER(?) OR LOWER(t.name) = LOWER(?))`
+	args := []any{email, sub, email, name}
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, args...)
+	} else {
+		row = db.LogQueryRow(ctx, db.DB, query, args...)
+	}
+	var n int
+	err := row.Scan(&n)
+	return n > 0, err
+}
+
+// SubdomainTaken reports whether a tenant, including a soft-deleted one, already uses sub.
+func SubdomainTaken(ctx context.Context, sub string) (bool, error) {
+	var n int
+	err := db.LogQueryRow(ctx, db.DB, `SELECT COUNT(*) FROM tenants WHERE LOWER(subdomain) = LOWER(?)`, sub).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+)
+
+// Report job statuses stored in report_jobs.status.
+const (
+	ReportPending = "pending"
+	ReportRunning = "running"
+	ReportReady   = "ready"
+	ReportFailed  = "failed"
+)
+
+// ReportJob tracks a report generated in the background for a user.
+type ReportJob struct {
+	ID          int64
+	Kind        string
+	TenantID    int64
+	UserID      int64
+	Status      string
+	Progress    int // 0-100
+	StorageKey  sql.NullString
+	ContentType sql.NullString
+	Error       sql.NullString
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+}
+
+func CreateReportJob(ctx context.Context, kind string, tenantID, userID int64) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`INSERT INTO report_jobs (kind, tenant_id, user_id, status) VALUES (?, ?, ?, ?)`,
+		kind, tenantID, userID, ReportPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// SetReportProgress marks the job running and records its completion percentage.
+func SetReportProgress(ctx context.Context, id int64, progress int) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE report_jobs SET status = ?, progress = ? WHERE id = ?`, ReportRunning, progress, id)
+	return err
+}
+
+func MarkReportReady(ctx context.Context, id int64, key, contentType string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE report_jobs SET status = ?, progress = 100, storage_key = ?, content_type = ?, completed_at = ?
+		WHERE id = ?`, ReportReady, key, contentType, time.Now(), id)
+	return err
+}
+
+func MarkReportFailed(ctx context.Context, id int64, cause error) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE report_jobs SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+		ReportFailed, cause.Error(), time.Now(), id)
+	return err
+}
+
+func GetReportJob(ctx context.Context, id int64) (*ReportJob, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, kind, tenant_id, user_id, status, progress, storage_key, content_type, error, created_at, completed_at
+		FROM report_jobs WHERE id = ?`, id)
+	var j ReportJob
+	err := row.Scan(&j.ID, &j.Kind, &j.TenantID, &j.UserID, &j.Status, &j.Progress,
+		&j.StorageKey, &j.ContentType, &j.Error, &j.CreatedAt, &j.CompletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// TenantMember is a row of the member report.
+type TenantMember struct {
+	UserID   int64
+	Email    string
+	Name     string
+	Role     string
+	IsActive bool
+	Status   string // MembershipActive or MembershipPending; deactivated memberships stay active with IsActive false
+	JoinedAt time.Time
+}
+
+// ListTenantMembers returns every membership of the tenant.
+func ListTenantMembers(ctx context.Context, tenantID int64) ([]TenantMember, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT `+memberColumns+`
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.tenant_id = ?
+		ORDER BY m.status = 'pending' DESC, m.joined_at`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantMember
+	for rows.Next() {
+		m, err := scanTenantMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// MemberList pages through the members of a tenant. Filters: "q" matches the email or name,
+// "role" a role, "status" is "active", "inactive" (deactivated) or "pending".
+var MemberList = &pagination.List{
+	Sorts: map[string]string{
+		"email":  "u.email",
+		"name":   "COALESCE(NULLIF(u.name, ''), u.email)",
+		"role":   "m.role",
+		"joined": "m.joined_at",
+	},
+	Sort:    "joined",
+	Filters: []string{"q", "role", "status"},
+}
+
+// PageTenantMembers returns a page of the members of the tenant, see MemberList.
+func PageTenantMembers(ctx context.Context, tenantID int64, req pagination.Request) ([]TenantMember, pagination.Page, error) {
+	q := &pagination.Query{
+		Select:   memberColumns,
+		From:     "memberships m JOIN users u ON u.id = m.user_id",
+		Tenant:   "m.tenant_id",
+		TenantID: tenantID,
+		ID:       "u.id",
+	}
+	if v := req.Filter("q"); v != "" {
+		q.Where(`u.email LIKE ? ESCAPE '\' OR u.name LIKE ? ESCAPE '\'`, pagination.Contains(v), pagination.Contains(v))
+	}
+	if v := req.Filter("role"); v != "" {
+		q.Where("m.role = ?", v)
+	}
+	switch req.Filter("status") {
+	case MembershipActive:
+		q.Where("m.status = ? AND m.is_active = 1", MembershipActive)
+	case MembershipInactive:
+		q.Where("m.status = ? AND m.is_active = 0", MembershipActive)
+	case MembershipPending:
+		q.Where("m.status = ?", MembershipPending)
+	}
+	return pagination.Fetch(ctx, q, req, scanTenantMember, func(m TenantMember) int64 { return m.UserID })
+}
+
+const memberColumns = `u.id, u.email, COALESCE(u.name, ''), COALESCE(m.role, 'member'), m.is_active, m.status, m.joined_at`
+
+func scanTenantMember(rows *sql.Rows) (TenantMember, error) {
+	var m TenantMember
+	err := rows.Scan(&m.UserID, &m.Email, &m.Name, &m.Role, &m.IsActive, &m.Status, &m.JoinedAt)
+	return m, err
+}
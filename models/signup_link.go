@@ -0,0 +1,103 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// SignupLink is a shareable registration link that admits users with a given role.
+type SignupLink struct {
+	ID        int64
+	TenantID  int64
+	Role      string
+	MaxUses   int // 0 for unlimited
+	Uses      int
+	ExpiresAt time.Time
+	CreatedBy int64
+	CreatedAt time.Time
+	RevokedAt sql.NullTime
+}
+
+// Usable reports whether the link can still admit a user.
+func (l *SignupLink) Usable() bool {
+	return !l.RevokedAt.Valid && time.Now().Before(l.ExpiresAt) && (l.MaxUses == 0 || l.Uses < l.MaxUses)
+}
+
+func CreateSignupLink(ctx context.Context, l SignupLink) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO signup_links (tenant_id, role, max_uses, expires_at, created_by) VALUES (?, ?, ?, ?, ?)`,
+		l.TenantID, l.Role, l.MaxUses, l.ExpiresAt, l.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetSignupLink returns a link of the tenant, or nil when it does not exist.
+func GetSignupLink(ctx context.Context, tenantID, id int64) (*SignupLink, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, tenant_id, role, max_uses, uses, expires_at, created_by, created_at, revoked_at
+		FROM signup_links WHERE id = ? AND tenant_id = ?`, id, tenantID)
+	var l SignupLink
+	err := row.Scan(&l.ID, &l.TenantID, &l.Role, &l.MaxUses, &l.Uses, &l.ExpiresAt, &l.CreatedBy, &l.CreatedAt, &l.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListSignupLinks returns the tenant's links that are neither revoked nor expired, newest first.
+func ListSignupLinks(ctx context.Context, tenantID int64) ([]SignupLink, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, tenant_id, role, max_uses, uses, expires_at, created_by, created_at, revoked_at
+		FROM signup_links
+		WHERE tenant_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC`, tenantID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SignupLink
+	for rows.Next() {
+		var l SignupLink
+		if err := rows.Scan(&l.ID, &l.TenantID, &l.Role, &l.MaxUses, &l.Uses, &l.ExpiresAt,
+			&l.CreatedBy, &l.CreatedAt, &l.RevokedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// RevokeSignupLink disables a link. It reports whether an active link of the tenant was found.
+func RevokeSignupLink(ctx context.Context, tenantID, id int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`UPDATE signup_links SET revoked_at = ? WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL`,
+		time.Now(), id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UseSignupLink counts one use of a link inside tx. It reports false when the link is revoked,
+// expired or exhausted, in which case nothing is counted.
+func UseSignupLink(ctx context.Context, tx *sql.Tx, tenantID, id int64) (bool, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE signup_links SET uses = uses + 1
+		WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL AND expires_at > ?
+		  AND (max_uses = 0 OR uses < max_uses)`, id, tenantID, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// supportAlphabet is Crockford's base32: no I, L, O or U, so codes survive being read aloud.
+const supportAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+type requestIDKey struct{}
+
+// WithRequestID attaches the request ID to ctx, so audit entries, emails and background work
+// started by the request can be traced back to it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID attached with WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// SupportCode derives the short code users quote to support from a request ID, e.g. "7KQ2-M9XD".
+// It is stable for a request ID and resolved back through GetSupportRef once recorded.
+func SupportCode(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(requestID))
+	var bits uint64
+	for _, b := range sum[:5] {
+		bits = bits<<8 | uint64(b)
+	}
+	code := make([]byte, 8)
+	for i := 7; i >= 0; i-- {
+		code[i] = supportAlphabet[bits&31]
+		bits >>= 5
+	}
+	return string(code[:4]) + "-" + string(code[4:])
+}
+
+// NormalizeSupportCode converts a code as typed by a user, in any case, with or without the dash
+// and with the letters Crockford maps to digits, to the form returned by SupportCode.
+// It returns "" when the input cannot be a support code.
+func NormalizeSupportCode(code string) string {
+	var out []byte
+	for _, c := range strings.ToUpper(code) {
+		switch c {
+		case '-', ' ':
+			continue
+		case 'O':
+			c = '0'
+		case 'I', 'L':
+			c = '1'
+		}
+		if !strings.ContainsRune(supportAlphabet, c) {
+			return ""
+		}
+		out = append(out, byte(c))
+	}
+	if len(out) != 8 {
+		return ""
+	}
+	return string(out[:4]) + "-" + string(out[4:])
+}
+
+// SupportRef is the context recorded when a support code is shown to a user.
+type SupportRef struct {
+	Code      string
+	RequestID string
+	TenantID  int64 // 0 on the root domain
+	UserID    int64 // 0 for anonymous requests
+	Method    string
+	Path      string
+	Status    int // 0 when the page did not report one
+	CreatedAt time.Time
+	Subdomain string // Filled by GetSupportRef
+	UserEmail string // Filled by GetSupportRef
+}
+
+// RecordSupportRef stores the context of a support code. Only the first record of a request is kept;
+// failures are logged by the caller and never block the error page.
+func RecordSupportRef(ctx context.Context, ref SupportRef) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT OR IGNORE INTO support_refs (code, request_id, tenant_id, user_id, method, path, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		ref.Code, ref.RequestID, nullInt(ref.TenantID), nullInt(ref.UserID), ref.Method, ref.Path, ref.Status)
+	return err
+}
+
+// GetSupportRef returns the context recorded for a support code, or nil when it is unknown.
+func GetSupportRef(ctx context.Context, code string) (*SupportRef, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT s.code, s.request_id, COALESCE(s.tenant_id, 0), COALESCE(s.user_id, 0), s.method, s.path, s.status, s.created_at,
+			COALESCE(t.subdomain, ''), COALESCE(u.email, '')
+		FROM support_refs s
+		LEFT JOIN tenants t ON t.id = s.tenant_id
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.code = ?`, NormalizeSupportCode(code))
+	var ref SupportRef
+	err := row.Scan(&ref.Code, &ref.RequestID, &ref.TenantID, &ref.UserID, &ref.Method, &ref.Path, &ref.Status, &ref.CreatedAt,
+		&ref.Subdomain, &ref.UserEmail)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
@@ -3,7 +3,8 @@ package models
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/pandamasta/tenkit/db"
@@ -27,31 +28,101 @@ type Tenant struct {
 	Timezone     string
 	Address      sql.NullString
 	Country      sql.NullString
+	// RateLimitFactor scales every rate limit applied on the tenant (e.g. 5 for a paid plan)
+	RateLimitFactor float64
+	SecondaryColor  sql.NullString
+	Theme           sql.NullString
+	BrandingVersion int64         // Bumped on every branding change to bust caches
+	Plan            string        // Name of the limits plan, "" for the platform default
+	ParentID        sql.NullInt64 // Parent of a sub-tenant, whose subdomain ends with the parent's
 }
 
+// GetTenantBySubdomain returns a tenant that is not deleted, including suspended ones (IsActive false).
 func GetTenantBySubdomain(ctx context.Context, conn *sql.DB, subdomain string) (*Tenant, error) {
-	log.Printf("[DB] 🔍 Querying tenant: %q", subdomain)
+	slog.DebugContext(ctx, "[DB] Querying tenant", "subdomain", subdomain)
 
 	row := db.LogQueryRow(ctx, conn, `
 		SELECT id, name, slug, subdomain, custom_domain, email, primary_color,
 		       logo_path, is_active, is_deleted, allow_signins,
-		       created_at, updated_at, deleted_at, timezone, address, country
+		       created_at, updated_at, deleted_at, timezone, address, country,
+		       COALESCE(rate_limit_factor, 1), secondary_color, theme, branding_version, COALESCE(plan, ''), parent_tenant_id
 		FROM tenants
-		WHERE subdomain = ? AND is_active = 1 AND is_deleted = 0
+		WHERE subdomain = ? AND is_deleted = 0
 	`, subdomain)
 
 	var t Tenant
 	err := row.Scan(&t.ID, &t.Name, &t.Slug, &t.Subdomain, &t.CustomDomain,
 		&t.Email, &t.PrimaryColor, &t.LogoPath, &t.IsActive, &t.IsDeleted,
 		&t.AllowSignins, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
-		&t.Timezone, &t.Address, &t.Country)
+		&t.Timezone, &t.Address, &t.Country, &t.RateLimitFactor,
+		&t.SecondaryColor, &t.Theme, &t.BrandingVersion, &t.Plan, &t.ParentID)
 
 	if err == sql.ErrNoRows {
-		log.Printf("[DB] ❌ No tenant matched: %q", subdomain)
+		slog.DebugContext(ctx, "[DB] No tenant matched", "subdomain", subdomain)
 		return nil, nil
 	}
 	if err != nil {
-		log.Printf("[DB] ❌ Query failed: %v", err)
+		slog.ErrorContext(ctx, "[DB] Tenant query failed", "subdomain", subdomain, "error", err)
 	}
 	return &t, err
 }
+
+// SetTenantRateLimitFactor overrides the rate limits of a tenant; 1 restores the defaults.
+func SetTenantRateLimitFactor(ctx context.Context, tenantID int64, factor float64) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE tenants SET rate_limit_factor = ?, updated_at = ? WHERE id = ?`, factor, time.Now(), tenantID)
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
+
+// SetTenantPlan moves a tenant to another limits plan; "" falls back to the platform default.
+func SetTenantPlan(ctx context.Context, tenantID int64, plan string) error {
+	_, err := db.LogExec(ctx, db.DB,
+		`UPDATE tenants SET plan = NULLIF(?, ''), updated_at = ? WHERE id = ?`, plan, time.Now(), tenantID)
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
+
+var (
+	tenantHooksMu sync.RWMutex
+	tenantHooks   []func(tenantID int64)
+)
+
+// OnTenantChange registers fn to run after a tenant row is updated, e.g. to drop cached copies.
+func OnTenantChange(fn func(tenantID int64)) {
+	tenantHooksMu.Lock()
+	defer tenantHooksMu.Unlock()
+	tenantHooks = append(tenantHooks, fn)
+}
+
+// TenantChanged runs the OnTenantChange hooks. Code updating the tenants table, or the settings
+// loaded with it, must call it. The hooks also run for the sub-tenants, which inherit branding and
+// settings from their parent.
+func TenantChanged(tenantID int64) {
+	children, err := ChildTenantIDs(context.Background(), tenantID)
+	if err != nil {
+		slog.Error("[DB] Failed to list sub-tenants", "tenant_id", tenantID, "error", err)
+	}
+	tenantHooksMu.RLock()
+	defer tenantHooksMu.RUnlock()
+	for _, id := range append([]int64{tenantID}, children...) {
+		for _, fn := range tenantHooks {
+			fn(id)
+		}
+	}
+}
+
+// GetTenantSubdomain returns the subdomain of a tenant, or "" when it does not exist.
+func GetTenantSubdomain(ctx context.Context, tenantID int64) (string, error) {
+	var sub string
+	row := db.LogQueryRow(ctx, db.DB, `SELECT subdomain FROM tenants WHERE id = ?`, tenantID)
+	err := row.Scan(&sub)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return sub, err
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// archiveTimeFormat is the layout the SQLite driver writes times with, kept by archived rows so
+// that an imported row reads back like the original.
+const archiveTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// TenantRows returns every row of table whose column equals tenantID, e.g. ("users", "tenant_id"),
+// as column/value maps ready for JSON: text as strings, times in the driver's layout. table and
+// column must be names known to the code, never input.
+func TenantRows(ctx context.Context, table, column string, tenantID int64) ([]map[string]any, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT * FROM `+table+` WHERE `+column+` = ?`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []map[string]any
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			switch v := values[i].(type) {
+			case []byte:
+				row[c] = string(v)
+			case time.Time:
+				row[c] = v.Format(archiveTimeFormat)
+			default:
+				row[c] = v
+			}
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
+
+// TableColumns returns the columns of table within tx.
+func TableColumns(ctx context.Context, tx *sql.Tx, table string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// InsertRow inserts the values of row that match columns, as returned by TableColumns, into table
+// within tx and returns the ID of the new row. Keys of row outside columns are ignored, so rows
+// read from an archive never name arbitrary columns.
+func InsertRow(ctx context.Context, tx *sql.Tx, table string, columns []string, row map[string]any) (int64, error) {
+	var names, marks []string
+	var args []any
+	for _, c := range columns {
+		v, ok := row[c]
+		if !ok {
+			continue
+		}
+		names = append(names, `"`+c+`"`)
+		marks = append(marks, "?")
+		args = append(args, v)
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (`+strings.Join(names, ", ")+`) VALUES (`+strings.Join(marks, ", ")+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// ErrHasSubTenants is returned when purging a tenant whose sub-tenants have not been purged yet.
+var ErrHasSubTenants = errors.New("tenant still has sub-tenants")
+
+// SubTenant is a row of the sub-tenant list shown to the admins of the parent.
+type SubTenant struct {
+	TenantSummary
+	Members int // Active memberships
+}
+
+// ListSubTenants returns the sub-tenants of a parent that have not been purged, by name.
+func ListSubTenants(ctx context.Context, parentID int64) ([]SubTenant, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT `+tenantSummaryColumns+`,
+		       (SELECT COUNT(*) FROM memberships m WHERE m.tenant_id = tenants.id AND m.is_active = 1)
+		FROM tenants WHERE parent_tenant_id = ? ORDER BY name`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []SubTenant
+	for rows.Next() {
+		var t SubTenant
+		var active, deleted bool
+		if err := rows.Scan(&t.ID, &t.Name, &t.Subdomain, &active, &deleted, &t.SuspendedReason, &t.Plan,
+			&t.CreatedAt, &t.DeletedAt, &t.PurgeAt, &t.Members); err != nil {
+			return nil, err
+		}
+		t.State = tenantState(active, deleted)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ChildTenantIDs returns the IDs of the sub-tenants of a parent, in any state.
+func ChildTenantIDs(ctx context.Context, parentID int64) ([]int64, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT id FROM tenants WHERE parent_tenant_id = ?`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+)
+
+// Tenant lifecycle states.
+const (
+	TenantActive    = "active"
+	TenantSuspended = "suspended" // Subdomain serves the suspended page
+	TenantDeleted   = "deleted"   // Soft-deleted, purged once PurgeAt has passed
+)
+
+// ErrTenantState is returned when a transition does not apply to the tenant's current state.
+var ErrTenantState = errors.New("transition not allowed from the tenant's current state")
+
+// TenantSummary is a row of the platform tenant list.
+type TenantSummary struct {
+	ID              int64
+	Name            string
+	Subdomain       string
+	State           string
+	SuspendedReason string
+	Plan            string
+	CreatedAt       time.Time
+	DeletedAt       sql.NullTime
+	PurgeAt         sql.NullTime
+}
+
+// TenantTransition describes a lifecycle change passed to OnTenantTransition hooks.
+type TenantTransition struct {
+	TenantID  int64
+	Subdomain string
+	From, To  string // Tenant states; To is "purged" once the data is gone
+	Reason    string
+	At        time.Time
+}
+
+var (
+	transitionHooksMu sync.RWMutex
+	transitionHooks   []func(context.Context, TenantTransition)
+)
+
+// OnTenantTransition registers fn to run after every lifecycle transition, e.g. to notify webhooks.
+func OnTenantTransition(fn func(context.Context, TenantTransition)) {
+	transitionHooksMu.Lock()
+	defer transitionHooksMu.Unlock()
+	transitionHooks = append(transitionHooks, fn)
+}
+
+func notifyTransition(ctx context.Context, tr TenantTransition) {
+	TenantChanged(tr.TenantID)
+	transitionHooksMu.RLock()
+	defer transitionHooksMu.RUnlock()
+	for _, fn := range transitionHooks {
+		fn(ctx, tr)
+	}
+}
+
+// tenantState maps the tenants flags to a lifecycle state.
+func tenantState(isActive, isDeleted bool) string {
+	switch {
+	case isDeleted:
+		return TenantDeleted
+	case !isActive:
+		return TenantSuspended
+	}
+	return TenantActive
+}
+
+// GetTenantSummary returns a tenant in any state, or nil when it does not exist.
+func GetTenantSummary(ctx context.Context, tenantID int64) (*TenantSummary, error) {
+	row := db.LogQueryRow(ctx, db.DB, `
+		SELECT id, name, subdomain, is_active, is_deleted, COALESCE(suspended_reason, ''), created_at, deleted_at, purge_at
+		FROM tenants WHERE id = ?`, tenantID)
+	var t TenantSummary
+	var active, deleted bool
+	err := row.Scan(&t.ID, &t.Name, &t.Subdomain, &active, &deleted, &t.SuspendedReason, &t.CreatedAt, &t.DeletedAt, &t.PurgeAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.State = tenantState(active, deleted)
+	return &t, nil
+}
+
+// ListTenants returns every tenant that has not been purged, in creation order.
+func ListTenants(ctx context.Context) ([]TenantSummary, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT `+tenantSummaryColumns+`
+		FROM tenants ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantSummary
+	for rows.Next() {
+		t, err := scanTenantSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// TenantList pages through the tenants of the platform. Filters: "q" matches the name or
+// subdomain, "state" is TenantActive, TenantSuspended or TenantDeleted.
+var TenantList = &pagination.List{
+	Sorts: map[string]string{
+		"name":      "name",
+		"subdomain": "subdomain",
+		"created":   "created_at",
+	},
+	Sort:    "created",
+	Filters: []string{"q", "state"},
+}
+
+// PageTenants returns a page of the tenants that have not been purged, see TenantList.
+func PageTenants(ctx context.Context, req pagination.Request) ([]TenantSummary, pagination.Page, error) {
+	q := &pagination.Query{Select: tenantSummaryColumns, From: "tenants", ID: "id"}
+	if v := req.Filter("q"); v != "" {
+		q.Where(`name LIKE ? ESCAPE '\' OR subdomain LIKE ? ESCAPE '\'`, pagination.Contains(v), pagination.Contains(v))
+	}
+	switch req.Filter("state") {
+	case TenantActive:
+		q.Where("is_active = 1 AND is_deleted = 0")
+	case TenantSuspended:
+		q.Where("is_active = 0 AND is_deleted = 0")
+	case TenantDeleted:
+		q.Where("is_deleted = 1")
+	}
+	return pagination.Fetch(ctx, q, req, scanTenantSummary, func(t TenantSummary) int64 { return t.ID })
+}
+
+const tenantSummaryColumns = `id, name, subdomain, is_active, is_deleted, COALESCE(suspended_reason, ''), COALESCE(plan, ''),
+			created_at, deleted_at, purge_at`
+
+func scanTenantSummary(rows *sql.Rows) (TenantSummary, error) {
+	var t TenantSummary
+	var active, deleted bool
+	if err := rows.Scan(&t.ID, &t.Name, &t.Subdomain, &active, &deleted, &t.SuspendedReason, &t.Plan,
+		&t.CreatedAt, &t.DeletedAt, &t.PurgeAt); err != nil {
+		return t, err
+	}
+	t.State = tenantState(active, deleted)
+	return t, nil
+}
+
+// SuspendTenant takes an active tenant offline; its subdomain then serves the suspended page.
+func SuspendTenant(ctx context.Context, tenantID int64, reason string) error {
+	return transition(ctx, tenantID, TenantActive, TenantSuspended, reason,
+		`UPDATE tenants SET is_active = 0, suspended_reason = ?, updated_at = ? WHERE id = ? AND is_active = 1 AND is_deleted = 0`,
+		reason, time.Now(), tenantID)
+}
+
+// ReactivateTenant brings a suspended tenant back, or restores a deleted one that has not been purged yet.
+func ReactivateTenant(ctx context.Context, tenantID int64) error {
+	t, err := GetTenantSummary(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.State == TenantActive {
+		return ErrTenantState
+	}
+	return transition(ctx, tenantID, t.State, TenantActive, "",
+		`UPDATE tenants SET is_active = 1, is_deleted = 0, suspended_reason = NULL, deleted_at = NULL, purge_at = NULL, updated_at = ?
+		 WHERE id = ? AND (is_active = 0 OR is_deleted = 1)`,
+		time.Now(), tenantID)
+}
+
+// DeleteTenant soft-deletes a tenant. Its data stays until purgeAt so the deletion can be undone.
+func DeleteTenant(ctx context.Context, tenantID int64, purgeAt time.Time) error {
+	t, err := GetTenantSummary(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if t == nil || t.State == TenantDeleted {
+		return ErrTenantState
+	}
+	now := time.Now()
+	return transition(ctx, tenantID, t.State, TenantDeleted, "",
+		`UPDATE tenants SET is_deleted = 1, deleted_at = ?, purge_at = ?, updated_at = ? WHERE id = ? AND is_deleted = 0`,
+		now, purgeAt, now, tenantID)
+}
+
+// transition runs a state-changing update and notifies the hooks when it applied.
+func transition(ctx context.Context, tenantID int64, from, to, reason, query string, args ...any) error {
+	res, err := db.LogExec(ctx, db.DB, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTenantState
+	}
+	sub, _ := GetTenantSubdomain(ctx, tenantID)
+	notifyTransition(ctx, TenantTransition{TenantID: tenantID, Subdomain: sub, From: from, To: to, Reason: reason, At: time.Now()})
+	return nil
+}
+
+// TenantsDueForPurge returns deleted tenants whose purge date has passed, skipping tenants on legal hold.
+func TenantsDueForPurge(ctx context.Context) ([]TenantSummary, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT id, name, subdomain, created_at, deleted_at, purge_at
+		FROM tenants
+		WHERE is_deleted = 1 AND purge_at IS NOT NULL AND purge_at < ?
+		  AND id NOT IN (SELECT tenant_id FROM tenant_legal_holds)`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TenantSummary
+	for rows.Next() {
+		t := TenantSummary{State: TenantDeleted}
+		if err := rows.Scan(&t.ID, &t.Name, &t.Subdomain, &t.CreatedAt, &t.DeletedAt, &t.PurgeAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// TenantStorageKeys returns the stored files of a tenant (exports, reports, logo and avatars) to delete before a purge.
+func TenantStorageKeys(ctx context.Context, tenantID int64) ([]string, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `
+		SELECT storage_key FROM data_exports WHERE tenant_id = ? AND storage_key IS NOT NULL
+		UNION ALL
+		SELECT storage_key FROM report_jobs WHERE tenant_id = ? AND storage_key IS NOT NULL
+		UNION ALL
+		SELECT logo_key FROM tenants WHERE id = ? AND logo_key IS NOT NULL
+		UNION ALL
+		SELECT avatar_key FROM users WHERE tenant_id = ? AND avatar_key IS NOT NULL
+		UNION
+		SELECT key FROM stored_objects WHERE tenant_id = ?`, tenantID, tenantID, tenantID, tenantID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		out = append(out, key)
+	}
+	return out, rows.Err()
+}
+
+// tenantTables lists the tables holding tenant data, children before parents.
+var tenantTables = []string{
+	"sessions", "impersonation_handoffs", "password_resets", "ownership_transfers", "pending_user_signups", "signup_links", "memberships",
+	"data_exports", "report_jobs", "jobs", "api_key_usage", "api_keys", "audit_logs",
+	"tenant_geo_policies", "tenant_nav_settings", "tenant_custom_domains", "tenant_email_domains",
+	"tenant_meta_settings", "tenant_launch_settings", "tenant_membership_settings", "tenant_join_domains", "tenant_settings",
+	"tenant_feature_flags",
+	"group_members", "group_permissions", "groups", "support_refs", "stored_objects",
+	"usage_daily", "usage_active_users", "webhook_deliveries", "webhook_endpoints", "notifications", "users",
+	"tenant_data_keys",
+}
+
+// PurgeTenant permanently deletes a soft-deleted tenant and all of its rows.
+// It refuses while the tenant is on legal hold, when it was restored meanwhile, and with
+// ErrHasSubTenants while its sub-tenants are not purged.
+func PurgeTenant(ctx context.Context, tenantID int64) error {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return err
+	}
+	sub, err := GetTenantSubdomain(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	if err := tx.QueryRowContext(ctx, `SELECT is_deleted FROM tenants WHERE id = ?`, tenantID).Scan(&deleted); err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrTenantState
+	}
+	var children int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tenants WHERE parent_tenant_id = ?`, tenantID).Scan(&children); err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrHasSubTenants
+	}
+	for _, table := range tenantTables {
+		query := `DELETE FROM ` + table + ` WHERE tenant_id = ?`
+		if table == "api_key_usage" {
+			query = `DELETE FROM api_key_usage WHERE key_id IN (SELECT id FROM api_keys WHERE tenant_id = ?)`
+		}
+		if _, err := tx.ExecContext(ctx, query, tenantID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, tenantID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	notifyTransition(ctx, TenantTransition{TenantID: tenantID, Subdomain: sub, From: TenantDeleted, To: "purged", At: time.Now()})
+	return nil
+}
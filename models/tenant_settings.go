@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// MaxTenantSettingSize bounds the JSON stored for a single setting.
+const MaxTenantSettingSize = 64 << 10
+
+// ErrSettingTooLarge is returned when a value exceeds MaxTenantSettingSize once encoded.
+var ErrSettingTooLarge = errors.New("tenant setting too large")
+
+// GetTenantSettings returns every setting stored for the tenant, as JSON by key.
+func GetTenantSettings(ctx context.Context, tenantID int64) (map[string]json.RawMessage, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT key, value FROM tenant_settings WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]json.RawMessage{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		out[key] = json.RawMessage(value)
+	}
+	return out, rows.Err()
+}
+
+// SetTenantSetting stores value, encoded as JSON, under key. Cached tenants are invalidated.
+func SetTenantSetting(ctx context.Context, tenantID int64, key string, value any) error {
+	raw, ok := value.(json.RawMessage)
+	if !ok || !json.Valid(raw) {
+		var err error
+		if raw, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	if len(raw) > MaxTenantSettingSize {
+		return ErrSettingTooLarge
+	}
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO tenant_settings (tenant_id, key, value, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		tenantID, key, string(raw), time.Now())
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
+
+// DeleteTenantSetting removes a setting so that its default applies again.
+func DeleteTenantSetting(ctx context.Context, tenantID int64, key string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM tenant_settings WHERE tenant_id = ? AND key = ?`, tenantID, key)
+	if err == nil {
+		TenantChanged(tenantID)
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// CountTenantMembers returns the number of memberships of a tenant, pending and deactivated included.
+func CountTenantMembers(ctx context.Context, tenantID int64) (int64, error) {
+	var n int64
+	err := db.LogQueryRow(ctx, db.DB, `SELECT COUNT(*) FROM memberships WHERE tenant_id = ?`, tenantID).Scan(&n)
+	return n, err
+}
+
+// RecordStoredObject remembers the size of a tenant file, replacing the previous size of the key.
+func RecordStoredObject(ctx context.Context, tenantID int64, key string, size int64) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO stored_objects (key, tenant_id, size) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET size = excluded.size, created_at = CURRENT_TIMESTAMP`,
+		key, tenantID, size)
+	return err
+}
+
+// ForgetStoredObject drops a deleted file from the storage accounting.
+func ForgetStoredObject(ctx context.Context, key string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM stored_objects WHERE key = ?`, key)
+	return err
+}
+
+// TenantStorageBytes returns the total size of the files stored for a tenant.
+func TenantStorageBytes(ctx context.Context, tenantID int64) (int64, error) {
+	var n int64
+	err := db.LogQueryRow(ctx, db.DB,
+		`SELECT COALESCE(SUM(size), 0) FROM stored_objects WHERE tenant_id = ?`, tenantID).Scan(&n)
+	return n, err
+}
+
+// UsageRecord is the value of a meter for a tenant on a day.
+type UsageRecord struct {
+	TenantID  int64
+	Subdomain string // Filled by ListUsage
+	Day       string // UTC date, YYYY-MM-DD
+	Meter     string
+	Value     int64
+}
+
+// ActiveUser is a user seen on a tenant on a day.
+type ActiveUser struct {
+	TenantID int64
+	Day      string
+	UserID   int64
+}
+
+// UsageFilter selects the usage returned by ListUsage. Empty fields match everything.
+type UsageFilter struct {
+	From     string // First day, inclusive
+	To       string // Last day, inclusive
+	TenantID int64
+	Meter    string
+}
+
+// AddUsage adds counter increments to the daily usage in one transaction.
+func AddUsage(ctx context.Context, records []UsageRecord) error {
+	return writeUsage(ctx, records, `
+		INSERT INTO usage_daily (tenant_id, day, meter, value) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, day, meter) DO UPDATE SET value = value + excluded.value, updated_at = CURRENT_TIMESTAMP`)
+}
+
+// SetUsage overwrites daily values, for meters measuring a level rather than counting events.
+func SetUsage(ctx context.Context, records []UsageRecord) error {
+	return writeUsage(ctx, records, `
+		INSERT INTO usage_daily (tenant_id, day, meter, value) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, day, meter) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`)
+}
+
+func writeUsage(ctx context.Context, records []UsageRecord, query string) error {
+	if len(records) == 0 {
+		return nil
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range records {
+		if _, err := tx.ExecContext(ctx, query, u.TenantID, u.Day, u.Meter, u.Value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordActiveUsers remembers which users were seen on which tenant and day; duplicates are ignored.
+func RecordActiveUsers(ctx context.Context, users []ActiveUser) error {
+	if len(users) == 0 {
+		return nil
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range users {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT OR IGNORE INTO usage_active_users (tenant_id, day, user_id) VALUES (?, ?, ?)`,
+			u.TenantID, u.Day, u.UserID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountActiveUsers stores the number of distinct users seen on each tenant during a day under meter.
+func CountActiveUsers(ctx context.Context, day, meter string) error {
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO usage_daily (tenant_id, day, meter, value)
+		SELECT tenant_id, day, ?, COUNT(*) FROM usage_active_users WHERE day = ? GROUP BY tenant_id
+		ON CONFLICT(tenant_id, day, meter) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		meter, day)
+	return err
+}
+
+// PruneActiveUsers drops the active users recorded before a day, once they have been counted.
+func PruneActiveUsers(ctx context.Context, before string) error {
+	_, err := db.LogExec(ctx, db.DB, `DELETE FROM usage_active_users WHERE day < ?`, before)
+	return err
+}
+
+// SnapshotStorageUsage stores the bytes currently stored by each tenant as the day's value of meter.
+func SnapshotStorageUsage(ctx context.Context, day, meter string) error {
+	// "WHERE true" lets SQLite tell the upsert clause from a join constraint
+	_, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO usage_daily (tenant_id, day, meter, value)
+		SELECT tenant_id, ?, ?, SUM(size) FROM stored_objects WHERE true GROUP BY tenant_id
+		ON CONFLICT(tenant_id, day, meter) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		day, meter)
+	return err
+}
+
+// ListUsage returns the daily usage matching the filter, by tenant, day and meter.
+func ListUsage(ctx context.Context, f UsageFilter) ([]UsageRecord, error) {
+	query := `
+		SELECT u.tenant_id, COALESCE(t.subdomain, ''), u.day, u.meter, u.value
+		FROM usage_daily u
+		LEFT JOIN tenants t ON t.id = u.tenant_id
+		WHERE 1 = 1`
+	var args []any
+	if f.From != "" {
+		query += ` AND u.day >= ?`
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		query += ` AND u.day <= ?`
+		args = append(args, f.To)
+	}
+	if f.TenantID != 0 {
+		query += ` AND u.tenant_id = ?`
+		args = append(args, f.TenantID)
+	}
+	if f.Meter != "" {
+		query += ` AND u.meter = ?`
+		args = append(args, f.Meter)
+	}
+	query += ` ORDER BY t.subdomain, u.day, u.meter`
+
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UsageRecord
+	for rows.Next() {
+		var u UsageRecord
+		if err := rows.Scan(&u.TenantID, &u.Subdomain, &u.Day, &u.Meter, &u.Value); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
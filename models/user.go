@@ -5,24 +5,42 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
-	"log"
+	"errors"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/pandamasta/tenkit/db"
 )
 
+// ErrUserExists is returned by CreateUser when the email already belongs to an account of the
+// tenant. Accounts belong to one tenant, so the same address may have one on several tenants, each
+// with its own password, role and sessions.
+var ErrUserExists = errors.New("email already belongs to an account")
+
 type User struct {
 	ID           int64
 	Email        string
 	PasswordHash string
 	TenantID     int64
+	Role         string
+	Lang         string // Preferred language, "" to negotiate it from the browser
+	Name         string // Display name, see DisplayName
+	Timezone     string // IANA time zone dates are shown in, "" for the tenant's
+	AvatarKey    string // Storage key of the uploaded avatar, served at AvatarURL
+	// Set by GetSession for impersonation sessions opened by a platform operator
+	ImpersonatorID    int64
+	ImpersonatorEmail string
+	SessionExpires    time.Time
 }
 
+// GetUserByEmail returns the oldest verified account of email on any tenant, or nil. The address
+// may have accounts on several tenants: use GetUserByEmailAndTenant to find that of a tenant.
 func GetUserByEmail(email string) (*User, error) {
 	row := db.LogQueryRow(context.Background(), db.DB,
-		`SELECT id, email, password_hash, tenant_id FROM users WHERE email = ? AND is_verified = 1`, email)
+		`SELECT id, email, password_hash, tenant_id, COALESCE(role, 'member') FROM users WHERE email = ? AND is_verified = 1 ORDER BY id LIMIT 1`, email)
 	var u User
-	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID); err != nil {
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID, &u.Role); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -33,11 +51,11 @@ func GetUserByEmail(email string) (*User, error) {
 
 func GetUserByEmailAndTenant(email string, tenantID int64) (*User, error) {
 	row := db.LogQueryRow(context.Background(), db.DB,
-		`SELECT id, email, password_hash, tenant_id FROM users 
+		`SELECT id, email, password_hash, tenant_id, COALESCE(role, 'member') FROM users 
 		 WHERE email = ? AND tenant_id = ? AND is_verified = 1`,
 		email, tenantID)
 	var u User
-	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID); err != nil {
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID, &u.Role); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -46,6 +64,61 @@ func GetUserByEmailAndTenant(email string, tenantID int64) (*User, error) {
 	return &u, nil
 }
 
+// CreateUser creates a verified user of a tenant with an active membership, e.g. for operators adding
+// accounts by hand, and returns its ID.
+func CreateUser(ctx context.Context, tenantID int64, email, passwordHash, role string) (int64, error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER(?) AND tenant_id = ?`, email, tenantID).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		return 0, ErrUserExists
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO users (email, password_hash, is_verified, tenant_id, role)
+		VALUES (?, ?, 1, ?, ?)`, email, passwordHash, tenantID, role)
+	if err != nil {
+		return 0, err
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO memberships (user_id, tenant_id, role, is_active) VALUES (?, ?, ?, 1)`,
+		userID, tenantID, role); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// SetUserPassword replaces the password hash of a user and ends their sessions, so that the old
+// password stops working everywhere at once.
+func SetUserPassword(ctx context.Context, userID int64, passwordHash string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET password_hash = ? WHERE id = ?`, passwordHash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	UserChanged(userID)
+	return nil
+}
+
 func CreateSession(userID, tenantID int64) string {
 	b := make([]byte, 16)
 	rand.Read(b)
@@ -54,21 +127,110 @@ func CreateSession(userID, tenantID int64) string {
 	_, err := db.DB.Exec(`INSERT INTO sessions (token, user_id, tenant_id, expires_at)
         VALUES (?, ?, ?, ?)`, token, userID, tenantID, time.Now().Add(24*time.Hour))
 	if err != nil {
-		log.Printf("[SESSION] Error creating session: %v", err)
+		slog.Error("[SESSION] Error creating session", "user_id", userID, "error", err)
 	}
 	return token
 }
 
 func GetSession(token string) (*User, error) {
 	row := db.LogQueryRow(context.Background(), db.DB,
-		`SELECT u.id, u.email, u.password_hash, u.tenant_id
+		`SELECT u.id, u.email, u.password_hash, u.tenant_id, COALESCE(u.role, 'member'), COALESCE(u.lang, ''),
+                COALESCE(u.name, ''), COALESCE(u.timezone, ''), COALESCE(u.avatar_key, ''),
+                COALESCE(s.impersonator_id, 0), COALESCE(s.impersonator_email, ''), s.expires_at
          FROM sessions s
          JOIN users u ON u.id = s.user_id
          WHERE s.token = ? AND s.expires_at > ?`,
 		token, time.Now())
 	var u User
-	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID); err != nil {
+	if err := row.Scan(&u.ID, &u.Email, &u.PasswordHash, &u.TenantID, &u.Role, &u.Lang,
+		&u.Name, &u.Timezone, &u.AvatarKey, &u.ImpersonatorID, &u.ImpersonatorEmail, &u.SessionExpires); err != nil {
 		return nil, err
 	}
 	return &u, nil
 }
+
+var (
+	userHooksMu    sync.RWMutex
+	userHooks      []func(userID int64)
+	sessionEndHook []func(token string)
+)
+
+// OnUserChange registers fn to run after a user is updated or loses sessions, e.g. to drop cached
+// sessions.
+func OnUserChange(fn func(userID int64)) {
+	userHooksMu.Lock()
+	defer userHooksMu.Unlock()
+	userHooks = append(userHooks, fn)
+}
+
+// UserChanged runs the OnUserChange hooks. Code updating the users table or deleting sessions must
+// call it.
+func UserChanged(userID int64) {
+	userHooksMu.RLock()
+	defer userHooksMu.RUnlock()
+	for _, fn := range userHooks {
+		fn(userID)
+	}
+}
+
+// OnSessionEnd registers fn to run after a single session is deleted.
+func OnSessionEnd(fn func(token string)) {
+	userHooksMu.Lock()
+	defer userHooksMu.Unlock()
+	sessionEndHook = append(sessionEndHook, fn)
+}
+
+func sessionEnded(token string) {
+	userHooksMu.RLock()
+	defer userHooksMu.RUnlock()
+	for _, fn := range sessionEndHook {
+		fn(token)
+	}
+}
+
+// PurgeExpiredSessions deletes the sessions past their expiry and returns how many were removed.
+func PurgeExpiredSessions(ctx context.Context) (int64, error) {
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM sessions WHERE expires_at <= ?`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteTenantSessions signs every user of a tenant out and returns how many sessions were removed.
+func DeleteTenantSessions(ctx context.Context, tenantID int64) (int64, error) {
+	rows, err := db.LogQuery(ctx, db.DB, `SELECT DISTINCT user_id FROM sessions WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	var users []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	res, err := db.LogExec(ctx, db.DB, `DELETE FROM sessions WHERE tenant_id = ?`, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range users {
+		UserChanged(id)
+	}
+	return res.RowsAffected()
+}
+
+// SetUserLang stores the preferred language of a user, used on every device they sign in from.
+func SetUserLang(ctx context.Context, userID int64, lang string) error {
+	_, err := db.LogExec(ctx, db.DB, `UPDATE users SET lang = ? WHERE id = ?`, lang, userID)
+	if err == nil {
+		UserChanged(userID)
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Webhook delivery states stored in webhook_deliveries.status.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed" // Given up after the last retry
+)
+
+// WebhookSecretPrefix starts every endpoint signing secret.
+const WebhookSecretPrefix = "whsec_"
+
+// WebhookEndpoint is a URL receiving the events of a tenant, or of every tenant when TenantID is 0.
+type WebhookEndpoint struct {
+	ID        int64
+	TenantID  int64 // 0 for a platform endpoint
+	URL       string
+	Secret    string
+	Events    []string // Subscribed events; empty for all
+	Active    bool
+	CreatedBy int64
+	CreatedAt time.Time
+}
+
+// Subscribed reports whether the endpoint wants an event.
+func (e WebhookEndpoint) Subscribed(event string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, event)
+}
+
+// WebhookDelivery is one event queued for one endpoint, with the outcome of its last attempt.
+type WebhookDelivery struct {
+	ID            int64
+	EndpointID    int64
+	TenantID      int64
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	ResponseCode  int
+	LastError     string
+	CreatedAt     time.Time
+	DeliveredAt   sql.NullTime
+	URL           string // Endpoint URL, filled by ClaimDueWebhookDeliveries
+	Secret        string // Endpoint secret, filled by ClaimDueWebhookDeliveries
+}
+
+// CreateWebhookEndpoint registers an endpoint with a new signing secret and returns it with its ID.
+func CreateWebhookEndpoint(ctx context.Context, e WebhookEndpoint) (*WebhookEndpoint, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	e.Secret = WebhookSecretPrefix + hex.EncodeToString(b)
+	e.Active = true
+	res, err := db.LogExec(ctx, db.DB, `
+		INSERT INTO webhook_endpoints (tenant_id, url, secret, events, is_active, created_by)
+		VALUES (?, ?, ?, ?, 1, ?)`,
+		nullInt(e.TenantID), e.URL, e.Secret, strings.Join(e.Events, ","), nullInt(e.CreatedBy))
+	if err != nil {
+		return nil, err
+	}
+	if e.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetWebhookEndpoint returns an endpoint of the tenant (0 for the platform), or nil.
+func GetWebhookEndpoint(ctx context.Context, tenantID, id int64) (*WebhookEndpoint, error) {
+	endpoints, err := queryWebhookEndpoints(ctx, `
+		SELECT id, COALESCE(tenant_id, 0), url, secret, events, is_active, COALESCE(created_by, 0), created_at
+		FROM webhook_endpoints WHERE id = ? AND COALESCE(tenant_id, 0) = ?`, id, tenantID)
+	if err != nil || len(endpoints) == 0 {
+		return nil, err
+	}
+	return &endpoints[0], nil
+}
+
+// ListWebhookEndpoints returns the endpoints of the tenant (0 for the platform), oldest first.
+func ListWebhookEndpoints(ctx context.Context, tenantID int64) ([]WebhookEndpoint, error) {
+	return queryWebhookEndpoints(ctx, `
+		SELECT id, COALESCE(tenant_id, 0), url, secret, events, is_active, COALESCE(created_by, 0), created_at
+		FROM webhook_endpoints WHERE COALESCE(tenant_id, 0) = ? ORDER BY id`, tenantID)
+}
+
+// WebhookEndpointsFor returns the active endpoints subscribed to an event of the tenant: its own
+// and the platform ones.
+func WebhookEndpointsFor(ctx context.Context, tenantID int64, event string) ([]WebhookEndpoint, error) {
+	all, err := queryWebhookEndpoints(ctx, `
+		SELECT id, COALESCE(tenant_id, 0), url, secret, events, is_active, COALESCE(created_by, 0), created_at
+		FROM webhook_endpoints WHERE is_active = 1 AND (tenant_id IS NULL OR tenant_id = ?) ORDER BY id`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	out := all[:0]
+	for _, e := range all {
+		if e.Subscribed(event) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func queryWebhookEndpoints(ctx context.Context, query string, args ...any) ([]WebhookEndpoint, error) {
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookEndpoint
+	for rows.Next() {
+		var e WebhookEndpoint
+		var events string
+		if err := rows.Scan(&e.ID, &e.TenantID, &e.URL, &e.Secret, &events, &e.Active, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if events != "" {
+			e.Events = strings.Split(events, ",")
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// SetWebhookEndpointActive pauses or resumes an endpoint. It reports whether the endpoint was found.
+func SetWebhookEndpointActive(ctx context.Context, tenantID, id int64, active bool) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB,
+		`UPDATE webhook_endpoints SET is_active = ? WHERE id = ? AND COALESCE(tenant_id, 0) = ?`, active, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteWebhookEndpoint removes an endpoint and its delivery log. It reports whether the endpoint was found,
+// and returns ErrLegalHold while the tenant is held.
+func DeleteWebhookEndpoint(ctx context.Context, tenantID, id int64) (bool, error) {
+	if err := CheckLegalHold(ctx, tenantID); err != nil {
+		return false, err
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = ? AND COALESCE(tenant_id, 0) = ?`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE endpoint_id = ?`, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// EnqueueWebhookDeliveries queues deliveries, due at once, in one transaction.
+func EnqueueWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (endpoint_id, tenant_id, event, payload, status, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			d.EndpointID, nullInt(d.TenantID), d.Event, d.Payload, WebhookPending, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimDueWebhookDeliveries returns up to limit pending deliveries whose attempt is due, with their
+// endpoint. Each is pushed back by lease first, so that other instances skip it while it is attempted.
+func ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	now := time.Now()
+	due, err := queryWebhookDeliveries(ctx, `
+		SELECT d.id, d.endpoint_id, COALESCE(d.tenant_id, 0), d.event, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.response_code, d.last_error, d.created_at, d.delivered_at, e.url, e.secret
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND e.is_active = 1
+		ORDER BY d.next_attempt_at LIMIT ?`, WebhookPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	claimed := due[:0]
+	for _, d := range due {
+		res, err := db.LogExec(ctx, db.DB, `
+			UPDATE webhook_deliveries SET next_attempt_at = ?
+			WHERE id = ? AND status = ? AND next_attempt_at <= ?`,
+			now.Add(lease), d.ID, WebhookPending, now)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt. A pending delivery is retried at next;
+// the others are final.
+func RecordWebhookAttempt(ctx context.Context, id int64, status string, code int, errMsg string, next time.Time) error {
+	var deliveredAt sql.NullTime
+	if status == WebhookDelivered {
+		deliveredAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	_, err := db.LogExec(ctx, db.DB, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, response_code = ?, last_error = ?, next_attempt_at = ?, delivered_at = ?
+		WHERE id = ?`, status, code, errMsg, next, deliveredAt, id)
+	return err
+}
+
+// ListWebhookDeliveries returns the latest deliveries of an endpoint of the tenant (0 for the platform).
+func ListWebhookDeliveries(ctx context.Context, tenantID, endpointID int64, limit int) ([]WebhookDelivery, error) {
+	return queryWebhookDeliveries(ctx, `
+		SELECT d.id, d.endpoint_id, COALESCE(d.tenant_id, 0), d.event, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.response_code, d.last_error, d.created_at, d.delivered_at, e.url, ''
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id
+		WHERE d.endpoint_id = ? AND COALESCE(e.tenant_id, 0) = ?
+		ORDER BY d.id DESC LIMIT ?`, endpointID, tenantID, limit)
+}
+
+// RetryWebhookDelivery queues a delivery of an endpoint of the tenant again, whatever its state.
+// It reports whether the delivery was found.
+func RetryWebhookDelivery(ctx context.Context, tenantID, id int64) (bool, error) {
+	res, err := db.LogExec(ctx, db.DB, `
+		UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?
+		WHERE id = ? AND endpoint_id IN (SELECT id FROM webhook_endpoints WHERE COALESCE(tenant_id, 0) = ?)`,
+		WebhookPending, time.Now(), id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func queryWebhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.TenantID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.ResponseCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
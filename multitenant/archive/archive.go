@@ -0,0 +1,89 @@
+// Package archive exports a whole tenant to a portable zip archive and imports it back as a new
+// tenant, for moving tenants between environments and for handing their data to tenants leaving
+// the platform. An archive holds the tenant row, its users, memberships, groups and settings, the
+// rows of the tables applications register, and the stored files of the tenant (logo, avatars and
+// other files under its storage prefix):
+//
+//	manifest.json        Format, version, source tenant and contents
+//	tables/<table>.json  Rows of a table as JSON objects
+//	files/<key>          Stored files, by storage key
+//
+// Import renumbers the rows, rewrites the references between them and moves the files under the
+// prefix of the new tenant, so an archive can also be imported next to the tenant it came from
+// under another subdomain. Encrypted columns (see the crypto package) are archived decrypted and
+// encrypted again with the data key of the new tenant. Sessions, tokens, audit logs, exports and
+// usage stay behind, and a custom domain is claimed again on the new tenant.
+//
+//	archive.Register(archive.Table{Name: "invoices", ID: "id", Refs: map[string]string{"customer_id": "users"}})
+package archive
+
+import (
+	"sync"
+)
+
+// Archive format of the manifest; Version is bumped on incompatible changes.
+const (
+	Format  = "tenkit-tenant"
+	Version = 1
+)
+
+// Table is a table of tenant rows carried by archives. It must have a tenant_id column.
+type Table struct {
+	Name string // Table name, e.g. "invoices"
+	// ID is the auto-increment key renumbered on import, "" for tables keyed by other columns
+	ID string
+	// Refs maps the columns holding IDs of archived rows to their table, e.g. {"user_id": "users"}.
+	// References to rows missing from the archive become NULL.
+	Refs map[string]string
+	// Keys are the columns holding storage keys of files under the tenant prefix
+	Keys []string
+	// Secrets are the columns left empty in archives exported WithoutCredentials
+	Secrets []string
+}
+
+// builtin are the tables of tenkit, in an order where every table comes after those it refers to.
+var builtin = []Table{
+	{Name: "users", ID: "id", Keys: []string{"avatar_key"}, Secrets: []string{"password_hash"}},
+	{Name: "memberships", ID: "id", Refs: map[string]string{"user_id": "users"}},
+	{Name: "groups", ID: "id", Refs: map[string]string{"created_by": "users"}},
+	{Name: "group_members", Refs: map[string]string{"group_id": "groups", "user_id": "users"}},
+	{Name: "group_permissions", Refs: map[string]string{"group_id": "groups", "granted_by": "users"}},
+	{Name: "tenant_settings"},
+	{Name: "tenant_feature_flags", Refs: map[string]string{"updated_by": "users"}},
+	{Name: "tenant_nav_settings"},
+	{Name: "tenant_meta_settings"},
+	{Name: "tenant_launch_settings"},
+	{Name: "tenant_membership_settings"},
+	{Name: "tenant_join_domains", ID: "id"},
+	{Name: "tenant_geo_policies"},
+	{Name: "tenant_email_domains", Secrets: []string{"private_key"}},
+}
+
+// tenantTable describes the tenant row itself, keyed by id instead of tenant_id.
+var tenantTable = Table{Name: "tenants", ID: "id", Keys: []string{"logo_key"}}
+
+var (
+	mu     sync.RWMutex
+	tables []Table
+)
+
+// Register adds an application table to the archives, imported after the built-in tables and the
+// tables registered before it. Registering a name again replaces its declaration.
+func Register(t Table) {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, existing := range tables {
+		if existing.Name == t.Name {
+			tables[i] = t
+			return
+		}
+	}
+	tables = append(tables, t)
+}
+
+// Tables returns the archived tables in import order: the built-in ones, then the registered ones.
+func Tables() []Table {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append(append([]Table{}, builtin...), tables...)
+}
@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	TenantID   int64          `json:"tenant_id"` // ID on the source platform, the prefix of the archived storage keys
+	Subdomain  string         `json:"subdomain"`
+	Name       string         `json:"name"`
+	Tables     map[string]int `json:"tables"` // Rows by table, the tenant row included
+	Files      []string       `json:"files"`  // Storage keys of the archived files
+	// WithoutCredentials is set when password hashes and private keys were left out
+	WithoutCredentials bool `json:"without_credentials,omitempty"`
+}
+
+// ExportOptions tune Export.
+type ExportOptions struct {
+	Store storage.Store // Store of the tenant files; nil leaves the files out
+	// WithoutCredentials empties the password hashes and private keys, e.g. for the archive handed
+	// to an offboarded tenant. Members of a tenant imported from it set their password with /forgot.
+	WithoutCredentials bool
+}
+
+// ErrNoTenant is returned by Export for a tenant that does not exist.
+var ErrNoTenant = errors.New("archive: tenant not found")
+
+// Export writes the archive of a tenant, in any state, to w and returns its manifest.
+func Export(ctx context.Context, tenantID int64, w io.Writer, opts ExportOptions) (*Manifest, error) {
+	tenant, err := models.TenantRows(ctx, tenantTable.Name, "id", tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenant) != 1 {
+		return nil, ErrNoTenant
+	}
+	m := &Manifest{
+		Format:             Format,
+		Version:            Version,
+		ExportedAt:         time.Now().UTC(),
+		TenantID:           tenantID,
+		Tables:             map[string]int{},
+		WithoutCredentials: opts.WithoutCredentials,
+	}
+	m.Subdomain, _ = tenant[0]["subdomain"].(string)
+	m.Name, _ = tenant[0]["name"].(string)
+
+	zw := zip.NewWriter(w)
+	writeJSON := func(name string, v any) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	// Step 1: The tenant row and the rows of every archived table
+	if err := writeJSON("tables/"+tenantTable.Name+".json", tenant); err != nil {
+		return nil, err
+	}
+	m.Tables[tenantTable.Name] = 1
+	for _, t := range Tables() {
+		rows, err := models.TenantRows(ctx, t.Name, "tenant_id", tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("archive: table %s: %w", t.Name, err)
+		}
+		if err := decryptColumns(ctx, tenantID, t.Name, rows); err != nil {
+			return nil, err
+		}
+		if opts.WithoutCredentials {
+			for _, row := range rows {
+				for _, c := range t.Secrets {
+					if _, ok := row[c]; ok {
+						row[c] = ""
+					}
+				}
+			}
+		}
+		if rows == nil {
+			rows = []map[string]any{}
+		}
+		if err := writeJSON("tables/"+t.Name+".json", rows); err != nil {
+			return nil, err
+		}
+		m.Tables[t.Name] = len(rows)
+	}
+
+	// Step 2: The files under the tenant prefix; exports and reports are left out
+	if opts.Store != nil {
+		keys, err := models.TenantStorageKeys(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		prefix := storage.TenantPrefix(tenantID)
+		seen := map[string]bool{}
+		for _, key := range keys {
+			if !strings.HasPrefix(key, prefix) || seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := copyFile(ctx, opts.Store, zw, key); errors.Is(err, storage.ErrNotFound) {
+				slog.WarnContext(ctx, "[ARCHIVE] Stored file missing, left out", "tenant_id", tenantID, "key", key)
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("archive: file %s: %w", key, err)
+			}
+			m.Files = append(m.Files, key)
+		}
+	}
+
+	// Step 3: The manifest, listing what was written
+	if err := writeJSON("manifest.json", m); err != nil {
+		return nil, err
+	}
+	return m, zw.Close()
+}
+
+// decryptColumns replaces the encrypted values of table in rows by their plaintext, as data keys stay
+// with the platform; Import encrypts them again for the new tenant.
+func decryptColumns(ctx context.Context, tenantID int64, table string, rows []map[string]any) error {
+	for _, c := range crypto.Columns() {
+		if c.Table != table {
+			continue
+		}
+		for _, row := range rows {
+			v, ok := row[c.Column].(string)
+			if !ok || !crypto.IsEncrypted(v) {
+				continue
+			}
+			plaintext, err := c.Decrypt(ctx, tenantID, v)
+			if err != nil {
+				return fmt.Errorf("archive: %s: %w", c.Field(), err)
+			}
+			row[c.Column] = plaintext
+		}
+	}
+	return nil
+}
+
+// copyFile adds the stored file key to the archive.
+func copyFile(ctx context.Context, store storage.Store, zw *zip.Writer, key string) error {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	f, err := zw.Create("files/" + key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return err
+}
@@ -0,0 +1,267 @@
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+)
+
+// ErrInvalidArchive is returned by Import for a file that is not a tenant archive of a supported version.
+var ErrInvalidArchive = errors.New("archive: not a tenant archive")
+
+// ImportOptions tune Import.
+type ImportOptions struct {
+	Config *multitenant.Config // Validates the subdomain of the new tenant
+	// Subdomain, Name and Email replace those of the archived tenant, e.g. to import it next to
+	// the tenant it came from. The archived ones are kept when empty.
+	Subdomain string
+	Name      string
+	Email     string
+	Store     storage.Store // Store receiving the tenant files; nil leaves the files out
+}
+
+// Import creates a new active tenant from the archive read from r, of size bytes, and returns its
+// ID. It returns ErrInvalidArchive, multitenant.ErrInvalidSubdomain or multitenant.ErrTenantExists
+// for archives that cannot be imported, and creates nothing then. The files are stored after the
+// tenant is created: an error storing them is returned with the ID of the tenant.
+func Import(ctx context.Context, r io.ReaderAt, size int64, opts ImportOptions) (int64, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	entries := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	// Step 1: Check the manifest and read the tenant row
+	var m Manifest
+	if err := readJSON(entries["manifest.json"], &m); err != nil || m.Format != Format {
+		return 0, ErrInvalidArchive
+	}
+	if m.Version > Version {
+		return 0, fmt.Errorf("%w: version %d is newer than %d", ErrInvalidArchive, m.Version, Version)
+	}
+	var tenant []map[string]any
+	if err := readJSON(entries["tables/"+tenantTable.Name+".json"], &tenant); err != nil || len(tenant) != 1 {
+		return 0, ErrInvalidArchive
+	}
+	row := tenant[0]
+	for k, v := range map[string]string{"subdomain": opts.Subdomain, "name": opts.Name, "email": opts.Email} {
+		if v = strings.TrimSpace(v); v != "" {
+			row[k] = v
+		}
+	}
+	sub, _ := row["subdomain"].(string)
+	name, _ := row["name"].(string)
+	email, _ := row["email"].(string)
+	sub = strings.ToLower(sub)
+	if opts.Config == nil || !opts.Config.Server.ValidSubdomain(sub) {
+		return 0, multitenant.ErrInvalidSubdomain
+	}
+	if name == "" || email == "" {
+		return 0, ErrInvalidArchive
+	}
+	// The new tenant is a live top-level tenant; its custom domain is claimed again
+	row["subdomain"], row["slug"] = sub, sub
+	row["is_active"], row["is_deleted"] = true, false
+	for _, c := range []string{"parent_tenant_id", "custom_domain", "deleted_at", "purge_at", "suspended_reason"} {
+		row[c] = nil
+	}
+
+	// Step 2: Read the rows of every table before writing anything
+	rows := map[string][]map[string]any{}
+	for _, t := range Tables() {
+		f := entries["tables/"+t.Name+".json"]
+		if f == nil {
+			continue // Registered after the export, or by another application
+		}
+		var tr []map[string]any
+		if err := readJSON(f, &tr); err != nil {
+			return 0, fmt.Errorf("%w: table %s: %v", ErrInvalidArchive, t.Name, err)
+		}
+		rows[t.Name] = tr
+	}
+
+	// Step 3: Insert the tenant and its rows, renumbered, in one transaction
+	oldPrefix := storage.TenantPrefix(m.TenantID)
+	var id int64
+	err = models.ProvisionTx(ctx, func(tx *sql.Tx) error {
+		if err := models.TenantConflict(ctx, tx, name, sub, email); err != nil {
+			return err
+		}
+		var err error
+		if id, err = insert(ctx, tx, tenantTable, clone(row), nil, oldPrefix, 0); err != nil {
+			return fmt.Errorf("archive: table %s: %w", tenantTable.Name, err)
+		}
+		ids := map[string]map[int64]int64{}
+		for _, t := range Tables() {
+			if rows[t.Name] == nil {
+				continue
+			}
+			if t.ID != "" {
+				ids[t.Name] = map[int64]int64{}
+			}
+			for _, src := range rows[t.Name] {
+				r := clone(src)
+				r["tenant_id"] = id
+				oldID, _ := r[t.ID].(int64)
+				newID, err := insert(ctx, tx, t, r, ids, oldPrefix, id)
+				if err != nil {
+					return fmt.Errorf("archive: table %s: %w", t.Name, err)
+				}
+				if t.ID != "" {
+					ids[t.Name][oldID] = newID
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := crypto.EncryptColumns(ctx, id, false); err != nil {
+		return id, fmt.Errorf("archive: %w", err)
+	}
+	slog.InfoContext(ctx, "[ARCHIVE] Tenant imported", "tenant_id", id, "subdomain", sub, "source_tenant_id", m.TenantID)
+
+	events.Publish(ctx, events.Event{
+		Name:     events.TenantCreated,
+		TenantID: id,
+		Data:     map[string]any{"subdomain": sub, "name": name, "owner_email": email, "imported_from": m.Subdomain},
+	})
+
+	// Step 4: Store the files under the prefix of the new tenant
+	if opts.Store == nil {
+		return id, nil
+	}
+	for _, key := range m.Files {
+		rest, ok := strings.CutPrefix(key, oldPrefix)
+		f := entries["files/"+key]
+		if !ok || f == nil {
+			continue
+		}
+		if err := putFile(ctx, opts.Store, f, storage.TenantKey(id, rest)); err != nil {
+			return id, fmt.Errorf("archive: file %s: %w", key, err)
+		}
+	}
+	return id, nil
+}
+
+// insert writes an archived row of t within tx: the ID is left to the database, references are
+// mapped through ids and storage keys moved to the prefix of newTenant. It returns the new ID.
+func insert(ctx context.Context, tx *sql.Tx, t Table, row map[string]any, ids map[string]map[int64]int64, oldPrefix string, newTenant int64) (int64, error) {
+	if t.ID != "" {
+		delete(row, t.ID)
+	}
+	for col, table := range t.Refs {
+		old, ok := row[col].(int64)
+		if !ok {
+			continue
+		}
+		if id, ok := ids[table][old]; ok {
+			row[col] = id
+		} else {
+			row[col] = nil
+		}
+	}
+	// Keys of the tenant row are set once its ID is known; keys outside the prefix are dropped
+	pending := map[string]string{}
+	for _, col := range t.Keys {
+		rest, ok := strings.CutPrefix(stringValue(row, col), oldPrefix)
+		switch {
+		case ok && newTenant != 0:
+			row[col] = storage.TenantKey(newTenant, rest)
+		case ok:
+			pending[col] = rest
+			row[col] = nil
+		default:
+			row[col] = nil
+		}
+	}
+	cols, err := models.TableColumns(ctx, tx, t.Name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := models.InsertRow(ctx, tx, t.Name, cols, row)
+	if err != nil {
+		return 0, err
+	}
+	for col, rest := range pending {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+t.Name+` SET `+col+` = ? WHERE id = ?`, storage.TenantKey(id, rest), id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// clone copies an archived row, which insert rewrites, so that a retried transaction starts over
+// from the archive.
+func clone(row map[string]any) map[string]any {
+	out := make(map[string]any, len(row))
+	for k, v := range row {
+		out[k] = v
+	}
+	return out
+}
+
+// stringValue returns the text value of col in row, "" when it is not text.
+func stringValue(row map[string]any, col string) string {
+	s, _ := row[col].(string)
+	return s
+}
+
+// readJSON decodes an archive entry into v, with the numbers of rows as int64 or float64.
+func readJSON(f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("missing entry")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dec := json.NewDecoder(rc)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if rows, ok := v.(*[]map[string]any); ok {
+		for _, row := range *rows {
+			for k, val := range row {
+				if n, ok := val.(json.Number); ok {
+					if i, err := n.Int64(); err == nil {
+						row[k] = i
+					} else if fl, err := n.Float64(); err == nil {
+						row[k] = fl
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// putFile stores an archived file under key, typed by its extension.
+func putFile(ctx context.Context, store storage.Store, f *zip.File, key string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return store.Put(ctx, key, rc, mime.TypeByExtension(path.Ext(key)))
+}
@@ -0,0 +1,173 @@
+// Package assets serves static files (stylesheets, scripts, images) from an fs.FS, e.g. an embed.FS,
+// under content-hashed names such as app.3f2a1b9c.css that browsers cache for good. Compressible
+// files are served gzipped, and precompressed .br or .gz siblings shipped in the FS are preferred.
+//
+//	static, err := assets.New(staticFS, "/static/")
+//	render.Assets = static // {{ asset "app.css" }} links the hashed name
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// compressible are the extensions gzipped at startup when the FS has no .gz sibling.
+var compressible = map[string]bool{
+	".css": true, ".js": true, ".mjs": true, ".json": true, ".map": true, ".svg": true,
+	".html": true, ".txt": true, ".xml": true, ".webmanifest": true,
+}
+
+// asset is a file loaded in memory with its variants.
+type asset struct {
+	name   string // Path in the FS, e.g. "css/app.css"
+	hash   string // Short content hash
+	body   []byte
+	gzip   []byte // nil when not worth compressing
+	brotli []byte // Only from a precompressed .br sibling; the standard library has no encoder
+}
+
+// Server serves the files of an FS under a URL prefix. Files are read into memory by New; restart to
+// pick up changes.
+type Server struct {
+	prefix  string
+	started time.Time
+	files   map[string]*asset // By name
+	hashed  map[string]*asset // By hashed name, e.g. "css/app.3f2a1b9c.css"
+}
+
+// New loads the files of fsys, served under prefix, e.g. "/static/".
+func New(fsys fs.FS, prefix string) (*Server, error) {
+	s := &Server{
+		prefix:  "/" + strings.Trim(prefix, "/") + "/",
+		started: time.Now(),
+		files:   map[string]*asset{},
+		hashed:  map[string]*asset{},
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") || isVariant(fsys, name) {
+			return nil
+		}
+		body, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		a := &asset{name: name, hash: hex.EncodeToString(sum[:4]), body: body}
+		if br, err := fs.ReadFile(fsys, name+".br"); err == nil {
+			a.brotli = br
+		}
+		if gz, err := fs.ReadFile(fsys, name+".gz"); err == nil {
+			a.gzip = gz
+		} else if compressible[path.Ext(name)] {
+			a.gzip = compress(body)
+		}
+		s.files[name] = a
+		s.hashed[hashedName(name, a.hash)] = a
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("assets: load: %w", err)
+	}
+	slog.Info("[ASSETS] Static files loaded", "count", len(s.files), "prefix", s.prefix)
+	return s, nil
+}
+
+// URL returns the URL of the file name under its hashed name, e.g. "/static/app.3f2a1b9c.css";
+// unknown files get their plain URL.
+func (s *Server) URL(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if a, ok := s.files[name]; ok {
+		return s.prefix + hashedName(name, a.hash)
+	}
+	slog.Warn("[ASSETS] Unknown asset", "asset", name)
+	return s.prefix + name
+}
+
+// ServeHTTP serves the file named by the path after the prefix. Hashed names are cached as immutable
+// for a year; plain names are revalidated with their ETag.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, s.prefix)
+	a, immutable := s.hashed[name]
+	if !immutable {
+		a = s.files[name]
+	}
+	if a == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("ETag", `"`+a.hash+`"`)
+	if immutable {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", "public, no-cache")
+	}
+	body := a.body
+	if a.gzip != nil || a.brotli != nil {
+		h.Add("Vary", "Accept-Encoding")
+		switch enc := r.Header.Get("Accept-Encoding"); {
+		case a.brotli != nil && accepts(enc, "br"):
+			h.Set("Content-Encoding", "br")
+			body = a.brotli
+		case a.gzip != nil && accepts(enc, "gzip"):
+			h.Set("Content-Encoding", "gzip")
+			body = a.gzip
+		}
+	}
+	// ServeContent sets the type from the extension of the plain name and answers If-None-Match
+	http.ServeContent(w, r, a.name, s.started, bytes.NewReader(body))
+}
+
+// hashedName inserts hash before the extension of name: "css/app.css" becomes "css/app.<hash>.css".
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// isVariant reports whether name is the precompressed sibling of another file, e.g. app.css.gz.
+func isVariant(fsys fs.FS, name string) bool {
+	ext := path.Ext(name)
+	if ext != ".gz" && ext != ".br" {
+		return false
+	}
+	_, err := fs.Stat(fsys, strings.TrimSuffix(name, ext))
+	return err == nil
+}
+
+// compress gzips body, returning nil when it does not get smaller.
+func compress(body []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(body)
+	zw.Close()
+	if buf.Len() >= len(body) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// accepts reports whether the Accept-Encoding header enc accepts coding, ignoring codings with q=0.
+func accepts(enc, coding string) bool {
+	for _, part := range strings.Split(enc, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
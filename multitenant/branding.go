@@ -0,0 +1,87 @@
+package multitenant
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// BrandThemes lists the daisyUI themes tenants may pick; the first one is the platform default.
+var BrandThemes = []string{"light", "dark", "cupcake", "corporate", "emerald", "forest", "night", "nord"}
+
+// hexColor accepts #rgb and #rrggbb colors, the forms the generated stylesheet can blend.
+var hexColor = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Brand is the visual identity of a tenant, loaded and cached with it.
+type Brand struct {
+	PrimaryColor   string // Hex color; empty for the platform default
+	SecondaryColor string // Hex color; empty for the platform default
+	Theme          string // One of BrandThemes; empty for the platform default
+	LogoPath       string // URL or site path of the logo; empty when unset
+	Version        int64  // Bumped on every change, used to version cached assets
+}
+
+// Inherit returns the brand with the fields of parent it leaves unset, for sub-tenants. The
+// version follows the changes of both.
+func (b Brand) Inherit(parent Brand) Brand {
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = parent.PrimaryColor
+	}
+	if b.SecondaryColor == "" {
+		b.SecondaryColor = parent.SecondaryColor
+	}
+	if b.Theme == "" {
+		b.Theme = parent.Theme
+	}
+	if b.LogoPath == "" {
+		b.LogoPath = parent.LogoPath
+	}
+	b.Version += parent.Version
+	return b
+}
+
+// ValidBrandColor reports whether c can be used as a brand color. Empty means unset.
+func ValidBrandColor(c string) bool {
+	return c == "" || hexColor.MatchString(c)
+}
+
+// ValidBrandTheme reports whether theme is one of BrandThemes. Empty means unset.
+func ValidBrandTheme(theme string) bool {
+	if theme == "" {
+		return true
+	}
+	for _, t := range BrandThemes {
+		if t == theme {
+			return true
+		}
+	}
+	return false
+}
+
+// ContrastColor returns black or white, whichever reads best on the hex color c.
+func ContrastColor(c string) string {
+	r, g, b, err := parseHexColor(c)
+	if err != nil {
+		return "#ffffff"
+	}
+	// Perceived brightness (ITU-R BT.601)
+	if 299*r+587*g+114*b > 128*1000 {
+		return "#000000"
+	}
+	return "#ffffff"
+}
+
+func parseHexColor(c string) (r, g, b int, err error) {
+	if !hexColor.MatchString(c) {
+		return 0, 0, 0, fmt.Errorf("invalid color %q", c)
+	}
+	hex := c[1:]
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff), nil
+}
@@ -0,0 +1,123 @@
+package multitenant
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// TenantStore keeps the tenants of a CachedFetcher. cache.Cache implements it: cache.NewMemory is an
+// LRU for one instance, and the Redis backend shares the tenants between instances.
+type TenantStore interface {
+	Get(ctx context.Context, key string) ([]byte, error) // Any error is a miss
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// CachedFetcher wraps a TenantFetcher with a cache. Unknown identifiers are cached too (for
+// NegativeTTL) so that probing random subdomains does not reach the database.
+// Call Invalidate or InvalidateTenant when a tenant is updated or suspended.
+type CachedFetcher struct {
+	Fetcher     TenantFetcher
+	Store       TenantStore
+	TTL         time.Duration // Lifetime of a found tenant
+	NegativeTTL time.Duration // Lifetime of a "not found" answer
+}
+
+// cacheEntry is a cached answer. Mark is the change mark of the tenant it was loaded under; the
+// entry is stale once InvalidateTenant changed it.
+type cacheEntry struct {
+	Tenant *Tenant `json:"tenant"` // nil for a negative entry
+	Mark   string  `json:"mark,omitempty"`
+}
+
+// NewCachedFetcher returns a cache in store in front of f using the lifetimes of cfg.
+func NewCachedFetcher(f TenantFetcher, store TenantStore, cfg TenantCacheConfig) *CachedFetcher {
+	return &CachedFetcher{Fetcher: f, Store: store, TTL: cfg.TTL, NegativeTTL: cfg.NegativeTTL}
+}
+
+// Fetch returns the cached tenant or loads it from the wrapped fetcher.
+// Errors are never cached.
+func (c *CachedFetcher) Fetch(ctx context.Context, identifier string) (*Tenant, error) {
+	if t, ok := c.get(ctx, identifier); ok {
+		return t, nil
+	}
+	t, err := c.Fetcher.Fetch(ctx, identifier)
+	if err != nil {
+		return nil, err
+	}
+	e, ttl := cacheEntry{Tenant: t}, c.TTL
+	if t == nil {
+		ttl = c.NegativeTTL
+	} else if ttl > 0 {
+		e.Mark = c.mark(ctx, t.ID)
+	}
+	if ttl > 0 {
+		c.put(ctx, identifier, e, ttl)
+	}
+	return t, nil
+}
+
+// Invalidate drops the cached answer for an identifier, e.g. after a tenant is created on it.
+func (c *CachedFetcher) Invalidate(identifier string) {
+	if err := c.Store.Delete(context.Background(), tenantCacheKey(identifier)); err != nil {
+		slog.Warn("[CACHE] Failed to drop tenant", "identifier", identifier, "err", err)
+	}
+}
+
+// InvalidateTenant drops every cached entry of a tenant, e.g. after it is renamed or suspended, by
+// changing its mark.
+func (c *CachedFetcher) InvalidateTenant(tenantID int64) {
+	if c.TTL <= 0 {
+		return
+	}
+	mark := strconv.FormatInt(time.Now().UnixNano(), 36)
+	// Entries older than TTL are gone, so the mark need not outlive them
+	if err := c.Store.Set(context.Background(), tenantMarkKey(tenantID), []byte(mark), c.TTL); err != nil {
+		slog.Warn("[CACHE] Failed to drop tenant", "tenant_id", tenantID, "err", err)
+	}
+}
+
+func (c *CachedFetcher) get(ctx context.Context, identifier string) (*Tenant, bool) {
+	b, err := c.Store.Get(ctx, tenantCacheKey(identifier))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, false
+	}
+	if e.Tenant != nil && e.Mark != c.mark(ctx, e.Tenant.ID) {
+		return nil, false
+	}
+	return e.Tenant, true
+}
+
+func (c *CachedFetcher) put(ctx context.Context, identifier string, e cacheEntry, ttl time.Duration) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = c.Store.Set(ctx, tenantCacheKey(identifier), b, ttl)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "[CACHE] Failed to store tenant", "identifier", identifier, "err", err)
+	}
+}
+
+// mark returns the change mark of a tenant, "" when it did not change lately.
+func (c *CachedFetcher) mark(ctx context.Context, tenantID int64) string {
+	b, err := c.Store.Get(ctx, tenantMarkKey(tenantID))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func tenantCacheKey(identifier string) string {
+	return "tenants:lookup:" + identifier
+}
+
+func tenantMarkKey(tenantID int64) string {
+	return "tenants:mark:" + strconv.FormatInt(tenantID, 10)
+}
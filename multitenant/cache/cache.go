@@ -0,0 +1,155 @@
+// Package cache keeps data read on every request, such as sessions and tenants, out of the
+// database. The memory backend serves one instance; with CACHE_BACKEND=redis the instances share
+// the cache, and a change made on one is seen at once by the others.
+//
+//	plan, err := cache.Load(ctx, cache.Current(), "plan:"+name, time.Minute, func(ctx context.Context) (*Plan, error) {
+//		return loadPlan(ctx, name)
+//	})
+//
+// Load runs the loader once for concurrent misses of the same key, and falls back to it when the
+// cache fails, so a cache outage slows requests down without breaking them.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// ErrMiss is returned by Get for a missing or expired key.
+var ErrMiss = errors.New("cache: miss")
+
+// Cache stores values by key for a limited time.
+type Cache interface {
+	// Get returns the value of key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the value of key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys; missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Counter is implemented by caches that count atomically, such as attempts within a fixed window.
+type Counter interface {
+	// Incr adds one to the counter of key and returns its new value. A new counter expires after
+	// ttl, which later increments do not extend.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// New returns the cache of cfg.Backend: "memory" (default), "redis" or "none" for no cache.
+func New(cfg multitenant.CacheConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemory(cfg.Size), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("cache: REDIS_ADDR is required for the redis backend")
+		}
+		client := &redis.Client{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB}
+		return &Redis{Client: client, Prefix: "tenkit:cache:"}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("cache: unknown backend %q", cfg.Backend)
+	}
+}
+
+type holder struct{ Cache }
+
+var current atomic.Value // holder
+
+// SetCache installs the cache used by tenkit; nil turns caching off.
+func SetCache(c Cache) {
+	current.Store(holder{c})
+}
+
+// Current returns the installed cache, nil when caching is off.
+func Current() Cache {
+	h, _ := current.Load().(holder)
+	return h.Cache
+}
+
+// Load returns the value of key, calling load and caching its result for ttl on a miss. Values are
+// stored as JSON. Concurrent misses of a key share one call of load, and errors are not cached.
+// With a nil cache, load is called every time.
+func Load[T any](ctx context.Context, c Cache, key string, ttl time.Duration, load func(context.Context) (T, error)) (T, error) {
+	var v T
+	if c == nil {
+		return load(ctx)
+	}
+	b, err := c.Get(ctx, key)
+	if err == nil {
+		if err := json.Unmarshal(b, &v); err == nil {
+			return v, nil
+		}
+		slog.WarnContext(ctx, "[CACHE] Undecodable entry dropped", "key", key)
+	} else if !errors.Is(err, ErrMiss) {
+		slog.WarnContext(ctx, "[CACHE] Get failed", "key", key, "err", err)
+	}
+
+	b, err = flights.do(key, func() ([]byte, error) {
+		// The first caller leaving must not fail the others waiting on the same load
+		v, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Set(ctx, key, b, ttl); err != nil {
+			slog.WarnContext(ctx, "[CACHE] Set failed", "key", key, "err", err)
+		}
+		return b, nil
+	})
+	if err != nil {
+		return v, err
+	}
+	return v, json.Unmarshal(b, &v)
+}
+
+// group runs one call per key at a time, sharing its result with the callers asking meanwhile.
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+var flights group
+
+func (g *group) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.val, c.err
+	}
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory is a Cache local to the instance, evicting the least recently used keys beyond Size.
+type Memory struct {
+	Size int // Maximum number of keys, unbounded when zero
+
+	mu    sync.Mutex
+	ll    *list.List // Front is the most recently used entry
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns a memory cache keeping at most size keys.
+func NewMemory(size int) *Memory {
+	return &Memory{Size: size}
+}
+
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	e := el.Value.(*memoryEntry)
+	if time.Now().After(e.expires) {
+		m.remove(el)
+		return nil, ErrMiss
+	}
+	m.ll.MoveToFront(el)
+	return append([]byte(nil), e.value...), nil
+}
+
+func (m *Memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, append([]byte(nil), value...), time.Now().Add(ttl))
+	return nil
+}
+
+// set stores value until expires; the caller holds mu.
+func (m *Memory) set(key string, value []byte, expires time.Time) {
+	if m.ll == nil {
+		m.ll = list.New()
+		m.items = make(map[string]*list.Element)
+	}
+	e := &memoryEntry{key: key, value: value, expires: expires}
+	if el, ok := m.items[key]; ok {
+		el.Value = e
+		m.ll.MoveToFront(el)
+		return
+	}
+	m.items[key] = m.ll.PushFront(e)
+	for m.Size > 0 && m.ll.Len() > m.Size {
+		m.remove(m.ll.Back())
+	}
+}
+
+func (m *Memory) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		if el, ok := m.items[k]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	expires := time.Now().Add(ttl)
+	if el, ok := m.items[key]; ok {
+		if e := el.Value.(*memoryEntry); time.Now().Before(e.expires) {
+			n, _ = strconv.ParseInt(string(e.value), 10, 64)
+			expires = e.expires
+		}
+	}
+	n++
+	m.set(key, []byte(strconv.FormatInt(n, 10)), expires)
+	return n, nil
+}
+
+// remove deletes an element; the caller holds mu.
+func (m *Memory) remove(el *list.Element) {
+	m.ll.Remove(el)
+	delete(m.items, el.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// Redis is a Cache shared by every instance of the application.
+type Redis struct {
+	Client *redis.Client
+	Prefix string // Key prefix, e.g. "tenkit:cache:"
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.Client.Do(ctx, "GET", r.Prefix+key)
+	if errors.Is(err, redis.ErrNil) {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("cache: unexpected GET reply %v", reply)
+	}
+	return []byte(s), nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := r.Client.Do(ctx, "SET", r.Prefix+key, string(value), "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	return err
+}
+
+// incrScript increments KEYS[1] and starts its expiry of ARGV[1] ms when it is new.
+const incrScript = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`
+
+func (r *Redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := r.Client.Do(ctx, "EVAL", incrScript, "1", r.Prefix+key, strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("cache: unexpected INCR reply %v", reply)
+	}
+	return n, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := []string{"DEL"}
+	for _, k := range keys {
+		args = append(args, r.Prefix+k)
+	}
+	_, err := r.Client.Do(ctx, args...)
+	return err
+}
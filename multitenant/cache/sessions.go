@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// SessionTTL is how long Session serves a cached session, 0 to read the database every time.
+var SessionTTL = 30 * time.Second
+
+// markTTL keeps the change mark of a user longer than any cached session of theirs.
+const markTTL = 24 * time.Hour
+
+// sessionEntry is a cached session, current while the change mark of its user is still Mark.
+type sessionEntry struct {
+	User *models.User
+	Mark string
+}
+
+// Session returns the user of a session token like models.GetSession, serving it from the installed
+// cache for up to SessionTTL. A cached session is dropped as soon as its user changes (see Watch);
+// the password hash is never cached. Without a cache, the database is read every time.
+func Session(ctx context.Context, token string) (*models.User, error) {
+	c, ttl := Current(), SessionTTL
+	if c == nil || ttl <= 0 {
+		return models.GetSession(token)
+	}
+	key := sessionKey(token)
+	if b, err := c.Get(ctx, key); err == nil {
+		var e sessionEntry
+		if json.Unmarshal(b, &e) == nil && e.User != nil && time.Now().Before(e.User.SessionExpires) &&
+			e.Mark == mark(ctx, c, userMarkKey(e.User.ID)) {
+			return e.User, nil
+		}
+	} else if !errors.Is(err, ErrMiss) {
+		slog.WarnContext(ctx, "[CACHE] Get failed", "key", "session", "err", err)
+	}
+
+	b, err := flights.do(key, func() ([]byte, error) {
+		u, err := models.GetSession(token)
+		if err != nil {
+			return nil, err
+		}
+		u.PasswordHash = ""
+		b, err := json.Marshal(sessionEntry{User: u, Mark: mark(ctx, c, userMarkKey(u.ID))})
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Set(ctx, key, b, min(ttl, time.Until(u.SessionExpires))); err != nil {
+			slog.WarnContext(ctx, "[CACHE] Set failed", "key", "session", "err", err)
+		}
+		return b, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var e sessionEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return e.User, nil
+}
+
+// ForgetSession drops a cached session.
+func ForgetSession(ctx context.Context, c Cache, token string) {
+	if c == nil {
+		return
+	}
+	if err := c.Delete(ctx, sessionKey(token)); err != nil {
+		slog.WarnContext(ctx, "[CACHE] Failed to drop session", "err", err)
+	}
+}
+
+// ForgetUser drops the cached sessions of a user, by changing their mark.
+func ForgetUser(ctx context.Context, c Cache, userID int64) {
+	if c == nil {
+		return
+	}
+	if err := c.Set(ctx, userMarkKey(userID), newMark(), markTTL); err != nil {
+		slog.WarnContext(ctx, "[CACHE] Failed to drop sessions of user", "user_id", userID, "err", err)
+	}
+}
+
+// Watch registers the models hooks dropping what the installed cache holds about a user or a
+// tenant when it changes, and the sessions that end. Call it once per process.
+func Watch() {
+	models.OnUserChange(func(userID int64) { ForgetUser(context.Background(), Current(), userID) })
+	models.OnSessionEnd(func(token string) { ForgetSession(context.Background(), Current(), token) })
+	models.OnTenantChange(func(tenantID int64) { ForgetTenant(context.Background(), Current(), tenantID) })
+}
+
+// sessionKey hashes the token, so that the cache never holds usable credentials.
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "session:" + hex.EncodeToString(sum[:])
+}
+
+func userMarkKey(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10) + ":mark"
+}
+
+// mark returns the change mark stored under key, "" when nothing changed lately. Entries record the
+// mark they were loaded under, and are stale once it differs.
+func mark(ctx context.Context, c Cache, key string) string {
+	b, err := c.Get(ctx, key)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func newMark() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+}
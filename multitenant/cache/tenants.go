@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// TenantTTL is how long the values of LoadTenant stay cached.
+var TenantTTL = time.Minute
+
+// LoadTenant is Load for a value of a tenant, such as settings kept in their own table, cached
+// under name for TenantTTL. The values of a tenant are dropped whenever it changes (see Watch and
+// models.TenantChanged).
+func LoadTenant[T any](ctx context.Context, tenantID int64, name string, load func(context.Context) (T, error)) (T, error) {
+	c := Current()
+	if c == nil || TenantTTL <= 0 {
+		return load(ctx)
+	}
+	mk := tenantMarkKey(tenantID)
+	return Load(ctx, c, mk+":"+mark(ctx, c, mk)+":"+name, TenantTTL, load)
+}
+
+// ForgetTenant drops the values of a tenant cached by LoadTenant, by changing its mark.
+func ForgetTenant(ctx context.Context, c Cache, tenantID int64) {
+	if c == nil {
+		return
+	}
+	if err := c.Set(ctx, tenantMarkKey(tenantID), newMark(), markTTL); err != nil {
+		slog.WarnContext(ctx, "[CACHE] Failed to drop values of tenant", "tenant_id", tenantID, "err", err)
+	}
+}
+
+func tenantMarkKey(tenantID int64) string {
+	return "tenant:" + strconv.FormatInt(tenantID, 10)
+}
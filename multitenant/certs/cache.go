@@ -0,0 +1,41 @@
+package certs
+
+import (
+	"context"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// DBCache stores certificates and the ACME account key in the acme_cache table, so that
+// several instances share them. Private keys are stored as is: restrict access to the database.
+type DBCache struct{}
+
+func (DBCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := models.GetACMECache(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (DBCache) Put(ctx context.Context, key string, data []byte) error {
+	return models.PutACMECache(ctx, key, data)
+}
+
+func (DBCache) Delete(ctx context.Context, key string) error {
+	return models.DeleteACMECache(ctx, key)
+}
+
+// NewCache returns the cache selected by cfg.Cache: the database or a local directory.
+func NewCache(cfg multitenant.TLSConfig) autocert.Cache {
+	if cfg.Cache == "db" {
+		return DBCache{}
+	}
+	return autocert.DirCache(cfg.CacheDir)
+}
@@ -0,0 +1,79 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DNSProvider publishes the TXT records of DNS-01 challenges. fqdn is the full record name,
+// e.g. "_acme-challenge.example.com.", and value the record content.
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+var dnsProviders = struct {
+	sync.RWMutex
+	byName map[string]DNSProvider
+}{byName: map[string]DNSProvider{}}
+
+// RegisterDNSProvider makes a provider selectable with TLS_DNS_PROVIDER. Call it before New.
+func RegisterDNSProvider(name string, p DNSProvider) {
+	dnsProviders.Lock()
+	defer dnsProviders.Unlock()
+	dnsProviders.byName[name] = p
+}
+
+func lookupDNSProvider(name string) (DNSProvider, bool) {
+	dnsProviders.RLock()
+	defer dnsProviders.RUnlock()
+	p, ok := dnsProviders.byName[name]
+	return p, ok
+}
+
+// ExecProvider delegates to a script called as "<command> present|cleanup <fqdn> <value>",
+// which lets any DNS host be used without a dedicated provider.
+type ExecProvider struct {
+	Command string
+}
+
+func (p ExecProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+func (p ExecProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+func (p ExecProvider) run(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, p.Command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns hook %s: %w: %s", action, err, out)
+	}
+	return nil
+}
+
+// waitForTXT polls public DNS until the record is visible or the timeout expires. The CA may
+// still see the record earlier than our resolver, so a timeout is logged rather than fatal.
+func waitForTXT(ctx context.Context, fqdn, value string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		records, _ := net.DefaultResolver.LookupTXT(ctx, fqdn)
+		for _, r := range records {
+			if r == value {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+	slog.Warn("[CERTS] TXT record not visible yet, continuing", "fqdn", fqdn)
+}
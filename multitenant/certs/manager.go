@@ -0,0 +1,355 @@
+// Package certs serves HTTPS with certificates obtained from an ACME CA such as Let's Encrypt:
+// the root domain and tenant custom domains through autocert, and tenant subdomains through a
+// wildcard certificate validated with DNS-01 when a DNS provider is configured.
+//
+// TLS_ACME=1 turns it on. TLS_DNS_PROVIDER names a provider added with RegisterDNSProvider, or the
+// exec hook, and TLS_CACHE=dir|db keeps the certificates on disk or in the database.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// accountKeyName is where autocert keeps the ACME account key; the wildcard flow reuses it.
+const accountKeyName = "acme_account+key"
+
+// renewBefore is how long before expiry the wildcard certificate is renewed.
+const renewBefore = 30 * 24 * time.Hour
+
+// Manager picks the certificate for each TLS handshake.
+type Manager struct {
+	domain   string
+	cfg      multitenant.TLSConfig
+	cache    autocert.Cache
+	dns      DNSProvider
+	autocert *autocert.Manager
+
+	mu       sync.RWMutex
+	wildcard *tls.Certificate
+}
+
+// New builds a Manager from the configuration. It fails when the configured DNS provider is unknown.
+func New(cfg *multitenant.Config) (*Manager, error) {
+	m := &Manager{
+		domain: hostOnly(cfg.Domain),
+		cfg:    cfg.TLS,
+		cache:  NewCache(cfg.TLS),
+	}
+	switch cfg.TLS.DNSProvider {
+	case "":
+	case "exec":
+		if cfg.TLS.DNSExec == "" {
+			return nil, errors.New("certs: TLS_DNS_EXEC is required by the exec DNS provider")
+		}
+		m.dns = ExecProvider{Command: cfg.TLS.DNSExec}
+	default:
+		p, ok := lookupDNSProvider(cfg.TLS.DNSProvider)
+		if !ok {
+			return nil, fmt.Errorf("certs: unknown DNS provider %q", cfg.TLS.DNSProvider)
+		}
+		m.dns = p
+	}
+	m.autocert = &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      m.cache,
+		HostPolicy: m.hostPolicy,
+		Email:      cfg.TLS.Email,
+		Client:     &acme.Client{DirectoryURL: cfg.TLS.DirectoryURL},
+	}
+	return m, nil
+}
+
+// TLSConfig returns the server TLS configuration, including the TLS-ALPN-01 protocol.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// HTTPHandler answers HTTP-01 challenges and passes other requests to fallback;
+// a nil fallback redirects them to HTTPS.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return m.autocert.HTTPHandler(fallback)
+}
+
+// GetCertificate serves the wildcard certificate to tenant subdomains when available,
+// and lets autocert handle every other host.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if m.isTenantHost(name) && !isALPNChallenge(hello) {
+		m.mu.RLock()
+		cert := m.wildcard
+		m.mu.RUnlock()
+		if cert != nil {
+			return cert, nil
+		}
+	}
+	return m.autocert.GetCertificate(hello)
+}
+
+// Start loads or obtains the wildcard certificate and keeps it renewed until ctx is done.
+// Without a DNS provider it does nothing and tenant subdomains get individual certificates.
+func (m *Manager) Start(ctx context.Context) {
+	if m.dns == nil {
+		return
+	}
+	go func() {
+		for {
+			if err := m.ensureWildcard(ctx); err != nil {
+				slog.Error("[CERTS] Wildcard certificate unavailable", "domain", m.domain, "err", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(12 * time.Hour):
+			}
+		}
+	}()
+}
+
+// hostPolicy allows the root domain, existing tenant subdomains and active custom domains.
+func (m *Manager) hostPolicy(ctx context.Context, host string) error {
+	if host == m.domain || host == "www."+m.domain {
+		return nil
+	}
+	if m.isTenantHost(host) {
+		id, err := models.GetTenantIDBySubdomain(ctx, strings.TrimSuffix(host, "."+m.domain))
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			return nil
+		}
+		return fmt.Errorf("certs: no tenant for %q", host)
+	}
+	ok, err := models.IsActiveCustomDomain(ctx, host)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("certs: host %q not allowed", host)
+	}
+	return nil
+}
+
+// isTenantHost reports whether host is a single label under the root domain.
+func (m *Manager) isTenantHost(host string) bool {
+	sub, ok := strings.CutSuffix(host, "."+m.domain)
+	return ok && sub != "" && sub != "www" && !strings.Contains(sub, ".")
+}
+
+func (m *Manager) wildcardName() string {
+	return "wildcard." + m.domain
+}
+
+// ensureWildcard loads the cached wildcard certificate and renews it when close to expiry.
+func (m *Manager) ensureWildcard(ctx context.Context) error {
+	if cert, err := m.cachedWildcard(ctx); err == nil && time.Until(cert.Leaf.NotAfter) > renewBefore {
+		m.mu.Lock()
+		m.wildcard = cert
+		m.mu.Unlock()
+		return nil
+	}
+
+	slog.Info("[CERTS] Requesting wildcard certificate", "domain", m.domain)
+	cert, err := m.obtainWildcard(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.wildcard = cert
+	m.mu.Unlock()
+	slog.Info("[CERTS] Wildcard certificate ready", "domain", m.domain, "expires", cert.Leaf.NotAfter)
+	return nil
+}
+
+func (m *Manager) cachedWildcard(ctx context.Context) (*tls.Certificate, error) {
+	data, err := m.cache.Get(ctx, m.wildcardName())
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// obtainWildcard runs an ACME order for *.domain, answering its DNS-01 challenge through the provider.
+func (m *Manager) obtainWildcard(ctx context.Context) (*tls.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	// Step 1: Register or reuse the account
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.cfg.DirectoryURL}
+	acct := &acme.Account{}
+	if m.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("register account: %w", err)
+	}
+
+	// Step 2: Order and answer the DNS-01 challenges
+	name := "*." + m.domain
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(name))
+	if err != nil {
+		return nil, fmt.Errorf("authorize order: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, u); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("wait order: %w", err)
+	}
+
+	// Step 3: Finalize with a fresh key and cache key + chain in the autocert PEM layout
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{name}}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("finalize order: %w", err)
+	}
+	var buf bytes.Buffer
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return nil, err
+	}
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, b := range der {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: b})
+	}
+	if err := m.cache.Put(ctx, m.wildcardName(), buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("cache certificate: %w", err)
+	}
+	return m.cachedWildcard(ctx)
+}
+
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	z, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", z.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	fqdn := "_acme-challenge." + strings.TrimPrefix(z.Identifier.Value, "*.") + "."
+	if err := m.dns.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("present %s: %w", fqdn, err)
+	}
+	defer func() {
+		if err := m.dns.CleanUp(context.Background(), fqdn, value); err != nil {
+			slog.Warn("[CERTS] Failed to clean up challenge record", "fqdn", fqdn, "err", err)
+		}
+	}()
+	waitForTXT(ctx, fqdn, value, 3*time.Minute)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, z.URI); err != nil {
+		return fmt.Errorf("authorization of %s: %w", z.Identifier.Value, err)
+	}
+	return nil
+}
+
+// accountKey loads the account key shared with autocert, creating it on first use.
+func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := m.cache.Get(ctx, accountKeyName)
+	if errors.Is(err, autocert.ErrCacheMiss) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.cache.Put(ctx, accountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("certs: invalid account key in cache")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	return nil, errors.New("certs: unsupported account key in cache")
+}
+
+func isALPNChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
+
+func hostOnly(host string) string {
+	if i := strings.Index(host, ":"); i != -1 {
+		return host[:i]
+	}
+	return host
+}
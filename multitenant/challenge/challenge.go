@@ -0,0 +1,158 @@
+// Package challenge asks suspicious visitors of the enroll, register and login forms to solve a
+// CAPTCHA. A source is challenged when it is on the IP challenge list, or once it made
+// CHALLENGE_AFTER suspicious attempts (failed logins, repeated signups) within CHALLENGE_WINDOW,
+// counted per IP and per email on each tenant. Without a provider, challenged IPs are refused
+// instead, so the counters still throttle logins; emails are then not counted, as refusing them
+// would let anyone lock their owners out.
+//
+// Forms render the widget with {{ template "challenge" . }}, which shows it when the handler set
+// Extra["Challenge"], and the flows check the response posted with the form, or sent as
+// "challenge" to the JSON API.
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// ErrFailed is returned by Verify when the response is missing, wrong or expired.
+var ErrFailed = errors.New("challenge: verification failed")
+
+// Widget is what a form embeds to show the challenge, see templates/challenge.html.
+type Widget struct {
+	Script  string // URL of the provider's script
+	Class   string // Class of the element the script renders the widget in
+	SiteKey string
+}
+
+// Provider is a CAPTCHA service.
+type Provider interface {
+	// Widget returns the widget to embed in forms.
+	Widget() Widget
+	// Field is the name of the form field the widget posts its response in.
+	Field() string
+	// Verify checks the response of the visitor at ip, returning ErrFailed when it is not valid.
+	Verify(ctx context.Context, response, ip string) error
+}
+
+// SiteVerify is a Provider speaking the siteverify protocol shared by hCaptcha, Cloudflare
+// Turnstile and reCAPTCHA: the response is posted with the secret to VerifyURL, which answers
+// {"success": true} when it is valid.
+type SiteVerify struct {
+	VerifyURL     string
+	ResponseField string
+	Embed         Widget // Returned by Widget
+	Secret        string
+	Client        *http.Client
+}
+
+// HCaptcha returns the hCaptcha provider.
+func HCaptcha(siteKey, secret string) *SiteVerify {
+	return newSiteVerify("https://api.hcaptcha.com/siteverify", "h-captcha-response",
+		Widget{Script: "https://js.hcaptcha.com/1/api.js", Class: "h-captcha", SiteKey: siteKey}, secret)
+}
+
+// Turnstile returns the Cloudflare Turnstile provider.
+func Turnstile(siteKey, secret string) *SiteVerify {
+	return newSiteVerify("https://challenges.cloudflare.com/turnstile/v0/siteverify", "cf-turnstile-response",
+		Widget{Script: "https://challenges.cloudflare.com/turnstile/v0/api.js", Class: "cf-turnstile", SiteKey: siteKey}, secret)
+}
+
+// ReCAPTCHA returns the reCAPTCHA v2 checkbox provider.
+func ReCAPTCHA(siteKey, secret string) *SiteVerify {
+	return newSiteVerify("https://www.google.com/recaptcha/api/siteverify", "g-recaptcha-response",
+		Widget{Script: "https://www.google.com/recaptcha/api.js", Class: "g-recaptcha", SiteKey: siteKey}, secret)
+}
+
+func newSiteVerify(verifyURL, field string, w Widget, secret string) *SiteVerify {
+	return &SiteVerify{
+		VerifyURL:     verifyURL,
+		ResponseField: field,
+		Embed:         w,
+		Secret:        secret,
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *SiteVerify) Widget() Widget { return s.Embed }
+
+func (s *SiteVerify) Field() string { return s.ResponseField }
+
+func (s *SiteVerify) Verify(ctx context.Context, response, ip string) error {
+	if response == "" {
+		return ErrFailed
+	}
+	form := url.Values{"secret": {s.Secret}, "response": {response}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("challenge: siteverify answered %s", resp.Status)
+	}
+	var out struct {
+		Success bool     `json:"success"`
+		Errors  []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("challenge: invalid siteverify answer: %w", err)
+	}
+	if !out.Success {
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(out.Errors, ", "))
+	}
+	return nil
+}
+
+// New returns the provider of cfg.Provider: "hcaptcha", "turnstile", "recaptcha", or "" and "none"
+// for no provider.
+func New(cfg multitenant.ChallengeConfig) (Provider, error) {
+	if cfg.Provider != "" && cfg.Provider != "none" && (cfg.SiteKey == "" || cfg.Secret == "") {
+		return nil, fmt.Errorf("challenge: CHALLENGE_SITE_KEY and CHALLENGE_SECRET are required for %s", cfg.Provider)
+	}
+	switch cfg.Provider {
+	case "", "none":
+		return nil, nil
+	case "hcaptcha":
+		return HCaptcha(cfg.SiteKey, cfg.Secret), nil
+	case "turnstile":
+		return Turnstile(cfg.SiteKey, cfg.Secret), nil
+	case "recaptcha":
+		return ReCAPTCHA(cfg.SiteKey, cfg.Secret), nil
+	default:
+		return nil, fmt.Errorf("challenge: unknown provider %q", cfg.Provider)
+	}
+}
+
+type holder struct{ *Guard }
+
+var current atomic.Value // holder
+
+// SetGuard installs the guard used by the built-in flows; nil only refuses the IPs of the
+// challenge list.
+func SetGuard(g *Guard) {
+	current.Store(holder{g})
+}
+
+// Current returns the installed guard, nil when none is.
+func Current() *Guard {
+	h, _ := current.Load().(holder)
+	return h.Guard
+}
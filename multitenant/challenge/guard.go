@@ -0,0 +1,112 @@
+package challenge
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cache"
+)
+
+// Guard counts the suspicious attempts of each IP, and of each email on a tenant, and decides which
+// submissions must carry a solved challenge. Attempts are counted in fixed windows: later attempts
+// do not extend one, so a source is challenged for at most Window after its last attempt.
+type Guard struct {
+	Provider Provider      // nil to refuse challenged IPs
+	After    int           // Suspicious attempts before a challenge, 0 to only challenge listed IPs
+	Window   time.Duration // Window attempts are counted in
+
+	once  sync.Once
+	local *cache.Memory // Counters when the installed cache cannot count
+}
+
+// NewGuard returns the guard configured by cfg.
+func NewGuard(cfg multitenant.ChallengeConfig) (*Guard, error) {
+	p, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{Provider: p, After: cfg.After, Window: cfg.Window}, nil
+}
+
+// Required reports whether ip, or email on the tenant, made After suspicious attempts or more.
+// email may be "". Emails only count with a provider: refusing an email outright would let anyone
+// lock its owner out, while a challenge only slows them down.
+func (g *Guard) Required(ctx context.Context, tenantID int64, ip, email string) bool {
+	if g.After <= 0 {
+		return false
+	}
+	for _, key := range g.keys(tenantID, ip, email) {
+		if g.count(ctx, key) >= g.After {
+			return true
+		}
+	}
+	return false
+}
+
+// Note counts a suspicious attempt of ip and of email on the tenant. email may be "".
+func (g *Guard) Note(ctx context.Context, tenantID int64, ip, email string) {
+	if g.After <= 0 {
+		return
+	}
+	c := g.counter()
+	for _, key := range g.keys(tenantID, ip, email) {
+		if _, err := c.Incr(ctx, key, max(g.Window, time.Minute)); err != nil {
+			slog.WarnContext(ctx, "[CHALLENGE] Failed to count attempt", "err", err)
+		}
+	}
+}
+
+// Reset forgets the attempts on email on the tenant, e.g. once its owner signed in.
+func (g *Guard) Reset(ctx context.Context, tenantID int64, email string) {
+	if g.After <= 0 || email == "" {
+		return
+	}
+	keys := g.keys(tenantID, "", email)
+	if len(keys) == 0 {
+		return
+	}
+	if err := g.counter().Delete(ctx, keys...); err != nil {
+		slog.WarnContext(ctx, "[CHALLENGE] Failed to reset attempts", "err", err)
+	}
+}
+
+func (g *Guard) keys(tenantID int64, ip, email string) []string {
+	var keys []string
+	if ip != "" {
+		keys = append(keys, "challenge:ip:"+ip)
+	}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" && g.Provider != nil {
+		keys = append(keys, "challenge:email:"+strconv.FormatInt(tenantID, 10)+":"+email)
+	}
+	return keys
+}
+
+func (g *Guard) count(ctx context.Context, key string) int {
+	b, err := g.counter().Get(ctx, key)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(b))
+	return n
+}
+
+// counterCache is a cache that counts atomically, as the memory and Redis caches do.
+type counterCache interface {
+	cache.Cache
+	cache.Counter
+}
+
+// counter returns the installed cache when it counts, so that instances sharing one share the
+// counters, and a local memory cache otherwise.
+func (g *Guard) counter() counterCache {
+	if c, ok := cache.Current().(counterCache); ok {
+		return c
+	}
+	g.once.Do(func() { g.local = cache.NewMemory(10000) })
+	return g.local
+}
@@ -1,91 +1,822 @@
 package multitenant
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pandamasta/tenkit/internal/envloader"
+	"github.com/pandamasta/tenkit/multitenant/logging"
+	"github.com/pandamasta/tenkit/multitenant/utils"
 )
 
 // Config defines the global configuration structure for a multitenant application.
 type Config struct {
-	Domain        string        // Root domain (e.g., "example.com")
-	SessionCookie CookieConfig  // Session cookie configuration
-	CSRF          CSRFConfig    // CSRF protection configuration
-	Server        ServerConfig  // HTTP server configuration
-	TokenExpiry   time.Duration // Default token/session expiration
-	I18n          I18nConfig    // Language and translation config
+	Env            string            // "dev" or "prod"; production refuses insecure defaults
+	Domain         string            // Root domain (e.g., "example.com")
+	Secret         SecretConfig      // Token signing keys
+	Crypto         CryptoConfig      // Master keys of the per-tenant data keys, see the crypto package
+	Secrets        SecretsConfig     // Where secrets are read from, see the secrets package
+	Database       DatabaseConfig    // Database connection
+	SessionCookie  CookieConfig      // Session cookie configuration
+	CSRF           CSRFConfig        // CSRF protection configuration
+	Server         ServerConfig      // HTTP server configuration
+	TokenExpiry    time.Duration     // Default token/session expiration
+	ResetExpiry    time.Duration     // Password reset link expiration
+	SetupExpiry    time.Duration     // Set-password link of users created by an admin (ACCOUNT_SETUP_EXPIRY)
+	TransferExpiry time.Duration     // Ownership transfer offers (OWNERSHIP_TRANSFER_EXPIRY)
+	I18n           I18nConfig        // Language and translation config
+	Export         ExportConfig      // Personal data export settings
+	Security       SecurityConfig    // Access policy settings
+	Mail           MailConfig        // Outgoing email settings
+	Storage        StorageConfig     // File storage backend
+	Log            LogConfig         // Log output settings
+	Errors         ErrorsConfig      // Error reporting
+	API            APIConfig         // Public API settings
+	RateLimit      RateLimitConfig   // Request rate limits
+	Brand          BrandConfig       // Platform defaults for tenants without branding
+	TLS            TLSConfig         // Native HTTPS with ACME certificates
+	Metrics        MetricsConfig     // Prometheus endpoint
+	Roles          RolesConfig       // Membership roles and their ranking
+	TenantCache    TenantCacheConfig // In-memory cache in front of the tenant fetcher
+	Tenants        TenantsConfig     // Tenant lifecycle settings
+	Maintenance    MaintenanceConfig // Maintenance mode switched on by configuration
+	Routes         RoutesConfig      // Flows registered by handlers.App
+	Webhooks       WebhooksConfig    // Outbound webhook delivery
+	Search         SearchConfig      // Full-text search backend
+	Realtime       RealtimeConfig    // Live updates pushed over /events
+	Jobs           JobsConfig        // Background job runner
+	Cache          CacheConfig       // Cache of sessions and tenants
+	Challenge      ChallengeConfig   // CAPTCHA asked from suspicious sources on enroll, register and login
+	Templates      TemplatesConfig   // Page templates
+	ConfigWatch    time.Duration     // How often .env and the configuration file are checked for changes, 0 for SIGHUP only
+	FeatureFlags   string            // Flags defined by configuration, see features.ParseFlags
+}
+
+// TemplatesConfig tells where page templates are loaded from.
+type TemplatesConfig struct {
+	Dir    string // Directory whose files override the built-in templates (TEMPLATES_DIR), empty for none
+	Reload bool   // Parse templates again on every render, for development (TEMPLATES_RELOAD)
+}
+
+// SearchConfig selects the backend of the search package.
+type SearchConfig struct {
+	Backend string // "sqlite" (default, in the application database), "meilisearch" or "none" (SEARCH_BACKEND)
+	URL     string // Meilisearch server, e.g. http://localhost:7700 (SEARCH_URL)
+	APIKey  string // Meilisearch key allowed to write documents and settings (SEARCH_API_KEY)
+	Index   string // Meilisearch index shared by the tenants (SEARCH_INDEX)
+}
+
+// RealtimeConfig tunes the live updates streamed to browsers at /events.
+type RealtimeConfig struct {
+	Backend       string        // "memory" (default), "redis" to reach the clients of every instance, or "none" (REALTIME_BACKEND)
+	Heartbeat     time.Duration // Comment sent on idle streams so that proxies keep them open (REALTIME_HEARTBEAT)
+	Retry         time.Duration // Reconnection delay advised to clients (REALTIME_RETRY)
+	Backlog       int           // Messages kept per tenant for reconnecting clients (REALTIME_BACKLOG)
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// CacheConfig selects the cache keeping sessions and tenants between requests.
+type CacheConfig struct {
+	Backend       string        // "memory" (default), "redis" to share it between instances, or "none" (CACHE_BACKEND)
+	Size          int           // Entries kept by the memory backend (CACHE_SIZE)
+	SessionTTL    time.Duration // How long a session is served from the cache, 0 to always read it (CACHE_SESSION_TTL)
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// ChallengeConfig selects the CAPTCHA provider and when the built-in flows ask for it.
+type ChallengeConfig struct {
+	Provider string        // "hcaptcha", "turnstile", "recaptcha", or "" to refuse challenged sources (CHALLENGE_PROVIDER)
+	SiteKey  string        // Public key of the widget (CHALLENGE_SITE_KEY)
+	Secret   string        // Verification secret (CHALLENGE_SECRET)
+	After    int           // Suspicious attempts of an IP or email before it is challenged, 0 to never (CHALLENGE_AFTER)
+	Window   time.Duration // Fixed window attempts are counted in (CHALLENGE_WINDOW)
+}
+
+// JobsConfig tunes the background job runner.
+type JobsConfig struct {
+	Workers   int           // Jobs run at the same time by each instance, 0 to run none on this one (JOBS_WORKERS)
+	PerTenant int           // Jobs of one tenant running at the same time, so that a busy tenant cannot hold every worker (JOBS_PER_TENANT)
+	Poll      time.Duration // Interval between checks for due jobs (JOBS_POLL)
+	Retention time.Duration // How long finished jobs are kept (JOBS_RETENTION)
+	Schedules string        // "kind=spec" entries separated by ";" overriding the platform task schedules, spec "off" to disable one (JOBS_SCHEDULES)
+}
+
+// WebhooksConfig tunes the delivery of outbound webhooks.
+type WebhooksConfig struct {
+	Timeout      time.Duration // Time allowed to each delivery attempt
+	AllowPrivate bool          // Deliver to loopback and private addresses, for development only
+}
+
+// TenantsConfig holds the tenant lifecycle settings.
+type TenantsConfig struct {
+	PurgeAfter     time.Duration // Grace period between soft deletion and permanent purge
+	ProvisionToken string        // Bearer token of the provisioning endpoint; empty disables it
+	DefaultPlan    string        // Limits plan of tenants without one; empty leaves them unlimited
+}
+
+// MaintenanceConfig puts the platform or some tenants in maintenance mode; platform admins and the
+// tenkit command switch it on at runtime too, see the maintenance package.
+type MaintenanceConfig struct {
+	Enabled    bool          // Whole platform (MAINTENANCE_MODE)
+	Tenants    []string      // Subdomains of the tenants in maintenance (MAINTENANCE_TENANTS)
+	Message    string        // Shown instead of the default text of the page (MAINTENANCE_MESSAGE)
+	RetryAfter time.Duration // Sent as Retry-After, 0 to leave it out (MAINTENANCE_RETRY_AFTER)
+}
+
+// TenantCacheConfig sizes the in-memory CachedFetcher of each instance. A zero Size disables it.
+type TenantCacheConfig struct {
+	Size        int
+	TTL         time.Duration // How long a tenant is served from memory
+	NegativeTTL time.Duration // How long an unknown subdomain is remembered
+}
+
+// MetricsConfig protects the /metrics endpoint.
+type MetricsConfig struct {
+	Token string // Bearer token expected from the scraper; empty leaves the endpoint open
+}
+
+// TLSConfig enables native HTTPS with certificates obtained from an ACME CA such as Let's Encrypt.
+// The root domain and verified custom domains use HTTP-01/TLS-ALPN-01; the wildcard certificate for
+// tenant subdomains needs DNS-01 and therefore a DNS provider.
+type TLSConfig struct {
+	ACME         bool   // Serve HTTPS on Addr with ACME certificates instead of plain HTTP on Server.Addr
+	Addr         string // HTTPS listener, e.g. ":443"
+	HTTPAddr     string // HTTP listener for HTTP-01 challenges and redirects, e.g. ":80"
+	Email        string // Contact address of the ACME account
+	DirectoryURL string // ACME directory; empty for Let's Encrypt production
+	Cache        string // "dir" (default) or "db"
+	CacheDir     string // Directory of the "dir" cache
+	DNSProvider  string // Registered DNS-01 provider name; empty disables the wildcard certificate
+	DNSExec      string // Hook script of the built-in "exec" provider
+}
+
+// BrandConfig holds the platform branding used when a tenant has none of its own.
+type BrandConfig struct {
+	Name       string // Web app manifest name on the root domain
+	Favicon    string // Image file served at /favicon.ico
+	ThemeColor string // Manifest theme color, e.g. "#570df8"
+}
+
+// DefaultRateLimits protects the authentication endpoints against credential stuffing and mail flooding.
+const DefaultRateLimits = "POST /login=10/1m,POST /login=30/1h:10," +
+	"POST /enroll=5/10m,POST /register=5/10m," +
+	"POST /forgot=5/10m,POST /reset=10/10m," +
+	"POST /api/v1/login=10/1m,POST /api/v1/login=30/1h:10," +
+	"POST /api/v1/enroll=5/10m,POST /api/v1/register=5/10m," +
+	"POST /api/v1/password/forgot=5/10m,POST /api/v1/password/reset=10/10m," +
+	"/api/=300/1m@tenant"
+
+// RateLimitConfig selects the rate limiter backend and the limits applied per route.
+type RateLimitConfig struct {
+	Backend       string // "memory" (default) or "redis"; use redis when running several instances
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	// Rules are "route=limit[@scope]" entries, e.g. "POST /login=10/1m,*=1200/1m@tenant".
+	// Scopes: ip (default), user, tenant. Limits are multiplied by the tenant's rate_limit_factor.
+	Rules string
+}
+
+// APIConfig holds the rate limit tiers applied to API keys.
+type APIConfig struct {
+	Tiers       map[string]int // Requests per minute allowed for each tier
+	DefaultTier string         // Tier given to new keys
+}
+
+// LogConfig controls the format of application and access logs.
+type LogConfig struct {
+	Format string   // "text" (default) or "json"
+	Level  string   // Minimum level: "debug", "info" (default), "warn" or "error"
+	Levels string   // Levels of subsystems, "SQL=debug,SESSION=warn", see logging.ParseLevels
+	Redact []string // Attribute and query parameter names whose values are replaced in logs
 }
 
 // I18nConfig holds configuration for i18n and translations.
 type I18nConfig struct {
 	DefaultLang string // e.g. "en", "fr"
-	LocalesPath string // Path to folder with JSON translation files
+	LocalesPath string // Folder with the application's JSON translation files, overriding the built-in keys; "" for the built-in ones only
+	Watch       bool   // Reload the translations when the files of LocalesPath change (development)
+	// URLPrefix puts the language in the path of pages, /fr/login; bare paths redirect to the negotiated
+	// language, except the prefixes of PrefixExempt (assets, APIs, machine endpoints)
+	URLPrefix    bool
+	PrefixExempt []string
+}
+
+// SecretConfig holds the HMAC keys used to sign tokens.
+type SecretConfig struct {
+	Current  string   // Key used to sign new tokens (TENKIT_SECRET)
+	Previous []string // Retired keys still accepted for verification (TENKIT_SECRET_PREVIOUS, comma-separated)
+	// AcceptV1Tokens accepts the pipe-delimited /verify and /confirm tokens issued before versioned
+	// tokens, until utils.LegacyTokensUntil (TENKIT_ACCEPT_V1_TOKENS)
+	AcceptV1Tokens bool
+}
+
+// CryptoConfig holds the master keys wrapping the per-tenant data keys that encrypt sensitive columns.
+// Without a master key, one is derived from the signing keys.
+type CryptoConfig struct {
+	MasterKey          string   // Key wrapping new data keys (TENKIT_MASTER_KEY)
+	PreviousMasterKeys []string // Retired keys still unwrapping data keys until rewrapped (TENKIT_MASTER_KEY_PREVIOUS, comma-separated)
+}
+
+// ExportConfig holds settings for personal data exports.
+type ExportConfig struct {
+	LinkExpiry time.Duration // Lifetime of signed download links
+}
+
+// ErrorsConfig sends panics and 5xx responses to an error tracker; see the errors package.
+type ErrorsConfig struct {
+	SentryDSN   string // Sentry project DSN (SENTRY_DSN), empty to only log errors
+	Environment string // Environment of the reports (SENTRY_ENVIRONMENT), TENKIT_ENV by default
+	Release     string // Version of the application (SENTRY_RELEASE)
+}
+
+// SecretsConfig selects the provider of secrets such as TENKIT_SECRET and SMTP_PASSWORD. The env
+// provider reads them from the settings, the others override the settings with their values.
+type SecretsConfig struct {
+	Provider        string        // "env" (default), "file", "vault" or "aws"
+	Dir             string        // Directory of the file provider, one file per secret, e.g. /run/secrets
+	VaultAddr       string        // e.g. "https://vault.internal:8200"
+	VaultToken      string        // Token of the vault provider
+	VaultPath       string        // Path of the secret, e.g. "secret/data/tenkit" for a KV v2 mount
+	AWSRegion       string        // Region of the aws provider (AWS Secrets Manager)
+	AWSSecretID     string        // Name or ARN of the secret, a JSON object of the secrets
+	AWSAccessKey    string        // AWS_ACCESS_KEY_ID
+	AWSSecretKey    string        // AWS_SECRET_ACCESS_KEY
+	AWSSessionToken string        // AWS_SESSION_TOKEN, for temporary credentials
+	CacheTTL        time.Duration // How long values are cached, and how often rotations are checked
+}
+
+// DatabaseConfig holds the database connection settings.
+type DatabaseConfig struct {
+	DSN string // SQLite database file, e.g. "./clubapp.db"
+}
+
+// StorageConfig selects where files such as exports are written.
+type StorageConfig struct {
+	Backend        string // "local" (default) or "s3"
+	LocalDir       string // Root directory of the local backend
+	LocalURLPrefix string // Route serving signed URLs of the local backend, "/files/" by default
+	S3Endpoint     string // e.g. "https://s3.eu-west-3.amazonaws.com"
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PathStyle    bool   // Required by most self-hosted S3 servers
+	S3SSE          string // Server-side encryption: "AES256" or "aws:kms"
+	S3KMSKeyID     string
+}
+
+// MailConfig holds the SMTP relay settings. An empty SMTPAddr logs messages instead.
+type MailConfig struct {
+	SMTPAddr     string // host:port of the relay
+	SMTPUser     string
+	SMTPPassword string
+	From         string // Platform sender, used until a tenant verifies its own domain
+
+	InboundDomain     string // Receiving domain; tenants get <subdomain>.<InboundDomain>
+	MailgunSigningKey string // Webhook signing key for Mailgun inbound routes
+	InboundSecret     string // Token expected in the ?token= query of the SES webhook
+}
+
+// SecurityConfig holds request filtering settings.
+type SecurityConfig struct {
+	GeoIPDatabase   string   // CSV of "cidr,country" rows; empty disables geo restrictions
+	IPBlocklist     string   // File of IPs/CIDRs rejected on enroll, register and login
+	IPChallengelist string   // File of IPs/CIDRs challenged on enroll, register and login
+	PlatformAdmins  []string // Emails allowed to use the platform admin pages
+	// ImpersonationTTL bounds the sessions platform admins open as tenant users
+	ImpersonationTTL time.Duration
+	// ConfirmOnGet uses the /verify and /confirm links as soon as they are opened, rather than when
+	// the button of their page is pressed, which mail scanners prefetching links never do
+	ConfirmOnGet bool
+	// RedirectHosts are the hosts redirects may leave the request host for, such as the "next" of
+	// /login (REDIRECT_ALLOWED_HOSTS); "*.example.com" allows the subdomains of example.com
+	RedirectHosts []string
 }
 
 // CookieConfig holds session cookie settings.
 type CookieConfig struct {
-	Name     string
-	Secure   bool
-	SameSite http.SameSite
-	MaxAge   time.Duration
+	Name        string
+	Secure      bool
+	SameSite    http.SameSite
+	MaxAge      time.Duration
+	Domain      string // "" or TenantCookieDomain for host-only cookies, or a fixed domain
+	Partitioned bool   // Keyed to the embedding site (CHIPS), for apps shown in cross-site iframes
 }
 
 // CSRFConfig holds CSRF token configuration for cookie and headers.
 type CSRFConfig struct {
-	CookieName string
-	HeaderName string
-	Secure     bool
-	SameSite   http.SameSite
-	MaxAge     time.Duration
+	CookieName  string
+	HeaderName  string
+	FieldName   string // Form field carrying the token
+	Secure      bool
+	SameSite    http.SameSite
+	MaxAge      time.Duration
+	ExemptPaths []string // Path prefixes skipped by the check, e.g. "/api/" for token-authenticated endpoints
+	MaxMemory   int64    // Memory limit when the token must be read from a multipart body
+	Domain      string   // As CookieConfig.Domain
+	Partitioned bool
+}
+
+// Cookie returns the settings of the CSRF cookie.
+func (c CSRFConfig) Cookie() CookieConfig {
+	return CookieConfig{
+		Name:        c.CookieName,
+		Secure:      c.Secure,
+		SameSite:    c.SameSite,
+		MaxAge:      c.MaxAge,
+		Domain:      c.Domain,
+		Partitioned: c.Partitioned,
+	}
 }
 
 // ServerConfig holds the network address configuration.
 type ServerConfig struct {
 	Addr string // Example: ":8080"
+	// TrustedProxies are the IPs/CIDRs of load balancers allowed to report the client IP
+	// through Forwarded, X-Forwarded-For or X-Real-IP. Empty trusts no one.
+	TrustedProxies []string
+	// TenantHeader and TenantPathPrefix enable extra tenant resolution strategies for deployments
+	// behind a proxy that names the tenant, or serving every tenant on a single host.
+	TenantHeader     string // e.g. "X-Tenant"; only honoured from trusted proxies
+	TenantPathPrefix string // e.g. "/t/" for URLs like /t/acme/login
+	// RootRedirect turns off the marketing-domain flows: requests to the root domain are redirected
+	// there and only tenant hosts are served, except the machine endpoints in RootExemptPaths.
+	RootRedirect    string   // e.g. "https://www.example.com"
+	RootExemptPaths []string // Path prefixes still served on the root domain, e.g. "/metrics"
+	// PreviewPattern names the preview host of every tenant, "{sub}" standing for its subdomain.
+	// Preview hosts serve the same tenant to its members only, flagged by middleware.IsPreview.
+	PreviewPattern string // "{sub}-preview" by default; empty disables previews
+	// ReservedSubdomains can never name a tenant, e.g. hosts the platform serves itself.
+	ReservedSubdomains []string // DefaultReservedSubdomains unless RESERVED_SUBDOMAINS is set
+	// PublicScheme and PublicPort are those of the absolute URLs built by package urls, e.g. in mails.
+	PublicScheme string // "https", or "http" for localhost without TLS_ACME
+	PublicPort   string // Appended to hosts when APP_DOMAIN has no port, e.g. "8443"; empty for the default
+	// PathURLs builds tenant URLs as <root>/<TenantPathPrefix><subdomain>/... instead of subdomains.
+	PathURLs bool
 }
 
 // LoadDefaultConfig returns an AppConfig populated with environment variables or default values.
 func LoadDefaultConfig() *Config {
 	envloader.LoadDotEnv(".env") // log déjà géré
+	loadDefaultConfigFile()
 
 	domain := getEnv("APP_DOMAIN", "localhost:9003")
-	isSecure := domain != "localhost" && domain != "localhost:9003"
+	tlsACME := getEnvBool("TLS_ACME", false)
+	isSecure := tlsACME || (domain != "localhost" && domain != "localhost:9003")
+	sessionSecure := getEnvBool("SESSION_COOKIE_SECURE", isSecure)
+	csrfSecure := getEnvBool("CSRF_COOKIE_SECURE", isSecure)
+	cookieDomain := getEnv("COOKIE_DOMAIN", "")
+	partitioned := getEnvBool("COOKIE_PARTITIONED", false)
+	sessionSameSite, csrfSameSite := http.SameSiteLaxMode, http.SameSiteStrictMode
+	if partitioned {
+		// Browsers only send cookies to a cross-site iframe with SameSite=None
+		sessionSameSite, csrfSameSite = http.SameSiteNoneMode, http.SameSiteNoneMode
+	}
 
 	defaultLang := getEnv("DEFAULT_LANG", "en")
-	localesPath := getEnv("TENKIT_LOCALES", "internal/i18n/locales") // permet override en prod/dev
+	localesPath := getEnv("TENKIT_LOCALES", "") // Application translations, merged over the built-in ones
 
 	return &Config{
+		Env:    getEnv("TENKIT_ENV", "dev"),
 		Domain: domain,
+		Secret: SecretConfig{
+			Current:        getEnv("TENKIT_SECRET", utils.DefaultSecret),
+			Previous:       getEnvList("TENKIT_SECRET_PREVIOUS"),
+			AcceptV1Tokens: getEnvBool("TENKIT_ACCEPT_V1_TOKENS", false),
+		},
+		Crypto: CryptoConfig{
+			MasterKey:          getEnv("TENKIT_MASTER_KEY", ""),
+			PreviousMasterKeys: getEnvList("TENKIT_MASTER_KEY_PREVIOUS"),
+		},
+		Secrets: SecretsConfig{
+			Provider:        getEnv("SECRETS_PROVIDER", "env"),
+			Dir:             getEnv("SECRETS_DIR", "/run/secrets"),
+			VaultAddr:       getEnv("VAULT_ADDR", ""),
+			VaultToken:      getEnv("VAULT_TOKEN", ""),
+			VaultPath:       getEnv("VAULT_SECRET_PATH", ""),
+			AWSRegion:       getEnv("AWS_REGION", ""),
+			AWSSecretID:     getEnv("AWS_SECRET_ID", ""),
+			AWSAccessKey:    getEnv("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretKey:    getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			AWSSessionToken: getEnv("AWS_SESSION_TOKEN", ""),
+			CacheTTL:        getEnvDuration("SECRETS_CACHE_TTL", 5*time.Minute),
+		},
+		Database: DatabaseConfig{
+			DSN: getEnv("DATABASE_DSN", "./clubapp.db"),
+		},
 		SessionCookie: CookieConfig{
-			Name:     getEnv("SESSION_COOKIE", "app_session"),
-			Secure:   getEnvBool("SESSION_COOKIE_SECURE", isSecure),
-			SameSite: http.SameSiteLaxMode,
-			MaxAge:   7 * 24 * time.Hour,
+			Name:        cookiePrefix("SESSION_COOKIE_PREFIX", sessionSecure, cookieDomain) + getEnv("SESSION_COOKIE", "app_session"),
+			Secure:      sessionSecure,
+			SameSite:    sessionSameSite,
+			MaxAge:      7 * 24 * time.Hour,
+			Domain:      cookieDomain,
+			Partitioned: partitioned,
 		},
 		CSRF: CSRFConfig{
-			CookieName: "csrf_token",
-			HeaderName: "X-CSRF-Token",
-			Secure:     getEnvBool("CSRF_COOKIE_SECURE", isSecure),
-			SameSite:   http.SameSiteStrictMode,
-			MaxAge:     2 * time.Hour,
+			CookieName:  cookiePrefix("CSRF_COOKIE_PREFIX", csrfSecure, cookieDomain) + "csrf_token",
+			HeaderName:  "X-CSRF-Token",
+			FieldName:   "csrf_token",
+			Secure:      csrfSecure,
+			SameSite:    csrfSameSite,
+			MaxAge:      2 * time.Hour,
+			ExemptPaths: getEnvList("CSRF_EXEMPT_PATHS"),
+			MaxMemory:   32 << 20,
+			Domain:      cookieDomain,
+			Partitioned: partitioned,
 		},
 		Server: ServerConfig{
-			Addr: getEnv("SERVER_ADDR", ":9003"),
+			Addr:               getEnv("SERVER_ADDR", ":9003"),
+			TrustedProxies:     getEnvList("TRUSTED_PROXIES"),
+			TenantHeader:       getEnv("TENANT_HEADER", ""),
+			TenantPathPrefix:   getEnv("TENANT_PATH_PREFIX", ""),
+			RootRedirect:       getEnv("ROOT_REDIRECT_URL", ""),
+			RootExemptPaths:    getEnvListDefault("ROOT_REDIRECT_EXEMPT", []string{"/healthz", "/metrics", "/webhooks/", "/api/v1/tenants", "/api/v1/maintenance"}),
+			PreviewPattern:     previewPattern(),
+			ReservedSubdomains: getEnvListDefault("RESERVED_SUBDOMAINS", DefaultReservedSubdomains),
+			PublicScheme:       getEnv("PUBLIC_SCHEME", publicScheme(isSecure)),
+			PublicPort:         getEnv("PUBLIC_PORT", ""),
+			PathURLs:           getEnvBool("TENANT_PATH_URLS", false),
 		},
-		TokenExpiry: 24 * time.Hour,
+		ConfigWatch:    getEnvDuration("TENKIT_CONFIG_WATCH", 0),
+		FeatureFlags:   getEnv("FEATURE_FLAGS", ""),
+		TokenExpiry:    24 * time.Hour,
+		ResetExpiry:    time.Hour,
+		SetupExpiry:    getEnvDuration("ACCOUNT_SETUP_EXPIRY", 72*time.Hour),
+		TransferExpiry: getEnvDuration("OWNERSHIP_TRANSFER_EXPIRY", 72*time.Hour),
 		I18n: I18nConfig{
 			DefaultLang: defaultLang,
 			LocalesPath: localesPath,
+			Watch:       getEnvBool("I18N_WATCH", false),
+			URLPrefix:   getEnvBool("LANG_URL_PREFIX", false),
+			PrefixExempt: getEnvListDefault("LANG_URL_PREFIX_EXEMPT", []string{"/static/", "/api/", "/webhooks/", "/admin/i18n/",
+				"/metrics", "/lang", "/favicon.ico", "/manifest.webmanifest", "/branding/", "/files/", "/.well-known/", "/qr.png"}),
+		},
+		Templates: TemplatesConfig{
+			Dir:    getEnv("TEMPLATES_DIR", ""),
+			Reload: getEnvBool("TEMPLATES_RELOAD", false),
+		},
+		Export: ExportConfig{
+			LinkExpiry: 48 * time.Hour,
+		},
+		Storage: StorageConfig{
+			Backend:        getEnv("TENKIT_STORAGE", "local"),
+			LocalDir:       getEnv("TENKIT_STORAGE_DIR", "storage"),
+			LocalURLPrefix: getEnv("TENKIT_STORAGE_URL_PREFIX", "/files/"),
+			S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+			S3Region:       getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:       getEnv("S3_BUCKET", ""),
+			S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle:    getEnvBool("S3_PATH_STYLE", false),
+			S3SSE:          getEnv("S3_SSE", "AES256"),
+			S3KMSKeyID:     getEnv("S3_KMS_KEY_ID", ""),
+		},
+		Mail: MailConfig{
+			SMTPAddr:     getEnv("SMTP_ADDR", ""),
+			SMTPUser:     getEnv("SMTP_USER", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "Tenkit <noreply@"+strings.Split(domain, ":")[0]+">"),
+
+			InboundDomain:     getEnv("INBOUND_MAIL_DOMAIN", "inbound."+strings.Split(domain, ":")[0]),
+			MailgunSigningKey: getEnv("MAILGUN_SIGNING_KEY", ""),
+			InboundSecret:     getEnv("INBOUND_MAIL_SECRET", ""),
+		},
+		Log: LogConfig{
+			Format: getEnv("TENKIT_LOG_FORMAT", "text"),
+			Level:  getEnv("TENKIT_LOG_LEVEL", "info"),
+			Levels: getEnv("TENKIT_LOG_LEVELS", ""),
+			Redact: getEnvListDefault("TENKIT_LOG_REDACT", []string{"password", "token", "secret", "cookie", "authorization", "csrf", "session"}),
+		},
+		Errors: ErrorsConfig{
+			SentryDSN:   getEnv("SENTRY_DSN", ""),
+			Environment: getEnv("SENTRY_ENVIRONMENT", getEnv("TENKIT_ENV", "dev")),
+			Release:     getEnv("SENTRY_RELEASE", ""),
+		},
+		API: APIConfig{
+			Tiers: map[string]int{
+				"free":       getEnvInt("API_RATE_FREE", 60),
+				"pro":        getEnvInt("API_RATE_PRO", 600),
+				"enterprise": getEnvInt("API_RATE_ENTERPRISE", 6000),
+			},
+			DefaultTier: "free",
+		},
+		RateLimit: RateLimitConfig{
+			Backend:       getEnv("RATE_LIMIT_BACKEND", "memory"),
+			RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			RedisPassword: getEnv("REDIS_PASSWORD", ""),
+			RedisDB:       getEnvInt("REDIS_DB", 0),
+			Rules:         getEnv("RATE_LIMITS", DefaultRateLimits),
+		},
+		TLS: TLSConfig{
+			ACME:         tlsACME,
+			Addr:         getEnv("TLS_ADDR", ":443"),
+			HTTPAddr:     getEnv("TLS_HTTP_ADDR", ":80"),
+			Email:        getEnv("TLS_ACME_EMAIL", ""),
+			DirectoryURL: getEnv("TLS_ACME_DIRECTORY", ""),
+			Cache:        getEnv("TLS_CACHE", "dir"),
+			CacheDir:     getEnv("TLS_CACHE_DIR", "certs"),
+			DNSProvider:  getEnv("TLS_DNS_PROVIDER", ""),
+			DNSExec:      getEnv("TLS_DNS_EXEC", ""),
+		},
+		Metrics: MetricsConfig{
+			Token: getEnv("METRICS_TOKEN", ""),
+		},
+		Maintenance: MaintenanceConfig{
+			Enabled:    getEnvBool("MAINTENANCE_MODE", false),
+			Tenants:    getEnvList("MAINTENANCE_TENANTS"),
+			Message:    getEnv("MAINTENANCE_MESSAGE", ""),
+			RetryAfter: getEnvDuration("MAINTENANCE_RETRY_AFTER", 15*time.Minute),
+		},
+		Tenants: TenantsConfig{
+			PurgeAfter:     getEnvDuration("TENANT_PURGE_AFTER", 30*24*time.Hour),
+			ProvisionToken: getEnv("TENANT_PROVISION_TOKEN", ""),
+			DefaultPlan:    getEnv("TENANT_DEFAULT_PLAN", ""),
+		},
+		Routes: RoutesConfig{
+			Disabled: getEnvList("ROUTES_DISABLED"),
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			AllowPrivate: getEnvBool("WEBHOOK_ALLOW_PRIVATE", false),
+		},
+		Search: SearchConfig{
+			Backend: getEnv("SEARCH_BACKEND", "sqlite"),
+			URL:     getEnv("SEARCH_URL", ""),
+			APIKey:  getEnv("SEARCH_API_KEY", ""),
+			Index:   getEnv("SEARCH_INDEX", "tenkit"),
+		},
+		Realtime: RealtimeConfig{
+			Backend:       getEnv("REALTIME_BACKEND", "memory"),
+			Heartbeat:     getEnvDuration("REALTIME_HEARTBEAT", 25*time.Second),
+			Retry:         getEnvDuration("REALTIME_RETRY", 3*time.Second),
+			Backlog:       getEnvInt("REALTIME_BACKLOG", 100),
+			RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			RedisPassword: getEnv("REDIS_PASSWORD", ""),
+			RedisDB:       getEnvInt("REDIS_DB", 0),
+		},
+		Cache: CacheConfig{
+			Backend:       getEnv("CACHE_BACKEND", "memory"),
+			Size:          getEnvInt("CACHE_SIZE", 10000),
+			SessionTTL:    getEnvDuration("CACHE_SESSION_TTL", 30*time.Second),
+			RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+			RedisPassword: getEnv("REDIS_PASSWORD", ""),
+			RedisDB:       getEnvInt("REDIS_DB", 0),
+		},
+		Challenge: ChallengeConfig{
+			Provider: getEnv("CHALLENGE_PROVIDER", ""),
+			SiteKey:  getEnv("CHALLENGE_SITE_KEY", ""),
+			Secret:   getEnv("CHALLENGE_SECRET", ""),
+			After:    getEnvInt("CHALLENGE_AFTER", 5),
+			Window:   getEnvDuration("CHALLENGE_WINDOW", 15*time.Minute),
+		},
+		Jobs: JobsConfig{
+			Workers:   getEnvInt("JOBS_WORKERS", 4),
+			PerTenant: getEnvInt("JOBS_PER_TENANT", 2),
+			Poll:      getEnvDuration("JOBS_POLL", time.Second),
+			Retention: getEnvDuration("JOBS_RETENTION", 72*time.Hour),
+			Schedules: getEnv("JOBS_SCHEDULES", ""),
+		},
+		TenantCache: TenantCacheConfig{
+			Size:        getEnvInt("TENANT_CACHE_SIZE", 1000),
+			TTL:         getEnvDuration("TENANT_CACHE_TTL", time.Minute),
+			NegativeTTL: getEnvDuration("TENANT_CACHE_NEGATIVE_TTL", 10*time.Second),
+		},
+		Roles: RolesConfig{
+			Roles:   parseRoles(getEnv("TENKIT_ROLES", DefaultRoles)),
+			Default: getEnv("TENKIT_DEFAULT_ROLE", "member"),
+			Admin:   getEnv("TENKIT_ADMIN_ROLE", "admin"),
+			Owner:   getEnv("TENKIT_OWNER_ROLE", "owner"),
+		},
+		Brand: BrandConfig{
+			Name:       getEnv("BRAND_NAME", "Tenkit"),
+			Favicon:    getEnv("BRAND_FAVICON", "static/static/images/logo.png"),
+			ThemeColor: getEnv("BRAND_THEME_COLOR", "#570df8"),
 		},
+		Security: SecurityConfig{
+			GeoIPDatabase:    getEnv("TENKIT_GEOIP_DB", ""),
+			IPBlocklist:      getEnv("TENKIT_IP_BLOCKLIST", ""),
+			IPChallengelist:  getEnv("TENKIT_IP_CHALLENGELIST", ""),
+			PlatformAdmins:   getEnvList("TENKIT_PLATFORM_ADMINS"),
+			ImpersonationTTL: getEnvDuration("IMPERSONATION_TTL", 30*time.Minute),
+			ConfirmOnGet:     getEnvBool("CONFIRM_ON_GET", false),
+			RedirectHosts:    getEnvList("REDIRECT_ALLOWED_HOSTS"),
+		},
+	}
+}
+
+// IsPlatformAdmin reports whether email belongs to a platform administrator.
+func (c *Config) IsPlatformAdmin(email string) bool {
+	for _, admin := range c.Security.PlatformAdmins {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrInsecureSecret is returned by Validate when production runs with the default signing key.
+var ErrInsecureSecret = errors.New("TENKIT_SECRET must be set to a non-default value outside dev mode")
+
+// ErrNoMasterKey is returned by Validate when production runs without a master key: data keys would
+// be wrapped by a key derived from TENKIT_SECRET, and retiring that secret would make them unreadable.
+var ErrNoMasterKey = errors.New("TENKIT_MASTER_KEY must be set outside dev mode; data keys wrapped before stay readable until tenkit keys rewrap")
+
+// ErrInsecureCookies is returned by Validate when production serves a public domain with cookies
+// that browsers would send over plain HTTP.
+var ErrInsecureCookies = errors.New("SESSION_COOKIE_SECURE and CSRF_COOKIE_SECURE must be true outside dev mode on a public domain")
+
+// isLocalDomain reports whether domain is served on the developer's machine.
+func isLocalDomain(domain string) bool {
+	host := domain
+	if h, _, ok := strings.Cut(domain, ":"); ok {
+		host = h
+	}
+	return host == "localhost" || strings.HasSuffix(host, ".localhost") || host == "127.0.0.1"
+}
+
+// validateCookieDomain refuses a COOKIE_DOMAIN that would send the session of a tenant to the
+// other tenants, including the sub-tenants served on its subdomains, or that the __Host- prefix
+// would drop.
+func (c *Config) validateCookieDomain() error {
+	d := strings.ToLower(strings.TrimPrefix(c.SessionCookie.Domain, "."))
+	if d == "" {
+		return nil
+	}
+	if d == TenantCookieDomain {
+		return nil
+	}
+	if strings.HasPrefix(c.SessionCookie.Name, HostPrefix) || strings.HasPrefix(c.CSRF.CookieName, HostPrefix) {
+		return errors.New("COOKIE_DOMAIN cannot be used with __Host- cookies, set the prefixes to __Secure-")
+	}
+	if c.Routes.Enabled(FlowSubTenants) {
+		return fmt.Errorf("COOKIE_DOMAIN=%s would send sessions to the sub-tenants served on its subdomains, use %q or add %s to ROUTES_DISABLED", c.SessionCookie.Domain, TenantCookieDomain, FlowSubTenants)
+	}
+	app, _, _ := strings.Cut(strings.ToLower(c.Domain), ":")
+	if d == app || strings.HasSuffix(app, "."+d) {
+		return fmt.Errorf("COOKIE_DOMAIN=%s would share sessions across tenants, use %q to scope them to each tenant", c.SessionCookie.Domain, TenantCookieDomain)
+	}
+	return nil
+}
+
+// IsDev reports whether the application runs in development mode.
+func (c *Config) IsDev() bool {
+	return c.Env == "" || c.Env == "dev"
+}
+
+// Validate checks the configuration for settings that are unsafe to run with.
+func (c *Config) Validate() error {
+	if err := validateConfigFile(); err != nil {
+		return err
+	}
+	if !c.IsDev() && (c.Secret.Current == "" || c.Secret.Current == utils.DefaultSecret) {
+		return ErrInsecureSecret
+	}
+	if !c.IsDev() && c.Crypto.MasterKey == "" {
+		return ErrNoMasterKey
+	}
+	if !c.IsDev() && !isLocalDomain(c.Domain) && (!c.SessionCookie.Secure || !c.CSRF.Secure) {
+		return ErrInsecureCookies
+	}
+	if c.Domain == "" {
+		return errors.New("APP_DOMAIN must be set")
+	}
+	if err := c.validateCookieDomain(); err != nil {
+		return err
+	}
+	if c.SessionCookie.Partitioned && (!c.SessionCookie.Secure || !c.CSRF.Secure) {
+		return errors.New("COOKIE_PARTITIONED requires secure cookies")
+	}
+	if c.Server.RootRedirect != "" {
+		if u, err := url.Parse(c.Server.RootRedirect); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("ROOT_REDIRECT_URL must be an absolute http(s) URL, got %q", c.Server.RootRedirect)
+		}
+	}
+	if c.Server.PublicScheme != "http" && c.Server.PublicScheme != "https" {
+		return fmt.Errorf("PUBLIC_SCHEME must be http or https, got %q", c.Server.PublicScheme)
 	}
+	if c.Server.PathURLs && c.Server.TenantPathPrefix == "" {
+		return errors.New("TENANT_PATH_URLS requires TENANT_PATH_PREFIX")
+	}
+	if c.I18n.LocalesPath != "" {
+		if info, err := os.Stat(c.I18n.LocalesPath); err != nil || !info.IsDir() {
+			return fmt.Errorf("TENKIT_LOCALES must be a directory, got %q", c.I18n.LocalesPath)
+		}
+	}
+	if err := validatePreviewPattern(c.Server.PreviewPattern); err != nil {
+		return err
+	}
+	if err := c.Secrets.Validate(); err != nil {
+		return err
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return fmt.Errorf("TENKIT_LOG_LEVEL must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if _, err := logging.ParseLevels(c.Log.Levels); err != nil {
+		return fmt.Errorf("TENKIT_LOG_LEVELS: %w", err)
+	}
+	if err := c.Routes.Validate(); err != nil {
+		return err
+	}
+	return c.Roles.Validate()
 }
 
-// getEnv returns the environment variable or a fallback default.
+// Validate checks that the selected provider has its settings.
+func (c SecretsConfig) Validate() error {
+	switch c.Provider {
+	case "", "env":
+	case "file":
+		if c.Dir == "" {
+			return errors.New("SECRETS_DIR is required by the file secrets provider")
+		}
+	case "vault":
+		if c.VaultAddr == "" || c.VaultPath == "" {
+			return errors.New("VAULT_ADDR and VAULT_SECRET_PATH are required by the vault secrets provider")
+		}
+	case "aws":
+		if c.AWSRegion == "" || c.AWSSecretID == "" {
+			return errors.New("AWS_REGION and AWS_SECRET_ID are required by the aws secrets provider")
+		}
+	default:
+		return fmt.Errorf("SECRETS_PROVIDER must be env, file, vault or aws, got %q", c.Provider)
+	}
+	return nil
+}
+
+// ApplyKeys installs the configured signing keys in the token package.
+func (c *Config) ApplyKeys() {
+	utils.SetKeys(c.Secret.Current, c.Secret.Previous...)
+	utils.AcceptLegacyTokens(c.Secret.AcceptV1Tokens)
+}
+
+// getEnv returns the environment variable, or the value of the configuration file, or a fallback default.
 func getEnv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
+	if v := lookupSetting(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// publicScheme returns the default scheme of absolute URLs: https except for local development.
+func publicScheme(secure bool) string {
+	if secure {
+		return "https"
+	}
+	return "http"
+}
+
+// previewPattern returns the preview host pattern from the environment, "none" disabling previews.
+func previewPattern() string {
+	if p := getEnv("TENANT_PREVIEW_PATTERN", "{sub}-preview"); p != "none" {
+		return strings.ToLower(p)
+	}
+	return ""
+}
+
+// cookiePrefix returns the cookie name prefix from the environment: "__Host-" by default for
+// secure cookies, or "__Secure-" when they carry a domain, which __Host- forbids; "none" disables
+// it. Prefixes are only used on secure cookies since browsers reject them otherwise.
+func cookiePrefix(key string, secure bool, domain string) string {
+	if !secure {
+		return ""
+	}
+	def := HostPrefix
+	if domain != "" && domain != TenantCookieDomain {
+		def = SecurePrefix
+	}
+	switch p := getEnv(key, def); p {
+	case HostPrefix, SecurePrefix:
+		return p
+	}
+	return ""
+}
+
+// getEnvList returns a comma-separated environment variable as a slice.
+func getEnvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(lookupSetting(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// getEnvListDefault is getEnvList with a fallback when the variable is unset or empty.
+func getEnvListDefault(key string, fallback []string) []string {
+	if v := getEnvList(key); len(v) > 0 {
 		return v
 	}
 	return fallback
@@ -93,7 +824,7 @@ func getEnv(key, fallback string) string {
 
 // getEnvBool returns a boolean environment variable or a fallback.
 func getEnvBool(key string, fallback bool) bool {
-	if v := os.Getenv(key); v != "" {
+	if v := lookupSetting(key); v != "" {
 		b, err := strconv.ParseBool(v)
 		if err == nil {
 			return b
@@ -101,3 +832,33 @@ func getEnvBool(key string, fallback bool) bool {
 	}
 	return fallback
 }
+
+// getEnvInt returns an integer environment variable or a fallback.
+func getEnvInt(key string, fallback int) int {
+	if v := lookupSetting(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+// getEnvDuration returns a duration environment variable such as "90s" or a fallback.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v := lookupSetting(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
+// APIRateLimit returns the requests per minute allowed for a tier, falling back to the default tier.
+func (c *Config) APIRateLimit(tier string) int {
+	if n, ok := c.API.Tiers[tier]; ok {
+		return n
+	}
+	return c.API.Tiers[c.API.DefaultTier]
+}
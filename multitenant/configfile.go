@@ -0,0 +1,312 @@
+package multitenant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultConfigFiles are the configuration files LoadDefaultConfig reads when TENKIT_CONFIG is unset,
+// the first existing one winning.
+var DefaultConfigFiles = []string{"tenkit.yaml", "tenkit.yml", "tenkit.toml"}
+
+// A configuration file sets the same settings as the environment variables, nested by their
+// underscore-separated parts: APP_DOMAIN is
+//
+//	app:
+//	  domain: example.com
+//
+// in YAML and "[app] domain = ..." in TOML, with lists for comma-separated values. Environment
+// variables override the file, so deployments keep secrets out of it.
+var (
+	fileMu     sync.RWMutex
+	fileValues map[string]string // By environment variable name
+	fileErr    error             // Reported by Validate
+	fileName   string
+	knownKeys  = map[string]bool{} // Settings read by LoadDefaultConfig, to report unknown file keys
+)
+
+// LoadConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) configuration file whose values apply
+// to the settings not set in the environment. It replaces the values of a previous file.
+func LoadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		values, err = parseYAML(data)
+	case ".toml":
+		values, err = parseTOML(data)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, want .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	fileMu.Lock()
+	fileValues, fileName = values, path
+	fileMu.Unlock()
+	slog.Info("[CONFIG] Configuration file loaded", "file", path, "settings", len(values))
+	return nil
+}
+
+// loadDefaultConfigFile loads TENKIT_CONFIG, or the first of DefaultConfigFiles that exists. Its
+// error is kept for Validate, so that a broken file stops the application.
+func loadDefaultConfigFile() {
+	path := os.Getenv("TENKIT_CONFIG")
+	if path == "" {
+		for _, name := range DefaultConfigFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+	if path == "" {
+		return
+	}
+	err := LoadConfigFile(path)
+	fileMu.Lock()
+	fileErr = err
+	fileMu.Unlock()
+}
+
+// lookupSetting returns a setting from the environment, then from the configuration file.
+func lookupSetting(key string) string {
+	fileMu.Lock()
+	knownKeys[key] = true
+	v := fileValues[key]
+	fileMu.Unlock()
+	if env := os.Getenv(key); env != "" {
+		return env
+	}
+	return v
+}
+
+// validateConfigFile reports a configuration file that failed to load or sets unknown settings,
+// usually typos that would otherwise be ignored.
+func validateConfigFile() error {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+	if fileErr != nil {
+		return fileErr
+	}
+	var unknown []string
+	for key := range fileValues {
+		if !knownKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("config file %s: unknown settings %s", fileName, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// settingKey turns the path of a file value into its environment variable name.
+func settingKey(parts []string) string {
+	key := strings.Join(parts, "_")
+	key = strings.NewReplacer("-", "_", ".", "_").Replace(key)
+	return strings.ToUpper(key)
+}
+
+// parseYAML reads the subset of YAML configuration files use: nested mappings by indentation,
+// scalars (plain, single or double quoted), and lists as "- item" lines or [a, b] flows.
+func parseYAML(data []byte) (map[string]string, error) {
+	type level struct {
+		indent int
+		path   []string
+	}
+	values := map[string]string{}
+	stack := []level{{indent: -1}}
+	var listKey string // Setting receiving "- item" lines
+	listIndent := -1
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		raw := strings.TrimRight(sc.Text(), " \t\r")
+		line := strings.TrimSpace(stripComment(raw))
+		if line == "" || line == "---" {
+			continue
+		}
+		if strings.HasPrefix(raw, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		indent := len(raw) - len(strings.TrimLeft(raw, " "))
+
+		if item, ok := strings.CutPrefix(line, "- "); ok || line == "-" {
+			if listKey == "" || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item outside a list", n)
+			}
+			v, err := yamlScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if values[listKey] != "" {
+				values[listKey] += ","
+			}
+			values[listKey] += v
+			continue
+		}
+		listKey, listIndent = "", -1
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: want \"key: value\"", n)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		value = strings.TrimSpace(value)
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+		path := append(append([]string{}, stack[len(stack)-1].path...), key)
+
+		switch {
+		case value == "":
+			// A mapping or a list follows
+			stack = append(stack, level{indent: indent, path: path})
+			listKey, listIndent = settingKey(path), indent
+		case value == "|" || value == ">" || strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*"):
+			return nil, fmt.Errorf("line %d: block scalars, anchors and aliases are not supported", n)
+		case strings.HasPrefix(value, "["):
+			items, err := flowList(value, yamlScalar)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			values[settingKey(path)] = items
+		default:
+			v, err := yamlScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			values[settingKey(path)] = v
+		}
+	}
+	return values, sc.Err()
+}
+
+// parseTOML reads the subset of TOML configuration files use: [section.sub] tables and key = value
+// pairs with strings, numbers, booleans and arrays of them.
+func parseTOML(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	var section []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: want a [table] header", n)
+			}
+			section = strings.Split(strings.TrimSpace(line[1:len(line)-1]), ".")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", n)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		value = strings.TrimSpace(value)
+		path := append(append([]string{}, section...), strings.Split(key, ".")...)
+
+		var v string
+		var err error
+		switch {
+		case strings.HasPrefix(value, "{"):
+			err = fmt.Errorf("inline tables are not supported")
+		case strings.HasPrefix(value, "["):
+			v, err = flowList(value, tomlScalar)
+		default:
+			v, err = tomlScalar(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[settingKey(path)] = v
+	}
+	return values, sc.Err()
+}
+
+// stripComment removes a # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// flowList joins the items of a [a, "b", c] list with commas, as in comma-separated variables.
+func flowList(value string, scalar func(string) (string, error)) (string, error) {
+	if !strings.HasSuffix(value, "]") {
+		return "", fmt.Errorf("unterminated list %s", value)
+	}
+	var items []string
+	for _, item := range strings.Split(value[1:len(value)-1], ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, v)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// yamlScalar unquotes a YAML scalar; plain scalars are taken as they are.
+func yamlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value == "~" || value == "null":
+		return "", nil
+	}
+	return value, nil
+}
+
+// tomlScalar unquotes a TOML string; numbers and booleans are taken as they are.
+func tomlScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err != nil {
+		return "", fmt.Errorf("invalid value %s: strings must be quoted", value)
+	}
+	return strings.ReplaceAll(value, "_", ""), nil
+}
@@ -0,0 +1,32 @@
+package multitenant
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Cookie name prefixes understood by browsers (RFC 6265bis). A prefixed cookie is only
+// accepted when its attributes meet the prefix requirements.
+const (
+	HostPrefix   = "__Host-"   // Secure, Path=/ and no Domain: bound to the exact host
+	SecurePrefix = "__Secure-" // Secure
+)
+
+// ApplyCookiePrefix enforces the attributes required by the cookie's name prefix, so that
+// browsers do not silently drop it. Call it on every cookie before setting it.
+func ApplyCookiePrefix(c *http.Cookie) *http.Cookie {
+	switch {
+	case strings.HasPrefix(c.Name, HostPrefix):
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	case strings.HasPrefix(c.Name, SecurePrefix):
+		c.Secure = true
+	}
+	return c
+}
+
+// TenantCookieDomain as CookieConfig.Domain scopes cookies to the exact host of the tenant serving
+// the request: they get no Domain attribute, as one would send them to the subdomains of the host,
+// where sub-tenants are served. Tenants, parents and sub-tenants never share them.
+const TenantCookieDomain = "tenant"
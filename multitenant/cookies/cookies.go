@@ -0,0 +1,86 @@
+// Package cookies sets the cookies of tenkit from their configuration, so that they all get the
+// same attributes: Path=/, HttpOnly, Secure, SameSite, Partitioned, the configured domain and
+// the requirements of the __Host- and __Secure- name prefixes.
+//
+//	cookies.Set(w, r, cfg.SessionCookie, token, cfg.TokenExpiry)
+//	cookies.Clear(w, r, cfg.SessionCookie)
+//
+// A cookie is only cleared by a cookie with the same name, domain and path, which is why clearing
+// goes through the same configuration as setting.
+//
+// Signed and encrypted cookies carry client state the server must be able to trust, such as the
+// language, flash messages or the state of an OAuth flow. Values are bound to the cookie name and
+// to their expiry, and checked against every key of the ring (TENKIT_SECRET and
+// TENKIT_SECRET_PREVIOUS), so cookies set before a key rotation stay valid. A tampered, expired or
+// unsigned cookie reads as missing.
+//
+//	cookies.SetSigned(w, r, cookies.Lang(cfg), "fr", 0)
+//	lang, ok := cookies.Signed(r, cookies.LangName)
+//	err := cookies.SetEncrypted(w, r, cc, state, 10*time.Minute)
+//	state, ok := cookies.Encrypted(r, cc.Name)
+package cookies
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// LangName is the cookie keeping the language picked by a visitor, signed (see SetSigned).
+const LangName = "lang"
+
+// New returns the cookie of cc carrying value for r. It lasts maxAge, or cc.MaxAge when maxAge is
+// zero; a negative maxAge deletes it.
+func New(r *http.Request, cc multitenant.CookieConfig, value string, maxAge time.Duration) *http.Cookie {
+	if maxAge == 0 {
+		maxAge = cc.MaxAge
+	}
+	c := &http.Cookie{
+		Name:     cc.Name,
+		Value:    value,
+		Path:     "/",
+		Domain:   Domain(cc.Domain),
+		HttpOnly: true,
+		Secure:   cc.Secure,
+		SameSite: cc.SameSite,
+	}
+	switch {
+	case maxAge < 0:
+		c.MaxAge = -1
+	case maxAge > 0:
+		c.MaxAge = int(maxAge.Seconds())
+	}
+	multitenant.ApplyCookiePrefix(c)
+	// Browsers drop partitioned cookies that are not secure
+	c.Partitioned = cc.Partitioned && c.Secure
+	return c
+}
+
+// Set sets the cookie of cc to value, see New.
+func Set(w http.ResponseWriter, r *http.Request, cc multitenant.CookieConfig, value string, maxAge time.Duration) {
+	http.SetCookie(w, New(r, cc, value, maxAge))
+}
+
+// Clear deletes the cookie of cc.
+func Clear(w http.ResponseWriter, r *http.Request, cc multitenant.CookieConfig) {
+	http.SetCookie(w, New(r, cc, "", -1))
+}
+
+// Lang returns the settings of the language cookie, which follows the session cookie but keeps
+// the choice for a year.
+func Lang(cfg *multitenant.Config) multitenant.CookieConfig {
+	cc := cfg.SessionCookie
+	cc.Name = LangName
+	cc.MaxAge = 365 * 24 * time.Hour
+	return cc
+}
+
+// Domain returns the Domain attribute for the configured domain: none for "" and for
+// multitenant.TenantCookieDomain, whose cookies stay on the host of the tenant, or domain itself.
+func Domain(domain string) string {
+	if domain == multitenant.TenantCookieDomain {
+		return ""
+	}
+	return domain
+}
@@ -0,0 +1,123 @@
+package cookies
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// SetSigned sets the cookie of cc to value with a signature, see New. The value stays readable by
+// the client; use SetEncrypted to hide it.
+func SetSigned(w http.ResponseWriter, r *http.Request, cc multitenant.CookieConfig, value string, maxAge time.Duration) {
+	http.SetCookie(w, New(r, cc, Sign(cc.Name, value, expiry(cc, maxAge)), maxAge))
+}
+
+// Signed returns the value of the signed cookie name, and false when it is missing, tampered with
+// or expired.
+func Signed(r *http.Request, name string) (string, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return Verify(name, c.Value)
+}
+
+// SetEncrypted sets the cookie of cc to value, encrypted and authenticated, see New.
+func SetEncrypted(w http.ResponseWriter, r *http.Request, cc multitenant.CookieConfig, value string, maxAge time.Duration) error {
+	sealed, err := Encrypt(cc.Name, value, expiry(cc, maxAge))
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, New(r, cc, sealed, maxAge))
+	return nil
+}
+
+// Encrypted returns the value of the encrypted cookie name, and false when it is missing, tampered
+// with or expired.
+func Encrypted(r *http.Request, name string) (string, bool) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return Decrypt(name, c.Value)
+}
+
+// Sign returns the value of the cookie name signed until expires, "<expiry>.<value>.<signature>"
+// in base64. A zero expires signs it for as long as the browser keeps it.
+func Sign(name, value string, expires time.Time) string {
+	payload := stamp(expires) + "." + base64.RawURLEncoding.EncodeToString([]byte(value))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(utils.MAC(macInput(name, payload)))
+}
+
+// Verify returns the value of a cookie signed by Sign for the same name, unless it expired.
+func Verify(name, signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	payload := signed[:i]
+	mac, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil || !utils.VerifyMAC(macInput(name, payload), mac) {
+		return "", false
+	}
+	exp, encoded, ok := strings.Cut(payload, ".")
+	if !ok || expired(exp) {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+// Encrypt returns the value of the cookie name encrypted until expires.
+func Encrypt(name, value string, expires time.Time) (string, error) {
+	return utils.Seal(macInput(name, ""), []byte(stamp(expires)+"."+value))
+}
+
+// Decrypt returns the value of a cookie encrypted by Encrypt for the same name, unless it expired.
+func Decrypt(name, sealed string) (string, bool) {
+	plaintext, ok := utils.Open(macInput(name, ""), sealed)
+	if !ok {
+		return "", false
+	}
+	exp, value, ok := strings.Cut(string(plaintext), ".")
+	if !ok || expired(exp) {
+		return "", false
+	}
+	return value, true
+}
+
+// expiry returns when a cookie of cc set for maxAge expires, zero for a session cookie.
+func expiry(cc multitenant.CookieConfig, maxAge time.Duration) time.Time {
+	if maxAge == 0 {
+		maxAge = cc.MaxAge
+	}
+	if maxAge <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(maxAge)
+}
+
+func stamp(expires time.Time) string {
+	if expires.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(expires.Unix(), 10)
+}
+
+func expired(stamp string) bool {
+	exp, err := strconv.ParseInt(stamp, 10, 64)
+	return err != nil || (exp != 0 && time.Now().Unix() > exp)
+}
+
+// macInput binds a signed value to its cookie, so that it cannot be replayed in another one.
+func macInput(name, payload string) string {
+	return "cookie|" + name + "|" + payload
+}
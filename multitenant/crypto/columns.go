@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Column is an encrypted column of a table with a tenant_id column. Rotate re-encrypts the columns
+// registered with RegisterColumn, and tenant archives carry them decrypted.
+type Column struct {
+	Table  string // e.g. "users"
+	Column string // e.g. "totp_secret"
+	Key    string // Column identifying the rows, e.g. "id"
+}
+
+// Field returns the field name the values of the column are encrypted for, "<table>.<column>".
+func (c Column) Field() string {
+	return c.Table + "." + c.Column
+}
+
+// Encrypt seals a value of the column for a tenant.
+func (c Column) Encrypt(ctx context.Context, tenantID int64, plaintext string) (string, error) {
+	return EncryptString(ctx, tenantID, c.Field(), plaintext)
+}
+
+// Decrypt opens a value of the column of a tenant.
+func (c Column) Decrypt(ctx context.Context, tenantID int64, value string) (string, error) {
+	return DecryptString(ctx, tenantID, c.Field(), value)
+}
+
+// DKIMKey holds the private keys of the custom sending domains of tenants.
+var DKIMKey = Column{Table: "tenant_email_domains", Column: "private_key", Key: "tenant_id"}
+
+var (
+	columnsMu sync.RWMutex
+	columns   = []Column{DKIMKey}
+)
+
+// RegisterColumn declares an encrypted column of the application, e.g. API tokens of an
+// integration, so that Rotate re-encrypts it. Registering a column again has no effect.
+func RegisterColumn(c Column) {
+	columnsMu.Lock()
+	defer columnsMu.Unlock()
+	for _, existing := range columns {
+		if existing == c {
+			return
+		}
+	}
+	columns = append(columns, c)
+}
+
+// Columns returns the encrypted columns: the built-in ones, then the registered ones.
+func Columns() []Column {
+	columnsMu.RLock()
+	defer columnsMu.RUnlock()
+	return append([]Column{}, columns...)
+}
+
+// EncryptColumns encrypts the values of the registered columns of a tenant with its active data key,
+// those not encrypted yet and, with all, those of retired keys too. It returns how many values it
+// wrote. A value changed meanwhile by the application is left as written.
+func EncryptColumns(ctx context.Context, tenantID int64, all bool) (int, error) {
+	active, _, err := activeKey(ctx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range Columns() {
+		values, err := models.ColumnValues(ctx, c.Table, c.Key, c.Column, tenantID)
+		if err != nil {
+			return n, fmt.Errorf("crypto: %s: %w", c.Field(), err)
+		}
+		for _, v := range values {
+			if IsEncrypted(v.Value) && (!all || keyID(v.Value) == active) {
+				continue
+			}
+			plaintext, err := c.Decrypt(ctx, tenantID, v.Value)
+			if err != nil {
+				return n, fmt.Errorf("crypto: %s of %v: %w", c.Field(), v.Key, err)
+			}
+			sealed, err := c.Encrypt(ctx, tenantID, plaintext)
+			if err != nil {
+				return n, err
+			}
+			if err := models.SetColumnValue(ctx, c.Table, c.Key, c.Column, tenantID, v.Key, v.Value, sealed); err != nil {
+				return n, fmt.Errorf("crypto: %s of %v: %w", c.Field(), v.Key, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Rotate gives a tenant a new data key and re-encrypts its registered columns with it, returning
+// how many values it re-encrypted. The retired keys still decrypt the values of other columns
+// until DropRetired deletes them.
+func Rotate(ctx context.Context, tenantID int64) (int, error) {
+	key, wrapped, masterID, err := newDataKey(tenantID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := models.RotateDataKey(ctx, tenantID, wrapped, masterID)
+	if err != nil {
+		return 0, err
+	}
+	cacheKey(id, key)
+	slog.InfoContext(ctx, "[CRYPTO] Data key rotated", "tenant_id", tenantID, "key_id", id)
+	return EncryptColumns(ctx, tenantID, true)
+}
+
+// DropRetired deletes the retired data keys of a tenant. Values they encrypted, outside the
+// columns Rotate re-encrypted, can no longer be read.
+func DropRetired(ctx context.Context, tenantID int64) (int64, error) {
+	n, err := models.DeleteRetiredDataKeys(ctx, tenantID)
+	if err == nil && n > 0 {
+		forgetKeys()
+	}
+	return n, err
+}
+
+// Rewrap wraps every data key that another master key wrapped with the current master key, after
+// TENKIT_MASTER_KEY changed, and returns how many it rewrapped. The values stay as they are. The
+// replaced master key can be removed from TENKIT_MASTER_KEY_PREVIOUS once it ran.
+func Rewrap(ctx context.Context) (int, error) {
+	keys, err := models.ListDataKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	currentID := MasterKeyID()
+	n := 0
+	for i := range keys {
+		k := &keys[i]
+		if k.MasterKeyID == currentID {
+			continue
+		}
+		key, err := unwrapCached(k)
+		if err != nil {
+			return n, err
+		}
+		wrapped, masterID, err := wrap(k.TenantID, key)
+		if err != nil {
+			return n, err
+		}
+		if err := models.RewrapDataKey(ctx, k.ID, wrapped, masterID); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "[CRYPTO] Data keys rewrapped", "count", n, "master_key_id", currentID)
+	}
+	return n, nil
+}
+
+// keyID returns the ID of the data key that encrypted a value, 0 when it is not encrypted.
+func keyID(value string) int64 {
+	var id int64
+	fmt.Sscanf(value[min(len(value), len(prefix)):], "%d:", &id)
+	return id
+}
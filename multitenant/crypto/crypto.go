@@ -0,0 +1,294 @@
+// Package crypto encrypts sensitive columns with per-tenant data keys (envelope encryption). Each
+// tenant gets a random AES-256 data key on its first encrypted value, stored in tenant_data_keys
+// wrapped by the master key (TENKIT_MASTER_KEY, from the secrets provider), so that the database
+// alone does not reveal the values and purging a tenant's keys makes its encrypted data unreadable.
+//
+//	sealed, err := crypto.EncryptString(ctx, tenantID, "users.totp_secret", secret)
+//	secret, err := crypto.DecryptString(ctx, tenantID, "users.totp_secret", sealed)
+//
+// Values are bound to their tenant and field: a value copied to another row or tenant does not
+// decrypt. Values written before a column was encrypted read back unchanged, and Rotate encrypts
+// them along with the values of the previous data key. Production requires TENKIT_MASTER_KEY (see
+// multitenant.ErrNoMasterKey); in dev mode, one is derived from TENKIT_SECRET. To move to a new
+// master key, keep the replaced one in TENKIT_MASTER_KEY_PREVIOUS and run Rewrap (tenkit keys
+// rewrap). Nothing is encrypted before Configure installs the keys.
+package crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// prefix marks encrypted values: "enc:v1:<data key ID>:<base64 nonce and ciphertext>".
+const prefix = "enc:v1:"
+
+var (
+	ErrNoKey     = errors.New("crypto: data key not found") // Deleted, or wrapped by an unknown master key
+	ErrNoMaster  = errors.New("crypto: no master key, call Configure first")
+	ErrDecrypt   = errors.New("crypto: value does not decrypt")
+	ErrNoTenant  = errors.New("crypto: value belongs to another tenant")
+	errMalformed = errors.New("crypto: malformed value")
+)
+
+// masterKey is a master key stretched to an AES-256 key, with the ID recorded by the data keys it wraps.
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+func newMasterKey(secret string) masterKey {
+	k := sha256.Sum256([]byte("tenkit-master-key|" + secret))
+	id := sha256.Sum256(k[:])
+	return masterKey{id: hex.EncodeToString(id[:8]), key: k[:]}
+}
+
+var (
+	mu       sync.RWMutex
+	current  masterKey // Zero until Configure
+	previous []masterKey
+	dataKeys = map[int64][]byte{} // Unwrapped data keys by ID
+)
+
+// Configure installs the master keys of cfg: TENKIT_MASTER_KEY wraps new data keys, and the previous
+// master keys, as well as those derived from the signing keys before a master key was required,
+// still unwrap the existing ones. Without TENKIT_MASTER_KEY, only allowed in dev mode, the key is
+// derived from TENKIT_SECRET.
+func Configure(cfg *multitenant.Config) {
+	var keys []masterKey
+	for _, k := range cfg.Crypto.PreviousMasterKeys {
+		keys = append(keys, newMasterKey(k))
+	}
+	for _, k := range append([]string{cfg.Secret.Current}, cfg.Secret.Previous...) {
+		keys = append(keys, newMasterKey(k))
+	}
+	cur := cfg.Crypto.MasterKey
+	if cur == "" {
+		cur = cfg.Secret.Current // Dev mode only, see multitenant.ErrNoMasterKey
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	current, previous = newMasterKey(cur), keys
+}
+
+// MasterKeyID returns the ID of the current master key, as recorded by the data keys it wrapped.
+func MasterKeyID() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.id
+}
+
+// IsEncrypted reports whether a stored value was written by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt seals plaintext for the field (e.g. "users.totp_secret") of a tenant, 0 for platform
+// data, with its active data key, created on first use.
+func Encrypt(ctx context.Context, tenantID int64, field string, plaintext []byte) (string, error) {
+	id, key, err := activeKey(ctx, tenantID)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(key, plaintext, aad(tenantID, id, field))
+	if err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatInt(id, 10) + ":" + sealed, nil
+}
+
+// Decrypt opens a value sealed by Encrypt for the same tenant and field. A value that is not
+// encrypted, written before the column was, is returned as is.
+func Decrypt(ctx context.Context, tenantID int64, field, value string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return []byte(value), nil
+	}
+	idText, sealed, ok := strings.Cut(rest, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if !ok || err != nil {
+		return nil, errMalformed
+	}
+	key, keyTenant, err := dataKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if keyTenant != tenantID {
+		return nil, ErrNoTenant
+	}
+	return open(key, sealed, aad(tenantID, id, field))
+}
+
+// EncryptString is Encrypt for text values. The empty string stays empty, for optional columns.
+func EncryptString(ctx context.Context, tenantID int64, field, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	return Encrypt(ctx, tenantID, field, []byte(plaintext))
+}
+
+// DecryptString is Decrypt for text values.
+func DecryptString(ctx context.Context, tenantID int64, field, value string) (string, error) {
+	b, err := Decrypt(ctx, tenantID, field, value)
+	return string(b), err
+}
+
+// aad binds a value to its tenant, data key and field.
+func aad(tenantID, keyID int64, field string) []byte {
+	return fmt.Appendf(nil, "%d|%d|%s", tenantID, keyID, field)
+}
+
+// activeKey returns the active data key of a tenant, creating it on first use.
+func activeKey(ctx context.Context, tenantID int64) (int64, []byte, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		k, err := models.GetActiveDataKey(ctx, tenantID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if k != nil {
+			key, err := unwrapCached(k)
+			return k.ID, key, err
+		}
+		key, wrapped, masterID, err := newDataKey(tenantID)
+		if err != nil {
+			return 0, nil, err
+		}
+		id, err := models.CreateDataKey(ctx, tenantID, wrapped, masterID)
+		if errors.Is(err, models.ErrDataKeyExists) {
+			continue // Created by a concurrent request: use that one
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		slog.InfoContext(ctx, "[CRYPTO] Data key created", "tenant_id", tenantID, "key_id", id)
+		cacheKey(id, key)
+		return id, key, nil
+	}
+	return 0, nil, ErrNoKey
+}
+
+// dataKey returns a data key by ID and its tenant.
+func dataKey(ctx context.Context, id int64) ([]byte, int64, error) {
+	k, err := models.GetDataKey(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if k == nil {
+		return nil, 0, ErrNoKey
+	}
+	key, err := unwrapCached(k)
+	return key, k.TenantID, err
+}
+
+// newDataKey returns a random data key for a tenant and its form wrapped by the current master key.
+func newDataKey(tenantID int64) (key []byte, wrapped, masterID string, err error) {
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", "", err
+	}
+	wrapped, masterID, err = wrap(tenantID, key)
+	return key, wrapped, masterID, err
+}
+
+// wrap seals a data key of a tenant with the current master key.
+func wrap(tenantID int64, key []byte) (wrapped, masterID string, err error) {
+	mu.RLock()
+	m := current
+	mu.RUnlock()
+	if m.key == nil {
+		return "", "", ErrNoMaster
+	}
+	wrapped, err = seal(m.key, key, fmt.Appendf(nil, "data-key|%d", tenantID))
+	return wrapped, m.id, err
+}
+
+// unwrapCached returns the data key k, unwrapped by the master key that wrapped it.
+func unwrapCached(k *models.DataKey) ([]byte, error) {
+	mu.RLock()
+	key, ok := dataKeys[k.ID]
+	m := append([]masterKey{current}, previous...)
+	mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	for _, mk := range m {
+		if mk.id != k.MasterKeyID {
+			continue
+		}
+		key, err := open(mk.key, k.WrappedKey, fmt.Appendf(nil, "data-key|%d", k.TenantID))
+		if err != nil {
+			return nil, err
+		}
+		cacheKey(k.ID, key)
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: key %d is wrapped by an unknown master key %s", ErrNoKey, k.ID, k.MasterKeyID)
+}
+
+func cacheKey(id int64, key []byte) {
+	mu.Lock()
+	dataKeys[id] = key
+	mu.Unlock()
+}
+
+// forgetKeys drops unwrapped data keys from the cache, after they were deleted.
+func forgetKeys() {
+	mu.Lock()
+	dataKeys = map[int64][]byte{}
+	mu.Unlock()
+}
+
+// seal encrypts plaintext with AES-256-GCM and returns the nonce and ciphertext in base64.
+func seal(key, plaintext, additional []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, additional)), nil
+}
+
+// open decrypts a value produced by seal.
+func open(key []byte, sealed string, additional []byte) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, errMalformed
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errMalformed
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,72 @@
+package multitenant
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// DomainVerifyPrefix is prepended to a custom domain to name its verification TXT record.
+const DomainVerifyPrefix = "_tenkit-verify."
+
+// CustomDomainResolver resolves tenant subdomains like SubdomainResolver and, for any other
+// host, the tenant whose verified custom domain matches the full host.
+type CustomDomainResolver struct {
+	Config *Config
+}
+
+func (c CustomDomainResolver) Resolve(r *http.Request) (string, error) {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	root := c.Config.Domain
+	if h, _, err := net.SplitHostPort(root); err == nil {
+		root = h
+	}
+	if host == root || strings.HasSuffix(host, "."+root) {
+		return SubdomainResolver{Config: c.Config}.Resolve(r)
+	}
+
+	sub, err := models.GetSubdomainByCustomDomain(r.Context(), host)
+	if err != nil {
+		return "", err
+	}
+	if sub == "" {
+		return "", fmt.Errorf("unknown custom domain: %s", host)
+	}
+	return sub, nil
+}
+
+// DomainVerifyRecord returns the TXT record name and value proving control of domain.
+func DomainVerifyRecord(domain, token string) (name, value string) {
+	return DomainVerifyPrefix + domain, "tenkit-verify=" + token
+}
+
+// LookupCNAME and LookupTXT are the DNS resolvers used by VerifyCustomDomain; custom setups may replace them.
+var (
+	LookupCNAME = net.DefaultResolver.LookupCNAME
+	LookupTXT   = net.DefaultResolver.LookupTXT
+)
+
+// VerifyCustomDomain checks that domain either publishes the verification TXT record or is
+// a CNAME to target, the tenant's own host under the root domain.
+func VerifyCustomDomain(ctx context.Context, domain, token, target string) error {
+	name, value := DomainVerifyRecord(domain, token)
+	if records, err := LookupTXT(ctx, name); err == nil {
+		for _, r := range records {
+			if strings.TrimSpace(r) == value {
+				return nil
+			}
+		}
+	}
+	cname, err := LookupCNAME(ctx, domain)
+	if err == nil && strings.EqualFold(strings.TrimSuffix(cname, "."), target) {
+		return nil
+	}
+	return fmt.Errorf("no %s TXT record matching the token and no CNAME to %s", name, target)
+}
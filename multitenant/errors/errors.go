@@ -0,0 +1,135 @@
+// Package errors passes the failures of requests, such as panics and 5xx responses, to an error
+// tracker. The middleware fills a Report with the stack trace, request, tenant and user, and Capture
+// hands it to the installed Reporter: a no-op by default, or the Sentry adapter of this package.
+//
+//	errors.SetReporter(sentry) // tenkit.New does it when SENTRY_DSN is set
+//
+// Import it under another name next to the standard errors package, e.g. tkerrors.
+package errors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Report is a failure to report, with the metadata of the request it happened in.
+type Report struct {
+	Err       error
+	Panic     bool            // Err is a *PanicError recovered from a handler
+	Stack     []runtime.Frame // Innermost call first
+	Request   *http.Request   // nil outside requests
+	RequestID string
+	TenantID  int64 // 0 on the root domain
+	Tenant    string
+	UserID    int64 // 0 for anonymous requests
+	UserEmail string
+	IP        string // Client address
+	Time      time.Time
+}
+
+// Reporter sends reports to an error tracker. Report runs in the failing request and must not
+// block; adapters queue the reports and send them in the background.
+type Reporter interface {
+	Report(ctx context.Context, rep Report)
+}
+
+// ReporterFunc adapts a function to Reporter.
+type ReporterFunc func(ctx context.Context, rep Report)
+
+func (f ReporterFunc) Report(ctx context.Context, rep Report) { f(ctx, rep) }
+
+// Nop discards reports; it is the default Reporter.
+type Nop struct{}
+
+func (Nop) Report(context.Context, Report) {}
+
+type holder struct{ Reporter }
+
+var current atomic.Value // holder
+
+func init() {
+	current.Store(holder{Nop{}})
+}
+
+// SetReporter installs r for every report; nil restores Nop.
+func SetReporter(r Reporter) {
+	if r == nil {
+		r = Nop{}
+	}
+	current.Store(holder{r})
+}
+
+// Current returns the installed Reporter.
+func Current() Reporter {
+	return current.Load().(holder).Reporter
+}
+
+// PanicError is the error of a recovered panic.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Capture sends rep to the installed Reporter, with the current time and stack when rep has none.
+// A panicking Reporter is logged and never breaks the request.
+func Capture(ctx context.Context, rep Report) {
+	if rep.Err == nil {
+		return
+	}
+	if rep.Time.IsZero() {
+		rep.Time = time.Now()
+	}
+	if rep.Stack == nil {
+		rep.Stack = Stack(1)
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(ctx, "[ERRORS] Reporter panicked", "panic", v)
+		}
+	}()
+	Current().Report(ctx, rep)
+}
+
+// Stack returns the stack of the caller, innermost call first, skipping skip more frames. Called
+// in a deferred recover, it starts at the function that panicked.
+func Stack(skip int) []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []runtime.Frame
+	for {
+		f, more := frames.Next()
+		out = append(out, f)
+		if !more {
+			break
+		}
+	}
+	// Drop the deferred function and the panic machinery above the panicking function
+	for i, f := range out {
+		if f.Function == "runtime.gopanic" {
+			out = out[i+1:]
+			for len(out) > 1 && strings.HasPrefix(out[0].Function, "runtime.") {
+				out = out[1:]
+			}
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,259 @@
+package errors
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant/logging"
+)
+
+// SentryOptions tunes a Sentry reporter.
+type SentryOptions struct {
+	Environment string   // e.g. "prod"
+	Release     string   // Version of the application, e.g. a git SHA
+	ServerName  string   // Defaults to the host name
+	Redact      []string // Query parameters whose values are masked, e.g. TENKIT_LOG_REDACT
+	Client      *http.Client
+	QueueSize   int // Reports waiting to be sent; more are dropped. Defaults to 100.
+}
+
+// Sentry sends reports to Sentry, or to any service speaking its envelope protocol such as
+// GlitchTip, from a background goroutine.
+type Sentry struct {
+	endpoint string
+	auth     string
+	opts     SentryOptions
+	queue    chan []byte
+	pending  sync.WaitGroup
+}
+
+// sentryHeaders are the request headers sent with reports; cookies and credentials are left out.
+var sentryHeaders = []string{"Accept", "Accept-Language", "Content-Type", "Host", "Referer", "User-Agent"}
+
+// NewSentry returns a reporter for a project DSN, https://<key>@<host>/<project>.
+func NewSentry(dsn string, opts SentryOptions) (*Sentry, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN, want https://<key>@<host>/<project>")
+	}
+	dir, project := path.Split(strings.TrimSuffix(u.Path, "/"))
+	if _, err := strconv.ParseUint(project, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: no project ID")
+	}
+	if opts.ServerName == "" {
+		opts.ServerName, _ = os.Hostname()
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	s := &Sentry{
+		endpoint: fmt.Sprintf("%s://%s%sapi/%s/envelope/", u.Scheme, u.Host, dir, project),
+		auth:     "Sentry sentry_version=7, sentry_client=tenkit/1, sentry_key=" + u.User.Username(),
+		opts:     opts,
+		queue:    make(chan []byte, opts.QueueSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report queues rep, or drops it when the queue is full.
+func (s *Sentry) Report(ctx context.Context, rep Report) {
+	id := eventID()
+	event, err := json.Marshal(s.event(id, rep))
+	if err != nil {
+		slog.ErrorContext(ctx, "[ERRORS] Failed to encode the Sentry event", "err", err)
+		return
+	}
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": id, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	body.Write(header)
+	body.WriteString("\n")
+	item, _ := json.Marshal(map[string]any{"type": "event", "length": len(event)})
+	body.Write(item)
+	body.WriteString("\n")
+	body.Write(event)
+	body.WriteString("\n")
+
+	s.pending.Add(1)
+	select {
+	case s.queue <- body.Bytes():
+	default:
+		s.pending.Done()
+		slog.WarnContext(ctx, "[ERRORS] Sentry queue full, report dropped", "event_id", id)
+	}
+}
+
+// Flush waits until the queued reports are sent, at most timeout; call it before exiting.
+func (s *Sentry) Flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *Sentry) run() {
+	for body := range s.queue {
+		s.send(body)
+		s.pending.Done()
+	}
+}
+
+func (s *Sentry) send(body []byte) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("[ERRORS] Failed to build the Sentry request", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		slog.Error("[ERRORS] Failed to send the report to Sentry", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Error("[ERRORS] Sentry refused the report", "status", resp.StatusCode)
+	}
+}
+
+// sentryFrame is a frame of a Sentry stack trace.
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// event builds the Sentry event of a report; secrets and sensitive query parameters are masked.
+func (s *Sentry) event(id string, rep Report) map[string]any {
+	level := "error"
+	typ := fmt.Sprintf("%T", rep.Err)
+	if rep.Panic {
+		level = "fatal"
+		typ = "panic"
+	}
+	// Sentry lists frames outermost first
+	frames := make([]sentryFrame, 0, len(rep.Stack))
+	for i := len(rep.Stack) - 1; i >= 0; i-- {
+		f := rep.Stack[i]
+		module, function := splitFunction(f.Function)
+		frames = append(frames, sentryFrame{
+			Function: function,
+			Module:   module,
+			Filename: path.Base(f.File),
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    !strings.HasPrefix(f.Function, "runtime.") && !strings.HasPrefix(f.Function, "net/http."),
+		})
+	}
+	event := map[string]any{
+		"event_id":    id,
+		"timestamp":   rep.Time.UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       level,
+		"logger":      "tenkit",
+		"server_name": s.opts.ServerName,
+		"exception": map[string]any{"values": []map[string]any{{
+			"type":       typ,
+			"value":      logging.RedactSecrets(rep.Err.Error()),
+			"stacktrace": map[string]any{"frames": frames},
+		}}},
+	}
+	if s.opts.Environment != "" {
+		event["environment"] = s.opts.Environment
+	}
+	if s.opts.Release != "" {
+		event["release"] = s.opts.Release
+	}
+	tags := map[string]string{}
+	if rep.Tenant != "" {
+		tags["tenant"] = rep.Tenant
+	}
+	if rep.RequestID != "" {
+		tags["request_id"] = rep.RequestID
+	}
+	if len(tags) > 0 {
+		event["tags"] = tags
+	}
+	user := map[string]string{}
+	if rep.UserID != 0 {
+		user["id"] = strconv.FormatInt(rep.UserID, 10)
+	}
+	if rep.UserEmail != "" {
+		user["email"] = rep.UserEmail
+	}
+	if rep.IP != "" {
+		user["ip_address"] = rep.IP
+	}
+	if len(user) > 0 {
+		event["user"] = user
+	}
+	if rep.TenantID != 0 {
+		event["extra"] = map[string]any{"tenant_id": rep.TenantID}
+	}
+	if r := rep.Request; r != nil {
+		headers := map[string]string{}
+		for _, name := range sentryHeaders {
+			if v := r.Header.Get(name); v != "" {
+				headers[name] = v
+			}
+		}
+		if r.Host != "" {
+			headers["Host"] = r.Host
+		}
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		event["request"] = map[string]any{
+			"url":          scheme + "://" + r.Host + r.URL.Path,
+			"method":       r.Method,
+			"query_string": logging.RedactQuery(r.URL.RawQuery, s.opts.Redact),
+			"headers":      headers,
+		}
+	}
+	return event
+}
+
+// splitFunction splits "github.com/a/b.(*T).M" into the package path and "(*T).M".
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
+
+// eventID returns a random Sentry event ID, 32 hex digits.
+func eventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
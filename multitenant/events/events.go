@@ -0,0 +1,113 @@
+// Package events is an in-process event bus fired by the built-in flows (signup, confirmation,
+// login, password reset, tenant provisioning and lifecycle) so that applications can attach
+// behavior such as welcome emails or CRM sync with Go callbacks, without forking the handlers.
+// Subscribers run synchronously once the action succeeded, and a panicking subscriber is logged
+// without breaking the flow:
+//
+//	events.Subscribe(events.UserConfirmed, func(ctx context.Context, e events.Event) { ... })
+package events
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Events published by tenkit. Applications may publish their own names too.
+const (
+	TenantCreated       = "tenant.created"
+	TenantSuspended     = "tenant.suspended"
+	TenantReactivated   = "tenant.reactivated"
+	TenantDeleted       = "tenant.deleted"
+	TenantPurged        = "tenant.purged"
+	UserRegistered      = "user.registered" // Signup submitted, before the email is confirmed
+	UserConfirmed       = "user.confirmed"
+	LoginSucceeded      = "login.succeeded"
+	PasswordReset       = "password.reset"
+	MemberInvited       = "member.invited"
+	MemberCreated       = "member.created" // Account added by an admin, before its password is set
+	MemberRoleChanged   = "member.role_changed"
+	SubscriptionUpdated = "subscription.updated"
+)
+
+// All subscribes to every event.
+const All = "*"
+
+// Event is a single occurrence passed to subscribers.
+type Event struct {
+	Name     string
+	TenantID int64 // 0 for platform events
+	UserID   int64 // 0 when no user is involved or known yet
+	Data     map[string]any
+	Time     time.Time
+}
+
+var subscribers struct {
+	sync.RWMutex
+	fns map[string][]func(context.Context, Event)
+}
+
+// Subscribe registers fn to receive the events named name, or every event with All. Subscribers run
+// synchronously in the request, in registration order, after the action the event reports succeeded;
+// slow work (sending mail, calling an API) belongs in a goroutine with context.WithoutCancel(ctx).
+func Subscribe(name string, fn func(context.Context, Event)) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	if subscribers.fns == nil {
+		subscribers.fns = map[string][]func(context.Context, Event){}
+	}
+	subscribers.fns[name] = append(subscribers.fns[name], fn)
+}
+
+// Publish passes an event to its subscribers. A panicking subscriber is logged and skipped, so that
+// an extension can never break the flow that published the event.
+func Publish(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	subscribers.RLock()
+	fns := append(append([]func(context.Context, Event){}, subscribers.fns[e.Name]...), subscribers.fns[All]...)
+	subscribers.RUnlock()
+
+	slog.DebugContext(ctx, "[EVENTS] Publish", "event", e.Name, "tenant_id", e.TenantID, "subscribers", len(fns))
+	for _, fn := range fns {
+		call(ctx, fn, e)
+	}
+}
+
+func call(ctx context.Context, fn func(context.Context, Event), e Event) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(ctx, "[EVENTS] Subscriber panicked", "event", e.Name, "panic", v, "stack", string(debug.Stack()))
+		}
+	}()
+	fn(ctx, e)
+}
+
+// OnTransition publishes the lifecycle events of tenants; register it with models.OnTenantTransition.
+func OnTransition(ctx context.Context, tr models.TenantTransition) {
+	name := map[string]string{
+		models.TenantActive:    TenantReactivated,
+		models.TenantSuspended: TenantSuspended,
+		models.TenantDeleted:   TenantDeleted,
+		"purged":               TenantPurged,
+	}[tr.To]
+	if name == "" {
+		return
+	}
+	Publish(ctx, Event{
+		Name:     name,
+		TenantID: tr.TenantID,
+		Time:     tr.At,
+		Data: map[string]any{
+			"subdomain": tr.Subdomain,
+			"from":      tr.From,
+			"to":        tr.To,
+			"reason":    tr.Reason,
+		},
+	})
+}
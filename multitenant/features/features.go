@@ -0,0 +1,300 @@
+// Package features evaluates feature flags per tenant and user, so that features are rolled out
+// gradually across tenants. Flags are defined in code with Register or in the FEATURE_FLAGS
+// setting, platform admins change their state at /admin/features, and tenant overrides win over
+// everything else:
+//
+//	if features.Enabled(r.Context(), "new_dashboard") { ... }
+//
+// FEATURE_FLAGS lists flags that are on, off, or rolled out to a stable percentage of tenants or
+// users: new_dashboard,beta_reports=10%,inbox=50%@user. Templates call
+// {{ if call .Feature "new_dashboard" }}, and GET /api/v1/features returns the flags of the
+// tenant to client-side code.
+package features
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Flag defines a feature flag.
+type Flag struct {
+	Name        string
+	Description string
+	Enabled     bool // On for every tenant
+	Rollout     int  // Percentage of tenants, or users with PerUser, getting the flag when not Enabled
+	PerUser     bool // Roll out by user instead of by tenant; anonymous visitors count as their tenant
+}
+
+// Sources of the state of a flag, from the weakest.
+const (
+	SourceCode   = "code"   // Register
+	SourceConfig = "config" // FEATURE_FLAGS
+	SourceAdmin  = "admin"  // Set by a platform admin
+)
+
+// State is the platform-wide state of a flag and where it comes from.
+type State struct {
+	Flag
+	Source string
+}
+
+var (
+	mu         sync.RWMutex
+	registered = map[string]Flag{}
+	configured = map[string]Flag{}
+	stored     = map[string]models.FeatureFlag{}
+	overrides  = map[int64]map[string]bool{} // By tenant ID
+)
+
+// Register defines a flag in code; FEATURE_FLAGS and platform admins change its state.
+func Register(f Flag) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered[f.Name] = f
+}
+
+// Configure replaces the flags defined by the FEATURE_FLAGS setting, see ParseFlags.
+func Configure(spec string) error {
+	flags, err := ParseFlags(spec)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		byName[f.Name] = f
+	}
+	mu.Lock()
+	configured = byName
+	mu.Unlock()
+	return nil
+}
+
+// ParseFlags reads comma-separated "name[=state]" entries, the state being "on" (the default),
+// "off" or a rollout percentage by tenant, "25%", or by user, "25%@user":
+// "new_dashboard,beta_reports=10%,inbox=50%@user".
+func ParseFlags(spec string) ([]Flag, error) {
+	var flags []Flag
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, state, hasState := strings.Cut(entry, "=")
+		f := Flag{Name: strings.TrimSpace(name), Enabled: !hasState}
+		if err := validName(f.Name); err != nil {
+			return nil, fmt.Errorf("features: FEATURE_FLAGS: %w", err)
+		}
+		state, scope, _ := strings.Cut(strings.TrimSpace(state), "@")
+		switch {
+		case !hasState:
+		case state == "on" || state == "true":
+			f.Enabled = true
+		case state == "off" || state == "false":
+		case strings.HasSuffix(state, "%"):
+			n, err := strconv.Atoi(strings.TrimSuffix(state, "%"))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("features: FEATURE_FLAGS: invalid rollout %q for %s", state, f.Name)
+			}
+			f.Rollout = n
+		default:
+			return nil, fmt.Errorf("features: FEATURE_FLAGS: invalid state %q for %s, want on, off or a percentage", state, f.Name)
+		}
+		switch scope {
+		case "", "tenant":
+		case "user":
+			f.PerUser = true
+		default:
+			return nil, fmt.Errorf("features: FEATURE_FLAGS: invalid scope %q for %s, want tenant or user", scope, f.Name)
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// validName accepts the names usable in templates and settings: lowercase letters, digits, "_",
+// "-" and ".".
+func validName(name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("invalid flag name %q", name)
+	}
+	for _, c := range name {
+		if !('a' <= c && c <= 'z') && !('0' <= c && c <= '9') && c != '_' && c != '-' && c != '.' {
+			return fmt.Errorf("invalid flag name %q: use lowercase letters, digits, _, - and .", name)
+		}
+	}
+	return nil
+}
+
+// Load reads the state set by platform admins and the tenant overrides. Set and the other writers
+// call it; instances sharing the database call it periodically to pick up each other's changes.
+func Load(ctx context.Context) error {
+	flags, err := models.ListFeatureFlags(ctx)
+	if err != nil {
+		return fmt.Errorf("features: %w", err)
+	}
+	tenantFlags, err := models.ListTenantFeatureFlags(ctx)
+	if err != nil {
+		return fmt.Errorf("features: %w", err)
+	}
+	byName := make(map[string]models.FeatureFlag, len(flags))
+	for _, f := range flags {
+		byName[f.Name] = f
+	}
+	byTenant := map[int64]map[string]bool{}
+	for _, f := range tenantFlags {
+		if byTenant[f.TenantID] == nil {
+			byTenant[f.TenantID] = map[string]bool{}
+		}
+		byTenant[f.TenantID][f.Name] = f.Enabled
+	}
+	mu.Lock()
+	stored, overrides = byName, byTenant
+	mu.Unlock()
+	return nil
+}
+
+// lookup returns the platform-wide state of a flag; mu must be held.
+func lookup(name string) (State, bool) {
+	var state State
+	f, ok := registered[name]
+	if ok {
+		state = State{Flag: f, Source: SourceCode}
+	}
+	if c, found := configured[name]; found {
+		c.Description = f.Description
+		state, ok = State{Flag: c, Source: SourceConfig}, true
+	}
+	if s, found := stored[name]; found {
+		state.Name, state.Enabled, state.Rollout, state.Source = name, s.Enabled, s.Rollout, SourceAdmin
+		ok = true
+	}
+	return state, ok
+}
+
+// Flags returns the platform-wide state of every flag, by name.
+func Flags() []State {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := map[string]bool{}
+	for name := range registered {
+		names[name] = true
+	}
+	for name := range configured {
+		names[name] = true
+	}
+	for name := range stored {
+		names[name] = true
+	}
+	states := make([]State, 0, len(names))
+	for name := range names {
+		s, _ := lookup(name)
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// Enabled reports whether a flag is on for the tenant and user of the request context. Unknown
+// flags are off.
+func Enabled(ctx context.Context, name string) bool {
+	var tenantID, userID int64
+	if t := middleware.FromContext(ctx); t != nil {
+		tenantID = t.ID
+	}
+	if u := middleware.UserFromContext(ctx); u != nil {
+		userID = u.ID
+	}
+	return EnabledFor(tenantID, userID, name)
+}
+
+// EnabledFor reports whether a flag is on for a tenant and a user, 0 for none: the tenant override
+// if any, else on when the flag is enabled or the tenant or user falls in its rollout.
+func EnabledFor(tenantID, userID int64, name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	if on, ok := overrides[tenantID][name]; ok && tenantID != 0 {
+		return on
+	}
+	state, ok := lookup(name)
+	if !ok {
+		return false
+	}
+	if state.Enabled || state.Rollout >= 100 {
+		return true
+	}
+	if state.Rollout <= 0 {
+		return false
+	}
+	id := tenantID
+	if state.PerUser && userID != 0 {
+		id = userID
+	}
+	return id != 0 && bucket(name, id) < state.Rollout
+}
+
+// bucket places an ID in one of 100 buckets, differently for each flag, so that a rollout grows
+// by adding tenants to those already in it.
+func bucket(name string, id int64) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + strconv.FormatInt(id, 10)))
+	return int(h.Sum32() % 100)
+}
+
+// All returns the state of every flag for the tenant and user of the request context, for APIs
+// and client-side code.
+func All(ctx context.Context) map[string]bool {
+	all := map[string]bool{}
+	for _, s := range Flags() {
+		all[s.Name] = Enabled(ctx, s.Name)
+	}
+	return all
+}
+
+// Set stores the platform-wide state of a flag, defining it when it is unknown.
+func Set(ctx context.Context, name string, enabled bool, rollout int, by int64) error {
+	if err := validName(name); err != nil {
+		return fmt.Errorf("features: %w", err)
+	}
+	if rollout < 0 || rollout > 100 {
+		return fmt.Errorf("features: invalid rollout %d", rollout)
+	}
+	if err := models.SetFeatureFlag(ctx, name, enabled, rollout, by); err != nil {
+		return err
+	}
+	return Load(ctx)
+}
+
+// Reset drops the state set by platform admins and the tenant overrides of a flag.
+func Reset(ctx context.Context, name string) error {
+	if err := models.DeleteFeatureFlag(ctx, name); err != nil {
+		return err
+	}
+	return Load(ctx)
+}
+
+// SetTenant turns a flag on or off for a tenant, whatever its platform-wide state.
+func SetTenant(ctx context.Context, tenantID int64, name string, enabled bool, by int64) error {
+	if err := validName(name); err != nil {
+		return fmt.Errorf("features: %w", err)
+	}
+	if err := models.SetTenantFeatureFlag(ctx, tenantID, name, enabled, by); err != nil {
+		return err
+	}
+	return Load(ctx)
+}
+
+// ClearTenant removes the override of a tenant.
+func ClearTenant(ctx context.Context, tenantID int64, name string) error {
+	if err := models.ClearTenantFeatureFlag(ctx, tenantID, name); err != nil {
+		return err
+	}
+	return Load(ctx)
+}
@@ -0,0 +1,207 @@
+// Package forms parses and validates HTML form submissions from declarative field definitions, so
+// handlers stop repeating ParseForm, trimming and checks. A Form is declared once; each request
+// gets a Result holding the cleaned values to repopulate the form, the translated errors by field
+// and the CSRF field to render.
+package forms
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Translator localizes error messages, e.g. the application's *i18n.I18n.
+type Translator interface {
+	T(key, lang string, args ...any) string
+}
+
+// Messages translates the errors of Results; set it at startup. Without it, errors are their keys.
+var Messages Translator
+
+// CSRFFieldName is the form field carrying the CSRF token; keep it equal to Config.CSRF.FieldName.
+var CSRFFieldName = "csrf_token"
+
+// Message is a validation error: an i18n key and its arguments.
+type Message struct {
+	Key  string
+	Args []any
+}
+
+// Check validates the cleaned value of a field, returning nil when it is acceptable. Checks are
+// skipped for empty values, which only Field.Required refuses.
+type Check func(value string) *Message
+
+// Field declares a form field.
+type Field struct {
+	Name     string
+	Required bool
+	Raw      bool // Keep surrounding spaces, e.g. for passwords
+	Lower    bool // Lowercase the value, e.g. for emails and domains
+	Checks   []Check
+}
+
+// Form is a set of field declarations, shared by the requests of a handler.
+type Form struct {
+	Fields []Field
+}
+
+// New declares a form.
+func New(fields ...Field) *Form {
+	return &Form{Fields: fields}
+}
+
+// Result is a submission of a form: its values and errors.
+type Result struct {
+	Values    map[string]string // Cleaned values, to repopulate the form
+	Errors    map[string]string // Translated errors by field name; "" is for errors of the whole form
+	CSRFToken string
+	lang      string
+}
+
+// Parse parses the submission of r and runs the checks of every field.
+func (f *Form) Parse(r *http.Request) *Result {
+	res := Empty(r)
+	if err := r.ParseForm(); err != nil {
+		res.AddError("", "form.invalid")
+		return res
+	}
+	for _, field := range f.Fields {
+		value := r.PostFormValue(field.Name)
+		if !field.Raw {
+			value = strings.TrimSpace(value)
+		}
+		if field.Lower {
+			value = strings.ToLower(value)
+		}
+		res.Values[field.Name] = value
+		if value == "" {
+			if field.Required {
+				res.AddError(field.Name, "form.required")
+			}
+			continue
+		}
+		for _, check := range field.Checks {
+			if m := check(value); m != nil {
+				res.AddError(field.Name, m.Key, m.Args...)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Empty returns a Result without values, to render a form before it is submitted.
+func Empty(r *http.Request) *Result {
+	token, _ := r.Context().Value(middleware.CsrfKey).(string)
+	return &Result{
+		Values:    map[string]string{},
+		Errors:    map[string]string{},
+		CSRFToken: token,
+		lang:      middleware.LangFromContext(r.Context()),
+	}
+}
+
+// Valid reports whether no check failed.
+func (res *Result) Valid() bool {
+	return len(res.Errors) == 0
+}
+
+// Get returns the cleaned value of a field.
+func (res *Result) Get(name string) string {
+	return res.Values[name]
+}
+
+// Set sets the value of a field, e.g. from stored settings before the form is shown.
+func (res *Result) Set(name, value string) {
+	res.Values[name] = value
+}
+
+// Error returns the translated error of a field, "" for none.
+func (res *Result) Error(name string) string {
+	return res.Errors[name]
+}
+
+// AddError records an error found by the handler, e.g. a taken name; field "" is the whole form.
+// The first error of a field is kept.
+func (res *Result) AddError(field, key string, args ...any) {
+	if _, ok := res.Errors[field]; ok {
+		return
+	}
+	msg := key
+	if Messages != nil {
+		msg = Messages.T(key, res.lang, args...)
+	}
+	res.Errors[field] = msg
+}
+
+// CSRFField renders the hidden input carrying the CSRF token: {{ .Extra.Form.CSRFField }}.
+func (res *Result) CSRFField() template.HTML {
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(CSRFFieldName) +
+		`" value="` + template.HTMLEscapeString(res.CSRFToken) + `">`)
+}
+
+// Email accepts account addresses.
+func Email() Check {
+	return func(value string) *Message {
+		if !multitenant.ValidEmail(value) {
+			return &Message{Key: "form.email"}
+		}
+		return nil
+	}
+}
+
+// MinLength refuses values shorter than n characters.
+func MinLength(n int) Check {
+	return func(value string) *Message {
+		if utf8.RuneCountInString(value) < n {
+			return &Message{Key: "form.min_length", Args: []any{n}}
+		}
+		return nil
+	}
+}
+
+// MaxLength refuses values longer than n characters.
+func MaxLength(n int) Check {
+	return func(value string) *Message {
+		if utf8.RuneCountInString(value) > n {
+			return &Message{Key: "form.max_length", Args: []any{n}}
+		}
+		return nil
+	}
+}
+
+// Pattern refuses values not matching re, with the message key.
+func Pattern(re *regexp.Regexp, key string) Check {
+	return func(value string) *Message {
+		if !re.MatchString(value) {
+			return &Message{Key: key}
+		}
+		return nil
+	}
+}
+
+// OneOf accepts the listed values only, e.g. the options of a select.
+func OneOf(values ...string) Check {
+	return func(value string) *Message {
+		if !slices.Contains(values, value) {
+			return &Message{Key: "form.one_of"}
+		}
+		return nil
+	}
+}
+
+// Func is a custom check: ok reports whether the value is acceptable, key is the message otherwise.
+func Func(ok func(value string) bool, key string) Check {
+	return func(value string) *Message {
+		if !ok(value) {
+			return &Message{Key: key}
+		}
+		return nil
+	}
+}
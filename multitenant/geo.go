@@ -0,0 +1,75 @@
+package multitenant
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// GeoLocator maps a client IP to an ISO 3166-1 alpha-2 country code.
+type GeoLocator interface {
+	Country(ip net.IP) (string, error) // Returns "" when the country is unknown
+}
+
+// CIDRGeoLocator is a list-based GeoLocator loaded from "cidr,country" CSV rows,
+// the format produced by most free GeoIP country exports.
+type CIDRGeoLocator struct {
+	ranges []geoRange
+}
+
+type geoRange struct {
+	network *net.IPNet
+	country string
+}
+
+// LoadCIDRGeoLocator reads a CSV file of "cidr,country" rows. Lines starting with # are ignored.
+func LoadCIDRGeoLocator(path string) (*CIDRGeoLocator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geo database: %w", err)
+	}
+	defer f.Close()
+	return ParseCIDRGeoLocator(f)
+}
+
+// ParseCIDRGeoLocator builds a locator from CSV content.
+func ParseCIDRGeoLocator(r io.Reader) (*CIDRGeoLocator, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+
+	loc := &CIDRGeoLocator{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid geo database: %w", err)
+		}
+		if len(rec) < 2 {
+			continue
+		}
+		_, network, err := net.ParseCIDR(strings.TrimSpace(rec[0]))
+		if err != nil {
+			continue // header row or malformed line
+		}
+		loc.ranges = append(loc.ranges, geoRange{network: network, country: strings.ToUpper(strings.TrimSpace(rec[1]))})
+	}
+	return loc, nil
+}
+
+func (l *CIDRGeoLocator) Country(ip net.IP) (string, error) {
+	if ip == nil {
+		return "", nil
+	}
+	for _, r := range l.ranges {
+		if r.network.Contains(ip) {
+			return r.country, nil
+		}
+	}
+	return "", nil
+}
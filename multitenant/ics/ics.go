@@ -0,0 +1,186 @@
+// Package ics writes iCalendar (RFC 5545) feeds and keeps the registry of per-user feeds
+// that applications expose through the signed calendar endpoint. Feeds registered with Register
+// are served at /calendar/<feed>.ics behind signed subscription URLs, which stop working when the
+// user leaves the tenant or resets them from /account/calendar.
+package ics
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a single VEVENT.
+type Event struct {
+	UID         string // Stable and globally unique, e.g. "match-42@acme.example.com"
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool // Start and End are dates; End is exclusive
+	Updated     time.Time
+	Cancelled   bool
+}
+
+// Calendar is a VCALENDAR with its events.
+type Calendar struct {
+	Name   string
+	ProdID string // Defaults to "-//tenkit//EN"
+	Events []Event
+}
+
+const (
+	stampLayout = "20060102T150405Z"
+	dateLayout  = "20060102"
+)
+
+// WriteTo renders the calendar with CRLF line endings and lines folded at 75 octets.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	prodID := c.ProdID
+	if prodID == "" {
+		prodID = "-//tenkit//EN"
+	}
+	now := time.Now().UTC().Format(stampLayout)
+
+	line(cw, "BEGIN", "VCALENDAR")
+	line(cw, "VERSION", "2.0")
+	line(cw, "PRODID", unbroken(prodID))
+	line(cw, "CALSCALE", "GREGORIAN")
+	line(cw, "METHOD", "PUBLISH")
+	if c.Name != "" {
+		line(cw, "X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line(cw, "BEGIN", "VEVENT")
+		line(cw, "UID", escape(e.UID))
+		stamp := now
+		if !e.Updated.IsZero() {
+			stamp = e.Updated.UTC().Format(stampLayout)
+		}
+		line(cw, "DTSTAMP", stamp)
+		if e.AllDay {
+			line(cw, "DTSTART;VALUE=DATE", e.Start.Format(dateLayout))
+			if !e.End.IsZero() {
+				line(cw, "DTEND;VALUE=DATE", e.End.Format(dateLayout))
+			}
+		} else {
+			line(cw, "DTSTART", e.Start.UTC().Format(stampLayout))
+			if !e.End.IsZero() {
+				line(cw, "DTEND", e.End.UTC().Format(stampLayout))
+			}
+		}
+		line(cw, "SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line(cw, "DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line(cw, "LOCATION", escape(e.Location))
+		}
+		if e.URL != "" {
+			line(cw, "URL", unbroken(e.URL))
+		}
+		if e.Cancelled {
+			line(cw, "STATUS", "CANCELLED")
+		}
+		line(cw, "END", "VEVENT")
+	}
+	line(cw, "END", "VCALENDAR")
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// escape applies the TEXT value escaping of RFC 5545 section 3.3.11. A lone CR is a line break
+// too for many clients, so it is escaped like one rather than letting a value start a property.
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// unbroken drops the line breaks of a value that has no escaping, such as a URI.
+func unbroken(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// line writes "NAME:value", folding it into 75-octet lines without splitting UTF-8 sequences.
+func line(w *countWriter, name, value string) {
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74 // Continuation lines start with a space
+	}
+	w.WriteString(s + "\r\n")
+}
+
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) WriteString(s string) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.WriteString(s)
+	c.n += int64(n)
+	c.err = err
+}
+
+// Source returns the events of a feed for one user of a tenant.
+type Source func(ctx context.Context, tenantID, userID int64) ([]Event, error)
+
+// Feed is a calendar applications offer to their users.
+type Feed struct {
+	Name     string // URL segment: /calendar/<name>.ics
+	TitleKey string // i18n key of the calendar name
+	Source   Source
+}
+
+var (
+	mu    sync.RWMutex
+	feeds = map[string]Feed{}
+)
+
+// Register adds a feed; registering the same name again replaces it.
+func Register(f Feed) {
+	mu.Lock()
+	defer mu.Unlock()
+	feeds[f.Name] = f
+}
+
+// Lookup returns the feed registered under name.
+func Lookup(name string) (Feed, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := feeds[name]
+	return f, ok
+}
+
+// Feeds returns the registered feeds sorted by name.
+func Feeds() []Feed {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]Feed, 0, len(feeds))
+	for _, f := range feeds {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
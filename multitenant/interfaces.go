@@ -1,3 +1,31 @@
+// Package multitenant holds the core of tenkit: the configuration, tenant resolution and the
+// registries applications extend.
+//
+// Configuration comes from the environment, .env and an optional tenkit.yaml, tenkit.yml or
+// tenkit.toml file (or the file named by TENKIT_CONFIG), whose keys are the variable names nested
+// by their parts: app: {domain: ...} is APP_DOMAIN. Environment variables override the file, and
+// Config.Validate refuses unknown keys, the default TENKIT_SECRET and insecure cookies outside dev
+// mode. WatchConfig applies the reloadable settings (RATE_LIMITS, FEATURE_FLAGS, MAINTENANCE_*,
+// TENKIT_LOCALES, the log levels) on SIGHUP or every TENKIT_CONFIG_WATCH; ReloadableSetting and
+// OnConfigChange extend it.
+//
+// A ChainResolver finds the tenant of a request by trying its resolvers in order: the verified
+// custom domain or subdomain of the host, a header set by a trusted proxy (TENANT_HEADER), and a
+// path prefix for single-host deployments (TENANT_PATH_PREFIX). Preview hosts such as
+// acme-preview.<domain> (TENANT_PREVIEW_PATTERN) serve the same tenant to its members only.
+//
+// Roles are ranked (TENKIT_ROLES, default owner:100,admin:50,member:10); TENKIT_DEFAULT_ROLE,
+// TENKIT_OWNER_ROLE and TENKIT_ADMIN_ROLE pick the role of new members, of tenant creators and the
+// one required for tenant settings. Applications declare their own tenant settings and group
+// permissions, which then appear on the settings and group pages:
+//
+//	multitenant.RegisterSetting(multitenant.SettingDef{Key: "invoice_prefix", LabelKey: "settings.invoice_prefix", Type: multitenant.SettingString})
+//	multitenant.RegisterPermission(multitenant.Permission{Name: "billing.manage"}) // Label permission.billing.manage
+//	prefix := tenant.Settings.GetString("invoice_prefix")
+//
+// Slugify turns organization names into subdomains (Café Müller is cafe-muller), and
+// AvailableSubdomain skips RESERVED_SUBDOMAINS and taken ones. ProvisionTenant creates an active
+// tenant and its owner with the checks of /enroll, without the email round trip.
 package multitenant
 
 import (
@@ -12,9 +40,17 @@ import (
 
 // Tenant is the shared struct for tenant data.
 type Tenant struct {
-	ID        int64
-	Subdomain string
-	Name      string
+	ID              int64
+	Subdomain       string
+	Name            string
+	RateLimitFactor float64  // Multiplier applied to rate limits on this tenant
+	Suspended       bool     // Requests get the suspended page (middleware.Suspended)
+	Settings        Settings // Per-tenant settings (tenant_settings), read-only
+	Brand           Brand    // Colors, theme and logo
+	Plan            string   // Limits plan, "" for the platform default (see package limits)
+	CustomDomain    string   // Verified custom domain serving the tenant, "" for none
+	Timezone        string   // IANA time zone, e.g. "Europe/Paris"; dates are shown in it
+	ParentID        int64    // Parent of a sub-tenant, 0 for a top-level tenant
 }
 
 // TenantResolver extracts the tenant identifier from the request.
@@ -48,7 +84,8 @@ type TenantFetcher interface {
 	Fetch(ctx context.Context, identifier string) (*Tenant, error)
 }
 
-// DBFetcher is the default DB-based implementation.
+// DBFetcher is the default DB-based implementation. A sub-tenant inherits the branding and the
+// settings it did not set from its parent, and is suspended along with it.
 type DBFetcher struct {
 	DB *sql.DB // Or *gorm.DB if using ORM later
 }
@@ -59,5 +96,46 @@ func (f DBFetcher) Fetch(ctx context.Context, sub string) (*Tenant, error) {
 	if err != nil || t == nil {
 		return nil, err
 	}
-	return &Tenant{ID: int64(t.ID), Subdomain: t.Subdomain, Name: t.Name}, nil
+	settings, err := models.GetTenantSettings(ctx, int64(t.ID))
+	if err != nil {
+		return nil, err
+	}
+	tenant := &Tenant{
+		ID:              int64(t.ID),
+		Subdomain:       t.Subdomain,
+		Name:            t.Name,
+		RateLimitFactor: t.RateLimitFactor,
+		Suspended:       !t.IsActive,
+		Settings:        NewSettings(settings),
+		Plan:            t.Plan,
+		CustomDomain:    t.CustomDomain.String,
+		Timezone:        t.Timezone,
+		ParentID:        t.ParentID.Int64,
+		Brand: Brand{
+			PrimaryColor:   t.PrimaryColor.String,
+			SecondaryColor: t.SecondaryColor.String,
+			Theme:          t.Theme.String,
+			LogoPath:       t.LogoPath.String,
+			Version:        t.BrandingVersion,
+		},
+	}
+	if tenant.ParentID == 0 {
+		return tenant, nil
+	}
+
+	// A sub-tenant's subdomain ends with the parent's, e.g. "client.agency"
+	_, parentSub, _ := strings.Cut(t.Subdomain, ".")
+	parent, err := f.Fetch(ctx, parentSub)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil || parent.ID != tenant.ParentID {
+		// The parent is deleted: its sub-tenants go offline with it
+		tenant.Suspended = true
+		return tenant, nil
+	}
+	tenant.Suspended = tenant.Suspended || parent.Suspended
+	tenant.Settings = tenant.Settings.Inherit(parent.Settings)
+	tenant.Brand = tenant.Brand.Inherit(parent.Brand)
+	return tenant, nil
 }
@@ -0,0 +1,52 @@
+package multitenant
+
+import (
+	"net"
+	"strings"
+)
+
+// Tenant settings holding the IP ranges allowed on and denied from a tenant's site, as IPs or CIDRs
+// separated by commas or new lines. They are enforced by middleware.IPAccess.
+const (
+	IPAllowSetting = "ip_allow"
+	IPDenySetting  = "ip_deny"
+)
+
+// IPAccessPolicy restricts the addresses served on a tenant's site.
+type IPAccessPolicy struct {
+	Allow []*net.IPNet // When set, only these ranges are served
+	Deny  []*net.IPNet // Refused even when allowed
+}
+
+// ParseIPRanges reads IPs and CIDRs separated by commas or new lines, e.g. "10.0.0.0/8, 192.0.2.7".
+func ParseIPRanges(s string) ([]*net.IPNet, error) {
+	return ParseIPList(strings.NewReader(strings.ReplaceAll(s, ",", "\n")))
+}
+
+// ValidateIPRanges checks a value of the IP range settings, see ParseIPRanges.
+func ValidateIPRanges(s string) error {
+	_, err := ParseIPRanges(s)
+	return err
+}
+
+// TenantIPAccess returns the policy of a tenant's settings; ok is false when it has none.
+func TenantIPAccess(s Settings) (p IPAccessPolicy, ok bool, err error) {
+	if p.Allow, err = ParseIPRanges(s.GetString(IPAllowSetting)); err != nil {
+		return p, false, err
+	}
+	if p.Deny, err = ParseIPRanges(s.GetString(IPDenySetting)); err != nil {
+		return p, false, err
+	}
+	return p, len(p.Allow) > 0 || len(p.Deny) > 0, nil
+}
+
+// Allows reports whether ip may be served: it is not denied and, with an allow list, it is listed.
+func (p IPAccessPolicy) Allows(ip net.IP) bool {
+	if ip == nil {
+		return len(p.Allow) == 0
+	}
+	if containsIP(p.Deny, ip) {
+		return false
+	}
+	return len(p.Allow) == 0 || containsIP(p.Allow, ip)
+}
@@ -0,0 +1,156 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed schedule: the five fields of crontab(5) (minute, hour, day of month, month, day
+// of week), a shortcut such as "@hourly" or "@daily", or "@every 30s" for fixed intervals.
+type Cron struct {
+	Spec   string
+	every  time.Duration
+	fields [5]uint64 // Bit i set when value i matches
+	anyDom bool      // Day of month is "*": only the day of week restricts days
+	anyDow bool      // Day of week is "*": only the day of month restricts days
+}
+
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronBounds are the allowed values of each field; 7 is Sunday too in the day of week.
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCron parses a schedule, e.g. "*/15 * * * *", "30 3 * * 1-5", "@daily" or "@every 5s".
+func ParseCron(spec string) (*Cron, error) {
+	c := &Cron{Spec: spec}
+	s := strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(s, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("jobs: invalid interval in %q", spec)
+		}
+		c.every = d
+		return c, nil
+	}
+	if full, ok := cronShortcuts[s]; ok {
+		s = full
+	}
+	parts := strings.Fields(s)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("jobs: %q does not have 5 fields", spec)
+	}
+	for i, p := range parts {
+		bits, err := parseCronField(p, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("jobs: invalid field %q in %q: %w", p, spec, err)
+		}
+		c.fields[i] = bits
+	}
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1 // Sunday
+	}
+	c.anyDom, c.anyDow = parts[2] == "*", parts[4] == "*"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("jobs: %q never runs", spec)
+	}
+	return c, nil
+}
+
+// parseCronField reads a comma-separated list of "*", "n", "a-b", each optionally followed by "/step".
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if r, s, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", s)
+			}
+			rng, step = r, n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value %q", a)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad value %q", b)
+				}
+			} else if step > 1 {
+				to = hi // "5/15" runs from 5 to the end of the range
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("out of range %d-%d", lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t matching the schedule, in the location of t, or the zero
+// time when none comes within five years. Interval schedules run every interval after t.
+func (c *Cron) Next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Schedules such as "0 0 30 2 *" never match
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.match(3, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.match(1, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.match(0, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) match(field, v int) bool {
+	return c.fields[field]&(1<<v) != 0
+}
+
+// dayMatches applies the crontab rule: when both the day of month and the day of week are
+// restricted, a day matching either runs.
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := c.match(2, t.Day()), c.match(4, int(t.Weekday()))
+	switch {
+	case c.anyDom && c.anyDow:
+		return true
+	case c.anyDom:
+		return dow
+	case c.anyDow:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,329 @@
+// Package jobs runs background work: jobs are queued in the database, so they survive restarts and
+// are shared by every instance, and run by a pool of workers that gives each tenant its turn.
+// Failed jobs are retried with exponential backoff, and schedules in cron syntax queue recurring jobs.
+//
+//	jobs.Register(jobs.Kind{Name: "invoice.send", Handler: func(ctx context.Context, job *models.Job) error {
+//		var p struct{ InvoiceID int64 }
+//		if err := job.Decode(&p); err != nil {
+//			return jobs.Permanent(err)
+//		}
+//		return sendInvoice(ctx, job.TenantID, p.InvoiceID)
+//	}})
+//	jobs.Enqueue(ctx, tenantID, "invoice.send", map[string]any{"InvoiceID": inv.ID})
+//	jobs.Schedule("invoice.reminders", "0 9 * * 1-5", "invoice.reminders")
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// Defaults of Kind.
+const (
+	DefaultMaxAttempts = 5
+	DefaultTimeout     = 5 * time.Minute
+)
+
+// Kind is a type of job and the function running it.
+type Kind struct {
+	Name        string
+	Handler     func(ctx context.Context, job *models.Job) error
+	MaxAttempts int                             // DefaultMaxAttempts when zero
+	Timeout     time.Duration                   // Time allowed to an attempt, DefaultTimeout when zero
+	Backoff     func(attempt int) time.Duration // Delay after the attempt-th failure, Backoff when nil
+}
+
+func (k Kind) maxAttempts() int {
+	if k.MaxAttempts > 0 {
+		return k.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (k Kind) timeout() time.Duration {
+	if k.Timeout > 0 {
+		return k.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Backoff doubles the delay after each failed attempt, from 30 seconds up to an hour.
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// Permanent wraps err so that the job fails without further attempts, e.g. for an invalid payload.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+var registry struct {
+	sync.RWMutex
+	kinds     map[string]Kind
+	schedules []schedule
+}
+
+type schedule struct {
+	name string
+	cron *Cron
+	kind string
+}
+
+// Register makes a kind of job runnable. Register every kind on every instance before starting
+// the runner, since any instance may pick any job.
+func Register(k Kind) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.kinds == nil {
+		registry.kinds = map[string]Kind{}
+	}
+	registry.kinds[k.Name] = k
+}
+
+func lookup(name string) (Kind, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	k, ok := registry.kinds[name]
+	return k, ok
+}
+
+// Schedule queues a platform job of kind on every run of spec, e.g. "@hourly" or "*/10 * * * *"
+// (see ParseCron). name identifies the schedule across instances, which share each run; a run is
+// skipped while the previous one is still queued or running.
+func Schedule(name, spec, kind string) error {
+	c, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for i, s := range registry.schedules {
+		if s.name == name {
+			registry.schedules[i] = schedule{name, c, kind}
+			return nil
+		}
+	}
+	registry.schedules = append(registry.schedules, schedule{name, c, kind})
+	return nil
+}
+
+// wake lets workers pick a job queued by this instance without waiting for the next poll.
+var wake = make(chan struct{}, 1)
+
+// Enqueue queues a job for a tenant, 0 for a platform job, to run as soon as a worker is free.
+// payload is encoded as JSON and read back with models.Job.Decode.
+func Enqueue(ctx context.Context, tenantID int64, kind string, payload any) (int64, error) {
+	return EnqueueAt(ctx, time.Now(), tenantID, kind, payload)
+}
+
+// EnqueueAt is Enqueue for a job that must not run before at.
+func EnqueueAt(ctx context.Context, at time.Time, tenantID int64, kind string, payload any) (int64, error) {
+	return enqueue(ctx, at, tenantID, kind, payload, false)
+}
+
+func enqueue(ctx context.Context, at time.Time, tenantID int64, kind string, payload any, unique bool) (int64, error) {
+	k, ok := lookup(kind)
+	if !ok {
+		return 0, fmt.Errorf("jobs: unknown kind %q", kind)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	j := models.Job{
+		TenantID:    tenantID,
+		Kind:        kind,
+		Payload:     string(b),
+		MaxAttempts: k.maxAttempts(),
+		RunAt:       at,
+		RequestID:   models.RequestIDFromContext(ctx),
+	}
+	if err := models.CreateJob(ctx, &j, unique); err != nil {
+		return 0, err
+	}
+	if j.ID != 0 {
+		slog.DebugContext(ctx, "[JOBS] Job enqueued", "job_id", j.ID, "kind", kind, "tenant_id", tenantID, "run_at", at)
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return j.ID, nil
+}
+
+// Runner is the worker pool running the queued jobs, and the scheduler queueing the runs of the
+// schedules.
+type Runner struct {
+	Workers   int           // Jobs run at the same time by this instance
+	PerTenant int           // Jobs of one tenant running at the same time across instances
+	Poll      time.Duration // Interval between checks for due jobs and schedules
+
+	due map[string]time.Time // Next run of each schedule, as last read from the database
+}
+
+// NewRunner returns a runner configured by cfg.
+func NewRunner(cfg multitenant.JobsConfig) *Runner {
+	return &Runner{Workers: max(cfg.Workers, 1), PerTenant: max(cfg.PerTenant, 1), Poll: max(cfg.Poll, 100*time.Millisecond)}
+}
+
+// Run starts the workers and the scheduler, and returns once ctx is done and the running jobs ended.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range r.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+	ticker := time.NewTicker(r.Poll)
+	defer ticker.Stop()
+	for {
+		r.schedule(ctx)
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work runs jobs one after the other, waiting for the next poll or enqueue when none is due.
+func (r *Runner) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := models.ClaimJob(ctx, r.lease(), r.PerTenant)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("[JOBS] Failed to claim job", "err", err)
+		}
+		if job != nil {
+			r.run(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-time.After(r.Poll):
+		}
+	}
+}
+
+// lease is how long a claimed job is reserved for: the longest timeout, with a margin.
+func (r *Runner) lease() time.Duration {
+	registry.RLock()
+	defer registry.RUnlock()
+	d := DefaultTimeout
+	for _, k := range registry.kinds {
+		d = max(d, k.timeout())
+	}
+	return d + time.Minute
+}
+
+// run attempts a job and records the outcome, scheduling a retry after a failure.
+func (r *Runner) run(ctx context.Context, job *models.Job) {
+	ctx = models.WithRequestID(context.WithoutCancel(ctx), job.RequestID)
+	k, ok := lookup(job.Kind)
+	var err error
+	switch {
+	case !ok:
+		err = Permanent(fmt.Errorf("jobs: unknown kind %q", job.Kind))
+	case job.Attempts > job.MaxAttempts:
+		// Its instance stopped during the last attempt
+		err = Permanent(fmt.Errorf("jobs: attempts exhausted, last error: %s", job.LastError))
+	default:
+		start := time.Now()
+		err = call(ctx, k, job)
+		slog.DebugContext(ctx, "[JOBS] Job attempted", "job_id", job.ID, "kind", job.Kind, "tenant_id", job.TenantID,
+			"attempt", job.Attempts, "duration", time.Since(start), "err", err)
+	}
+
+	var retryAt time.Time
+	var permanent permanentError
+	if err != nil && !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		backoff := Backoff
+		if k.Backoff != nil {
+			backoff = k.Backoff
+		}
+		retryAt = time.Now().Add(backoff(job.Attempts))
+		slog.WarnContext(ctx, "[JOBS] Job failed, retrying", "job_id", job.ID, "kind", job.Kind,
+			"attempt", job.Attempts, "retry_at", retryAt, "err", err)
+	} else if err != nil {
+		slog.ErrorContext(ctx, "[JOBS] Job failed", "job_id", job.ID, "kind", job.Kind, "tenant_id", job.TenantID,
+			"attempts", job.Attempts, "err", err)
+	}
+	if err := models.FinishJob(ctx, job.ID, err, retryAt); err != nil {
+		slog.ErrorContext(ctx, "[JOBS] Failed to record job outcome", "job_id", job.ID, "err", err)
+	}
+}
+
+// call runs the handler of k within its timeout, turning a panic into an error.
+func call(ctx context.Context, k Kind, job *models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, k.timeout())
+	defer cancel()
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(ctx, "[JOBS] Job panicked", "job_id", job.ID, "kind", job.Kind, "panic", v, "stack", string(debug.Stack()))
+			err = fmt.Errorf("jobs: panic: %v", v)
+		}
+	}()
+	return k.Handler(ctx, job)
+}
+
+// schedule queues the runs of the schedules that are due.
+func (r *Runner) schedule(ctx context.Context) {
+	registry.RLock()
+	schedules := append([]schedule(nil), registry.schedules...)
+	registry.RUnlock()
+	if r.due == nil {
+		r.due = map[string]time.Time{}
+	}
+	now := time.Now()
+	for _, s := range schedules {
+		if at, ok := r.due[s.name]; ok && now.Before(at) {
+			continue
+		}
+		claimed, next, err := models.ClaimJobSchedule(ctx, s.name, s.cron.Spec, s.cron.Next(now))
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("[JOBS] Failed to check schedule", "schedule", s.name, "err", err)
+			}
+			continue
+		}
+		r.due[s.name] = next
+		if !claimed {
+			continue
+		}
+		if _, err := enqueue(ctx, now, 0, s.kind, nil, true); err != nil {
+			slog.Error("[JOBS] Failed to queue scheduled job", "schedule", s.name, "kind", s.kind, "err", err)
+		}
+	}
+}
+
+// Cleanup is the kind of job deleting the jobs finished more than retention ago.
+func Cleanup(retention time.Duration) Kind {
+	return Kind{Name: "jobs.cleanup", Handler: func(ctx context.Context, _ *models.Job) error {
+		n, err := models.PurgeJobs(ctx, time.Now().Add(-retention))
+		if err == nil && n > 0 {
+			slog.InfoContext(ctx, "[JOBS] Finished jobs purged", "count", n)
+		}
+		return err
+	}}
+}
@@ -0,0 +1,200 @@
+// Package limits enforces the plan of a tenant: quotas such as the number of members or the
+// bytes stored, and the features the plan includes.
+//
+//	limits.RegisterPlan(limits.Plan{Name: "pro", Limits: map[string]int64{limits.Members: 50}, Features: []string{"custom_domain"}})
+//	if err := limits.Check(ctx, limits.Members, +1); err != nil { ... } // *limits.LimitError
+//	if limits.Enabled(ctx, "custom_domain") { ... }
+//
+// Platform admins attach plans on /admin/tenants or through the provisioning API, and billing
+// integrations with SetPlan. Tenants without a plan follow TENANT_DEFAULT_PLAN, or are unlimited
+// when it is empty.
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Built-in resources, counted by the usage functions registered below.
+const (
+	Members = "members" // Memberships of the tenant, pending ones included
+	Storage = "storage" // Bytes of files stored for the tenant
+)
+
+// Built-in features, gated by the handlers that offer them.
+const (
+	CustomDomain = "custom_domain" // Serving the tenant on its own domain
+	APIKeys      = "api_keys"      // Creating API keys
+)
+
+// ErrLimitReached is matched by every *LimitError.
+var ErrLimitReached = errors.New("plan limit reached")
+
+// ErrUnknownPlan is returned by SetPlan for a plan that was never registered.
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// ErrFeatureUnavailable is returned by Require when the plan of the tenant lacks a feature.
+var ErrFeatureUnavailable = errors.New("feature not included in plan")
+
+// Plan is a named set of limits and features that tenants are attached to.
+type Plan struct {
+	Name     string
+	Limits   map[string]int64 // Maximum usage by resource; a missing or zero limit is unlimited
+	Features []string         // Features included in the plan
+}
+
+// Limit returns the limit of a resource, 0 when unlimited.
+func (p *Plan) Limit(resource string) int64 {
+	return p.Limits[resource]
+}
+
+// Has reports whether the plan includes a feature.
+func (p *Plan) Has(feature string) bool {
+	return slices.Contains(p.Features, feature)
+}
+
+// LimitError reports the limit that a change would exceed.
+type LimitError struct {
+	Resource string
+	Plan     string
+	Limit    int64
+	Usage    int64 // Usage before the change
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("plan %q allows %d %s, %d in use", e.Plan, e.Limit, e.Resource, e.Usage)
+}
+
+// Is makes errors.Is(err, ErrLimitReached) match.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitReached
+}
+
+// UsageFunc returns the current usage of a resource by a tenant.
+type UsageFunc func(ctx context.Context, tenantID int64) (int64, error)
+
+var (
+	mu     sync.RWMutex
+	plans  = map[string]*Plan{}
+	usages = map[string]UsageFunc{
+		Members: models.CountTenantMembers,
+		Storage: models.TenantStorageBytes,
+	}
+)
+
+// DefaultPlan names the plan of tenants that have none. When it is empty or not registered,
+// such tenants are unlimited and have every feature.
+var DefaultPlan string
+
+// RegisterPlan declares a plan, replacing any previous one with the same name.
+func RegisterPlan(p Plan) {
+	mu.Lock()
+	defer mu.Unlock()
+	plans[p.Name] = &p
+}
+
+// RegisterUsage declares how the usage of a resource is counted, so that it can be limited by plans.
+func RegisterUsage(resource string, fn UsageFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	usages[resource] = fn
+}
+
+// GetPlan returns a registered plan, or nil.
+func GetPlan(name string) *Plan {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plans[name]
+}
+
+// Plans returns the names of the registered plans, sorted.
+func Plans() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SetPlan attaches a tenant to a registered plan, or to DefaultPlan when plan is "", and emits
+// the subscription.updated event. Billing integrations call it when a subscription changes.
+func SetPlan(ctx context.Context, tenantID int64, plan string) error {
+	if plan != "" && GetPlan(plan) == nil {
+		return ErrUnknownPlan
+	}
+	if err := models.SetTenantPlan(ctx, tenantID, plan); err != nil {
+		return err
+	}
+	events.Publish(ctx, events.Event{
+		Name:     events.SubscriptionUpdated,
+		TenantID: tenantID,
+		Data:     map[string]any{"plan": plan},
+	})
+	return nil
+}
+
+// PlanOf returns the plan applying to a tenant: its own, else DefaultPlan. It returns nil when
+// neither is registered, which leaves the tenant unlimited.
+func PlanOf(t *multitenant.Tenant) *Plan {
+	if t != nil && t.Plan != "" {
+		if p := GetPlan(t.Plan); p != nil {
+			return p
+		}
+	}
+	return GetPlan(DefaultPlan)
+}
+
+// Check reports whether the tenant of the request may grow a resource by delta, e.g.
+// limits.Check(ctx, limits.Members, +1) before adding a member. It returns a *LimitError when
+// the new usage would exceed the plan. Requests without a tenant are never limited.
+func Check(ctx context.Context, resource string, delta int64) error {
+	return CheckTenant(ctx, middleware.FromContext(ctx), resource, delta)
+}
+
+// CheckTenant is Check for an explicit tenant.
+func CheckTenant(ctx context.Context, t *multitenant.Tenant, resource string, delta int64) error {
+	p := PlanOf(t)
+	if p == nil || p.Limit(resource) <= 0 {
+		return nil
+	}
+	mu.RLock()
+	fn := usages[resource]
+	mu.RUnlock()
+	if fn == nil {
+		return fmt.Errorf("limits: no usage registered for %q", resource)
+	}
+	usage, err := fn(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	if usage+delta > p.Limit(resource) {
+		return &LimitError{Resource: resource, Plan: p.Name, Limit: p.Limit(resource), Usage: usage}
+	}
+	return nil
+}
+
+// Enabled reports whether the plan of the request's tenant includes a feature.
+// Tenants without a plan have every feature.
+func Enabled(ctx context.Context, feature string) bool {
+	p := PlanOf(middleware.FromContext(ctx))
+	return p == nil || p.Has(feature)
+}
+
+// Require returns ErrFeatureUnavailable when the plan of the request's tenant lacks a feature.
+func Require(ctx context.Context, feature string) error {
+	if !Enabled(ctx, feature) {
+		return ErrFeatureUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Options configures a Handler.
+type Options struct {
+	// Level is the minimum level of subsystems without their own, e.g. multitenant.LogLevel.
+	Level slog.Leveler
+	// Redact lists attribute and query parameter names whose values are replaced, e.g. "token".
+	Redact []string
+	// Context returns the fields of a record's context, such as its tenant and request ID. Fields
+	// already set on the record are not repeated.
+	Context func(ctx context.Context) []slog.Attr
+}
+
+// Handler filters records by subsystem level, adds their context fields and redacts them before
+// passing them to the wrapped handler, which should accept every level.
+type Handler struct {
+	next slog.Handler
+	opts Options
+}
+
+// NewHandler wraps next, e.g. a slog.JSONHandler writing to stdout.
+func NewHandler(next slog.Handler, opts Options) *Handler {
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	return &Handler{next: next, opts: opts}
+}
+
+// Enabled reports whether any subsystem logs at level; Handle then checks the record's own.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	min := h.opts.Level.Level()
+	if cur := levels.Load(); cur != nil {
+		for _, l := range *cur {
+			if l < min {
+				min = l
+			}
+		}
+	}
+	return level >= min
+}
+
+func (h *Handler) Handle(ctx context.Context, rec slog.Record) error {
+	// Step 1: Level of the subsystem, else of the handler
+	min := h.opts.Level.Level()
+	if l, ok := Level(Subsystem(rec.Message)); ok {
+		min = l
+	}
+	if rec.Level < min {
+		return nil
+	}
+
+	// Step 2: Redact the message and attributes, then add the context fields
+	out := slog.NewRecord(rec.Time, rec.Level, RedactSecrets(rec.Message), rec.PC)
+	seen := map[string]bool{}
+	rec.Attrs(func(a slog.Attr) bool {
+		seen[a.Key] = true
+		out.AddAttrs(h.redact(a))
+		return true
+	})
+	if h.opts.Context != nil && ctx != nil {
+		for _, a := range h.opts.Context(ctx) {
+			if !seen[a.Key] {
+				out.AddAttrs(h.redact(a))
+			}
+		}
+	}
+	return h.next.Handle(ctx, out)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redact(a)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted), opts: h.opts}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name), opts: h.opts}
+}
+
+// redact masks sensitive attributes by name, registered secrets and the sensitive query
+// parameters of URLs, in groups too.
+func (h *Handler) redact(a slog.Attr) slog.Attr {
+	if IsRedacted(a.Key, h.opts.Redact) {
+		return slog.String(a.Key, Redacted)
+	}
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactURL(RedactSecrets(v.String()), h.opts.Redact))
+	case slog.KindGroup:
+		group := v.Group()
+		out := make([]any, len(group))
+		for i, g := range group {
+			out[i] = h.redact(g)
+		}
+		return slog.Group(a.Key, out...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, RedactSecrets(err.Error()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
@@ -0,0 +1,240 @@
+// Package logging is the log handler of tenkit applications behind log/slog. Code keeps logging
+// with slog; the handler adds the tenant, user and request ID of the record's context, applies
+// per-subsystem levels and redacts secrets:
+//
+//	slog.InfoContext(ctx, "[BILLING] Invoice sent", "invoice", id) // Subsystem BILLING
+//	log := logging.For("BILLING")                                   // Same, "[BILLING] " added
+//	logging.SetLevels("SQL=debug,SESSION=warn")                    // TENKIT_LOG_LEVELS
+//
+// The subsystem of a record is the tag that starts its message, as in "[SESSION] ...", or the
+// name given to For.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Redacted replaces the values of sensitive attributes and registered secrets.
+const Redacted = "REDACTED"
+
+// minSecretLen keeps short values, which would mask unrelated text, out of RedactValue.
+const minSecretLen = 8
+
+var (
+	levels  atomic.Pointer[map[string]slog.Level] // By subsystem
+	secrets atomic.Pointer[[]string]
+	mu      sync.Mutex // Serializes the writers of levels and secrets
+)
+
+// ParseLevels reads comma-separated "SUBSYSTEM=level" entries, e.g. "SQL=debug,SESSION=warn".
+// Subsystem names are case-insensitive.
+func ParseLevels(spec string) (map[string]slog.Level, error) {
+	out := map[string]slog.Level{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid entry %q, want SUBSYSTEM=level", entry)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+			return nil, fmt.Errorf("invalid level %q for %s, want debug, info, warn or error", value, name)
+		}
+		out[name] = level
+	}
+	return out, nil
+}
+
+// SetLevels replaces the per-subsystem levels with those of spec, see ParseLevels. Subsystems
+// without a level follow the handler's level.
+func SetLevels(spec string) error {
+	parsed, err := ParseLevels(spec)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	levels.Store(&parsed)
+	mu.Unlock()
+	return nil
+}
+
+// SetLevel sets the level of one subsystem.
+func SetLevel(subsystem string, level slog.Level) {
+	mu.Lock()
+	defer mu.Unlock()
+	next := map[string]slog.Level{}
+	if cur := levels.Load(); cur != nil {
+		for k, v := range *cur {
+			next[k] = v
+		}
+	}
+	next[strings.ToUpper(subsystem)] = level
+	levels.Store(&next)
+}
+
+// Level returns the level of a subsystem, if it has one.
+func Level(subsystem string) (slog.Level, bool) {
+	if cur := levels.Load(); cur != nil {
+		l, ok := (*cur)[strings.ToUpper(subsystem)]
+		return l, ok
+	}
+	return 0, false
+}
+
+// RedactValue registers secret values, such as keys and passwords read from the secrets provider,
+// to be replaced wherever they appear in messages and string attributes. Values shorter than 8
+// bytes are ignored.
+func RedactValue(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	var next []string
+	if cur := secrets.Load(); cur != nil {
+		next = append(next, *cur...)
+	}
+	for _, v := range values {
+		if len(v) >= minSecretLen && !contains(next, v) {
+			next = append(next, v)
+		}
+	}
+	secrets.Store(&next)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactSecrets replaces the registered secrets found in s, for text leaving the process other than
+// through the log handler, such as error reports.
+func RedactSecrets(s string) string {
+	cur := secrets.Load()
+	if cur == nil {
+		return s
+	}
+	for _, v := range *cur {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, Redacted)
+		}
+	}
+	return s
+}
+
+// Subsystem returns the tag that starts a message, "SESSION" for "[SESSION] Resolved user", or "".
+func Subsystem(msg string) string {
+	if !strings.HasPrefix(msg, "[") {
+		return ""
+	}
+	end := strings.IndexByte(msg, ']')
+	if end < 2 {
+		return ""
+	}
+	return strings.ToUpper(msg[1:end])
+}
+
+// IsRedacted reports whether an attribute or query parameter named key holds a sensitive value:
+// its name contains one of redact, case-insensitively.
+func IsRedacted(key string, redact []string) bool {
+	key = strings.ToLower(key)
+	for _, r := range redact {
+		if strings.Contains(key, strings.ToLower(r)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactQuery masks the values of the sensitive parameters of a raw query string.
+func RedactQuery(raw string, redact []string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return "[unparseable]"
+	}
+	changed := false
+	for key := range values {
+		if IsRedacted(key, redact) {
+			values[key] = []string{Redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return raw
+	}
+	return values.Encode()
+}
+
+// redactURL masks the sensitive query parameters of a string holding an absolute URL or a path
+// with a query, such as a verification link.
+func redactURL(s string, redact []string) string {
+	q := strings.IndexByte(s, '?')
+	if q < 0 || strings.ContainsAny(s, " \n") || !(strings.HasPrefix(s, "/") || strings.Contains(s[:q], "://")) {
+		return s
+	}
+	query, fragment, _ := strings.Cut(s[q+1:], "#")
+	redacted := RedactQuery(query, redact)
+	if redacted == query {
+		return s
+	}
+	if fragment != "" {
+		redacted += "#" + fragment
+	}
+	return s[:q+1] + redacted
+}
+
+// For returns a logger of a subsystem: its messages start with "[NAME] " and follow the level of
+// the subsystem. It logs through slog.Default at the time of each record, so package-level loggers
+// can be created before the application installs its handler.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{prefix: "[" + strings.ToUpper(subsystem) + "] "})
+}
+
+// subsystemHandler prefixes messages and passes records to the default handler.
+type subsystemHandler struct {
+	prefix string
+	ops    []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, replayed on the default handler
+}
+
+func (h *subsystemHandler) handler() slog.Handler {
+	out := slog.Default().Handler()
+	for _, op := range h.ops {
+		out = op(out)
+	}
+	return out
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, rec slog.Record) error {
+	rec.Message = h.prefix + rec.Message
+	return h.handler().Handle(ctx, rec)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *subsystemHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	return &subsystemHandler{prefix: h.prefix, ops: append(append([]func(slog.Handler) slog.Handler{}, h.ops...), op)}
+}
@@ -0,0 +1,155 @@
+package mail
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	tkcrypto "github.com/pandamasta/tenkit/multitenant/crypto"
+)
+
+// signedHeaders lists the header fields covered by DKIM signatures.
+var signedHeaders = []string{"From", "To", "Subject", "Date", "Message-ID"}
+
+var wsp = regexp.MustCompile(`[ \t]+`)
+
+// DKIMSigner signs messages for a domain with relaxed/relaxed canonicalization (RFC 6376).
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Key      *rsa.PrivateKey
+}
+
+// Sign returns the DKIM-Signature header for the given headers and encoded body.
+func (s *DKIMSigner) Sign(headers []Header, body []byte) (Header, error) {
+	bodyHash := sha256.Sum256(canonicalBody(body))
+
+	var names []string
+	var canon strings.Builder
+	for _, name := range signedHeaders {
+		for _, h := range headers {
+			if strings.EqualFold(h.Name, name) {
+				canon.WriteString(canonicalHeader(h.Name, h.Value) + "\r\n")
+				names = append(names, strings.ToLower(name))
+				break
+			}
+		}
+	}
+
+	value := fmt.Sprintf("v=1; a=rsa-sha256; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		s.Domain, s.Selector, time.Now().Unix(), strings.Join(names, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	canon.WriteString(canonicalHeader("DKIM-Signature", value))
+
+	digest := sha256.Sum256([]byte(canon.String()))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return Header{}, fmt.Errorf("dkim signing failed: %w", err)
+	}
+	return Header{Name: "DKIM-Signature", Value: value + base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// canonicalHeader applies the "relaxed" header canonicalization.
+func canonicalHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.TrimSpace(wsp.ReplaceAllString(value, " "))
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value
+}
+
+// canonicalBody applies the "relaxed" body canonicalization.
+func canonicalBody(body []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(wsp.ReplaceAllString(l, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// GenerateDKIMKey creates a new 2048-bit RSA key and returns it PEM-encoded.
+func GenerateDKIMKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	der := x509.MarshalPKCS1PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})), nil
+}
+
+// DomainKey returns the DKIM key of a tenant sending domain, stored encrypted with the tenant's data key.
+func DomainKey(ctx context.Context, d *models.EmailDomain) (*rsa.PrivateKey, error) {
+	pemKey, err := tkcrypto.DKIMKey.Decrypt(ctx, d.TenantID, d.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDKIMKey(pemKey)
+}
+
+// ParseDKIMKey decodes a PEM-encoded RSA private key.
+func ParseDKIMKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("invalid DKIM key: no PEM block")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// DKIMRecord returns the DNS name and TXT value to publish for a key.
+func DKIMRecord(domain, selector string, key *rsa.PrivateKey) (name, value string, err error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	return selector + "._domainkey." + domain,
+		"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+}
+
+// LookupTXT is the DNS resolver used by verification; tests and custom setups may replace it.
+var LookupTXT = net.LookupTXT
+
+// VerifyDKIMRecord checks that the published DKIM record matches the key.
+func VerifyDKIMRecord(domain, selector string, key *rsa.PrivateKey) error {
+	name, expected, err := DKIMRecord(domain, selector, key)
+	if err != nil {
+		return err
+	}
+	records, err := LookupTXT(name)
+	if err != nil {
+		return fmt.Errorf("dkim record lookup failed: %w", err)
+	}
+	want := dkimTag(expected, "p")
+	for _, r := range records {
+		if dkimTag(r, "p") == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("no matching DKIM record at %s", name)
+}
+
+// dkimTag extracts a tag value from a "k=v; k=v" record.
+func dkimTag(record, tag string) string {
+	for _, part := range strings.Split(record, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == tag {
+			return strings.Join(strings.Fields(kv[1]), "")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,274 @@
+package mail
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInboundSignature = errors.New("inbound mail: invalid signature")
+	ErrInboundNoHandler = errors.New("inbound mail: no handler for recipient")
+)
+
+// InboundMessage is an email received through a provider webhook.
+type InboundMessage struct {
+	Recipient string // Address the message was delivered to, e.g. "reply+abc@acme.inbound.example.com"
+	From      string
+	Subject   string
+	Text      string
+	HTML      string
+	MessageID string
+	InReplyTo string
+	Headers   map[string]string
+}
+
+// LocalPart returns the recipient before "@", and the "+tag" part split off, if any.
+func (m *InboundMessage) LocalPart() (box, tag string) {
+	local, _, _ := strings.Cut(m.Recipient, "@")
+	box, tag, _ = strings.Cut(strings.ToLower(local), "+")
+	return box, tag
+}
+
+// InboundHandler processes a message addressed to a tenant.
+// tenantID is 0 for messages sent to the inbound domain itself.
+type InboundHandler func(ctx context.Context, tenantID int64, msg *InboundMessage) error
+
+// InboundRouter dispatches messages to handlers by mailbox name (the local part before "+").
+type InboundRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]InboundHandler
+}
+
+// Inbound is the router used by the built-in webhook handlers.
+var Inbound = &InboundRouter{}
+
+// Handle registers fn for messages sent to box@... or box+tag@...
+func (r *InboundRouter) Handle(box string, fn InboundHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.handlers == nil {
+		r.handlers = make(map[string]InboundHandler)
+	}
+	r.handlers[strings.ToLower(box)] = fn
+}
+
+// Dispatch hands the message to the handler registered for its mailbox.
+func (r *InboundRouter) Dispatch(ctx context.Context, tenantID int64, msg *InboundMessage) error {
+	box, _ := msg.LocalPart()
+	r.mu.RLock()
+	fn, ok := r.handlers[box]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrInboundNoHandler
+	}
+	return fn(ctx, tenantID, msg)
+}
+
+// RecipientSubdomain returns the tenant subdomain of a recipient on the inbound domain:
+// "x@acme.inbound.example.com" gives "acme", "x@inbound.example.com" gives "".
+// ok is false when the address is not on the inbound domain.
+func RecipientSubdomain(recipient, inboundDomain string) (sub string, ok bool) {
+	_, domain, found := strings.Cut(strings.ToLower(recipient), "@")
+	inboundDomain = strings.ToLower(inboundDomain)
+	switch {
+	case !found:
+		return "", false
+	case domain == inboundDomain:
+		return "", true
+	case strings.HasSuffix(domain, "."+inboundDomain):
+		sub = strings.TrimSuffix(domain, "."+inboundDomain)
+		return sub, !strings.Contains(sub, ".")
+	}
+	return "", false
+}
+
+// ParseMailgun reads a Mailgun "forward" webhook (parsed message fields) after checking
+// its HMAC signature and that the timestamp is recent.
+func ParseMailgun(r *http.Request, signingKey string, maxMemory int64) (*InboundMessage, error) {
+	if err := r.ParseMultipartForm(maxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	// Step 1: Verify the signature over timestamp + token
+	ts := r.PostFormValue("timestamp")
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(ts + r.PostFormValue("token")))
+	sig, err := hex.DecodeString(r.PostFormValue("signature"))
+	if signingKey == "" || err != nil || !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, ErrInboundSignature
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)).Abs() > 5*time.Minute {
+		return nil, ErrInboundSignature
+	}
+
+	// Step 2: Map the fields
+	msg := &InboundMessage{
+		Recipient: r.PostFormValue("recipient"),
+		From:      r.PostFormValue("from"),
+		Subject:   r.PostFormValue("subject"),
+		Text:      r.PostFormValue("body-plain"),
+		HTML:      r.PostFormValue("body-html"),
+		MessageID: r.PostFormValue("Message-Id"),
+		InReplyTo: r.PostFormValue("In-Reply-To"),
+		Headers:   map[string]string{},
+	}
+	var headers [][2]string
+	if err := json.Unmarshal([]byte(r.PostFormValue("message-headers")), &headers); err == nil {
+		for _, h := range headers {
+			msg.Headers[h[0]] = h[1]
+		}
+	}
+	return msg, nil
+}
+
+// sesNotification is the SNS envelope posted for an SES receipt rule with an SNS action.
+type sesNotification struct {
+	Type         string `json:"Type"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+type sesReceipt struct {
+	Mail struct {
+		Destination []string `json:"destination"`
+	} `json:"mail"`
+	Receipt struct {
+		Recipients []string `json:"recipients"`
+	} `json:"receipt"`
+	Content string `json:"content"` // Raw MIME, base64 encoded
+}
+
+// ErrSESSubscription is returned by ParseSES for SNS subscription confirmations;
+// the caller should confirm by fetching SubscribeURL.
+type ErrSESSubscription struct {
+	SubscribeURL string
+}
+
+func (e *ErrSESSubscription) Error() string { return "inbound mail: SNS subscription confirmation" }
+
+// ParseSES reads an SNS notification carrying an SES receipt with raw content (BASE64 encoding).
+// SNS message signatures are not verified here; protect the endpoint with a secret path or token.
+func ParseSES(body io.Reader) ([]*InboundMessage, error) {
+	var n sesNotification
+	if err := json.NewDecoder(io.LimitReader(body, 20<<20)).Decode(&n); err != nil {
+		return nil, err
+	}
+	if n.Type == "SubscriptionConfirmation" {
+		return nil, &ErrSESSubscription{SubscribeURL: n.SubscribeURL}
+	}
+	if n.Type != "Notification" {
+		return nil, fmt.Errorf("inbound mail: unexpected SNS type %q", n.Type)
+	}
+
+	var rec sesReceipt
+	if err := json.Unmarshal([]byte(n.Message), &rec); err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(rec.Content)
+	if err != nil {
+		return nil, err
+	}
+	base, err := parseMIME(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := rec.Receipt.Recipients
+	if len(recipients) == 0 {
+		recipients = rec.Mail.Destination
+	}
+	out := make([]*InboundMessage, 0, len(recipients))
+	for _, rcpt := range recipients {
+		m := *base
+		m.Recipient = rcpt
+		out = append(out, &m)
+	}
+	return out, nil
+}
+
+// parseMIME extracts headers and the first text/plain and text/html parts of a raw message.
+func parseMIME(raw []byte) (*InboundMessage, error) {
+	m, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		return nil, err
+	}
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		subject = m.Header.Get("Subject")
+	}
+	msg := &InboundMessage{
+		From:      m.Header.Get("From"),
+		Subject:   subject,
+		MessageID: m.Header.Get("Message-Id"),
+		InReplyTo: m.Header.Get("In-Reply-To"),
+		Headers:   map[string]string{},
+	}
+	for k := range m.Header {
+		msg.Headers[k] = m.Header.Get(k)
+	}
+	if err := readParts(msg, m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func readParts(msg *InboundMessage, contentType, encoding string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := readParts(msg, p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	b, err := io.ReadAll(io.LimitReader(body, 5<<20))
+	if err != nil {
+		return err
+	}
+	switch {
+	case mediaType == "text/plain" && msg.Text == "":
+		msg.Text = string(b)
+	case mediaType == "text/html" && msg.HTML == "":
+		msg.HTML = string(b)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package mail sends the emails of tenkit over SMTP and receives inbound mail. Tenants with a
+// verified email domain send as noreply@<domain>, DKIM-signed with a key kept encrypted in the
+// database; the others send as the platform sender.
+//
+// Inbound mail arrives through the Mailgun and Amazon SES webhooks and is addressed to
+// <box>@<tenant>.<INBOUND_MAIL_DOMAIN>; the InboundRouter dispatches it by mailbox to the handlers
+// of the application:
+//
+//	mail.Inbound.Handle("support", func(ctx context.Context, tenantID int64, msg *mail.InboundMessage) error {
+//		return tickets.Create(ctx, tenantID, msg.From, msg.Subject, msg.Text)
+//	})
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Mailer renders and sends messages, choosing the sender identity per tenant.
+// Tenants with a verified email domain send as noreply@<domain>, DKIM-signed with
+// their own key; everyone else falls back to the platform sender.
+type Mailer struct {
+	Transport    Sender
+	PlatformFrom string // e.g. "Tenkit <noreply@example.com>"
+}
+
+// Default is the mailer used by the built-in handlers. It logs messages until replaced.
+var Default = &Mailer{Transport: LogSender{}, PlatformFrom: "Tenkit <noreply@localhost>"}
+
+// Send delivers a platform message.
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	if msg.RequestID == "" {
+		msg.RequestID = models.RequestIDFromContext(ctx)
+		recordNotice(ctx, 0, msg)
+	}
+	if msg.From == "" {
+		msg.From = m.PlatformFrom
+	}
+	raw, err := msg.Bytes(nil)
+	if err != nil {
+		return err
+	}
+	return m.Transport.Send(ctx, addressOf(msg.From), recipients(msg.To), raw)
+}
+
+// SendTenant delivers a message on behalf of a tenant.
+func (m *Mailer) SendTenant(ctx context.Context, tenantID int64, tenantName string, msg Message) error {
+	if msg.RequestID == "" {
+		msg.RequestID = models.RequestIDFromContext(ctx)
+		recordNotice(ctx, tenantID, msg)
+	}
+	d, err := models.GetEmailDomain(ctx, tenantID)
+	if err != nil {
+		slog.Error("[MAIL] Failed to load tenant email domain, using platform sender", "tenant_id", tenantID, "err", err)
+	}
+	if d == nil || !d.IsVerified {
+		return m.Send(ctx, msg)
+	}
+
+	key, err := DomainKey(ctx, d)
+	if err != nil {
+		slog.Error("[MAIL] Invalid tenant DKIM key, using platform sender", "tenant_id", tenantID, "err", err)
+		return m.Send(ctx, msg)
+	}
+	msg.From = fmt.Sprintf("%s <noreply@%s>", tenantName, d.Domain)
+	raw, err := msg.Bytes(&DKIMSigner{Domain: d.Domain, Selector: d.Selector, Key: key})
+	if err != nil {
+		return err
+	}
+	return m.Transport.Send(ctx, addressOf(msg.From), recipients(msg.To), raw)
+}
+
+// recordNotice records the support code quoted by a failure notice, unless the request already
+// recorded it on an error page.
+func recordNotice(ctx context.Context, tenantID int64, msg Message) {
+	if !msg.IsError || msg.RequestID == "" {
+		return
+	}
+	ref := models.SupportRef{Code: models.SupportCode(msg.RequestID), RequestID: msg.RequestID, TenantID: tenantID, Path: "mail: " + msg.Subject}
+	if err := models.RecordSupportRef(ctx, ref); err != nil {
+		slog.ErrorContext(ctx, "[MAIL] Failed to record support code", "code", ref.Code, "err", err)
+	}
+}
+
+func recipients(to []string) []string {
+	out := make([]string, len(to))
+	for i, addr := range to {
+		out[i] = addressOf(addr)
+	}
+	return out
+}
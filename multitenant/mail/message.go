@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	From    string // RFC 5322 address, e.g. "Club <noreply@club.example.com>"; filled by the Mailer if empty
+	To      []string
+	Subject string
+	Text    string
+	// RequestID is the request the message was sent from, filled by the Mailer from the context.
+	// It is sent as X-Request-ID with the matching X-Support-Code.
+	RequestID string
+	// IsError marks failure notices, whose text ends with the request ID and support code
+	// so that recipients can quote them to support.
+	IsError bool
+}
+
+// Header is a single message header field.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// headers returns the header fields of the message in output order.
+func (m *Message) headers() ([]Header, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	to := make([]string, 0, len(m.To))
+	for _, addr := range m.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", addr, err)
+		}
+		to = append(to, a.String())
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	headers := []Header{
+		{"From", from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+	if m.RequestID != "" {
+		headers = append(headers,
+			Header{"X-Request-ID", m.RequestID},
+			Header{"X-Support-Code", models.SupportCode(m.RequestID)})
+	}
+	return headers, nil
+}
+
+// body returns the quoted-printable body with CRLF line endings.
+func (m *Message) body() ([]byte, error) {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	text := strings.ReplaceAll(m.Text, "\r\n", "\n")
+	if m.IsError && m.RequestID != "" {
+		text = fmt.Sprintf("%s\n\n--\nRequest ID: %s\nSupport code: %s\n", strings.TrimRight(text, "\n"), m.RequestID, models.SupportCode(m.RequestID))
+	}
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Bytes renders the message, DKIM-signing it when a signer is given.
+func (m *Message) Bytes(signer *DKIMSigner) ([]byte, error) {
+	headers, err := m.headers()
+	if err != nil {
+		return nil, err
+	}
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		sig, err := signer.Sign(headers, body)
+		if err != nil {
+			return nil, err
+		}
+		headers = append([]Header{sig}, headers...)
+	}
+
+	var buf bytes.Buffer
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.Name, h.Value)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// addressOf extracts the bare email address from an RFC 5322 address.
+func addressOf(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Address
+	}
+	return s
+}
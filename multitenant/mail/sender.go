@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"context"
+	"log/slog"
+	"net/smtp"
+	"strings"
+)
+
+// Sender delivers an already rendered message.
+type Sender interface {
+	Send(ctx context.Context, from string, to []string, raw []byte) error
+}
+
+// SMTPSender delivers messages through an SMTP relay.
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, from string, to []string, raw []byte) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host := s.Addr
+		if i := strings.LastIndex(host, ":"); i != -1 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, from, to, raw)
+}
+
+// LogSender writes messages to the log instead of sending them. It is the development default.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, from string, to []string, raw []byte) error {
+	slog.Info("[MAIL] Message not sent (log transport)", "from", from, "to", to, "message", string(raw))
+	return nil
+}
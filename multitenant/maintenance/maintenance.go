@@ -0,0 +1,157 @@
+// Package maintenance keeps track of the maintenance windows of the platform and of tenants, set
+// by configuration (MAINTENANCE_MODE, MAINTENANCE_TENANTS) or at runtime by operators through the
+// tenkit command and the platform API. middleware.Maintenance serves the maintenance page while a
+// window is open:
+//
+//	maintenance.Start(ctx, 0, "Database upgrade", 30*time.Minute, userID) // Whole platform
+//	maintenance.End(ctx, tenantID)
+package maintenance
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// Sources of a maintenance window.
+const (
+	SourceConfig   = "config"   // MAINTENANCE_MODE or MAINTENANCE_TENANTS
+	SourceOperator = "operator" // Started at runtime
+)
+
+// Window is a maintenance window in progress.
+type Window struct {
+	TenantID   int64         // 0 for the platform, and for tenants of MAINTENANCE_TENANTS
+	Subdomain  string        // Empty for the platform
+	Message    string        // Empty for the default text of the page
+	RetryAfter time.Duration // 0 leaves Retry-After out
+	Since      time.Time     // Zero for windows set by configuration
+	Source     string
+}
+
+var (
+	mu       sync.RWMutex
+	config   multitenant.MaintenanceConfig
+	platform *models.Maintenance
+	tenants  = map[int64]models.Maintenance{}
+)
+
+// Configure applies the maintenance settings of the configuration.
+func Configure(cfg multitenant.MaintenanceConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	config = cfg
+	config.Tenants = append([]string(nil), cfg.Tenants...)
+}
+
+// Load reads the windows started at runtime. Start calls it periodically, so that windows started
+// by another process, such as the tenkit command, apply within a few seconds.
+func Load(ctx context.Context) error {
+	list, err := models.ListMaintenance(ctx)
+	if err != nil {
+		return err
+	}
+	var p *models.Maintenance
+	byTenant := map[int64]models.Maintenance{}
+	for i, m := range list {
+		if m.TenantID == 0 {
+			p = &list[i]
+		} else {
+			byTenant[m.TenantID] = m
+		}
+	}
+	mu.Lock()
+	platform, tenants = p, byTenant
+	mu.Unlock()
+	return nil
+}
+
+// Start opens a maintenance window on the platform (tenantID 0) or a tenant, or changes the message
+// and Retry-After of the one in progress.
+func Start(ctx context.Context, tenantID int64, message string, retryAfter time.Duration, startedBy int64) error {
+	if err := models.StartMaintenance(ctx, tenantID, message, retryAfter, startedBy); err != nil {
+		return err
+	}
+	return Load(ctx)
+}
+
+// End closes the maintenance window started at runtime on the platform (tenantID 0) or a tenant;
+// it reports whether one was open. Windows set by configuration stay until the setting changes.
+func End(ctx context.Context, tenantID int64) (bool, error) {
+	ended, err := models.EndMaintenance(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+	return ended, Load(ctx)
+}
+
+// Platform returns the window of the whole platform, if one is open.
+func Platform() (Window, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if platform != nil {
+		return operatorWindow(*platform), true
+	}
+	if config.Enabled {
+		return configWindow(""), true
+	}
+	return Window{}, false
+}
+
+// Tenant returns the window that applies to t: the platform's, else the tenant's own.
+func Tenant(t *multitenant.Tenant) (Window, bool) {
+	if w, ok := Platform(); ok || t == nil {
+		return w, ok
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if m, ok := tenants[t.ID]; ok {
+		return operatorWindow(m), true
+	}
+	for _, sub := range config.Tenants {
+		if sub == t.Subdomain {
+			w := configWindow(sub)
+			w.TenantID = t.ID
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// Windows returns the windows in progress, the platform's first, then by tenant.
+func Windows() []Window {
+	mu.RLock()
+	defer mu.RUnlock()
+	var out []Window
+	if platform != nil {
+		out = append(out, operatorWindow(*platform))
+	} else if config.Enabled {
+		out = append(out, configWindow(""))
+	}
+	ids := make([]int64, 0, len(tenants))
+	for id := range tenants {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		out = append(out, operatorWindow(tenants[id]))
+	}
+	for _, sub := range config.Tenants {
+		out = append(out, configWindow(sub))
+	}
+	return out
+}
+
+func operatorWindow(m models.Maintenance) Window {
+	return Window{TenantID: m.TenantID, Subdomain: m.Subdomain, Message: m.Message, RetryAfter: m.RetryAfter, Since: m.StartedAt, Source: SourceOperator}
+}
+
+// configWindow returns the window MAINTENANCE_MODE or MAINTENANCE_TENANTS opens for subdomain, ""
+// for the platform. It must be called with mu held.
+func configWindow(subdomain string) Window {
+	return Window{Subdomain: subdomain, Message: config.Message, RetryAfter: config.RetryAfter, Source: SourceConfig}
+}
@@ -0,0 +1,67 @@
+package multitenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/events"
+)
+
+// Member creation errors.
+var (
+	ErrInvalidRole = errors.New("unknown role")
+	ErrUserExists  = models.ErrUserExists
+)
+
+// MemberRequest describes a user added to a tenant by one of its admins or by the platform.
+type MemberRequest struct {
+	Config    *Config // Roles and set-password link lifetime
+	TenantID  int64
+	Email     string
+	Role      string // Defaults to Config.Roles.Default
+	CreatedBy int64  // Admin adding the user, 0 for the platform
+}
+
+// NewMember is a user created by CreateMember.
+type NewMember struct {
+	UserID int64
+	Email  string
+	Role   string
+	Token  string // Single-use token of the set-password link, /reset?token=<Token>
+}
+
+// CreateMember creates a verified user with an active membership and no password, and mints the
+// token of the link through which they choose one; it is valid for Config.SetupExpiry. Callers
+// mail the link and check the member limit of the tenant's plan beforehand. It returns
+// ErrInvalidEmail, ErrInvalidRole or ErrUserExists for requests that cannot succeed.
+func CreateMember(ctx context.Context, req MemberRequest) (*NewMember, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	role := req.Role
+	if role == "" {
+		role = req.Config.Roles.Default
+	}
+	if !ValidEmail(email) {
+		return nil, ErrInvalidEmail
+	}
+	if _, ok := req.Config.Roles.Get(role); !ok {
+		return nil, ErrInvalidRole
+	}
+
+	userID, err := models.CreateUser(ctx, req.TenantID, email, "", role)
+	if err != nil {
+		return nil, err
+	}
+	token, err := models.CreatePasswordReset(ctx, userID, req.TenantID, req.Config.SetupExpiry)
+	if err != nil {
+		return nil, err
+	}
+	events.Publish(ctx, events.Event{
+		Name:     events.MemberCreated,
+		TenantID: req.TenantID,
+		UserID:   userID,
+		Data:     map[string]any{"email": email, "role": role, "created_by": req.CreatedBy},
+	})
+	return &NewMember{UserID: userID, Email: email, Role: role, Token: token}, nil
+}
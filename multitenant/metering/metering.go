@@ -0,0 +1,138 @@
+// Package metering records usage per tenant and day, such as requests served, active users and bytes
+// stored, for reporting and usage-based billing. Counters are buffered in memory and written by Flush;
+// Aggregate derives the meters computed from other tables.
+package metering
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Built-in meters.
+const (
+	Requests     = "requests"      // HTTP requests served on the tenant, counted by middleware.Metering
+	ActiveUsers  = "active_users"  // Distinct signed-in users seen during the day
+	StorageBytes = "storage_bytes" // Bytes stored for the tenant, as of the last aggregation of the day
+)
+
+// meterRegex restricts meter names to short dotted names such as "reports.generated".
+var meterRegex = regexp.MustCompile(`^[a-z0-9_.]{1,64}$`)
+
+// ValidMeter reports whether name can be used as a meter.
+func ValidMeter(name string) bool {
+	return meterRegex.MatchString(name)
+}
+
+// Day returns the UTC day that usage at t is accounted to, as stored: YYYY-MM-DD.
+func Day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+type counterKey struct {
+	tenantID int64
+	day      string
+	meter    string
+}
+
+var (
+	mu       sync.Mutex
+	counters = map[counterKey]int64{}
+	seen     = map[models.ActiveUser]struct{}{}
+)
+
+// Add increments a counter meter of a tenant for today, e.g. metering.Add(t.ID, "invoices.sent", 1).
+// The increment is buffered until the next Flush, so it costs no query.
+func Add(tenantID int64, meter string, n int64) {
+	if tenantID <= 0 || n == 0 {
+		return
+	}
+	if !ValidMeter(meter) {
+		slog.Warn("[METERING] Invalid meter name", "meter", meter)
+		return
+	}
+	k := counterKey{tenantID: tenantID, day: Day(time.Now()), meter: meter}
+	mu.Lock()
+	counters[k] += n
+	mu.Unlock()
+}
+
+// Seen marks a user as active on a tenant today.
+func Seen(tenantID, userID int64) {
+	if tenantID <= 0 || userID <= 0 {
+		return
+	}
+	u := models.ActiveUser{TenantID: tenantID, Day: Day(time.Now()), UserID: userID}
+	mu.Lock()
+	seen[u] = struct{}{}
+	mu.Unlock()
+}
+
+// Set records the level of a meter for a tenant today, replacing any previous value of the day.
+// It is meant for meters that measure a quantity, such as seats or projects, rather than count events.
+func Set(ctx context.Context, tenantID int64, meter string, value int64) error {
+	if !ValidMeter(meter) {
+		return fmt.Errorf("metering: invalid meter name %q", meter)
+	}
+	return models.SetUsage(ctx, []models.UsageRecord{{TenantID: tenantID, Day: Day(time.Now()), Meter: meter, Value: value}})
+}
+
+// Flush writes the buffered counters and active users. What could not be written is kept for the next flush.
+func Flush(ctx context.Context) error {
+	mu.Lock()
+	pending, active := counters, seen
+	counters, seen = map[counterKey]int64{}, map[models.ActiveUser]struct{}{}
+	mu.Unlock()
+
+	records := make([]models.UsageRecord, 0, len(pending))
+	for k, n := range pending {
+		records = append(records, models.UsageRecord{TenantID: k.tenantID, Day: k.day, Meter: k.meter, Value: n})
+	}
+	users := make([]models.ActiveUser, 0, len(active))
+	for u := range active {
+		users = append(users, u)
+	}
+
+	err := models.AddUsage(ctx, records)
+	if err != nil {
+		mu.Lock()
+		for k, n := range pending {
+			counters[k] += n
+		}
+		mu.Unlock()
+	}
+	if uerr := models.RecordActiveUsers(ctx, users); uerr != nil {
+		mu.Lock()
+		for u := range active {
+			seen[u] = struct{}{}
+		}
+		mu.Unlock()
+		if err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// Aggregate flushes the buffers, then computes the active users of the day of now and snapshots the
+// bytes stored. The previous day's active users are counted again so that its last hours are not lost at midnight.
+func Aggregate(ctx context.Context, now time.Time) error {
+	if err := Flush(ctx); err != nil {
+		return err
+	}
+	today, yesterday := Day(now), Day(now.AddDate(0, 0, -1))
+	for _, day := range []string{yesterday, today} {
+		if err := models.CountActiveUsers(ctx, day, ActiveUsers); err != nil {
+			return err
+		}
+	}
+	if err := models.SnapshotStorageUsage(ctx, today, StorageBytes); err != nil {
+		return err
+	}
+	return models.PruneActiveUsers(ctx, yesterday)
+}
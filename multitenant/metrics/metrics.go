@@ -0,0 +1,110 @@
+// Package metrics keeps in-process counters and exposes them in the Prometheus text format,
+// without depending on a client library.
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CounterVec is a monotonically increasing counter partitioned by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64 // Keyed by the rendered label set
+}
+
+var registry = struct {
+	sync.Mutex
+	counters []*CounterVec
+}{}
+
+// NewCounterVec registers a counter exported by Handler.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: map[string]uint64{}}
+	registry.Lock()
+	registry.counters = append(registry.counters, c)
+	registry.Unlock()
+	return c
+}
+
+// Inc adds one to the series of the given label values, in the order of the label names.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n to the series of the given label values.
+func (c *CounterVec) Add(n uint64, values ...string) {
+	key := c.labelSet(values)
+	c.mu.Lock()
+	c.values[key] += n
+	c.mu.Unlock()
+}
+
+// Value returns the current value of a series.
+func (c *CounterVec) Value(values ...string) uint64 {
+	key := c.labelSet(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) labelSet(values []string) string {
+	parts := make([]string, len(c.labels))
+	for i, name := range c.labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, escapeLabel(v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *CounterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(w, "%s %d\n", c.name, c.values[k])
+		} else {
+			fmt.Fprintf(w, "%s{%s} %d\n", c.name, k, c.values[k])
+		}
+	}
+	c.mu.Unlock()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Handler serves every registered counter. When token is set, requests must carry it as a
+// bearer token; otherwise the endpoint should only be reachable from the monitoring network.
+func Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if token != "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.Lock()
+		defer registry.Unlock()
+		for _, c := range registry.counters {
+			c.writeTo(w)
+		}
+	})
+}
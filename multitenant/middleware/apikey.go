@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/ratelimit"
+	"github.com/pandamasta/tenkit/multitenant/security"
+)
+
+// APIKeyAuth authenticates API requests with a tenant key sent as "Authorization: Bearer <key>"
+// or "X-API-Key", and enforces the requests-per-minute limit of the key's tier.
+// Responses carry X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset; throttled
+// requests get 429 with Retry-After. On a tenant subdomain only that tenant's keys are accepted.
+func APIKeyAuth(cfg *multitenant.Config, limiter ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Extract and look up the key
+		secret := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); secret == "" && strings.HasPrefix(auth, "Bearer ") {
+			secret = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			WriteError(w, r, ErrAPIKeyRequired)
+			return
+		}
+		key, err := models.GetAPIKeyBySecret(r.Context(), secret)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[APIKEY] Lookup failed", "err", err)
+			WriteError(w, r, WrapErr(ErrInternal, "API key lookup"))
+			return
+		}
+		if key == nil {
+			slog.WarnContext(r.Context(), "[APIKEY] Unknown or revoked key", "ip", ClientIP(r))
+			WriteError(w, r, ErrInvalidAPIKey)
+			return
+		}
+		if t := FromContext(r.Context()); t != nil && t.ID != key.TenantID {
+			slog.WarnContext(r.Context(), "[APIKEY] Key used on another tenant", "key_id", key.ID, "tenant", t.Subdomain)
+			WriteError(w, r, ErrInvalidAPIKey)
+			return
+		}
+
+		// Step 2: Enforce the tier limit
+		res, err := limiter.Allow(r.Context(), "apikey|"+strconv.FormatInt(key.ID, 10), ratelimit.PerMinute(cfg.APIRateLimit(key.Tier)))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[APIKEY] Limiter failed", "key_id", key.ID, "err", err)
+			res = ratelimit.Result{Allowed: true}
+		} else {
+			setRateLimitHeaders(w, res)
+		}
+		if err := models.RecordAPIKeyUsage(r.Context(), key.ID, !res.Allowed); err != nil {
+			slog.ErrorContext(r.Context(), "[APIKEY] Failed to record usage", "key_id", key.ID, "err", err)
+		}
+		if !res.Allowed {
+			EmitSecurityEvent(r, security.RateLimited, "api key "+key.Prefix+" ("+key.Tier+")")
+			WriteError(w, r, ErrRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey, key)))
+	})
+}
+
+// APIKeyFromContext returns the key that authenticated the request, or nil.
+func APIKeyFromContext(ctx context.Context) *models.APIKey {
+	k, _ := ctx.Value(apiKeyKey).(*models.APIKey)
+	return k
+}
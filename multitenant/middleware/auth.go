@@ -1,17 +1,113 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
+	"net/url"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
 )
 
 // RequireAuth ensures the user is logged in
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := CurrentUser(r)
+		user := authUser(r)
 		if user == nil {
-			http.Redirect(w, r, "/login?error=auth", http.StatusSeeOther)
+			redirectToLogin(w, r)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireTenant answers 404 outside tenant hosts, for routes that only make sense on a tenant.
+func RequireTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) == nil {
+			WriteError(w, r, ErrNoTenant)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole ensures the user is logged in and holds one of the given roles.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := authUser(r)
+			if user == nil {
+				redirectToLogin(w, r)
+				return
+			}
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			WriteError(w, r, ErrForbidden)
+		})
+	}
+}
+
+// RequireMinRole ensures the user is logged in and holds min or a higher ranked role.
+func RequireMinRole(cfg *multitenant.Config, min string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := authUser(r)
+			if user == nil {
+				redirectToLogin(w, r)
+				return
+			}
+			if !cfg.Roles.Allows(user.Role, min) {
+				slog.InfoContext(r.Context(), "[AUTH] Role too low", "user_id", user.ID, "role", user.Role, "required", min)
+				WriteError(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePlatformAdmin ensures the user is logged in and listed in TENKIT_PLATFORM_ADMINS.
+func RequirePlatformAdmin(cfg *multitenant.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := authUser(r)
+			if user == nil {
+				redirectToLogin(w, r)
+				return
+			}
+			if !cfg.IsPlatformAdmin(user.Email) {
+				slog.WarnContext(r.Context(), "[AUTH] Platform admin access denied", "user_id", user.ID, "path", r.URL.Path)
+				WriteError(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authUser returns the logged-in user when they belong to the tenant of the request, nil otherwise.
+// SessionMiddleware already ignores the sessions of other tenants; this holds for chains that
+// resolve the user before the tenant too.
+func authUser(r *http.Request) *models.User {
+	user := CurrentUser(r)
+	if t := FromContext(r.Context()); user != nil && t != nil && user.TenantID != t.ID {
+		slog.WarnContext(r.Context(), "[AUTH] Session of another tenant", "user_id", user.ID, "tenant_id", t.ID, "user_tenant_id", user.TenantID)
+		return nil
+	}
+	return user
+}
+
+// redirectToLogin sends a visitor who is not signed in to /login. For pages, the login then brings
+// them back to the page they asked for, through its "next" parameter.
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	target := "/login?error=auth"
+	if isPageRequest(r) && r.Header.Get("HX-Request") != "true" {
+		target += "&next=" + url.QueryEscape(LangPath(r.Context(), r.URL.RequestURI()))
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
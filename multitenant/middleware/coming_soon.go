@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// comingSoonOpenPaths stay reachable in coming-soon mode so members can still sign in.
+var comingSoonOpenPaths = []string{"/login", "/logout", "/forgot", "/reset", "/impersonate", "/lang", "/static/", "/branding/", "/favicon.ico", "/manifest.webmanifest"}
+
+// ComingSoon serves the placeholder to anonymous visitors of tenants in soft launch mode.
+// Members of the tenant browse normally. It must run after TenantMiddleware and SessionMiddleware.
+func ComingSoon(placeholder http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		if t == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user := CurrentUser(r); user != nil && user.TenantID == t.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range comingSoonOpenPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		settings, err := models.GetLaunchSettings(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[LAUNCH] Failed to load launch settings", "tenant", t.Subdomain, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if settings == nil || !settings.ComingSoon {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slog.DebugContext(r.Context(), "[LAUNCH] Serving coming-soon page", "tenant", t.Subdomain, "path", r.URL.Path)
+		w.Header().Set("X-Robots-Tag", "noindex")
+		placeholder.ServeHTTP(w, r)
+	})
+}
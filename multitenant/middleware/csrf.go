@@ -3,67 +3,124 @@ package middleware
 import (
 	"context"
 	"crypto/rand"
-	"crypto/subtle"
 	"encoding/base64"
 	"log/slog"
+	"mime"
 	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+	"github.com/pandamasta/tenkit/multitenant/security"
+	"github.com/pandamasta/tenkit/multitenant/utils"
 )
 
-func CSRFMiddleware(next http.Handler) http.Handler {
+// CSRFMiddleware implements signed double-submit protection.
+// A random secret lives in the CSRF cookie; the token handed to forms is an HMAC of that
+// secret and the session cookie, so a token is only valid for the session it was rendered in.
+// Unsafe requests must send the token in the configured header or form field.
+func CSRFMiddleware(cfg *multitenant.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Try to get existing CSRF cookie
-		var token string
-		cookie, err := r.Cookie("csrf_token")
+		for _, prefix := range cfg.CSRF.ExemptPaths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				slog.DebugContext(r.Context(), "[CSRF] Path exempt", "path", r.URL.Path)
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// Step 1: Load or create the per-browser secret
+		var secret string
+		cookie, err := r.Cookie(cfg.CSRF.CookieName)
 		if err != nil || cookie.Value == "" {
-			// No valid cookie, generate one
-			token, err = generateCSRFToken()
+			secret, err = generateCSRFSecret()
 			if err != nil {
-				slog.Error("[CSRF] Token generation failed", "error", err)
-				http.Error(w, "Internal error", http.StatusInternalServerError)
+				slog.ErrorContext(r.Context(), "[CSRF] Secret generation failed", "error", err)
+				WriteError(w, r, WrapErr(ErrInternal, "CSRF secret generation"))
 				return
 			}
-
-			http.SetCookie(w, &http.Cookie{
-				Name:     "csrf_token",
-				Value:    token,
-				HttpOnly: true,
-				Secure:   false,
-				SameSite: http.SameSiteStrictMode,
-			})
-			slog.Info("[CSRF] CSRF token created and set", "path", r.URL.Path)
+			cookies.Set(w, r, cfg.CSRF.Cookie(), secret, 0)
+			slog.DebugContext(r.Context(), "[CSRF] CSRF secret created and set", "path", r.URL.Path)
 		} else {
-			token = cookie.Value
-			slog.Debug("[CSRF] Reusing existing CSRF token", "path", r.URL.Path)
+			secret = cookie.Value
 		}
 
-		// Store in context for GET handler
-		ctx := context.WithValue(r.Context(), CsrfKey, token)
-		r = r.WithContext(ctx)
+		// Step 2: Derive the token bound to the current session
+		session := ""
+		if c, err := r.Cookie(cfg.SessionCookie.Name); err == nil {
+			session = c.Value
+		}
+		token := csrfToken(secret, session)
+		r = r.WithContext(context.WithValue(r.Context(), CsrfKey, token))
 
-		// If it's a modifying request, verify token
-		if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodDelete {
-			formToken := r.FormValue("csrf_token")
-			if formToken == "" {
-				slog.Warn("[CSRF] Missing CSRF token in form", "path", r.URL.Path)
-				http.Error(w, "CSRF token missing in form", http.StatusForbidden)
+		// Step 3: Verify unsafe requests
+		if !isSafeMethod(r.Method) {
+			submitted := submittedCSRFToken(cfg, r)
+			if submitted == "" {
+				EmitSecurityEvent(r, security.CSRFFailure, "missing token")
+				WriteError(w, r, ErrCSRFMissing)
 				return
 			}
-			if subtle.ConstantTimeCompare([]byte(token), []byte(formToken)) != 1 {
-				slog.Warn("[CSRF] Invalid CSRF token", "path", r.URL.Path)
-				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			if !validCSRFToken(secret, session, submitted) {
+				EmitSecurityEvent(r, security.CSRFFailure, "invalid token")
+				WriteError(w, r, ErrCSRFInvalid)
 				return
 			}
-			slog.Info("[CSRF] Valid CSRF token", "path", r.URL.Path)
+			slog.DebugContext(r.Context(), "[CSRF] Valid CSRF token", "path", r.URL.Path)
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func generateCSRFToken() (string, error) {
+// submittedCSRFToken reads the token from the header, then from the form body.
+// Multipart bodies are parsed with the configured memory limit and stay available to the handler.
+func submittedCSRFToken(cfg *multitenant.Config, r *http.Request) string {
+	if v := r.Header.Get(cfg.CSRF.HeaderName); v != "" {
+		return v
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(cfg.CSRF.MaxMemory); err != nil {
+			slog.Warn("[CSRF] Failed to parse multipart form", "err", err)
+			return ""
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			slog.Warn("[CSRF] Failed to parse form", "err", err)
+			return ""
+		}
+	default:
+		return "" // JSON and other bodies must use the header
+	}
+	return r.PostFormValue(cfg.CSRF.FieldName)
+}
+
+func csrfToken(secret, session string) string {
+	return base64.RawURLEncoding.EncodeToString(utils.MAC("csrf|" + secret + "|" + session))
+}
+
+func validCSRFToken(secret, session, submitted string) bool {
+	mac, err := base64.RawURLEncoding.DecodeString(submitted)
+	if err != nil {
+		return false
+	}
+	return utils.VerifyMAC("csrf|"+secret+"|"+session, mac)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func generateCSRFSecret() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(b), nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
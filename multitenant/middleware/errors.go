@@ -1,15 +1,239 @@
 package middleware
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+	tkerrors "github.com/pandamasta/tenkit/multitenant/errors"
+)
 
 var (
 	ErrInvalidDomain = fmt.Errorf("invalid domain")
 	ErrNoTenant      = fmt.Errorf("no tenant found")
 	ErrFetchTenant   = fmt.Errorf("failed to fetch tenant")
 	ErrInvalidInput  = fmt.Errorf("invalid input")
+
+	ErrUnauthorized   = fmt.Errorf("authentication required")
+	ErrForbidden      = fmt.Errorf("forbidden")
+	ErrNotFound       = fmt.Errorf("not found")
+	ErrAPIKeyRequired = fmt.Errorf("API key required")
+	ErrInvalidAPIKey  = fmt.Errorf("invalid API key")
+	ErrCSRFMissing    = fmt.Errorf("CSRF token missing")
+	ErrCSRFInvalid    = fmt.Errorf("invalid CSRF token")
+	ErrRateLimited    = fmt.Errorf("too many requests")
+	ErrInternal       = fmt.Errorf("internal error")
 )
 
 // Wrap for context
 func WrapErr(err error, msg string) error {
 	return fmt.Errorf("%s: %w", msg, err)
 }
+
+// errorKind is the response of a typed error: its status, problem code and message key.
+type errorKind struct {
+	err    error
+	status int
+	code   string
+	key    string
+}
+
+// errorKinds maps the typed errors to their responses; WriteError matches them with errors.Is.
+var errorKinds = []errorKind{
+	{ErrInvalidDomain, http.StatusNotFound, "invalid_domain", "error.invalid_domain"},
+	{ErrNoTenant, http.StatusNotFound, "no_tenant", "error.no_tenant"},
+	{ErrFetchTenant, http.StatusInternalServerError, "internal", "error.internal"},
+	{ErrInvalidInput, http.StatusBadRequest, "invalid_input", "error.invalid_input"},
+	{ErrUnauthorized, http.StatusUnauthorized, "unauthorized", "error.unauthorized"},
+	{ErrForbidden, http.StatusForbidden, "forbidden", "error.forbidden"},
+	{ErrNotFound, http.StatusNotFound, "not_found", "error.not_found"},
+	{ErrAPIKeyRequired, http.StatusUnauthorized, "api_key_required", "error.api_key_required"},
+	{ErrInvalidAPIKey, http.StatusUnauthorized, "invalid_api_key", "error.invalid_api_key"},
+	{ErrCSRFMissing, http.StatusForbidden, "csrf_missing", "error.csrf_missing"},
+	{ErrCSRFInvalid, http.StatusForbidden, "csrf_invalid", "error.csrf_invalid"},
+	{ErrRateLimited, http.StatusTooManyRequests, "rate_limited", "error.rate_limited"},
+	{ErrInternal, http.StatusInternalServerError, "internal", "error.internal"},
+}
+
+// ErrorTranslator localizes the titles and messages of error responses.
+type ErrorTranslator interface {
+	T(key, lang string, args ...any) string
+}
+
+// ErrorMessages translates error responses; set it at startup, e.g. to the application's *i18n.I18n.
+// Without it, they are answered in English.
+var ErrorMessages ErrorTranslator
+
+// ErrorPage renders the HTML error page of browser requests; nil renders a minimal built-in page.
+var ErrorPage func(w http.ResponseWriter, r *http.Request, p *Problem)
+
+// Problem is an RFC 7807 problem detail. Code, RequestID and SupportCode are extension members:
+// a stable machine-readable code and what users quote to support.
+type Problem struct {
+	Type        string `json:"type"`
+	Title       string `json:"title"`
+	Status      int    `json:"status"`
+	Detail      string `json:"detail,omitempty"`
+	Instance    string `json:"instance,omitempty"`
+	Code        string `json:"code"`
+	RequestID   string `json:"request_id,omitempty"`
+	SupportCode string `json:"support_code,omitempty"`
+}
+
+// WriteError answers err according to its type: application/problem+json for API requests, a
+// localized HTML page for browsers, plain text otherwise. Errors of no known type answer 500; their
+// text is logged and passed to the error reporter with those of the other 5xx answers, not shown.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, true)
+}
+
+// writeError is WriteError; Recover reports its panics itself.
+func writeError(w http.ResponseWriter, r *http.Request, err error, reportErr bool) {
+	kind := errorKinds[len(errorKinds)-1]
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			kind = k
+			break
+		}
+	}
+	if kind.status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "[ERROR] Request failed", "path", r.URL.Path, "err", err)
+		if reportErr {
+			report(r, tkerrors.Report{Err: err, Stack: tkerrors.Stack(2)})
+		}
+	}
+	detail := kind.err.Error()
+	if ErrorMessages != nil {
+		detail = ErrorMessages.T(kind.key, requestLang(r))
+	}
+	writeProblem(w, r, kind.status, kind.code, detail)
+}
+
+// Error answers msg with the given status through the same rendering as WriteError, with the request
+// ID and support code so users can quote them in reports. msg is shown as is.
+func Error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	writeProblem(w, r, code, statusCode(code), msg)
+}
+
+// APIError is Error with an explicit problem code, for API handlers.
+func APIError(w http.ResponseWriter, r *http.Request, code, msg string, status int) {
+	writeProblem(w, r, status, code, msg)
+}
+
+// statusCode derives a problem code from a status, e.g. "not_found" from 404.
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// writeProblem renders the problem in the format the client takes.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	p := &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+	if ErrorMessages != nil {
+		if title := ErrorMessages.T(fmt.Sprintf("error.title.%d", status), requestLang(r)); !strings.HasPrefix(title, "error.") {
+			p.Title = title
+		}
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		p.RequestID, p.SupportCode = id, SupportCode(r, status)
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch errorFormat(r) {
+	case "json":
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(p)
+	case "html":
+		if ErrorPage != nil {
+			if _, ok := r.Context().Value(LangKey).(string); !ok {
+				r = r.WithContext(context.WithValue(r.Context(), LangKey, requestLang(r)))
+			}
+			ErrorPage(w, r, p)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		data := map[string]any{"Lang": requestLang(r), "Problem": p, "RequestIDLabel": "Request ID", "SupportCodeLabel": "Support code"}
+		if ErrorMessages != nil {
+			data["RequestIDLabel"] = ErrorMessages.T("error.request_id", requestLang(r))
+			data["SupportCodeLabel"] = ErrorMessages.T("error.support_code", requestLang(r))
+		}
+		if err := errorPageTmpl.Execute(w, data); err != nil {
+			slog.ErrorContext(r.Context(), "[ERROR] Failed to render error page", "err", err)
+		}
+	default:
+		msg := p.Detail
+		if p.RequestID != "" {
+			msg = fmt.Sprintf("%s\nRequest ID: %s\nSupport code: %s", msg, p.RequestID, p.SupportCode)
+		}
+		http.Error(w, msg, status)
+	}
+}
+
+// errorFormat picks the error format of the request: "json" under /api/ or when the client asks for
+// JSON, "html" when it takes HTML, and "text" for other clients such as webhooks and curl.
+func errorFormat(r *http.Request) string {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return "json"
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mt == "text/html":
+			return "html"
+		case mt == "application/json", mt == "application/problem+json":
+			return "json"
+		}
+	}
+	return "text"
+}
+
+// requestLang returns the language of the request. Before LangMiddleware has run, e.g. for unknown
+// tenants, it takes the lang cookie or the first Accept-Language tag; the translator falls back to
+// the default language for unknown ones.
+func requestLang(r *http.Request) string {
+	if lang, ok := r.Context().Value(LangKey).(string); ok {
+		return lang
+	}
+	if lang, ok := cookies.Signed(r, cookies.LangName); ok && lang != "" {
+		return lang
+	}
+	tag, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	return strings.TrimSpace(tag)
+}
+
+// errorPageTmpl is the built-in HTML error page.
+var errorPageTmpl = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="{{if .Lang}}{{.Lang}}{{else}}en{{end}}">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Problem.Status}} {{.Problem.Title}}</title></head>
+<body style="font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem;">
+<h1>{{.Problem.Status}} {{.Problem.Title}}</h1>
+<p>{{.Problem.Detail}}</p>
+{{if .Problem.SupportCode}}<p><small>{{.RequestIDLabel}}: {{.Problem.RequestID}}<br>{{.SupportCodeLabel}}: {{.Problem.SupportCode}}</small></p>{{end}}
+</body>
+</html>
+`))
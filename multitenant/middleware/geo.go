@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// GeoRestriction enforces the tenant's country allow/deny policy.
+// It must run after TenantMiddleware; requests on the main domain are not restricted.
+// Blocked requests are audited and served by the denied handler with a 403 status.
+func GeoRestriction(locator multitenant.GeoLocator, denied http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		if t == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		policy, err := models.GetGeoPolicy(r.Context(), t.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "[GEO] Failed to load policy", "tenant", t.Subdomain, "err", err)
+			next.ServeHTTP(w, r) // Fail open: a DB hiccup must not lock everyone out
+			return
+		}
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := ClientIP(r)
+		country, err := locator.Country(net.ParseIP(ip))
+		if err != nil {
+			slog.WarnContext(r.Context(), "[GEO] Country lookup failed", "ip", ip, "err", err)
+		}
+
+		if !policy.Allows(country) {
+			slog.WarnContext(r.Context(), "[GEO] Request blocked", "tenant", t.Subdomain, "ip", ip, "country", country)
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: t.ID,
+				UserID:   CurrentUserID(r),
+				Action:   "geo.blocked",
+				IP:       ip,
+				Details:  "country=" + country + " path=" + r.URL.Path,
+			})
+			w.WriteHeader(http.StatusForbidden)
+			denied.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// groupSet memoizes the current user's groups and permissions for the duration of a request.
+type groupSet struct {
+	once     sync.Once
+	groups   []models.Group
+	permOnce sync.Once
+	perms    map[string]bool
+}
+
+// Groups lets GroupsFromContext and PermissionsFromContext load the current user's groups and
+// permissions at most once per request, and only when a handler asks for them. It must run after
+// TenantMiddleware and SessionMiddleware.
+func Groups(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), groupsKey, &groupSet{})))
+	})
+}
+
+// GroupsFromContext returns the groups the current user belongs to in the request's tenant, each with
+// the user's group role. It returns nil for anonymous users, outside tenants, and when loading fails,
+// so group-scoped records stay hidden rather than leak.
+func GroupsFromContext(ctx context.Context) []models.Group {
+	set, ok := ctx.Value(groupsKey).(*groupSet)
+	if !ok {
+		return loadGroups(ctx)
+	}
+	set.once.Do(func() { set.groups = loadGroups(ctx) })
+	return set.groups
+}
+
+func loadGroups(ctx context.Context) []models.Group {
+	t := FromContext(ctx)
+	user, _ := ctx.Value(userKey).(*models.User)
+	if t == nil || user == nil {
+		return nil
+	}
+	groups, err := models.ListUserGroups(ctx, t.ID, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "[GROUPS] Failed to load user groups", "tenant", t.Subdomain, "user_id", user.ID, "err", err)
+		return nil
+	}
+	return groups
+}
+
+// GroupIDsFromContext returns the IDs of the current user's groups.
+func GroupIDsFromContext(ctx context.Context) []int64 {
+	groups := GroupsFromContext(ctx)
+	ids := make([]int64, len(groups))
+	for i, g := range groups {
+		ids[i] = g.ID
+	}
+	return ids
+}
+
+// InGroup reports whether the current user belongs to the group.
+func InGroup(ctx context.Context, groupID int64) bool {
+	for _, g := range GroupsFromContext(ctx) {
+		if g.ID == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// ManagesGroup reports whether the current user is a manager of the group.
+func ManagesGroup(ctx context.Context, groupID int64) bool {
+	for _, g := range GroupsFromContext(ctx) {
+		if g.ID == groupID {
+			return g.Role == models.GroupManager
+		}
+	}
+	return false
+}
+
+// GroupScopeFor returns the scope to filter group-owned records with for the current user:
+// every record for tenant admins, the records of the user's groups otherwise.
+func GroupScopeFor(r *http.Request, cfg *multitenant.Config) models.GroupScope {
+	if user := CurrentUser(r); user != nil && cfg.Roles.Allows(user.Role, cfg.Roles.Admin) {
+		return models.GroupScope{All: true}
+	}
+	return models.GroupScope{GroupIDs: GroupIDsFromContext(r.Context())}
+}
+
+// PermissionsFromContext returns the permissions the current user holds through their groups in
+// the request's tenant. Like GroupsFromContext, it returns none when they cannot be loaded.
+func PermissionsFromContext(ctx context.Context) map[string]bool {
+	set, ok := ctx.Value(groupsKey).(*groupSet)
+	if !ok {
+		return loadPermissions(ctx)
+	}
+	set.permOnce.Do(func() { set.perms = loadPermissions(ctx) })
+	return set.perms
+}
+
+func loadPermissions(ctx context.Context) map[string]bool {
+	t := FromContext(ctx)
+	user, _ := ctx.Value(userKey).(*models.User)
+	if t == nil || user == nil {
+		return nil
+	}
+	perms, err := models.ListUserPermissions(ctx, t.ID, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "[GROUPS] Failed to load user permissions", "tenant", t.Subdomain, "user_id", user.ID, "err", err)
+		return nil
+	}
+	out := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		out[p] = true
+	}
+	return out
+}
+
+// HasPermission reports whether the current user holds a permission: tenant admins hold every
+// permission, other members those granted to one of their groups.
+func HasPermission(r *http.Request, cfg *multitenant.Config, permission string) bool {
+	user := authUser(r)
+	if user == nil {
+		return false
+	}
+	return cfg.Roles.Allows(user.Role, cfg.Roles.Admin) || PermissionsFromContext(r.Context())[permission]
+}
+
+// RequirePermission ensures the user is logged in and holds the permission, see HasPermission.
+//
+//	app.Groups.Auth.With(middleware.RequirePermission(cfg, "invoices.approve")).Post("/invoices/{id}/approve", approve)
+func RequirePermission(cfg *multitenant.Config, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := authUser(r)
+			if user == nil {
+				redirectToLogin(w, r)
+				return
+			}
+			if !HasPermission(r, cfg, permission) {
+				slog.InfoContext(r.Context(), "[AUTH] Permission missing", "user_id", user.ID, "permission", permission)
+				WriteError(w, r, ErrForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,35 +1,140 @@
 package middleware
 
 import (
+	"bufio"
 	"context"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
-	"github.com/pandamasta/tenkit/models"
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/logging"
 )
 
+// accessEntry collects request details filled in by inner middleware,
+// so the access log and error reports do not resolve the session or tenant a second time.
+type accessEntry struct {
+	tenant    string
+	tenantID  int64
+	userID    int64
+	userEmail string
+}
+
+// responseRecorder captures the status code and body size written by the handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijacking not supported")
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Logger writes one structured access log record per request through slog.
+// It should wrap TenantMiddleware and SessionMiddleware, which report the tenant and user back to it.
 func Logger(cfg *multitenant.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		entry := &accessEntry{tenant: "main"}
+		rec := &responseRecorder{ResponseWriter: w}
 
-		// Load user from session token if present
-		if cookie, err := r.Cookie(cfg.SessionCookie.Name); err == nil {
-			if user, err := models.GetSession(cookie.Value); err == nil && user != nil {
-				r = r.WithContext(context.WithValue(r.Context(), userKey, user))
-			}
-		}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessKey, entry)))
 
-		// Tenant
-		t := FromContext(r.Context())
-		tenantInfo := "main"
-		if t != nil {
-			tenantInfo = t.Subdomain
+		if rec.status == 0 {
+			rec.status = http.StatusOK
 		}
-
-		next.ServeHTTP(w, r)
-		log.Printf("[HTTP][%s] %s %s from %s - %v",
-			tenantInfo, r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.Default().LogAttrs(r.Context(), level, "[HTTP] Request",
+			slog.String("tenant", entry.tenant),
+			slog.Int64("user_id", entry.userID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("query", logging.RedactQuery(r.URL.RawQuery, cfg.Log.Redact)),
+			slog.Int("status", rec.status),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("ip", ClientIP(r)),
+			slog.Duration("duration", time.Since(start)),
+		)
 	})
 }
+
+// noteAccess lets inner middleware record details for the access log.
+func noteAccess(r *http.Request, fn func(e *accessEntry)) {
+	if e, ok := r.Context().Value(accessKey).(*accessEntry); ok {
+		fn(e)
+	}
+}
+
+// NewSlogHandler builds the application log handler: JSON or text output as configured, the levels
+// of TENKIT_LOG_LEVEL and TENKIT_LOG_LEVELS, sensitive attributes and secrets redacted, and the
+// request ID, tenant and user added to records logged with a request context.
+func NewSlogHandler(cfg *multitenant.Config, w io.Writer, level slog.Leveler) slog.Handler {
+	// The logging handler filters by level; the output handler writes whatever it passes on
+	opts := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var h slog.Handler
+	if cfg.Log.Format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if err := logging.SetLevels(cfg.Log.Levels); err != nil {
+		slog.Error("[LOG] Invalid TENKIT_LOG_LEVELS", "err", err)
+	}
+	return logging.NewHandler(h, logging.Options{Level: level, Redact: cfg.Log.Redact, Context: LogContext})
+}
+
+// LogContext returns the request ID, tenant and user of a request context for log records.
+func LogContext(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id := RequestIDFromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if t := FromContext(ctx); t != nil {
+		attrs = append(attrs, slog.String("tenant", t.Subdomain))
+	}
+	if u := UserFromContext(ctx); u != nil {
+		attrs = append(attrs, slog.Int64("user_id", u.ID))
+	}
+	return attrs
+}
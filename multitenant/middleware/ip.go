@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// ClientIP returns the IP of the client that sent the request: the one resolved by RealIP
+// when the request came through a trusted proxy, the peer address otherwise.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// RealIP resolves the client IP from the Forwarded, X-Forwarded-For and X-Real-IP headers,
+// in that order, when the peer is one of cfg.Server.TrustedProxies. Headers sent by other
+// peers are ignored since anyone can forge them. It must wrap every middleware using ClientIP.
+func RealIP(cfg *multitenant.Config, next http.Handler) http.Handler {
+	trusted := parseTrustedProxies(cfg.Server.TrustedProxies)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := peerIP(r)
+		if len(trusted) == 0 || !trusted.contains(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := forwardedIP(r, trusted)
+		if ip == "" {
+			ip = peer
+		}
+		ctx := context.WithValue(r.Context(), clientIPKey, ip)
+		if proto := forwardedProto(r); proto != "" {
+			ctx = context.WithValue(ctx, clientProtoKey, proto)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Scheme returns "https" or "http" as seen by the client, honouring the protocol
+// reported by a trusted proxy that terminates TLS.
+func Scheme(r *http.Request) string {
+	if proto, ok := r.Context().Value(clientProtoKey).(string); ok {
+		return proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// TrustedProxy returns a check for requests coming directly from one of cfg.Server.TrustedProxies,
+// e.g. for multitenant.HeaderResolver.
+func TrustedProxy(cfg *multitenant.Config) func(*http.Request) bool {
+	trusted := parseTrustedProxies(cfg.Server.TrustedProxies)
+	return func(r *http.Request) bool {
+		return trusted.contains(peerIP(r))
+	}
+}
+
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type proxyList []*net.IPNet
+
+func parseTrustedProxies(entries []string) proxyList {
+	var out proxyList
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			if ip := net.ParseIP(e); ip != nil && ip.To4() != nil {
+				e += "/32"
+			} else {
+				e += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			slog.Error("[REALIP] Ignoring invalid trusted proxy", "entry", e, "err", err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func (l proxyList) contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range l {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedIP walks the forwarding chain from the closest hop back and returns the first
+// address that is not a trusted proxy, or "" when the headers carry no usable address.
+func forwardedIP(r *http.Request, trusted proxyList) string {
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				chain = append(chain, strings.TrimSpace(hop))
+			}
+		}
+	}
+	if len(chain) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+		return ""
+	}
+
+	client := ""
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if ip == nil {
+			// "unknown", an obfuscated identifier or garbage: nothing beyond it can be trusted
+			break
+		}
+		client = ip.String()
+		if !trusted.contains(client) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor extracts the for= addresses of RFC 7239 Forwarded headers, without ports.
+func forwardedFor(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+				val = strings.Trim(val, `"`)
+				if strings.HasPrefix(val, "[") {
+					// [2001:db8::1]:4711
+					if end := strings.Index(val, "]"); end > 0 {
+						val = val[1:end]
+					}
+				} else if host, _, err := net.SplitHostPort(val); err == nil {
+					val = host
+				}
+				out = append(out, val)
+			}
+		}
+	}
+	return out
+}
+
+// forwardedProto returns the proto= of the first Forwarded element, or X-Forwarded-Proto.
+func forwardedProto(r *http.Request) string {
+	proto := ""
+	if v := r.Header.Get("Forwarded"); v != "" {
+		first, _, _ := strings.Cut(v, ",")
+		for _, pair := range strings.Split(first, ";") {
+			k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(k, "proto") {
+				proto = strings.Trim(val, `"`)
+			}
+		}
+	}
+	if proto == "" {
+		proto, _, _ = strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	}
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "http", "https":
+		return proto
+	}
+	return ""
+}
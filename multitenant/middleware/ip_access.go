@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// ipAccessOpenPaths stay reachable from denied addresses so the page can be styled and translated.
+var ipAccessOpenPaths = []string{"/lang", "/static/", "/branding/", "/favicon.ico"}
+
+// IPAccess enforces the tenant's IP allow and deny lists (multitenant.IPAllowSetting and
+// IPDenySetting). Platform admins are never blocked, so they can fix a list that locks a tenant
+// out. Blocked requests are logged, audited and served by denied with a 403 status, or answered a
+// problem under /api/. It must run after TenantMiddleware and SessionMiddleware; requests on the
+// main domain are not restricted.
+func IPAccess(cfg *multitenant.Config, denied http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		if t == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy, ok, err := multitenant.TenantIPAccess(t.Settings)
+		if err != nil {
+			// Settings are validated when saved; an invalid stored list must not lock everyone out
+			slog.ErrorContext(r.Context(), "[IPACCESS] Invalid IP lists", "tenant", t.Subdomain, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := ClientIP(r)
+		if !ok || policy.Allows(net.ParseIP(ip)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user := CurrentUser(r); user != nil && cfg.IsPlatformAdmin(user.Email) {
+			slog.InfoContext(r.Context(), "[IPACCESS] Platform admin let through", "tenant", t.Subdomain, "ip", ip)
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range ipAccessOpenPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		slog.WarnContext(r.Context(), "[IPACCESS] Request blocked", "tenant", t.Subdomain, "ip", ip, "path", r.URL.Path)
+		models.LogAudit(r.Context(), models.AuditEntry{
+			TenantID: t.ID,
+			UserID:   CurrentUserID(r),
+			Action:   "ip_access.blocked",
+			IP:       ip,
+			Details:  "path=" + r.URL.Path,
+		})
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			detail := "Access from this address is not allowed"
+			if ErrorMessages != nil {
+				detail = ErrorMessages.T("ip_access.denied", requestLang(r))
+			}
+			APIError(w, r, "ip_denied", detail, http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		denied.ServeHTTP(w, r)
+	})
+}
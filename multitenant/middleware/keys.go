@@ -3,10 +3,20 @@ package middleware
 type contextKey string
 
 const (
-	userIDKey      contextKey = "userID"
-	userKey        contextKey = "user"
-	TenantKey      contextKey = "tenant"
-	isTenantCtxKey contextKey = "isTenant"
-	CsrfKey        contextKey = "csrf_token"
-	langKey        contextKey = "lang"
+	userIDKey       contextKey = "userID"
+	userKey         contextKey = "user"
+	TenantKey       contextKey = "tenant"
+	isTenantCtxKey  contextKey = "isTenant"
+	CsrfKey         contextKey = "csrf_token"
+	langKey         contextKey = "lang"
+	langSourceKey   contextKey = "lang_source"
+	langPrefixKey   contextKey = "lang_prefix"
+	reputationKey   contextKey = "reputation"
+	accessKey       contextKey = "access"
+	apiKeyKey       contextKey = "api_key"
+	clientIPKey     contextKey = "client_ip"
+	clientProtoKey  contextKey = "client_proto"
+	groupsKey       contextKey = "groups"
+	previewKey      contextKey = "preview"
+	sessionTokenKey contextKey = "session_token"
 )
@@ -4,63 +4,157 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
 )
 
 type LangKeyType string
 
 const LangKey LangKeyType = "lang"
 
+// TenantLangSetting is the tenant setting holding the default language of a tenant, used when
+// neither the visitor nor their browser picked an available one.
+const TenantLangSetting = "default_lang"
+
+// Sources of the request language, from the strongest to the weakest.
+const (
+	langFromPath    = "path"    // Prefix of the path, in URL-prefix mode (LangPrefix)
+	langFromCookie  = "cookie"  // Picked with the language switcher on this browser
+	langFromUser    = "user"    // Stored on the signed-in user
+	langFromHeader  = "header"  // Negotiated from Accept-Language
+	langFromTenant  = "tenant"  // Default language of the tenant
+	langFromDefault = "default" // DEFAULT_LANG
+)
+
 // I18nProvider defines an interface for accessing translations.
 type I18nProvider interface {
 	Translations() map[string]map[string]string
 }
 
 // LangMiddleware extracts the language from the cookie or Accept-Language header and injects it into the context.
+// The tenant and the user are not known yet at this point; PreferredLang refines the choice once they are.
 func LangMiddleware(cfg *multitenant.Config, i18n I18nProvider, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		lang := cfg.I18n.DefaultLang // Read DEFAULT_LANG from .env via Config
+		lang, source := cfg.I18n.DefaultLang, langFromDefault // Read DEFAULT_LANG from .env via Config
 		translations := i18n.Translations()
 
-		// 1. Check the "lang" cookie
-		if cookie, err := r.Cookie("lang"); err == nil && cookie.Value != "" {
-			if _, ok := translations[cookie.Value]; ok {
-				lang = cookie.Value
-				slog.Info("[LANG] Language from cookie", "lang", lang)
+		// 1. Check the signed "lang" cookie
+		if value, ok := cookies.Signed(r, cookies.LangName); ok && value != "" {
+			if _, ok := translations[value]; ok {
+				lang, source = value, langFromCookie
 			}
-		} else if accept := r.Header.Get("Accept-Language"); accept != "" {
-			// 2. Check the Accept-Language header
-			langs := strings.Split(accept, ",")
-			for _, l := range langs {
-				l = strings.Split(l, ";")[0] // Ignore weights (e.g., q=0.9)
-				l = strings.TrimSpace(l)
-				if _, ok := translations[l]; ok {
-					lang = l
-					slog.Info("[LANG] Language from Accept-Language header", "lang", lang)
-					break
-				}
-				// Try the base language (e.g., fr for fr-FR)
-				base := strings.Split(l, "-")[0]
-				if base != l {
-					if _, ok := translations[base]; ok {
-						lang = base
-						slog.Info("[LANG] Language from Accept-Language base", "lang", lang)
-						break
+		}
+		// 2. Negotiate the Accept-Language header
+		if source == langFromDefault {
+			if l, ok := NegotiateLang(r.Header.Get("Accept-Language"), translations); ok {
+				lang, source = l, langFromHeader
+			}
+		}
+
+		slog.DebugContext(r.Context(), "[LANG] Language resolved", "lang", lang, "source", source)
+		ctx := context.WithValue(r.Context(), LangKey, lang)
+		ctx = context.WithValue(ctx, langSourceKey, source)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// PreferredLang applies the preferences known once the session and the tenant are resolved: the
+// language stored on the signed-in user beats the browser's, and the tenant's default language
+// (TenantLangSetting) replaces DEFAULT_LANG. A language picked on this browser always wins.
+func PreferredLang(i18n I18nProvider, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source, _ := r.Context().Value(langSourceKey).(string)
+		if source == "" || source == langFromCookie || source == langFromPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		translations := i18n.Translations()
+		lang := ""
+		if user := CurrentUser(r); user != nil && user.Lang != "" {
+			if _, ok := translations[user.Lang]; ok {
+				lang, source = user.Lang, langFromUser
+			}
+		}
+		if lang == "" && source == langFromDefault {
+			if t := FromContext(r.Context()); t != nil {
+				if l := t.Settings.GetString(TenantLangSetting); l != "" {
+					if _, ok := translations[l]; ok {
+						lang, source = l, langFromTenant
 					}
 				}
 			}
-		} else {
-			slog.Info("[LANG] No 'lang' cookie or header found, using default", "lang", lang)
 		}
-
-		slog.Debug("[LANG] Language resolved", "lang", lang)
+		if lang == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		slog.DebugContext(r.Context(), "[LANG] Language preferred", "lang", lang, "source", source)
 		ctx := context.WithValue(r.Context(), LangKey, lang)
+		ctx = context.WithValue(ctx, langSourceKey, source)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// NegotiateLang picks the available language best matching an Accept-Language header. Ranges are
+// tried by decreasing quality, ignoring q=0, with the RFC 4647 lookup scheme: "fr-CA" matches
+// "fr-CA", then "fr". Tags are compared case-insensitively; the available spelling is returned.
+func NegotiateLang(accept string, available map[string]map[string]string) (string, bool) {
+	if accept == "" {
+		return "", false
+	}
+	byLower := make(map[string]string, len(available))
+	for l := range available {
+		byLower[strings.ToLower(l)] = l
+	}
+
+	type langRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []langRange
+	for _, part := range strings.Split(accept, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, langRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, rg := range ranges {
+		for tag := rg.tag; tag != ""; {
+			if l, ok := byLower[tag]; ok {
+				return l, true
+			}
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+			// Lookup also drops a single-letter subtag left at the end, e.g. the "x" of "zh-x-private"
+			if j := strings.LastIndex(tag, "-"); j >= 0 && len(tag)-j == 2 {
+				tag = tag[:j]
+			}
+		}
+	}
+	return "", false
+}
+
 // LangFromContext retrieves the current language from the context.
 func LangFromContext(ctx context.Context) string {
 	lang, ok := ctx.Value(LangKey).(string)
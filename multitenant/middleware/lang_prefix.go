@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
+)
+
+// LangPrefix serves pages under a language prefix, /fr/login, when Config.I18n.URLPrefix is set. It
+// strips a prefix naming an available language before routing, so handlers see /login, and makes
+// it the request language. Page requests without a prefix are redirected to the language
+// negotiated by LangMiddleware; the prefixes of Config.I18n.PrefixExempt are served as they are.
+// Wrap it inside LangMiddleware.
+func LangPrefix(cfg *multitenant.Config, i18n I18nProvider, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Step 1: Strip a language prefix
+		if lang, rest, ok := SplitLangPrefix(r.URL.Path, i18n.Translations()); ok {
+			// Keep the choice for the redirects of handlers, which target bare paths
+			if current, ok := cookies.Signed(r, cookies.LangName); !ok || current != lang {
+				cookies.SetSigned(w, r, cookies.Lang(cfg), lang, 0)
+			}
+			ctx := context.WithValue(r.Context(), LangKey, lang)
+			ctx = context.WithValue(ctx, langSourceKey, langFromPath)
+			ctx = context.WithValue(ctx, langPrefixKey, true)
+			r2 := r.Clone(ctx)
+			r2.URL.Path, r2.URL.RawPath = rest, ""
+			next.ServeHTTP(w, r2)
+			return
+		}
+
+		// Step 2: Redirect page requests to the negotiated language
+		if !isPageRequest(r) || exemptPath(r.URL.Path, cfg.I18n.PrefixExempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		target := LocalizePath(r.URL.Path, LangFromContext(r.Context()))
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		slog.DebugContext(r.Context(), "[LANG] Redirecting to localized path", "path", r.URL.Path, "target", target)
+		w.Header().Add("Vary", "Accept-Language, Cookie")
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
+
+// SplitLangPrefix splits "/fr/login" into "fr" and "/login" when fr is an available language.
+func SplitLangPrefix(path string, available map[string]map[string]string) (lang, rest string, ok bool) {
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if segment == "" {
+		return "", path, false
+	}
+	if _, found := available[segment]; !found {
+		return "", path, false
+	}
+	return segment, "/" + rest, true
+}
+
+// LocalizePath prefixes path with lang: "/login" becomes "/fr/login".
+func LocalizePath(path, lang string) string {
+	if path == "" || path == "/" {
+		return "/" + lang + "/"
+	}
+	return "/" + lang + "/" + strings.TrimPrefix(path, "/")
+}
+
+// LangPath returns path as linked from the current page: with the language prefix when the request
+// was served under one, unchanged otherwise. Handlers and templates use it to stay in the language.
+func LangPath(ctx context.Context, path string) string {
+	if !HasLangPrefix(ctx) || !strings.HasPrefix(path, "/") {
+		return path
+	}
+	return LocalizePath(path, LangFromContext(ctx))
+}
+
+// HasLangPrefix reports whether the request was served under a language prefix.
+func HasLangPrefix(ctx context.Context) bool {
+	prefixed, _ := ctx.Value(langPrefixKey).(bool)
+	return prefixed
+}
+
+// isPageRequest reports whether r is a browser navigation to a page, which alone gets redirected.
+func isPageRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func exemptPath(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/maintenance"
+)
+
+// maintenanceOpenPaths stay reachable during maintenance: health checks and metrics, the login of
+// operators, the operator console and platform API, and what the page needs.
+var maintenanceOpenPaths = []string{"/healthz", "/metrics", "/login", "/logout", "/admin/", "/api/v1/maintenance", "/lang", "/static/", "/branding/", "/favicon.ico", "/manifest.webmanifest"}
+
+// Maintenance answers 503 with page, or a problem under /api/, while the platform or the request's
+// tenant is in maintenance. Platform admins browse normally. It must run after TenantMiddleware and
+// SessionMiddleware.
+func Maintenance(cfg *multitenant.Config, page http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		window, ok := maintenance.Tenant(FromContext(r.Context()))
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user := CurrentUser(r); user != nil && cfg.IsPlatformAdmin(user.Email) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range maintenanceOpenPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		slog.DebugContext(r.Context(), "[MAINTENANCE] Serving maintenance page", "path", r.URL.Path, "source", window.Source)
+		if window.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(window.RetryAfter.Seconds())))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			detail := window.Message
+			if detail == "" {
+				detail = "Down for maintenance"
+				if ErrorMessages != nil {
+					detail = ErrorMessages.T("maintenance.message", requestLang(r))
+				}
+			}
+			APIError(w, r, "maintenance", detail, http.StatusServiceUnavailable)
+			return
+		}
+		page.ServeHTTP(w, r)
+	})
+}
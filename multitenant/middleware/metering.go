@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant/metering"
+)
+
+// Metering counts the requests served on each tenant and the users active on it, for usage reports.
+// Static assets are not counted, nor are impersonation sessions as active users. It must run after
+// TenantMiddleware and SessionMiddleware.
+func Metering(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := FromContext(r.Context()); t != nil && !strings.HasPrefix(r.URL.Path, "/static/") {
+			metering.Add(t.ID, metering.Requests, 1)
+			if user := CurrentUser(r); user != nil && user.ImpersonatorID == 0 {
+				metering.Seen(t.ID, user.ID)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// IsPreview reports whether the request came through the tenant's preview host.
+func IsPreview(ctx context.Context) bool {
+	v, _ := ctx.Value(previewKey).(bool)
+	return v
+}
+
+// Preview keeps preview hosts to the tenant's members: anonymous visitors are sent to the login
+// page, which stays reachable with the paths open in coming-soon mode. Preview responses are
+// never indexed. It must run after TenantMiddleware and SessionMiddleware.
+func Preview(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		if t == nil || !IsPreview(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("X-Robots-Tag", "noindex")
+		if user := CurrentUser(r); user != nil && user.TenantID == t.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range comingSoonOpenPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		slog.DebugContext(r.Context(), "[PREVIEW] Anonymous preview request sent to login", "tenant", t.Subdomain, "path", r.URL.Path)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	})
+}
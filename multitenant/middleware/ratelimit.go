@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant/ratelimit"
+	"github.com/pandamasta/tenkit/multitenant/security"
+)
+
+// RateLimit applies every rule matching the request. Each rule counts requests per client IP,
+// logged-in user or tenant depending on its scope, and the limits of user and tenant rules are
+// scaled by the tenant's RateLimitFactor (see ratelimit.Rule.Scales). It must run after
+// TenantMiddleware and SessionMiddleware, and inside RealIP: per-IP rules count ClientIP, which
+// is the load balancer's address for every client unless RealIP resolved it from TRUSTED_PROXIES.
+// Limiter errors fail open so a Redis outage does not take the site down.
+func RateLimit(limiter ratelimit.Limiter, rules []ratelimit.Rule, next http.Handler) http.Handler {
+	return RateLimitSet(limiter, ratelimit.NewRuleSet(rules), next)
+}
+
+// RateLimitSet is RateLimit with rules replaced at runtime, e.g. on a configuration reload.
+func RateLimitSet(limiter ratelimit.Limiter, set *ratelimit.RuleSet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		factor := 1.0
+		if t != nil {
+			factor = t.RateLimitFactor
+		}
+
+		var tightest *ratelimit.Result
+		for _, rule := range set.Load() {
+			if !rule.Matches(r.Method, r.URL.Path) {
+				continue
+			}
+			limit := rule.Limit
+			if rule.Scales() {
+				limit = limit.Scale(factor)
+			}
+			res, err := limiter.Allow(r.Context(), rule.Key(rateLimitSubject(r, rule.Scope)), limit)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "[RATELIMIT] Limiter failed", "route", rule.Route, "err", err)
+				continue
+			}
+			if !res.Allowed {
+				setRateLimitHeaders(w, res)
+				event := security.RateLimited
+				if r.Method == http.MethodPost && (r.URL.Path == "/login" || r.URL.Path == "/api/v1/login") {
+					event = security.Lockout
+				}
+				EmitSecurityEvent(r, event, rule.Route+"="+rule.Limit.String()+"@"+rule.Scope)
+				WriteError(w, r, ErrRateLimited)
+				return
+			}
+			if tightest == nil || res.Remaining < tightest.Remaining {
+				tightest = &res
+			}
+		}
+		if tightest != nil {
+			setRateLimitHeaders(w, *tightest)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitSubject returns what a rule of the given scope counts against.
+func rateLimitSubject(r *http.Request, scope string) string {
+	switch scope {
+	case ratelimit.ScopeUser:
+		if uid := CurrentUserID(r); uid != 0 {
+			return "user:" + strconv.FormatInt(uid, 10)
+		}
+	case ratelimit.ScopeTenant:
+		if t := FromContext(r.Context()); t != nil {
+			return "tenant:" + strconv.FormatInt(t.ID, 10)
+		}
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// setRateLimitHeaders writes X-RateLimit-* and, for denied requests, Retry-After.
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(res.Reset).Unix(), 10))
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+}
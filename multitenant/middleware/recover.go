@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	tkerrors "github.com/pandamasta/tenkit/multitenant/errors"
+)
+
+// Recover turns panics of the handlers below it into 500 error pages, logs them with their stack and
+// passes them to the error reporter. http.ErrAbortHandler is re-raised so that net/http aborts the
+// response as intended. It must run inside RequestID so that the page carries the request ID and
+// support code.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "[RECOVER] Handler panicked", "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			report(r, tkerrors.Report{Err: &tkerrors.PanicError{Value: v}, Panic: true, Stack: tkerrors.Stack(0)})
+			writeError(w, r, WrapErr(ErrInternal, fmt.Sprint(v)), false)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReportError passes err to the error reporter with the request, tenant and user of r, for failures
+// handlers recover from themselves. WriteError already reports the errors answered with a 5xx.
+func ReportError(r *http.Request, err error) {
+	report(r, tkerrors.Report{Err: err, Stack: tkerrors.Stack(1)})
+}
+
+// report fills rep with the metadata of r and captures it. Recover runs outside the tenant and
+// session middleware, so the tenant and user come from the access log entry when r lacks them.
+func report(r *http.Request, rep tkerrors.Report) {
+	ctx := r.Context()
+	rep.Request = r
+	rep.RequestID = RequestIDFromContext(ctx)
+	rep.IP = ClientIP(r)
+	if t := FromContext(ctx); t != nil {
+		rep.TenantID, rep.Tenant = t.ID, t.Subdomain
+	}
+	if u := UserFromContext(ctx); u != nil {
+		rep.UserID, rep.UserEmail = u.ID, u.Email
+	}
+	noteAccess(r, func(e *accessEntry) {
+		if rep.TenantID == 0 && e.tenantID != 0 {
+			rep.TenantID, rep.Tenant = e.tenantID, e.tenant
+		}
+		if rep.UserID == 0 {
+			rep.UserID, rep.UserEmail = e.userID, e.userEmail
+		}
+	})
+	tkerrors.Capture(ctx, rep)
+}
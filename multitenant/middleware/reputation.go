@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// ReputationGuard checks the client IP against an IPReputation before the wrapped handler runs.
+// Blocked requests are audited and served by the blocked handler with a 403 status;
+// challenged requests go through with the verdict stored in the context.
+func ReputationGuard(checker multitenant.IPReputation, blocked http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		verdict, err := checker.Check(r.Context(), net.ParseIP(ip))
+		if err != nil {
+			slog.WarnContext(r.Context(), "[REPUTATION] Check failed, allowing request", "ip", ip, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch verdict {
+		case multitenant.ReputationBlock:
+			var tenantID int64
+			if t := FromContext(r.Context()); t != nil {
+				tenantID = t.ID
+			}
+			slog.WarnContext(r.Context(), "[REPUTATION] Request blocked", "ip", ip, "path", r.URL.Path)
+			models.LogAudit(r.Context(), models.AuditEntry{
+				TenantID: tenantID,
+				Action:   "reputation.blocked",
+				IP:       ip,
+				Details:  "path=" + r.URL.Path,
+			})
+			w.WriteHeader(http.StatusForbidden)
+			blocked.ServeHTTP(w, r)
+			return
+		case multitenant.ReputationChallenge:
+			slog.InfoContext(r.Context(), "[REPUTATION] Request challenged", "ip", ip, "path", r.URL.Path)
+			r = r.WithContext(context.WithValue(r.Context(), reputationKey, verdict))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReputationChallenged reports whether ReputationGuard asked for this request to be challenged.
+func ReputationChallenged(ctx context.Context) bool {
+	v, ok := ctx.Value(reputationKey).(multitenant.ReputationVerdict)
+	return ok && v == multitenant.ReputationChallenge
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID reuses a well-formed incoming X-Request-ID or generates one,
+// stores it in the context and echoes it in the response headers.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(models.WithRequestID(r.Context(), id)))
+	})
+}
+
+// RequestIDFromContext returns the request ID, or "" outside a request.
+func RequestIDFromContext(ctx context.Context) string {
+	return models.RequestIDFromContext(ctx)
+}
+
+// SupportCode returns the support code of the request and records its context, so that platform
+// admins can resolve the code users quote. status is the response status, 0 when unknown.
+func SupportCode(r *http.Request, status int) string {
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		return ""
+	}
+	ref := models.SupportRef{
+		Code:      models.SupportCode(id),
+		RequestID: id,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Status:    status,
+	}
+	if t := FromContext(r.Context()); t != nil {
+		ref.TenantID = t.ID
+	}
+	if u := CurrentUser(r); u != nil {
+		ref.UserID = u.ID
+	}
+	if err := models.RecordSupportRef(r.Context(), ref); err != nil {
+		slog.ErrorContext(r.Context(), "[REQID] Failed to record support code", "code", ref.Code, "err", err)
+	}
+	return ref.Code
+}
+
+// validRequestID accepts short IDs made of URL-safe characters, so client values cannot inject into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		slog.Error("[REQID] Failed to generate request ID", "err", err)
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// LogHandler wraps a slog.Handler and adds the request ID to every record logged with a request context
+// (slog.InfoContext and friends).
+type LogHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler returns h wrapped so request-scoped records carry request_id.
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{Handler: h}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/pandamasta/tenkit/multitenant/security"
+)
+
+// EmitSecurityEvent records a security event with the tenant, user and client IP of the request.
+func EmitSecurityEvent(r *http.Request, typ security.EventType, detail string) {
+	e := security.Event{
+		Type:   typ,
+		UserID: CurrentUserID(r),
+		IP:     ClientIP(r),
+		Path:   r.URL.Path,
+		Detail: detail,
+	}
+	if t := FromContext(r.Context()); t != nil {
+		e.TenantID = t.ID
+	}
+	security.Emit(r.Context(), e)
+}
@@ -7,33 +7,41 @@ import (
 
 	"github.com/pandamasta/tenkit/models"
 	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/cache"
+	"github.com/pandamasta/tenkit/multitenant/cookies"
 )
 
+// SessionMiddleware loads the user of the session cookie. It runs inside TenantMiddleware: a
+// session of another tenant, such as the parent of a sub-tenant served on one of its subdomains,
+// is ignored, so that its roles never apply to this tenant.
 func SessionMiddleware(cfg *multitenant.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context() // Start with current ctx to propagate outer values like CSRF
 		cookie, err := r.Cookie(cfg.SessionCookie.Name)
 		if err == nil && cookie.Value != "" {
-			slog.Info("[SESSION] Found cookie", "value", cookie.Value)
-			user, err := models.GetSession(cookie.Value)
+			slog.DebugContext(r.Context(), "[SESSION] Found cookie")
+			user, err := cache.Session(r.Context(), cookie.Value)
 			if err == nil && user != nil {
-				// Optional: Add tenant check for security (if not already in GetSession)
-				t := FromContext(r.Context()) // Assuming FromContext from tenant.go
+				t := FromContext(r.Context())
 				if t != nil && user.TenantID != t.ID {
-					slog.Warn("[SESSION] Mismatch tenant for user", "user_id", user.ID, "expected_tenant_id", t.ID, "got_tenant_id", user.TenantID)
-					http.SetCookie(w, &http.Cookie{Name: cfg.SessionCookie.Name, MaxAge: -1}) // Clear invalid cookie
+					slog.WarnContext(r.Context(), "[SESSION] Mismatch tenant for user", "user_id", user.ID, "expected_tenant_id", t.ID, "got_tenant_id", user.TenantID)
+					cookies.Clear(w, r, cfg.SessionCookie) // Clear invalid cookie
 					next.ServeHTTP(w, r)
 					return
 				}
-				slog.Info("[SESSION] Resolved userID", "user_id", user.ID)
+				slog.DebugContext(r.Context(), "[SESSION] Resolved userID", "user_id", user.ID)
 				ctx = context.WithValue(ctx, userIDKey, user.ID)
 				ctx = context.WithValue(ctx, userKey, user)
+				if user.ImpersonatorID != 0 {
+					ctx = models.WithImpersonator(ctx, user.ImpersonatorEmail)
+				}
+				noteAccess(r, func(e *accessEntry) { e.userID, e.userEmail = user.ID, user.Email })
 			} else {
-				slog.Warn("[SESSION] Invalid/expired session", "err", err)
-				http.SetCookie(w, &http.Cookie{Name: cfg.SessionCookie.Name, MaxAge: -1}) // Clear on error
+				slog.WarnContext(r.Context(), "[SESSION] Invalid/expired session", "err", err)
+				cookies.Clear(w, r, cfg.SessionCookie) // Clear on error
 			}
 		} else {
-			slog.Info("[SESSION] No session cookie in request")
+			slog.DebugContext(r.Context(), "[SESSION] No session cookie in request")
 		}
 		r = r.WithContext(ctx) // Always attach updated ctx to propagate (e.g., CSRF token)
 		next.ServeHTTP(w, r)
@@ -53,3 +61,9 @@ func CurrentUser(r *http.Request) *models.User {
 	}
 	return nil
 }
+
+// UserFromContext returns the logged-in user of a request context, nil when anonymous.
+func UserFromContext(ctx context.Context) *models.User {
+	u, _ := ctx.Value(userKey).(*models.User)
+	return u
+}
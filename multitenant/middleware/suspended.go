@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// suspendedOpenPaths stay reachable on suspended tenants so the page can be styled and translated.
+var suspendedOpenPaths = []string{"/lang", "/static/", "/branding/", "/favicon.ico", "/manifest.webmanifest"}
+
+// Suspended serves page instead of the application on suspended tenants, members included.
+// It must run after TenantMiddleware.
+func Suspended(page http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := FromContext(r.Context())
+		if t == nil || !t.Suspended {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, p := range suspendedOpenPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		slog.DebugContext(r.Context(), "[TENANT] Serving suspended page", "tenant", t.Subdomain, "path", r.URL.Path)
+		w.Header().Set("X-Robots-Tag", "noindex")
+		page.ServeHTTP(w, r)
+	})
+}
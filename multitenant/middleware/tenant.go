@@ -1,53 +1,121 @@
+// Package middleware holds the HTTP middleware of tenkit and the context accessors handlers read
+// their results with (FromContext for the tenant, CurrentUser, LangFromContext, GroupsFromContext).
+// tenkit.New chains them in the order they depend on each other: RealIP, RequestID and Logger,
+// then Recover, LangMiddleware, CSRFMiddleware, TenantMiddleware, SessionMiddleware and the
+// per-tenant guards.
+//
+// TenantMiddleware resolves the tenant of the host; with ROOT_REDIRECT_URL set, requests to the
+// root domain are redirected there, except the paths of ROOT_REDIRECT_EXEMPT. Sessions and CSRF
+// tokens live in cookies set through the cookies package, with the __Host- prefix over TLS. CSRF
+// tokens are signed double-submit tokens bound to the session, read from the form field or the
+// X-CSRF-Token header; CSRF_EXEMPT_PATHS lists the exempt paths.
+//
+// Routes are guarded with RequireAuth, RequireRole, RequireMinRole (a role and those ranked above
+// it), RequirePlatformAdmin and RequirePermission; GroupScopeFor limits a query to the groups of
+// the current user:
+//
+//	scope := middleware.GroupScopeFor(r, cfg)
+//	where, args := scope.Where("documents.group_id")
+//
+// Per tenant, GeoRestriction and IPAccess apply the country and IP lists (ip_allow and ip_deny,
+// denied addresses win, platform admins pass), ReputationGuard challenges listed IPs, ComingSoon
+// hides soft-launched tenants from anonymous visitors and Maintenance serves the maintenance page.
+// RateLimit enforces RATE_LIMITS per client IP, user or tenant; ClientIP only trusts the
+// forwarding headers of TRUSTED_PROXIES.
+//
+// LangMiddleware picks the language from the signed lang cookie or Accept-Language (RFC 4647
+// lookup, see NegotiateLang), and PreferredLang then applies the user's saved language and the
+// tenant's default_lang. With LANG_URL_PREFIX=true, LangPrefix serves pages under /fr/... and
+// strips the prefix before routing; LangPath builds links in the current language.
+//
+// Errors are answered with WriteError, which maps the typed errors (ErrNoTenant, ErrForbidden,
+// ErrCSRFInvalid, ErrRateLimited...) to a status and a stable code: RFC 7807 problem details for
+// /api/ and JSON clients, an HTML page (ErrorPage, translated with ErrorMessages) for browsers.
+// Error pages carry the support code of the request ID, which platform admins look up at
+// /admin/support.
 package middleware
 
 import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/pandamasta/tenkit/multitenant"
 )
 
+// TenantMiddleware resolves the tenant of the request and stores it in the context. Any
+// TenantResolver works, including a multitenant.ChainResolver combining several strategies;
+// resolvers implementing multitenant.PathRewriter get to strip their part of the path.
 func TenantMiddleware(cfg *multitenant.Config, resolver multitenant.TenantResolver, fetcher multitenant.TenantFetcher, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		subdomain, err := resolver.Resolve(r)
 		if err != nil {
-			slog.Error("[MIDDLEWARE] Resolution error", "err", err)
-			http.NotFound(w, r)
+			slog.ErrorContext(r.Context(), "[MIDDLEWARE] Resolution error", "err", err)
+			WriteError(w, r, WrapErr(ErrInvalidDomain, err.Error()))
 			return
 		}
 		ctx := r.Context()
 
 		if subdomain == "" {
-			slog.Info("[MIDDLEWARE] Default domain accessed", "host", r.Host)
+			if target := cfg.Server.RootRedirect; target != "" && !rootExempt(cfg, r.URL.Path) {
+				slog.DebugContext(r.Context(), "[MIDDLEWARE] Root domain redirected", "host", r.Host, "to", target)
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+			slog.InfoContext(r.Context(), "[MIDDLEWARE] Default domain accessed", "host", r.Host)
 			ctx = context.WithValue(ctx, isTenantCtxKey, false)
 			r = r.WithContext(ctx) // Ensure updated ctx is attached
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		slog.Info("[MIDDLEWARE] Looking up tenant for subdomain", "subdomain", subdomain, "host", r.Host)
+		slog.InfoContext(r.Context(), "[MIDDLEWARE] Looking up tenant for subdomain", "subdomain", subdomain, "host", r.Host)
 
-		t, err := fetcher.Fetch(ctx, subdomain)
+		// A preview host serves its tenant; a tenant actually named like one keeps its own host
+		var t *multitenant.Tenant
+		preview := false
+		if base, ok := cfg.Server.PreviewOf(subdomain); ok {
+			t, err = fetcher.Fetch(ctx, base)
+			preview = err == nil && t != nil
+		}
+		if !preview {
+			t, err = fetcher.Fetch(ctx, subdomain)
+		}
 		if err != nil {
-			slog.Error("[TENANT] Fetch error", "subdomain", subdomain, "err", err)
-			http.NotFound(w, r)
+			slog.ErrorContext(r.Context(), "[TENANT] Fetch error", "subdomain", subdomain, "err", err)
+			WriteError(w, r, WrapErr(ErrFetchTenant, err.Error()))
 			return
 		}
 		if t == nil {
-			slog.Error("[TENANT] Unknown or inactive tenant", "subdomain", subdomain)
-			http.NotFound(w, r)
+			slog.ErrorContext(r.Context(), "[TENANT] Unknown or inactive tenant", "subdomain", subdomain)
+			WriteError(w, r, ErrNoTenant)
 			return
 		}
 
-		slog.Info("[TENANT] Loaded tenant", "name", t.Name, "subdomain", t.Subdomain)
+		slog.InfoContext(r.Context(), "[TENANT] Loaded tenant", "name", t.Name, "subdomain", t.Subdomain)
+		if rw, ok := resolver.(multitenant.PathRewriter); ok {
+			r = rw.Rewrite(r, subdomain)
+		}
+		noteAccess(r, func(e *accessEntry) { e.tenant, e.tenantID = t.Subdomain, t.ID })
 		ctx = context.WithValue(ctx, TenantKey, t)
 		ctx = context.WithValue(ctx, isTenantCtxKey, true)
+		ctx = context.WithValue(ctx, previewKey, preview)
 		r = r.WithContext(ctx) // Ensure updated ctx is attached
 		next.ServeHTTP(w, r)
 	})
 }
 
+// rootExempt reports whether path is still served on the root domain when it redirects.
+func rootExempt(cfg *multitenant.Config, path string) bool {
+	for _, prefix := range cfg.Server.RootExemptPaths {
+		if path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(path, prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
 func FromContext(ctx context.Context) *multitenant.Tenant {
 	if t, ok := ctx.Value(TenantKey).(*multitenant.Tenant); ok {
 		return t
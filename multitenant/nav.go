@@ -0,0 +1,86 @@
+package multitenant
+
+import (
+	"sort"
+	"sync"
+)
+
+// NavItem is a menu entry rendered in the tenant navigation.
+type NavItem struct {
+	ID          string   // Stable identifier, used by per-tenant visibility settings
+	LabelKey    string   // i18n key of the label
+	Route       string   // Path the entry links to
+	Order       int      // Lower values are rendered first
+	RequireAuth bool     // Only shown to logged-in users
+	Roles       []string // If set, only shown to users holding one of these roles
+}
+
+// NavRegistry holds the menu entries registered by the embedding application.
+type NavRegistry struct {
+	mu    sync.RWMutex
+	items []NavItem
+}
+
+// DefaultNav is the registry used by the render package.
+var DefaultNav = NewNavRegistry()
+
+// NewNavRegistry returns an empty registry.
+func NewNavRegistry() *NavRegistry {
+	return &NavRegistry{}
+}
+
+// RegisterNav adds an item to DefaultNav.
+func RegisterNav(item NavItem) {
+	DefaultNav.Register(item)
+}
+
+// Register adds an item, replacing any previous item with the same ID.
+func (n *NavRegistry) Register(item NavItem) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, existing := range n.items {
+		if existing.ID == item.ID {
+			n.items[i] = item
+			return
+		}
+	}
+	n.items = append(n.items, item)
+	sort.SliceStable(n.items, func(i, j int) bool { return n.items[i].Order < n.items[j].Order })
+}
+
+// Items returns a copy of all registered items in display order.
+func (n *NavRegistry) Items() []NavItem {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	out := make([]NavItem, len(n.items))
+	copy(out, n.items)
+	return out
+}
+
+// Visible returns the items a visitor may see, given their role (empty when anonymous)
+// and the set of item IDs the tenant chose to hide.
+func (n *NavRegistry) Visible(role string, loggedIn bool, hidden map[string]bool) []NavItem {
+	var out []NavItem
+	for _, item := range n.Items() {
+		if hidden[item.ID] {
+			continue
+		}
+		if (item.RequireAuth || len(item.Roles) > 0) && !loggedIn {
+			continue
+		}
+		if len(item.Roles) > 0 && !hasRole(item.Roles, role) {
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
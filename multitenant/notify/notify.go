@@ -0,0 +1,81 @@
+// Package notify sends in-app notifications, listed in the notification menu of the tenant site and
+// at /notifications. A notification is a translation key with named arguments, rendered in the
+// language of its reader when shown:
+//
+//	notify.Send(ctx, userID, "invoice.paid", map[string]any{"Number": inv.Number})
+//	// en.json: "invoice.paid": "Invoice {{.Number}} was paid"
+//
+// Each notification is also pushed to the live updates of its user as a "notification" event.
+// Forward, subscribed to the event bus, notifies members of their role changes and link creators
+// of the users who joined through their invitations.
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/realtime"
+)
+
+// Send notifies a user. key is a translation key whose {{.Name}} placeholders are filled with args.
+func Send(ctx context.Context, userID int64, key string, args map[string]any) error {
+	return SendLink(ctx, userID, key, "", args)
+}
+
+// SendLink is Send for a notification leading to a page of the tenant site, e.g. "/groups/3".
+// Links leaving the site are dropped.
+func SendLink(ctx context.Context, userID int64, key, link string, args map[string]any) error {
+	if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") || strings.HasPrefix(link, "/\\") {
+		link = ""
+	}
+	n := models.Notification{UserID: userID, Key: key, Args: args, URL: link}
+	if err := models.CreateNotification(ctx, &n); err != nil {
+		return err
+	}
+	if n.ID == 0 {
+		slog.WarnContext(ctx, "[NOTIFY] Notification to an unknown user dropped", "user_id", userID, "key", key)
+		return nil
+	}
+	slog.DebugContext(ctx, "[NOTIFY] Notification sent", "user_id", userID, "key", key, "id", n.ID)
+	_ = realtime.Send(ctx, n.TenantID, userID, realtime.EventNotification, map[string]any{"id": n.ID, "key": key, "url": link})
+	return nil
+}
+
+// Forward turns events of the bus into notifications. Subscribe it with
+// events.Subscribe(events.All, notify.Forward).
+func Forward(ctx context.Context, e events.Event) {
+	var err error
+	switch e.Name {
+	case events.MemberRoleChanged:
+		role, _ := e.Data["role"].(string)
+		previous, _ := e.Data["previous_role"].(string)
+		by, _ := e.Data["changed_by"].(string)
+		if role != previous {
+			err = Send(ctx, e.UserID, "notify.role_changed", map[string]any{"Role": role, "By": by})
+		}
+	case events.UserConfirmed:
+		err = invitationAccepted(ctx, e)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "[NOTIFY] Failed to notify", "event", e.Name, "tenant_id", e.TenantID, "err", err)
+	}
+}
+
+// invitationAccepted notifies the creator of the signup link a user confirmed their account with.
+func invitationAccepted(ctx context.Context, e events.Event) error {
+	linkID, _ := e.Data["signup_link_id"].(int64)
+	if linkID == 0 {
+		return nil
+	}
+	link, err := models.GetSignupLink(ctx, e.TenantID, linkID)
+	if err != nil || link == nil || link.CreatedBy == 0 || link.CreatedBy == e.UserID {
+		return err
+	}
+	email, _ := e.Data["email"].(string)
+	return SendLink(ctx, link.CreatedBy, "notify.invitation_accepted",
+		"/admin/members?"+url.Values{"q": {email}}.Encode(), map[string]any{"Email": email})
+}
@@ -0,0 +1,321 @@
+// Package openapi builds the OpenAPI 3 document of the JSON endpoints from operations declared in Go
+// next to their routes, so that client SDKs can be generated. Request and response schemas are
+// derived from the Go types by reflection, following their json tags.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Scopes tell on which hosts an operation is served. Tenants are resolved from the host, so a
+// tenant-scoped operation acts on the tenant of <tenant>.<domain> (or of its custom domain).
+const (
+	ScopeRoot   = "root"   // Only on the root domain
+	ScopeTenant = "tenant" // Only on tenant hosts
+	ScopeAny    = "any"    // On both
+)
+
+// Security schemes operations may require.
+const (
+	AuthBearer    = "bearerAuth"     // Access token returned by POST /api/v1/login
+	AuthAPIKey    = "apiKey"         // Tenant API key, as a bearer token or X-API-Key
+	AuthProvision = "provisionToken" // TENANT_PROVISION_TOKEN
+)
+
+// Response describes one response of an operation. Body is a value of the Go type answered,
+// e.g. User{}; nil for responses without a body, except errors which default to problem details.
+type Response struct {
+	Description string
+	Body        any
+}
+
+// Operation is the metadata of one route.
+type Operation struct {
+	Method      string // e.g. http.MethodPost
+	Path        string // e.g. "/api/v1/login"
+	ID          string // operationId, e.g. "login"
+	Summary     string
+	Description string
+	Tags        []string
+	Scope       string      // ScopeRoot, ScopeTenant or ScopeAny
+	Security    []string    // Any one of these schemes is accepted; empty for public operations
+	Request     any         // Value of the Go type of the JSON body, nil when there is none
+	Query       []Parameter // Query string parameters
+	Responses   map[int]Response
+}
+
+// Parameter describes a query string parameter of an operation.
+type Parameter struct {
+	Name        string
+	Type        string // "string" or "integer"
+	Description string
+}
+
+// Info is the document-level information.
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	Scheme      string // "https", or "http" in development
+	Domain      string // Root domain, e.g. "example.com"
+}
+
+// Registry holds the operations declared by tenkit and the embedding application.
+type Registry struct {
+	mu  sync.RWMutex
+	ops []Operation
+}
+
+// Default is the registry served at /api/openapi.json.
+var Default = &Registry{}
+
+// Register adds an operation to Default.
+func Register(op Operation) {
+	Default.Register(op)
+}
+
+// Register adds an operation, replacing any previous one with the same method and path.
+func (g *Registry) Register(op Operation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, existing := range g.ops {
+		if existing.Method == op.Method && existing.Path == op.Path {
+			g.ops[i] = op
+			return
+		}
+	}
+	g.ops = append(g.ops, op)
+}
+
+// Handle registers h on mux at "<method> <path>" and declares op for it.
+func (g *Registry) Handle(mux *http.ServeMux, op Operation, h http.Handler) {
+	mux.Handle(op.Method+" "+op.Path, h)
+	g.Register(op)
+}
+
+// Operations returns a copy of the operations sorted by path and method.
+func (g *Registry) Operations() []Operation {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make([]Operation, len(g.ops))
+	copy(out, g.ops)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// Document returns the OpenAPI 3.0 document of the registered operations, ready for JSON encoding.
+func (g *Registry) Document(info Info) map[string]any {
+	b := &builder{schemas: map[string]any{}}
+	rootServer := map[string]any{"url": info.Scheme + "://" + info.Domain, "description": "Root domain"}
+	tenantServer := map[string]any{
+		"url":         info.Scheme + "://{tenant}." + info.Domain,
+		"description": "Tenant host; the tenant is resolved from the subdomain, or from a custom domain",
+		"variables":   map[string]any{"tenant": map[string]any{"default": "acme", "description": "Tenant subdomain"}},
+	}
+
+	paths := map[string]any{}
+	for _, op := range g.Operations() {
+		item, _ := paths[op.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		o := map[string]any{
+			"operationId":    op.ID,
+			"summary":        op.Summary,
+			"x-tenant-scope": op.Scope,
+			"responses":      b.responses(op.Responses),
+		}
+		if op.Description != "" {
+			o["description"] = op.Description
+		}
+		if len(op.Tags) > 0 {
+			o["tags"] = op.Tags
+		}
+		switch op.Scope {
+		case ScopeRoot:
+			o["servers"] = []any{rootServer}
+		case ScopeTenant:
+			o["servers"] = []any{tenantServer}
+		}
+		security := []any{}
+		for _, s := range op.Security {
+			security = append(security, map[string]any{s: []string{}})
+		}
+		o["security"] = security
+		if len(op.Query) > 0 {
+			params := []any{}
+			for _, p := range op.Query {
+				params = append(params, map[string]any{
+					"name": p.Name, "in": "query", "description": p.Description,
+					"schema": map[string]any{"type": p.Type},
+				})
+			}
+			o["parameters"] = params
+		}
+		if op.Request != nil {
+			o["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json":                  map[string]any{"schema": b.schema(reflect.TypeOf(op.Request))},
+					"application/x-www-form-urlencoded": map[string]any{"schema": b.schema(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+		item[strings.ToLower(op.Method)] = o
+	}
+
+	b.schemas["Problem"] = map[string]any{
+		"type":        "object",
+		"description": "RFC 7807 problem details",
+		"required":    []string{"type", "title", "status", "code"},
+		"properties": map[string]any{
+			"type":         map[string]any{"type": "string"},
+			"title":        map[string]any{"type": "string", "description": "Status text in the request language"},
+			"status":       map[string]any{"type": "integer", "format": "int32"},
+			"detail":       map[string]any{"type": "string", "description": "Message in the request language"},
+			"instance":     map[string]any{"type": "string"},
+			"code":         map[string]any{"type": "string", "description": "Stable machine-readable code, e.g. invalid_credentials"},
+			"request_id":   map[string]any{"type": "string"},
+			"support_code": map[string]any{"type": "string", "description": "Code users quote to support"},
+		},
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"servers": []any{rootServer, tenantServer},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				AuthBearer:    map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT", "description": "Access token of POST /api/v1/login, valid on the tenant that issued it"},
+				AuthAPIKey:    map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "Tenant API key; also accepted as a bearer token"},
+				AuthProvision: map[string]any{"type": "http", "scheme": "bearer", "description": "TENANT_PROVISION_TOKEN of the platform"},
+			},
+		},
+	}
+}
+
+// builder collects the named schemas referenced by the document.
+type builder struct {
+	schemas map[string]any
+}
+
+func (b *builder) responses(rs map[int]Response) map[string]any {
+	out := map[string]any{}
+	codes := make([]int, 0, len(rs))
+	for code := range rs {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		r := rs[code]
+		resp := map[string]any{"description": r.Description}
+		switch {
+		case r.Body != nil:
+			resp["content"] = map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(r.Body))}}
+		case code >= 400:
+			resp["content"] = map[string]any{"application/problem+json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Problem"}}}
+		}
+		out[strconv.Itoa(code)] = resp
+	}
+	return out
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t. Named struct types become components referenced by $ref.
+func (b *builder) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		s := b.schema(t.Elem())
+		s["nullable"] = true
+		return s
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		format := "int64"
+		if t.Bits() <= 32 {
+			format = "int32"
+		}
+		return map[string]any{"type": "integer", "format": format}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if name == "" {
+			return b.object(t)
+		}
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]any{} // Placeholder for recursive types
+			b.schemas[name] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// object returns the inline schema of a struct from its json tags.
+func (b *builder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// schemaName names the component of a struct type after it, capitalized: apiUser becomes "ApiUser".
+// Anonymous and generic types are inlined.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" || strings.Contains(name, "[") {
+		return ""
+	}
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
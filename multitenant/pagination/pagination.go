@@ -0,0 +1,366 @@
+// Package pagination parses the paging, sorting and filtering parameters of list pages and API
+// endpoints, runs the matching tenant-scoped query, and describes the resulting page for pager
+// controls (see templates/pager.html) and JSON envelopes.
+//
+// Lists work in one of two modes. Offset mode (?page=2, or ?offset=50 for API clients) serves rows
+// sorted on any declared column, with a total count. Cursor mode (?cursor=...) walks rows in ID
+// order, which stays stable while rows are added, e.g. an audit log; cursors are opaque to clients.
+// Both take ?limit=, clamped to the maximum of the list, and ?sort=name or ?sort=-name for
+// descending order.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page sizes used when a list declares none.
+const (
+	DefaultLimit = 25
+	MaxLimit     = 100
+)
+
+// maxFilterLength bounds the filter values kept from a request.
+const maxFilterLength = 200
+
+// ErrInvalid is returned by List.Parse for a malformed limit, offset, cursor or sort.
+var ErrInvalid = errors.New("invalid pagination parameters")
+
+// Mode selects how a list pages through its rows.
+type Mode int
+
+const (
+	OffsetMode Mode = iota // Sorted on any declared column, with a total
+	CursorMode             // In ID order, resumed after the last ID seen
+)
+
+// List declares what a list accepts. Declare lists once, as package variables.
+type List struct {
+	Mode     Mode
+	Limit    int               // Default page size, DefaultLimit when 0
+	MaxLimit int               // Largest page size, MaxLimit when 0
+	Sorts    map[string]string // Offset mode: sort names clients may use and their SQL expressions
+	Sort     string            // Default sort, "-" prefixed for descending, e.g. "-joined"; "id" or "-id" in cursor mode
+	Filters  []string          // Query parameters kept as filters, e.g. "q" or "role"
+}
+
+// Request is the page a client asked for.
+type Request struct {
+	List    *List
+	Limit   int
+	Offset  int               // Offset mode: rows skipped
+	After   int64             // Cursor mode: ID the page starts after, 0 for the first page
+	Sort    string            // Name in List.Sorts, "id" in cursor mode
+	Desc    bool              // Descending order
+	Filters map[string]string // Non-empty filters, by name
+}
+
+// Parse reads the page asked for by the query parameters q. On error the returned request is the
+// first page in the default order, with the filters, so HTML pages may ignore the error; API
+// endpoints should answer 400.
+func (l *List) Parse(q url.Values) (Request, error) {
+	req := l.first()
+	for _, name := range l.Filters {
+		if v := strings.TrimSpace(q.Get(name)); v != "" {
+			if len(v) > maxFilterLength {
+				v = v[:maxFilterLength]
+			}
+			req.Filters[name] = v
+		}
+	}
+	fail := func() (Request, error) {
+		req.Offset, req.After = 0, 0
+		req.Sort, req.Desc = l.defaultSort()
+		return req, ErrInvalid
+	}
+
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fail()
+		}
+		req.Limit = min(n, l.maxLimit())
+	}
+	if s := q.Get("sort"); s != "" {
+		name, desc := strings.CutPrefix(s, "-")
+		if !l.sortable(name) {
+			return fail()
+		}
+		req.Sort, req.Desc = name, desc
+	}
+	switch l.Mode {
+	case CursorMode:
+		if s := q.Get("cursor"); s != "" {
+			id, err := decodeCursor(s)
+			if err != nil {
+				return fail()
+			}
+			req.After = id
+		}
+	default:
+		if s := q.Get("offset"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return fail()
+			}
+			req.Offset = n
+		} else if s := q.Get("page"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return fail()
+			}
+			req.Offset = (n - 1) * req.Limit
+		}
+	}
+	return req, nil
+}
+
+// first returns the first page in the default order.
+func (l *List) first() Request {
+	req := Request{List: l, Limit: l.Limit, Filters: map[string]string{}}
+	if req.Limit <= 0 {
+		req.Limit = DefaultLimit
+	}
+	req.Limit = min(req.Limit, l.maxLimit())
+	req.Sort, req.Desc = l.defaultSort()
+	return req
+}
+
+func (l *List) maxLimit() int {
+	if l.MaxLimit > 0 {
+		return l.MaxLimit
+	}
+	return MaxLimit
+}
+
+func (l *List) defaultSort() (string, bool) {
+	name, desc := strings.CutPrefix(l.Sort, "-")
+	if l.Mode == CursorMode {
+		return "id", desc
+	}
+	return name, desc
+}
+
+func (l *List) sortable(name string) bool {
+	if l.Mode == CursorMode {
+		return name == "id"
+	}
+	_, ok := l.Sorts[name]
+	return ok
+}
+
+// Filter returns the value of a filter, "" when unset.
+func (r Request) Filter(name string) string {
+	return r.Filters[name]
+}
+
+// SortParam returns the sort as written in URLs, e.g. "-joined".
+func (r Request) SortParam() string {
+	if r.Desc {
+		return "-" + r.Sort
+	}
+	return r.Sort
+}
+
+// query returns the parameters that select the same rows: the filters, and the sort and limit
+// when they differ from the defaults.
+func (r Request) query() url.Values {
+	q := url.Values{}
+	for name, v := range r.Filters {
+		q.Set(name, v)
+	}
+	if r.List == nil {
+		return q
+	}
+	if r.SortParam() != r.List.first().SortParam() {
+		q.Set("sort", r.SortParam())
+	}
+	if r.Limit != r.List.first().Limit {
+		q.Set("limit", strconv.Itoa(r.Limit))
+	}
+	return q
+}
+
+// encodeCursor returns the opaque cursor resuming after id.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("id:" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(s string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, err
+	}
+	rest, ok := strings.CutPrefix(string(b), "id:")
+	if !ok {
+		return 0, ErrInvalid
+	}
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalid
+	}
+	return id, nil
+}
+
+// Page is a page of results: the request plus what the query found, with the URLs of pager
+// controls. URLs are query strings relative to the current page, e.g. "?page=2&q=ann".
+type Page struct {
+	Request
+	Total   int  // Offset mode: rows matching the filters; -1 in cursor mode
+	Count   int  // Rows on this page
+	HasNext bool // Another page follows
+	last    int64
+}
+
+// HasPrev reports whether pages come before this one.
+func (p Page) HasPrev() bool {
+	return p.Offset > 0 || p.After > 0
+}
+
+// NextCursor returns the cursor of the next page in cursor mode, "" on the last page.
+func (p Page) NextCursor() string {
+	if p.List == nil || p.List.Mode != CursorMode || !p.HasNext {
+		return ""
+	}
+	return encodeCursor(p.last)
+}
+
+// Number returns the 1-based number of the page in offset mode.
+func (p Page) Number() int {
+	return p.Offset/max(p.Limit, 1) + 1
+}
+
+// Pages returns the number of pages in offset mode, at least 1.
+func (p Page) Pages() int {
+	return max((p.Total+p.Limit-1)/max(p.Limit, 1), 1)
+}
+
+// From returns the 1-based position of the first row of the page, 0 when it is empty.
+func (p Page) From() int {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.Offset + 1
+}
+
+// To returns the 1-based position of the last row of the page.
+func (p Page) To() int {
+	return p.Offset + p.Count
+}
+
+// NextURL returns the URL of the next page, "" on the last one.
+func (p Page) NextURL() string {
+	if !p.HasNext {
+		return ""
+	}
+	q := p.query()
+	if p.List != nil && p.List.Mode == CursorMode {
+		q.Set("cursor", p.NextCursor())
+	} else {
+		q.Set("page", strconv.Itoa(p.Number()+1))
+	}
+	return "?" + q.Encode()
+}
+
+// PrevURL returns the URL of the previous page, or of the first one in cursor mode, "" on the
+// first page.
+func (p Page) PrevURL() string {
+	if !p.HasPrev() {
+		return ""
+	}
+	q := p.query()
+	if p.Offset > 0 && p.Number() > 2 {
+		q.Set("page", strconv.Itoa(p.Number()-1))
+	}
+	return "?" + q.Encode()
+}
+
+// SortURL returns the URL of the first page sorted on name: ascending, or descending when the
+// list already is sorted on name in ascending order.
+func (p Page) SortURL(name string) string {
+	q := p.query()
+	sort := name
+	if p.Sort == name && !p.Desc {
+		sort = "-" + name
+	}
+	q.Set("sort", sort)
+	return "?" + q.Encode()
+}
+
+// SortMark returns "▲" or "▼" when the list is sorted on name, for column headers.
+func (p Page) SortMark(name string) string {
+	switch {
+	case p.Sort != name:
+		return ""
+	case p.Desc:
+		return "▼"
+	default:
+		return "▲"
+	}
+}
+
+// Trim drops the extra row that Query.SQL fetches to detect a following page, and returns the
+// page of items. id returns the ID of an item, from which the next cursor is made.
+func Trim[T any](req Request, items []T, id func(T) int64) ([]T, Page) {
+	p := Page{Request: req, Total: -1}
+	if len(items) > req.Limit {
+		items = items[:req.Limit]
+		p.HasNext = true
+	}
+	if len(items) > 0 {
+		p.last = id(items[len(items)-1])
+	}
+	p.Count = len(items)
+	if items == nil {
+		items = []T{}
+	}
+	return items, p
+}
+
+// Envelope is the JSON of a page of an API list, {"data": [...], "pagination": {...}}.
+type Envelope[T any] struct {
+	Data       []T  `json:"data"`
+	Pagination Info `json:"pagination"`
+}
+
+// Info describes a page in JSON envelopes.
+type Info struct {
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"` // Offset mode
+	Total      *int   `json:"total,omitempty"`  // Offset mode, when the rows were counted
+	Sort       string `json:"sort"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor mode; pass it as ?cursor= for the next page
+}
+
+// NewEnvelope returns the JSON envelope of a page of items.
+func NewEnvelope[T any](items []T, p Page) Envelope[T] {
+	if items == nil {
+		items = []T{}
+	}
+	info := Info{Limit: p.Limit, Sort: p.SortParam(), HasMore: p.HasNext, NextCursor: p.NextCursor()}
+	if p.List == nil || p.List.Mode == OffsetMode {
+		info.Offset = &p.Offset
+		if p.Total >= 0 {
+			info.Total = &p.Total
+		}
+	}
+	return Envelope[T]{Data: items, Pagination: info}
+}
+
+// likeEscaper escapes the LIKE wildcards of patterns written "column LIKE ? ESCAPE '\'".
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Contains returns the LIKE pattern of values containing s, for conditions written
+// "column LIKE ? ESCAPE '\'".
+func Contains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// Prefix returns the LIKE pattern of values starting with s, like Contains.
+func Prefix(s string) string {
+	return likeEscaper.Replace(s) + "%"
+}
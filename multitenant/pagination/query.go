@@ -0,0 +1,109 @@
+package pagination
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pandamasta/tenkit/db"
+)
+
+// Query is the SQL of a list. Rows are scoped to one tenant through the Tenant column, so that a
+// forgotten condition cannot leak rows across tenants; only platform lists leave it empty.
+type Query struct {
+	Select   string // Columns, e.g. "u.id, u.email"
+	From     string // Tables, e.g. "memberships m JOIN users u ON u.id = m.user_id"
+	Tenant   string // Column holding the tenant ID, e.g. "m.tenant_id"
+	TenantID int64
+	ID       string // Unique column breaking sort ties and followed by cursors, e.g. "u.id"
+
+	where []string
+	args  []any
+}
+
+// Where adds a condition, e.g. q.Where("m.role = ?", role).
+func (q *Query) Where(cond string, args ...any) *Query {
+	q.where = append(q.where, "("+cond+")")
+	q.args = append(q.args, args...)
+	return q
+}
+
+// conditions returns the WHERE clause of the rows matching the filters, with its arguments.
+func (q *Query) conditions() (string, []any) {
+	where := append([]string{}, q.where...)
+	args := append([]any{}, q.args...)
+	if q.Tenant != "" {
+		where = append([]string{q.Tenant + " = ?"}, where...)
+		args = append([]any{q.TenantID}, args...)
+	}
+	if len(where) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// SQL returns the query of the page asked for by req. It fetches one row more than the page, which
+// Trim drops after noting that another page follows.
+func (q *Query) SQL(req Request) (string, []any) {
+	where, args := q.conditions()
+	dir := " ASC"
+	if req.Desc {
+		dir = " DESC"
+	}
+	if req.After > 0 {
+		op := " > ?"
+		if req.Desc {
+			op = " < ?"
+		}
+		if where == "" {
+			where = " WHERE " + q.ID + op
+		} else {
+			where += " AND " + q.ID + op
+		}
+		args = append(args, req.After)
+	}
+	order := q.ID + dir
+	if expr, ok := req.List.Sorts[req.Sort]; ok && req.List.Mode == OffsetMode {
+		order = expr + dir + ", " + order
+	}
+	args = append(args, req.Limit+1, req.Offset)
+	return "SELECT " + q.Select + " FROM " + q.From + where + " ORDER BY " + order + " LIMIT ? OFFSET ?", args
+}
+
+// CountSQL returns the query counting the rows matching the filters.
+func (q *Query) CountSQL() (string, []any) {
+	where, args := q.conditions()
+	return "SELECT COUNT(*) FROM " + q.From + where, args
+}
+
+// Fetch runs the query of the page asked for by req, reading each row with scan, and counts the
+// matching rows in offset mode. id returns the ID of an item, see Trim.
+func Fetch[T any](ctx context.Context, q *Query, req Request, scan func(*sql.Rows) (T, error), id func(T) int64) ([]T, Page, error) {
+	query, args := q.SQL(req)
+	rows, err := db.LogQuery(ctx, db.DB, query, args...)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, Page{}, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, Page{}, err
+	}
+	items, page := Trim(req, items, id)
+
+	if req.List.Mode == OffsetMode {
+		query, args := q.CountSQL()
+		if err := db.LogQueryRow(ctx, db.DB, query, args...).Scan(&page.Total); err != nil {
+			return nil, Page{}, err
+		}
+	}
+	return items, page, nil
+}
@@ -0,0 +1,64 @@
+package multitenant
+
+import (
+	"sort"
+	"sync"
+)
+
+// Permission is a capability an application grants to groups of a tenant, such as
+// "invoices.approve". Tenant admins grant the registered permissions from the group page; a
+// member holds the permissions of every group they belong to.
+type Permission struct {
+	Name     string // Stored in group_permissions.permission
+	LabelKey string // i18n key of the display name
+}
+
+// PermissionRegistry holds the permissions registered by the embedding application.
+type PermissionRegistry struct {
+	mu    sync.RWMutex
+	items map[string]Permission
+}
+
+// DefaultPermissions is the registry the group page offers permissions from.
+var DefaultPermissions = NewPermissionRegistry()
+
+// NewPermissionRegistry returns an empty registry.
+func NewPermissionRegistry() *PermissionRegistry {
+	return &PermissionRegistry{items: map[string]Permission{}}
+}
+
+// RegisterPermission adds a permission to DefaultPermissions.
+func RegisterPermission(p Permission) {
+	DefaultPermissions.Register(p)
+}
+
+// Register adds a permission, replacing any previous one with the same name. The label defaults
+// to "permission.<name>".
+func (p *PermissionRegistry) Register(perm Permission) {
+	if perm.LabelKey == "" {
+		perm.LabelKey = "permission." + perm.Name
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.items[perm.Name] = perm
+}
+
+// Get returns the permission with the given name.
+func (p *PermissionRegistry) Get(name string) (Permission, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	perm, ok := p.items[name]
+	return perm, ok
+}
+
+// Items returns the registered permissions by name.
+func (p *PermissionRegistry) Items() []Permission {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]Permission, 0, len(p.items))
+	for _, perm := range p.items {
+		out = append(out, perm)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,45 @@
+package multitenant
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PreviewPlaceholder stands for the tenant subdomain in ServerConfig.PreviewPattern.
+const PreviewPlaceholder = "{sub}"
+
+// PreviewOf reports whether identifier names the preview host of a tenant, e.g. "acme-preview"
+// for the pattern "{sub}-preview", and returns the tenant subdomain.
+func (c ServerConfig) PreviewOf(identifier string) (string, bool) {
+	prefix, suffix, ok := strings.Cut(c.PreviewPattern, PreviewPlaceholder)
+	if !ok || (prefix == "" && suffix == "") {
+		return "", false
+	}
+	if len(identifier) <= len(prefix)+len(suffix) || !strings.HasPrefix(identifier, prefix) || !strings.HasSuffix(identifier, suffix) {
+		return "", false
+	}
+	return identifier[len(prefix) : len(identifier)-len(suffix)], true
+}
+
+// PreviewHost returns the preview identifier of a tenant subdomain, or "" when previews are disabled.
+func (c ServerConfig) PreviewHost(subdomain string) string {
+	if !strings.Contains(c.PreviewPattern, PreviewPlaceholder) {
+		return ""
+	}
+	return strings.Replace(c.PreviewPattern, PreviewPlaceholder, subdomain, 1)
+}
+
+// validatePreviewPattern checks the pattern keeps the tenant subdomain a single DNS label.
+func validatePreviewPattern(p string) error {
+	if p == "" {
+		return nil
+	}
+	if strings.Count(p, PreviewPlaceholder) != 1 || p == PreviewPlaceholder {
+		return fmt.Errorf("TENANT_PREVIEW_PATTERN must contain %s once with a prefix or suffix, got %q", PreviewPlaceholder, p)
+	}
+	rest := strings.Replace(p, PreviewPlaceholder, "", 1)
+	if strings.Trim(rest, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		return fmt.Errorf("TENANT_PREVIEW_PATTERN may only add letters, digits and hyphens, got %q", p)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package multitenant
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/events"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// Provisioning errors, wrapping the reason a tenant could not be created.
+var (
+	ErrInvalidName      = errors.New("tenant name is required")
+	ErrInvalidEmail     = errors.New("invalid owner email")
+	ErrInvalidSubdomain = errors.New("invalid subdomain")
+	ErrTenantExists     = models.ErrTenantExists // Matched by models.ErrSubdomainTaken and the other fields taken
+	ErrInvalidParent    = errors.New("parent tenant not found or itself a sub-tenant")
+)
+
+// ValidEmail reports whether email is acceptable as an account address.
+func ValidEmail(email string) bool {
+	return emailRegex.MatchString(email)
+}
+
+// ProvisionRequest describes a tenant created programmatically, e.g. from a billing or CRM system.
+type ProvisionRequest struct {
+	Config        *Config // Validation rules and owner role
+	Name          string
+	Subdomain     string // Derived from Name like /enroll does when empty, suffixed until free
+	OwnerEmail    string
+	OwnerPassword string // Optional; without one the owner sets a password through /forgot
+	Plan          string // Optional limits plan; the platform default applies when empty
+	// Parent is the subdomain of the tenant owning a sub-tenant, "" for a top-level tenant. Subdomain
+	// is then the label prepended to it: "client" under "agency" is served at client.agency.<domain>.
+	Parent string
+}
+
+// ProvisionTenant creates an active tenant with its owner, applying the checks of /enroll and
+// /verify without the email round trip. It returns ErrInvalidName, ErrInvalidEmail,
+// ErrInvalidSubdomain, ErrInvalidParent or ErrTenantExists for requests that cannot succeed.
+// Sub-tenants have one level: the parent must be a top-level tenant.
+func ProvisionTenant(ctx context.Context, req ProvisionRequest) (*Tenant, error) {
+	name := strings.TrimSpace(req.Name)
+	email := strings.ToLower(strings.TrimSpace(req.OwnerEmail))
+	sub := strings.ToLower(strings.TrimSpace(req.Subdomain))
+	switch {
+	case name == "":
+		return nil, ErrInvalidName
+	case !ValidEmail(email):
+		return nil, ErrInvalidEmail
+	}
+	derived := sub == ""
+
+	var parentID int64
+	suffix := ""
+	if req.Parent != "" {
+		parent, err := models.GetTenantBySubdomain(ctx, db.DB, strings.ToLower(strings.TrimSpace(req.Parent)))
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.ParentID.Valid {
+			return nil, ErrInvalidParent
+		}
+		parentID, suffix = int64(parent.ID), "."+parent.Subdomain
+		if !derived {
+			sub += suffix
+		}
+	}
+
+	var hash string
+	if req.OwnerPassword != "" {
+		b, err := bcrypt.GenerateFromPassword([]byte(req.OwnerPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		hash = string(b)
+	}
+	// A derived subdomain taken by a concurrent signup meanwhile is derived again
+	var id int64
+	for attempt := 1; ; attempt++ {
+		if derived {
+			var err error
+			if suffix != "" {
+				sub, err = req.Config.Server.AvailableSubTenantSubdomain(ctx, name, suffix[1:])
+			} else {
+				sub, err = req.Config.Server.AvailableSubdomain(ctx, name)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		label, ok := strings.CutSuffix(sub, suffix)
+		if !ok || !req.Config.Server.ValidSubdomain(label) {
+			return nil, ErrInvalidSubdomain
+		}
+		var err error
+		id, _, err = models.CreateTenantWithOwner(ctx, models.NewTenant{
+			Name:         name,
+			Subdomain:    sub,
+			OwnerEmail:   email,
+			PasswordHash: hash,
+			OwnerRole:    req.Config.Roles.Owner,
+			Plan:         req.Plan,
+			ParentID:     parentID,
+		})
+		if err == nil {
+			break
+		}
+		if !derived || !errors.Is(err, models.ErrSubdomainTaken) || attempt == 3 {
+			return nil, err
+		}
+	}
+
+	events.Publish(ctx, events.Event{
+		Name:     events.TenantCreated,
+		TenantID: id,
+		Data:     map[string]any{"subdomain": sub, "name": name, "owner_email": email, "plan": req.Plan, "parent_id": parentID},
+	})
+	return &Tenant{ID: id, Subdomain: sub, Name: name, RateLimitFactor: 1, Plan: req.Plan, ParentID: parentID}, nil
+}
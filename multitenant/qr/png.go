@@ -0,0 +1,32 @@
+package qr
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Image returns the code as a black and white image with scale pixels per module.
+func (c *Code) Image(scale, border int) image.Image {
+	dim := (c.Size + border*2) * scale
+	img := image.NewPaletted(image.Rect(0, 0, dim, dim), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+border)*scale+dx, (y+border)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG encodes the code as PNG.
+func (c *Code) WritePNG(w io.Writer, scale, border int) error {
+	return png.Encode(w, c.Image(scale, border))
+}
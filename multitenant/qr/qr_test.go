@@ -0,0 +1,179 @@
+package qr
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// formatInfo is the format information table of ISO/IEC 18004 Annex C, masked with 0x5412,
+// indexed by level, then mask.
+var formatInfo = [4][8]int{
+	Low:      {0x77C4, 0x72F3, 0x7DAA, 0x789D, 0x662F, 0x6318, 0x6C41, 0x6976},
+	Medium:   {0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0},
+	Quartile: {0x355F, 0x3068, 0x3F31, 0x3A06, 0x24B4, 0x2183, 0x2EDA, 0x2BED},
+	High:     {0x1689, 0x13BE, 0x1CE7, 0x19D0, 0x0762, 0x0255, 0x0D0C, 0x083B},
+}
+
+// versionInfo is the version information table of ISO/IEC 18004 Annex D, for versions 7 to 40.
+var versionInfo = []int{
+	0x07C94, 0x085BC, 0x09A99, 0x0A4D3, 0x0BBF6, 0x0C762, 0x0D847, 0x0E60D, 0x0F928, 0x10B78,
+	0x1145D, 0x12A17, 0x13532, 0x149A6, 0x15683, 0x168C9, 0x177EC, 0x18EC4, 0x191E1, 0x1AFAB,
+	0x1B08E, 0x1CC1A, 0x1D33F, 0x1ED75, 0x1F250, 0x209D5, 0x216F0, 0x228BA, 0x2379F, 0x24B0B,
+	0x2542E, 0x26A64, 0x27541, 0x28C69,
+}
+
+func TestFormatBits(t *testing.T) {
+	for level := Low; level <= High; level++ {
+		for mask := 0; mask < 8; mask++ {
+			c := newCode(1, level)
+			c.drawFormatBits(mask)
+
+			// First copy: column 8 from the top, then row 8 towards the left, skipping the timing patterns
+			var first, second int
+			for i, y := range []int{0, 1, 2, 3, 4, 5, 7, 8} {
+				if c.Black(8, y) {
+					first |= 1 << i
+				}
+			}
+			for i, x := range []int{7, 5, 4, 3, 2, 1, 0} {
+				if c.Black(x, 8) {
+					first |= 1 << (8 + i)
+				}
+			}
+			// Second copy: row 8 from the right edge, then column 8 down to the bottom edge
+			for i := 0; i < 8; i++ {
+				if c.Black(c.Size-1-i, 8) {
+					second |= 1 << i
+				}
+			}
+			for i := 0; i < 7; i++ {
+				if c.Black(8, c.Size-7+i) {
+					second |= 1 << (8 + i)
+				}
+			}
+
+			want := formatInfo[level][mask]
+			if first != want || second != want {
+				t.Errorf("level %d mask %d: got %#04x and %#04x, want %#04x", level, mask, first, second, want)
+			}
+			if !c.Black(8, c.Size-8) {
+				t.Errorf("level %d mask %d: dark module is light", level, mask)
+			}
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	for i, want := range versionInfo {
+		version := 7 + i
+		c := newCode(version, Low)
+		c.drawVersion()
+
+		// Bottom left block, 3 rows by 6 columns, and its transpose at the top right
+		var bottom, right int
+		for bit := 0; bit < 18; bit++ {
+			a, b := c.Size-11+bit%3, bit/3
+			if c.Black(b, a) {
+				bottom |= 1 << bit
+			}
+			if c.Black(a, b) {
+				right |= 1 << bit
+			}
+		}
+		if bottom != want || right != want {
+			t.Errorf("version %d: got %#05x and %#05x, want %#05x", version, bottom, right, want)
+		}
+	}
+
+	c := newCode(6, Low)
+	c.drawVersion()
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunc[y][x] {
+				t.Fatalf("version 6: module %d,%d reserved, versions below 7 carry no version information", x, y)
+			}
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	tests := []struct {
+		name      string
+		data, ecc []byte
+	}{
+		{
+			// ISO/IEC 18004 Annex I: "01234567" in numeric mode, version 1-M
+			name: "annex I",
+			data: []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11},
+			ecc:  []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55},
+		},
+		{
+			// "HELLO WORLD" in alphanumeric mode, version 1-M
+			name: "hello world",
+			data: []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17},
+			ecc:  []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23},
+		},
+	}
+	for _, tt := range tests {
+		if got := rsRemainder(tt.data, rsDivisor(len(tt.ecc))); !bytes.Equal(got, tt.ecc) {
+			t.Errorf("%s: got % X, want % X", tt.name, got, tt.ecc)
+		}
+	}
+}
+
+func TestEncodeSymbol(t *testing.T) {
+	// "hello world" in byte mode, version 1-M with mask 3
+	want := strings.Fields(`
+		#######.##.##.#######
+		#.....#.#####.#.....#
+		#.###.#....##.#.###.#
+		#.###.#.###.#.#.###.#
+		#.###.#..###..#.###.#
+		#.....#..####.#.....#
+		#######.#.#.#.#######
+		........#####........
+		#.##.###..###.#..#.##
+		.##.##.#.#.########.#
+		...##.###.##.#.#...##
+		.#####.#..##...#.#.#.
+		...#.#####..###.....#
+		........####..###.#..
+		#######.#########....
+		#.....#.#....#.#.####
+		#.###.#..#..#....##..
+		#.###.#.#.#...#..###.
+		#.###.#.##..#..#..#..
+		#.....#...##.####...#
+		#######.#.##.###..#..`)
+
+	c, err := Encode("hello world", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 1 || c.Size != len(want) {
+		t.Fatalf("got version %d of size %d, want version 1 of size %d", c.Version, c.Size, len(want))
+	}
+	for y, row := range want {
+		var got strings.Builder
+		for x := 0; x < c.Size; x++ {
+			if c.Black(x, y) {
+				got.WriteByte('#')
+			} else {
+				got.WriteByte('.')
+			}
+		}
+		if got.String() != row {
+			t.Errorf("row %2d: got %s, want %s", y, got.String(), row)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", 2954), Low); err != ErrTooLong {
+		t.Errorf("got %v, want ErrTooLong", err)
+	}
+	if c, err := Encode(strings.Repeat("x", 2953), Low); err != nil || c.Version != 40 {
+		t.Errorf("2953 bytes at level L: got %v, want version 40", err)
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// New builds the Limiter selected by the configuration.
+func New(cfg multitenant.RateLimitConfig) (Limiter, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("ratelimit: REDIS_ADDR is required for the redis backend")
+		}
+		client := &redis.Client{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB}
+		return &Redis{Client: client, Prefix: "tenkit:rl:"}, nil
+	default:
+		return nil, fmt.Errorf("ratelimit: unknown backend %q", cfg.Backend)
+	}
+}
+
+// Scopes select what a rule counts requests against.
+const (
+	ScopeIP     = "ip"     // Client IP (default)
+	ScopeUser   = "user"   // Logged-in user, falling back to the client IP
+	ScopeTenant = "tenant" // Tenant of the request, falling back to the client IP
+)
+
+// Rule limits requests to a route. Route is "METHOD /path", "/path" or "*" for every request;
+// paths ending in "/" match the whole subtree, like http.ServeMux patterns.
+type Rule struct {
+	Route string
+	Scope string
+	Limit Limit
+}
+
+// Matches reports whether the rule applies to the request method and path.
+func (r Rule) Matches(method, path string) bool {
+	if r.Route == "*" {
+		return true
+	}
+	pattern := r.Route
+	if m, p, ok := strings.Cut(r.Route, " "); ok {
+		if m != method {
+			return false
+		}
+		pattern = p
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+// Scales reports whether the rate limit factor of tenants applies to the rule: it raises the
+// throughput of tenant and user rules, while the per-IP rules guarding logins and signups against
+// abuse stay the same for every tenant.
+func (r Rule) Scales() bool {
+	return r.Scope == ScopeTenant || r.Scope == ScopeUser
+}
+
+// Key identifies the bucket of this rule for a subject (IP, user or tenant).
+// Rules on the same route with different limits keep separate buckets.
+func (r Rule) Key(subject string) string {
+	return r.Route + "|" + r.Limit.String() + "|" + subject
+}
+
+// ParseRules reads comma-separated "route=limit[@scope]" entries, e.g.
+// "POST /login=10/1m,POST /login=20/1h@user,*=1200/1m@tenant".
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: invalid rule %q", entry)
+		}
+		limit, scope, _ := strings.Cut(rest, "@")
+		if scope == "" {
+			scope = ScopeIP
+		}
+		if scope != ScopeIP && scope != ScopeUser && scope != ScopeTenant {
+			return nil, fmt.Errorf("ratelimit: unknown scope %q in %q", scope, entry)
+		}
+		l, err := ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, Rule{Route: strings.TrimSpace(route), Scope: scope, Limit: l})
+	}
+	return rules, nil
+}
+
+// RuleSet holds rules that can be replaced while requests are served, e.g. when RATE_LIMITS is
+// reloaded.
+type RuleSet struct {
+	rules atomic.Pointer[[]Rule]
+}
+
+// NewRuleSet returns a set holding rules.
+func NewRuleSet(rules []Rule) *RuleSet {
+	s := &RuleSet{}
+	s.Store(rules)
+	return s
+}
+
+// Load returns the current rules.
+func (s *RuleSet) Load() []Rule {
+	return *s.rules.Load()
+}
+
+// Store replaces the rules.
+func (s *RuleSet) Store(rules []Rule) {
+	s.rules.Store(&rules)
+}
@@ -0,0 +1,111 @@
+// Package ratelimit provides token bucket rate limiting with in-memory and Redis backends.
+// RATE_LIMITS lists the rules enforced by middleware.RateLimit, counted per client IP, user or
+// tenant:
+//
+//	RATE_LIMITS=POST /login=10/1m,POST /login=20/1h@user,*=1200/1m@tenant
+//
+// User and tenant rules are scaled by the rate limit factor of the tenant; per-IP rules, such as
+// those guarding /login, are the same for every tenant. RATE_LIMIT_BACKEND=redis shares the
+// buckets between instances.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Rate requests every Per, with bursts of up to Burst requests.
+type Limit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int // Bucket capacity; Rate when zero
+}
+
+// PerMinute returns a limit of n requests per minute.
+func PerMinute(n int) Limit {
+	return Limit{Rate: n, Per: time.Minute}
+}
+
+// Scale multiplies the rate and burst, e.g. to grant a tenant higher limits.
+// Factors of zero or less leave the limit unchanged.
+func (l Limit) Scale(factor float64) Limit {
+	if factor <= 0 || factor == 1 {
+		return l
+	}
+	l.Rate = max(1, int(float64(l.Rate)*factor))
+	if l.Burst > 0 {
+		l.Burst = max(1, int(float64(l.Burst)*factor))
+	}
+	return l
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// tokensPerSecond is the refill speed of the bucket.
+func (l Limit) tokensPerSecond() float64 {
+	return float64(l.Rate) / l.Per.Seconds()
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Rate, l.Per)
+}
+
+// ParseLimit reads "10/1m" (10 per minute) or "100/1h:20" (burst of 20).
+func ParseLimit(s string) (Limit, error) {
+	spec, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	rate, per, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("ratelimit: invalid limit %q, want rate/duration", s)
+	}
+	var l Limit
+	var err error
+	if l.Rate, err = strconv.Atoi(rate); err != nil || l.Rate <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid rate in %q", s)
+	}
+	if l.Per, err = time.ParseDuration(per); err != nil || l.Per <= 0 {
+		return Limit{}, fmt.Errorf("ratelimit: invalid duration in %q", s)
+	}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, fmt.Errorf("ratelimit: invalid burst in %q", s)
+		}
+	}
+	return l, nil
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Tokens left after this request
+	RetryAfter time.Duration // Wait before the next token when denied
+	Reset      time.Duration // Time until the bucket is full again
+}
+
+// Limiter consumes one token from the bucket identified by key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result computes the Result for a bucket holding tokens after the request.
+func result(allowed bool, tokens float64, l Limit) Result {
+	rate := l.tokensPerSecond()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.burst(),
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(l.burst()) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return res
+}
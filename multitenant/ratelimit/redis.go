@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// tokenBucketScript refills and consumes the bucket atomically.
+// KEYS[1] bucket, ARGV: tokens per ms, burst, now in ms. Returns {allowed, tokens}.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(b[1]) or burst
+local ts = tonumber(b[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate))
+return {allowed, tostring(tokens)}
+`
+
+// Redis is a Limiter shared by every instance of the application.
+type Redis struct {
+	Client *redis.Client
+	Prefix string // Key prefix, e.g. "tenkit:rl:"
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, l Limit) (Result, error) {
+	now := time.Now().UnixMilli()
+	perMs := l.tokensPerSecond() / 1000
+	reply, err := r.Client.Do(ctx, "EVAL", tokenBucketScript, "1", r.Prefix+key,
+		strconv.FormatFloat(perMs, 'g', -1, 64), strconv.Itoa(l.burst()), strconv.FormatInt(now, 10))
+	if err != nil {
+		return Result{}, err
+	}
+	arr, ok := reply.([]any)
+	if !ok || len(arr) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected script reply %v", reply)
+	}
+	allowed, _ := arr[0].(int64)
+	s, _ := arr[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected token count %q", s)
+	}
+	return result(allowed == 1, tokens, l), nil
+}
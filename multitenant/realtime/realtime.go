@@ -0,0 +1,308 @@
+// Package realtime pushes live updates to the browsers of a tenant over Server-Sent Events, served at
+// /events. A Hub keeps the open streams of each tenant and a short backlog of recent messages, so that
+// a client reconnecting with Last-Event-ID receives what it missed:
+//
+//	realtime.Send(ctx, tenantID, userID, "invoice.paid", map[string]any{"id": inv.ID})
+//	realtime.Broadcast(ctx, tenantID, "board.updated", board, cfg.Roles.AtLeast(cfg.Roles.Admin)...)
+//
+//	// In the browser
+//	const es = new EventSource("/events");
+//	es.addEventListener("invoice.paid", e => refresh(JSON.parse(e.data)));
+//
+// The hub is in memory by default; with REALTIME_BACKEND=redis messages go through a Redis stream and
+// reach the clients connected to every instance.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// Events sent by tenkit itself.
+const (
+	EventNotification = "notification" // A notification was sent to the user, see the notify package
+	EventMember       = "member"       // A member joined, was added, changed role, deactivated or removed
+	EventResync       = "resync"       // Messages were missed: the client should reload its data
+)
+
+// subscriptionBuffer is the number of messages a stream may lag behind before it is closed.
+const subscriptionBuffer = 32
+
+// Message is an update for the members of a tenant.
+type Message struct {
+	ID       string          `json:"-"` // Set by the hub, sent as the SSE id
+	TenantID int64           `json:"tenant_id"`
+	UserID   int64           `json:"user_id,omitempty"` // Recipient, every member of the tenant when 0
+	Roles    []string        `json:"roles,omitempty"`   // Roles allowed to receive it, every role when empty
+	Event    string          `json:"event"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// For reports whether a member of the tenant of m receives it.
+func (m Message) For(userID int64, role string) bool {
+	return (m.UserID == 0 || m.UserID == userID) && (len(m.Roles) == 0 || slices.Contains(m.Roles, role))
+}
+
+// Relay carries messages between the instances of the application.
+type Relay interface {
+	// Publish sends a message to every instance, including this one.
+	Publish(ctx context.Context, m Message) error
+	// Run passes the messages published by any instance to deliver, with their ID set, until ctx is done.
+	Run(ctx context.Context, deliver func(Message)) error
+}
+
+// Hub dispatches the messages of each tenant to its open streams.
+type Hub struct {
+	Backlog int   // Messages kept per tenant for reconnecting clients
+	Relay   Relay // nil to deliver within this instance only
+
+	mu      sync.Mutex
+	prefix  string // Of local IDs, so that IDs issued before a restart are never matched
+	seq     int64
+	tenants map[int64]*tenantHub
+}
+
+type tenantHub struct {
+	subs    map[*Subscription]struct{}
+	backlog []Message
+}
+
+// NewHub returns a hub keeping backlog messages per tenant.
+func NewHub(backlog int, relay Relay) *Hub {
+	return &Hub{
+		Backlog: backlog,
+		Relay:   relay,
+		prefix:  strconv.FormatInt(time.Now().UnixNano(), 36) + "-",
+		tenants: map[int64]*tenantHub{},
+	}
+}
+
+// New returns the hub of cfg.Backend: "memory" (default), "redis" or "none" for no hub.
+func New(cfg multitenant.RealtimeConfig) (*Hub, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewHub(cfg.Backlog, nil), nil
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return nil, fmt.Errorf("realtime: REDIS_ADDR is required for the redis backend")
+		}
+		client := &redis.Client{Addr: cfg.RedisAddr, Password: cfg.RedisPassword, DB: cfg.RedisDB}
+		return NewHub(cfg.Backlog, &RedisRelay{Client: client, Stream: "tenkit:realtime"}), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("realtime: unknown backend %q", cfg.Backend)
+	}
+}
+
+// Publish sends m to the streams of its tenant, through the relay when there is one.
+func (h *Hub) Publish(ctx context.Context, m Message) error {
+	if h.Relay != nil {
+		return h.Relay.Publish(ctx, m)
+	}
+	h.deliver(m)
+	return nil
+}
+
+// Run delivers the messages of the relay until ctx is done, retrying after failures. It returns at
+// once without a relay.
+func (h *Hub) Run(ctx context.Context) {
+	if h.Relay == nil {
+		return
+	}
+	for ctx.Err() == nil {
+		err := h.Relay.Run(ctx, h.deliver)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		slog.ErrorContext(ctx, "[REALTIME] Relay failed, retrying", "err", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// deliver records m in the backlog of its tenant and passes it to the matching streams. Streams
+// whose buffer is full are closed: their client reconnects and catches up from the backlog.
+func (h *Hub) deliver(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if m.ID == "" {
+		h.seq++
+		m.ID = h.prefix + strconv.FormatInt(h.seq, 10)
+	}
+	th := h.tenant(m.TenantID)
+	th.backlog = append(th.backlog, m)
+	if n := len(th.backlog) - max(h.Backlog, 0); n > 0 {
+		th.backlog = slices.Delete(th.backlog, 0, n)
+	}
+	for s := range th.subs {
+		if !m.For(s.userID, s.role) {
+			continue
+		}
+		select {
+		case s.c <- m:
+		default:
+			slog.Warn("[REALTIME] Slow stream closed", "tenant_id", m.TenantID, "user_id", s.userID)
+			h.remove(th, s)
+		}
+	}
+}
+
+func (h *Hub) tenant(id int64) *tenantHub {
+	th := h.tenants[id]
+	if th == nil {
+		th = &tenantHub{subs: map[*Subscription]struct{}{}}
+		h.tenants[id] = th
+	}
+	return th
+}
+
+func (h *Hub) remove(th *tenantHub, s *Subscription) {
+	if _, ok := th.subs[s]; ok {
+		delete(th.subs, s)
+		close(s.c)
+	}
+}
+
+// Subscription is an open stream of a member. C is closed when the hub drops the stream.
+type Subscription struct {
+	C <-chan Message
+
+	c        chan Message
+	hub      *Hub
+	tenantID int64
+	userID   int64
+	role     string
+}
+
+// Subscribe opens a stream for a member of a tenant. With lastID, the ID of the last message the
+// client received, it also returns the messages sent since. When lastID is no longer in the backlog,
+// ok is false and missed is a single EventResync message carrying the newest ID.
+func (h *Hub) Subscribe(tenantID, userID int64, role, lastID string) (s *Subscription, missed []Message, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := make(chan Message, subscriptionBuffer)
+	s = &Subscription{C: c, c: c, hub: h, tenantID: tenantID, userID: userID, role: role}
+	th := h.tenant(tenantID)
+	th.subs[s] = struct{}{}
+	if lastID == "" {
+		return s, nil, true
+	}
+	i := slices.IndexFunc(th.backlog, func(m Message) bool { return m.ID == lastID })
+	if i < 0 {
+		resync := Message{TenantID: tenantID, Event: EventResync, Data: json.RawMessage("{}")}
+		if n := len(th.backlog); n > 0 {
+			resync.ID = th.backlog[n-1].ID
+		}
+		return s, []Message{resync}, false
+	}
+	for _, m := range th.backlog[i+1:] {
+		if m.For(userID, role) {
+			missed = append(missed, m)
+		}
+	}
+	return s, missed, true
+}
+
+// Close ends the stream.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s.hub.tenant(s.tenantID), s)
+}
+
+// Streams returns the number of open streams.
+func (h *Hub) Streams() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, th := range h.tenants {
+		n += len(th.subs)
+	}
+	return n
+}
+
+type holder struct{ *Hub }
+
+var current atomic.Value // holder
+
+// SetHub installs the hub used by Publish, Send and Broadcast; nil turns live updates off.
+func SetHub(h *Hub) {
+	current.Store(holder{h})
+}
+
+// Current returns the installed hub, nil when live updates are off.
+func Current() *Hub {
+	h, _ := current.Load().(holder)
+	return h.Hub
+}
+
+// Send pushes an event to the streams of one member. data is encoded as JSON.
+func Send(ctx context.Context, tenantID, userID int64, event string, data any) error {
+	return publish(ctx, Message{TenantID: tenantID, UserID: userID, Event: event}, data)
+}
+
+// Broadcast pushes an event to the members of a tenant holding one of roles, or to every member
+// without roles. data is encoded as JSON.
+func Broadcast(ctx context.Context, tenantID int64, event string, data any, roles ...string) error {
+	return publish(ctx, Message{TenantID: tenantID, Roles: roles, Event: event}, data)
+}
+
+func publish(ctx context.Context, m Message, data any) error {
+	h := Current()
+	if h == nil || m.TenantID == 0 {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	m.Data = b
+	if err := h.Publish(ctx, m); err != nil {
+		slog.ErrorContext(ctx, "[REALTIME] Failed to publish", "event", m.Event, "tenant_id", m.TenantID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// MemberChanged tells the admins of a tenant that a member changed, for the changes that have no
+// event on the bus; action is e.g. "deactivated" or "removed".
+func MemberChanged(ctx context.Context, cfg *multitenant.Config, tenantID, userID int64, action string) {
+	_ = Broadcast(ctx, tenantID, EventMember, map[string]any{"action": action, "user_id": userID},
+		cfg.Roles.AtLeast(cfg.Roles.Admin)...)
+}
+
+// Forward returns an event bus subscriber telling the admins of a tenant about its membership
+// changes. Subscribe it with events.Subscribe(events.All, realtime.Forward(cfg)).
+func Forward(cfg *multitenant.Config) func(context.Context, events.Event) {
+	actions := map[string]string{
+		events.UserConfirmed:     "joined",
+		events.MemberCreated:     "created",
+		events.MemberInvited:     "invited",
+		events.MemberRoleChanged: "role_changed",
+	}
+	return func(ctx context.Context, e events.Event) {
+		action, ok := actions[e.Name]
+		if !ok || e.TenantID == 0 {
+			return
+		}
+		data := map[string]any{"action": action, "user_id": e.UserID}
+		if role, ok := e.Data["role"]; ok {
+			data["role"] = role
+		}
+		_ = Broadcast(ctx, e.TenantID, EventMember, data, cfg.Roles.AtLeast(cfg.Roles.Admin)...)
+	}
+}
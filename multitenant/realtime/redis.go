@@ -0,0 +1,105 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/pandamasta/tenkit/multitenant/redis"
+)
+
+// RedisRelay shares messages between instances through a Redis stream, capped to roughly MaxLen
+// entries. The stream entry IDs become the message IDs, identical on every instance, so a client
+// reconnecting to another instance still resumes where it stopped.
+type RedisRelay struct {
+	Client *redis.Client
+	Stream string // Key of the stream, e.g. "tenkit:realtime"
+	MaxLen int    // 10000 when zero
+}
+
+// blockMillis is how long XREAD waits for new entries; below the client's I/O timeout.
+const blockMillis = "4000"
+
+func (r *RedisRelay) Publish(ctx context.Context, m Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	maxLen := r.MaxLen
+	if maxLen <= 0 {
+		maxLen = 10000
+	}
+	_, err = r.Client.Do(ctx, "XADD", r.Stream, "MAXLEN", "~", strconv.Itoa(maxLen), "*", "m", string(b))
+	return err
+}
+
+func (r *RedisRelay) Run(ctx context.Context, deliver func(Message)) error {
+	// Step 1: Start after the newest entry; the backlog of each instance only covers its uptime
+	last := "0-0"
+	reply, err := r.Client.Do(ctx, "XREVRANGE", r.Stream, "+", "-", "COUNT", "1")
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		return err
+	}
+	if entries, _ := reply.([]any); len(entries) > 0 {
+		if id, _, ok := streamEntry(entries[0]); ok {
+			last = id
+		}
+	}
+
+	// Step 2: Read the new entries until ctx is done
+	for ctx.Err() == nil {
+		reply, err := r.Client.Do(ctx, "XREAD", "COUNT", "100", "BLOCK", blockMillis, "STREAMS", r.Stream, last)
+		if errors.Is(err, redis.ErrNil) {
+			continue // Nothing new within blockMillis
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		streams, _ := reply.([]any)
+		for _, s := range streams {
+			pair, _ := s.([]any)
+			if len(pair) != 2 {
+				return fmt.Errorf("realtime: unexpected XREAD reply %v", reply)
+			}
+			entries, _ := pair[1].([]any)
+			for _, e := range entries {
+				id, fields, ok := streamEntry(e)
+				if !ok {
+					return fmt.Errorf("realtime: unexpected stream entry %v", e)
+				}
+				last = id
+				var m Message
+				if err := json.Unmarshal([]byte(fields["m"]), &m); err != nil {
+					slog.WarnContext(ctx, "[REALTIME] Invalid message in stream", "id", id, "err", err)
+					continue
+				}
+				m.ID = id
+				deliver(m)
+			}
+		}
+	}
+	return nil
+}
+
+// streamEntry reads an [id, [field, value, ...]] stream entry.
+func streamEntry(v any) (id string, fields map[string]string, ok bool) {
+	e, _ := v.([]any)
+	if len(e) != 2 {
+		return "", nil, false
+	}
+	id, ok = e[0].(string)
+	kv, _ := e[1].([]any)
+	fields = map[string]string{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		k, _ := kv[i].(string)
+		v, _ := kv[i+1].(string)
+		fields[k] = v
+	}
+	return id, fields, ok
+}
@@ -0,0 +1,89 @@
+// Package redirect sends visitors to URLs taken from requests, such as the "next" parameter of
+// /login or the Referer of /lang, without opening redirects to other sites. A target is followed
+// when it is a path on the request host, an absolute URL of the request host, or a URL of a host
+// configured in REDIRECT_ALLOWED_HOSTS; anything else falls back to a fixed URL.
+//
+//	redirect.Safe(w, r, r.FormValue("next"), "/")
+package redirect
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	mu    sync.RWMutex
+	hosts []string
+)
+
+// Configure sets the hosts redirects may go to besides the request host, e.g. "docs.example.com"
+// or "*.example.com" for every subdomain of example.com.
+func Configure(allowed []string) {
+	var list []string
+	for _, h := range allowed {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			list = append(list, h)
+		}
+	}
+	mu.Lock()
+	hosts = list
+	mu.Unlock()
+}
+
+// Safe redirects to target when Allowed accepts it, and to fallback otherwise, with 303 See Other.
+// htmx requests get an HX-Redirect header instead, as they would follow a redirect in place.
+func Safe(w http.ResponseWriter, r *http.Request, target, fallback string) {
+	target = Target(r, target, fallback)
+	if r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true" {
+		w.Header().Set("HX-Redirect", target)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// Target returns target when Allowed accepts it for r, fallback otherwise.
+func Target(r *http.Request, target, fallback string) string {
+	if Allowed(r, target) {
+		return target
+	}
+	return fallback
+}
+
+// Allowed reports whether target stays on the request host or goes to a configured host. Paths
+// must be absolute and not start with "//" or "/\", which browsers read as another host.
+func Allowed(r *http.Request, target string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || allowedHost(u.Hostname())
+}
+
+// allowedHost reports whether host is one of the configured hosts.
+func allowedHost(host string) bool {
+	host = strings.ToLower(host)
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range hosts {
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
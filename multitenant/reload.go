@@ -0,0 +1,193 @@
+package multitenant
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant/logging"
+)
+
+// LogLevel is the minimum level of the application log handler, TENKIT_LOG_LEVEL; pass it to the
+// handler so that reloads change it.
+var LogLevel = new(slog.LevelVar)
+
+// reloadable lists the settings ReloadConfig applies to the running configuration, with the field
+// each one sets. Other settings need a restart.
+var reloadable = map[string]func(*Config) any{
+	"FEATURE_FLAGS":           func(c *Config) any { return &c.FeatureFlags },
+	"MAINTENANCE_MODE":        func(c *Config) any { return &c.Maintenance.Enabled },
+	"MAINTENANCE_TENANTS":     func(c *Config) any { return &c.Maintenance.Tenants },
+	"MAINTENANCE_MESSAGE":     func(c *Config) any { return &c.Maintenance.Message },
+	"MAINTENANCE_RETRY_AFTER": func(c *Config) any { return &c.Maintenance.RetryAfter },
+	"RATE_LIMITS":             func(c *Config) any { return &c.RateLimit.Rules },
+	"TENKIT_LOCALES":          func(c *Config) any { return &c.I18n.LocalesPath },
+	"TENKIT_LOG_LEVEL":        func(c *Config) any { return &c.Log.Level },
+	"TENKIT_LOG_LEVELS":       func(c *Config) any { return &c.Log.Levels },
+}
+
+// ReloadableSetting makes key, an environment variable name, reloadable at runtime. field returns
+// the pointer to the Config field it sets, e.g. func(c *Config) any { return &c.Brand.Name }.
+func ReloadableSetting(key string, field func(*Config) any) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadable[key] = field
+}
+
+// ConfigChange describes a reload that changed settings.
+type ConfigChange struct {
+	Config  *Config  // The running configuration, with the new values
+	Changed []string // Reloadable settings that changed, by environment variable name
+}
+
+// Has reports whether setting changed.
+func (c ConfigChange) Has(setting string) bool {
+	return slices.Contains(c.Changed, setting)
+}
+
+var (
+	reloadMu    sync.Mutex // Serializes reloads, and guards reloadable and the hooks
+	reloadHooks []func(ctx context.Context, change ConfigChange)
+)
+
+// OnConfigChange registers fn to run after a reload changed settings, so that subsystems pick up
+// their new values, e.g. rebuilding rate limit rules.
+func OnConfigChange(fn func(ctx context.Context, change ConfigChange)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// ReloadConfig reads the environment, .env and the configuration file again and applies the
+// reloadable settings to cfg, then runs the OnConfigChange hooks. Changes to other settings are
+// logged and wait for a restart. An invalid configuration is refused and cfg is left as it is.
+func ReloadConfig(ctx context.Context, cfg *Config) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	// Step 1: Read the settings again
+	before := settingValues()
+	fresh := LoadDefaultConfig()
+	if err := fresh.Validate(); err != nil {
+		return fmt.Errorf("config reload: %w", err)
+	}
+	after := settingValues()
+
+	// Step 2: Apply the reloadable ones
+	var changed, restart []string
+	for key, v := range after {
+		if before[key] == v {
+			continue
+		}
+		field, ok := reloadable[key]
+		if !ok {
+			restart = append(restart, key)
+			continue
+		}
+		dst, src := reflect.ValueOf(field(cfg)).Elem(), reflect.ValueOf(field(fresh)).Elem()
+		if !reflect.DeepEqual(dst.Interface(), src.Interface()) {
+			dst.Set(src)
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(restart)
+	if len(restart) > 0 {
+		slog.WarnContext(ctx, "[CONFIG] Changed settings need a restart", "settings", restart)
+	}
+	if len(changed) == 0 {
+		slog.InfoContext(ctx, "[CONFIG] Configuration reloaded, nothing to apply")
+		return nil
+	}
+	slog.InfoContext(ctx, "[CONFIG] Configuration reloaded", "changed", changed)
+
+	// Step 3: Let subsystems react
+	change := ConfigChange{Config: cfg, Changed: changed}
+	if change.Has("TENKIT_LOG_LEVEL") {
+		LogLevel.UnmarshalText([]byte(cfg.Log.Level))
+	}
+	if change.Has("TENKIT_LOG_LEVELS") {
+		logging.SetLevels(cfg.Log.Levels)
+	}
+	for _, fn := range reloadHooks {
+		fn(ctx, change)
+	}
+	return nil
+}
+
+// settingValues returns the current value of every setting read so far.
+func settingValues() map[string]string {
+	fileMu.RLock()
+	keys := make([]string, 0, len(knownKeys))
+	for key := range knownKeys {
+		keys = append(keys, key)
+	}
+	fileMu.RUnlock()
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		values[key] = lookupSetting(key)
+	}
+	return values
+}
+
+// WatchConfig reloads cfg on SIGHUP and, with an interval, when .env or the configuration file
+// changes, until ctx is done. Failed reloads are logged and keep the running configuration.
+func WatchConfig(ctx context.Context, cfg *Config, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last := configFilesState()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.InfoContext(ctx, "[CONFIG] SIGHUP received, reloading configuration")
+		case <-tick:
+			state := configFilesState()
+			if state == last {
+				continue
+			}
+			last = state
+			slog.InfoContext(ctx, "[CONFIG] Configuration files changed, reloading")
+		}
+		if err := ReloadConfig(ctx, cfg); err != nil {
+			slog.ErrorContext(ctx, "[CONFIG] Reload failed, keeping the running configuration", "err", err)
+		}
+		last = configFilesState()
+	}
+}
+
+// configFilesState sums up the modification times and sizes of .env and the configuration file.
+func configFilesState() string {
+	fileMu.RLock()
+	files := []string{".env", fileName}
+	fileMu.RUnlock()
+	if path := os.Getenv("TENKIT_CONFIG"); path != "" {
+		files = append(files, path)
+	} else {
+		files = append(files, DefaultConfigFiles...)
+	}
+	var state string
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			state += fmt.Sprintf("%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return state
+}
@@ -0,0 +1,134 @@
+package multitenant
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// ReputationVerdict is the outcome of an IP reputation check.
+type ReputationVerdict int
+
+const (
+	ReputationAllow     ReputationVerdict = iota // Let the request through
+	ReputationChallenge                          // Let it through but require extra proof from the user
+	ReputationBlock                              // Reject the request
+)
+
+func (v ReputationVerdict) String() string {
+	switch v {
+	case ReputationChallenge:
+		return "challenge"
+	case ReputationBlock:
+		return "block"
+	default:
+		return "allow"
+	}
+}
+
+// IPReputation decides how to treat requests from a given IP.
+type IPReputation interface {
+	Check(ctx context.Context, ip net.IP) (ReputationVerdict, error)
+}
+
+// ListReputation is the default IPReputation backed by static IP/CIDR lists,
+// such as a Tor exit node list or an abuse feed.
+type ListReputation struct {
+	block     []*net.IPNet
+	challenge []*net.IPNet
+}
+
+// LoadListReputation builds a ListReputation from two files (one IP or CIDR per line).
+// Either path may be empty.
+func LoadListReputation(blockPath, challengePath string) (*ListReputation, error) {
+	l := &ListReputation{}
+	var err error
+	if blockPath != "" {
+		if l.block, err = readIPListFile(blockPath); err != nil {
+			return nil, err
+		}
+	}
+	if challengePath != "" {
+		if l.challenge, err = readIPListFile(challengePath); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (l *ListReputation) Check(ctx context.Context, ip net.IP) (ReputationVerdict, error) {
+	if ip == nil {
+		return ReputationAllow, nil
+	}
+	if containsIP(l.block, ip) {
+		return ReputationBlock, nil
+	}
+	if containsIP(l.challenge, ip) {
+		return ReputationChallenge, nil
+	}
+	return ReputationAllow, nil
+}
+
+func readIPListFile(path string) ([]*net.IPNet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP list: %w", err)
+	}
+	defer f.Close()
+	return ParseIPList(f)
+}
+
+// ParseIPList reads one IP or CIDR per line. Blank lines and # comments are ignored.
+func ParseIPList(r io.Reader) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.Index(line, "#"); i != -1 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		n, err := parseIPOrCIDR(line)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, sc.Err()
+}
+
+// parseIPOrCIDR accepts "10.0.0.0/8" as well as a bare "10.1.2.3".
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP %q", s)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
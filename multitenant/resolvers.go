@@ -0,0 +1,103 @@
+package multitenant
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathRewriter is implemented by resolvers that identify the tenant from part of the URL path.
+// TenantMiddleware calls Rewrite once the tenant is loaded so routes see the path without it.
+type PathRewriter interface {
+	Rewrite(r *http.Request, identifier string) *http.Request
+}
+
+// ChainResolver tries each resolver in order and returns the first tenant identifier found,
+// e.g. custom domain or subdomain, then a proxy header, then a path prefix. A resolver returning
+// "" or an error passes to the next one. The chain returns "" (root site) when at least one
+// resolver accepted the request without finding a tenant, and the last error otherwise.
+type ChainResolver []TenantResolver
+
+func (c ChainResolver) Resolve(r *http.Request) (string, error) {
+	var lastErr error
+	root := false
+	for _, res := range c {
+		id, err := res.Resolve(r)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if id != "" {
+			return id, nil
+		}
+		root = true
+	}
+	if root || lastErr == nil {
+		return "", nil
+	}
+	return "", lastErr
+}
+
+// Rewrite applies the rewriting of every resolver of the chain that supports it.
+func (c ChainResolver) Rewrite(r *http.Request, identifier string) *http.Request {
+	for _, res := range c {
+		if rw, ok := res.(PathRewriter); ok {
+			r = rw.Rewrite(r, identifier)
+		}
+	}
+	return r
+}
+
+// HeaderResolver reads the tenant identifier from a request header set by a reverse proxy,
+// e.g. "X-Tenant". Anyone can send that header, so Trusted must only accept requests coming
+// from the proxy (see middleware.TrustedProxy); a nil Trusted ignores the header entirely.
+type HeaderResolver struct {
+	Header  string
+	Trusted func(*http.Request) bool
+}
+
+func (h HeaderResolver) Resolve(r *http.Request) (string, error) {
+	if h.Trusted == nil || !h.Trusted(r) {
+		return "", nil
+	}
+	return strings.ToLower(strings.TrimSpace(r.Header.Get(h.Header))), nil
+}
+
+// PathPrefixResolver identifies the tenant from the first path segment after Prefix, e.g.
+// "/t/acme/login" for Prefix "/t/", for deployments serving every tenant on a single host.
+// The prefix and identifier are stripped from the path before routing.
+type PathPrefixResolver struct {
+	Prefix string
+}
+
+func (p PathPrefixResolver) Resolve(r *http.Request) (string, error) {
+	rest, ok := strings.CutPrefix(r.URL.Path, p.Prefix)
+	if !ok {
+		return "", nil
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	if id == "" {
+		return "", errors.New("missing tenant in path")
+	}
+	return strings.ToLower(id), nil
+}
+
+func (p PathPrefixResolver) Rewrite(r *http.Request, identifier string) *http.Request {
+	base := p.Prefix + identifier
+	path, ok := strings.CutPrefix(r.URL.Path, base)
+	if !ok || (path != "" && !strings.HasPrefix(path, "/")) {
+		// The tenant came from another resolver, or the case differs: leave the path alone
+		return r
+	}
+	if path == "" {
+		path = "/"
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	return r2
+}
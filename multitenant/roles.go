@@ -0,0 +1,104 @@
+package multitenant
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoles is the role set used when TENKIT_ROLES is not set.
+const DefaultRoles = "owner:100,admin:50,member:10"
+
+// ErrUnknownRole is returned by Validate when a configured role is missing from the registry.
+var ErrUnknownRole = errors.New("role is not declared in TENKIT_ROLES")
+
+// Role is a membership role. Higher ranks include the permissions of lower ones.
+type Role struct {
+	Name     string // Value stored in users.role and memberships.role
+	LabelKey string // i18n key of the display name, e.g. "role.owner"
+	Rank     int
+}
+
+// RolesConfig is the registry of membership roles.
+type RolesConfig struct {
+	Roles   []Role // Ordered from highest to lowest rank
+	Default string // Role given to users joining an existing tenant
+	Admin   string // Lowest role allowed to manage tenant settings
+	Owner   string // Role given to the user who creates a tenant
+}
+
+// Get returns the role with the given name.
+func (c RolesConfig) Get(name string) (Role, bool) {
+	for _, r := range c.Roles {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Role{}, false
+}
+
+// Rank returns the rank of a role, or -1 when the role is unknown.
+func (c RolesConfig) Rank(name string) int {
+	if r, ok := c.Get(name); ok {
+		return r.Rank
+	}
+	return -1
+}
+
+// Allows reports whether role ranks at or above min. Unknown roles are never allowed.
+func (c RolesConfig) Allows(role, min string) bool {
+	rank, need := c.Rank(role), c.Rank(min)
+	return rank >= 0 && need >= 0 && rank >= need
+}
+
+// AtLeast returns the names of the roles ranking at or above min, e.g. for NavItem.Roles.
+func (c RolesConfig) AtLeast(min string) []string {
+	var out []string
+	for _, r := range c.Roles {
+		if c.Allows(r.Name, min) {
+			out = append(out, r.Name)
+		}
+	}
+	return out
+}
+
+// Label returns the i18n key of a role's display name, falling back to the raw name.
+func (c RolesConfig) Label(name string) string {
+	if r, ok := c.Get(name); ok {
+		return r.LabelKey
+	}
+	return name
+}
+
+// Validate checks that the default, admin and owner roles are declared.
+func (c RolesConfig) Validate() error {
+	for _, name := range []string{c.Default, c.Admin, c.Owner} {
+		if _, ok := c.Get(name); !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownRole, name)
+		}
+	}
+	return nil
+}
+
+// parseRoles reads "name:rank" entries into a registry sorted by decreasing rank.
+// A missing rank keeps the declaration order.
+func parseRoles(s string) []Role {
+	var roles []Role
+	for i, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, rankStr, _ := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		rank, err := strconv.Atoi(strings.TrimSpace(rankStr))
+		if err != nil {
+			rank = 1000 - i
+		}
+		roles = append(roles, Role{Name: name, LabelKey: "role." + name, Rank: rank})
+	}
+	sort.SliceStable(roles, func(i, j int) bool { return roles[i].Rank > roles[j].Rank })
+	return roles
+}
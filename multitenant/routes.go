@@ -0,0 +1,51 @@
+package multitenant
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Flows that can be left out of the routes registered by handlers.App.
+const (
+	FlowEnroll        = "enroll"         // Open tenant creation at /enroll and /verify
+	FlowRegister      = "register"       // Self-registration into a tenant at /register and /confirm
+	FlowPasswordReset = "password_reset" // /forgot and /reset
+	FlowExport        = "export"         // Personal data export at /account/export
+	FlowCalendar      = "calendar"       // Calendar feeds and the subscription page
+	FlowGroups        = "groups"         // Groups at /groups
+	FlowReports       = "reports"        // Background reports and their jobs
+	FlowAPIKeys       = "api_keys"       // API key management at /settings/api-keys
+	FlowWebhooks      = "webhooks"       // Webhook endpoints at /settings/webhooks
+	FlowAPI           = "api"            // JSON API of the auth flows under /api/v1/
+	FlowSearch        = "search"         // Search page at /search
+	FlowNotifications = "notifications"  // Notification menu and /notifications
+	FlowRealtime      = "realtime"       // Live updates streamed at /events
+	FlowSubTenants    = "sub_tenants"    // Sub-tenants created by tenant admins at /settings/sub-tenants
+)
+
+// Flows lists every flow that RoutesConfig can disable.
+var Flows = []string{
+	FlowEnroll, FlowRegister, FlowPasswordReset,
+	FlowExport, FlowCalendar, FlowGroups, FlowReports, FlowAPIKeys, FlowWebhooks, FlowAPI, FlowSearch,
+	FlowNotifications, FlowRealtime, FlowSubTenants,
+}
+
+// RoutesConfig selects the flows whose routes are registered. Every flow is enabled by default.
+type RoutesConfig struct {
+	Disabled []string // Flows left out, e.g. "enroll" for an invite-only platform
+}
+
+// Enabled reports whether the routes of flow are registered.
+func (c RoutesConfig) Enabled(flow string) bool {
+	return !slices.Contains(c.Disabled, flow)
+}
+
+// Validate rejects unknown flow names, which usually are typos that would leave a flow open.
+func (c RoutesConfig) Validate() error {
+	for _, f := range c.Disabled {
+		if !slices.Contains(Flows, f) {
+			return fmt.Errorf("ROUTES_DISABLED: unknown flow %q", f)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Meilisearch indexes the documents of every tenant in one Meilisearch index, filtered by tenant
+// on every search. Writes are asynchronous tasks on the Meilisearch side, so a change shows up in
+// results shortly after Index returns.
+type Meilisearch struct {
+	URL      string // e.g. "http://localhost:7700"
+	APIKey   string // Key allowed to write documents and settings, empty without authentication
+	IndexUID string // "tenkit" by default
+	Client   *http.Client
+
+	mu         sync.Mutex
+	configured bool
+}
+
+// meiliDoc is a document as stored in Meilisearch.
+type meiliDoc struct {
+	Key      string `json:"key"` // Primary key, derived from the tenant, type and ID
+	TenantID int64  `json:"tenant_id"`
+	Type     string `json:"type"`
+	ID       string `json:"doc_id"`
+	MinRole  string `json:"min_role"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+}
+
+// NewMeilisearch returns a backend for the server at rawURL.
+func NewMeilisearch(rawURL, apiKey, index string) *Meilisearch {
+	if index == "" {
+		index = "tenkit"
+	}
+	return &Meilisearch{
+		URL:      strings.TrimSuffix(rawURL, "/"),
+		APIKey:   apiKey,
+		IndexUID: index,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// meiliKey returns the primary key of a document; Meilisearch only accepts [A-Za-z0-9_-].
+func meiliKey(tenantID int64, typ, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(tenantID, 10) + "\x00" + typ + "\x00" + id))
+}
+
+// do sends a request to the Meilisearch API and decodes the answer into out when not nil.
+func (m *Meilisearch) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.URL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	}
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("meilisearch: %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// configure declares the filterable attributes of the index until it succeeds once; Meilisearch
+// creates the index itself.
+func (m *Meilisearch) configure(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.configured {
+		return nil
+	}
+	err := m.do(ctx, http.MethodPatch, "/indexes/"+url.PathEscape(m.IndexUID)+"/settings", map[string]any{
+		"filterableAttributes": []string{"tenant_id", "type", "min_role"},
+		"searchableAttributes": []string{"title", "body"},
+	}, nil)
+	m.configured = err == nil
+	return err
+}
+
+// Index adds or replaces the documents.
+func (m *Meilisearch) Index(ctx context.Context, docs ...Document) error {
+	if err := m.configure(ctx); err != nil {
+		return err
+	}
+	out := make([]meiliDoc, len(docs))
+	for i, d := range docs {
+		out[i] = meiliDoc{
+			Key: meiliKey(d.TenantID, d.Type, d.ID), TenantID: d.TenantID, Type: d.Type, ID: d.ID,
+			MinRole: d.MinRole, URL: d.URL, Title: d.Title, Body: d.Body,
+		}
+	}
+	return m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.IndexUID)+"/documents?primaryKey=key", out, nil)
+}
+
+// Delete removes a document.
+func (m *Meilisearch) Delete(ctx context.Context, tenantID int64, typ, id string) error {
+	return m.do(ctx, http.MethodDelete, "/indexes/"+url.PathEscape(m.IndexUID)+"/documents/"+meiliKey(tenantID, typ, id), nil, nil)
+}
+
+// DeleteTenant removes every document of a tenant.
+func (m *Meilisearch) DeleteTenant(ctx context.Context, tenantID int64) error {
+	if err := m.configure(ctx); err != nil {
+		return err
+	}
+	return m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.IndexUID)+"/documents/delete", map[string]any{
+		"filter": "tenant_id = " + strconv.FormatInt(tenantID, 10),
+	}, nil)
+}
+
+// Search runs q with the typo tolerance and ranking rules of the index.
+func (m *Meilisearch) Search(ctx context.Context, q Query) ([]Result, error) {
+	if err := m.configure(ctx); err != nil {
+		return nil, err
+	}
+	filter := []any{"tenant_id = " + strconv.FormatInt(q.TenantID, 10)}
+	if len(q.Types) > 0 {
+		types := make([]any, len(q.Types))
+		for i, t := range q.Types {
+			types[i] = "type = " + strconv.Quote(t)
+		}
+		filter = append(filter, types)
+	}
+	roles := []any{`min_role = ""`}
+	for _, r := range q.Roles {
+		roles = append(roles, "min_role = "+strconv.Quote(r))
+	}
+	filter = append(filter, roles)
+
+	var resp struct {
+		Hits []struct {
+			meiliDoc
+			Score     float64 `json:"_rankingScore"`
+			Formatted struct {
+				Body string `json:"body"`
+			} `json:"_formatted"`
+		} `json:"hits"`
+	}
+	err := m.do(ctx, http.MethodPost, "/indexes/"+url.PathEscape(m.IndexUID)+"/search", map[string]any{
+		"q":                     strings.Join(q.Terms(), " "),
+		"filter":                filter,
+		"limit":                 max(q.Limit, 1),
+		"offset":                q.Offset,
+		"attributesToCrop":      []string{"body"},
+		"cropLength":            24,
+		"attributesToHighlight": []string{"body"},
+		"highlightPreTag":       HighlightStart,
+		"highlightPostTag":      HighlightEnd,
+		"showRankingScore":      true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Result, 0, len(resp.Hits))
+	for _, h := range resp.Hits {
+		out = append(out, Result{
+			Document: Document{TenantID: h.TenantID, Type: h.Type, ID: h.ID, MinRole: h.MinRole, URL: h.URL, Title: h.Title, Body: h.Body},
+			Score:    h.Score,
+			Snippet:  h.Formatted.Body,
+		})
+	}
+	return out, nil
+}
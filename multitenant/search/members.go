@@ -0,0 +1,86 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/events"
+)
+
+// TypeMember is the type of the documents of MemberSource.
+const TypeMember = "member"
+
+// MemberSource indexes the members of a tenant by name and email. They are found by tenant admins
+// only and link to the member admin console.
+func MemberSource(cfg *multitenant.Config) Source {
+	doc := func(m models.TenantMember) Document {
+		title := m.Name
+		if title == "" {
+			title = m.Email
+		}
+		return Document{
+			ID:      strconv.FormatInt(m.UserID, 10),
+			Title:   title,
+			Body:    strings.Join(strings.Fields(m.Email+" "+m.Name+" "+m.Role), " "),
+			URL:     "/admin/members?" + url.Values{"q": {m.Email}}.Encode(),
+			MinRole: cfg.Roles.Admin,
+		}
+	}
+	return Source{
+		Type:     TypeMember,
+		LabelKey: "search.type.member",
+		List: func(ctx context.Context, tenantID int64) ([]Document, error) {
+			members, err := models.ListTenantMembers(ctx, tenantID)
+			if err != nil {
+				return nil, err
+			}
+			docs := make([]Document, len(members))
+			for i, m := range members {
+				docs[i] = doc(m)
+			}
+			return docs, nil
+		},
+		Get: func(ctx context.Context, tenantID int64, id string) (*Document, error) {
+			userID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return nil, nil
+			}
+			m, err := models.GetTenantMember(ctx, tenantID, userID)
+			if m == nil || err != nil {
+				return nil, err
+			}
+			d := doc(*m)
+			return &d, nil
+		},
+	}
+}
+
+// TouchMember indexes the current state of a member, see Touch.
+func TouchMember(ctx context.Context, tenantID, userID int64) {
+	Touch(ctx, tenantID, TypeMember, strconv.FormatInt(userID, 10))
+}
+
+// Forward keeps the index in step with the event bus: new tenants are indexed, new members added
+// and purged tenants dropped. Subscribe it with events.Subscribe(events.All, search.Forward).
+func Forward(ctx context.Context, e events.Event) {
+	if Current() == nil || e.TenantID == 0 {
+		return
+	}
+	switch e.Name {
+	case events.TenantCreated:
+		if _, err := Reindex(ctx, e.TenantID); err != nil {
+			slog.ErrorContext(ctx, "[SEARCH] Failed to index new tenant", "tenant_id", e.TenantID, "err", err)
+		}
+	case events.UserConfirmed, events.MemberCreated:
+		TouchMember(ctx, e.TenantID, e.UserID)
+	case events.TenantPurged:
+		if err := Current().DeleteTenant(ctx, e.TenantID); err != nil {
+			slog.ErrorContext(ctx, "[SEARCH] Failed to drop purged tenant", "tenant_id", e.TenantID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// Postgres searches a Postgres database with a tsvector column, ranked by ts_rank with titles
+// weighted above bodies. DB is opened by the application with its Postgres driver, e.g. pgx's
+// stdlib; create the backend with NewPostgres and install it with tenkit.WithSearch.
+type Postgres struct {
+	DB     *sql.DB
+	Config string // Text search configuration, "simple" by default; "english" stems words
+}
+
+// NewPostgres creates the search_documents table of d and its index.
+func NewPostgres(ctx context.Context, d *sql.DB) (*Postgres, error) {
+	p := &Postgres{DB: d, Config: "simple"}
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS search_documents (
+			tenant_id BIGINT NOT NULL,
+			type TEXT NOT NULL,
+			doc_id TEXT NOT NULL,
+			min_role TEXT NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			tsv TSVECTOR NOT NULL,
+			PRIMARY KEY (tenant_id, type, doc_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS search_documents_tsv ON search_documents USING GIN (tsv)`,
+	} {
+		if _, err := d.ExecContext(ctx, stmt); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Index upserts the documents in one transaction.
+func (p *Postgres) Index(ctx context.Context, docs ...Document) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, d := range docs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO search_documents (tenant_id, type, doc_id, min_role, url, title, body, tsv)
+			VALUES ($1, $2, $3, $4, $5, $6, $7,
+				setweight(to_tsvector($8::regconfig, $6), 'A') || setweight(to_tsvector($8::regconfig, $7), 'B'))
+			ON CONFLICT (tenant_id, type, doc_id) DO UPDATE SET
+				min_role = EXCLUDED.min_role, url = EXCLUDED.url, title = EXCLUDED.title,
+				body = EXCLUDED.body, tsv = EXCLUDED.tsv`,
+			d.TenantID, d.Type, d.ID, d.MinRole, d.URL, d.Title, d.Body, p.Config)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes a document.
+func (p *Postgres) Delete(ctx context.Context, tenantID int64, typ, id string) error {
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM search_documents WHERE tenant_id = $1 AND type = $2 AND doc_id = $3`, tenantID, typ, id)
+	return err
+}
+
+// DeleteTenant removes every document of a tenant.
+func (p *Postgres) DeleteTenant(ctx context.Context, tenantID int64) error {
+	_, err := p.DB.ExecContext(ctx, `DELETE FROM search_documents WHERE tenant_id = $1`, tenantID)
+	return err
+}
+
+// Search matches every term as a word prefix.
+func (p *Postgres) Search(ctx context.Context, q Query) ([]Result, error) {
+	terms := q.Terms()
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	// Terms hold only letters and digits, so they are safe in to_tsquery syntax
+	tsquery := strings.Join(terms, ":* & ") + ":*"
+	args := []any{q.TenantID, p.Config, tsquery}
+	param := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"tenant_id = $1", "tsv @@ query"}
+	if len(q.Types) > 0 {
+		types := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			types[i] = param(t)
+		}
+		where = append(where, "type IN ("+strings.Join(types, ", ")+")")
+	}
+	roles := "min_role = ''"
+	for _, r := range q.Roles {
+		roles += " OR min_role = " + param(r)
+	}
+	where = append(where, "("+roles+")")
+	options := param("StartSel=" + HighlightStart + ", StopSel=" + HighlightEnd + ", MaxWords=24, MinWords=8")
+	limit, offset := param(max(q.Limit, 1)), param(q.Offset)
+
+	rows, err := p.DB.QueryContext(ctx, `
+		SELECT tenant_id, type, doc_id, min_role, url, title, body, ts_rank(tsv, query),
+			ts_headline($2::regconfig, body, query, `+options+`)
+		FROM search_documents, to_tsquery($2::regconfig, $3) query
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY 8 DESC LIMIT `+limit+` OFFSET `+offset, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Result
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.TenantID, &r.Type, &r.ID, &r.MinRole, &r.URL, &r.Title, &r.Body, &r.Score, &r.Snippet); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
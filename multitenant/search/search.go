@@ -0,0 +1,270 @@
+// Package search indexes tenant data for full-text search and runs the ranked, tenant-scoped
+// queries of the /search page. Documents come from sources: the members of a tenant are built in,
+// and applications register their own resources with Register, then call Touch when one changes.
+//
+// The Backend defaults to SQLite full-text search in the application database: FTS5 when the
+// binary is built with -tags sqlite_fts5, a plain LIKE scan otherwise. Postgres (NewPostgres) and
+// Meilisearch (NewMeilisearch, SEARCH_BACKEND=meilisearch) are the alternatives.
+//
+//	search.Register(search.Source{Type: "invoice", LabelKey: "search.type.invoice", List: ..., Get: ...})
+//	search.Touch(ctx, tenantID, "invoice", id) // After creating, changing or deleting an invoice
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// Markers wrapping the matches in Result.Snippet.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// maxTerms bounds the words of a query.
+const maxTerms = 10
+
+// Document is an indexed resource of a tenant.
+type Document struct {
+	TenantID int64
+	Type     string // Source of the document, e.g. "member"
+	ID       string // Unique within the tenant and type
+	Title    string
+	Body     string
+	URL      string // Page of the resource, relative to the tenant host
+	MinRole  string // Lowest role allowed to find the document, "" for every member
+}
+
+// Query is a search within one tenant.
+type Query struct {
+	TenantID int64
+	Text     string
+	Types    []string // Types searched, every type when empty
+	Roles    []string // Roles whose documents the searcher may find, besides those without MinRole
+	Limit    int
+	Offset   int
+}
+
+// Terms returns the words of the query, lowercased, without punctuation.
+func (q Query) Terms() []string {
+	terms := strings.FieldsFunc(strings.ToLower(q.Text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) > maxTerms {
+		terms = terms[:maxTerms]
+	}
+	return terms
+}
+
+// Result is a document matching a query.
+type Result struct {
+	Document
+	Score   float64 // Relevance, higher first; only comparable within one search
+	Snippet string  // Excerpt of the body, matches wrapped in HighlightStart and HighlightEnd
+}
+
+// SnippetHTML returns the snippet escaped for HTML, with the matches in <mark> elements.
+func (r Result) SnippetHTML() template.HTML {
+	s := template.HTMLEscapeString(r.Snippet)
+	s = strings.ReplaceAll(s, HighlightStart, "<mark>")
+	s = strings.ReplaceAll(s, HighlightEnd, "</mark>")
+	return template.HTML(s)
+}
+
+// Backend stores the documents and runs the searches.
+type Backend interface {
+	// Index adds documents, replacing those with the same tenant, type and ID.
+	Index(ctx context.Context, docs ...Document) error
+	Delete(ctx context.Context, tenantID int64, typ, id string) error
+	DeleteTenant(ctx context.Context, tenantID int64) error
+	// Search returns the matches of q, best first. Queries without terms match nothing.
+	Search(ctx context.Context, q Query) ([]Result, error)
+}
+
+// New builds the Backend selected by the configuration, nil when search is off.
+func New(ctx context.Context, cfg multitenant.SearchConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "", "sqlite":
+		return NewSQLite(ctx, db.DB)
+	case "meilisearch":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("search: SEARCH_URL is required for the meilisearch backend")
+		}
+		return NewMeilisearch(cfg.URL, cfg.APIKey, cfg.Index), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("search: unknown backend %q", cfg.Backend)
+	}
+}
+
+// ErrDisabled is returned by Search while no backend is installed.
+var ErrDisabled = errors.New("search: no backend")
+
+type holder struct{ Backend }
+
+var current atomic.Value // holder
+
+// SetBackend installs b for indexing and searching; nil turns search off.
+func SetBackend(b Backend) {
+	current.Store(holder{b})
+}
+
+// Current returns the installed backend, nil when search is off.
+func Current() Backend {
+	h, _ := current.Load().(holder)
+	return h.Backend
+}
+
+// Source provides the documents of one type.
+type Source struct {
+	Type     string
+	LabelKey string // i18n key naming the type on the search page, e.g. "search.type.member"
+	// List returns every document of the tenant, for Reindex.
+	List func(ctx context.Context, tenantID int64) ([]Document, error)
+	// Get returns a document, nil when the resource no longer exists, for Touch.
+	Get func(ctx context.Context, tenantID int64, id string) (*Document, error)
+}
+
+var sources struct {
+	sync.RWMutex
+	list []Source
+}
+
+// Register adds a source, replacing any previous one of the same type.
+func Register(src Source) {
+	sources.Lock()
+	defer sources.Unlock()
+	for i, s := range sources.list {
+		if s.Type == src.Type {
+			sources.list[i] = src
+			return
+		}
+	}
+	sources.list = append(sources.list, src)
+}
+
+// Sources returns the registered sources, in registration order.
+func Sources() []Source {
+	sources.RLock()
+	defer sources.RUnlock()
+	return append([]Source{}, sources.list...)
+}
+
+func source(typ string) (Source, bool) {
+	for _, s := range Sources() {
+		if s.Type == typ {
+			return s, true
+		}
+	}
+	return Source{}, false
+}
+
+// Touch indexes the current state of a resource, or removes it from the index when its source no
+// longer finds it. Failures are logged but never block the caller's flow; Reindex repairs them.
+func Touch(ctx context.Context, tenantID int64, typ, id string) {
+	b := Current()
+	src, ok := source(typ)
+	if b == nil || !ok {
+		return
+	}
+	doc, err := src.Get(ctx, tenantID, id)
+	if err == nil {
+		if doc == nil {
+			err = b.Delete(ctx, tenantID, typ, id)
+		} else {
+			doc.TenantID, doc.Type, doc.ID = tenantID, typ, id
+			err = b.Index(ctx, *doc)
+		}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "[SEARCH] Failed to index document", "tenant_id", tenantID, "type", typ, "id", id, "err", err)
+	}
+}
+
+// Reindex rebuilds the index of a tenant from the registered sources and returns the number of
+// documents indexed. Documents indexed without a source are dropped.
+func Reindex(ctx context.Context, tenantID int64) (int, error) {
+	b := Current()
+	if b == nil {
+		return 0, ErrDisabled
+	}
+	if err := b.DeleteTenant(ctx, tenantID); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, src := range Sources() {
+		docs, err := src.List(ctx, tenantID)
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", src.Type, err)
+		}
+		for i := range docs {
+			docs[i].TenantID, docs[i].Type = tenantID, src.Type
+		}
+		if len(docs) == 0 {
+			continue
+		}
+		if err := b.Index(ctx, docs...); err != nil {
+			return n, fmt.Errorf("%s: %w", src.Type, err)
+		}
+		n += len(docs)
+	}
+	return n, nil
+}
+
+// Search runs q on the installed backend.
+func Search(ctx context.Context, q Query) ([]Result, error) {
+	b := Current()
+	if b == nil {
+		return nil, ErrDisabled
+	}
+	if len(q.Terms()) == 0 {
+		return nil, nil
+	}
+	return b.Search(ctx, q)
+}
+
+// highlight returns an excerpt of text around the first of the terms it contains, with every
+// occurrence of a term wrapped in the highlight markers, for backends without snippets of their own.
+func highlight(text string, terms []string, words int) string {
+	fields := strings.Fields(text)
+	first := -1
+	for i, f := range fields {
+		if matchesTerm(f, terms) {
+			fields[i] = HighlightStart + f + HighlightEnd
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	start := max(first-words/3, 0)
+	end := min(start+words, len(fields))
+	s := strings.Join(fields[start:end], " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(fields) {
+		s += "…"
+	}
+	return s
+}
+
+func matchesTerm(word string, terms []string) bool {
+	w := strings.ToLower(word)
+	for _, t := range terms {
+		if strings.Contains(w, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/multitenant/pagination"
+)
+
+// SQLite searches the application database. With FTS5 (go build -tags sqlite_fts5) documents live
+// in the search_fts virtual table and results are ranked by BM25, title matches first; without it
+// they live in search_docs and every term must appear in the title or body.
+type SQLite struct {
+	DB  *sql.DB
+	FTS bool // FTS5 is available
+}
+
+// NewSQLite creates the index tables of d, using FTS5 when the driver supports it.
+func NewSQLite(ctx context.Context, d *sql.DB) (*SQLite, error) {
+	s := &SQLite{DB: d, FTS: true}
+	_, err := db.LogExec(ctx, d, `
+		CREATE VIRTUAL TABLE IF NOT EXISTS search_fts USING fts5(
+			tenant_id UNINDEXED, type UNINDEXED, doc_id UNINDEXED, min_role UNINDEXED, url UNINDEXED,
+			title, body, tokenize = 'unicode61 remove_diacritics 2')`)
+	if err == nil {
+		// The table of an earlier FTS5 build exists even when this binary lacks the module
+		_, err = db.LogExec(ctx, d, `SELECT 1 FROM search_fts LIMIT 0`)
+	}
+	if err != nil && strings.Contains(err.Error(), "no such module") {
+		slog.WarnContext(ctx, "[SEARCH] SQLite built without FTS5, falling back to LIKE matching; build with -tags sqlite_fts5 for ranked search")
+		s.FTS = false
+		_, err = db.LogExec(ctx, d, `
+			CREATE TABLE IF NOT EXISTS search_docs (
+				tenant_id INTEGER NOT NULL,
+				type TEXT NOT NULL,
+				doc_id TEXT NOT NULL,
+				min_role TEXT NOT NULL DEFAULT '',
+				url TEXT NOT NULL DEFAULT '',
+				title TEXT NOT NULL DEFAULT '',
+				body TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (tenant_id, type, doc_id)
+			)`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLite) table() string {
+	if s.FTS {
+		return "search_fts"
+	}
+	return "search_docs"
+}
+
+// Index replaces the documents in one transaction.
+func (s *SQLite) Index(ctx context.Context, docs ...Document) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, d := range docs {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+s.table()+` WHERE tenant_id = ? AND type = ? AND doc_id = ?`,
+			d.TenantID, d.Type, d.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+s.table()+` (tenant_id, type, doc_id, min_role, url, title, body)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, d.TenantID, d.Type, d.ID, d.MinRole, d.URL, d.Title, d.Body); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes a document.
+func (s *SQLite) Delete(ctx context.Context, tenantID int64, typ, id string) error {
+	_, err := db.LogExec(ctx, s.DB, `DELETE FROM `+s.table()+` WHERE tenant_id = ? AND type = ? AND doc_id = ?`, tenantID, typ, id)
+	return err
+}
+
+// DeleteTenant removes every document of a tenant.
+func (s *SQLite) DeleteTenant(ctx context.Context, tenantID int64) error {
+	_, err := db.LogExec(ctx, s.DB, `DELETE FROM `+s.table()+` WHERE tenant_id = ?`, tenantID)
+	return err
+}
+
+// Search matches every term as a word prefix.
+func (s *SQLite) Search(ctx context.Context, q Query) ([]Result, error) {
+	terms := q.Terms()
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	where := []string{"tenant_id = ?"}
+	args := []any{q.TenantID}
+	if len(q.Types) > 0 {
+		where = append(where, "type IN (?"+strings.Repeat(", ?", len(q.Types)-1)+")")
+		for _, t := range q.Types {
+			args = append(args, t)
+		}
+	}
+	roles := "min_role = ''"
+	for _, r := range q.Roles {
+		roles += " OR min_role = ?"
+		args = append(args, r)
+	}
+	where = append(where, "("+roles+")")
+
+	var query string
+	if s.FTS {
+		// Quoted terms are taken literally; the trailing * matches them as prefixes
+		match := make([]string, len(terms))
+		for i, t := range terms {
+			match[i] = `"` + t + `"*`
+		}
+		where = append(where, "search_fts MATCH ?")
+		args = append(args, strings.Join(match, " "))
+		query = `SELECT tenant_id, type, doc_id, min_role, url, title, body,
+				-bm25(search_fts, 0, 0, 0, 0, 0, 10.0, 1.0),
+				snippet(search_fts, 6, char(2), char(3), '…', 24)
+			FROM search_fts WHERE ` + strings.Join(where, " AND ") + ` ORDER BY 8 DESC LIMIT ? OFFSET ?`
+	} else {
+		for _, t := range terms {
+			where = append(where, `(title LIKE ? ESCAPE '\' OR body LIKE ? ESCAPE '\')`)
+			args = append(args, pagination.Contains(t), pagination.Contains(t))
+		}
+		// Rank the documents whose title holds the first term above the others
+		query = `SELECT tenant_id, type, doc_id, min_role, url, title, body,
+				CASE WHEN title LIKE ? ESCAPE '\' THEN 2 ELSE 1 END, ''
+			FROM search_docs WHERE ` + strings.Join(where, " AND ") + ` ORDER BY 8 DESC, title LIMIT ? OFFSET ?`
+		args = append([]any{pagination.Contains(terms[0])}, args...)
+	}
+	args = append(args, max(q.Limit, 1), q.Offset)
+
+	rows, err := db.LogQuery(ctx, s.DB, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Result
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.TenantID, &r.Type, &r.ID, &r.MinRole, &r.URL, &r.Title, &r.Body, &r.Score, &r.Snippet); err != nil {
+			return nil, err
+		}
+		if !s.FTS {
+			r.Snippet = highlight(r.Body, terms, 24)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,135 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSecretsManager reads secrets from the keys of an AWS Secrets Manager secret whose value is a
+// JSON object, {"TENKIT_SECRET": "...", "SMTP_PASSWORD": "..."}. Requests are signed with AWS
+// Signature Version 4.
+type AWSSecretsManager struct {
+	Region       string
+	SecretID     string // Name or ARN
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // For temporary credentials
+	Endpoint     string // Defaults to https://secretsmanager.<region>.amazonaws.com
+	Client       *http.Client
+
+	doc document
+}
+
+func (a *AWSSecretsManager) Get(ctx context.Context, name string) (string, error) {
+	data, err := a.doc.get(ctx, a.read)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// read returns the key/value pairs of the secret.
+func (a *AWSSecretsManager) read(ctx context.Context) (map[string]string, error) {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + a.Region + ".amazonaws.com"
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": a.SecretID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: aws: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body, time.Now().UTC())
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: aws: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("secrets: aws %s: %s: %s", a.SecretID, resp.Status, msg)
+	}
+	var out struct {
+		SecretString string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("secrets: aws: %w", err)
+	}
+	var pairs map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out.SecretString), &pairs); err != nil {
+		return nil, fmt.Errorf("secrets: aws %s: the secret must be a JSON object: %w", a.SecretID, err)
+	}
+	return stringValues(pairs), nil
+}
+
+// sign adds the SigV4 headers of the secretsmanager service to the request.
+func (a *AWSSecretsManager) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+
+	// Step 1: Canonical request
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		canonHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, "/", "", canonHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+
+	// Step 2: String to sign
+	scope := day + "/" + a.Region + "/secretsmanager/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	// Step 3: Signature
+	key := hmacSHA256([]byte("AWS4"+a.SecretKey), day)
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.AccessKey, scope, signedHeaders, sig))
+	req.Header.Del("Host") // net/http sends req.Host itself
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,143 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/logging"
+	"github.com/pandamasta/tenkit/multitenant/utils"
+)
+
+// Cache keeps the values of a provider for TTL, so that remote providers are not called on every
+// read, and runs the OnRotate callbacks of the secrets whose value changed when it reads them
+// again. A zero TTL caches values until Refresh.
+type Cache struct {
+	Provider Provider
+	TTL      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	hooks   map[string][]func(ctx context.Context, old, new string)
+}
+
+type cacheEntry struct {
+	value   string
+	found   bool
+	fetched time.Time
+}
+
+// NewCache returns a cache of p.
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	return &Cache{Provider: p, TTL: ttl}
+}
+
+// Get returns the cached value of name, reading it from the provider when it expired. When the
+// provider fails, the expired value is kept.
+func (c *Cache) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && (c.TTL == 0 || time.Since(e.fetched) < c.TTL) {
+		if !e.found {
+			return "", ErrNotFound
+		}
+		return e.value, nil
+	}
+	return c.fetch(ctx, name)
+}
+
+// fetch reads name from the provider and runs the rotation callbacks when its value changed.
+func (c *Cache) fetch(ctx context.Context, name string) (string, error) {
+	v, err := c.Provider.Get(ctx, name)
+	found := err == nil
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		c.mu.Lock()
+		e, ok := c.entries[name]
+		c.mu.Unlock()
+		if ok && e.found {
+			slog.WarnContext(ctx, "[SECRETS] Provider failed, keeping the cached value", "secret", name, "err", err)
+			return e.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry{}
+	}
+	old, seen := c.entries[name]
+	c.entries[name] = cacheEntry{value: v, found: found, fetched: time.Now()}
+	hooks := c.hooks[name]
+	c.mu.Unlock()
+
+	if found {
+		logging.RedactValue(v)
+	}
+	if seen && old.found && found && old.value != v {
+		slog.InfoContext(ctx, "[SECRETS] Secret rotated", "secret", name)
+		for _, fn := range hooks {
+			fn(ctx, old.value, v)
+		}
+	}
+	if !found {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+// OnRotate registers fn to run when the value of name changes, with its previous and new values.
+func (c *Cache) OnRotate(name string, fn func(ctx context.Context, old, new string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hooks == nil {
+		c.hooks = map[string][]func(ctx context.Context, old, new string){}
+	}
+	c.hooks[name] = append(c.hooks[name], fn)
+}
+
+// Refresh reads every cached secret again, running the callbacks of those that rotated.
+func (c *Cache) Refresh(ctx context.Context) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+	for _, name := range names {
+		if _, err := c.fetch(ctx, name); err != nil && !errors.Is(err, ErrNotFound) {
+			slog.ErrorContext(ctx, "[SECRETS] Failed to refresh secret", "secret", name, "err", err)
+		}
+	}
+}
+
+// Watch refreshes the cache every TTL until ctx is done; it returns at once without a TTL.
+func (c *Cache) Watch(ctx context.Context) {
+	if c.TTL <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.TTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Refresh(ctx)
+		}
+	}
+}
+
+// RotateSigningKey installs a rotated TENKIT_SECRET as the token signing key. The replaced key is
+// still accepted for verification along with TENKIT_SECRET_PREVIOUS, so that issued tokens and
+// sessions survive one rotation.
+func RotateSigningKey(c *Cache, cfg *multitenant.Config) {
+	previous := append([]string{}, cfg.Secret.Previous...)
+	c.OnRotate(SigningKey, func(ctx context.Context, old, new string) {
+		utils.SetKeys(new, append([]string{old}, previous...)...)
+		slog.InfoContext(ctx, "[SECRETS] Signing key rotated")
+	})
+}
@@ -0,0 +1,166 @@
+// Package secrets reads the secrets of the application, such as the token signing key and the SMTP
+// password, from the environment, files, HashiCorp Vault or AWS Secrets Manager. Secrets are named
+// after their environment variables in every provider.
+//
+// SECRETS_PROVIDER selects the provider: env (the default), file (one file per secret in
+// SECRETS_DIR, as Docker and Kubernetes mount them), vault (the keys of the Vault secret at
+// VAULT_SECRET_PATH, KV v1 or v2) or aws (a JSON object in the Secrets Manager secret
+// AWS_SECRET_ID). Apply fills the configuration before it is validated; the Cache refreshes the
+// values every SECRETS_CACHE_TTL and runs the OnRotate callbacks when one changes.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/logging"
+)
+
+// ErrNotFound is returned by Get when the provider has no value for the secret.
+var ErrNotFound = errors.New("secrets: not found")
+
+// Names of the secrets read by Apply, and of the Stripe keys for billing integrations.
+const (
+	SigningKey          = "TENKIT_SECRET"
+	SigningKeyPrevious  = "TENKIT_SECRET_PREVIOUS" // Comma-separated
+	MasterKey           = "TENKIT_MASTER_KEY"
+	MasterKeyPrevious   = "TENKIT_MASTER_KEY_PREVIOUS" // Comma-separated
+	SMTPUser            = "SMTP_USER"
+	SMTPPassword        = "SMTP_PASSWORD"
+	DatabaseDSN         = "DATABASE_DSN"
+	S3AccessKey         = "S3_ACCESS_KEY"
+	S3SecretKey         = "S3_SECRET_KEY"
+	RedisPassword       = "REDIS_PASSWORD"
+	MailgunSigningKey   = "MAILGUN_SIGNING_KEY"
+	InboundMailSecret   = "INBOUND_MAIL_SECRET"
+	MetricsToken        = "METRICS_TOKEN"
+	SentryDSN           = "SENTRY_DSN"
+	SearchAPIKey        = "SEARCH_API_KEY"
+	ChallengeSecret     = "CHALLENGE_SECRET"
+	StripeSecretKey     = "STRIPE_SECRET_KEY"
+	StripeWebhookSecret = "STRIPE_WEBHOOK_SECRET"
+)
+
+// Provider returns the current value of a secret.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Env reads secrets from environment variables.
+type Env struct{}
+
+func (Env) Get(_ context.Context, name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+// File reads each secret from the file of its name in Dir, as mounted by Docker and Kubernetes
+// (/run/secrets/TENKIT_SECRET). Surrounding whitespace is trimmed.
+type File struct {
+	Dir string
+}
+
+func (f File) Get(_ context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return "", fmt.Errorf("secrets: invalid name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("secrets: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// New builds the provider selected by the configuration, cached for cfg.CacheTTL.
+func New(cfg multitenant.SecretsConfig) (*Cache, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	var p Provider
+	switch cfg.Provider {
+	case "", "env":
+		p = Env{}
+	case "file":
+		p = File{Dir: cfg.Dir}
+	case "vault":
+		p = &Vault{Addr: cfg.VaultAddr, Token: cfg.VaultToken, Path: cfg.VaultPath}
+	case "aws":
+		p = &AWSSecretsManager{
+			Region:       cfg.AWSRegion,
+			SecretID:     cfg.AWSSecretID,
+			AccessKey:    cfg.AWSAccessKey,
+			SecretKey:    cfg.AWSSecretKey,
+			SessionToken: cfg.AWSSessionToken,
+		}
+	}
+	return NewCache(p, cfg.CacheTTL), nil
+}
+
+// fields maps the secrets Apply reads to their configuration fields.
+var fields = map[string]func(c *multitenant.Config) *string{
+	SigningKey:        func(c *multitenant.Config) *string { return &c.Secret.Current },
+	MasterKey:         func(c *multitenant.Config) *string { return &c.Crypto.MasterKey },
+	SMTPUser:          func(c *multitenant.Config) *string { return &c.Mail.SMTPUser },
+	SMTPPassword:      func(c *multitenant.Config) *string { return &c.Mail.SMTPPassword },
+	DatabaseDSN:       func(c *multitenant.Config) *string { return &c.Database.DSN },
+	S3AccessKey:       func(c *multitenant.Config) *string { return &c.Storage.S3AccessKey },
+	S3SecretKey:       func(c *multitenant.Config) *string { return &c.Storage.S3SecretKey },
+	RedisPassword:     func(c *multitenant.Config) *string { return &c.RateLimit.RedisPassword },
+	MailgunSigningKey: func(c *multitenant.Config) *string { return &c.Mail.MailgunSigningKey },
+	InboundMailSecret: func(c *multitenant.Config) *string { return &c.Mail.InboundSecret },
+	MetricsToken:      func(c *multitenant.Config) *string { return &c.Metrics.Token },
+	SentryDSN:         func(c *multitenant.Config) *string { return &c.Errors.SentryDSN },
+	SearchAPIKey:      func(c *multitenant.Config) *string { return &c.Search.APIKey },
+	ChallengeSecret:   func(c *multitenant.Config) *string { return &c.Challenge.Secret },
+}
+
+// Apply sets the secrets of cfg from p; secrets p does not have keep their configured value. Call
+// it before cfg.Validate, which refuses the default signing key. The values of every secret setting
+// are then redacted from logs.
+func Apply(ctx context.Context, p Provider, cfg *multitenant.Config) error {
+	for name, field := range fields {
+		v, err := p.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("secrets: %s: %w", name, err)
+		}
+		*field(cfg) = v
+	}
+	for name, list := range map[string]*[]string{SigningKeyPrevious: &cfg.Secret.Previous, MasterKeyPrevious: &cfg.Crypto.PreviousMasterKeys} {
+		v, err := p.Get(ctx, name)
+		switch {
+		case err == nil:
+			*list = splitList(v)
+		case !errors.Is(err, ErrNotFound):
+			return fmt.Errorf("secrets: %s: %w", name, err)
+		}
+	}
+	for _, field := range fields {
+		logging.RedactValue(*field(cfg))
+	}
+	logging.RedactValue(cfg.Secret.Previous...)
+	logging.RedactValue(cfg.Crypto.PreviousMasterKeys...)
+	return nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
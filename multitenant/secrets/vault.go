@@ -0,0 +1,107 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vault reads secrets from the keys of a HashiCorp Vault secret, e.g. Path "secret/data/tenkit"
+// on a KV version 2 mount or "secret/tenkit" on version 1.
+type Vault struct {
+	Addr   string // e.g. "https://vault.internal:8200"
+	Token  string
+	Path   string
+	Client *http.Client
+
+	doc document
+}
+
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	data, err := v.doc.get(ctx, v.read)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// read returns the key/value pairs of the secret.
+func (v *Vault) read(ctx context.Context) (map[string]string, error) {
+	url := strings.TrimRight(v.Addr, "/") + "/v1/" + strings.Trim(v.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: vault: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("secrets: vault %s: %s: %s", v.Path, resp.Status, msg)
+	}
+
+	// KV version 2 nests the pairs in data.data, version 1 returns them in data
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("secrets: vault: %w", err)
+	}
+	pairs := body.Data
+	if nested, ok := body.Data["data"]; ok && strings.HasPrefix(string(nested), "{") {
+		if err := json.Unmarshal(nested, &pairs); err != nil {
+			return nil, fmt.Errorf("secrets: vault: %w", err)
+		}
+	}
+	return stringValues(pairs), nil
+}
+
+// stringValues keeps the string values of a JSON object.
+func stringValues(pairs map[string]json.RawMessage) map[string]string {
+	values := make(map[string]string, len(pairs))
+	for k, raw := range pairs {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			values[k] = s
+		}
+	}
+	return values
+}
+
+// document keeps the last key/value pairs read from a remote secret for a second, so that reading
+// several secrets at once, as Apply does, makes a single request.
+type document struct {
+	mu     sync.Mutex
+	values map[string]string
+	read   time.Time
+}
+
+func (d *document) get(ctx context.Context, read func(context.Context) (map[string]string, error)) (map[string]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.values != nil && time.Since(d.read) < time.Second {
+		return d.values, nil
+	}
+	values, err := read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.values, d.read = values, time.Now()
+	return values, nil
+}
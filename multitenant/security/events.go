@@ -0,0 +1,79 @@
+// Package security records brute-force related events (failed logins, lockouts, CSRF failures,
+// rate limiting) so operators can alert on credential-stuffing waves. Every event is counted in
+// tenkit_security_events_total, logged, and passed to subscribers; the rarer ones are also audited.
+package security
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/metrics"
+)
+
+// EventType identifies a security event.
+type EventType string
+
+const (
+	FailedLogin EventType = "failed_login"
+	Lockout     EventType = "lockout"      // Login refused because the client exceeded the login limits
+	CSRFFailure EventType = "csrf_failure" // Missing or invalid CSRF token
+	RateLimited EventType = "rate_limited" // Any other request refused by a rate limit
+)
+
+// audited lists the events also written to audit_logs. Rate limiting is left out: it fires on
+// every request of a flood and would turn an attack on the site into one on the database.
+var audited = map[EventType]bool{FailedLogin: true, Lockout: true, CSRFFailure: true}
+
+// Event is a single security event.
+type Event struct {
+	Type     EventType
+	TenantID int64 // 0 when the tenant is unknown or on the root domain
+	UserID   int64 // 0 for anonymous requests
+	IP       string
+	Path     string
+	Detail   string // e.g. the submitted email or the rate limit rule
+	Time     time.Time
+}
+
+// Events counts security events by type, for alerting.
+var Events = metrics.NewCounterVec("tenkit_security_events_total", "Security events by type.", "type")
+
+var subscribers struct {
+	sync.RWMutex
+	fns []func(context.Context, Event)
+}
+
+// Subscribe registers fn to receive every event, e.g. to push them to a SIEM.
+// fn runs synchronously in the request and must be fast.
+func Subscribe(fn func(context.Context, Event)) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	subscribers.fns = append(subscribers.fns, fn)
+}
+
+// Emit records an event.
+func Emit(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	Events.Inc(string(e.Type))
+	slog.WarnContext(ctx, "[SECURITY] "+string(e.Type), "tenant_id", e.TenantID, "user_id", e.UserID, "ip", e.IP, "path", e.Path, "detail", e.Detail)
+	if audited[e.Type] {
+		models.LogAudit(ctx, models.AuditEntry{
+			TenantID: e.TenantID,
+			UserID:   e.UserID,
+			Action:   "security." + string(e.Type),
+			IP:       e.IP,
+			Details:  e.Detail,
+		})
+	}
+
+	subscribers.RLock()
+	defer subscribers.RUnlock()
+	for _, fn := range subscribers.fns {
+		fn(ctx, e)
+	}
+}
@@ -0,0 +1,220 @@
+package multitenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Setting types, deciding how a setting is edited on the settings page and stored as JSON.
+const (
+	SettingBool   = "bool"
+	SettingString = "string"
+	SettingInt    = "int"
+)
+
+// settingKeyRegex restricts keys to short dotted names such as "calendar.public".
+var settingKeyRegex = regexp.MustCompile(`^[a-z0-9_.]{1,64}$`)
+
+// ValidSettingKey reports whether key can be stored as a tenant setting.
+func ValidSettingKey(key string) bool {
+	return settingKeyRegex.MatchString(key)
+}
+
+// SettingDef declares a tenant setting so that it gets a default and a field on the settings page.
+// Undeclared keys can still be stored through models.SetTenantSetting.
+type SettingDef struct {
+	Key      string // Stable key, e.g. "allow_signins"
+	LabelKey string // i18n key of the label
+	HelpKey  string // Optional i18n key of a help text
+	Type     string // SettingBool, SettingString or SettingInt
+	Default  any    // Value used when the tenant never set the key
+	Order    int    // Lower values are rendered first
+	// Validate optionally checks the trimmed value of a SettingString, e.g. ValidateIPRanges
+	Validate func(value string) error
+}
+
+// Parse converts a form value into the JSON stored for this setting.
+func (d SettingDef) Parse(value string) (json.RawMessage, error) {
+	switch d.Type {
+	case SettingBool:
+		return json.Marshal(value == "1" || value == "true" || value == "on")
+	case SettingInt:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("setting %s: %q is not a number", d.Key, value)
+		}
+		return json.Marshal(n)
+	case SettingString:
+		value = strings.TrimSpace(value)
+		if d.Validate != nil {
+			if err := d.Validate(value); err != nil {
+				return nil, fmt.Errorf("setting %s: %w", d.Key, err)
+			}
+		}
+		return json.Marshal(value)
+	}
+	return nil, fmt.Errorf("setting %s: unknown type %q", d.Key, d.Type)
+}
+
+// DefaultJSON returns the JSON of the value that applies while the tenant never set the key:
+// Default, or the zero value of Type.
+func (d SettingDef) DefaultJSON() json.RawMessage {
+	v := d.Default
+	if v == nil {
+		switch d.Type {
+		case SettingBool:
+			v = false
+		case SettingInt:
+			v = 0
+		default:
+			v = ""
+		}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// SettingRegistry holds the settings declared by the embedding application.
+type SettingRegistry struct {
+	mu   sync.RWMutex
+	defs []SettingDef
+}
+
+// DefaultSettings is the registry used by Settings and the settings page.
+var DefaultSettings = &SettingRegistry{}
+
+// RegisterSetting declares a setting in DefaultSettings. It panics on an invalid key, as a programming error.
+func RegisterSetting(def SettingDef) {
+	DefaultSettings.Register(def)
+}
+
+// Register declares a setting, replacing any previous one with the same key.
+func (s *SettingRegistry) Register(def SettingDef) {
+	if !ValidSettingKey(def.Key) {
+		panic(fmt.Sprintf("multitenant: invalid setting key %q", def.Key))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.defs {
+		if existing.Key == def.Key {
+			s.defs[i] = def
+			return
+		}
+	}
+	s.defs = append(s.defs, def)
+	sort.SliceStable(s.defs, func(i, j int) bool { return s.defs[i].Order < s.defs[j].Order })
+}
+
+// Get returns the declaration of key.
+func (s *SettingRegistry) Get(key string) (SettingDef, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, d := range s.defs {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return SettingDef{}, false
+}
+
+// Defs returns a copy of all declarations in display order.
+func (s *SettingRegistry) Defs() []SettingDef {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]SettingDef, len(s.defs))
+	copy(out, s.defs)
+	return out
+}
+
+// Settings are a tenant's stored settings, as JSON values by key. They are loaded with the tenant
+// and cached with it, so they must be treated as read-only; write through models.SetTenantSetting.
+type Settings struct {
+	values map[string]json.RawMessage
+}
+
+// NewSettings wraps stored values.
+func NewSettings(values map[string]json.RawMessage) Settings {
+	return Settings{values: values}
+}
+
+// Inherit returns the settings with the values of parent for the keys they do not set, for
+// sub-tenants.
+func (s Settings) Inherit(parent Settings) Settings {
+	values := make(map[string]json.RawMessage, len(parent.values)+len(s.values))
+	for k, v := range parent.values {
+		values[k] = v
+	}
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return Settings{values: values}
+}
+
+// MarshalJSON encodes the stored values, so that a tenant can be kept in a shared cache.
+func (s Settings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.values)
+}
+
+// UnmarshalJSON decodes values encoded by MarshalJSON.
+func (s *Settings) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &s.values)
+}
+
+// Has reports whether the tenant stored a value for key.
+func (s Settings) Has(key string) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+// Decode unmarshals the stored value of key into dst, or the declared default when the tenant never set it.
+// It reports false when neither exists.
+func (s Settings) Decode(key string, dst any) (bool, error) {
+	if raw, ok := s.values[key]; ok {
+		return true, json.Unmarshal(raw, dst)
+	}
+	def, ok := DefaultSettings.Get(key)
+	if !ok || def.Default == nil {
+		return false, nil
+	}
+	raw, err := json.Marshal(def.Default)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, dst)
+}
+
+// GetBool returns a boolean setting, false when unset or not a boolean.
+func (s Settings) GetBool(key string) bool {
+	var v bool
+	s.Decode(key, &v)
+	return v
+}
+
+// GetString returns a string setting, "" when unset or not a string.
+func (s Settings) GetString(key string) string {
+	var v string
+	s.Decode(key, &v)
+	return v
+}
+
+// GetInt returns an integer setting, 0 when unset or not a number.
+func (s Settings) GetInt(key string) int {
+	var v int
+	s.Decode(key, &v)
+	return v
+}
+
+// GetDuration returns a duration setting stored as a string such as "15m", 0 when unset or invalid.
+func (s Settings) GetDuration(key string) time.Duration {
+	d, _ := time.ParseDuration(s.GetString(key))
+	return d
+}
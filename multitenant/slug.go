@@ -0,0 +1,137 @@
+package multitenant
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// maxSubdomainLen is the length limit of a DNS label.
+const maxSubdomainLen = 63
+
+var subdomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?$`)
+
+// DefaultReservedSubdomains are the names kept for the platform when RESERVED_SUBDOMAINS is unset.
+var DefaultReservedSubdomains = []string{
+	"www", "api", "admin", "app", "auth", "login", "dashboard", "account", "accounts",
+	"mail", "smtp", "imap", "pop", "mx", "ns1", "ns2", "ftp",
+	"static", "assets", "cdn", "media", "files",
+	"help", "support", "status", "docs", "blog", "billing",
+	"dev", "staging", "test", "demo", "root", "system",
+}
+
+// transliterations spell out letters that do not decompose into an ASCII letter and a mark.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'þ': "th", 'ł': "l", 'ı': "i",
+	'&': "and",
+}
+
+// latinBase maps the precomposed Latin letters with diacritics to their base letter.
+var latinBase = map[rune]rune{}
+
+func init() {
+	for base, variants := range map[rune]string{
+		'a': "àáâãäåāăą", 'c': "çćĉċč", 'd': "ď", 'e': "èéêëēĕėęě", 'g': "ĝğġģ", 'h': "ĥħ",
+		'i': "ìíîïĩīĭįİ", 'j': "ĵ", 'k': "ķ", 'l': "ĺļľŀ", 'n': "ñńņňŉ", 'o': "òóôõöōŏő",
+		'r': "ŕŗř", 's': "śŝşšș", 't': "ţťŧț", 'u': "ùúûüũūŭůűų", 'w': "ŵ", 'y': "ýÿŷ", 'z': "źżž",
+	} {
+		for _, v := range variants {
+			latinBase[v] = base
+		}
+	}
+}
+
+// Slugify turns an organization name into a subdomain candidate: lowercase ASCII letters and
+// digits, with accents transliterated ("Café Müller" becomes "cafe-muller"), full-width forms
+// folded and every other run of characters replaced by a single hyphen. The result may still be
+// empty, reserved or taken; see ServerConfig.ValidSubdomain and AvailableSubdomain.
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	write := func(s string) {
+		if hyphen && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		hyphen = false
+		b.WriteString(s)
+	}
+	for _, r := range strings.ToLower(name) {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r = unicode.ToLower(r - 0xFEE0) // Full-width ASCII
+		}
+		if base, ok := latinBase[r]; ok {
+			r = base
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			write(string(r))
+		case transliterations[r] != "":
+			write(transliterations[r])
+		default:
+			hyphen = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSubdomainLen {
+		slug = strings.TrimRight(slug[:maxSubdomainLen], "-")
+	}
+	return slug
+}
+
+// IsReserved reports whether sub is kept for the platform.
+func (c ServerConfig) IsReserved(sub string) bool {
+	return slices.ContainsFunc(c.ReservedSubdomains, func(r string) bool { return strings.EqualFold(r, sub) })
+}
+
+// ValidSubdomain reports whether sub can name a new tenant: a single DNS label that is not
+// reserved and does not look like the preview host of another tenant.
+func (c ServerConfig) ValidSubdomain(sub string) bool {
+	if !subdomainRegex.MatchString(sub) || c.IsReserved(sub) {
+		return false
+	}
+	_, isPreview := c.PreviewOf(sub)
+	return !isPreview
+}
+
+// AvailableSubdomain returns the first free and valid subdomain for an organization name: its slug,
+// then the slug suffixed with -2, -3 and so on. It returns "" when the name yields no usable slug.
+func (c ServerConfig) AvailableSubdomain(ctx context.Context, name string) (string, error) {
+	return c.availableSubdomain(ctx, name, "")
+}
+
+// AvailableSubTenantSubdomain is AvailableSubdomain for a sub-tenant of the tenant on parent: it
+// returns the free subdomain "<slug>.<parent>", e.g. "client.agency".
+func (c ServerConfig) AvailableSubTenantSubdomain(ctx context.Context, name, parent string) (string, error) {
+	return c.availableSubdomain(ctx, name, "."+parent)
+}
+
+// availableSubdomain returns the first free subdomain made of a valid label for name followed by suffix.
+func (c ServerConfig) availableSubdomain(ctx context.Context, name, suffix string) (string, error) {
+	slug := Slugify(name)
+	if slug == "" {
+		return "", nil
+	}
+	for i := 1; i <= 100; i++ {
+		sub := slug
+		if i > 1 {
+			suffix := "-" + strconv.Itoa(i)
+			sub = strings.TrimRight(slug[:min(len(slug), maxSubdomainLen-len(suffix))], "-") + suffix
+		}
+		if !c.ValidSubdomain(sub) {
+			continue
+		}
+		taken, err := models.SubdomainTaken(ctx, sub+suffix)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return sub + suffix, nil
+		}
+	}
+	return "", nil
+}
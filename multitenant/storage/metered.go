@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// Metered wraps a Store to account for the bytes stored under each tenant's prefix (see TenantKey),
+// which the storage limit of plans is checked against. Other keys pass through uncounted. Files of a
+// tenant on legal hold are not deleted: Delete returns models.ErrLegalHold.
+func Metered(s Store) Store {
+	return &meteredStore{Store: s}
+}
+
+type meteredStore struct {
+	Store
+}
+
+func (m *meteredStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	tenantID, ok := KeyTenant(key)
+	if !ok {
+		return m.Store.Put(ctx, key, r, contentType)
+	}
+	cr := &countingReader{r: r}
+	if err := m.Store.Put(ctx, key, cr, contentType); err != nil {
+		return err
+	}
+	if err := models.RecordStoredObject(ctx, tenantID, key, cr.n); err != nil {
+		slog.ErrorContext(ctx, "[STORAGE] Failed to record stored object", "key", key, "err", err)
+	}
+	return nil
+}
+
+func (m *meteredStore) Delete(ctx context.Context, key string) error {
+	tenantID, ok := KeyTenant(key)
+	if ok {
+		if err := models.CheckLegalHold(ctx, tenantID); err != nil {
+			return err
+		}
+	}
+	if err := m.Store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if ok {
+		if err := models.ForgetStoredObject(ctx, key); err != nil {
+			slog.ErrorContext(ctx, "[STORAGE] Failed to forget stored object", "key", key, "err", err)
+		}
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+)
+
+var (
+	// ErrTooLarge is returned by ReadUpload when the file exceeds the rules' MaxSize.
+	ErrTooLarge = errors.New("storage: file too large")
+	// ErrTypeNotAllowed is returned by ReadUpload when the sniffed type is not accepted.
+	ErrTypeNotAllowed = errors.New("storage: file type not allowed")
+)
+
+// UploadRules bound what an upload may contain before it is stored.
+type UploadRules struct {
+	MaxSize int64             // Largest accepted size in bytes
+	Types   map[string]string // Accepted types, as sniffed from the content, mapped to their file extension
+}
+
+// ImageRules accept raster images up to 1 MB. SVG is left out since it can carry scripts.
+var ImageRules = UploadRules{
+	MaxSize: 1 << 20,
+	Types: map[string]string{
+		"image/png":  ".png",
+		"image/jpeg": ".jpg",
+		"image/gif":  ".gif",
+		"image/webp": ".webp",
+	},
+}
+
+// Upload is a file that passed its UploadRules.
+type Upload struct {
+	Data        []byte
+	ContentType string // Sniffed from the content, never the type declared by the client
+	Ext         string // Extension matching ContentType, for building the key
+}
+
+// ReadUpload reads at most rules.MaxSize bytes from r and checks the content type by sniffing.
+func ReadUpload(r io.Reader, rules UploadRules) (*Upload, error) {
+	data, err := io.ReadAll(io.LimitReader(r, rules.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > rules.MaxSize {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := rules.Types[contentType]
+	if !ok {
+		return nil, ErrTypeNotAllowed
+	}
+	return &Upload{Data: data, ContentType: contentType, Ext: ext}, nil
+}
+
+// ContentTypeOf returns the content type to serve a stored key with, from its extension.
+func ContentTypeOf(key string) string {
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,63 @@
+// Package urls builds absolute URLs of the marketing site and of tenant sites, e.g. for links in
+// mails, following Config.Server: the public scheme and port, verified custom domains, and path-based
+// tenant URLs (<root>/t/<subdomain>/...) when TENANT_PATH_URLS is set.
+//
+//	link := urls.Tenant(cfg, tenant, "/confirm", url.Values{"token": {token}})
+//
+// Templates call {{ call .TenantURL "/login" }} and {{ call .MarketingURL "/enroll" }}.
+package urls
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pandamasta/tenkit/multitenant"
+)
+
+// Marketing returns the absolute URL of path on the root domain, with params as query string.
+func Marketing(cfg *multitenant.Config, path string, params url.Values) string {
+	return build(cfg.Server.PublicScheme, host(cfg, cfg.Domain), path, params)
+}
+
+// Tenant returns the absolute URL of path on the site of t: its custom domain when verified, else its
+// subdomain (or path prefix).
+func Tenant(cfg *multitenant.Config, t *multitenant.Tenant, path string, params url.Values) string {
+	if t.CustomDomain != "" {
+		return build(cfg.Server.PublicScheme, t.CustomDomain, path, params)
+	}
+	return Subdomain(cfg, t.Subdomain, path, params)
+}
+
+// Subdomain returns the absolute URL of path on the subdomain host of a tenant, ignoring custom
+// domains, e.g. for tenants not loaded as a multitenant.Tenant.
+func Subdomain(cfg *multitenant.Config, sub, path string, params url.Values) string {
+	if cfg.Server.PathURLs {
+		prefix := "/" + strings.Trim(cfg.Server.TenantPathPrefix, "/") + "/" + sub
+		return build(cfg.Server.PublicScheme, host(cfg, cfg.Domain), prefix+ensureSlash(path), params)
+	}
+	return build(cfg.Server.PublicScheme, host(cfg, sub+"."+cfg.Domain), path, params)
+}
+
+// host appends the public port to h unless the domain already carries one.
+func host(cfg *multitenant.Config, h string) string {
+	if cfg.Server.PublicPort == "" || strings.Contains(cfg.Domain, ":") {
+		return h
+	}
+	return net.JoinHostPort(h, cfg.Server.PublicPort)
+}
+
+func build(scheme, host, path string, params url.Values) string {
+	u := url.URL{Scheme: scheme, Host: host, Path: ensureSlash(path)}
+	if len(params) > 0 {
+		u.RawQuery = params.Encode()
+	}
+	return u.String()
+}
+
+func ensureSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
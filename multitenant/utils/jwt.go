@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// jwtHeader is the encoded {"alg":"HS256","typ":"JWT"} header of every token.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// AccessClaims are the claims of an API access token. The token is bound to a session,
+// so logging out or resetting the password revokes it before it expires.
+type AccessClaims struct {
+	Subject   int64  `json:"sub"` // User ID
+	TenantID  int64  `json:"tid"`
+	Audience  string `json:"aud"` // Tenant subdomain
+	SessionID string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// GenerateAccessToken returns an HS256 JWT for the claims, signed with the current key.
+func GenerateAccessToken(c AccessClaims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	keyRing.RLock()
+	h := hmac.New(sha256.New, keyRing.current)
+	keyRing.RUnlock()
+	h.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// ValidateAccessToken checks the signature against every key in the ring, the expiry and the audience,
+// and returns the claims.
+func ValidateAccessToken(token, audience string) (*AccessClaims, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, false
+	}
+	signed := parts[0] + "." + parts[1]
+	valid := false
+	keyRing.RLock()
+	for _, key := range append([][]byte{keyRing.current}, keyRing.previous...) {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(signed))
+		if hmac.Equal(h.Sum(nil), sig) {
+			valid = true
+			break
+		}
+	}
+	keyRing.RUnlock()
+	if !valid {
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	var c AccessClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, false
+	}
+	if time.Now().Unix() >= c.ExpiresAt || c.Audience != audience || c.SessionID == "" {
+		return nil, false
+	}
+	return &c, true
+}
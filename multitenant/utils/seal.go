@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// Seal encrypts and authenticates plaintext for a purpose, e.g. "cookie|oauth_state", with a key
+// derived from the current signing key. Only Open with the same purpose reads it back.
+func Seal(purpose string, plaintext []byte) (string, error) {
+	keyRing.RLock()
+	key := sealKey(keyRing.current, purpose)
+	keyRing.RUnlock()
+	gcm, err := newSealGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, []byte(purpose))), nil
+}
+
+// Open decrypts a value produced by Seal for the same purpose, trying every key in the ring.
+func Open(purpose, sealed string) ([]byte, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, false
+	}
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	for _, k := range append([][]byte{keyRing.current}, keyRing.previous...) {
+		gcm, err := newSealGCM(sealKey(k, purpose))
+		if err != nil || len(data) < gcm.NonceSize() {
+			return nil, false
+		}
+		if plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(purpose)); err == nil {
+			return plaintext, true
+		}
+	}
+	return nil, false
+}
+
+// sealKey derives the encryption key of a purpose from a signing key, so that the signing keys are
+// never used as encryption keys themselves.
+func sealKey(signingKey []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, signingKey)
+	h.Write([]byte("seal|" + purpose))
+	return h.Sum(nil)
+}
+
+func newSealGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
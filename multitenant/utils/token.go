@@ -4,37 +4,346 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var secretKey = []byte("replace-this-with-env-secret")
+// DefaultSecret is the development-only signing key used when none is configured.
+const DefaultSecret = "replace-this-with-env-secret"
 
-func GenerateSignupToken(email, org string, expires time.Time) (string, error) {
-	payload := fmt.Sprintf("%s|%s|%d", email, org, expires.Unix())
-	h := hmac.New(sha256.New, secretKey)
+// keyRing holds the signing keys. Tokens are signed with the current key and
+// accepted if they verify against the current key or any previous one.
+var keyRing = struct {
+	sync.RWMutex
+	current  []byte
+	previous [][]byte
+}{current: []byte(DefaultSecret)}
+
+// SetKeys installs the signing keys. Previous keys are only used for verification,
+// so tokens issued before a rotation stay valid until they expire.
+func SetKeys(current string, previous ...string) {
+	keyRing.Lock()
+	defer keyRing.Unlock()
+	keyRing.current = []byte(current)
+	keyRing.previous = keyRing.previous[:0]
+	for _, k := range previous {
+		if k != "" {
+			keyRing.previous = append(keyRing.previous, []byte(k))
+		}
+	}
+}
+
+// sign returns "<payload>.<signature>" using the current key.
+func sign(payload string) string {
+	keyRing.RLock()
+	h := hmac.New(sha256.New, keyRing.current)
+	keyRing.RUnlock()
 	h.Write([]byte(payload))
-	sig := h.Sum(nil)
-	token := fmt.Sprintf("%s.%s",
+	return fmt.Sprintf("%s.%s",
 		base64.URLEncoding.EncodeToString([]byte(payload)),
-		base64.URLEncoding.EncodeToString(sig),
+		base64.URLEncoding.EncodeToString(h.Sum(nil)),
 	)
-	return token, nil
 }
 
-func ValidateSignupToken(token string) (email, org string, ok bool) {
+// verify checks the signature against every key in the ring and returns the payload.
+func verify(token string) ([]byte, bool) {
 	parts := strings.Split(token, ".")
 	if len(parts) != 2 {
+		return nil, false
+	}
+	payloadBytes, err := base64.URLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, false
+	}
+	sigBytes, err := base64.URLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	for _, key := range append([][]byte{keyRing.current}, keyRing.previous...) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(payloadBytes)
+		if hmac.Equal(mac.Sum(nil), sigBytes) {
+			return payloadBytes, true
+		}
+	}
+	return nil, false
+}
+
+// MAC returns an HMAC-SHA256 of data under the current key.
+func MAC(data string) []byte {
+	keyRing.RLock()
+	h := hmac.New(sha256.New, keyRing.current)
+	keyRing.RUnlock()
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// minMACSize is the shortest truncation of a MAC that VerifyMAC accepts.
+const minMACSize = 16
+
+// VerifyMAC checks mac against every key in the ring. mac may be truncated to no less than 16 bytes.
+func VerifyMAC(data string, mac []byte) bool {
+	if len(mac) < minMACSize || len(mac) > sha256.Size {
+		return false
+	}
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+	for _, key := range append([][]byte{keyRing.current}, keyRing.previous...) {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		if hmac.Equal(h.Sum(nil)[:len(mac)], mac) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignQR returns the signature that lets /qr.png render data for the given audience.
+// It keeps the endpoint from being used as an open QR service for arbitrary content.
+func SignQR(audience, data string) string {
+	return base64.RawURLEncoding.EncodeToString(MAC("qr|" + audience + "|" + data)[:minMACSize])
+}
+
+// VerifyQR checks a signature produced by SignQR.
+func VerifyQR(audience, data, sig string) bool {
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || len(mac) != minMACSize {
+		return false
+	}
+	return VerifyMAC("qr|"+audience+"|"+data, mac)
+}
+
+// Token purposes. A token is only accepted by the flow it was issued for.
+const (
+	PurposeTenantSignup = "tenant_signup" // /enroll -> /verify
+	PurposeUserConfirm  = "user_confirm"  // /register -> /confirm
+	PurposeDataExport   = "data_export"   // export download links
+	PurposeReport       = "report"        // report job download links
+	PurposeCalendarFeed = "calendar_feed" // per-user calendar subscription URLs
+	PurposeSignupLink   = "signup_link"   // shareable /register links granting a role
+	PurposeFile         = "file"          // signed URLs of objects in local storage
+	PurposeImpersonate  = "impersonate"   // hand-off of an impersonation from the platform to a tenant host
+)
+
+// tokenVersion is the current token format: "v2.<base64 JSON claims>.<signature>".
+const tokenVersion = 2
+
+var (
+	ErrTokenInvalid  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrTokenPurpose  = errors.New("token issued for another purpose")
+	ErrTokenAudience = errors.New("token issued for another audience")
+)
+
+// Claims is the signed payload of a token.
+type Claims struct {
+	Version  int    `json:"v"`
+	Purpose  string `json:"pur"`
+	Audience string `json:"aud"` // Host the token is valid on: root domain or tenant subdomain
+	Email    string `json:"email,omitempty"`
+	Org      string `json:"org,omitempty"`
+	TenantID int64  `json:"tid,omitempty"`
+	UserID   int64  `json:"uid,omitempty"`
+	ObjectID int64  `json:"oid,omitempty"` // Purpose-specific object, e.g. the export ID
+	Role     string `json:"role,omitempty"`
+	MaxUses  int    `json:"max,omitempty"`
+	Key      string `json:"key,omitempty"`   // Storage key of a signed file URL
+	Nonce    string `json:"nonce,omitempty"` // Checked against the server to revoke or consume the token
+	Expires  int64  `json:"exp"`
+}
+
+// IssueToken signs the claims, stamping the current version and expiry.
+func IssueToken(c Claims, expires time.Time) (string, error) {
+	c.Version = tokenVersion
+	c.Expires = expires.Unix()
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d.%s", tokenVersion, sign(string(payload))), nil
+}
+
+// ParseToken verifies a token and checks it was issued for the given purpose and audience.
+func ParseToken(token, purpose, audience string) (*Claims, error) {
+	rest, found := strings.CutPrefix(token, fmt.Sprintf("v%d.", tokenVersion))
+	if !found {
+		return nil, ErrTokenInvalid
+	}
+	payload, ok := verify(rest)
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.Version != tokenVersion {
+		return nil, ErrTokenInvalid
+	}
+	if c.Purpose != purpose {
+		return nil, ErrTokenPurpose
+	}
+	if !strings.EqualFold(c.Audience, audience) {
+		return nil, ErrTokenAudience
+	}
+	if time.Now().Unix() > c.Expires {
+		return nil, ErrTokenExpired
+	}
+	return &c, nil
+}
+
+// LegacyTokensUntil is the hard cutoff of v1 tokens: after it they are refused even when
+// AcceptLegacyTokens turned them on. The v1 format, its validators and TENKIT_ACCEPT_V1_TOKENS are
+// removed in the first release after this date.
+var LegacyTokensUntil = time.Date(2026, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+var acceptLegacy atomic.Bool
+
+// AcceptLegacyTokens turns on the v1 pipe-delimited /verify and /confirm tokens, so that links sent
+// before the upgrade keep working until LegacyTokensUntil. They are refused by default.
+func AcceptLegacyTokens(on bool) {
+	acceptLegacy.Store(on)
+}
+
+// isLegacyToken reports whether a token uses the v1 pipe-delimited format and is still accepted.
+func isLegacyToken(token string) bool {
+	return strings.Count(token, ".") == 1 && acceptLegacy.Load() && time.Now().Before(LegacyTokensUntil)
+}
+
+// GenerateSignupToken issues the token sent by /enroll. The audience is the root domain.
+func GenerateSignupToken(audience, email, org string, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeTenantSignup, Audience: audience, Email: email, Org: org}, expires)
+}
+
+func ValidateSignupToken(token, audience string) (email, org string, ok bool) {
+	if isLegacyToken(token) {
+		return validateLegacySignupToken(token)
+	}
+	c, err := ParseToken(token, PurposeTenantSignup, audience)
+	if err != nil {
 		return "", "", false
 	}
-	payloadBytes, _ := base64.URLEncoding.DecodeString(parts[0])
-	sigBytes, _ := base64.URLEncoding.DecodeString(parts[1])
+	return c.Email, c.Org, true
+}
+
+// GenerateUserToken issues the token sent by /register. The audience is the tenant subdomain.
+func GenerateUserToken(audience, email string, tenantID int64, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeUserConfirm, Audience: audience, Email: email, TenantID: tenantID}, expires)
+}
+
+func ValidateUserToken(token, audience string) (email string, tenantID int64, ok bool) {
+	if isLegacyToken(token) {
+		return validateLegacyUserToken(token)
+	}
+	c, err := ParseToken(token, PurposeUserConfirm, audience)
+	if err != nil {
+		return "", 0, false
+	}
+	return c.Email, c.TenantID, true
+}
+
+// GenerateExportToken signs a download link for a personal data export.
+func GenerateExportToken(audience string, exportID, userID int64, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeDataExport, Audience: audience, ObjectID: exportID, UserID: userID}, expires)
+}
+
+// ValidateExportToken checks the signature, purpose and expiry of an export download token.
+func ValidateExportToken(token, audience string) (exportID, userID int64, ok bool) {
+	c, err := ParseToken(token, PurposeDataExport, audience)
+	if err != nil {
+		return 0, 0, false
+	}
+	return c.ObjectID, c.UserID, true
+}
+
+// GenerateFileToken signs a URL of a stored object. Like a presigned S3 URL it is a bearer link
+// bound to the key only, so it works on whichever host serves the files.
+func GenerateFileToken(key string, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeFile, Key: key}, expires)
+}
+
+// ValidateFileToken checks the signature, purpose and expiry of a file token and returns its key.
+func ValidateFileToken(token string) (key string, ok bool) {
+	c, err := ParseToken(token, PurposeFile, "")
+	if err != nil || c.Key == "" {
+		return "", false
+	}
+	return c.Key, true
+}
+
+// GenerateImpersonationToken signs the hand-off opening an impersonation session on the tenant host.
+// The operator is carried as ObjectID and Email, and nonce is the recorded hand-off it consumes.
+func GenerateImpersonationToken(audience string, userID, tenantID, operatorID int64, operatorEmail, nonce string, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeImpersonate, Audience: audience, UserID: userID, TenantID: tenantID,
+		ObjectID: operatorID, Email: operatorEmail, Nonce: nonce}, expires)
+}
+
+// ValidateImpersonationToken checks an impersonation hand-off token and returns its claims.
+func ValidateImpersonationToken(token, audience string) (*Claims, bool) {
+	c, err := ParseToken(token, PurposeImpersonate, audience)
+	if err != nil || c.UserID == 0 || c.ObjectID == 0 || c.Nonce == "" {
+		return nil, false
+	}
+	return c, true
+}
+
+// GenerateReportToken signs a download link for a finished report job.
+func GenerateReportToken(audience string, jobID, userID int64, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeReport, Audience: audience, ObjectID: jobID, UserID: userID}, expires)
+}
+
+// ValidateReportToken checks the signature, purpose and expiry of a report download token.
+func ValidateReportToken(token, audience string) (jobID, userID int64, ok bool) {
+	c, err := ParseToken(token, PurposeReport, audience)
+	if err != nil {
+		return 0, 0, false
+	}
+	return c.ObjectID, c.UserID, true
+}
 
-	expected := hmac.New(sha256.New, secretKey)
-	expected.Write(payloadBytes)
-	if !hmac.Equal(expected.Sum(nil), sigBytes) {
+// GenerateCalendarToken signs the token of a user's calendar subscription URLs, bound to their
+// calendar feed secret so that rotating it revokes the URLs.
+func GenerateCalendarToken(audience string, userID, tenantID int64, secret string, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeCalendarFeed, Audience: audience, UserID: userID, TenantID: tenantID, Nonce: secret}, expires)
+}
+
+// ValidateCalendarToken checks the signature, purpose and expiry of a calendar feed token. The
+// caller compares the returned secret with the user's current one.
+func ValidateCalendarToken(token, audience string) (userID, tenantID int64, secret string, ok bool) {
+	c, err := ParseToken(token, PurposeCalendarFeed, audience)
+	if err != nil || c.Nonce == "" {
+		return 0, 0, "", false
+	}
+	return c.UserID, c.TenantID, c.Nonce, true
+}
+
+// GenerateSignupLinkToken signs a shareable signup link granting role, usable maxUses times (0 for unlimited).
+func GenerateSignupLinkToken(audience string, linkID int64, role string, maxUses int, expires time.Time) (string, error) {
+	return IssueToken(Claims{Purpose: PurposeSignupLink, Audience: audience, ObjectID: linkID, Role: role, MaxUses: maxUses}, expires)
+}
+
+// ValidateSignupLinkToken checks the signature, purpose and expiry of a signup link token.
+// The remaining uses are tracked in the database, not in the token.
+func ValidateSignupLinkToken(token, audience string) (linkID int64, role string, ok bool) {
+	c, err := ParseToken(token, PurposeSignupLink, audience)
+	if err != nil {
+		return 0, "", false
+	}
+	return c.ObjectID, c.Role, true
+}
+
+// validateLegacySignupToken accepts the v1 "email|org|exp" payload of /enroll. A v1 user token has
+// the same shape with a tenant ID in the middle, so a numeric org is refused: v1 carried no purpose.
+func validateLegacySignupToken(token string) (email, org string, ok bool) {
+	payloadBytes, ok := verify(token)
+	if !ok {
 		return "", "", false
 	}
 
@@ -44,34 +353,22 @@ func ValidateSignupToken(token string) (email, org string, ok bool) {
 	}
 
 	email, org = fields[0], fields[1]
+	if _, err := strconv.ParseInt(org, 10, 64); err == nil {
+		return "", "", false
+	}
 	exp, err := strconv.ParseInt(fields[2], 10, 64)
 	if err != nil || time.Now().Unix() > exp {
 		return "", "", false
 	}
+	slog.Warn("[TOKEN] Accepted legacy v1 signup token")
 	return email, org, true
 }
 
-func GenerateUserToken(email string, tenantID int64, expires time.Time) (string, error) {
-	payload := fmt.Sprintf("%s|%d|%d", email, tenantID, expires.Unix())
-	h := hmac.New(sha256.New, secretKey)
-	h.Write([]byte(payload))
-	sig := h.Sum(nil)
-	return fmt.Sprintf("%s.%s",
-		base64.URLEncoding.EncodeToString([]byte(payload)),
-		base64.URLEncoding.EncodeToString(sig),
-	), nil
-}
-
-func ValidateUserToken(token string) (email string, tenantID int64, ok bool) {
-	parts := strings.Split(token, ".")
-	if len(parts) != 2 {
-		return "", 0, false
-	}
-	payloadBytes, _ := base64.URLEncoding.DecodeString(parts[0])
-	sigBytes, _ := base64.URLEncoding.DecodeString(parts[1])
-	mac := hmac.New(sha256.New, secretKey)
-	mac.Write(payloadBytes)
-	if !hmac.Equal(mac.Sum(nil), sigBytes) {
+// validateLegacyUserToken accepts the v1 "email|tenantID|exp" payload of /register. The caller
+// checks that the tenant ID is the one of the request.
+func validateLegacyUserToken(token string) (email string, tenantID int64, ok bool) {
+	payloadBytes, ok := verify(token)
+	if !ok {
 		return "", 0, false
 	}
 
@@ -85,5 +382,6 @@ func ValidateUserToken(token string) (email string, tenantID int64, ok bool) {
 	if err != nil || err2 != nil || time.Now().Unix() > exp {
 		return "", 0, false
 	}
+	slog.Warn("[TOKEN] Accepted legacy v1 user token")
 	return email, id, true
 }
@@ -0,0 +1,120 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+)
+
+// retryDelays spaces the attempts of a delivery; it is given up once they are exhausted.
+var retryDelays = []time.Duration{
+	time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour, 24 * time.Hour,
+}
+
+// deliveryBatch bounds the deliveries attempted by one DeliverDue call.
+const deliveryBatch = 50
+
+// errPrivateTarget is returned when an endpoint resolves to an address of the server's own network.
+var errPrivateTarget = errors.New("webhooks: endpoint resolves to a private address")
+
+// Deliverer posts queued deliveries to their endpoints.
+type Deliverer struct {
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+// NewDeliverer returns a Deliverer whose attempts time out after timeout. Unless allowPrivate is set,
+// it refuses to connect to loopback, private and link-local addresses, whatever the endpoint host
+// resolves to, so that tenants cannot use webhooks to reach internal services.
+func NewDeliverer(timeout time.Duration, allowPrivate bool) *Deliverer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return errPrivateTarget
+			}
+			return nil
+		}
+	}
+	return &Deliverer{
+		Timeout: timeout,
+		Client: &http.Client{
+			Transport: &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+			// A redirect is reported as a failed attempt rather than followed to another host
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// DeliverDue attempts the deliveries that are due, one after the other.
+func (d *Deliverer) DeliverDue(ctx context.Context) {
+	due, err := models.ClaimDueWebhookDeliveries(ctx, deliveryBatch, 2*d.Timeout+time.Minute)
+	if err != nil {
+		slog.Error("[WEBHOOK] Failed to load due deliveries", "err", err)
+		return
+	}
+	for _, del := range due {
+		d.attempt(ctx, del)
+	}
+}
+
+// attempt posts one delivery and records its outcome, scheduling the next retry on failure.
+func (d *Deliverer) attempt(ctx context.Context, del models.WebhookDelivery) {
+	code, err := d.post(ctx, del)
+	status, next, errMsg := models.WebhookDelivered, time.Now(), ""
+	if err != nil {
+		errMsg = err.Error()
+		if del.Attempts < len(retryDelays) {
+			status, next = models.WebhookPending, time.Now().Add(retryDelays[del.Attempts])
+		} else {
+			status = models.WebhookFailed
+		}
+		slog.Warn("[WEBHOOK] Delivery attempt failed", "delivery_id", del.ID, "event", del.Event,
+			"attempt", del.Attempts+1, "status", status, "err", err)
+	} else {
+		slog.Info("[WEBHOOK] Delivered", "delivery_id", del.ID, "event", del.Event, "code", code)
+	}
+	if err := models.RecordWebhookAttempt(ctx, del.ID, status, code, errMsg, next); err != nil {
+		slog.Error("[WEBHOOK] Failed to record attempt", "delivery_id", del.ID, "err", err)
+	}
+}
+
+func (d *Deliverer) post(ctx context.Context, del models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tenkit-webhooks/1")
+	req.Header.Set("X-Tenkit-Event", del.Event)
+	req.Header.Set("X-Tenkit-Delivery", strconv.FormatInt(del.ID, 10))
+	req.Header.Set("X-Tenkit-Signature", Sign(del.Secret, time.Now(), body))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,133 @@
+// Package webhooks delivers tenant events to the HTTP endpoints registered by tenants and by the
+// platform. Events are queued in the database by Emit, which Forward calls for the bus events, and
+// posted by a Deliverer, signed with the endpoint secret and retried with backoff until they are
+// acknowledged with a 2xx response.
+//
+// Deliveries carry an X-Tenkit-Signature: t=<unix>,v1=<hex> header, the HMAC-SHA256 of
+// "<unix>.<body>" keyed with the endpoint secret. Private and loopback addresses are refused
+// unless WEBHOOK_ALLOW_PRIVATE is set.
+//
+//	webhooks.Emit(ctx, tenantID, "invoice.paid", map[string]any{"id": inv.ID})
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant/events"
+)
+
+// Events delivered to endpoints. They are published on the event bus by tenkit; applications may
+// emit their own event names too.
+const (
+	TenantCreated       = events.TenantCreated
+	TenantSuspended     = events.TenantSuspended
+	TenantReactivated   = events.TenantReactivated
+	TenantDeleted       = events.TenantDeleted
+	TenantPurged        = events.TenantPurged
+	UserConfirmed       = events.UserConfirmed
+	MemberInvited       = events.MemberInvited
+	MemberCreated       = events.MemberCreated
+	MemberRoleChanged   = events.MemberRoleChanged
+	SubscriptionUpdated = events.SubscriptionUpdated
+	Ping                = "ping" // Sent on demand to test an endpoint; never subscribed to
+)
+
+// Events lists the events endpoints can subscribe to, in display order.
+var Events = []string{
+	TenantCreated, TenantSuspended, TenantReactivated, TenantDeleted, TenantPurged,
+	UserConfirmed, MemberInvited, MemberCreated, MemberRoleChanged, SubscriptionUpdated,
+}
+
+// ValidEvent reports whether an endpoint can subscribe to event.
+func ValidEvent(event string) bool {
+	return slices.Contains(Events, event)
+}
+
+// Payload is the JSON body posted to endpoints.
+type Payload struct {
+	ID        string    `json:"id"` // Same for every endpoint receiving the event, to deduplicate
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	TenantID  int64     `json:"tenant_id,omitempty"`
+	Data      any       `json:"data"`
+}
+
+// Emit queues an event of a tenant for its endpoints and the platform ones. Like models.LogAudit,
+// failures are logged rather than returned so that the action the event reports is never undone.
+func Emit(ctx context.Context, tenantID int64, event string, data any) {
+	endpoints, err := models.WebhookEndpointsFor(ctx, tenantID, event)
+	if err != nil {
+		slog.ErrorContext(ctx, "[WEBHOOK] Failed to load endpoints", "event", event, "tenant_id", tenantID, "err", err)
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+	if err := enqueue(ctx, endpoints, tenantID, event, data); err != nil {
+		slog.ErrorContext(ctx, "[WEBHOOK] Failed to queue event", "event", event, "tenant_id", tenantID, "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "[WEBHOOK] Event queued", "event", event, "tenant_id", tenantID, "endpoints", len(endpoints))
+}
+
+// SendPing queues a ping event for a single endpoint, to check that it receives and verifies deliveries.
+func SendPing(ctx context.Context, e models.WebhookEndpoint) error {
+	return enqueue(ctx, []models.WebhookEndpoint{e}, e.TenantID, Ping, map[string]any{"endpoint_id": e.ID})
+}
+
+func enqueue(ctx context.Context, endpoints []models.WebhookEndpoint, tenantID int64, event string, data any) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	body, err := json.Marshal(Payload{
+		ID:        "evt_" + hex.EncodeToString(id),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		TenantID:  tenantID,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	deliveries := make([]models.WebhookDelivery, 0, len(endpoints))
+	for _, e := range endpoints {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID: e.ID,
+			TenantID:   tenantID,
+			Event:      event,
+			Payload:    string(body),
+		})
+	}
+	return models.EnqueueWebhookDeliveries(ctx, deliveries)
+}
+
+// Forward queues the bus events endpoints can subscribe to; register it with
+// events.Subscribe(events.All, webhooks.Forward).
+func Forward(ctx context.Context, e events.Event) {
+	if !ValidEvent(e.Name) {
+		return
+	}
+	Emit(ctx, e.TenantID, e.Name, e.Data)
+}
+
+// Sign returns the X-Tenkit-Signature header of a body sent at t: "t=<unix seconds>,v1=<hex>", where
+// v1 is the HMAC-SHA256 of "<unix seconds>.<body>" keyed with the endpoint secret. Receivers recompute
+// it and reject old timestamps to defeat replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
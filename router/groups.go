@@ -0,0 +1,28 @@
+package router
+
+import (
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+)
+
+// Groups are the standard route groups of a tenkit application.
+type Groups struct {
+	Public   *Router // Every host
+	Tenant   *Router // Tenant hosts only; 404 on the root domain
+	Auth     *Router // Logged-in users of the tenant
+	Admin    *Router // Tenant admins: Config.Roles.Admin and higher ranked roles
+	Platform *Router // Platform admins listed in TENKIT_PLATFORM_ADMINS, on any host
+}
+
+// StandardGroups derives the standard groups from rt.
+func StandardGroups(rt *Router, cfg *multitenant.Config) Groups {
+	tenant := rt.With(middleware.RequireTenant)
+	auth := tenant.With(middleware.RequireAuth)
+	return Groups{
+		Public:   rt,
+		Tenant:   tenant,
+		Auth:     auth,
+		Admin:    auth.With(middleware.RequireMinRole(cfg, cfg.Roles.Admin)),
+		Platform: rt.With(middleware.RequirePlatformAdmin(cfg)),
+	}
+}
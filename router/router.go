@@ -0,0 +1,166 @@
+// Package router is a thin layer over http.ServeMux: method-aware registration with Go 1.22 patterns,
+// route groups sharing a path prefix and middleware, and named routes for URL generation.
+//
+//	rt := router.New(http.NewServeMux())
+//	g := router.StandardGroups(rt, cfg) // Public, Tenant, Auth, Admin and Platform
+//	g.Auth.Get("/groups/{id}", showGroup).Name("group")
+//	rt.URL("group", "id", "5") // /groups/5
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a handler, e.g. middleware.RequireAuth.
+type Middleware func(http.Handler) http.Handler
+
+// Router registers routes on a ServeMux. Groups derived from it share the mux and the route names.
+type Router struct {
+	mux    *http.ServeMux
+	prefix string
+	mw     []Middleware
+	names  *names
+}
+
+// names maps route names to their path patterns, e.g. "group" to "/groups/{id}".
+type names struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}
+
+// New returns a router registering on mux.
+func New(mux *http.ServeMux) *Router {
+	return &Router{mux: mux, names: &names{paths: map[string]string{}}}
+}
+
+// ServeHTTP serves the request with the underlying mux.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Mux returns the underlying mux, for registrations outside the router.
+func (rt *Router) Mux() *http.ServeMux {
+	return rt.mux
+}
+
+// Group returns a router whose routes get prefix prepended to their paths and run through mw,
+// after the middleware of rt. The first middleware runs first.
+func (rt *Router) Group(prefix string, mw ...Middleware) *Router {
+	return &Router{
+		mux:    rt.mux,
+		prefix: rt.prefix + strings.TrimSuffix(prefix, "/"),
+		mw:     append(append([]Middleware{}, rt.mw...), mw...),
+		names:  rt.names,
+	}
+}
+
+// With returns a group without prefix running mw.
+func (rt *Router) With(mw ...Middleware) *Router {
+	return rt.Group("", mw...)
+}
+
+// Route is a registered route, to be named.
+type Route struct {
+	Methods []string // Empty for every method
+	Path    string   // Full path pattern, e.g. "/groups/{id}"
+	names   *names
+}
+
+// Name names the route for URL. Names are unique; naming two routes alike panics.
+func (r *Route) Name(name string) *Route {
+	r.names.mu.Lock()
+	defer r.names.mu.Unlock()
+	if existing, ok := r.names.paths[name]; ok && existing != r.Path {
+		panic(fmt.Sprintf("router: route name %q used for %s and %s", name, existing, r.Path))
+	}
+	r.names.paths[name] = r.Path
+	return r
+}
+
+// Handle registers h for the given methods at path; no method matches them all. GET also serves HEAD.
+func (rt *Router) Handle(methods []string, path string, h http.Handler) *Route {
+	path = rt.prefix + path
+	for i := len(rt.mw) - 1; i >= 0; i-- {
+		h = rt.mw[i](h)
+	}
+	if len(methods) == 0 {
+		rt.mux.Handle(path, h)
+	}
+	for _, m := range methods {
+		rt.mux.Handle(m+" "+path, h)
+	}
+	return &Route{Methods: methods, Path: path, names: rt.names}
+}
+
+// Any registers h for every method at path.
+func (rt *Router) Any(path string, h http.Handler) *Route {
+	return rt.Handle(nil, path, h)
+}
+
+// Get registers h for GET (and HEAD) at path.
+func (rt *Router) Get(path string, h http.Handler) *Route {
+	return rt.Handle([]string{http.MethodGet}, path, h)
+}
+
+// Post registers h for POST at path.
+func (rt *Router) Post(path string, h http.Handler) *Route {
+	return rt.Handle([]string{http.MethodPost}, path, h)
+}
+
+// Delete registers h for DELETE at path.
+func (rt *Router) Delete(path string, h http.Handler) *Route {
+	return rt.Handle([]string{http.MethodDelete}, path, h)
+}
+
+// Form registers a page rendered on GET and submitted with POST; other methods get 405.
+func (rt *Router) Form(path string, h http.Handler) *Route {
+	return rt.Handle([]string{http.MethodGet, http.MethodPost}, path, h)
+}
+
+// URL returns the path of the named route with its wildcards replaced by params, given as
+// name/value pairs: URL("group", "id", "5") returns "/groups/5". Values are path-escaped, except
+// for trailing "{name...}" wildcards whose slashes are kept.
+func (rt *Router) URL(name string, params ...string) (string, error) {
+	rt.names.mu.RLock()
+	path, ok := rt.names.paths[name]
+	rt.names.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("router: unknown route %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("router: odd number of params for route %q", name)
+	}
+	path = strings.TrimSuffix(path, "{$}")
+	for i := 0; i < len(params); i += 2 {
+		key, value := params[i], params[i+1]
+		switch {
+		case strings.Contains(path, "{"+key+"...}"):
+			segments := strings.Split(value, "/")
+			for j, s := range segments {
+				segments[j] = url.PathEscape(s)
+			}
+			path = strings.Replace(path, "{"+key+"...}", strings.Join(segments, "/"), 1)
+		case strings.Contains(path, "{"+key+"}"):
+			path = strings.Replace(path, "{"+key+"}", url.PathEscape(value), 1)
+		default:
+			return "", fmt.Errorf("router: route %q has no parameter %q", name, key)
+		}
+	}
+	if strings.Contains(path, "{") {
+		return "", fmt.Errorf("router: missing parameters for route %q (%s)", name, path)
+	}
+	return path, nil
+}
+
+// MustURL is URL for names and params known to be valid; it panics otherwise.
+func (rt *Router) MustURL(name string, params ...string) string {
+	u, err := rt.URL(name, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
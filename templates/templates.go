@@ -0,0 +1,11 @@
+// Package templates embeds the built-in page templates. They are rendered through render.Engine,
+// which lets applications override any of them with a file of the same name.
+package templates
+
+import "embed"
+
+// FS holds the layouts (base.html, header.html, meta.html, pager.html, notifications_menu.html,
+// challenge.html) and the page templates.
+//
+//go:embed *.html
+var FS embed.FS
@@ -0,0 +1,746 @@
+// Package tenkit assembles a multi-tenant application from the packages of this module. New wires
+// the translations, database, templates, tenant resolution, built-in routes and middleware chain
+// in the order they depend on each other, and options replace any of those pieces:
+//
+//	app, err := tenkit.New(cfg, tenkit.WithStatic(static), tenkit.WithMailer(sender))
+//	if err != nil { ... }
+//	app.Router.Get("/pricing", pricingHandler)
+//	app.Start(ctx)
+//	err = app.ListenAndServe(ctx)
+package tenkit
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pandamasta/tenkit/db"
+	"github.com/pandamasta/tenkit/handlers"
+	"github.com/pandamasta/tenkit/internal/i18n"
+	"github.com/pandamasta/tenkit/internal/render"
+	"github.com/pandamasta/tenkit/models"
+	"github.com/pandamasta/tenkit/multitenant"
+	"github.com/pandamasta/tenkit/multitenant/assets"
+	"github.com/pandamasta/tenkit/multitenant/cache"
+	"github.com/pandamasta/tenkit/multitenant/certs"
+	"github.com/pandamasta/tenkit/multitenant/challenge"
+	"github.com/pandamasta/tenkit/multitenant/crypto"
+	tkerrors "github.com/pandamasta/tenkit/multitenant/errors"
+	"github.com/pandamasta/tenkit/multitenant/events"
+	"github.com/pandamasta/tenkit/multitenant/features"
+	"github.com/pandamasta/tenkit/multitenant/forms"
+	"github.com/pandamasta/tenkit/multitenant/jobs"
+	"github.com/pandamasta/tenkit/multitenant/limits"
+	"github.com/pandamasta/tenkit/multitenant/mail"
+	"github.com/pandamasta/tenkit/multitenant/maintenance"
+	"github.com/pandamasta/tenkit/multitenant/metering"
+	"github.com/pandamasta/tenkit/multitenant/metrics"
+	"github.com/pandamasta/tenkit/multitenant/middleware"
+	"github.com/pandamasta/tenkit/multitenant/notify"
+	"github.com/pandamasta/tenkit/multitenant/openapi"
+	"github.com/pandamasta/tenkit/multitenant/ratelimit"
+	"github.com/pandamasta/tenkit/multitenant/realtime"
+	"github.com/pandamasta/tenkit/multitenant/redirect"
+	"github.com/pandamasta/tenkit/multitenant/search"
+	"github.com/pandamasta/tenkit/multitenant/secrets"
+	"github.com/pandamasta/tenkit/multitenant/storage"
+	"github.com/pandamasta/tenkit/multitenant/webhooks"
+	"github.com/pandamasta/tenkit/router"
+	"github.com/pandamasta/tenkit/templates"
+)
+
+// App is an assembled application. It serves HTTP through the canonical middleware chain; routes
+// added to Router or Groups after New are served as well.
+type App struct {
+	Config    *multitenant.Config
+	I18n      *i18n.I18n
+	Templates *render.Engine
+	Store     storage.Store
+	Resolver  multitenant.TenantResolver
+	Fetcher   multitenant.TenantFetcher
+	Limiter   ratelimit.Limiter
+	Router    *router.Router
+	Groups    router.Groups
+
+	handler    http.Handler
+	mailer     mail.Sender
+	secrets    *secrets.Cache
+	reporter   tkerrors.Reporter
+	search     search.Backend
+	locales    []fs.FS
+	templates  []fs.FS
+	static     fs.FS
+	middleware []func(http.Handler) http.Handler
+	overrides  map[string]http.Handler // Handlers of default routes, by route name
+	rateLimits *ratelimit.RuleSet
+	ctx        context.Context // Of Start, for the watchers restarted on reloads
+	stopWatch  context.CancelFunc
+}
+
+// Option changes how New assembles the application.
+type Option func(*App)
+
+// WithResolver replaces the resolver chain built from the configuration (custom domain or
+// subdomain, then TENANT_HEADER and TENANT_PATH_PREFIX).
+func WithResolver(r multitenant.TenantResolver) Option {
+	return func(a *App) { a.Resolver = r }
+}
+
+// WithFetcher replaces the database fetcher and its TENANT_CACHE_SIZE cache; f is used as it is.
+func WithFetcher(f multitenant.TenantFetcher) Option {
+	return func(a *App) { a.Fetcher = f }
+}
+
+// WithStore replaces the storage backend of the STORAGE_* settings. It is still metered, so that
+// tenant storage counts against their plan.
+func WithStore(s storage.Store) Option {
+	return func(a *App) { a.Store = s }
+}
+
+// WithMailer replaces the transport of mail.Default, the SMTP relay of SMTP_ADDR or the log in dev.
+func WithMailer(s mail.Sender) Option {
+	return func(a *App) { a.mailer = s }
+}
+
+// WithSecrets refreshes the secrets of c in the background once started, and installs a rotated
+// TENKIT_SECRET as the signing key. Apply c to the configuration before validating it.
+func WithSecrets(c *secrets.Cache) Option {
+	return func(a *App) { a.secrets = c }
+}
+
+// WithReporter sends panics and 5xx responses to r instead of the Sentry reporter of SENTRY_DSN.
+func WithReporter(r tkerrors.Reporter) Option {
+	return func(a *App) { a.reporter = r }
+}
+
+// WithSearch replaces the search backend of SEARCH_BACKEND, e.g. with search.NewPostgres.
+func WithSearch(b search.Backend) Option {
+	return func(a *App) { a.search = b }
+}
+
+// WithLimiter replaces the rate limiter of the RATE_LIMIT_* settings.
+func WithLimiter(l ratelimit.Limiter) Option {
+	return func(a *App) { a.Limiter = l }
+}
+
+// WithLocales adds translation files over the built-in ones; the files of TENKIT_LOCALES still win.
+func WithLocales(fsys ...fs.FS) Option {
+	return func(a *App) { a.locales = append(a.locales, fsys...) }
+}
+
+// WithTemplates adds templates over the built-in ones, e.g. an application's embed.FS; the files
+// of TEMPLATES_DIR still win.
+func WithTemplates(fsys ...fs.FS) Option {
+	return func(a *App) { a.templates = append(a.templates, fsys...) }
+}
+
+// WithStatic serves fsys under /static/ with content-hashed names, linked with {{ asset "..." }}.
+func WithStatic(fsys fs.FS) Option {
+	return func(a *App) { a.static = fsys }
+}
+
+// WithMiddleware wraps the routes in mw, inside the built-in middleware: requests reaching it have
+// their language, session, tenant and user. The first middleware is the outermost.
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(a *App) { a.middleware = append(a.middleware, mw...) }
+}
+
+// WithHandler serves a default route with h instead of its built-in handler, by route name, e.g.
+// "home" or "dashboard". Flows are disabled with ROUTES_DISABLED instead.
+func WithHandler(name string, h http.Handler) Option {
+	return func(a *App) { a.overrides[name] = h }
+}
+
+// New assembles the application for cfg, which must be validated. It sets the package-level hooks
+// of the middleware, forms and render packages, so a process runs a single App.
+func New(cfg *multitenant.Config, opts ...Option) (*App, error) {
+	a := &App{Config: cfg, overrides: map[string]http.Handler{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	// Step 1: Translations
+	tr, err := i18n.New(cfg.I18n.DefaultLang)
+	if err != nil {
+		return nil, fmt.Errorf("i18n: %w", err)
+	}
+	slog.Info("[LANG] Loading locales", "path", cfg.I18n.LocalesPath)
+	if err := tr.Load(a.localeSources()...); err != nil {
+		return nil, fmt.Errorf("i18n: %w", err)
+	}
+	a.I18n = tr
+	middleware.ErrorMessages = tr
+	forms.Messages = tr
+	forms.CSRFFieldName = cfg.CSRF.FieldName
+	render.Config = cfg
+	limits.DefaultPlan = cfg.Tenants.DefaultPlan
+
+	// Step 2: Database, cache, storage, search and the live updates hub
+	if db.DB == nil {
+		db.DSN = cfg.Database.DSN
+		db.Init()
+	}
+	crypto.Configure(cfg)
+	c, err := cache.New(cfg.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	cache.SetCache(c)
+	cache.SessionTTL, cache.TenantTTL = cfg.Cache.SessionTTL, cfg.TenantCache.TTL
+	cache.Watch()
+	if a.Store == nil {
+		if a.Store, err = storage.New(cfg.Storage); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+	}
+	a.Store = storage.Metered(a.Store)
+	if a.search == nil {
+		if a.search, err = search.New(context.Background(), cfg.Search); err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+	}
+	search.SetBackend(a.search)
+	search.Register(search.MemberSource(cfg))
+	if cfg.Routes.Enabled(multitenant.FlowRealtime) {
+		hub, err := realtime.New(cfg.Realtime)
+		if err != nil {
+			return nil, fmt.Errorf("realtime: %w", err)
+		}
+		realtime.SetHub(hub)
+	}
+
+	// Step 3: Events: lifecycle transitions are published on the bus, and the bus feeds the webhooks,
+	// the search index, the notifications and the live updates. Applications attach their own behavior
+	// with events.Subscribe.
+	models.OnTenantTransition(events.OnTransition)
+	events.Subscribe(events.All, webhooks.Forward)
+	events.Subscribe(events.All, search.Forward)
+	if cfg.Routes.Enabled(multitenant.FlowNotifications) {
+		events.Subscribe(events.All, notify.Forward)
+	}
+	if realtime.Current() != nil {
+		events.Subscribe(events.All, realtime.Forward(cfg))
+	}
+
+	// Step 4: Rate limiting, shared through Redis when several instances run
+	if a.Limiter == nil {
+		if a.Limiter, err = ratelimit.New(cfg.RateLimit); err != nil {
+			return nil, fmt.Errorf("rate limit: %w", err)
+		}
+	}
+	rateLimits, err := ratelimit.ParseRules(cfg.RateLimit.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMITS: %w", err)
+	}
+	a.rateLimits = ratelimit.NewRuleSet(rateLimits)
+
+	// Step 5: Feature flags and maintenance windows: the configured ones, then those set by operators
+	if err := features.Configure(cfg.FeatureFlags); err != nil {
+		return nil, err
+	}
+	if err := features.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	maintenance.Configure(cfg.Maintenance)
+	if err := maintenance.Load(context.Background()); err != nil {
+		return nil, err
+	}
+	redirect.Configure(cfg.Security.RedirectHosts)
+
+	// Step 6: Mail: log messages in dev unless an SMTP relay is configured
+	mail.Default.PlatformFrom = cfg.Mail.From
+	switch {
+	case a.mailer != nil:
+		mail.Default.Transport = a.mailer
+	case cfg.Mail.SMTPAddr != "":
+		mail.Default.Transport = &mail.SMTPSender{
+			Addr:     cfg.Mail.SMTPAddr,
+			Username: cfg.Mail.SMTPUser,
+			Password: cfg.Mail.SMTPPassword,
+		}
+	}
+
+	// Step 7: Templates: the built-in ones, the application's, then the files of TEMPLATES_DIR
+	tcfg := cfg.Templates
+	tcfg.Dir = ""
+	a.Templates = render.NewEngine(tcfg, templates.FS)
+	for _, fsys := range a.templates {
+		a.Templates.Override(fsys)
+	}
+	if cfg.Templates.Dir != "" {
+		a.Templates.Override(os.DirFS(cfg.Templates.Dir))
+	}
+	middleware.ErrorPage = handlers.ErrorPage(cfg, tr, handlers.InitErrorTemplates(a.Templates))
+
+	// Step 8: Tenant resolution: custom domain or subdomain, then the optional proxy header and path prefix
+	if a.Resolver == nil {
+		resolver := multitenant.ChainResolver{multitenant.CustomDomainResolver{Config: cfg}}
+		if cfg.Server.TenantHeader != "" {
+			resolver = append(resolver, multitenant.HeaderResolver{Header: cfg.Server.TenantHeader, Trusted: middleware.TrustedProxy(cfg)})
+		}
+		if cfg.Server.TenantPathPrefix != "" {
+			resolver = append(resolver, multitenant.PathPrefixResolver{Prefix: cfg.Server.TenantPathPrefix})
+		}
+		a.Resolver = resolver
+	}
+	if a.Fetcher == nil {
+		a.Fetcher = multitenant.DBFetcher{DB: db.DB}
+		if cfg.Cache.Backend == "redis" {
+			// Shared by the instances, behind the local cache of each
+			a.Fetcher = watchTenants(multitenant.NewCachedFetcher(a.Fetcher, cache.Current(), cfg.TenantCache))
+		}
+		if cfg.TenantCache.Size > 0 {
+			a.Fetcher = watchTenants(multitenant.NewCachedFetcher(a.Fetcher, cache.NewMemory(cfg.TenantCache.Size), cfg.TenantCache))
+		}
+	}
+
+	// Step 9: Routes, navigation and background jobs
+	a.Router = router.New(http.NewServeMux())
+	a.Groups = router.StandardGroups(a.Router, cfg)
+	if err := a.registerRoutes(); err != nil {
+		return nil, err
+	}
+	a.registerNav()
+	if err := a.registerJobs(); err != nil {
+		return nil, err
+	}
+
+	// Step 10: Middleware, reporting the panics and 5xx responses of requests
+	if a.reporter == nil && cfg.Errors.SentryDSN != "" {
+		if a.reporter, err = tkerrors.NewSentry(cfg.Errors.SentryDSN, tkerrors.SentryOptions{
+			Environment: cfg.Errors.Environment,
+			Release:     cfg.Errors.Release,
+			Redact:      cfg.Log.Redact,
+		}); err != nil {
+			return nil, fmt.Errorf("SENTRY_DSN: %w", err)
+		}
+	}
+	if a.reporter != nil {
+		tkerrors.SetReporter(a.reporter)
+	}
+	if err := a.buildHandler(); err != nil {
+		return nil, err
+	}
+
+	// Step 11: Settings and secrets changed at runtime
+	multitenant.OnConfigChange(a.configChanged)
+	if a.secrets != nil {
+		secrets.RotateSigningKey(a.secrets, cfg)
+	}
+	return a, nil
+}
+
+// localeSources returns the translation files: built in, the application's, then TENKIT_LOCALES.
+func (a *App) localeSources() []fs.FS {
+	locales := append([]fs.FS{i18n.Builtin}, a.locales...)
+	if a.Config.I18n.LocalesPath != "" {
+		locales = append(locales, os.DirFS(a.Config.I18n.LocalesPath))
+	}
+	return locales
+}
+
+// configChanged applies reloaded settings. Invalid values are logged and the previous ones kept.
+func (a *App) configChanged(ctx context.Context, change multitenant.ConfigChange) {
+	cfg := change.Config
+	if change.Has("RATE_LIMITS") {
+		if rules, err := ratelimit.ParseRules(cfg.RateLimit.Rules); err != nil {
+			slog.ErrorContext(ctx, "[RATELIMIT] Invalid RATE_LIMITS, keeping the previous rules", "err", err)
+		} else {
+			a.rateLimits.Store(rules)
+		}
+	}
+	if change.Has("FEATURE_FLAGS") {
+		if err := features.Configure(cfg.FeatureFlags); err != nil {
+			slog.ErrorContext(ctx, "[FEATURES] Invalid FEATURE_FLAGS, keeping the previous flags", "err", err)
+		}
+	}
+	if change.Has("MAINTENANCE_MODE") || change.Has("MAINTENANCE_TENANTS") || change.Has("MAINTENANCE_MESSAGE") || change.Has("MAINTENANCE_RETRY_AFTER") {
+		maintenance.Configure(cfg.Maintenance)
+	}
+	if change.Has("REDIRECT_ALLOWED_HOSTS") {
+		redirect.Configure(cfg.Security.RedirectHosts)
+	}
+	if change.Has("TENKIT_LOCALES") {
+		if err := a.I18n.Load(a.localeSources()...); err != nil {
+			slog.ErrorContext(ctx, "[LANG] Failed to load the new locales, keeping the previous translations", "path", cfg.I18n.LocalesPath, "err", err)
+			return
+		}
+		a.watchLocales()
+	}
+}
+
+// watchLocales watches the files of TENKIT_LOCALES with I18N_WATCH, in place of the previous
+// directory once Start has run.
+func (a *App) watchLocales() {
+	if a.ctx == nil {
+		return
+	}
+	if a.stopWatch != nil {
+		a.stopWatch()
+		a.stopWatch = nil
+	}
+	if cfg := a.Config; cfg.I18n.Watch && cfg.I18n.LocalesPath != "" {
+		ctx, cancel := context.WithCancel(a.ctx)
+		a.stopWatch = cancel
+		go a.I18n.Watch(ctx, cfg.I18n.LocalesPath, 2*time.Second)
+	}
+}
+
+// ServeHTTP serves r through the middleware chain.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.ServeHTTP(w, r)
+}
+
+// route returns the handler of the default route name: the one of WithHandler, or h.
+func (a *App) route(name string, h http.Handler) http.Handler {
+	if o, ok := a.overrides[name]; ok {
+		return o
+	}
+	return h
+}
+
+// registerRoutes registers the built-in routes.
+func (a *App) registerRoutes() error {
+	cfg, tr, rt, groups := a.Config, a.I18n, a.Router, a.Groups
+
+	// Static files, served under content-hashed names ({{ asset "..." }} in templates)
+	if a.static != nil {
+		static, err := assets.New(a.static, "/static/")
+		if err != nil {
+			return fmt.Errorf("static files: %w", err)
+		}
+		render.Assets = static
+		rt.Get("/static/", static).Name("static")
+	}
+
+	rt.Get("/metrics", a.route("metrics", metrics.Handler(cfg.Metrics.Token))).Name("metrics")
+	rt.Get("/healthz", a.route("healthz", handlers.HealthHandler())).Name("healthz")
+	rt.Get("/favicon.ico", a.route("favicon", handlers.FaviconHandler(cfg))).Name("favicon")
+	rt.Get("/manifest.webmanifest", a.route("manifest", handlers.ManifestHandler(cfg))).Name("manifest")
+	rt.Get("/branding/theme.css", a.route("branding.theme", handlers.ThemeCSSHandler())).Name("branding.theme")
+	rt.Get("/branding/logo", a.route("branding.logo", handlers.LogoHandler(a.Store))).Name("branding.logo")
+	if cfg.Storage.Backend == "" || cfg.Storage.Backend == "local" {
+		rt.Get(strings.TrimSuffix(cfg.Storage.LocalURLPrefix, "/")+"/{key...}", a.route("file", handlers.FileHandler(a.Store))).Name("file")
+	}
+
+	mainTmpl, tenantTmpl := handlers.InitHomeTemplates(a.Templates)
+	rt.Any("/", a.route("home", handlers.HomeHandler(tr, mainTmpl, tenantTmpl))).Name("home")
+	rt.Get("/lang", a.route("lang", handlers.LangHandler(cfg, tr))).Name("lang")
+	rt.With(middleware.RequireAuth).Get("/dashboard", a.route("dashboard", handlers.DashboardHandler(tr, mainTmpl, tenantTmpl))).Name("dashboard")
+	rt.Get("/qr.png", a.route("qr", handlers.QRHandler(cfg))).Name("qr")
+
+	// Signup and login are screened against the IP reputation lists, and suspicious sources are
+	// challenged with a CAPTCHA
+	reputation, err := multitenant.LoadListReputation(cfg.Security.IPBlocklist, cfg.Security.IPChallengelist)
+	if err != nil {
+		return fmt.Errorf("IP reputation lists: %w", err)
+	}
+	guard, err := challenge.NewGuard(cfg.Challenge)
+	if err != nil {
+		return err
+	}
+	challenge.SetGuard(guard)
+	deniedTmpl := handlers.InitDeniedTemplates(a.Templates)
+	flows := &handlers.App{
+		Config:    cfg,
+		I18n:      tr,
+		Store:     a.Store,
+		Templates: a.Templates,
+		Screen: func(h http.Handler) http.Handler {
+			return middleware.ReputationGuard(reputation, handlers.ReputationBlockedHandler(tr, deniedTmpl), h)
+		},
+	}
+
+	// Built-in flows; ROUTES_DISABLED leaves some out, e.g. "enroll,register" for an invite-only platform
+	flows.RegisterAuthRoutes(rt)
+	flows.RegisterTenantRoutes(rt)
+	flows.RegisterAPIRoutes(rt)
+
+	// Platform administration
+	groups.Platform.Form("/admin/features", a.route("admin.features", handlers.FeaturesHandler(tr, handlers.InitFeatureTemplates(a.Templates)))).Name("admin.features")
+	groups.Platform.Form("/admin/legal-holds", a.route("admin.legal_holds", handlers.LegalHoldHandler(tr, handlers.InitLegalHoldTemplates(a.Templates)))).Name("admin.legal_holds")
+	groups.Platform.Form("/admin/tenants", a.route("admin.tenants", handlers.TenantAdminHandler(cfg, tr, handlers.InitTenantAdminTemplates(a.Templates)))).Name("admin.tenants")
+	groups.Platform.Form("/admin/impersonate", a.route("admin.impersonate", handlers.ImpersonateStartHandler(cfg, tr, handlers.InitImpersonateTemplates(a.Templates)))).Name("admin.impersonate")
+	groups.Platform.Post("/admin/i18n/reload", a.route("admin.i18n_reload", handlers.I18nReloadHandler(tr))).Name("admin.i18n_reload")
+	groups.Platform.Get("/admin/support", a.route("admin.support", handlers.SupportLookupHandler(tr, handlers.InitSupportTemplates(a.Templates)))).Name("admin.support")
+	groups.Platform.Get("/admin/usage", a.route("admin.usage", handlers.UsageReportHandler(tr, handlers.InitUsageTemplates(a.Templates)))).Name("admin.usage")
+	groups.Platform.Form("/admin/webhooks", a.route("admin.webhooks", handlers.WebhooksHandler(cfg, tr, handlers.InitWebhookTemplates(a.Templates)))).Name("admin.webhooks")
+	rt.Get("/impersonate", a.route("impersonate", handlers.ImpersonateHandler(cfg))).Name("impersonate")
+	rt.Post("/impersonate/stop", a.route("impersonate.stop", handlers.StopImpersonationHandler(cfg))).Name("impersonate.stop")
+
+	// Background reports offered on /settings/reports
+	handlers.RegisterReport(handlers.MemberReport)
+	handlers.RegisterReport(handlers.AuditReport)
+
+	// Public API, authenticated by tenant API keys instead of sessions and CSRF tokens
+	cfg.CSRF.ExemptPaths = append(cfg.CSRF.ExemptPaths, "/api/")
+	rt.Any("/api/v1/whoami", middleware.APIKeyAuth(cfg, a.Limiter, a.route("api.whoami", handlers.APIWhoAmIHandler()))).Name("api.whoami")
+	openapi.Register(handlers.WhoAmIOperation)
+	rt.Post("/api/v1/tenants", a.route("api.provisionTenant", handlers.ProvisionHandler(cfg))).Name("api.provisionTenant")
+	openapi.Register(handlers.ProvisionOperation)
+	rt.Form("/api/v1/maintenance", a.route("api.maintenance", handlers.MaintenanceAPIHandler(cfg))).Name("api.maintenance")
+	openapi.Register(handlers.MaintenanceStatusOperation)
+	openapi.Register(handlers.MaintenanceSwitchOperation)
+
+	// Inbound email, dispatched to the mailboxes of mail.Inbound
+	cfg.CSRF.ExemptPaths = append(cfg.CSRF.ExemptPaths, "/webhooks/")
+	rt.Post("/webhooks/mail/mailgun", a.route("webhooks.mailgun", handlers.InboundMailgunHandler(cfg, a.Fetcher))).Name("webhooks.mailgun")
+	rt.Post("/webhooks/mail/ses", a.route("webhooks.ses", handlers.InboundSESHandler(cfg, a.Fetcher))).Name("webhooks.ses")
+
+	// Tenant settings editable at /settings/general
+	multitenant.RegisterSetting(multitenant.SettingDef{Key: middleware.TenantLangSetting, LabelKey: "settings.default_lang", HelpKey: "settings.default_lang_help", Type: multitenant.SettingString})
+	multitenant.RegisterSetting(multitenant.SettingDef{Key: multitenant.IPAllowSetting, LabelKey: "settings.ip_allow", HelpKey: "settings.ip_allow_help", Type: multitenant.SettingString, Order: 50, Validate: multitenant.ValidateIPRanges})
+	multitenant.RegisterSetting(multitenant.SettingDef{Key: multitenant.IPDenySetting, LabelKey: "settings.ip_deny", HelpKey: "settings.ip_deny_help", Type: multitenant.SettingString, Order: 51, Validate: multitenant.ValidateIPRanges})
+	return nil
+}
+
+// registerNav registers the tenant navigation of the built-in pages.
+func (a *App) registerNav() {
+	cfg := a.Config
+	adminRoles := cfg.Roles.AtLeast(cfg.Roles.Admin)
+	multitenant.RegisterNav(multitenant.NavItem{ID: "home", LabelKey: "nav.home", Route: "/", Order: 0})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "dashboard", LabelKey: "nav.dashboard", Route: "/dashboard", Order: 10, RequireAuth: true})
+	if cfg.Routes.Enabled(multitenant.FlowGroups) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "groups", LabelKey: "nav.groups", Route: "/groups", Order: 20, RequireAuth: true})
+	}
+	if cfg.Routes.Enabled(multitenant.FlowSearch) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "search", LabelKey: "nav.search", Route: "/search", Order: 30, RequireAuth: true})
+	}
+	multitenant.RegisterNav(multitenant.NavItem{ID: "profile", LabelKey: "nav.profile", Route: "/account/profile", Order: 80, RequireAuth: true})
+	if cfg.Routes.Enabled(multitenant.FlowExport) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "export", LabelKey: "nav.export", Route: "/account/export", Order: 90, RequireAuth: true})
+	}
+	multitenant.RegisterNav(multitenant.NavItem{ID: "launch-settings", LabelKey: "nav.launch", Route: "/settings/launch", Order: 110, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "custom-domain", LabelKey: "nav.domain", Route: "/settings/domain", Order: 111, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "members", LabelKey: "nav.members", Route: "/settings/members", Order: 105, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "member-admin", LabelKey: "nav.member_admin", Route: "/admin/members", Order: 106, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "audit", LabelKey: "nav.audit", Route: "/admin/audit", Order: 107, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "general-settings", LabelKey: "nav.general", Route: "/settings/general", Order: 101, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "branding", LabelKey: "nav.branding", Route: "/settings/branding", Order: 102, Roles: adminRoles})
+	multitenant.RegisterNav(multitenant.NavItem{ID: "meta-settings", LabelKey: "nav.meta", Route: "/settings/meta", Order: 112, Roles: adminRoles})
+	if cfg.Routes.Enabled(multitenant.FlowReports) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "reports", LabelKey: "nav.reports", Route: "/settings/reports", Order: 115, Roles: adminRoles})
+	}
+	if cfg.Routes.Enabled(multitenant.FlowAPIKeys) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "api-keys", LabelKey: "nav.api_keys", Route: "/settings/api-keys", Order: 120, Roles: adminRoles})
+	}
+	if cfg.Routes.Enabled(multitenant.FlowWebhooks) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "webhooks", LabelKey: "nav.webhooks", Route: "/settings/webhooks", Order: 125, Roles: adminRoles})
+	}
+	if cfg.Routes.Enabled(multitenant.FlowSubTenants) {
+		multitenant.RegisterNav(multitenant.NavItem{ID: "sub-tenants", LabelKey: "nav.sub_tenants", Route: "/settings/sub-tenants", Order: 113, Roles: adminRoles})
+	}
+	multitenant.RegisterNav(multitenant.NavItem{ID: "nav-settings", LabelKey: "nav.settings", Route: "/settings/navigation", Order: 100, Roles: adminRoles})
+}
+
+// buildHandler wraps the router in the middleware chain, innermost first.
+func (a *App) buildHandler() error {
+	cfg, tr := a.Config, a.I18n
+	var handler http.Handler = a.Router
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		handler = a.middleware[i](handler)
+	}
+	handler = middleware.ComingSoon(handlers.ComingSoonHandler(tr, handlers.InitComingSoonTemplates(a.Templates)), handler)
+	handler = middleware.Preview(handler)
+	if cfg.Security.GeoIPDatabase != "" {
+		locator, err := multitenant.LoadCIDRGeoLocator(cfg.Security.GeoIPDatabase)
+		if err != nil {
+			return fmt.Errorf("GeoIP database %s: %w", cfg.Security.GeoIPDatabase, err)
+		}
+		handler = middleware.GeoRestriction(locator, handlers.GeoDeniedHandler(tr, handlers.InitDeniedTemplates(a.Templates)), handler)
+	}
+	handler = middleware.Groups(handler)
+	handler = middleware.Metering(handler)
+	handler = middleware.Suspended(handlers.SuspendedHandler(tr, handlers.InitSuspendedTemplates(a.Templates)), handler)
+	handler = middleware.Maintenance(cfg, handlers.MaintenanceHandler(tr, handlers.InitMaintenanceTemplates(a.Templates)), handler)
+	handler = middleware.IPAccess(cfg, handlers.IPDeniedHandler(tr, handlers.InitDeniedTemplates(a.Templates)), handler)
+	handler = middleware.RateLimitSet(a.Limiter, a.rateLimits, handler)
+	handler = middleware.PreferredLang(tr, handler)      // Once the user and the tenant are known
+	handler = middleware.SessionMiddleware(cfg, handler) // Inside the tenant, so that a session only opens on its own tenant
+	handler = middleware.TenantMiddleware(cfg, a.Resolver, a.Fetcher, handler)
+	handler = middleware.CSRFMiddleware(cfg, handler)
+	if cfg.I18n.URLPrefix {
+		handler = middleware.LangPrefix(cfg, tr, handler)
+	}
+	handler = middleware.LangMiddleware(cfg, tr, handler) // Before the tenant, so its error pages are translated
+	handler = middleware.Recover(handler)
+	handler = middleware.Logger(cfg, handler)
+	handler = middleware.RequestID(handler)
+	handler = middleware.RealIP(cfg, handler)
+	a.handler = handler
+	return nil
+}
+
+// Start runs the background jobs until ctx is done: retention and tenant purges, custom domain
+// checks, feature flags, maintenance windows, usage metering, webhook deliveries, configuration reloads, secret rotations and, with
+// I18N_WATCH, the locale watcher.
+func (a *App) Start(ctx context.Context) {
+	cfg := a.Config
+
+	// Configuration: reload settings such as RATE_LIMITS on SIGHUP or when the files change
+	go multitenant.WatchConfig(ctx, cfg, cfg.ConfigWatch)
+
+	// Secrets: pick up rotated values every SECRETS_CACHE_TTL
+	if a.secrets != nil {
+		go a.secrets.Watch(ctx)
+	}
+
+	// Translations: reload the application's locale files when they change, for translators
+	a.ctx = ctx
+	a.watchLocales()
+
+	// Feature flags: pick up the changes made by platform admins on other instances
+	go every(ctx, time.Minute, func() {
+		if err := features.Load(ctx); err != nil {
+			slog.Error("[FEATURES] Failed to load flags", "err", err)
+		}
+	})
+
+	// Maintenance: windows switched by the tenkit command or on other instances apply within seconds
+	go every(ctx, 10*time.Second, func() {
+		if err := maintenance.Load(ctx); err != nil {
+			slog.Error("[MAINTENANCE] Failed to load maintenance windows", "err", err)
+		}
+	})
+
+	// Usage metering: write the counters buffered by this instance every minute
+	go every(ctx, time.Minute, func() {
+		if err := metering.Flush(ctx); err != nil {
+			slog.Error("[METERING] Failed to flush usage", "err", err)
+		}
+	})
+
+	// Live updates: pass the messages published by every instance to the open streams
+	if hub := realtime.Current(); hub != nil {
+		go hub.Run(ctx)
+	}
+
+	// Background jobs: reports and the scheduled platform tasks of registerJobs, shared by the instances
+	if cfg.Jobs.Workers > 0 {
+		go jobs.NewRunner(cfg.Jobs).Run(ctx)
+	}
+}
+
+// DefaultJobSchedules are the schedules of the platform tasks, by job kind; JOBS_SCHEDULES overrides them.
+var DefaultJobSchedules = map[string]string{
+	"exports.purge":      "@hourly",      // Expired exports, except for tenants on legal hold
+	"tenants.purge":      "@hourly",      // Soft-deleted tenants whose grace period is over
+	"domains.verify":     "*/10 * * * *", // Pending custom domains whose DNS records are in place
+	"metering.aggregate": "@hourly",      // Active users and storage of the day
+	"webhooks.deliver":   "@every 5s",    // Queued webhook deliveries
+	"jobs.cleanup":       "@daily",       // Jobs finished more than JOBS_RETENTION ago
+}
+
+// registerJobs registers the built-in kinds of background jobs and schedules the platform tasks.
+func (a *App) registerJobs() error {
+	cfg, store := a.Config, a.Store
+	deliverer := webhooks.NewDeliverer(cfg.Webhooks.Timeout, cfg.Webhooks.AllowPrivate)
+	jobs.Register(handlers.ReportJob(store))
+	jobs.Register(jobs.Cleanup(cfg.Jobs.Retention))
+	jobs.Register(platformTask("exports.purge", 0, func(ctx context.Context) error {
+		handlers.PurgeExpiredExports(ctx, store)
+		return nil
+	}))
+	jobs.Register(platformTask("tenants.purge", 0, func(ctx context.Context) error {
+		handlers.PurgeDeletedTenants(ctx, store)
+		return nil
+	}))
+	jobs.Register(platformTask("domains.verify", 0, func(ctx context.Context) error {
+		handlers.VerifyPendingDomains(ctx, cfg)
+		return nil
+	}))
+	jobs.Register(platformTask("metering.aggregate", 0, func(ctx context.Context) error {
+		return metering.Aggregate(ctx, time.Now())
+	}))
+	// A batch of deliveries may wait for several slow endpoints in a row
+	jobs.Register(platformTask("webhooks.deliver", 15*time.Minute, func(ctx context.Context) error {
+		deliverer.DeliverDue(ctx)
+		return nil
+	}))
+
+	schedules := maps.Clone(DefaultJobSchedules)
+	for _, entry := range strings.Split(cfg.Jobs.Schedules, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		kind, spec, ok := strings.Cut(entry, "=")
+		kind = strings.TrimSpace(kind)
+		if _, known := schedules[kind]; !ok || !known {
+			return fmt.Errorf("JOBS_SCHEDULES: invalid entry %q", entry)
+		}
+		schedules[kind] = strings.TrimSpace(spec)
+	}
+	for kind, spec := range schedules {
+		if spec == "off" {
+			continue
+		}
+		if err := jobs.Schedule(kind, spec, kind); err != nil {
+			return fmt.Errorf("JOBS_SCHEDULES: %w", err)
+		}
+	}
+	return nil
+}
+
+// watchTenants drops the tenants cached by f whenever they change.
+func watchTenants(f *multitenant.CachedFetcher) *multitenant.CachedFetcher {
+	models.OnTenantChange(f.InvalidateTenant)
+	// A restored tenant may still be cached as unknown under its subdomain
+	models.OnTenantTransition(func(_ context.Context, t models.TenantTransition) { f.Invalidate(t.Subdomain) })
+	return f
+}
+
+// platformTask is a kind of platform job running fn, within timeout when set. A failed run is not
+// retried: the next scheduled run picks up the work.
+func platformTask(name string, timeout time.Duration, fn func(ctx context.Context) error) jobs.Kind {
+	return jobs.Kind{
+		Name:        name,
+		MaxAttempts: 1,
+		Timeout:     timeout,
+		Handler:     func(ctx context.Context, _ *models.Job) error { return fn(ctx) },
+	}
+}
+
+// every calls fn every d until ctx is done.
+func every(ctx context.Context, d time.Duration, fn func()) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// ListenAndServe serves the application on SERVER_ADDR or, with TLS_ACME, with ACME certificates
+// on TLS_ADDR and the challenges and redirects on TLS_HTTP_ADDR.
+func (a *App) ListenAndServe(ctx context.Context) error {
+	cfg := a.Config
+	if !cfg.TLS.ACME {
+		slog.Info("Starting HTTP server", "addr", cfg.Server.Addr)
+		return http.ListenAndServe(cfg.Server.Addr, a)
+	}
+
+	certManager, err := certs.New(cfg)
+	if err != nil {
+		return fmt.Errorf("TLS: %w", err)
+	}
+	certManager.Start(ctx)
+	go func() {
+		slog.Info("Starting HTTP challenge server", "addr", cfg.TLS.HTTPAddr)
+		if err := http.ListenAndServe(cfg.TLS.HTTPAddr, certManager.HTTPHandler(nil)); err != nil {
+			slog.Error("HTTP challenge server exited with error", "error", err)
+		}
+	}()
+	server := &http.Server{Addr: cfg.TLS.Addr, Handler: a, TLSConfig: certManager.TLSConfig()}
+	slog.Info("Starting HTTPS server", "addr", cfg.TLS.Addr)
+	return server.ListenAndServeTLS("", "")
+}